@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/listener"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// adminCmd groups commands that call the admin API of a running instance
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "manages a running iam-runtime-static instance using the admin API",
+}
+
+// adminPatchPolicyCmd patches the active policy of a running instance
+var adminPatchPolicyCmd = &cobra.Command{
+	Use:   "patch-policy",
+	Short: "applies a JSON Patch or overlay merge patch to the active policy and prints the result",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return adminPatchPolicy(cmd)
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, adminCmd)
+	registerCommand(adminCmd, adminPatchPolicyCmd, addFormatFlag)
+
+	adminCmd.PersistentFlags().String("address", "", "address of the instance to manage (default is the configured listen address)")
+	adminCmd.PersistentFlags().String("token", "", "admin token sent with each call (default is the configured admin token; prefer IAMRUNTIME_ADMIN_TOKEN)")
+
+	adminPatchPolicyCmd.Flags().String("json-patch", "", "file containing an RFC 6902 JSON Patch document")
+	adminPatchPolicyCmd.Flags().String("merge-patch", "", "file containing a policy overlay document")
+	adminPatchPolicyCmd.MarkFlagsMutuallyExclusive("json-patch", "merge-patch")
+}
+
+// dialAdmin connects to the admin API of the instance named by the --address flag.
+func dialAdmin(cmd *cobra.Command) (admin.AdminClient, *grpc.ClientConn, error) {
+	address, _ := cmd.Flags().GetString("address")
+	if address == "" {
+		address = viper.GetString("listen")
+	}
+
+	addr, err := listener.Parse(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+
+	token, _ := cmd.Flags().GetString("token")
+	if token == "" {
+		token = viper.GetString("admin.token")
+	}
+
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(adminToken(token)))
+	}
+
+	conn, err := grpc.Dial(addr.DialTarget(), opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return admin.NewAdminClient(conn), conn, nil
+}
+
+// adminToken sends the admin token as a bearer Authorization header with each call.
+type adminToken string
+
+func (t adminToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity reports false, since the admin API is often served on a Unix socket.
+func (t adminToken) RequireTransportSecurity() bool {
+	return false
+}
+
+func adminPatchPolicy(cmd *cobra.Command) error {
+	jsonPatchPath, _ := cmd.Flags().GetString("json-patch")
+	mergePatchPath, _ := cmd.Flags().GetString("merge-patch")
+
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	req := &admin.PatchPolicyRequest{}
+
+	switch {
+	case jsonPatchPath != "":
+		b, err := os.ReadFile(jsonPatchPath)
+		if err != nil {
+			return err
+		}
+
+		req.Patch = &admin.PatchPolicyRequest_JsonPatch{JsonPatch: b}
+	case mergePatchPath != "":
+		b, err := os.ReadFile(mergePatchPath)
+		if err != nil {
+			return err
+		}
+
+		req.Patch = &admin.PatchPolicyRequest_MergePatch{MergePatch: b}
+	default:
+		return errors.New("one of --json-patch or --merge-patch is required")
+	}
+
+	client, conn, err := dialAdmin(cmd)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	resp, err := client.PatchPolicy(context.Background(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(cmd, format, resp, func(w io.Writer) error {
+		_, err := fmt.Fprint(w, resp.Policy)
+
+		return err
+	})
+}
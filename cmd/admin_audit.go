@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// adminAuditCmd prints audit records from a running instance as JSON lines
+var adminAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "prints audit records from a running instance as JSON lines, acknowledging them for a named consumer",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return adminAudit(cmd)
+	},
+}
+
+func init() {
+	registerCommand(adminCmd, adminAuditCmd)
+
+	adminAuditCmd.Flags().String("consumer", "", "consumer name to resume from and acknowledge printed records for")
+	adminAuditCmd.Flags().Uint64("cursor", 0, "print records after this cursor instead of the consumer's acknowledged cursor")
+	adminAuditCmd.Flags().Bool("follow", false, "keep printing records as they are written")
+}
+
+// auditLine is the JSON form of a printed audit record.
+type auditLine struct {
+	Cursor uint64         `json:"cursor"`
+	Kind   string         `json:"kind"`
+	Time   time.Time      `json:"time"`
+	Event  map[string]any `json:"event"`
+}
+
+func adminAudit(cmd *cobra.Command) error {
+	consumer, _ := cmd.Flags().GetString("consumer")
+	cursor, _ := cmd.Flags().GetUint64("cursor")
+	follow, _ := cmd.Flags().GetBool("follow")
+
+	client, conn, err := dialAdmin(cmd)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	stream, err := client.TailAudit(ctx, &admin.TailAuditRequest{
+		Consumer: consumer,
+		Cursor:   cursor,
+		Follow:   follow,
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(cmd.OutOrStdout())
+
+	for {
+		rec, err := stream.Recv()
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case status.Code(err) == codes.Canceled && ctx.Err() != nil:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		if err := enc.Encode(auditLine{
+			Cursor: rec.Cursor,
+			Kind:   rec.Kind,
+			Time:   rec.Time.AsTime(),
+			Event:  rec.Event.AsMap(),
+		}); err != nil {
+			return err
+		}
+
+		// Acknowledge only what was printed, so an interrupted run resumes where it stopped.
+		if consumer != "" {
+			if _, err := client.AckAudit(ctx, &admin.AckAuditRequest{Consumer: consumer, Cursor: rec.Cursor}); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+
+				return err
+			}
+		}
+	}
+}
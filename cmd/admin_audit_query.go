@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// adminAuditQueryCmd prints retained audit records matching a filter as JSON lines
+var adminAuditQueryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "prints retained audit records of a running instance matching a filter as JSON lines, oldest first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return adminAuditQuery(cmd)
+	},
+}
+
+func init() {
+	registerCommand(adminAuditCmd, adminAuditQueryCmd)
+
+	flags := adminAuditQueryCmd.Flags()
+	flags.String("subject", "", "only print decisions for this subject, or made by it as an actor")
+	flags.String("action", "", "only print decisions for this action")
+	flags.String("resource", "", "only print decisions for this resource ID")
+	flags.String("decision", "", "only print decisions with this outcome: allowed or denied")
+	flags.String("kind", "", "only print records of this kind, such as policy_loaded")
+	flags.String("since", "", "only print records written at or after this time, as RFC 3339 or a duration before now")
+	flags.String("until", "", "only print records written before this time, as RFC 3339 or a duration before now")
+	flags.Int("limit", 0, "print at most this many records (0 prints all)")
+}
+
+func adminAuditQuery(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+	subject, _ := flags.GetString("subject")
+	action, _ := flags.GetString("action")
+	resource, _ := flags.GetString("resource")
+	decision, _ := flags.GetString("decision")
+	kind, _ := flags.GetString("kind")
+	limit, _ := flags.GetInt("limit")
+
+	req := &admin.QueryAuditRequest{
+		Subject:    subject,
+		Action:     action,
+		ResourceId: resource,
+		Kind:       kind,
+	}
+
+	switch decision {
+	case "":
+	case "allowed":
+		req.Decision = admin.DecisionOutcome_DECISION_OUTCOME_ALLOWED
+	case "denied":
+		req.Decision = admin.DecisionOutcome_DECISION_OUTCOME_DENIED
+	default:
+		return fmt.Errorf("--decision must be allowed or denied, got %q", decision)
+	}
+
+	for name, ts := range map[string]**timestamppb.Timestamp{"since": &req.Since, "until": &req.Until} {
+		value, _ := flags.GetString(name)
+		if value == "" {
+			continue
+		}
+
+		t, err := parseQueryTime(value)
+		if err != nil {
+			return fmt.Errorf("--%s: %w", name, err)
+		}
+
+		*ts = timestamppb.New(t)
+	}
+
+	client, conn, err := dialAdmin(cmd)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	printed := 0
+
+	for {
+		if limit > 0 {
+			req.PageSize = int32(min(limit-printed, 1000))
+		}
+
+		resp, err := client.QueryAudit(context.Background(), req)
+		if err != nil {
+			return err
+		}
+
+		for _, rec := range resp.Records {
+			if err := enc.Encode(auditLine{
+				Cursor: rec.Cursor,
+				Kind:   rec.Kind,
+				Time:   rec.Time.AsTime(),
+				Event:  rec.Event.AsMap(),
+			}); err != nil {
+				return err
+			}
+		}
+
+		printed += len(resp.Records)
+
+		if resp.NextPageToken == "" || (limit > 0 && printed >= limit) {
+			return nil
+		}
+
+		req.PageToken = resp.NextPageToken
+	}
+}
+
+// parseQueryTime parses an RFC 3339 time, or a duration before now.
+func parseQueryTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", value)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"github.com/spf13/cobra"
+)
+
+// adminCoverageCmd reports which grants of a running instance's policy have allowed requests
+var adminCoverageCmd = &cobra.Command{
+	Use:   "coverage",
+	Short: "reports how often each grant in the active policy has allowed a request, to find unused grants",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		unmatched, _ := cmd.Flags().GetBool("unmatched")
+		reset, _ := cmd.Flags().GetBool("reset")
+		failUnder, _ := cmd.Flags().GetFloat64("fail-under")
+
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		client, conn, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+
+		resp, err := client.GetCoverage(context.Background(), &admin.GetCoverageRequest{
+			UnmatchedOnly: unmatched,
+			ResetCounters: reset,
+		})
+		if err != nil {
+			return err
+		}
+
+		percent := 100.0
+		if resp.Total > 0 {
+			percent = 100 * float64(resp.Matched) / float64(resp.Total)
+		}
+
+		if err := writeOutput(cmd, format, resp, func(w io.Writer) error {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "HOLDER\tRESOURCE\tACTION\tRULE\tHITS\tLAST HIT")
+
+			for _, g := range resp.Grants {
+				holder := g.Subject
+				if g.Role != "" {
+					holder = "role:" + g.Role
+				}
+
+				lastHit := "-"
+				if g.LastHit != nil {
+					lastHit = g.LastHit.AsTime().Format(time.RFC3339)
+				}
+
+				ruleID := g.RuleId
+				if ruleID == "" {
+					ruleID = "-"
+				}
+
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", holder, g.ResourceId, g.Action, ruleID, g.Hits, lastHit)
+			}
+
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+
+			_, err := fmt.Fprintf(w, "\n%d of %d grant actions matched since %s (%.1f%%)\n", resp.Matched, resp.Total, resp.Since.AsTime().Format(time.RFC3339), percent)
+
+			return err
+		}); err != nil {
+			return err
+		}
+
+		if percent < failUnder {
+			return fmt.Errorf("coverage %.1f%% is below %.1f%%", percent, failUnder)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	registerCommand(adminCmd, adminCoverageCmd, addFormatFlag)
+
+	adminCoverageCmd.Flags().Bool("unmatched", false, "list only grants that have not allowed any request")
+	adminCoverageCmd.Flags().Bool("reset", false, "reset the counters after reporting them")
+	adminCoverageCmd.Flags().Float64("fail-under", 0, "exit with an error if less than this percentage of grant actions matched")
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// adminExpiringCmd lists upcoming grant expirations of a running instance
+var adminExpiringCmd = &cobra.Command{
+	Use:   "expiring",
+	Short: "lists grants in the active policy that are about to expire, soonest first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		within, _ := cmd.Flags().GetDuration("within")
+
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		client, conn, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+
+		resp, err := client.ListExpiringGrants(context.Background(), &admin.ListExpiringGrantsRequest{
+			Within: durationpb.New(within),
+		})
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(cmd, format, resp, func(w io.Writer) error {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "EXPIRES\tIN\tHOLDER\tRESOURCE\tACTIONS")
+
+			for _, g := range resp.Grants {
+				holder := g.Subject
+				if g.Role != "" {
+					holder = "role:" + g.Role
+				}
+
+				expiresAt := g.ExpiresAt.AsTime()
+
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+					expiresAt.Format(time.RFC3339),
+					time.Until(expiresAt).Round(time.Second),
+					holder,
+					g.ResourceId,
+					strings.Join(g.Actions, ","),
+				)
+			}
+
+			return tw.Flush()
+		})
+	},
+}
+
+func init() {
+	registerCommand(adminCmd, adminExpiringCmd, addFormatFlag)
+
+	adminExpiringCmd.Flags().Duration("within", 7*24*time.Hour, "only list grants expiring within this duration (0 lists all)")
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"github.com/spf13/cobra"
+)
+
+// adminFeaturesCmd lists the feature flags of a running instance
+var adminFeaturesCmd = &cobra.Command{
+	Use:   "features",
+	Short: "lists the experimental feature flags of a running instance and their settings",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		client, conn, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+
+		resp, err := client.ListFeatures(context.Background(), &admin.ListFeaturesRequest{})
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(cmd, format, resp, func(w io.Writer) error {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "FEATURE\tENABLED\tSUBJECTS\tDESCRIPTION")
+
+			for _, f := range resp.Features {
+				fmt.Fprintf(tw, "%s\t%t\t%s\t%s\n", f.Name, f.Enabled, formatFeatureSubjects(f.Subjects), f.Description)
+			}
+
+			return tw.Flush()
+		})
+	},
+}
+
+// adminSetFeatureCmd changes a feature flag of a running instance
+var adminSetFeatureCmd = &cobra.Command{
+	Use:   "set-feature <name>",
+	Short: "enables or disables an experimental feature flag globally or for a single subject",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		subject, _ := cmd.Flags().GetString("subject")
+		disable, _ := cmd.Flags().GetBool("disable")
+		clear, _ := cmd.Flags().GetBool("clear")
+
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		client, conn, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+
+		resp, err := client.SetFeature(context.Background(), &admin.SetFeatureRequest{
+			Name:    args[0],
+			Subject: subject,
+			Enabled: !disable,
+			Clear:   clear,
+		})
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(cmd, format, resp, func(w io.Writer) error {
+			f := resp.Feature
+			_, err := fmt.Fprintf(w, "%s: enabled=%t subjects=%s\n", f.Name, f.Enabled, formatFeatureSubjects(f.Subjects))
+
+			return err
+		})
+	},
+}
+
+func init() {
+	registerCommand(adminCmd, adminFeaturesCmd, addFormatFlag)
+	registerCommand(adminCmd, adminSetFeatureCmd, addFormatFlag)
+
+	adminSetFeatureCmd.Flags().String("subject", "", "change the flag for this subject only (default is all subjects)")
+	adminSetFeatureCmd.Flags().Bool("disable", false, "disable the flag instead of enabling it")
+	adminSetFeatureCmd.Flags().Bool("clear", false, "remove the subject's override so the global setting applies")
+	adminSetFeatureCmd.MarkFlagsMutuallyExclusive("disable", "clear")
+}
+
+// formatFeatureSubjects formats subject overrides as a sorted list of subject=enabled pairs.
+func formatFeatureSubjects(subjects map[string]bool) string {
+	if len(subjects) == 0 {
+		return "-"
+	}
+
+	pairs := make([]string, 0, len(subjects))
+	for subject, enabled := range subjects {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", subject, enabled))
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"text/tabwriter"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"github.com/spf13/cobra"
+)
+
+// adminSnapshotsCmd lists the policy snapshots retained by a running instance
+var adminSnapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "lists the active policy and the previous policies a running instance can roll back to",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		client, conn, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+
+		resp, err := client.ListPolicySnapshots(context.Background(), &admin.ListPolicySnapshotsRequest{})
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(cmd, format, resp, func(w io.Writer) error {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ACTIVE\tREVISION\tSOURCE\tLOADED\tSUBJECTS")
+
+			for _, snap := range resp.Snapshots {
+				active := ""
+				if snap.Active {
+					active = "*"
+				}
+
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", active, snap.Revision, snap.Source, snap.LoadedAt.AsTime().Format(time.RFC3339), snap.Subjects)
+			}
+
+			return tw.Flush()
+		})
+	},
+}
+
+// adminRollbackCmd rolls a running instance back to a retained policy snapshot
+var adminRollbackCmd = &cobra.Command{
+	Use:   "rollback <revision>",
+	Short: "makes a retained policy snapshot active again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		reason, _ := cmd.Flags().GetString("reason")
+		requestedBy, _ := cmd.Flags().GetString("requested-by")
+
+		if requestedBy == "" {
+			requestedBy = defaultRequester()
+		}
+
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		client, conn, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+
+		resp, err := client.RollbackPolicy(context.Background(), &admin.RollbackPolicyRequest{
+			Revision:    args[0],
+			Reason:      reason,
+			RequestedBy: requestedBy,
+		})
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(cmd, format, resp, func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "rolled back to %s from %s\n", resp.Policy.Revision, resp.Policy.Source)
+
+			return err
+		})
+	},
+}
+
+func init() {
+	registerCommand(adminCmd, adminSnapshotsCmd, addFormatFlag)
+	registerCommand(adminCmd, adminRollbackCmd, addFormatFlag)
+
+	adminRollbackCmd.Flags().String("reason", "", "why the policy is being rolled back, for the audit log (required)")
+	_ = adminRollbackCmd.MarkFlagRequired("reason")
+	adminRollbackCmd.Flags().String("requested-by", "", "who is rolling back, for the audit log (default is user@host)")
+}
+
+// defaultRequester returns user@host for the current user, or an empty string if unknown.
+func defaultRequester() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return u.Username
+	}
+
+	return u.Username + "@" + host
+}
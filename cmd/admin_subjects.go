@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// adminAddSubjectCmd adds a subject to the active policy of a running instance
+var adminAddSubjectCmd = &cobra.Command{
+	Use:   "add-subject <subject>",
+	Short: "adds a subject with the given grants and roles to the active policy",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		grantSpecs, _ := cmd.Flags().GetStringArray("grant")
+		roles, _ := cmd.Flags().GetStringSlice("role")
+
+		req := &admin.AddSubjectRequest{SubjectId: args[0], Roles: roles}
+
+		for _, spec := range grantSpecs {
+			resourceID, actions, ok := strings.Cut(spec, "=")
+			if !ok || resourceID == "" || actions == "" {
+				return fmt.Errorf("grant '%s' must be resource=action[,action...]", spec)
+			}
+
+			req.Grants = append(req.Grants, &admin.Grant{ResourceId: resourceID, Actions: strings.Split(actions, ",")})
+		}
+
+		return callAdminMutation(cmd, func(ctx context.Context, client admin.AdminClient) (string, error) {
+			resp, err := client.AddSubject(ctx, req)
+
+			return resp.GetRevision(), err
+		})
+	},
+}
+
+// adminRemoveSubjectCmd removes a subject from the active policy of a running instance
+var adminRemoveSubjectCmd = &cobra.Command{
+	Use:   "remove-subject <subject>",
+	Short: "removes a subject from the active policy",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return callAdminMutation(cmd, func(ctx context.Context, client admin.AdminClient) (string, error) {
+			resp, err := client.RemoveSubject(ctx, &admin.RemoveSubjectRequest{SubjectId: args[0]})
+
+			return resp.GetRevision(), err
+		})
+	},
+}
+
+// adminGrantCmd grants a subject actions on a resource in the active policy of a running instance
+var adminGrantCmd = &cobra.Command{
+	Use:   "grant <subject>",
+	Short: "grants a subject actions on a resource in the active policy",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resourceID, _ := cmd.Flags().GetString("resource")
+		actions, _ := cmd.Flags().GetStringSlice("action")
+
+		return callAdminMutation(cmd, func(ctx context.Context, client admin.AdminClient) (string, error) {
+			resp, err := client.GrantAccess(ctx, &admin.GrantAccessRequest{
+				SubjectId:  args[0],
+				ResourceId: resourceID,
+				Actions:    actions,
+			})
+
+			return resp.GetRevision(), err
+		})
+	},
+}
+
+// adminRevokeCmd revokes a subject's actions on a resource in the active policy of a running
+// instance
+var adminRevokeCmd = &cobra.Command{
+	Use:   "revoke <subject>",
+	Short: "revokes a subject's actions on a resource, or its whole grant, in the active policy",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resourceID, _ := cmd.Flags().GetString("resource")
+		actions, _ := cmd.Flags().GetStringSlice("action")
+
+		return callAdminMutation(cmd, func(ctx context.Context, client admin.AdminClient) (string, error) {
+			resp, err := client.RevokeAccess(ctx, &admin.RevokeAccessRequest{
+				SubjectId:  args[0],
+				ResourceId: resourceID,
+				Actions:    actions,
+			})
+
+			return resp.GetRevision(), err
+		})
+	},
+}
+
+// adminMintTokenCmd mints an ephemeral token for a subject of a running instance
+var adminMintTokenCmd = &cobra.Command{
+	Use:   "mint-token <subject>",
+	Short: "mints an ephemeral token authenticating a subject and prints it",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		client, conn, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+
+		req := &admin.MintTokenRequest{SubjectId: args[0]}
+		if ttl > 0 {
+			req.Ttl = durationpb.New(ttl)
+		}
+
+		resp, err := client.MintToken(context.Background(), req)
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(cmd, format, resp, func(w io.Writer) error {
+			fmt.Fprintln(w, resp.Token)
+			fmt.Fprintf(cmd.ErrOrStderr(), "expires at %s\n", resp.ExpiresAt.AsTime().Format("2006-01-02T15:04:05Z07:00"))
+
+			return nil
+		})
+	},
+}
+
+func init() {
+	registerCommand(adminCmd, adminAddSubjectCmd, addFormatFlag)
+	registerCommand(adminCmd, adminRemoveSubjectCmd, addFormatFlag)
+	registerCommand(adminCmd, adminGrantCmd, addFormatFlag)
+	registerCommand(adminCmd, adminRevokeCmd, addFormatFlag)
+	registerCommand(adminCmd, adminMintTokenCmd, addFormatFlag)
+
+	adminAddSubjectCmd.Flags().StringArray("grant", nil, "grant actions on a resource, as resource=action[,action...] (repeatable)")
+	adminAddSubjectCmd.Flags().StringSlice("role", nil, "role to give the subject, optionally pinned as id@version (repeatable)")
+
+	for _, c := range []*cobra.Command{adminGrantCmd, adminRevokeCmd} {
+		c.Flags().String("resource", "", "resource ID of the grant")
+		_ = c.MarkFlagRequired("resource")
+	}
+
+	adminGrantCmd.Flags().StringSlice("action", nil, "action to grant (repeatable)")
+	_ = adminGrantCmd.MarkFlagRequired("action")
+
+	adminRevokeCmd.Flags().StringSlice("action", nil, "action to revoke (repeatable; default is the whole grant)")
+
+	adminMintTokenCmd.Flags().Duration("ttl", 0, "how long the token is valid (default is the instance's OAuth2 token TTL)")
+}
+
+// adminMutationReport is the JSON report of a policy mutation.
+type adminMutationReport struct {
+	// Revision is the revision of the resulting active policy.
+	Revision string `json:"revision"`
+}
+
+// callAdminMutation connects to the admin API, makes a policy mutation with call, and prints the
+// revision of the resulting policy.
+func callAdminMutation(cmd *cobra.Command, call func(context.Context, admin.AdminClient) (string, error)) error {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	client, conn, err := dialAdmin(cmd)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	revision, err := call(context.Background(), client)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(cmd, format, adminMutationReport{Revision: revision}, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "active policy revision: %s\n", revision)
+
+		return err
+	})
+}
@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"github.com/spf13/cobra"
+)
+
+// ANSI escape sequences used to draw the dashboard.
+const (
+	ansiAltScreenOn  = "\x1b[?1049h"
+	ansiAltScreenOff = "\x1b[?1049l"
+	ansiClear        = "\x1b[H\x1b[2J"
+	ansiHideCursor   = "\x1b[?25l"
+	ansiShowCursor   = "\x1b[?25h"
+)
+
+// topDeniedSubjects is the number of subjects shown in the top denied list.
+const topDeniedSubjects = 5
+
+// adminTopCmd shows a live dashboard of a running instance
+var adminTopCmd = &cobra.Command{
+	Use:   "top",
+	Short: "shows a live dashboard of decision rates, recent decisions, and the active policy",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return adminTop(cmd)
+	},
+}
+
+func init() {
+	registerCommand(adminCmd, adminTopCmd)
+
+	adminTopCmd.Flags().Duration("interval", time.Second, "how often to refresh")
+	adminTopCmd.Flags().Int("decisions", 15, "number of recent decisions to show")
+}
+
+func adminTop(cmd *cobra.Command) error {
+	interval, _ := cmd.Flags().GetDuration("interval")
+	rows, _ := cmd.Flags().GetInt("decisions")
+
+	client, conn, err := dialAdmin(cmd)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	out := cmd.OutOrStdout()
+
+	fmt.Fprint(out, ansiAltScreenOn+ansiHideCursor)
+	defer fmt.Fprint(out, ansiShowCursor+ansiAltScreenOff)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev *topSample
+
+	for {
+		sample := &topSample{at: time.Now()}
+		sample.stats, sample.err = client.GetStats(ctx, &admin.GetStatsRequest{MaxRecentDecisions: int32(rows)})
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		drawTop(out, cmd.Flag("address").Value.String(), sample, prev, rows)
+
+		if sample.err == nil {
+			prev = sample
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// topSample is a single GetStats poll.
+type topSample struct {
+	at    time.Time
+	stats *admin.GetStatsResponse
+	err   error
+}
+
+func drawTop(w io.Writer, address string, cur, prev *topSample, rows int) {
+	var b strings.Builder
+
+	b.WriteString(ansiClear)
+
+	if address == "" {
+		address = "(configured listen address)"
+	}
+
+	fmt.Fprintf(&b, "iam-runtime-static top - %s - %s\n\n", address, cur.at.Format(time.TimeOnly))
+
+	if cur.err != nil {
+		fmt.Fprintf(&b, "error: %v\n", cur.err)
+		fmt.Fprint(w, b.String())
+
+		return
+	}
+
+	stats := cur.stats
+
+	fmt.Fprintf(&b, "policy    %s (%s)\n", shortRevision(stats.PolicyRevision), stats.PolicySource)
+	fmt.Fprintf(&b, "uptime    %s\n", cur.at.Sub(stats.StartedAt.AsTime()).Truncate(time.Second))
+	fmt.Fprintf(&b, "total     %d allowed, %d denied\n", stats.Allowed, stats.Denied)
+
+	if prev != nil {
+		elapsed := cur.at.Sub(prev.at).Seconds()
+
+		allowedRate := float64(stats.Allowed-prev.stats.Allowed) / elapsed
+		deniedRate := float64(stats.Denied-prev.stats.Denied) / elapsed
+
+		fmt.Fprintf(&b, "rate      %.1f/s (%.1f/s allowed, %.1f/s denied)\n", allowedRate+deniedRate, allowedRate, deniedRate)
+	} else {
+		b.WriteString("rate      -\n")
+	}
+
+	b.WriteString("\ntop denied subjects\n")
+
+	for _, sub := range topDenied(stats.DeniedBySubject, topDeniedSubjects) {
+		fmt.Fprintf(&b, "  %-30s %d\n", sub, stats.DeniedBySubject[sub])
+	}
+
+	b.WriteString("\nrecent decisions\n")
+
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  TIME\tRESULT\tSUBJECT\tACTION\tRESOURCE")
+
+	for i, d := range stats.RecentDecisions {
+		if i >= rows {
+			break
+		}
+
+		result := "allow"
+		if !d.Allowed {
+			result = "deny"
+		}
+
+		subject := d.Subject
+		if d.Actor != "" {
+			subject = d.Actor + " as " + d.Subject
+		}
+
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", d.Time.AsTime().Local().Format(time.TimeOnly), result, subject, d.Action, d.ResourceId)
+	}
+
+	_ = tw.Flush()
+
+	fmt.Fprint(w, b.String())
+}
+
+// topDenied returns up to n subjects with the most denials, most denied first.
+func topDenied(counts map[string]uint64, n int) []string {
+	out := make([]string, 0, len(counts))
+	for sub := range counts {
+		out = append(out, sub)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if counts[out[i]] != counts[out[j]] {
+			return counts[out[i]] > counts[out[j]]
+		}
+
+		return out[i] < out[j]
+	})
+
+	if len(out) > n {
+		out = out[:n]
+	}
+
+	return out
+}
+
+func shortRevision(rev string) string {
+	if len(rev) > 12 {
+		return rev[:12]
+	}
+
+	return rev
+}
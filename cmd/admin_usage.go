@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// adminUsageCmd reports how much each subject of a running instance's policy is used
+var adminUsageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "reports how many requests each subject in the active policy has made and when it was last seen, to find stale subjects",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		idle, _ := cmd.Flags().GetDuration("idle")
+		reset, _ := cmd.Flags().GetBool("reset")
+
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		client, conn, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+
+		req := &admin.GetSubjectUsageRequest{
+			ResetCounters: reset,
+		}
+
+		if cmd.Flags().Changed("idle") {
+			req.IdleFor = durationpb.New(idle)
+		}
+
+		resp, err := client.GetSubjectUsage(context.Background(), req)
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(cmd, format, resp, func(w io.Writer) error {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "SUBJECT\tTOKENS\tREQUESTS\tALLOWED\tDENIED\tLAST SEEN\tIDLE SINCE\tDISABLED")
+
+			for _, u := range resp.Subjects {
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", u.Subject, u.Tokens, u.Requests, u.Allowed, u.Denied,
+					formatUsageTime(u.LastSeen), formatUsageTime(u.IdleSince), formatUsageTime(u.DisabledAt))
+			}
+
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+
+			_, err := fmt.Fprintf(w, "\n%d of %d subjects seen since %s\n", resp.Seen, resp.Total, resp.Since.AsTime().Format(time.RFC3339))
+
+			return err
+		})
+	},
+}
+
+// adminEnableSubjectCmd enables a subject disabled for being stale on a running instance again
+var adminEnableSubjectCmd = &cobra.Command{
+	Use:   "enable-subject <subject>",
+	Short: "enables a subject disabled for not having been seen for the stale-subject period again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		client, conn, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+
+		defer conn.Close()
+
+		resp, err := client.EnableSubject(context.Background(), &admin.EnableSubjectRequest{SubjectId: args[0]})
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(cmd, format, resp, func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "enabled %s, disabled since %s\n", args[0], resp.DisabledAt.AsTime().Format(time.RFC3339))
+
+			return err
+		})
+	},
+}
+
+// formatUsageTime formats a time in the usage report, or returns - if it is unset.
+func formatUsageTime(t *timestamppb.Timestamp) string {
+	if t == nil {
+		return "-"
+	}
+
+	return t.AsTime().Format(time.RFC3339)
+}
+
+func init() {
+	registerCommand(adminCmd, adminUsageCmd, addFormatFlag)
+	registerCommand(adminCmd, adminEnableSubjectCmd, addFormatFlag)
+
+	adminUsageCmd.Flags().Duration("idle", 0, "list only subjects not seen for at least this long, including those never seen")
+	adminUsageCmd.Flags().Bool("reset", false, "reset the counters after reporting them")
+}
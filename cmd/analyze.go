@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+// analyzeCmd reports privilege-escalation paths in the policy
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "reports privilege-escalation paths in the policy: access to the policy source, admin access with wildcard grants, and delegation cycles",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policyResources, _ := cmd.Flags().GetStringSlice("policy-resource")
+		adminActions, _ := cmd.Flags().GetStringSlice("admin-action")
+
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		decrypter, err := newPolicyDecrypter(cmd)
+		if err != nil {
+			return err
+		}
+
+		findings, err := server.Analyze(policyPath(cmd), policyOverlays(cmd), policyReadFunc(cmd, decrypter), server.AnalyzeOptions{
+			PolicyResources: policyResources,
+			AdminActions:    adminActions,
+		})
+		if err != nil {
+			return err
+		}
+
+		if findings == nil {
+			findings = []server.Finding{}
+		}
+
+		if err := writeOutput(cmd, format, findings, func(w io.Writer) error {
+			for _, f := range findings {
+				fmt.Fprintln(w, f)
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if len(findings) > 0 {
+			return fmt.Errorf("%d findings", len(findings))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, analyzeCmd, addPolicyFlag, addFormatFlag)
+
+	analyzeCmd.Flags().StringSlice("policy-resource", nil, "resource ID or pattern standing for where the policy is stored, such as its git repository (repeatable)")
+	analyzeCmd.Flags().StringSlice("admin-action", nil, "action or pattern giving access to the admin API (repeatable)")
+}
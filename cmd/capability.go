@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/capability"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// capabilityTokenReport is the JSON report of the capability issue and attenuate commands.
+type capabilityTokenReport struct {
+	Token string `json:"token"`
+}
+
+// capabilityGrantReport is the JSON report of the capability verify command.
+type capabilityGrantReport struct {
+	Subject   string   `json:"subject"`
+	Actions   []string `json:"actions"`
+	Resources []string `json:"resources"`
+	// ExpiresAt is when the token expires, taking its caveats into account.
+	ExpiresAt time.Time              `json:"expiresAt"`
+	Caveats   []capabilityCaveatInfo `json:"caveats"`
+}
+
+// capabilityCaveatInfo is a caveat in the JSON report of the capability verify command.
+type capabilityCaveatInfo struct {
+	Actions   []string   `json:"actions,omitempty"`
+	Resources []string   `json:"resources,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// capabilityCmd groups commands for capability tokens
+var capabilityCmd = &cobra.Command{
+	Use:   "capability",
+	Short: "issues and verifies capability tokens, which carry a signed grant instead of being listed in the policy",
+}
+
+// capabilityIssueCmd issues a capability token
+var capabilityIssueCmd = &cobra.Command{
+	Use:   "issue <subject>",
+	Short: "issues a capability token authenticating a subject for the given actions on the given resources",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		actions, _ := cmd.Flags().GetStringSlice("action")
+		resources, _ := cmd.Flags().GetStringSlice("resource")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+
+		if ttl <= 0 {
+			return fmt.Errorf("ttl must be positive, got %s", ttl)
+		}
+
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		signer, err := capabilitySignerFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		token, err := signer.Issue(capability.Grant{
+			Subject:   args[0],
+			Actions:   actions,
+			Resources: resources,
+			ExpiresAt: time.Now().Add(ttl),
+		})
+		if err != nil {
+			return err
+		}
+
+		return writeToken(cmd, format, viper.GetString("credential-namespace.prefix")+token)
+	},
+}
+
+// capabilityAttenuateCmd derives a narrower capability token
+var capabilityAttenuateCmd = &cobra.Command{
+	Use:   "attenuate <token>",
+	Short: "derives a narrower token from a capability token by adding a caveat, without the signing key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		actions, _ := cmd.Flags().GetStringSlice("action")
+		resources, _ := cmd.Flags().GetStringSlice("resource")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+
+		caveat := capability.Caveat{Actions: actions, Resources: resources}
+
+		if ttl < 0 {
+			return fmt.Errorf("ttl must be positive, got %s", ttl)
+		}
+
+		if ttl > 0 {
+			exp := time.Now().Add(ttl)
+			caveat.ExpiresAt = &exp
+		}
+
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		prefix := viper.GetString("credential-namespace.prefix")
+
+		token, err := capability.Attenuate(strings.TrimPrefix(args[0], prefix), caveat)
+		if err != nil {
+			return err
+		}
+
+		return writeToken(cmd, format, prefix+token)
+	},
+}
+
+// capabilityVerifyCmd verifies a capability token and prints its grant
+var capabilityVerifyCmd = &cobra.Command{
+	Use:   "verify <token>",
+	Short: "verifies a capability token's signature and expiry and prints its grant",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		signer, err := capabilitySignerFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		token := strings.TrimPrefix(args[0], viper.GetString("credential-namespace.prefix"))
+
+		grant, err := signer.Verify(token, time.Now())
+		if err != nil {
+			return err
+		}
+
+		report := capabilityGrantReport{
+			Subject:   grant.Subject,
+			Actions:   grant.Actions,
+			Resources: grant.Resources,
+			ExpiresAt: grant.Expiry(),
+			Caveats:   make([]capabilityCaveatInfo, len(grant.Caveats)),
+		}
+
+		for i, c := range grant.Caveats {
+			report.Caveats[i] = capabilityCaveatInfo(c)
+		}
+
+		return writeOutput(cmd, format, report, func(w io.Writer) error {
+			fmt.Fprintf(w, "subject:    %s\n", grant.Subject)
+			fmt.Fprintf(w, "actions:    %s\n", strings.Join(grant.Actions, ", "))
+			fmt.Fprintf(w, "resources:  %s\n", strings.Join(grant.Resources, ", "))
+			fmt.Fprintf(w, "expires at: %s\n", grant.Expiry().Format(time.RFC3339))
+
+			for i, c := range grant.Caveats {
+				fmt.Fprintf(w, "caveat %d:   %s\n", i+1, formatCaveat(c))
+			}
+
+			return nil
+		})
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, capabilityCmd)
+	registerCommand(capabilityCmd, capabilityIssueCmd, addFormatFlag)
+	registerCommand(capabilityCmd, capabilityAttenuateCmd, addFormatFlag)
+	registerCommand(capabilityCmd, capabilityVerifyCmd, addFormatFlag)
+
+	capabilityCmd.PersistentFlags().String("signing-key-file", "", "file holding the signing key (default is the configured capability signing key file)")
+
+	capabilityIssueCmd.Flags().StringSlice("action", nil, "action the token is limited to, or a pattern (repeatable)")
+	capabilityIssueCmd.Flags().StringSlice("resource", nil, "resource ID the token is limited to, or a pattern (repeatable)")
+	capabilityIssueCmd.Flags().Duration("ttl", time.Hour, "how long the token is valid")
+	_ = capabilityIssueCmd.MarkFlagRequired("action")
+	_ = capabilityIssueCmd.MarkFlagRequired("resource")
+
+	capabilityAttenuateCmd.Flags().StringSlice("action", nil, "action the derived token is limited to, or a pattern (repeatable)")
+	capabilityAttenuateCmd.Flags().StringSlice("resource", nil, "resource ID the derived token is limited to, or a pattern (repeatable)")
+	capabilityAttenuateCmd.Flags().Duration("ttl", 0, "expire the derived token after this long, if sooner than the token it is derived from")
+}
+
+// writeToken writes a capability token issued or derived by cmd in format.
+func writeToken(cmd *cobra.Command, format, token string) error {
+	return writeOutput(cmd, format, capabilityTokenReport{Token: token}, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, token)
+
+		return err
+	})
+}
+
+// formatCaveat describes the restrictions of a caveat.
+func formatCaveat(c capability.Caveat) string {
+	var parts []string
+
+	if len(c.Actions) > 0 {
+		parts = append(parts, "actions "+strings.Join(c.Actions, ", "))
+	}
+
+	if len(c.Resources) > 0 {
+		parts = append(parts, "resources "+strings.Join(c.Resources, ", "))
+	}
+
+	if c.ExpiresAt != nil {
+		parts = append(parts, "expires at "+c.ExpiresAt.Format(time.RFC3339))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// capabilitySignerFromFlags returns the signer for the key file given to a command, falling back to
+// the configured key file.
+func capabilitySignerFromFlags(cmd *cobra.Command) (*capability.Signer, error) {
+	path, _ := cmd.Flags().GetString("signing-key-file")
+	if path == "" {
+		path = viper.GetString("capabilities.signing-key-file")
+	}
+
+	if path == "" {
+		return nil, errors.New("a signing key file is required: set --signing-key-file or capabilities.signing-key-file")
+	}
+
+	return readCapabilitySigner(path)
+}
+
+// readCapabilitySigner returns a signer for the key in the file at path. Surrounding whitespace,
+// such as a trailing newline, is not part of the key.
+func readCapabilitySigner(path string) (*capability.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return capability.NewSigner(bytes.TrimSpace(b))
+}
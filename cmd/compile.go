@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+// compileVerifyReport is the JSON report of the compile command with --verify.
+type compileVerifyReport struct {
+	Matches bool `json:"matches"`
+	// Mismatch says where the artifact first differs, if it does not match.
+	Mismatch string `json:"mismatch,omitempty"`
+}
+
+// compileCmd compiles the policy into a reproducible artifact
+var compileCmd = &cobra.Command{
+	Use:   "compile",
+	Short: "compiles the policy into a reproducible artifact with roles, inherited grants, and implied actions expanded",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		decrypter, err := newPolicyDecrypter(cmd)
+		if err != nil {
+			return err
+		}
+
+		if artifactPath, _ := cmd.Flags().GetString("verify"); artifactPath != "" {
+			format, err := outputFormat(cmd)
+			if err != nil {
+				return err
+			}
+
+			artifact, err := os.ReadFile(artifactPath)
+			if err != nil {
+				return err
+			}
+
+			err = server.VerifyCompiled(policyPath(cmd), policyOverlays(cmd), artifact, policyReadFunc(cmd, decrypter))
+			if err != nil && !errors.Is(err, server.ErrArtifactMismatch) {
+				return err
+			}
+
+			report := compileVerifyReport{Matches: err == nil}
+			if err != nil {
+				report.Mismatch = err.Error()
+			}
+
+			// Mismatches are reported by the error alone in text.
+			if werr := writeOutput(cmd, format, report, func(io.Writer) error { return nil }); werr != nil {
+				return werr
+			}
+
+			return err
+		}
+
+		var w io.Writer = cmd.OutOrStdout()
+
+		if outPath, _ := cmd.Flags().GetString("output"); outPath != "" {
+			f, err := os.Create(outPath)
+			if err != nil {
+				return err
+			}
+
+			defer f.Close()
+
+			w = f
+		}
+
+		return server.Compile(policyPath(cmd), policyOverlays(cmd), w, policyReadFunc(cmd, decrypter))
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, compileCmd, addPolicyFlag)
+
+	compileCmd.Flags().StringP("output", "o", "", "file to write the artifact to (default is stdout)")
+	compileCmd.Flags().String("verify", "", "instead of compiling, check that this artifact was compiled from the policy")
+	compileCmd.MarkFlagsMutuallyExclusive("output", "verify")
+	compileCmd.Flags().String("format", formatText, "output format of the --verify report: text, json, or yaml")
+	compileCmd.MarkFlagsMutuallyExclusive("output", "format")
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// configValidateReport is the JSON report of the config validate command.
+type configValidateReport struct {
+	Valid bool `json:"valid"`
+	// Errors lists each problem found, in the order they were found.
+	Errors []string `json:"errors"`
+	// Config is the effective configuration with secrets redacted, keyed by configuration key. It
+	// is only set for valid configurations.
+	Config map[string]any `json:"config,omitempty"`
+}
+
+// configCmd groups commands for working with the runtime configuration
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "inspects the iam-runtime-static configuration",
+}
+
+// configValidateCmd validates the runtime configuration
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "validates the configuration and prints the effective configuration with secrets redacted",
+	// Validation failures are not usage errors.
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return configValidate(cmd, viper.GetViper())
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, configCmd)
+	registerCommand(configCmd, configValidateCmd, addFormatFlag)
+}
+
+func configValidate(cmd *cobra.Command, v *viper.Viper) error {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadStrict(v)
+	if err != nil {
+		err = fmt.Errorf("failed to load configuration: %w", err)
+
+		return configInvalid(cmd, format, err, []string{err.Error()})
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return configInvalid(cmd, format, fmt.Errorf("invalid configuration:\n%w", err), errorList(err))
+	}
+
+	redacted, err := cfg.RedactedMap()
+	if err != nil {
+		return err
+	}
+
+	report := configValidateReport{Valid: true, Errors: []string{}, Config: redacted}
+
+	return writeOutput(cmd, format, report, func(w io.Writer) error {
+		out, err := yaml.Marshal(cfg.Redacted())
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(out)
+
+		return err
+	})
+}
+
+// configInvalid reports an invalid configuration in format and returns err, which is the whole
+// text report.
+func configInvalid(cmd *cobra.Command, format string, err error, errs []string) error {
+	report := configValidateReport{Errors: errs}
+
+	if werr := writeOutput(cmd, format, report, func(io.Writer) error { return nil }); werr != nil {
+		return werr
+	}
+
+	return err
+}
+
+// errorList returns the messages of the errors joined in err, or of err alone.
+func errorList(err error) []string {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []string{err.Error()}
+	}
+
+	var out []string
+
+	for _, e := range joined.Unwrap() {
+		out = append(out, e.Error())
+	}
+
+	return out
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/conformance"
+	"github.com/metal-toolbox/iam-runtime-static/internal/listener"
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authentication"
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// conformanceReport is the JSON report of the conformance command.
+type conformanceReport struct {
+	Passed  int                 `json:"passed"`
+	Failed  int                 `json:"failed"`
+	Results []conformanceResult `json:"results"`
+}
+
+// conformanceResult is the result of a scenario in the JSON report of the conformance command.
+type conformanceResult struct {
+	Scenario string `json:"scenario"`
+	Passed   bool   `json:"passed"`
+	// Failures describe how the target differed from the expectation or reference.
+	Failures []string `json:"failures"`
+}
+
+// conformanceCmd checks that an iam-runtime implementation behaves like the static runtime
+var conformanceCmd = &cobra.Command{
+	Use:   "conformance",
+	Short: "runs authentication and authorization scenarios against an iam-runtime endpoint, using the static runtime as the reference",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runConformance(cmd)
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, conformanceCmd, addPolicyFlag, addFormatFlag)
+
+	conformanceCmd.Flags().String("scenarios", "", "scenario file to run")
+	conformanceCmd.Flags().String("target", "", "address of the iam-runtime to test: a unix socket path, or tcp://host:port")
+	conformanceCmd.Flags().Bool("no-reference", false, "compare results with the scenario expectations only, without a static reference runtime")
+	conformanceCmd.Flags().Duration("timeout", 10*time.Second, "timeout for each call")
+
+	_ = conformanceCmd.MarkFlagRequired("scenarios")
+	_ = conformanceCmd.MarkFlagRequired("target")
+}
+
+func runConformance(cmd *cobra.Command) error {
+	scenariosPath, _ := cmd.Flags().GetString("scenarios")
+	target, _ := cmd.Flags().GetString("target")
+	noReference, _ := cmd.Flags().GetBool("no-reference")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	suite, err := conformance.Load(scenariosPath)
+	if err != nil {
+		return err
+	}
+
+	targetConn, err := dialRuntime(target)
+	if err != nil {
+		return err
+	}
+
+	defer targetConn.Close()
+
+	var reference grpc.ClientConnInterface
+
+	if !noReference && policyPath(cmd) != "" {
+		refConn, stop, err := startReferenceRuntime(cmd, suite)
+		if err != nil {
+			return err
+		}
+
+		defer stop()
+
+		reference = refConn
+	}
+
+	report := conformanceReport{Results: []conformanceResult{}}
+
+	for _, res := range suite.Run(cmd.Context(), targetConn, reference, timeout) {
+		result := conformanceResult{Scenario: res.Scenario, Passed: res.Passed(), Failures: res.Failures}
+
+		if result.Passed {
+			report.Passed++
+			result.Failures = []string{}
+		} else {
+			report.Failed++
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	if err := writeOutput(cmd, format, report, func(w io.Writer) error {
+		for _, res := range report.Results {
+			if res.Passed {
+				fmt.Fprintf(w, "PASS  %s\n", res.Scenario)
+			} else {
+				fmt.Fprintf(w, "FAIL  %s: %s\n", res.Scenario, strings.Join(res.Failures, "; "))
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d scenarios failed", report.Failed, len(suite.Scenarios))
+	}
+
+	return nil
+}
+
+// dialRuntime connects to the iam-runtime at the given listen address.
+func dialRuntime(address string) (*grpc.ClientConn, error) {
+	addr, err := listener.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return grpc.Dial(addr.DialTarget(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
+
+// startReferenceRuntime serves the command's policy on a loopback port, resolving policy tokens
+// from the suite's env, and returns a connection to it.
+func startReferenceRuntime(cmd *cobra.Command, suite *conformance.Suite) (*grpc.ClientConn, func(), error) {
+	decrypter, err := newPolicyDecrypter(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	iamSrv, err := server.NewServer(policyPath(cmd), zap.NewNop().Sugar(),
+		server.WithPolicyOverlays(policyOverlays(cmd)...),
+		server.WithPolicyDecrypter(decrypter),
+		server.WithEnv(suite.Getenv),
+		server.WithoutMetrics(),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("starting reference runtime: %w", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	grpcSrv := grpc.NewServer()
+	authorization.RegisterAuthorizationServer(grpcSrv, iamSrv)
+	authentication.RegisterAuthenticationServer(grpcSrv, iamSrv)
+
+	go func() {
+		_ = grpcSrv.Serve(lis)
+	}()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		grpcSrv.Stop()
+
+		return nil, nil, err
+	}
+
+	stop := func() {
+		conn.Close()
+		grpcSrv.Stop()
+	}
+
+	return conn, stop, nil
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/config"
+)
+
+// Token variables referenced by the ephemeral policy. They are resolved by the server without
+// touching the process environment.
+const (
+	ephemeralAdminTokenVar  = "EPHEMERAL_ADMIN_TOKEN"
+	ephemeralReaderTokenVar = "EPHEMERAL_READER_TOKEN"
+)
+
+// ephemeralPolicy grants the admin subject every example action and the reader subject only read.
+const ephemeralPolicy = `# Generated by iam-runtime-static serve --ephemeral. Removed on exit.
+subjects:
+  - id: admin
+    tokens: [{envVar: ` + ephemeralAdminTokenVar + `}]
+    resources:
+      - id: example
+        actions: [create, read, update, delete]
+  - id: reader
+    tokens: [{envVar: ` + ephemeralReaderTokenVar + `}]
+    resources:
+      - id: example
+        actions: [read]
+`
+
+// ephemeralTokenBytes is the number of random bytes in each generated token.
+const ephemeralTokenBytes = 24
+
+// ephemeral is a generated policy and its tokens, kept in a temporary directory.
+type ephemeral struct {
+	dir    string
+	tokens map[string]string
+}
+
+// newEphemeral writes the generated policy to a new temporary directory and points cfg at it. If
+// listenSet is false, the runtime listens on a socket in the same directory. The caller must call
+// cleanup once the server has stopped.
+func newEphemeral(cfg *config.Config, listenSet bool) (*ephemeral, error) {
+	if cfg.PolicyGit.Enabled() {
+		return nil, fmt.Errorf("--ephemeral cannot be used with git sync: %w", config.ErrConflictingOptions)
+	}
+
+	tokens := make(map[string]string, 2)
+
+	for _, key := range []string{ephemeralAdminTokenVar, ephemeralReaderTokenVar} {
+		b := make([]byte, ephemeralTokenBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		tokens[key] = hex.EncodeToString(b)
+	}
+
+	dir, err := os.MkdirTemp("", appName+"-")
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ephemeral{
+		dir:    dir,
+		tokens: tokens,
+	}
+
+	policyPath := filepath.Join(dir, "policy.yaml")
+
+	if err := os.WriteFile(policyPath, []byte(ephemeralPolicy), 0o600); err != nil {
+		out.cleanup()
+
+		return nil, err
+	}
+
+	cfg.Policy = policyPath
+	cfg.PolicyDir = ""
+	cfg.PolicyYAML = ""
+	cfg.PolicyOverlays = nil
+
+	if !listenSet {
+		cfg.Listen = filepath.Join(dir, "runtime.sock")
+	}
+
+	return out, nil
+}
+
+// getenv resolves the generated token variables.
+func (e *ephemeral) getenv(key string) string {
+	return e.tokens[key]
+}
+
+// printSummary writes the listen address and the generated subjects and tokens to w.
+func (e *ephemeral) printSummary(w io.Writer, cfg config.Config) {
+	fmt.Fprintf(w, "Ephemeral runtime listening on %s\n", cfg.Listen)
+	fmt.Fprintf(w, "Policy: %s\n\n", cfg.Policy)
+	fmt.Fprintf(w, "  admin   (create, read, update, delete on example)  %s\n", e.tokens[ephemeralAdminTokenVar])
+	fmt.Fprintf(w, "  reader  (read on example)                          %s\n\n", e.tokens[ephemeralReaderTokenVar])
+	fmt.Fprintln(w, "Everything is removed when the runtime exits.")
+}
+
+// cleanup removes the generated policy and socket.
+func (e *ephemeral) cleanup() {
+	if err := os.RemoveAll(e.dir); err != nil {
+		logger.Warnw("failed to remove ephemeral runtime directory", "dir", e.dir, "error", err)
+	}
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/config"
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+	"github.com/spf13/viper"
+)
+
+// exitCode is the status the process exits with when the runtime fails to start.
+type exitCode int
+
+const (
+	// exitFailure is any failure without a more specific exit code.
+	exitFailure exitCode = 1
+	// exitConfig is an invalid configuration.
+	exitConfig exitCode = 2
+	// exitPolicy is a policy that could not be read, parsed, or compiled.
+	exitPolicy exitCode = 3
+	// exitMissingToken is a policy token or client secret without a value.
+	exitMissingToken exitCode = 4
+	// exitBind is a listener that could not be opened.
+	exitBind exitCode = 5
+	// exitTLS is a TLS certificate, key, or CA that could not be loaded.
+	exitTLS exitCode = 6
+)
+
+// String returns the name of the exit code used in error reports.
+func (c exitCode) String() string {
+	switch c {
+	case exitConfig:
+		return "config"
+	case exitPolicy:
+		return "policy"
+	case exitMissingToken:
+		return "missing_token"
+	case exitBind:
+		return "bind"
+	case exitTLS:
+		return "tls"
+	default:
+		return "failure"
+	}
+}
+
+// policyExitCode returns the exit code for an error loading the policy.
+func policyExitCode(err error) exitCode {
+	if errors.Is(err, server.ErrMissingToken) {
+		return exitMissingToken
+	}
+
+	return exitPolicy
+}
+
+// startupReport is the JSON error report written to stderr when the runtime fails to start.
+type startupReport struct {
+	Kind     string `json:"kind"`
+	ExitCode int    `json:"exitCode"`
+	Message  string `json:"message"`
+	Error    string `json:"error"`
+}
+
+// fatal logs a failure to start the runtime and exits with the given code. With --json-errors, a
+// JSON report of the failure is also written to stderr as a single line.
+func fatal(code exitCode, msg string, err error) {
+	logger.Errorw(msg, "error", err, "exit_code", int(code), "kind", code.String())
+
+	_ = logger.Sync()
+
+	if viper.GetBool("json-errors") {
+		_ = json.NewEncoder(os.Stderr).Encode(startupReport{
+			Kind:     code.String(),
+			ExitCode: int(code),
+			Message:  msg,
+			Error:    err.Error(),
+		})
+	}
+
+	os.Exit(int(code))
+}
+
+// degrade handles a subsystem failing to start. If the subsystem fails open, the failure is logged
+// with how the runtime continues, given by fallback. Otherwise, the runtime exits as with fatal.
+func degrade(startup config.Startup, subsystem string, code exitCode, msg string, err error, fallback string) {
+	if !startup.FailsOpen(subsystem) {
+		fatal(code, msg, err)
+	}
+
+	logger.Warnw(msg+"; continuing degraded", "subsystem", subsystem, "fallback", fallback, "error", err)
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+// exportCmd writes the policy in a normalized form for diffing and external tools
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "writes the policy in a normalized form, or with --effective, fully flattened with the source of every grant",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		effective, _ := cmd.Flags().GetBool("effective")
+		format, _ := cmd.Flags().GetString("format")
+
+		decrypter, err := newPolicyDecrypter(cmd)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = cmd.OutOrStdout()
+
+		if outPath, _ := cmd.Flags().GetString("output"); outPath != "" {
+			f, err := os.Create(outPath)
+			if err != nil {
+				return err
+			}
+
+			defer f.Close()
+
+			w = f
+		}
+
+		return server.Export(policyPath(cmd), policyOverlays(cmd), w, policyReadFunc(cmd, decrypter), format, effective)
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, exportCmd, addPolicyFlag)
+
+	exportCmd.Flags().Bool("effective", false, "export the effective policy: roles, inherited grants, and implied actions expanded, with wildcards and conditions annotated")
+	exportCmd.Flags().String("format", server.ExportYAML, "output format: yaml or json")
+	exportCmd.Flags().StringP("output", "o", "", "file to write the export to (default is stdout)")
+}
@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/apitier"
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authentication"
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxGatewayBody is the largest request body the HTTP gateway accepts.
+const maxGatewayBody = 1 << 20
+
+// newGatewayHandler returns the handler for the HTTP gateway, which serves AuthenticateSubject
+// and CheckAccess as JSON endpoints, along with the admin calls that mutate the active policy and
+// mint tokens if withAdmin is set and gate allows them. Requests and responses use the protobuf
+// JSON mapping of the gRPC messages, and calls go through the same server logic as gRPC requests.
+func newGatewayHandler(srv server.Server, withAdmin bool, gate *apitier.Gate) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/authenticate", gatewayHandler("/"+authentication.Authentication_ServiceDesc.ServiceName+"/AuthenticateSubject",
+		func() proto.Message { return &authentication.AuthenticateSubjectRequest{} },
+		func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			return srv.AuthenticateSubject(ctx, req.(*authentication.AuthenticateSubjectRequest))
+		}))
+
+	mux.Handle("/check-access", gatewayHandler("/"+authorization.Authorization_ServiceDesc.ServiceName+"/CheckAccess",
+		func() proto.Message { return &authorization.CheckAccessRequest{} },
+		func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			return srv.CheckAccess(ctx, req.(*authorization.CheckAccessRequest))
+		}))
+
+	if withAdmin {
+		adminEndpoints := []struct {
+			path, method string
+			newRequest   func() proto.Message
+			call         func(context.Context, proto.Message) (proto.Message, error)
+		}{
+			{"/admin/add-subject", "AddSubject", func() proto.Message { return &admin.AddSubjectRequest{} }, func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return srv.AddSubject(ctx, req.(*admin.AddSubjectRequest))
+			}},
+			{"/admin/remove-subject", "RemoveSubject", func() proto.Message { return &admin.RemoveSubjectRequest{} }, func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return srv.RemoveSubject(ctx, req.(*admin.RemoveSubjectRequest))
+			}},
+			{"/admin/grant-access", "GrantAccess", func() proto.Message { return &admin.GrantAccessRequest{} }, func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return srv.GrantAccess(ctx, req.(*admin.GrantAccessRequest))
+			}},
+			{"/admin/revoke-access", "RevokeAccess", func() proto.Message { return &admin.RevokeAccessRequest{} }, func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return srv.RevokeAccess(ctx, req.(*admin.RevokeAccessRequest))
+			}},
+			{"/admin/mint-token", "MintToken", func() proto.Message { return &admin.MintTokenRequest{} }, func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				return srv.MintToken(ctx, req.(*admin.MintTokenRequest))
+			}},
+		}
+
+		intercept := srv.AdminUnaryInterceptor()
+
+		for _, e := range adminEndpoints {
+			method, call := "/"+admin.Admin_ServiceDesc.ServiceName+"/"+e.method, e.call
+
+			// As over gRPC, experimental calls are not served unless enabled.
+			if !gate.MethodAllowed(method) {
+				continue
+			}
+
+			// Admin calls are authorized by the same interceptor as over gRPC.
+			mux.Handle(e.path, gatewayHandler(method, e.newRequest, func(ctx context.Context, req proto.Message) (proto.Message, error) {
+				resp, err := intercept(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: method}, func(ctx context.Context, req any) (any, error) {
+					return call(ctx, req.(proto.Message))
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				return resp.(proto.Message), nil
+			}))
+		}
+	}
+
+	return mux
+}
+
+// credentialRequest is a request message carrying a credential.
+type credentialRequest interface {
+	proto.Message
+	GetCredential() string
+}
+
+// gatewayHandler returns a handler decoding a request message created by newRequest from a POST
+// body and responding with the result of call. If the message carries a credential but has none,
+// it is taken from a bearer Authorization header.
+func gatewayHandler(method string, newRequest func() proto.Message, call func(context.Context, proto.Message) (proto.Message, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeGatewayError(w, status.New(codes.Unimplemented, "method not allowed"), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGatewayBody))
+		if err != nil {
+			writeGatewayError(w, status.New(codes.InvalidArgument, "request body is too large or unreadable"), http.StatusBadRequest)
+
+			return
+		}
+
+		req := newRequest()
+
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, req); err != nil {
+			writeGatewayError(w, status.Newf(codes.InvalidArgument, "malformed request body: %v", err), http.StatusBadRequest)
+
+			return
+		}
+
+		if req, ok := req.(credentialRequest); ok && req.GetCredential() == "" {
+			if cred, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				setCredential(req, cred)
+			}
+		}
+
+		stream := &gatewayStream{method: method}
+
+		ctx := grpc.NewContextWithServerTransportStream(gatewayContext(r), stream)
+
+		resp, err := call(ctx, req)
+
+		copyMetadata(w.Header(), stream.header)
+		copyMetadata(w.Header(), stream.trailer)
+
+		if err != nil {
+			st := status.Convert(err)
+			writeGatewayError(w, st, httpStatusFromCode(st.Code()))
+
+			return
+		}
+
+		b, err := protojson.Marshal(resp)
+		if err != nil {
+			writeGatewayError(w, status.New(codes.Internal, "failed to encode response"), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b)
+	})
+}
+
+// setCredential sets the credential of a gateway request message.
+func setCredential(req credentialRequest, cred string) {
+	switch req := req.(type) {
+	case *authentication.AuthenticateSubjectRequest:
+		req.Credential = cred
+	case *authorization.CheckAccessRequest:
+		req.Credential = cred
+	}
+}
+
+// gatewayContext returns the context of a gateway call: the request's headers become incoming
+// metadata, so metadata such as on-behalf-of and credential headers apply, and the client's
+// address becomes the peer, so subjects' allowed networks apply.
+func gatewayContext(r *http.Request) context.Context {
+	md := make(metadata.MD, len(r.Header))
+
+	for key, values := range r.Header {
+		md[strings.ToLower(key)] = values
+	}
+
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+
+	if addr, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: net.TCPAddrFromAddrPort(addr)})
+	}
+
+	return ctx
+}
+
+// gatewayStream collects the headers and trailers a call sets, to return them as HTTP headers.
+type gatewayStream struct {
+	method  string
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *gatewayStream) Method() string {
+	return s.method
+}
+
+func (s *gatewayStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+
+	return nil
+}
+
+func (s *gatewayStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *gatewayStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+
+	return nil
+}
+
+func copyMetadata(h http.Header, md metadata.MD) {
+	for key, values := range md {
+		for _, v := range values {
+			h.Add(key, v)
+		}
+	}
+}
+
+// writeGatewayError responds with a status in its protobuf JSON mapping, including its details,
+// such as the denial reason.
+func writeGatewayError(w http.ResponseWriter, st *status.Status, code int) {
+	b, err := protojson.Marshal(st.Proto())
+	if err != nil {
+		b = []byte(`{"code":13,"message":"failed to encode error"}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(b)
+}
+
+// httpStatusFromCode maps a gRPC status code to the HTTP status code of a gateway response,
+// following the gRPC to HTTP mapping used by grpc-gateway.
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
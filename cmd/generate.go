@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+// generateCmd groups commands that generate policies
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "generates policies",
+}
+
+// generateSyntheticCmd generates a large synthetic policy
+var generateSyntheticCmd = &cobra.Command{
+	Use:   "synthetic",
+	Short: "generates a large, realistic synthetic policy for benchmarking, the same for the same flags",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := server.SyntheticOptions{}
+		opts.Subjects, _ = cmd.Flags().GetInt("subjects")
+		opts.Resources, _ = cmd.Flags().GetInt("resources")
+		opts.Roles, _ = cmd.Flags().GetInt("roles")
+		opts.Seed, _ = cmd.Flags().GetInt64("seed")
+
+		var w io.Writer = cmd.OutOrStdout()
+
+		if outPath, _ := cmd.Flags().GetString("output"); outPath != "" {
+			f, err := os.Create(outPath)
+			if err != nil {
+				return err
+			}
+
+			defer f.Close()
+
+			w = f
+		}
+
+		buf := bufio.NewWriter(w)
+
+		if err := server.GenerateSynthetic(buf, opts); err != nil {
+			return err
+		}
+
+		if err := buf.Flush(); err != nil {
+			return err
+		}
+
+		if tokensPath, _ := cmd.Flags().GetString("tokens-file"); tokensPath != "" {
+			return writeSyntheticTokens(tokensPath, opts)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, generateCmd)
+	registerCommand(generateCmd, generateSyntheticCmd)
+
+	generateSyntheticCmd.Flags().Int("subjects", 1000, "number of subjects")
+	generateSyntheticCmd.Flags().Int("resources", 10000, "number of resources, grouped into tenants of 100")
+	generateSyntheticCmd.Flags().Int("roles", 20, "number of roles")
+	generateSyntheticCmd.Flags().Int64("seed", 1, "seed determining the generated policy")
+	generateSyntheticCmd.Flags().StringP("output", "o", "", "file to write the policy to (default is stdout)")
+	generateSyntheticCmd.Flags().String("tokens-file", "", "also write each subject's ID and token, separated by a space, one per line, to this file")
+}
+
+// writeSyntheticTokens writes the ID and token of every subject of the synthetic policy to path.
+func writeSyntheticTokens(path string, opts server.SyntheticOptions) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+
+	for i := 0; i < opts.Subjects; i++ {
+		id := server.SyntheticSubjectID(i, opts.Subjects)
+
+		fmt.Fprintf(w, "%s %s\n", id, server.SyntheticToken(opts.Seed, id))
+	}
+
+	return w.Flush()
+}
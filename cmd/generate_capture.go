@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+// generateCaptureCmd captures a policy from a live runtime
+var generateCaptureCmd = &cobra.Command{
+	Use:   "from-runtime",
+	Short: "captures a policy granting chosen subjects exactly the actions a live iam-runtime allows them on chosen resources",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		address, _ := cmd.Flags().GetString("address")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		opts := server.CaptureOptions{
+			Getenv: os.Getenv,
+		}
+		opts.Subjects, _ = cmd.Flags().GetStringSlice("subject")
+		opts.Resources, _ = cmd.Flags().GetStringSlice("resource")
+		opts.Actions, _ = cmd.Flags().GetStringSlice("action")
+
+		c, err := client.New(address)
+		if err != nil {
+			return err
+		}
+
+		defer c.Close()
+
+		ctx := cmd.Context()
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		var w io.Writer = cmd.OutOrStdout()
+
+		if outPath, _ := cmd.Flags().GetString("output"); outPath != "" {
+			f, err := os.Create(outPath)
+			if err != nil {
+				return err
+			}
+
+			defer f.Close()
+
+			w = f
+		}
+
+		buf := bufio.NewWriter(w)
+
+		if err := server.CapturePolicy(ctx, buf, c, opts); err != nil {
+			return err
+		}
+
+		return buf.Flush()
+	},
+}
+
+func init() {
+	registerCommand(generateCmd, generateCaptureCmd)
+
+	generateCaptureCmd.Flags().String("address", "", "address of the iam-runtime to capture: a unix socket path, or tcp://host:port")
+	generateCaptureCmd.Flags().StringSlice("subject", nil, "environment variable holding the credential of a subject to capture, as ENV_VAR or ID=ENV_VAR to name the subject instead of using its sub claim (repeatable)")
+	generateCaptureCmd.Flags().StringSlice("resource", nil, "resource ID to check access on (repeatable)")
+	generateCaptureCmd.Flags().StringSlice("action", nil, "action to check on each resource (repeatable)")
+	generateCaptureCmd.Flags().Duration("timeout", time.Minute, "timeout for the whole capture (none if zero)")
+	generateCaptureCmd.Flags().StringP("output", "o", "", "file to write the policy to (default is stdout)")
+
+	_ = generateCaptureCmd.MarkFlagRequired("address")
+}
@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/config"
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultHarnessControlListen is the default address of the harness control endpoint.
+const defaultHarnessControlListen = "127.0.0.1:8090"
+
+// harnessScenario is what a test environment runs against: a policy, the relationships it starts
+// with, and chaos profiles emulating a slow or failing runtime.
+type harnessScenario struct {
+	// Policy is the policy file or directory, relative to the scenario file.
+	Policy string `yaml:"policy"`
+	// Relationships are created when the runtime starts, and again each time it is reset.
+	Relationships []harnessRelationship `yaml:"relationships"`
+	// Chaos adds latency and faults to access checks and RPCs, replacing any configured emulation
+	// profiles.
+	Chaos config.Emulation `yaml:"chaos"`
+	// Clock sets the time the runtime's clock starts at. It starts at the system time if unset.
+	Clock struct {
+		Start time.Time `yaml:"start"`
+	} `yaml:"clock"`
+}
+
+// harnessRelationship is a relationship seeded by the harness.
+type harnessRelationship struct {
+	Resource string `yaml:"resource"`
+	Relation string `yaml:"relation"`
+	Subject  string `yaml:"subject"`
+}
+
+// readHarnessScenario reads the scenario at path, resolving its policy path against the
+// scenario's directory.
+func readHarnessScenario(path string) (harnessScenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return harnessScenario{}, err
+	}
+
+	defer f.Close()
+
+	var out harnessScenario
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&out); err != nil && !errors.Is(err, io.EOF) {
+		return harnessScenario{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if out.Policy == "" {
+		return harnessScenario{}, fmt.Errorf("%s: policy is required: %w", path, config.ErrInvalidValue)
+	}
+
+	for i, rel := range out.Relationships {
+		if rel.Resource == "" || rel.Relation == "" || rel.Subject == "" {
+			return harnessScenario{}, fmt.Errorf("%s: relationship %d: resource, relation, and subject are required: %w", path, i, config.ErrInvalidValue)
+		}
+	}
+
+	if !filepath.IsAbs(out.Policy) {
+		out.Policy = filepath.Join(filepath.Dir(path), out.Policy)
+	}
+
+	return out, nil
+}
+
+// harnessCmd runs the runtime as an end-to-end test environment
+var harnessCmd = &cobra.Command{
+	Use:   "harness",
+	Short: "serves a test scenario with a control endpoint for advancing the clock, reloading the policy, and resetting state",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(viper.GetViper())
+		if err != nil {
+			fatal(exitConfig, "invalid configuration", err)
+		}
+
+		scenarioPath, _ := cmd.Flags().GetString("scenario")
+
+		scenario, err := readHarnessScenario(scenarioPath)
+		if err != nil {
+			fatal(exitConfig, "invalid scenario", err)
+		}
+
+		if cfg.PolicyGit.Enabled() || cfg.PolicyHub.Enabled() {
+			fatal(exitConfig, "invalid configuration", fmt.Errorf("the harness serves the scenario's policy, so it cannot sync one: %w", config.ErrConflictingOptions))
+		}
+
+		dir, err := os.MkdirTemp("", appName+"-harness-")
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if err := os.RemoveAll(dir); err != nil {
+				logger.Warnw("failed to remove harness directory", "dir", dir, "error", err)
+			}
+		}()
+
+		cfg.Policy = scenario.Policy
+		cfg.PolicyDir = ""
+		cfg.PolicyYAML = ""
+		cfg.PolicyOverlays = nil
+
+		if info, err := os.Stat(scenario.Policy); err == nil && info.IsDir() {
+			cfg.Policy = ""
+			cfg.PolicyDir = scenario.Policy
+		}
+
+		if len(scenario.Chaos.ActionProfiles) > 0 || len(scenario.Chaos.RPCProfiles) > 0 {
+			cfg.Emulation = scenario.Chaos
+		}
+
+		switch listen, _ := cmd.Flags().GetString("listen"); {
+		case listen != "":
+			cfg.Listen = listen
+		case !viper.IsSet("listen"):
+			cfg.Listen = filepath.Join(dir, "runtime.sock")
+		}
+
+		controlListen, _ := cmd.Flags().GetString("control-listen")
+		controlToken, _ := cmd.Flags().GetString("control-token")
+
+		// The control endpoint stops the runtime by canceling its context.
+		ctx, stop := context.WithCancel(cmd.Context())
+		defer stop()
+
+		h := &harness{
+			scenario: scenario,
+			token:    controlToken,
+			stop:     stop,
+		}
+
+		started := func(ctx context.Context, srv server.Server, refresh refreshFunc) (func(), error) {
+			return h.start(ctx, controlListen, srv, refresh, cmd.OutOrStdout(), cfg.Listen)
+		}
+
+		return serve(ctx, cfg, started, server.WithAdjustableClock(scenario.Clock.Start))
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, harnessCmd)
+
+	harnessCmd.Flags().String("scenario", "", "scenario file naming the policy, the relationships to seed, and the chaos profiles to apply")
+	_ = harnessCmd.MarkFlagRequired("scenario")
+
+	harnessCmd.Flags().String("listen", "", "address to serve the runtime on (default is a socket in a temporary directory, removed on exit)")
+	harnessCmd.Flags().String("control-listen", defaultHarnessControlListen, "HTTP address of the control endpoint")
+	harnessCmd.Flags().String("control-token", "", "bearer token control requests must carry (not required if empty)")
+}
+
+// harness serves the control endpoint of a running scenario.
+type harness struct {
+	scenario harnessScenario
+	token    string
+	// stop stops the runtime
+	stop func()
+
+	srv     server.Server
+	refresh refreshFunc
+}
+
+// start seeds the scenario's relationships and serves the control endpoint on addr, writing the
+// runtime and control addresses to w. The returned function stops the control endpoint.
+func (h *harness) start(ctx context.Context, addr string, srv server.Server, refresh refreshFunc, w io.Writer, listen string) (func(), error) {
+	h.srv = srv
+	h.refresh = refresh
+
+	if err := h.seed(ctx); err != nil {
+		return nil, err
+	}
+
+	// Listen before serving, so a busy address is reported at startup.
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	controlSrv := &http.Server{
+		Handler:           h.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := controlSrv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorw("harness control endpoint stopped", "error", err)
+		}
+	}()
+
+	fmt.Fprintf(w, "Harness runtime listening on %s\n", listen)
+	fmt.Fprintf(w, "Control endpoint: http://%s\n", lis.Addr())
+
+	return func() {
+		if err := controlSrv.Shutdown(context.Background()); err != nil {
+			logger.Warnw("failed to stop harness control endpoint", "error", err)
+		}
+	}, nil
+}
+
+// seed creates the scenario's relationships.
+func (h *harness) seed(ctx context.Context) error {
+	for _, rel := range h.scenario.Relationships {
+		_, err := h.srv.CreateRelationships(ctx, &authorization.CreateRelationshipsRequest{
+			ResourceId:    rel.Resource,
+			Relationships: []*authorization.Relationship{{Relation: rel.Relation, SubjectId: rel.Subject}},
+		})
+		if err != nil {
+			return fmt.Errorf("seeding relationship %s %s %s: %w", rel.Resource, rel.Relation, rel.Subject, err)
+		}
+	}
+
+	return nil
+}
+
+// harnessStatus is the response of every control request.
+type harnessStatus struct {
+	Policy server.PolicyInfo `json:"policy"`
+	// Now is the time on the runtime's clock.
+	Now time.Time `json:"now"`
+}
+
+// handler returns the control endpoint's handler:
+//
+//   - GET / reports the active policy and the runtime's clock.
+//   - POST /clock/advance?by=<duration> moves the clock forward.
+//   - POST /reload reloads the scenario's policy.
+//   - POST /reset deletes relationships and issued tokens, discards decision counters, moves the
+//     clock back to where it started, reloads the policy, and seeds the scenario's relationships.
+//   - POST /shutdown stops the runtime.
+func (h *harness) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+
+			return
+		}
+
+		h.writeStatus(w)
+	})
+
+	mux.Handle("/clock/advance", h.post(func(ctx context.Context, r *http.Request) error {
+		by, err := time.ParseDuration(r.URL.Query().Get("by"))
+		if err != nil || by <= 0 {
+			return fmt.Errorf("%w: by must be a positive duration, such as 1h", errHarnessBadRequest)
+		}
+
+		_, err = h.srv.AdvanceClock(by)
+
+		return err
+	}))
+
+	mux.Handle("/reload", h.post(func(ctx context.Context, _ *http.Request) error {
+		return h.refresh(ctx)
+	}))
+
+	mux.Handle("/reset", h.post(func(ctx context.Context, _ *http.Request) error {
+		if err := h.srv.ResetState(); err != nil {
+			return err
+		}
+
+		if err := h.refresh(ctx); err != nil {
+			return err
+		}
+
+		return h.seed(ctx)
+	}))
+
+	mux.Handle("/shutdown", h.post(func(context.Context, *http.Request) error {
+		logger.Info("harness shutdown requested")
+
+		// The runtime drains once this responds, since stopping the control endpoint waits for it.
+		h.stop()
+
+		return nil
+	}))
+
+	return mux
+}
+
+// errHarnessBadRequest marks control request errors caused by the request.
+var errHarnessBadRequest = errors.New("bad request")
+
+// post returns a handler calling fn for POST requests carrying the control token, if one is set,
+// and responding with the harness status.
+func (h *harness) post(fn func(ctx context.Context, r *http.Request) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+
+			return
+		}
+
+		if h.token != "" {
+			cred, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(cred), []byte(h.token)) != 1 {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid credential"})
+
+				return
+			}
+		}
+
+		if err := fn(r.Context(), r); err != nil {
+			code := http.StatusUnprocessableEntity
+			if errors.Is(err, errHarnessBadRequest) {
+				code = http.StatusBadRequest
+			}
+
+			logger.Errorw("harness control request failed", "path", r.URL.Path, "error", err)
+			writeJSON(w, code, map[string]string{"error": err.Error()})
+
+			return
+		}
+
+		logger.Infow("harness control request", "path", r.URL.Path)
+
+		h.writeStatus(w)
+	})
+}
+
+func (h *harness) writeStatus(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, harnessStatus{
+		Policy: h.srv.PolicyInfo(),
+		Now:    h.srv.Now(),
+	})
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/config"
+	"github.com/metal-toolbox/iam-runtime-static/internal/metrics"
+	"github.com/metal-toolbox/iam-runtime-static/internal/probe"
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+)
+
+// newHTTPHandler returns the handler for the HTTP listener, serving metrics and health, the policy
+// refresh webhook if a refresh token is configured, and the OAuth2 token endpoint and recent
+// decisions if enabled. The prober, if not nil, reports the latest self-test probe in the health
+// report.
+func newHTTPHandler(cfg config.Config, srv server.Server, prober *probe.Prober, refresh refreshFunc) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/", metrics.Handler(func() any { return newHealthReport(srv, prober) }))
+
+	if cfg.Refresh.Token != "" {
+		mux.Handle("/refresh", refreshHandler(cfg.Refresh.Token, srv, prober, refresh))
+	}
+
+	if cfg.OAuth2.Enabled {
+		mux.Handle("/oauth2/token", tokenHandler(srv))
+	}
+
+	if cfg.RecentDecisions.HTTP {
+		mux.Handle("/debug/decisions", decisionsHandler(srv))
+	}
+
+	return mux
+}
+
+// refreshHandler returns a handler that refetches the policy when called with POST and the given
+// bearer token, responding with the resulting health report.
+func refreshHandler(token string, srv server.Server, prober *probe.Prober, refresh refreshFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+
+			return
+		}
+
+		cred, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(cred), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid credential"})
+
+			return
+		}
+
+		if err := refresh(r.Context()); err != nil {
+			logger.Errorw("policy refresh failed", "error", err)
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+
+			return
+		}
+
+		logger.Infow("policy refreshed", "policy", srv.PolicyInfo())
+
+		writeJSON(w, http.StatusOK, newHealthReport(srv, prober))
+	})
+}
+
+// decisionsHandler returns a handler responding with the most recent decisions, newest first. The
+// limit query parameter caps their number.
+func decisionsHandler(srv server.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := 0
+
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+
+				return
+			}
+
+			limit = n
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"decisions": srv.RecentDecisions(limit)})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(v)
+}
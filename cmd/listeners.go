@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/config"
+	"github.com/metal-toolbox/iam-runtime-static/internal/listener"
+)
+
+// runtimeListener is an address the runtime serves on, with its listener options loaded.
+type runtimeListener struct {
+	addr listener.Address
+	opts listener.Options
+	// The APIs served, or empty for every API
+	apis []string
+}
+
+// apiSet returns a key identifying the APIs the listener serves, shared by listeners serving the
+// same ones.
+func (l runtimeListener) apiSet() string {
+	apis := slices.Clone(l.apis)
+	slices.Sort(apis)
+
+	return strings.Join(slices.Compact(apis), ",")
+}
+
+// prepareListeners parses the runtime's listeners and loads their TLS configuration, so problems
+// are reported before anything is served, and removes stale Unix sockets.
+func prepareListeners(cfg config.Config) []runtimeListener {
+	out := make([]runtimeListener, 0, len(cfg.AllListeners()))
+
+	for _, l := range cfg.AllListeners() {
+		addr, err := listener.Parse(l.Address)
+		if err != nil {
+			fatal(exitConfig, "invalid listen address", err)
+		}
+
+		opts := listener.Options{
+			Owner: l.Socket.Owner,
+			Group: l.Socket.Group,
+		}
+
+		if l.Socket.Mode != "" {
+			opts.Mode, err = listener.ParseMode(l.Socket.Mode)
+			if err != nil {
+				fatal(exitConfig, "invalid socket mode", err)
+			}
+		}
+
+		if l.TLS.Enabled() {
+			opts.TLS, err = listener.LoadTLS(l.TLS.Cert, l.TLS.Key, l.TLS.ClientCA)
+			if err != nil {
+				fatal(exitTLS, "invalid TLS configuration", err)
+			}
+		}
+
+		if addr.Network == listener.NetworkUnix {
+			socketPath := addr.Address
+
+			if _, err := os.Stat(socketPath); err == nil {
+				logger.Warnw("socket found, unlinking", "socket_path", socketPath)
+
+				if err := syscall.Unlink(socketPath); err != nil {
+					fatal(exitBind, "error unlinking socket", err)
+				}
+			}
+		}
+
+		out = append(out, runtimeListener{addr: addr, opts: opts, apis: l.APIs})
+	}
+
+	return out
+}
+
+// serveListeners binds the runtime's listeners and serves each of them with the server for its
+// APIs, from servers.
+func serveListeners(servers map[string]grpcServer, listeners []runtimeListener) {
+	for _, l := range listeners {
+		srv := servers[l.apiSet()]
+
+		lis, err := listener.ListenOptions(l.addr, l.opts)
+		if err != nil {
+			code := exitBind
+			if errors.Is(err, listener.ErrUnknownOwner) {
+				code = exitConfig
+			}
+
+			fatal(code, "failed to listen", err)
+		}
+
+		logger.Infow("starting server",
+			"address", l.addr.String(),
+			"tls", l.opts.TLS != nil,
+			"apis", l.apis,
+		)
+
+		go func() {
+			if err := srv.Serve(lis); err != nil {
+				fatal(exitFailure, "failed starting server", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+)
+
+// grantTypeClientCredentials is the only OAuth2 grant type the token endpoint supports.
+const grantTypeClientCredentials = "client_credentials"
+
+// tokenResponse is a successful OAuth2 access token response (RFC 6749, section 5.1).
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// tokenError is an OAuth2 error response (RFC 6749, section 5.2).
+type tokenError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// tokenHandler returns a handler implementing the OAuth2 client_credentials grant (RFC 6749,
+// section 4.4). Clients authenticate with HTTP basic authentication or with client_id and
+// client_secret form parameters, and receive a bearer token the runtime accepts as a credential.
+func tokenHandler(srv server.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Responses carry credentials and must not be cached.
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, tokenError{Error: "invalid_request", ErrorDescription: "method not allowed"})
+
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			writeJSON(w, http.StatusBadRequest, tokenError{Error: "invalid_request", ErrorDescription: "malformed form body"})
+
+			return
+		}
+
+		if grantType := r.PostForm.Get("grant_type"); grantType != grantTypeClientCredentials {
+			writeJSON(w, http.StatusBadRequest, tokenError{Error: "unsupported_grant_type"})
+
+			return
+		}
+
+		clientID, secret, basic := r.BasicAuth()
+		if basic {
+			// RFC 6749 form-encodes the client ID and secret before basic encoding.
+			clientID, _ = url.QueryUnescape(clientID)
+			secret, _ = url.QueryUnescape(secret)
+		} else {
+			clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+
+		if clientID == "" {
+			writeJSON(w, http.StatusUnauthorized, tokenError{Error: "invalid_client"})
+
+			return
+		}
+
+		issued, err := srv.IssueClientToken(clientID, secret)
+		if err != nil {
+			if !errors.Is(err, server.ErrInvalidClient) {
+				logger.Errorw("failed to issue access token", "error", err)
+				writeJSON(w, http.StatusInternalServerError, tokenError{Error: "server_error"})
+
+				return
+			}
+
+			if basic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="`+appName+`"`)
+			}
+
+			writeJSON(w, http.StatusUnauthorized, tokenError{Error: "invalid_client"})
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, tokenResponse{
+			AccessToken: issued.AccessToken,
+			TokenType:   "Bearer",
+			ExpiresIn:   int64(issued.ExpiresIn.Seconds()),
+		})
+	})
+}
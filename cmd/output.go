@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of commands printing reports.
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
+
+// outputFormats are the formats accepted by --format, in the order they are listed in errors.
+var outputFormats = []string{formatText, formatJSON, formatYAML}
+
+// addFormatFlag adds the --format flag selecting the output format of cmd. Text is for people;
+// JSON and YAML have the same stable schema, for tools.
+func addFormatFlag(cmd *cobra.Command) {
+	cmd.Flags().String("format", formatText, "output format: text, json, or yaml")
+}
+
+// outputFormat returns the format named by the --format flag of cmd.
+func outputFormat(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("format")
+
+	for _, f := range outputFormats {
+		if f == format {
+			return format, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown format '%s': must be text, json, or yaml", format)
+}
+
+// writeOutput writes v to the output of cmd in format: as indented JSON, as YAML with the keys of
+// its JSON form, or, for text, with text. Protobuf messages, such as admin API responses, are
+// written in their protobuf JSON form, with every field present.
+func writeOutput(cmd *cobra.Command, format string, v any, text func(w io.Writer) error) error {
+	w := cmd.OutOrStdout()
+
+	if m, ok := v.(proto.Message); ok && format != formatText {
+		b, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(m)
+		if err != nil {
+			return err
+		}
+
+		// protojson varies its whitespace, so it is re-encoded below.
+		v = json.RawMessage(b)
+	}
+
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(v)
+	case formatYAML:
+		return writeYAML(w, v)
+	default:
+		return text(w)
+	}
+}
+
+// writeYAML writes v as YAML. v is marshaled as JSON first, so the YAML has the same keys, in the
+// same order, as the JSON output.
+func writeYAML(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	// JSON is YAML, so it decodes to a document in the flow style, which is then written in the
+	// block style.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+
+	blockStyle(&doc)
+
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf.Bytes())
+
+	return err
+}
+
+// blockStyle clears the style of n and its descendants, so they are written in the block style
+// with strings quoted only where needed.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
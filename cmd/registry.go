@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// A commandOption adds shared flags to a command as it is registered, such as addPolicyFlag for
+// commands reading a policy and addFormatFlag for commands printing reports.
+type commandOption func(cmd *cobra.Command)
+
+// registerCommand adds cmd to parent, with the shared flags opts add. Every registered command
+// loads the configuration and sets up logging the same way, in the root command's persistent
+// pre-run, and prints its usage for flag and argument errors but not for errors running it.
+func registerCommand(parent, cmd *cobra.Command, opts ...commandOption) {
+	// Cobra only runs the nearest persistent pre-run, so one set here would skip loading the
+	// configuration.
+	if cmd.PersistentPreRun != nil || cmd.PersistentPreRunE != nil {
+		panic(fmt.Sprintf("command %s replaces the root command's persistent pre-run", cmd.Name()))
+	}
+
+	cmd.SilenceUsage = true
+
+	for _, opt := range opts {
+		opt(cmd)
+	}
+
+	parent.AddCommand(cmd)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadPolicy refreshes the policy until ctx is done whenever the process receives SIGHUP and,
+// if files is not empty, whenever one of files, or a policy file in one of them that is a
+// directory, changes. A policy that fails to load is logged and
+// the active policy is kept.
+func reloadPolicy(ctx context.Context, srv server.Server, files []string, refresh refreshFunc) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	defer signal.Stop(hup)
+
+	var (
+		events  <-chan fsnotify.Event
+		errs    <-chan error
+		watched policyWatch
+	)
+
+	if len(files) > 0 {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+
+		defer watcher.Close()
+
+		if watched, err = watchPolicyFiles(watcher, files); err != nil {
+			return err
+		}
+
+		events, errs = watcher.Events, watcher.Errors
+	}
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	reload := func(trigger string) {
+		before := srv.PolicyInfo().Revision
+
+		if err := refresh(ctx); err != nil {
+			logger.Errorw("policy reload failed, keeping the active policy", "trigger", trigger, "error", err)
+
+			return
+		}
+
+		info := srv.PolicyInfo()
+		if info.Revision == before {
+			logger.Debugw("policy unchanged", "trigger", trigger, "revision", info.Revision)
+
+			return
+		}
+
+		logger.Infow("policy reloaded", "trigger", trigger, "policy", info)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			reload("signal")
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			if watched.matches(ev.Name) {
+				timer.Reset(watchDebounce)
+			}
+		case err, ok := <-errs:
+			if !ok {
+				return nil
+			}
+
+			return err
+		case <-timer.C:
+			reload("file")
+		}
+	}
+}
+
+// policyWatch matches the watcher events for a set of policy files and directories.
+type policyWatch struct {
+	files map[string]struct{}
+	dirs  map[string]struct{}
+}
+
+// watchPolicyFiles adds the given policy files and directories to watcher. Files are watched
+// through their directories rather than directly, since many editors and config management tools
+// replace the file, and directories are watched for any policy file in them.
+func watchPolicyFiles(watcher *fsnotify.Watcher, paths []string) (policyWatch, error) {
+	out := policyWatch{
+		files: make(map[string]struct{}, len(paths)),
+		dirs:  make(map[string]struct{}),
+	}
+
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			out.dirs[path] = struct{}{}
+			dir = path
+		} else {
+			out.files[path] = struct{}{}
+		}
+
+		if err := watcher.Add(dir); err != nil {
+			return policyWatch{}, err
+		}
+	}
+
+	return out, nil
+}
+
+// matches reports whether an event for the file name concerns a watched policy file.
+func (w policyWatch) matches(name string) bool {
+	name = filepath.Clean(name)
+
+	if _, ok := w.files[name]; ok {
+		return true
+	}
+
+	_, ok := w.dirs[filepath.Dir(name)]
+
+	return ok && server.IsPolicyFile(name)
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const replHelp = `commands:
+  as <subject>             act as the given subject
+  can <action> <resource>  check whether the current subject may perform action on resource
+  why                      explain the last check
+  list resources           list the current subject's effective grants
+  list subjects            list the policy's subjects
+  help                     show this help
+  exit                     leave the REPL`
+
+// replCmd starts an interactive policy explorer
+var replCmd = &cobra.Command{
+	Use:   "repl",
+	Short: "interactively explore what subjects in a policy can do",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		decrypter, err := newPolicyDecrypter(cmd)
+		if err != nil {
+			return err
+		}
+
+		explorer, err := server.NewExplorer(policyPath(cmd), policyOverlays(cmd), decrypter.ReadFile, clockSkew(cmd))
+		if err != nil {
+			return err
+		}
+
+		return runREPL(explorer, cmd.InOrStdin(), cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, replCmd, addPolicyFlag)
+
+	replCmd.Flags().Duration("clock-skew", 0, "how long expired grants still apply (defaults to the configured clock-skew)")
+}
+
+// clockSkew returns the clock-skew tolerance given to a command, falling back to the configured
+// tolerance.
+func clockSkew(cmd *cobra.Command) time.Duration {
+	if cmd.Flags().Changed("clock-skew") {
+		d, _ := cmd.Flags().GetDuration("clock-skew")
+
+		return d
+	}
+
+	return viper.GetDuration("clock-skew")
+}
+
+func runREPL(explorer *server.Explorer, in io.Reader, out io.Writer) error {
+	var (
+		subject string
+		last    *server.Explanation
+	)
+
+	scanner := bufio.NewScanner(in)
+
+	fmt.Fprintln(out, "type help for commands")
+
+	for {
+		fmt.Fprintf(out, "%s> ", subject)
+
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+
+			return scanner.Err()
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case fields[0] == "exit" || fields[0] == "quit":
+			return nil
+		case fields[0] == "help":
+			fmt.Fprintln(out, replHelp)
+		case fields[0] == "as" && len(fields) == 2:
+			if !explorer.HasSubject(fields[1]) {
+				fmt.Fprintf(out, "unknown subject %s\n", fields[1])
+
+				continue
+			}
+
+			subject = fields[1]
+			last = nil
+		case fields[0] == "can" && len(fields) == 3:
+			if subject == "" {
+				fmt.Fprintln(out, "no subject selected; use: as <subject>")
+
+				continue
+			}
+
+			explanation := explorer.Explain(subject, fields[1], fields[2])
+			last = &explanation
+
+			if explanation.Allowed {
+				fmt.Fprintln(out, "allowed")
+			} else {
+				fmt.Fprintln(out, "denied")
+			}
+		case fields[0] == "why" && len(fields) == 1:
+			if last == nil {
+				fmt.Fprintln(out, "nothing to explain; use: can <action> <resource>")
+
+				continue
+			}
+
+			fmt.Fprintf(out, "  evaluated at %s (clock skew %s)\n", last.EvaluatedAt.Format(time.RFC3339), last.ClockSkew)
+
+			for _, reason := range last.Reasons {
+				fmt.Fprintf(out, "  %s\n", reason)
+			}
+		case len(fields) == 2 && fields[0] == "list" && fields[1] == "subjects":
+			for _, id := range explorer.Subjects() {
+				fmt.Fprintln(out, id)
+			}
+		case len(fields) == 2 && fields[0] == "list" && fields[1] == "resources":
+			if subject == "" {
+				fmt.Fprintln(out, "no subject selected; use: as <subject>")
+
+				continue
+			}
+
+			for _, g := range explorer.Grants(subject) {
+				fmt.Fprintf(out, "%s: %s\n", g.ResourceID, strings.Join(g.Actions, ", "))
+			}
+		default:
+			fmt.Fprintf(out, "unknown command: %s (type help for commands)\n", scanner.Text())
+		}
+	}
+}
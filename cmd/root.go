@@ -2,6 +2,7 @@
 package cmd
 
 import (
+	"os"
 	"strings"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -23,17 +24,22 @@ var rootCmd = &cobra.Command{
 	Use:   appName,
 	Short: "static IAM runtime",
 	Long:  "iam-runtime-static is an IAM runtime implementation that uses static credentials for authentication and authorization.",
+	// Subcommands are added with registerCommand, which keeps them from replacing this.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return initConfig()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	cobra.CheckErr(rootCmd.Execute())
+	// Cobra prints the error, so only the exit code is left to set.
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(int(exitFailure))
+	}
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
-
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/."+appName+".yaml)")
 
 	rootCmd.PersistentFlags().Bool("debug", false, "enable debug logging")
@@ -44,14 +50,16 @@ func init() {
 }
 
 // initConfig reads in config file and ENV variables if set.
-func initConfig() {
+func initConfig() error {
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
 	} else {
 		// Find home directory.
 		home, err := homedir.Dir()
-		cobra.CheckErr(err)
+		if err != nil {
+			return err
+		}
 
 		// Search config in home directory with name ".TODO" (without extension).
 		viper.AddConfigPath(home)
@@ -64,7 +72,9 @@ func initConfig() {
 
 	viper.AutomaticEnv() // read in environment variables that match
 
-	setupLogging()
+	if err := setupLogging(); err != nil {
+		return err
+	}
 
 	// If a config file is found, read it in.
 	err := viper.ReadInConfig()
@@ -73,9 +83,11 @@ func initConfig() {
 			"file", viper.ConfigFileUsed(),
 		)
 	}
+
+	return nil
 }
 
-func setupLogging() {
+func setupLogging() error {
 	cfg := zap.NewProductionConfig()
 	if viper.GetBool("logging.pretty") {
 		cfg = zap.NewDevelopmentConfig()
@@ -89,11 +101,13 @@ func setupLogging() {
 
 	l, err := cfg.Build()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	logger = l.Sugar().With("app", appName)
 	defer logger.Sync() //nolint:errcheck
+
+	return nil
 }
 
 // viperBindFlag provides a wrapper around the viper bindings that handles error checks
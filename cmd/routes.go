@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/middleware"
+
+	"github.com/spf13/cobra"
+)
+
+// routesReport is the JSON report of the routes command.
+type routesReport struct {
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Action     string `json:"action"`
+	ResourceID string `json:"resourceId"`
+	// Subject, Allowed, and Reasons are only set with --subject.
+	Subject string   `json:"subject,omitempty"`
+	Allowed *bool    `json:"allowed,omitempty"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// routesCmd resolves an HTTP request with a middleware route map
+var routesCmd = &cobra.Command{
+	Use:   "routes METHOD PATH",
+	Short: "shows the action and resource ID a middleware route map gives an HTTP request, and with --subject, whether the subject may perform it",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		routesPath, _ := cmd.Flags().GetString("routes")
+		headers, _ := cmd.Flags().GetStringSlice("header")
+		subject, _ := cmd.Flags().GetString("subject")
+
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(routesPath)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		cfg, err := middleware.LoadConfig(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", routesPath, err)
+		}
+
+		u, err := url.ParseRequestURI(args[1])
+		if err != nil {
+			return err
+		}
+
+		req := &http.Request{Method: strings.ToUpper(args[0]), URL: u, Header: make(http.Header)}
+
+		for _, h := range headers {
+			name, value, ok := strings.Cut(h, "=")
+			if !ok {
+				return fmt.Errorf("header '%s': must be name=value", h)
+			}
+
+			req.Header.Add(name, value)
+		}
+
+		match, ok := cfg.MatchRoute(req)
+		if !ok {
+			return fmt.Errorf("%s %s: no route matches", req.Method, u.Path)
+		}
+
+		report := routesReport{Method: req.Method, Path: u.Path, Action: match.Action, ResourceID: match.ResourceID}
+
+		text := func(w io.Writer) error {
+			fmt.Fprintf(w, "%s on %s\n", report.Action, report.ResourceID)
+
+			for _, reason := range report.Reasons {
+				fmt.Fprintf(w, "  %s\n", reason)
+			}
+
+			if report.Allowed != nil && *report.Allowed {
+				fmt.Fprintln(w, "allowed")
+			}
+
+			return nil
+		}
+
+		if subject == "" {
+			return writeOutput(cmd, format, report, text)
+		}
+
+		decrypter, err := newPolicyDecrypter(cmd)
+		if err != nil {
+			return err
+		}
+
+		explorer, err := server.NewExplorer(policyPath(cmd), policyOverlays(cmd), policyReadFunc(cmd, decrypter), clockSkew(cmd))
+		if err != nil {
+			return err
+		}
+
+		if !explorer.HasSubject(subject) {
+			return fmt.Errorf("policy has no subject '%s'", subject)
+		}
+
+		explanation := explorer.Explain(subject, match.Action, match.ResourceID)
+
+		report.Subject = subject
+		report.Allowed = &explanation.Allowed
+		report.Reasons = explanation.Reasons
+
+		if err := writeOutput(cmd, format, report, text); err != nil {
+			return err
+		}
+
+		if !explanation.Allowed {
+			return fmt.Errorf("subject %s may not perform %s on %s", subject, match.Action, match.ResourceID)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, routesCmd, addPolicyFlag, addFormatFlag)
+
+	routesCmd.Flags().String("routes", "", "middleware route map file")
+	routesCmd.Flags().StringSlice("header", nil, "request header as name=value (repeatable)")
+	routesCmd.Flags().String("subject", "", "subject to check the request for against the policy")
+	routesCmd.Flags().Duration("clock-skew", 0, "how long expired grants still apply (defaults to the configured clock-skew)")
+
+	_ = routesCmd.MarkFlagRequired("routes")
+}
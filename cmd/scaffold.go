@@ -0,0 +1,367 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+// Files written by scaffold.
+const (
+	scaffoldPolicyFile    = "policy.yaml"
+	scaffoldScenariosFile = "scenarios.yaml"
+	scaffoldTokensFile    = "tokens.env"
+)
+
+// scaffoldTokenBytes is the number of random bytes in each generated development token.
+const scaffoldTokenBytes = 16
+
+// scaffoldPattern is a starter policy for a common permission model, along with conformance
+// scenarios describing the access it grants.
+type scaffoldPattern struct {
+	description string
+	// tokenVars are the token variables referenced by the policy, in the order written to the
+	// tokens file.
+	tokenVars []string
+	policy    string
+	scenarios string
+}
+
+var scaffoldPatterns = map[string]scaffoldPattern{
+	"rbac": {
+		description: "admin, writer, and reader roles on a shared resource",
+		tokenVars:   []string{"ADMIN_TOKEN", "WRITER_TOKEN", "READER_TOKEN"},
+		policy: `# Role-based access control: each subject is granted one of three roles on the documents
+# resource. Add resources to a role to grant them to every subject holding it.
+implies:
+  document_update: [document_get]
+  document_delete: [document_get]
+roles:
+  - id: reader
+    resources:
+      - id: documents
+        actions: [document_get, document_list]
+  - id: writer
+    resources:
+      - id: documents
+        actions: [document_get, document_list, document_create, document_update]
+  - id: admin
+    resources:
+      - id: documents
+        actions: [document_get, document_list, document_create, document_update, document_delete]
+subjects:
+  - id: admin
+    tokens: [{envVar: ADMIN_TOKEN}]
+    roles: [admin]
+  - id: writer
+    tokens: [{envVar: WRITER_TOKEN}]
+    roles: [writer]
+  - id: reader
+    tokens: [{envVar: READER_TOKEN}]
+    roles: [reader]
+`,
+		scenarios: `scenarios:
+  - name: admin authenticates
+    credential: ${ADMIN_TOKEN}
+    authenticate: true
+    expect: {code: ok, claims: {sub: admin}}
+  - name: admin deletes documents
+    credential: ${ADMIN_TOKEN}
+    check: [{action: document_delete, resource: documents}]
+    expect: {code: ok}
+  - name: writer updates documents
+    credential: ${WRITER_TOKEN}
+    check: [{action: document_update, resource: documents}]
+    expect: {code: ok}
+  - name: writer cannot delete documents
+    credential: ${WRITER_TOKEN}
+    check: [{action: document_delete, resource: documents}]
+    expect: {code: permission_denied}
+  - name: reader lists documents
+    credential: ${READER_TOKEN}
+    check: [{action: document_list, resource: documents}]
+    expect: {code: ok}
+  - name: reader cannot create documents
+    credential: ${READER_TOKEN}
+    check: [{action: document_create, resource: documents}]
+    expect: {code: permission_denied}
+  - name: unknown token is rejected
+    credential: not-a-token
+    check: [{action: document_get, resource: documents}]
+    expect: {code: unauthenticated}
+`,
+	},
+	"multi-tenant": {
+		description: "tenant-scoped roles, with subjects confined to their own tenant's resources",
+		tokenVars:   []string{"ACME_ADMIN_TOKEN", "ACME_MEMBER_TOKEN", "GLOBEX_MEMBER_TOKEN"},
+		policy: `# Multi-tenancy: resources are named after their tenant, and each tenant has its own roles, so
+# granting a role never reaches another tenant's resources.
+roles:
+  - id: acme-member
+    resources:
+      - id: tenant-acme
+        actions: [project_list]
+      - id: acme-project-1
+        actions: [project_get]
+  - id: acme-admin
+    resources:
+      - id: tenant-acme
+        actions: [project_list, project_create]
+      - id: acme-project-1
+        actions: [project_get, project_update, project_delete]
+  - id: globex-member
+    resources:
+      - id: tenant-globex
+        actions: [project_list]
+      - id: globex-project-1
+        actions: [project_get]
+subjects:
+  - id: acme-admin
+    tokens: [{envVar: ACME_ADMIN_TOKEN}]
+    roles: [acme-admin]
+  - id: acme-member
+    tokens: [{envVar: ACME_MEMBER_TOKEN}]
+    roles: [acme-member]
+  - id: globex-member
+    tokens: [{envVar: GLOBEX_MEMBER_TOKEN}]
+    roles: [globex-member]
+`,
+		scenarios: `scenarios:
+  - name: acme admin creates a project in acme
+    credential: ${ACME_ADMIN_TOKEN}
+    check: [{action: project_create, resource: tenant-acme}]
+    expect: {code: ok}
+  - name: acme member reads an acme project
+    credential: ${ACME_MEMBER_TOKEN}
+    check: [{action: project_get, resource: acme-project-1}]
+    expect: {code: ok}
+  - name: acme member cannot update an acme project
+    credential: ${ACME_MEMBER_TOKEN}
+    check: [{action: project_update, resource: acme-project-1}]
+    expect: {code: permission_denied}
+  - name: acme admin cannot read a globex project
+    credential: ${ACME_ADMIN_TOKEN}
+    check: [{action: project_get, resource: globex-project-1}]
+    expect: {code: permission_denied}
+  - name: globex member cannot list acme projects
+    credential: ${GLOBEX_MEMBER_TOKEN}
+    check: [{action: project_list, resource: tenant-acme}]
+    expect: {code: permission_denied}
+`,
+	},
+	"owner": {
+		description: "subjects with full access to the resources they own and read access for support",
+		tokenVars:   []string{"ALICE_TOKEN", "BOB_TOKEN", "SUPPORT_TOKEN"},
+		policy: `# Owner-based access: each subject is granted every action on the resources it owns. A support
+# subject can read, but not change, everyone's resources.
+implies:
+  notebook_update: [notebook_get]
+  notebook_delete: [notebook_get]
+subjects:
+  - id: alice
+    tokens: [{envVar: ALICE_TOKEN}]
+    resources:
+      - id: notebook-alice
+        actions: [notebook_update, notebook_delete, notebook_share]
+  - id: bob
+    tokens: [{envVar: BOB_TOKEN}]
+    resources:
+      - id: notebook-bob
+        actions: [notebook_update, notebook_delete, notebook_share]
+  - id: support
+    tokens: [{envVar: SUPPORT_TOKEN}]
+    resources:
+      - id: notebook-alice
+        actions: [notebook_get]
+      - id: notebook-bob
+        actions: [notebook_get]
+`,
+		scenarios: `scenarios:
+  - name: alice updates her notebook
+    credential: ${ALICE_TOKEN}
+    check: [{action: notebook_update, resource: notebook-alice}]
+    expect: {code: ok}
+  - name: alice reads her notebook
+    credential: ${ALICE_TOKEN}
+    check: [{action: notebook_get, resource: notebook-alice}]
+    expect: {code: ok}
+  - name: alice cannot read bob's notebook
+    credential: ${ALICE_TOKEN}
+    check: [{action: notebook_get, resource: notebook-bob}]
+    expect: {code: permission_denied}
+  - name: support reads both notebooks
+    credential: ${SUPPORT_TOKEN}
+    check:
+      - {action: notebook_get, resource: notebook-alice}
+      - {action: notebook_get, resource: notebook-bob}
+    expect: {code: ok}
+  - name: support cannot delete a notebook
+    credential: ${SUPPORT_TOKEN}
+    check: [{action: notebook_delete, resource: notebook-bob}]
+    expect: {code: permission_denied}
+`,
+	},
+}
+
+// scaffoldCmd writes a starter policy and matching scenarios for a common permission model
+var scaffoldCmd = &cobra.Command{
+	Use:       "scaffold <pattern>",
+	Short:     "writes a starter policy, conformance scenarios, and a tokens file for a common permission model",
+	Long:      "scaffold writes a starter policy, conformance scenarios, and a tokens file for a common permission model.\n\nPatterns:\n" + scaffoldPatternList(),
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: scaffoldPatternNames(),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pattern, ok := scaffoldPatterns[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown pattern %q: must be one of %s", args[0], strings.Join(scaffoldPatternNames(), ", "))
+		}
+
+		dir, _ := cmd.Flags().GetString("dir")
+		force, _ := cmd.Flags().GetBool("force")
+
+		if err := writeScaffold(dir, pattern, force); err != nil {
+			return err
+		}
+
+		printScaffoldNextSteps(cmd.OutOrStdout(), dir)
+
+		return nil
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, scaffoldCmd)
+
+	scaffoldCmd.Flags().String("dir", ".", "directory to write the files to")
+	scaffoldCmd.Flags().Bool("force", false, "overwrite existing files")
+}
+
+func scaffoldPatternNames() []string {
+	names := make([]string, 0, len(scaffoldPatterns))
+	for name := range scaffoldPatterns {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func scaffoldPatternList() string {
+	var b strings.Builder
+
+	for _, name := range scaffoldPatternNames() {
+		fmt.Fprintf(&b, "  %-14s %s\n", name, scaffoldPatterns[name].description)
+	}
+
+	return b.String()
+}
+
+// writeScaffold writes the pattern's files to dir, generating a random development token for each
+// token variable, and validates the written policy. Existing files are only replaced if force is
+// set.
+func writeScaffold(dir string, pattern scaffoldPattern, force bool) error {
+	tokens, err := scaffoldTokens(pattern.tokenVars)
+	if err != nil {
+		return err
+	}
+
+	files := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+	}{
+		{scaffoldPolicyFile, pattern.policy, 0o644},
+		{scaffoldScenariosFile, pattern.scenarios, 0o644},
+		// The tokens are secrets, even if only for development.
+		{scaffoldTokensFile, tokens, 0o600},
+	}
+
+	if !force {
+		for _, f := range files {
+			if err := refuseOverwrite(filepath.Join(dir, f.name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.name), []byte(f.content), f.mode); err != nil {
+			return err
+		}
+	}
+
+	// Token variables are not set while scaffolding, so only errors matter.
+	for _, d := range server.Validate(filepath.Join(dir, scaffoldPolicyFile), nil, nil) {
+		if d.Severity == server.SeverityError {
+			return fmt.Errorf("generated policy is invalid: %s", d)
+		}
+	}
+
+	return nil
+}
+
+// refuseOverwrite returns an error if a file exists at path.
+func refuseOverwrite(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists; use --force to overwrite it", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// scaffoldTokens returns the contents of an env file setting each variable to a random token.
+func scaffoldTokens(vars []string) (string, error) {
+	var b strings.Builder
+
+	b.WriteString("# Development tokens for the scaffolded policy. Do not reuse them elsewhere.\n")
+
+	for _, v := range vars {
+		token := make([]byte, scaffoldTokenBytes)
+		if _, err := rand.Read(token); err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&b, "%s=%s\n", v, hex.EncodeToString(token))
+	}
+
+	return b.String(), nil
+}
+
+func printScaffoldNextSteps(w io.Writer, dir string) {
+	policy := filepath.Join(dir, scaffoldPolicyFile)
+	socket := filepath.Join(os.TempDir(), appName+".sock")
+
+	fmt.Fprintf(w, "Wrote %s, %s, and %s to %s.\n\n", scaffoldPolicyFile, scaffoldScenariosFile, scaffoldTokensFile, dir)
+	fmt.Fprintln(w, "To serve the policy and run its scenarios:")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "  set -a; . %s; set +a\n", sourcePath(filepath.Join(dir, scaffoldTokensFile)))
+	fmt.Fprintf(w, "  %s serve --policy %s --listen %s &\n", appName, policy, socket)
+	fmt.Fprintf(w, "  %s conformance --policy %s --scenarios %s --target %s\n", appName, policy, filepath.Join(dir, scaffoldScenariosFile), socket)
+}
+
+// sourcePath returns path in a form the shell's . command reads from the current directory rather
+// than searching PATH.
+func sourcePath(path string) string {
+	if strings.ContainsRune(path, filepath.Separator) {
+		return path
+	}
+
+	return "." + string(filepath.Separator) + path
+}
@@ -1,19 +1,62 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/metal-toolbox/iam-runtime-static/internal/alert"
+	"github.com/metal-toolbox/iam-runtime-static/internal/apitier"
+	"github.com/metal-toolbox/iam-runtime-static/internal/auditlog"
+	"github.com/metal-toolbox/iam-runtime-static/internal/capability"
+	"github.com/metal-toolbox/iam-runtime-static/internal/decisionlog"
+	// Serialize responses deterministically.
+	_ "github.com/metal-toolbox/iam-runtime-static/internal/codec"
+	"github.com/metal-toolbox/iam-runtime-static/internal/component"
+	"github.com/metal-toolbox/iam-runtime-static/internal/config"
+	"github.com/metal-toolbox/iam-runtime-static/internal/emulation"
+	"github.com/metal-toolbox/iam-runtime-static/internal/enrich"
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/internal/features"
+	"github.com/metal-toolbox/iam-runtime-static/internal/gitsync"
+	"github.com/metal-toolbox/iam-runtime-static/internal/hubsync"
+	"github.com/metal-toolbox/iam-runtime-static/internal/jwtverify"
+	"github.com/metal-toolbox/iam-runtime-static/internal/lastseen"
+	"github.com/metal-toolbox/iam-runtime-static/internal/metrics"
+	"github.com/metal-toolbox/iam-runtime-static/internal/policycrypt"
+	"github.com/metal-toolbox/iam-runtime-static/internal/probe"
+	"github.com/metal-toolbox/iam-runtime-static/internal/profiling"
+	"github.com/metal-toolbox/iam-runtime-static/internal/publish"
+	"github.com/metal-toolbox/iam-runtime-static/internal/resourceid"
+	"github.com/metal-toolbox/iam-runtime-static/internal/rotation"
 	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+	"github.com/metal-toolbox/iam-runtime-static/internal/tracing"
+	// Register the zstd compressor with gRPC.
+	_ "github.com/metal-toolbox/iam-runtime-static/internal/zstd"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/credentials"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/identity"
 
 	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authentication"
 	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	// Register the gzip compressor with gRPC.
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 // serveCmd starts the TODO service
@@ -21,65 +64,1419 @@ var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "starts the iam-runtime-static service",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return serve(cmd.Context(), viper.GetViper())
+		cfg, err := config.Load(viper.GetViper())
+		if err != nil {
+			fatal(exitConfig, "invalid configuration", err)
+		}
+
+		if ephemeralMode, _ := cmd.Flags().GetBool("ephemeral"); ephemeralMode {
+			eph, err := newEphemeral(&cfg, viper.IsSet("listen"))
+			if err != nil {
+				return err
+			}
+
+			defer eph.cleanup()
+
+			eph.printSummary(cmd.OutOrStdout(), cfg)
+
+			return serve(cmd.Context(), cfg, nil, server.WithEnv(eph.getenv))
+		}
+
+		return serve(cmd.Context(), cfg, nil)
 	},
 }
 
 func init() {
-	rootCmd.AddCommand(serveCmd)
+	registerCommand(rootCmd, serveCmd)
 
-	serveCmd.Flags().String("listen", "/var/"+appName+"/runtime.sock", "address to listen on")
+	serveCmd.Flags().String("listen", "/var/"+appName+"/runtime.sock", "address to listen on: a unix socket path, or tcp://host:port (tcp4:// and tcp6:// restrict to a single IP family)")
 	viperBindFlag("listen", serveCmd.Flags().Lookup("listen"))
 
+	serveCmd.Flags().String("socket-mode", "", "octal file mode of the --listen Unix socket (e.g., 0660)")
+	viperBindFlag("socket.mode", serveCmd.Flags().Lookup("socket-mode"))
+
+	serveCmd.Flags().String("socket-owner", "", "user owning the --listen Unix socket, by name or ID")
+	viperBindFlag("socket.owner", serveCmd.Flags().Lookup("socket-owner"))
+
+	serveCmd.Flags().String("socket-group", "", "group owning the --listen Unix socket, by name or ID")
+	viperBindFlag("socket.group", serveCmd.Flags().Lookup("socket-group"))
+
+	serveCmd.Flags().String("tls-cert", "", "PEM certificate for serving TLS on the --listen TCP address")
+	viperBindFlag("tls.cert", serveCmd.Flags().Lookup("tls-cert"))
+
+	serveCmd.Flags().String("tls-key", "", "PEM private key of --tls-cert")
+	viperBindFlag("tls.key", serveCmd.Flags().Lookup("tls-key"))
+
+	serveCmd.Flags().String("tls-client-ca", "", "PEM CA bundle that client certificates must be signed by, requiring mTLS (requires --tls-cert)")
+	viperBindFlag("tls.client-ca", serveCmd.Flags().Lookup("tls-client-ca"))
+
+	serveCmd.Flags().StringSlice("listen-apis", nil, "APIs to serve on --listen, such as authentication (default every API): "+strings.Join(apitier.Names(), ", "))
+	viperBindFlag("listen-apis", serveCmd.Flags().Lookup("listen-apis"))
+
 	// App specific flags
-	serveCmd.Flags().String("policy", "/etc/"+appName+"/policy.yaml", "runtime policy file")
+	serveCmd.Flags().String("policy", "/etc/"+appName+"/policy.yaml", "runtime policy file, or - to read it from stdin")
 	viperBindFlag("policy", serveCmd.Flags().Lookup("policy"))
+
+	serveCmd.Flags().String("policy-yaml", "", "inline policy document in YAML or JSON, instead of --policy (or IAMRUNTIME_POLICY_YAML)")
+	viperBindFlag("policy-yaml", serveCmd.Flags().Lookup("policy-yaml"))
+	serveCmd.MarkFlagsMutuallyExclusive("policy", "policy-yaml")
+
+	serveCmd.Flags().String("policy-dir", "", "directory of policy files (*.yaml, *.yml, *.json) merged into the runtime policy in name order, instead of --policy")
+	viperBindFlag("policy-dir", serveCmd.Flags().Lookup("policy-dir"))
+	serveCmd.MarkFlagsMutuallyExclusive("policy", "policy-dir")
+
+	serveCmd.Flags().Bool("json-errors", false, "on startup failure, also write a JSON error report with its kind and exit code to stderr")
+	viperBindFlag("json-errors", serveCmd.Flags().Lookup("json-errors"))
+
+	serveCmd.Flags().Bool("watch-policy", false, "reload the policy and its overlays when they change (SIGHUP always reloads)")
+	viperBindFlag("policy-watch", serveCmd.Flags().Lookup("watch-policy"))
+
+	serveCmd.Flags().Bool("ephemeral", false, "serve a generated policy with an admin and a read-only subject, printing their tokens, and remove it on exit")
+	serveCmd.MarkFlagsMutuallyExclusive("ephemeral", "policy")
+	serveCmd.MarkFlagsMutuallyExclusive("ephemeral", "policy-dir")
+	serveCmd.MarkFlagsMutuallyExclusive("ephemeral", "policy-yaml")
+
+	serveCmd.Flags().StringSlice("policy-overlay", nil, "policy overlay files merged over the runtime policy in order (e.g., policy.staging.yaml)")
+	viperBindFlag("policy-overlays", serveCmd.Flags().Lookup("policy-overlay"))
+
+	serveCmd.Flags().String("policy-encryption-identity", "", "age identity for decrypting encrypted policies (prefer IAMRUNTIME_POLICY_ENCRYPTION_IDENTITY)")
+	viperBindFlag("policy-encryption.identity", serveCmd.Flags().Lookup("policy-encryption-identity"))
+
+	serveCmd.Flags().String("policy-encryption-identity-file", "", "file containing age identities for decrypting encrypted policies")
+	viperBindFlag("policy-encryption.identity-file", serveCmd.Flags().Lookup("policy-encryption-identity-file"))
+
+	serveCmd.Flags().String("policy-encryption-identity-command", "", "shell command printing age identities for decrypting encrypted policies, such as a KMS or secret manager CLI")
+	viperBindFlag("policy-encryption.identity-command", serveCmd.Flags().Lookup("policy-encryption-identity-command"))
+
+	serveCmd.Flags().Float64("policy-max-subject-drop-percent", 0, "reject policy reloads removing more than this percentage of subjects, keeping the active policy (disabled if zero)")
+	viperBindFlag("policy-guard.max-subject-drop-percent", serveCmd.Flags().Lookup("policy-max-subject-drop-percent"))
+
+	serveCmd.Flags().Float64("policy-max-grant-drop-percent", 0, "reject policy reloads removing more than this percentage of grant actions, keeping the active policy (disabled if zero)")
+	viperBindFlag("policy-guard.max-grant-drop-percent", serveCmd.Flags().Lookup("policy-max-grant-drop-percent"))
+
+	serveCmd.Flags().Int("policy-history-size", 5, "number of previously active policies kept in memory")
+	viperBindFlag("policy-guard.history-size", serveCmd.Flags().Lookup("policy-history-size"))
+
+	serveCmd.Flags().String("expected-traffic", "", "YAML or JSON list of expected subject, action, and resource requests whose decisions are warmed on each policy load, logging those that would be denied")
+	viperBindFlag("expected-traffic.file", serveCmd.Flags().Lookup("expected-traffic"))
+
+	serveCmd.Flags().Bool("expected-traffic-require-allowed", false, "reject a policy that would deny any expected request, failing startup or keeping the active policy on reload")
+	viperBindFlag("expected-traffic.require-allowed", serveCmd.Flags().Lookup("expected-traffic-require-allowed"))
+
+	serveCmd.Flags().Duration("decision-cache-ttl", 0, "how long clients may cache CheckAccess results, sent as a response header hint (disabled if zero)")
+	viperBindFlag("decision-cache-ttl", serveCmd.Flags().Lookup("decision-cache-ttl"))
+
+	serveCmd.Flags().Duration("clock-skew", 0, "how long expired grants and JWTs are still accepted, to tolerate clock differences between machines")
+	viperBindFlag("clock-skew", serveCmd.Flags().Lookup("clock-skew"))
+
+	serveCmd.Flags().Duration("shutdown-timeout", defaultShutdownTimeout, "how long in-flight requests may take to finish on SIGTERM or interrupt before they are cancelled (0 waits indefinitely)")
+	viperBindFlag("shutdown-timeout", serveCmd.Flags().Lookup("shutdown-timeout"))
+
+	serveCmd.Flags().StringSlice("fail-open", nil, "subsystems that start degraded with a warning instead of aborting startup if they fail: "+strings.Join(config.FailOpenSubsystems, ", "))
+	viperBindFlag("startup.fail-open", serveCmd.Flags().Lookup("fail-open"))
+	serveCmd.Flags().StringSlice("enable-component", nil, "components that must be enabled, failing startup if they are not configured: "+strings.Join(component.Names(), ", "))
+	viperBindFlag("components.enabled", serveCmd.Flags().Lookup("enable-component"))
+	serveCmd.Flags().StringSlice("disable-component", nil, "components that are not initialized, even if configured: "+strings.Join(component.Names(), ", "))
+	viperBindFlag("components.disabled", serveCmd.Flags().Lookup("disable-component"))
+	serveCmd.Flags().Bool("enable-experimental-apis", false, "serve every experimental API, which may change or be removed in any release")
+	viperBindFlag("experimental-apis.all", serveCmd.Flags().Lookup("enable-experimental-apis"))
+	serveCmd.Flags().StringSlice("enable-experimental-api", nil, "experimental APIs to serve: "+strings.Join(apitier.ExperimentalNames(), ", "))
+	viperBindFlag("experimental-apis.enabled", serveCmd.Flags().Lookup("enable-experimental-api"))
+
+	serveCmd.Flags().Int("grpc-max-recv-msg-size", 0, "maximum message size in bytes the server can receive (default is the gRPC default of 4MiB)")
+	viperBindFlag("grpc.max-recv-msg-size", serveCmd.Flags().Lookup("grpc-max-recv-msg-size"))
+
+	serveCmd.Flags().Int("grpc-max-send-msg-size", 0, "maximum message size in bytes the server can send (default is the gRPC default of math.MaxInt32)")
+	viperBindFlag("grpc.max-send-msg-size", serveCmd.Flags().Lookup("grpc-max-send-msg-size"))
+
+	serveCmd.Flags().Bool("xds", false, "serve using configuration from an xDS management server (requires GRPC_XDS_BOOTSTRAP or GRPC_XDS_BOOTSTRAP_CONFIG)")
+	viperBindFlag("xds.enabled", serveCmd.Flags().Lookup("xds"))
+
+	serveCmd.Flags().Bool("admin", false, "register the admin API on the runtime listener")
+	viperBindFlag("admin.enabled", serveCmd.Flags().Lookup("admin"))
+
+	serveCmd.Flags().String("admin-token", "", "token admin API calls must carry as a bearer Authorization header, enabling the admin calls that change state (prefer IAMRUNTIME_ADMIN_TOKEN)")
+	viperBindFlag("admin.token", serveCmd.Flags().Lookup("admin-token"))
+
+	serveCmd.Flags().String("metrics-listen", "", "HTTP address serving /metrics, /healthz, and /refresh (disabled if empty)")
+	viperBindFlag("metrics.listen", serveCmd.Flags().Lookup("metrics-listen"))
+
+	serveCmd.Flags().String("gateway-listen", "", "HTTP address serving AuthenticateSubject and CheckAccess as JSON at /authenticate and /check-access (disabled if empty)")
+	viperBindFlag("gateway.listen", serveCmd.Flags().Lookup("gateway-listen"))
+
+	serveCmd.Flags().Bool("session-cache", false, "cache the subject each credential authenticates per gRPC connection, until the policy is reloaded or a credential is rotated")
+	viperBindFlag("session-cache", serveCmd.Flags().Lookup("session-cache"))
+	serveCmd.Flags().Bool("connection-subjects", false, "stamp each gRPC connection with the first subject authenticated on it, for decision events and per-subject connection metrics")
+	viperBindFlag("connection-subjects", serveCmd.Flags().Lookup("connection-subjects"))
+	serveCmd.Flags().Int("subject-max-connections", 0, "most gRPC connections each subject may hold at once, counted for the first subject authenticated on a connection (0 for unlimited)")
+	viperBindFlag("subject-limits.max-connections", serveCmd.Flags().Lookup("subject-max-connections"))
+	serveCmd.Flags().Int("subject-max-streams", 0, "most requests each subject may have in progress at once (0 for unlimited)")
+	viperBindFlag("subject-limits.max-streams", serveCmd.Flags().Lookup("subject-max-streams"))
+
+	serveCmd.Flags().Int("recent-decisions", server.DefaultRecentDecisions, "number of recent decisions kept in memory for the admin API and the debug endpoint")
+	viperBindFlag("recent-decisions.size", serveCmd.Flags().Lookup("recent-decisions"))
+
+	serveCmd.Flags().Bool("debug-decisions", false, "serve recent decisions from /debug/decisions on the metrics listener (requires --metrics-listen)")
+	viperBindFlag("recent-decisions.http", serveCmd.Flags().Lookup("debug-decisions"))
+
+	serveCmd.Flags().String("metrics-exporter", metrics.ExporterPrometheus, "how metrics are published: prometheus (served at /metrics) or otlp")
+	viperBindFlag("metrics.exporter", serveCmd.Flags().Lookup("metrics-exporter"))
+
+	serveCmd.Flags().String("metrics-otlp-endpoint", "", "OTLP gRPC collector host:port (default is from OTEL_EXPORTER_OTLP_ENDPOINT)")
+	viperBindFlag("metrics.otlp.endpoint", serveCmd.Flags().Lookup("metrics-otlp-endpoint"))
+
+	serveCmd.Flags().Bool("metrics-otlp-insecure", false, "disable TLS to the OTLP collector")
+	viperBindFlag("metrics.otlp.insecure", serveCmd.Flags().Lookup("metrics-otlp-insecure"))
+
+	serveCmd.Flags().Duration("metrics-otlp-interval", time.Minute, "how often metrics are exported over OTLP")
+	viperBindFlag("metrics.otlp.interval", serveCmd.Flags().Lookup("metrics-otlp-interval"))
+
+	serveCmd.Flags().Bool("tracing", false, "export traces of RPCs and policy evaluation over OTLP")
+	viperBindFlag("tracing.enabled", serveCmd.Flags().Lookup("tracing"))
+
+	serveCmd.Flags().String("tracing-otlp-endpoint", "", "OTLP gRPC collector host:port for traces (default is from OTEL_EXPORTER_OTLP_ENDPOINT)")
+	viperBindFlag("tracing.endpoint", serveCmd.Flags().Lookup("tracing-otlp-endpoint"))
+
+	serveCmd.Flags().Bool("tracing-otlp-insecure", false, "disable TLS to the OTLP trace collector")
+	viperBindFlag("tracing.insecure", serveCmd.Flags().Lookup("tracing-otlp-insecure"))
+
+	serveCmd.Flags().Float64("tracing-sample-ratio", 1, "fraction of traces started by the runtime that are sampled")
+	viperBindFlag("tracing.sample-ratio", serveCmd.Flags().Lookup("tracing-sample-ratio"))
+
+	serveCmd.Flags().String("policy-git-url", "", "git repository to sync the policy from instead of reading --policy")
+	viperBindFlag("policy-git.url", serveCmd.Flags().Lookup("policy-git-url"))
+
+	serveCmd.Flags().String("policy-git-branch", "", "branch to sync the policy from (default is main)")
+	viperBindFlag("policy-git.branch", serveCmd.Flags().Lookup("policy-git-branch"))
+
+	serveCmd.Flags().String("policy-git-tag", "", "tag to sync the policy from")
+	viperBindFlag("policy-git.tag", serveCmd.Flags().Lookup("policy-git-tag"))
+
+	serveCmd.Flags().String("policy-git-path", "policy.yaml", "path of the policy file within the git repository")
+	viperBindFlag("policy-git.path", serveCmd.Flags().Lookup("policy-git-path"))
+
+	serveCmd.Flags().Duration("policy-git-interval", time.Minute, "how often to poll the git repository")
+	viperBindFlag("policy-git.interval", serveCmd.Flags().Lookup("policy-git-interval"))
+
+	serveCmd.Flags().String("policy-git-username", "", "username for HTTP basic authentication to the git repository")
+	viperBindFlag("policy-git.username", serveCmd.Flags().Lookup("policy-git-username"))
+
+	serveCmd.Flags().String("policy-git-password", "", "password or token for HTTP basic authentication to the git repository (prefer IAMRUNTIME_POLICY_GIT_PASSWORD)")
+	viperBindFlag("policy-git.password", serveCmd.Flags().Lookup("policy-git-password"))
+
+	serveCmd.Flags().String("policy-git-cache-file", "", "file to keep a copy of the last synced policy in, which --fail-open policy-git starts from if the repository is unreachable")
+	viperBindFlag("policy-git.cache-file", serveCmd.Flags().Lookup("policy-git-cache-file"))
+
+	serveCmd.Flags().String("policy-hub", "", "admin API of another iam-runtime-static instance to mirror the policy of, read-only, instead of reading --policy: a unix socket path, or tcp://host:port")
+	viperBindFlag("policy-hub.address", serveCmd.Flags().Lookup("policy-hub"))
+
+	serveCmd.Flags().String("policy-hub-token", "", "admin token of the hub (prefer IAMRUNTIME_POLICY_HUB_TOKEN)")
+	viperBindFlag("policy-hub.token", serveCmd.Flags().Lookup("policy-hub-token"))
+
+	serveCmd.Flags().Duration("policy-hub-interval", 30*time.Second, "how often to poll the hub")
+	viperBindFlag("policy-hub.interval", serveCmd.Flags().Lookup("policy-hub-interval"))
+
+	serveCmd.Flags().String("refresh-token", "", "bearer token required by the /refresh endpoint, which is disabled if empty (prefer IAMRUNTIME_REFRESH_TOKEN)")
+	viperBindFlag("refresh.token", serveCmd.Flags().Lookup("refresh-token"))
+
+	serveCmd.Flags().String("events-environment", "", "environment name included in published events (default is the hostname)")
+	viperBindFlag("events.environment", serveCmd.Flags().Lookup("events-environment"))
+
+	serveCmd.Flags().String("events-pseudonymize-key", "", "key for replacing subject and resource IDs in published events with HMAC pseudonyms, at least 32 bytes (prefer IAMRUNTIME_EVENTS_PSEUDONYMIZE_KEY)")
+	viperBindFlag("events.pseudonymize-key", serveCmd.Flags().Lookup("events-pseudonymize-key"))
+
+	serveCmd.Flags().String("events-nats-url", "", "NATS server URL to publish decision and policy events to (prefer IAMRUNTIME_EVENTS_NATS_URL)")
+	viperBindFlag("events.nats.url", serveCmd.Flags().Lookup("events-nats-url"))
+
+	serveCmd.Flags().String("events-nats-subject-prefix", appName, "prefix of the NATS subjects events are published to, as prefix.kind")
+	viperBindFlag("events.nats.subject-prefix", serveCmd.Flags().Lookup("events-nats-subject-prefix"))
+
+	serveCmd.Flags().StringSlice("events-kafka-brokers", nil, "Kafka brokers to publish decision and policy events to")
+	viperBindFlag("events.kafka.brokers", serveCmd.Flags().Lookup("events-kafka-brokers"))
+
+	serveCmd.Flags().String("events-kafka-topic", "", "Kafka topic events are published to")
+	viperBindFlag("events.kafka.topic", serveCmd.Flags().Lookup("events-kafka-topic"))
+
+	serveCmd.Flags().StringSlice("audit-metadata-key", nil, "incoming gRPC metadata keys (e.g., traceparent, x-tenant-id) captured into decision events and audit logs")
+	viperBindFlag("audit.metadata-keys", serveCmd.Flags().Lookup("audit-metadata-key"))
+
+	serveCmd.Flags().Bool("audit-echo-claims", false, "also return the captured metadata as claims from AuthenticateSubject")
+	viperBindFlag("audit.echo-claims", serveCmd.Flags().Lookup("audit-echo-claims"))
+
+	serveCmd.Flags().String("audit-store", "", "file to keep the audit log streamed from the admin API in, so it survives restarts (requires --admin)")
+	viperBindFlag("audit.store", serveCmd.Flags().Lookup("audit-store"))
+
+	serveCmd.Flags().Int("audit-retention", auditlog.DefaultRetention, "number of audit records kept for streaming from the admin API")
+	viperBindFlag("audit.retention", serveCmd.Flags().Lookup("audit-retention"))
+
+	serveCmd.Flags().Bool("decision-log-stdout", false, "write a JSON record of each AuthenticateSubject and CheckAccess request to standard output")
+	viperBindFlag("decision-log.stdout", serveCmd.Flags().Lookup("decision-log-stdout"))
+
+	serveCmd.Flags().String("decision-log-file", "", "file to append a JSON record of each AuthenticateSubject and CheckAccess request to")
+	viperBindFlag("decision-log.file", serveCmd.Flags().Lookup("decision-log-file"))
+
+	serveCmd.Flags().Int("decision-log-max-size", decisionlog.DefaultMaxSize>>20, "size in megabytes at which the decision log file is rotated")
+	viperBindFlag("decision-log.max-size", serveCmd.Flags().Lookup("decision-log-max-size"))
+
+	serveCmd.Flags().Int("decision-log-max-backups", decisionlog.DefaultMaxBackups, "number of rotated decision log files kept")
+	viperBindFlag("decision-log.max-backups", serveCmd.Flags().Lookup("decision-log-max-backups"))
+
+	serveCmd.Flags().String("alert-webhook-url", "", "URL receiving a JSON POST for each decision on a sensitive action (prefer IAMRUNTIME_ALERT_WEBHOOK_URL)")
+	viperBindFlag("alert.webhook-url", serveCmd.Flags().Lookup("alert-webhook-url"))
+
+	serveCmd.Flags().StringSlice("feature", nil, "experimental feature flags to enable for all subjects (per-subject flags are set in the config file)")
+	viperBindFlag("features.enabled", serveCmd.Flags().Lookup("feature"))
+
+	serveCmd.Flags().String("credential-header", "", "gRPC metadata header to read the credential from when a request has none (e.g., authorization)")
+	viperBindFlag("credential-header.name", serveCmd.Flags().Lookup("credential-header"))
+
+	serveCmd.Flags().String("credential-header-prefix", "", "prefix to strip from the credential header value (e.g., \"Bearer \")")
+	viperBindFlag("credential-header.prefix", serveCmd.Flags().Lookup("credential-header-prefix"))
+
+	serveCmd.Flags().String("credential-prefix", "", "only accept credentials starting with this prefix (e.g., static_), so the runtime can share a host with others")
+	viperBindFlag("credential-namespace.prefix", serveCmd.Flags().Lookup("credential-prefix"))
+
+	serveCmd.Flags().String("credential-prefix-reject-code", "", "gRPC status code for credentials without the prefix (default failed_precondition)")
+	viperBindFlag("credential-namespace.reject-code", serveCmd.Flags().Lookup("credential-prefix-reject-code"))
+
+	serveCmd.Flags().String("credential-prefix-upstream", "", "runtime to forward requests with credentials without the prefix to: a unix socket path, or tcp://host:port")
+	viperBindFlag("credential-namespace.upstream", serveCmd.Flags().Lookup("credential-prefix-upstream"))
+
+	serveCmd.Flags().String("shadow-address", "", "runtime to mirror a sample of requests to, logging decisions it disagrees with: a unix socket path, or tcp://host:port")
+	viperBindFlag("shadow.address", serveCmd.Flags().Lookup("shadow-address"))
+
+	serveCmd.Flags().Float64("shadow-sample-ratio", 1, "fraction of AuthenticateSubject and CheckAccess requests mirrored to the shadow runtime")
+	viperBindFlag("shadow.sample-ratio", serveCmd.Flags().Lookup("shadow-sample-ratio"))
+
+	serveCmd.Flags().Bool("credential-checks", false, "explain why a rejected credential looks like a JWT, a private key, or a token with a scheme or whitespace left on it")
+	viperBindFlag("credential-checks.enabled", serveCmd.Flags().Lookup("credential-checks"))
+
+	serveCmd.Flags().Bool("denial-hints", false, "explain denied access checks in their error details, such as the subject's nearest grant; reveals the policy to callers, so for development only")
+	viperBindFlag("denial-hints", serveCmd.Flags().Lookup("denial-hints"))
+
+	serveCmd.Flags().String("empty-actions", config.EmptyActionsAllow, "how access checks naming no actions are answered: allow, deny, or invalid")
+	viperBindFlag("check-access.empty-actions", serveCmd.Flags().Lookup("empty-actions"))
+
+	serveCmd.Flags().String("duplicate-actions", config.DuplicateActionsEvaluate, "how access checks naming an action on a resource more than once are answered: evaluate or reject")
+	viperBindFlag("check-access.duplicate-actions", serveCmd.Flags().Lookup("duplicate-actions"))
+
+	serveCmd.Flags().Int("max-evaluated-rules", 0, "fail access checks with ResourceExhausted once they examine more grant entries than this (0 for no limit)")
+	viperBindFlag("check-access.max-rules", serveCmd.Flags().Lookup("max-evaluated-rules"))
+
+	serveCmd.Flags().Int("max-relationship-depth", 0, "fail access checks with ResourceExhausted when relationships lead farther than this many hops without allowing the action (0 for no limit)")
+	viperBindFlag("check-access.max-depth", serveCmd.Flags().Lookup("max-relationship-depth"))
+
+	serveCmd.Flags().StringSlice("authorization-backend", nil, "backend deciding access checks, in the order consulted: policy, relationships, or upstream (repeatable; default is the policy, then relationships)")
+	viperBindFlag("authorization.backends", serveCmd.Flags().Lookup("authorization-backend"))
+
+	serveCmd.Flags().String("authorization-combine", "", "how the decisions of the authorization backends are combined: priority, first-allow, or all-must-allow (default priority)")
+	viperBindFlag("authorization.combine", serveCmd.Flags().Lookup("authorization-combine"))
+
+	serveCmd.Flags().String("authorization-upstream", "", "runtime the upstream authorization backend forwards checks to: a unix socket path, or tcp://host:port")
+	viperBindFlag("authorization.upstream", serveCmd.Flags().Lookup("authorization-upstream"))
+
+	serveCmd.Flags().StringSlice("normalize-resource-ids", nil, "normalizers applied in order to resource IDs in the policy and in requests: "+strings.Join(resourceid.Normalizers, ", "))
+	viperBindFlag("resource-ids.normalize", serveCmd.Flags().Lookup("normalize-resource-ids"))
+
+	serveCmd.Flags().Int("max-credential-length", 0, "reject credentials longer than this many bytes (0 for no limit)")
+	viperBindFlag("credential-checks.max-length", serveCmd.Flags().Lookup("max-credential-length"))
+
+	serveCmd.Flags().Bool("token-commands", false, "run the commands of policy tokens with an exec source when the policy is loaded")
+	viperBindFlag("token-commands.enabled", serveCmd.Flags().Lookup("token-commands"))
+
+	serveCmd.Flags().Duration("token-command-timeout", 0, "how long a token command may run before it is killed (default 10s)")
+	viperBindFlag("token-commands.timeout", serveCmd.Flags().Lookup("token-command-timeout"))
+
+	serveCmd.Flags().StringSlice("token-command-env", nil, "environment variables passed to token commands; no others are (default PATH,HOME)")
+	viperBindFlag("token-commands.env", serveCmd.Flags().Lookup("token-command-env"))
+
+	serveCmd.Flags().Bool("credential-rotation", false, "serve the Credentials service, letting subjects rotate their own credentials")
+	viperBindFlag("credential-rotation.enabled", serveCmd.Flags().Lookup("credential-rotation"))
+
+	serveCmd.Flags().String("credential-rotation-store", "", "file to keep rotated credentials in, so they survive restarts (requires --credential-rotation)")
+	viperBindFlag("credential-rotation.store", serveCmd.Flags().Lookup("credential-rotation-store"))
+
+	serveCmd.Flags().Duration("credential-rotation-grace", time.Hour, "how long a replaced credential is still accepted")
+	viperBindFlag("credential-rotation.grace", serveCmd.Flags().Lookup("credential-rotation-grace"))
+
+	serveCmd.Flags().Duration("stale-subject-expiry", 0, "disable subjects not authenticated for this long, until they are enabled again with the admin API (0 to never disable subjects)")
+	viperBindFlag("stale-subjects.after", serveCmd.Flags().Lookup("stale-subject-expiry"))
+
+	serveCmd.Flags().String("stale-subject-store", "", "file to keep when subjects were last seen in, so staleness and disabled subjects survive restarts (requires --stale-subject-expiry)")
+	viperBindFlag("stale-subjects.store", serveCmd.Flags().Lookup("stale-subject-store"))
+
+	serveCmd.Flags().StringSlice("stale-subject-exempt", nil, "subject never disabled for being stale (repeatable)")
+	viperBindFlag("stale-subjects.exempt", serveCmd.Flags().Lookup("stale-subject-exempt"))
+
+	serveCmd.Flags().Duration("relationship-propagation-delay", 0, "how long relationship writes take to become visible to access checks, to simulate an eventually consistent backend")
+	viperBindFlag("relationships.propagation-delay", serveCmd.Flags().Lookup("relationship-propagation-delay"))
+
+	serveCmd.Flags().String("workload-identity", "", "policy identity whose access token GetAccessToken returns (default is the policy's only identity)")
+	viperBindFlag("identity.workload", serveCmd.Flags().Lookup("workload-identity"))
+
+	serveCmd.Flags().String("jwt-jwks-url", "", "authenticate subjects with JWTs signed by the keys at this JWKS URL")
+	viperBindFlag("jwt.jwks-url", serveCmd.Flags().Lookup("jwt-jwks-url"))
+
+	serveCmd.Flags().String("jwt-public-key-file", "", "authenticate subjects with JWTs signed by this PEM-encoded public key or certificate")
+	viperBindFlag("jwt.public-key-file", serveCmd.Flags().Lookup("jwt-public-key-file"))
+
+	serveCmd.Flags().StringSlice("jwt-issuer", nil, "only accept JWTs from this issuer (repeatable)")
+	viperBindFlag("jwt.issuers", serveCmd.Flags().Lookup("jwt-issuer"))
+
+	serveCmd.Flags().String("jwt-audience", "", "only accept JWTs with this audience")
+	viperBindFlag("jwt.audience", serveCmd.Flags().Lookup("jwt-audience"))
+
+	serveCmd.Flags().String("capability-signing-key-file", "", "accept capability tokens signed with the key in this file (at least 32 bytes)")
+	viperBindFlag("capabilities.signing-key-file", serveCmd.Flags().Lookup("capability-signing-key-file"))
+
+	serveCmd.Flags().Bool("self-test", false, "exit at startup unless the probe subject is authenticated and allowed the probe action")
+	viperBindFlag("probe.self-test", serveCmd.Flags().Lookup("self-test"))
+
+	serveCmd.Flags().String("probe-credential", "", "token of the probe subject used by the self-test probe (prefer IAMRUNTIME_PROBE_CREDENTIAL)")
+	viperBindFlag("probe.credential", serveCmd.Flags().Lookup("probe-credential"))
+
+	serveCmd.Flags().String("probe-action", "", "action the probe subject must be allowed")
+	viperBindFlag("probe.action", serveCmd.Flags().Lookup("probe-action"))
+
+	serveCmd.Flags().String("probe-resource", "", "resource the probe subject must be allowed the probe action on")
+	viperBindFlag("probe.resource", serveCmd.Flags().Lookup("probe-resource"))
+
+	serveCmd.Flags().Duration("probe-interval", 0, "how often to repeat the probe, reporting results in /healthz and metrics (0 to probe only at startup)")
+	viperBindFlag("probe.interval", serveCmd.Flags().Lookup("probe-interval"))
+
+	serveCmd.Flags().Duration("probe-timeout", 0, "timeout for each probe (default 5s)")
+	viperBindFlag("probe.timeout", serveCmd.Flags().Lookup("probe-timeout"))
+
+	serveCmd.Flags().Bool("oauth2", false, "serve an OAuth2 client_credentials token endpoint at /oauth2/token on the metrics listener")
+	viperBindFlag("oauth2.enabled", serveCmd.Flags().Lookup("oauth2"))
+
+	serveCmd.Flags().Duration("oauth2-token-ttl", 0, "how long access tokens issued by the OAuth2 token endpoint are valid (default 1h)")
+	viperBindFlag("oauth2.token-ttl", serveCmd.Flags().Lookup("oauth2-token-ttl"))
 }
 
-func serve(_ context.Context, v *viper.Viper) error {
+// grpcServerOptions returns the gRPC server options derived from the given configuration.
+func grpcServerOptions(cfg config.GRPC) []grpc.ServerOption {
+	var opts []grpc.ServerOption
+
+	if cfg.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+
+	if cfg.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(cfg.MaxSendMsgSize))
+	}
+
+	return opts
+}
+
+// serveHook is called once the runtime is serving, with the server and the function refreshing its
+// policy. It returns a function stopping what it started, called before the runtime drains.
+type serveHook func(ctx context.Context, srv server.Server, refresh refreshFunc) (func(), error)
+
+// serve runs the runtime until interrupted or ctx is canceled. The given options are applied after
+// those derived from cfg. If started is not nil, it is called once the runtime is serving.
+func serve(ctx context.Context, cfg config.Config, started serveHook, opts ...server.Option) error {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	if err := cfg.Validate(); err != nil {
+		fatal(exitConfig, "invalid configuration", err)
+	}
 
-	policyPath := v.GetString("policy")
-	socketPath := v.GetString("listen")
+	// Validated to succeed.
+	componentSet, _ := cfg.Components.Set()
+	apiGate, _ := cfg.ExperimentalAPIs.Gate()
 
-	if _, err := os.Stat(socketPath); err == nil {
-		logger.Warnw("socket found, unlinking", "socket_path", socketPath)
+	registry := component.NewRegistry(componentSet, logger)
+	defer registry.Stop()
 
-		if err := syscall.Unlink(socketPath); err != nil {
-			logger.Fatalw("error unlinking socket", "error", err)
+	// start initializes the named component if it is enabled.
+	start := func(name string, fn component.StartFunc) (bool, error) {
+		return registry.Start(ctx, name, cfg.ComponentConfigured(name), fn)
+	}
+
+	listeners := prepareListeners(cfg)
+
+	if cfg.Metrics.Exporter == metrics.ExporterOTLP {
+		shutdown, err := metrics.StartOTLP(ctx, metrics.OTLPConfig{
+			Endpoint: cfg.Metrics.OTLP.Endpoint,
+			Insecure: cfg.Metrics.OTLP.Insecure,
+			Interval: cfg.Metrics.OTLP.Interval,
+		}, appName)
+		if err != nil {
+			fatal(exitFailure, "failed to start OTLP metrics exporter", err)
+		}
+
+		defer func() {
+			if err := shutdown(context.Background()); err != nil {
+				logger.Warnw("failed to stop OTLP metrics exporter", "error", err)
+			}
+		}()
+	}
+
+	if _, err := start(component.Tracing, func(ctx context.Context) (func(), error) {
+		shutdown, err := tracing.Start(ctx, tracing.Config{
+			Endpoint:    cfg.Tracing.Endpoint,
+			Insecure:    cfg.Tracing.Insecure,
+			SampleRatio: cfg.Tracing.SampleRatio,
+		}, appName)
+		if err != nil {
+			return nil, err
 		}
+
+		return func() {
+			if err := shutdown(context.Background()); err != nil {
+				logger.Warnw("failed to stop OTLP trace exporter", "error", err)
+			}
+		}, nil
+	}); err != nil {
+		fatal(exitFailure, "failed to start OTLP trace exporter", err)
 	}
 
-	iamSrv, err := server.NewServer(policyPath, logger)
+	if _, err := start(component.Profiling, func(ctx context.Context) (func(), error) {
+		pusher, err := profiling.New(cfg.Profiling.Config(), logger)
+		if err != nil {
+			return nil, err
+		}
+
+		profilingCtx, stopProfiling := context.WithCancel(ctx)
+
+		go pusher.Run(profilingCtx)
+
+		return stopProfiling, nil
+	}); err != nil {
+		fatal(exitConfig, "invalid profiling configuration", err)
+	}
+
+	redacted, err := cfg.RedactedMap()
 	if err != nil {
-		logger.Fatalw("failed to create server", "error", err)
+		fatal(exitConfig, "failed to encode configuration", err)
 	}
 
-	grpcSrv := grpc.NewServer()
-	authorization.RegisterAuthorizationServer(grpcSrv, iamSrv)
-	authentication.RegisterAuthenticationServer(grpcSrv, iamSrv)
+	decrypter, err := policycrypt.New(ctx, policyDecryptionConfig(cfg.PolicyEncryption))
+	if err != nil {
+		fatal(exitConfig, "failed to load policy decryption identity", err)
+	}
 
-	listener, err := net.Listen("unix", socketPath)
+	featureSet, err := features.New(cfg.Features.Enabled, cfg.Features.Subjects)
 	if err != nil {
-		logger.Fatalw("failed to listen", "error", err)
+		fatal(exitConfig, "invalid feature flags", err)
 	}
 
-	logger.Infow("starting server",
-		"address", socketPath,
+	var (
+		profiles    *emulation.Profiles
+		rpcProfiles *emulation.RPCProfiles
 	)
 
+	if _, err := start(component.Emulation, func(context.Context) (func(), error) {
+		profiles, err = emulation.New(cfg.Emulation.Profiles())
+		if err != nil {
+			return nil, fmt.Errorf("action profiles: %w", err)
+		}
+
+		rpcProfiles, err = emulation.NewRPC(cfg.Emulation.RPCs())
+		if err != nil {
+			return nil, fmt.Errorf("RPC profiles: %w", err)
+		}
+
+		return nil, nil
+	}); err != nil {
+		fatal(exitConfig, "invalid emulation profiles", err)
+	}
+
+	enrichers, err := enrich.New(cfg.Enrichers(), logger)
+	if err != nil {
+		fatal(exitConfig, "invalid claim enrichers", err)
+	}
+
+	var expected []server.ExpectedRequest
+
+	if cfg.ExpectedTraffic.File != "" {
+		expected, err = server.ReadExpectedTraffic(cfg.ExpectedTraffic.File)
+		if err != nil {
+			fatal(exitConfig, "invalid expected traffic", err)
+		}
+	}
+
+	jwtVerifier, err := newJWTVerifier(cfg.JWT, cfg.ClockSkew)
+	if err != nil {
+		fatal(exitConfig, "invalid JWT configuration", err)
+	}
+
+	capabilitySigner, err := newCapabilitySigner(cfg.Capabilities)
+	if err != nil {
+		fatal(exitConfig, "invalid capability configuration", err)
+	}
+
+	if err := server.CheckDenialMessages(cfg.DenialMessages); err != nil {
+		fatal(exitConfig, "invalid denial messages", err)
+	}
+
+	namespaceOpt, closeUpstream, err := credentialNamespaceOption(cfg.CredentialNamespace)
+	if err != nil {
+		fatal(exitFailure, "failed to connect to upstream runtime", err)
+	}
+
+	defer closeUpstream()
+
+	backendsOpt, closeBackends, err := authorizationOption(cfg.Authorization)
+	if err != nil {
+		fatal(exitFailure, "failed to connect to upstream authorization backend", err)
+	}
+
+	defer closeBackends()
+
+	shadowOpt, closeShadow, err := shadowOption(cfg.Shadow)
+	if err != nil {
+		fatal(exitFailure, "failed to connect to shadow runtime", err)
+	}
+
+	defer closeShadow()
+
+	bus := events.NewBus()
+
+	if _, err := start(component.Events, func(ctx context.Context) (func(), error) {
+		fwd, err := newEventForwarder(cfg.Events)
+		if err != nil {
+			return nil, err
+		}
+
+		bus.Subscribe(fwd.Handle)
+
+		go fwd.Run(ctx)
+
+		return func() {
+			if err := fwd.Close(eventFlushTimeout); err != nil {
+				logger.Warnw("failed to stop event publishing", "error", err)
+			}
+		}, nil
+	}); err != nil {
+		degrade(cfg.Startup, config.SubsystemEvents, exitFailure, "failed to connect to event brokers", err, "events are not published")
+	}
+
+	// The admin API is registered with the gRPC server, so it has nothing to start or stop.
+	adminEnabled, _ := start(component.Admin, nil)
+
+	// The audit log is only read from the admin API, and only persisted if the audit component is
+	// also enabled.
+	if adminEnabled {
+		var auditLog *auditlog.Log
+
+		if _, err := start(component.Audit, func(context.Context) (func(), error) {
+			auditLog, err = auditlog.Open(auditlog.Config{
+				Path:      cfg.Audit.Store,
+				Retention: cfg.Audit.Retention,
+			}, logger)
+
+			return nil, err
+		}); err != nil {
+			degrade(cfg.Startup, config.SubsystemAudit, exitFailure, "failed to open audit log", err, "audit records are kept in memory only")
+		}
+
+		if auditLog == nil {
+			// Without a store, opening cannot fail.
+			auditLog, _ = auditlog.Open(auditlog.Config{Retention: cfg.Audit.Retention}, logger)
+		}
+
+		defer func() {
+			if err := auditLog.Close(); err != nil {
+				logger.Warnw("failed to close audit log", "error", err)
+			}
+		}()
+
+		opts = append(opts, server.WithAuditLog(auditLog))
+	}
+
+	if _, err := start(component.DecisionLog, func(context.Context) (func(), error) {
+		decisionLog, err := decisionlog.New(decisionlog.Config{
+			Stdout: cfg.DecisionLog.Stdout,
+			File: decisionlog.FileConfig{
+				Path:       cfg.DecisionLog.File,
+				MaxSize:    int64(cfg.DecisionLog.MaxSize) << 20,
+				MaxBackups: cfg.DecisionLog.MaxBackups,
+			},
+		}, os.Stdout, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, server.WithDecisionLog(decisionLog))
+
+		return func() {
+			if err := decisionLog.Close(); err != nil {
+				logger.Warnw("failed to close decision log", "error", err)
+			}
+		}, nil
+	}); err != nil {
+		degrade(cfg.Startup, config.SubsystemDecisionLog, exitFailure, "failed to open decision log", err, "decisions are not logged")
+	}
+
+	if cfg.TokenCommands.Enabled {
+		opts = append(opts, server.WithTokenCommands(cfg.TokenCommands.Timeout, cfg.TokenCommands.Env, cfg.TokenCommands.Dir))
+	}
+
+	if cfg.CredentialRotation.Enabled {
+		store, err := rotation.Open(cfg.CredentialRotation.Store)
+		if err != nil {
+			fatal(exitFailure, "failed to open rotated credentials", err)
+		}
+
+		opts = append(opts, server.WithCredentialRotation(store, cfg.CredentialRotation.Grace))
+	}
+
+	if cfg.StaleSubjects.After > 0 {
+		store, err := lastseen.Open(cfg.StaleSubjects.Store)
+		if err != nil {
+			fatal(exitFailure, "failed to open subject last-seen times", err)
+		}
+
+		// Sweeps save the store periodically; save what was seen since the last one on shutdown.
+		defer func() {
+			if err := store.Save(); err != nil {
+				logger.Warnw("failed to save subject last-seen times", "error", err)
+			}
+		}()
+
+		opts = append(opts, server.WithStaleSubjectExpiry(store, cfg.StaleSubjects.After, cfg.StaleSubjects.Exempt))
+	}
+
+	srvOpts := []server.Option{
+		server.WithConfig(redacted),
+		server.WithPolicyOverlays(cfg.PolicyOverlays...),
+		server.WithPolicyDecrypter(decrypter),
+		server.WithFeatures(featureSet),
+		server.WithActionProfiles(profiles),
+		server.WithRPCProfiles(rpcProfiles),
+		server.WithClaimEnrichers(enrichers),
+		server.WithJWTVerifier(jwtVerifier),
+		server.WithCapabilitySigner(capabilitySigner),
+		server.WithWorkloadIdentity(cfg.Identity.Workload),
+		server.WithReloadGuard(server.ReloadGuard{
+			MaxSubjectDropPercent: cfg.PolicyGuard.MaxSubjectDropPercent,
+			MaxGrantDropPercent:   cfg.PolicyGuard.MaxGrantDropPercent,
+		}),
+		server.WithPolicyHistory(cfg.PolicyGuard.HistorySize),
+		server.WithExpectedTraffic(expected, cfg.ExpectedTraffic.RequireAllowed),
+		server.WithEventBus(bus),
+		server.WithDecisionCacheTTL(cfg.DecisionCacheTTL),
+		server.WithClockSkew(cfg.ClockSkew),
+		server.WithRecentDecisions(cfg.RecentDecisions.Size),
+		server.WithMetadataCapture(cfg.Audit.MetadataKeys, cfg.Audit.EchoClaims),
+		server.WithCredentialHeader(cfg.CredentialHeader.Name, cfg.CredentialHeader.Prefix),
+		server.WithCredentialChecks(cfg.CredentialChecks.Enabled, cfg.CredentialChecks.MaxLength),
+		server.WithDenialMessages(cfg.DenialMessages),
+		server.WithRelationshipPropagationDelay(cfg.Relationships.PropagationDelay),
+		server.WithOwnership(cfg.Relationships.Ownership),
+		namespaceOpt,
+	}
+
+	if shadowOpt != nil {
+		srvOpts = append(srvOpts, shadowOpt)
+	}
+
+	if backendsOpt != nil {
+		srvOpts = append(srvOpts, backendsOpt)
+	}
+
+	// Relationships, coverage, and usage are kept by the server, so they have nothing to start or
+	// stop.
+	if ok, _ := start(component.Relationships, nil); !ok {
+		srvOpts = append(srvOpts, server.WithoutRelationships())
+	}
+
+	if ok, _ := start(component.Coverage, nil); !ok {
+		srvOpts = append(srvOpts, server.WithoutCoverage())
+	}
+
+	if ok, _ := start(component.Usage, nil); !ok {
+		srvOpts = append(srvOpts, server.WithoutUsage())
+	}
+
+	if cfg.SessionCache {
+		srvOpts = append(srvOpts, server.WithSessionCache())
+	}
+
+	if cfg.ConnectionSubjects {
+		srvOpts = append(srvOpts, server.WithConnectionSubjects())
+	}
+
+	if cfg.DenialHints {
+		logger.Warn("denial hints are enabled and reveal the policy to callers; do not enable them in production")
+
+		srvOpts = append(srvOpts, server.WithDenialHints())
+	}
+
+	// Validated with the rest of the configuration.
+	if code, _ := cfg.CheckAccess.EmptyActionsCode(); code != codes.OK {
+		srvOpts = append(srvOpts, server.WithEmptyActions(code))
+	}
+
+	if cfg.CheckAccess.RejectsDuplicates() {
+		srvOpts = append(srvOpts, server.WithDuplicateActionsRejected())
+	}
+
+	if cfg.CheckAccess.MaxRules > 0 || cfg.CheckAccess.MaxDepth > 0 {
+		srvOpts = append(srvOpts, server.WithEvaluationBudget(cfg.CheckAccess.MaxRules, cfg.CheckAccess.MaxDepth))
+	}
+
+	// Validated with the rest of the configuration.
+	if normalizer, _ := cfg.ResourceIDs.Pipeline(); normalizer.Enabled() {
+		srvOpts = append(srvOpts, server.WithResourceIDNormalizer(normalizer))
+	}
+
+	if cfg.SubjectLimits.MaxConnections > 0 || cfg.SubjectLimits.MaxStreams > 0 {
+		srvOpts = append(srvOpts, server.WithSubjectLimits(cfg.SubjectLimits.MaxConnections, cfg.SubjectLimits.MaxStreams))
+	}
+
+	srvOpts = append(srvOpts, opts...)
+
+	if cfg.OAuth2.TokenTTL > 0 {
+		srvOpts = append(srvOpts, server.WithIssuedTokenTTL(cfg.OAuth2.TokenTTL))
+	}
+
+	if cfg.Admin.Token != "" {
+		srvOpts = append(srvOpts, server.WithAdminToken(cfg.Admin.Token))
+	}
+
+	if cfg.Alert.WebhookURL != "" {
+		srvOpts = append(srvOpts, server.WithAlertNotifier(alert.NewWebhook(cfg.Alert.WebhookURL, logger)))
+	}
+
+	// Each served service reports NOT_SERVING while a policy loads, including the initial policy, so
+	// readiness checks take the runtime out of rotation until it can answer.
+	healthSrv := health.NewServer()
+	srvOpts = append(srvOpts, server.WithPolicyLoadHook(func(loading bool) {
+		setServingStatus(healthSrv, !loading)
+	}))
+
+	iamSrv, refresh, err := newIAMServer(ctx, cfg, srvOpts...)
+	if err != nil {
+		fatal(policyExitCode(err), "failed to create server", err)
+	}
+
+	reloadCtx, stopReload := context.WithCancel(ctx)
+	defer stopReload()
+
+	var watched []string
+
+	if cfg.PolicyWatch {
+		files := cfg.PolicyOverlays
+		if !cfg.InlinePolicy() {
+			files = append([]string{cfg.PolicySource()}, files...)
+		}
+
+		watched, err = absPaths(files)
+		if err != nil {
+			fatal(exitConfig, "invalid policy path", err)
+		}
+	}
+
 	go func() {
-		if err := grpcSrv.Serve(listener); err != nil {
-			logger.Fatalw("failed starting server", "error", err)
+		if err := reloadPolicy(reloadCtx, iamSrv, watched, refresh); err != nil {
+			logger.Errorw("policy reloads stopped", "error", err)
 		}
 	}()
 
-	<-c
+	var prober *probe.Prober
 
-	logger.Info("signal received, stopping server")
+	if cfg.Probe.Enabled() {
+		// Validated to exist.
+		addr, _ := cfg.PlaintextListen(apitier.Authentication, apitier.Authorization)
 
-	grpcSrv.GracefulStop()
+		conn, err := dialRuntime(addr)
+		if err != nil {
+			fatal(exitFailure, "failed to create probe client", err)
+		}
+
+		defer conn.Close()
+
+		prober = probe.New(probe.Config{
+			Credential: cfg.Probe.Credential,
+			Action:     cfg.Probe.Action,
+			Resource:   cfg.Probe.Resource,
+			Timeout:    cfg.Probe.Timeout,
+		}, conn, logger)
+	}
+
+	var metricsSrv *http.Server
+
+	// The metrics and gateway servers are shut down with the gRPC server, once it has drained.
+	if _, err := start(component.Metrics, func(context.Context) (func(), error) {
+		// Listen before serving, so a busy address is reported before the runtime starts serving.
+		lis, err := net.Listen("tcp", cfg.Metrics.Listen)
+		if err != nil {
+			return nil, err
+		}
+
+		metricsSrv = &http.Server{
+			Handler:           newHTTPHandler(cfg, iamSrv, prober, refresh),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			if err := metricsSrv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal(exitBind, "failed starting metrics server", err)
+			}
+		}()
+
+		return nil, nil
+	}); err != nil {
+		degrade(cfg.Startup, config.SubsystemMetrics, exitBind, "failed starting metrics server", err, "metrics, health, and refresh endpoints are not served")
+	}
+
+	var gatewaySrv *http.Server
+
+	// Starting the gateway cannot fail: a busy address is fatal once it starts serving.
+	_, _ = start(component.Gateway, func(context.Context) (func(), error) {
+		gatewaySrv = &http.Server{
+			Addr:              cfg.Gateway.Listen,
+			Handler:           newGatewayHandler(iamSrv, adminEnabled, apiGate),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			if err := gatewaySrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal(exitBind, "failed starting gateway", err)
+			}
+		}()
+
+		logger.Infow("starting HTTP gateway", "address", cfg.Gateway.Listen)
+
+		return nil, nil
+	})
+
+	unary := []grpc.UnaryServerInterceptor{iamSrv.AdminUnaryInterceptor()}
+
+	// Without emulation, calls skip the RPC profiles entirely.
+	if rpcProfiles != nil {
+		unary = append(unary, iamSrv.EmulationUnaryInterceptor())
+	}
+
+	// Last, so only requests answered by the policy are mirrored.
+	if cfg.Shadow.Enabled() {
+		unary = append(unary, iamSrv.ShadowUnaryInterceptor())
+	}
+
+	// newServer returns a gRPC server serving the given APIs, or every API if apis is empty.
+	newServer := func(apis []string) grpcServer {
+		grpcSrv, err := newGRPCServer(ctx, cfg,
+			grpc.StatsHandler(iamSrv.StatsHandler()),
+			grpc.ChainUnaryInterceptor(unary...),
+			grpc.ChainStreamInterceptor(iamSrv.AdminStreamInterceptor()),
+		)
+		if err != nil {
+			fatal(exitFailure, "failed to create gRPC server", err)
+		}
+
+		// Experimental APIs, and those the listeners do not serve, are left out of the registered
+		// services.
+		registrar := apitier.Registrar(grpcSrv, apiGate.Only(apis), logger)
+
+		authorization.RegisterAuthorizationServer(registrar, iamSrv)
+		authentication.RegisterAuthenticationServer(registrar, iamSrv)
+		identity.RegisterIdentityServer(registrar, iamSrv)
+
+		if cfg.CredentialRotation.Enabled || apiGate.Allowed(apitier.CredentialListing) {
+			credentials.RegisterCredentialsServer(registrar, iamSrv)
+		}
+
+		if adminEnabled {
+			admin.RegisterAdminServer(registrar, iamSrv)
+		}
+
+		healthpb.RegisterHealthServer(registrar, healthSrv)
+
+		return grpcSrv
+	}
+
+	// Listeners serving the same APIs share a gRPC server. Those serving different APIs each get
+	// their own, so a listener cannot reach a service it was not configured with.
+	grpcServers := make(map[string]grpcServer)
+
+	for _, l := range listeners {
+		if _, ok := grpcServers[l.apiSet()]; !ok {
+			grpcServers[l.apiSet()] = newServer(l.apis)
+		}
+	}
+
+	if experimental := apiGate.Enabled(); len(experimental) > 0 {
+		logger.Warnw("serving experimental APIs, which may change or be removed in any release", "apis", experimental)
+	}
+
+	logger.Infow("components started", "components", registry.Started())
+
+	serveListeners(grpcServers, listeners)
+
+	if prober != nil {
+		res := prober.Probe(ctx)
+
+		switch {
+		case res.OK:
+			logger.Infow("self-test probe passed", "subject", res.Subject, "latency", res.Latency)
+		case cfg.Probe.SelfTest:
+			fatal(exitFailure, "self-test probe failed", errors.New(res.Error))
+		default:
+			logger.Errorw("self-test probe failed", "error", res.Error)
+		}
+
+		if cfg.Probe.Interval > 0 {
+			go prober.Run(ctx, cfg.Probe.Interval)
+		}
+	}
+
+	stopHook := func() {}
+
+	if started != nil {
+		stop, err := started(ctx, iamSrv, refresh)
+		if err != nil {
+			fatal(exitFailure, "failed to start serving", err)
+		}
+
+		stopHook = stop
+	}
+
+	select {
+	case sig := <-c:
+		logger.Infow("signal received, draining in-flight requests", "signal", sig.String(), "timeout", cfg.ShutdownTimeout)
+	case <-ctx.Done():
+		logger.Infow("stopping, draining in-flight requests", "timeout", cfg.ShutdownTimeout)
+	}
+
+	stopHook()
+
+	// Health checks report NOT_SERVING from here on, so no new requests are routed to the runtime.
+	healthSrv.Shutdown()
+
+	shutdownCtx, cancelShutdown := shutdownContext(cfg.ShutdownTimeout)
+	defer cancelShutdown()
+
+	var drained sync.WaitGroup
+
+	for _, srv := range grpcServers {
+		drained.Add(1)
+
+		go func(srv grpcServer) {
+			defer drained.Done()
+
+			drainGRPC(shutdownCtx, srv)
+		}(srv)
+	}
+
+	drained.Wait()
+
+	if gatewaySrv != nil {
+		if err := gatewaySrv.Shutdown(shutdownCtx); err != nil {
+			logger.Warnw("failed to stop gateway", "error", err)
+		}
+	}
+
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+			logger.Warnw("failed to stop metrics server", "error", err)
+		}
+	}
 
 	return nil
 }
+
+// healthServices are the services whose status the gRPC health service reports, with the empty
+// name for the runtime as a whole.
+var healthServices = []string{"", authorization.Authorization_ServiceDesc.ServiceName, authentication.Authentication_ServiceDesc.ServiceName}
+
+// setServingStatus reports every health service as serving or not serving.
+func setServingStatus(healthSrv *health.Server, serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+
+	for _, svc := range healthServices {
+		healthSrv.SetServingStatus(svc, status)
+	}
+}
+
+// defaultShutdownTimeout is the default of --shutdown-timeout. It leaves time within Kubernetes'
+// default termination grace period of 30 seconds for the rest of shutdown.
+const defaultShutdownTimeout = 25 * time.Second
+
+// shutdownContext returns the context bounding shutdown, which is done after timeout, or never if
+// timeout is zero.
+func shutdownContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// drainGRPC stops srv once its in-flight requests finish, or, if ctx is done first, cancels them
+// and stops it immediately.
+func drainGRPC(ctx context.Context, srv grpcServer) {
+	drained := make(chan struct{})
+
+	go func() {
+		srv.GracefulStop()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		logger.Info("in-flight requests drained, server stopped")
+	case <-ctx.Done():
+		logger.Warn("shutdown timeout reached, cancelling in-flight requests")
+
+		srv.Stop()
+		<-drained
+	}
+}
+
+// newJWTVerifier returns the verifier for JWT credentials, or nil if JWT authentication is not
+// configured.
+func newJWTVerifier(cfg config.JWT, clockSkew time.Duration) (*jwtverify.Verifier, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	var publicKey []byte
+
+	if cfg.PublicKeyFile != "" {
+		b, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		publicKey = b
+	}
+
+	return jwtverify.New(jwtverify.Config{
+		JWKSURL:             cfg.JWKSURL,
+		JWKSRefreshInterval: cfg.JWKSRefreshInterval,
+		PublicKey:           publicKey,
+		Issuers:             cfg.Issuers,
+		Audience:            cfg.Audience,
+		Leeway:              clockSkew,
+	}, logger)
+}
+
+// newCapabilitySigner returns the signer verifying capability tokens, or nil if capability tokens
+// are not configured.
+func newCapabilitySigner(cfg config.Capabilities) (*capability.Signer, error) {
+	if cfg.SigningKeyFile == "" {
+		return nil, nil
+	}
+
+	return readCapabilitySigner(cfg.SigningKeyFile)
+}
+
+// credentialNamespaceOption returns the server option claiming the configured credential prefix,
+// connecting to the upstream runtime if one is set. The returned function closes the connection.
+func credentialNamespaceOption(cfg config.CredentialNamespace) (server.Option, func(), error) {
+	// Validated with the rest of the configuration.
+	code, _ := cfg.Code()
+
+	if cfg.Upstream == "" {
+		return server.WithCredentialNamespace(cfg.Prefix, code, nil), func() {}, nil
+	}
+
+	conn, err := dialRuntime(cfg.Upstream)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	closeConn := func() {
+		conn.Close()
+	}
+
+	return server.WithCredentialNamespace(cfg.Prefix, code, conn), closeConn, nil
+}
+
+// authorizationOption returns the server option deciding access checks with the configured
+// authorization backends, connecting to the upstream runtime if the upstream backend is one, or nil
+// if no backends are configured. The returned function closes the connection.
+func authorizationOption(cfg config.Authorization) (server.Option, func(), error) {
+	if !cfg.Enabled() {
+		return nil, func() {}, nil
+	}
+
+	// Validated with the rest of the configuration.
+	combine, combinator := config.CombinePriority, server.Priority
+
+	switch cfg.Combine {
+	case config.CombineFirstAllow:
+		combine, combinator = cfg.Combine, server.FirstAllow
+	case config.CombineAllMustAllow:
+		combine, combinator = cfg.Combine, server.AllMustAllow
+	}
+
+	closeConn := func() {}
+
+	backends := make([]server.Backend, 0, len(cfg.Backends))
+
+	for _, name := range cfg.Backends {
+		switch name {
+		case config.BackendPolicy:
+			backends = append(backends, server.PolicyBackend())
+		case config.BackendRelationships:
+			backends = append(backends, server.RelationshipsBackend())
+		case config.BackendUpstream:
+			conn, err := dialRuntime(cfg.Upstream)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			closeConn = func() {
+				conn.Close()
+			}
+
+			backends = append(backends, server.UpstreamBackend(conn, cfg.Timeout))
+		}
+	}
+
+	logger.Infow("deciding access checks with authorization backends", "backends", cfg.Backends, "combine", combine)
+
+	return server.WithAuthorizationBackends(combinator, backends...), closeConn, nil
+}
+
+// shadowOption returns the server option mirroring requests to the configured shadow runtime, if
+// one is set, or nil. The returned function closes the connection.
+func shadowOption(cfg config.Shadow) (server.Option, func(), error) {
+	if !cfg.Enabled() {
+		return nil, func() {}, nil
+	}
+
+	conn, err := dialRuntime(cfg.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Infow("mirroring requests to shadow runtime", "address", cfg.Address, "sample_ratio", cfg.SampleRatio)
+
+	closeConn := func() {
+		conn.Close()
+	}
+
+	return server.WithShadowRuntime(conn, cfg.SampleRatio, cfg.Timeout), closeConn, nil
+}
+
+// eventFlushTimeout bounds how long shutdown waits for queued events to be published.
+const eventFlushTimeout = 5 * time.Second
+
+func newEventForwarder(cfg config.Events) (*publish.Forwarder, error) {
+	env := cfg.Environment
+	if env == "" {
+		env, _ = os.Hostname()
+	}
+
+	return publish.New(publish.Config{
+		Environment:     env,
+		PseudonymizeKey: []byte(cfg.PseudonymizeKey),
+		NATS: publish.NATSConfig{
+			URL:           cfg.NATS.URL,
+			SubjectPrefix: cfg.NATS.SubjectPrefix,
+		},
+		Kafka: publish.KafkaConfig{
+			Brokers: cfg.Kafka.Brokers,
+			Topic:   cfg.Kafka.Topic,
+		},
+	}, logger)
+}
+
+// Sources of policies that are not read from a file.
+const (
+	policySourceStdin  = "stdin"
+	policySourceInline = "policy-yaml"
+)
+
+// readInlinePolicy returns the inline policy in the configuration, or the policy read from stdin,
+// along with its source.
+func readInlinePolicy(cfg config.Config, stdin io.Reader) ([]byte, string, error) {
+	if cfg.PolicyYAML != "" {
+		return []byte(cfg.PolicyYAML), policySourceInline, nil
+	}
+
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading the policy from stdin: %w", err)
+	}
+
+	return data, policySourceStdin, nil
+}
+
+// refreshFunc refetches the policy from its source and swaps it in if it changed.
+type refreshFunc func(ctx context.Context) error
+
+// newIAMServer creates the runtime server, reading the policy from the configured file or
+// directory, syncing it from git, or mirroring it from a hub. In git mode, the repository is polled in the background and new
+// revisions are swapped in as they are synced. If the repository is unreachable at startup and git
+// sync fails open, the cached policy is served until it can be synced. The returned function refreshes the policy on demand.
+func newIAMServer(ctx context.Context, cfg config.Config, opts ...server.Option) (server.Server, refreshFunc, error) {
+	if cfg.InlinePolicy() {
+		data, source, err := readInlinePolicy(cfg, os.Stdin)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		iamSrv, err := server.NewServerFromReader(bytes.NewReader(data), source, "", logger, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// The policy cannot be read again, so refreshes only re-read the overlays.
+		refresh := func(_ context.Context) error {
+			return iamSrv.UpdatePolicy(bytes.NewReader(data), source, "")
+		}
+
+		return iamSrv, refresh, nil
+	}
+
+	if cfg.PolicyHub.Enabled() {
+		return newMirrorServer(ctx, cfg, opts...)
+	}
+
+	if !cfg.PolicyGit.Enabled() {
+		policyPath := cfg.PolicySource()
+
+		iamSrv, err := server.NewServer(policyPath, logger, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		refresh := func(_ context.Context) error {
+			return iamSrv.UpdatePolicyFile(policyPath)
+		}
+
+		return iamSrv, refresh, nil
+	}
+
+	syncer, err := gitsync.New(gitsync.Config{
+		URL:       cfg.PolicyGit.URL,
+		Branch:    cfg.PolicyGit.Branch,
+		Tag:       cfg.PolicyGit.Tag,
+		Path:      cfg.PolicyGit.Path,
+		Interval:  cfg.PolicyGit.Interval,
+		Username:  cfg.PolicyGit.Username,
+		Password:  cfg.PolicyGit.Password,
+		CacheFile: cfg.PolicyGit.CacheFile,
+	}, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, revision, err := syncer.Sync(ctx)
+	synced := err == nil
+
+	if err != nil {
+		if !cfg.Startup.FailsOpen(config.SubsystemPolicyGit) {
+			return nil, nil, err
+		}
+
+		cached, cachedRevision, cacheErr := syncer.Cached()
+		if cacheErr != nil {
+			return nil, nil, fmt.Errorf("%w; cannot start from cached policy: %w", err, cacheErr)
+		}
+
+		logger.Warnw("failed to sync policy; continuing degraded", "subsystem", config.SubsystemPolicyGit,
+			"fallback", "starting from cached policy until the repository is reachable",
+			"cache", cfg.PolicyGit.CacheFile, "revision", cachedRevision, "error", err)
+
+		data, revision = cached, cachedRevision
+	}
+
+	iamSrv, err := server.NewServerFromReader(bytes.NewReader(data), syncer.Source(), revision, logger, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if synced {
+		syncer.Cache(data, revision)
+
+		logger.Infow("synced policy", "source", syncer.Source(), "revision", revision)
+	}
+
+	apply := func(data []byte, revision string) error {
+		if err := iamSrv.UpdatePolicy(bytes.NewReader(data), syncer.Source(), revision); err != nil {
+			return err
+		}
+
+		logger.Infow("synced policy", "source", syncer.Source(), "revision", revision)
+
+		return nil
+	}
+
+	go syncer.Run(ctx, revision, apply)
+
+	refresh := func(ctx context.Context) error {
+		return syncer.Poll(ctx, apply)
+	}
+
+	return iamSrv, refresh, nil
+}
+
+// newMirrorServer creates the IAM server for newIAMServer with the policy mirrored from a hub,
+// swapping in new revisions as they are synced.
+func newMirrorServer(ctx context.Context, cfg config.Config, opts ...server.Option) (server.Server, refreshFunc, error) {
+	syncer, err := hubsync.New(hubsync.Config{
+		Address:  cfg.PolicyHub.Address,
+		Token:    cfg.PolicyHub.Token,
+		Interval: cfg.PolicyHub.Interval,
+	}, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, revision, err := syncer.Sync(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts = append(opts, server.WithMirroredPolicy(syncer.Source()))
+
+	iamSrv, err := server.NewServerFromReader(bytes.NewReader(data), syncer.Source(), revision, logger, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Infow("synced policy", "source", syncer.Source(), "revision", revision)
+
+	apply := func(data []byte, revision string) error {
+		if err := iamSrv.UpdatePolicy(bytes.NewReader(data), syncer.Source(), revision); err != nil {
+			return err
+		}
+
+		logger.Infow("synced policy", "source", syncer.Source(), "revision", revision)
+
+		return nil
+	}
+
+	go syncer.Run(ctx, revision, apply)
+
+	refresh := func(ctx context.Context) error {
+		return syncer.Poll(ctx, apply)
+	}
+
+	return iamSrv, refresh, nil
+}
+
+// healthReport is the JSON health report served at /healthz.
+type healthReport struct {
+	Status string            `json:"status"`
+	Policy server.PolicyInfo `json:"policy"`
+	// Probe is the latest self-test probe result, if probing is enabled.
+	Probe *probe.Result `json:"probe,omitempty"`
+}
+
+// newHealthReport describes the runtime's health. The status is failing if the latest probe
+// failed. The prober may be nil.
+func newHealthReport(srv server.Server, prober *probe.Prober) healthReport {
+	out := healthReport{
+		Status: "ok",
+		Policy: srv.PolicyInfo(),
+		Probe:  prober.Last(),
+	}
+
+	if out.Probe != nil && !out.Probe.OK {
+		out.Status = "failing"
+	}
+
+	return out
+}
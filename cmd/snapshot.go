@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/config"
+	"github.com/metal-toolbox/iam-runtime-static/internal/policycrypt"
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// snapshotCmd prints the canonical effective policy
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "prints a canonical, fully resolved representation of the policy suitable for golden files",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		decrypter, err := newPolicyDecrypter(cmd)
+		if err != nil {
+			return err
+		}
+
+		return server.Snapshot(policyPath(cmd), policyOverlays(cmd), cmd.OutOrStdout(), policyReadFunc(cmd, decrypter))
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, snapshotCmd, addPolicyFlag)
+}
+
+// addPolicyFlag adds --policy, --policy-dir, and --policy-overlay flags to commands that read a policy without
+// serving it. The flags are not bound to viper, so they do not override the serve command's
+// bindings.
+func addPolicyFlag(cmd *cobra.Command) {
+	cmd.Flags().String("policy", "", "policy file, or - to read it from stdin (default is the configured runtime policy)")
+	cmd.Flags().String("policy-dir", "", "directory of policy files merged into the policy, instead of --policy")
+	cmd.MarkFlagsMutuallyExclusive("policy", "policy-dir")
+	cmd.Flags().StringSlice("policy-overlay", nil, "policy overlay files merged over the policy in order (default is the configured overlays)")
+}
+
+// policyPath returns the policy file or directory given to a command, falling back to the
+// configured policy.
+func policyPath(cmd *cobra.Command) string {
+	for _, name := range []string{"policy", "policy-dir"} {
+		if path, _ := cmd.Flags().GetString(name); path != "" {
+			return path
+		}
+	}
+
+	if dir := viper.GetString("policy-dir"); dir != "" {
+		return dir
+	}
+
+	return viper.GetString("policy")
+}
+
+// policyOverlays returns the policy overlays given to a command, falling back to the configured
+// overlays.
+func policyOverlays(cmd *cobra.Command) []string {
+	if cmd.Flags().Changed("policy-overlay") {
+		paths, _ := cmd.Flags().GetStringSlice("policy-overlay")
+
+		return paths
+	}
+
+	return viper.GetStringSlice("policy-overlays")
+}
+
+// newPolicyDecrypter returns a decrypter for encrypted policies using the configured identity.
+func newPolicyDecrypter(cmd *cobra.Command) (*policycrypt.Decrypter, error) {
+	return policycrypt.New(cmd.Context(), policyDecryptionConfig(config.PolicyEncryption{
+		Identity:        viper.GetString("policy-encryption.identity"),
+		IdentityFile:    viper.GetString("policy-encryption.identity-file"),
+		IdentityCommand: viper.GetString("policy-encryption.identity-command"),
+	}))
+}
+
+// policyReadFunc returns a function reading the policy files given to a command, decrypting them
+// with decrypter. The policy path - reads the policy from the command's stdin, which is read once.
+func policyReadFunc(cmd *cobra.Command, decrypter *policycrypt.Decrypter) server.ReadFileFunc {
+	var (
+		once  sync.Once
+		stdin []byte
+		err   error
+	)
+
+	return decrypter.Wrap(func(path string) ([]byte, error) {
+		if path != config.StdinPolicy {
+			return os.ReadFile(path)
+		}
+
+		once.Do(func() {
+			stdin, err = io.ReadAll(cmd.InOrStdin())
+		})
+
+		return stdin, err
+	})
+}
+
+func policyDecryptionConfig(cfg config.PolicyEncryption) policycrypt.Config {
+	return policycrypt.Config{
+		Identity:        cfg.Identity,
+		IdentityFile:    cfg.IdentityFile,
+		IdentityCommand: cfg.IdentityCommand,
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+// validateReport is the JSON report of the validate command.
+type validateReport struct {
+	Valid       bool                `json:"valid"`
+	Diagnostics []server.Diagnostic `json:"diagnostics"`
+	// Summary is only set for valid policies.
+	Summary *server.PolicySummary `json:"summary,omitempty"`
+}
+
+// validateCmd validates the policy without starting the server
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "validates the policy and its overlays, resolving token environment variables, and prints a summary",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		failOnWarnings, _ := cmd.Flags().GetBool("fail-on-warnings")
+
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		decrypter, err := newPolicyDecrypter(cmd)
+		if err != nil {
+			return err
+		}
+
+		read := policyReadFunc(cmd, decrypter)
+
+		diags := server.Validate(policyPath(cmd), policyOverlays(cmd), read)
+
+		var errs, warnings int
+
+		for _, d := range diags {
+			if d.Severity == server.SeverityError {
+				errs++
+			} else {
+				warnings++
+			}
+		}
+
+		report := validateReport{Valid: errs == 0, Diagnostics: diags}
+
+		if report.Diagnostics == nil {
+			report.Diagnostics = []server.Diagnostic{}
+		}
+
+		if report.Valid {
+			summary, err := server.Summarize(policyPath(cmd), policyOverlays(cmd), read)
+			if err != nil {
+				return err
+			}
+
+			report.Summary = &summary
+		}
+
+		if err := writeOutput(cmd, format, report, func(w io.Writer) error {
+			for _, d := range diags {
+				fmt.Fprintln(w, d)
+			}
+
+			if s := report.Summary; s != nil {
+				fmt.Fprintf(w, "policy is valid: %d subjects, %d roles, %d resources, %d of %d tokens set\n",
+					s.Subjects, s.Roles, s.Resources, s.TokensSet, s.Tokens)
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		switch {
+		case errs > 0:
+			return fmt.Errorf("%d errors", errs)
+		case failOnWarnings && warnings > 0:
+			return fmt.Errorf("%d warnings", warnings)
+		default:
+			return nil
+		}
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, validateCmd, addPolicyFlag, addFormatFlag)
+
+	validateCmd.Flags().Bool("fail-on-warnings", false, "fail if there are warnings, such as token environment variables that are not set")
+}
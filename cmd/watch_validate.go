@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/lsp"
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+)
+
+// watchDebounce coalesces the bursts of events editors produce when saving a file.
+const watchDebounce = 100 * time.Millisecond
+
+// watchReport is the JSON report of a validation by the watch-validate command.
+type watchReport struct {
+	Time time.Time `json:"time"`
+	// Valid reports whether there are no errors. There may be warnings.
+	Valid       bool                `json:"valid"`
+	Diagnostics []server.Diagnostic `json:"diagnostics"`
+}
+
+// watchValidateCmd continuously validates the policy as it is edited
+var watchValidateCmd = &cobra.Command{
+	Use:   "watch-validate",
+	Short: "watches the policy and its overlays and prints validation diagnostics whenever they change",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		files, err := absPaths(append([]string{policyPath(cmd)}, policyOverlays(cmd)...))
+		if err != nil {
+			return err
+		}
+
+		decrypter, err := newPolicyDecrypter(cmd)
+		if err != nil {
+			return err
+		}
+
+		validate := func(read server.ReadFileFunc) []server.Diagnostic {
+			// Files are read from disk, unless the editor has them open.
+			if read == nil {
+				read = os.ReadFile
+			}
+
+			return server.Validate(files[0], files[1:], decrypter.Wrap(read))
+		}
+
+		if useLSP, _ := cmd.Flags().GetBool("lsp"); useLSP {
+			return lsp.New(files, validate).Serve(cmd.InOrStdin(), cmd.OutOrStdout())
+		}
+
+		return watchValidate(cmd, format, files, validate)
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, watchValidateCmd, addPolicyFlag, addFormatFlag)
+
+	watchValidateCmd.Flags().Bool("lsp", false, "speak the Language Server Protocol over stdio instead of watching files, publishing diagnostics for open policy documents")
+
+	watchValidateCmd.MarkFlagsMutuallyExclusive("lsp", "format")
+}
+
+func watchValidate(cmd *cobra.Command, format string, files []string, validate lsp.ValidateFunc) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	defer watcher.Close()
+
+	watched, err := watchPolicyFiles(watcher, files)
+	if err != nil {
+		return err
+	}
+
+	if err := printDiagnostics(cmd.OutOrStdout(), format, validate(nil)); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-cmd.Context().Done():
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if watched.matches(ev.Name) {
+				timer.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			return err
+		case <-timer.C:
+			if err := printDiagnostics(cmd.OutOrStdout(), format, validate(nil)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// printDiagnostics writes the diagnostics of a validation in format. Each validation is written as
+// a single line of JSON, or as a YAML document, so tools can read them as they are written.
+func printDiagnostics(w io.Writer, format string, diags []server.Diagnostic) error {
+	now := time.Now()
+
+	switch format {
+	case formatJSON, formatYAML:
+		report := watchReport{Time: now, Valid: true, Diagnostics: diags}
+
+		if report.Diagnostics == nil {
+			report.Diagnostics = []server.Diagnostic{}
+		}
+
+		for _, d := range diags {
+			if d.Severity == server.SeverityError {
+				report.Valid = false
+			}
+		}
+
+		if format == formatJSON {
+			return json.NewEncoder(w).Encode(report)
+		}
+
+		fmt.Fprintln(w, "---")
+
+		return writeYAML(w, report)
+	}
+
+	fmt.Fprintf(w, "--- %s\n", now.Format(time.TimeOnly))
+
+	if len(diags) == 0 {
+		fmt.Fprintln(w, "policy is valid")
+
+		return nil
+	}
+
+	for _, d := range diags {
+		fmt.Fprintln(w, d.String())
+	}
+
+	return nil
+}
+
+func absPaths(paths []string) ([]string, error) {
+	out := make([]string, 0, len(paths))
+
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, abs)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// errWizardInput is returned when the wizard's input ends before the policy is complete.
+var errWizardInput = errors.New("input ended before the policy was complete")
+
+// tokenVarPattern matches characters that cannot appear in a token variable name.
+var tokenVarPattern = regexp.MustCompile(`[^A-Z0-9_]+`)
+
+// wizardPolicy is the subset of the policy format written by the wizard.
+type wizardPolicy struct {
+	Subjects []wizardSubject `yaml:"subjects"`
+}
+
+type wizardSubject struct {
+	ID        string           `yaml:"id"`
+	Tokens    []wizardToken    `yaml:"tokens"`
+	Resources []wizardResource `yaml:"resources"`
+}
+
+type wizardToken struct {
+	EnvVar string `yaml:"envVar"`
+}
+
+type wizardResource struct {
+	ID      string   `yaml:"id"`
+	Actions []string `yaml:"actions"`
+}
+
+// initCmd interactively builds a policy
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "interactively writes a policy and an env file template for its tokens",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policyOut, _ := cmd.Flags().GetString("output")
+		envOut, _ := cmd.Flags().GetString("env-file")
+		force, _ := cmd.Flags().GetBool("force")
+
+		if !force {
+			for _, path := range []string{policyOut, envOut} {
+				if err := refuseOverwrite(path); err != nil {
+					return err
+				}
+			}
+		}
+
+		p, err := runWizard(cmd.InOrStdin(), cmd.OutOrStdout())
+		if err != nil {
+			return err
+		}
+
+		return writeWizardPolicy(cmd.OutOrStdout(), p, policyOut, envOut)
+	},
+}
+
+func init() {
+	registerCommand(rootCmd, initCmd)
+
+	initCmd.Flags().String("output", scaffoldPolicyFile, "file to write the policy to")
+	initCmd.Flags().String("env-file", scaffoldTokensFile, "file to write the token variable template to")
+	initCmd.Flags().Bool("force", false, "overwrite existing files")
+}
+
+// wizardPrompter reads answers to prompts, one per line.
+type wizardPrompter struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+// ask prints the prompt and returns the trimmed answer, or def if the answer is empty.
+func (w *wizardPrompter) ask(prompt, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", prompt, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", prompt)
+	}
+
+	if !w.scanner.Scan() {
+		fmt.Fprintln(w.out)
+
+		if err := w.scanner.Err(); err != nil {
+			return "", err
+		}
+
+		return "", errWizardInput
+	}
+
+	answer := strings.TrimSpace(w.scanner.Text())
+	if answer == "" {
+		return def, nil
+	}
+
+	return answer, nil
+}
+
+// runWizard prompts for subjects, their token variables, and the actions they are granted on each
+// resource. An empty answer ends a list.
+func runWizard(in io.Reader, out io.Writer) (wizardPolicy, error) {
+	w := &wizardPrompter{scanner: bufio.NewScanner(in), out: out}
+
+	var p wizardPolicy
+
+	subjects := make(map[string]bool)
+	tokenVars := make(map[string]bool)
+
+	fmt.Fprintln(out, "Describe each subject and what it may do. Leave an answer empty to finish a list.")
+
+	for {
+		id, err := w.ask("\nSubject ID", "")
+		if err != nil {
+			return p, err
+		}
+
+		if id == "" {
+			if len(p.Subjects) == 0 {
+				fmt.Fprintln(out, "The policy needs at least one subject.")
+
+				continue
+			}
+
+			return p, nil
+		}
+
+		if subjects[id] {
+			fmt.Fprintf(out, "Subject %s was already added.\n", id)
+
+			continue
+		}
+
+		tokenVar, err := askTokenVar(w, id, tokenVars)
+		if err != nil {
+			return p, err
+		}
+
+		resources, err := askResources(w)
+		if err != nil {
+			return p, err
+		}
+
+		subjects[id] = true
+		tokenVars[tokenVar] = true
+
+		p.Subjects = append(p.Subjects, wizardSubject{
+			ID:        id,
+			Tokens:    []wizardToken{{EnvVar: tokenVar}},
+			Resources: resources,
+		})
+	}
+}
+
+func askTokenVar(w *wizardPrompter, subject string, used map[string]bool) (string, error) {
+	def := strings.Trim(tokenVarPattern.ReplaceAllString(strings.ToUpper(subject), "_"), "_") + "_TOKEN"
+
+	for {
+		tokenVar, err := w.ask("  Token environment variable", def)
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case tokenVarPattern.MatchString(tokenVar):
+			fmt.Fprintln(w.out, "  Use only upper-case letters, digits, and underscores.")
+		case used[tokenVar]:
+			fmt.Fprintf(w.out, "  %s is already used by another subject.\n", tokenVar)
+		default:
+			return tokenVar, nil
+		}
+	}
+}
+
+func askResources(w *wizardPrompter) ([]wizardResource, error) {
+	var out []wizardResource
+
+	seen := make(map[string]int)
+
+	for {
+		id, err := w.ask("  Resource ID", "")
+		if err != nil || id == "" {
+			return out, err
+		}
+
+		answer, err := w.ask("    Actions (comma-separated)", "")
+		if err != nil {
+			return out, err
+		}
+
+		actions := splitActions(answer)
+		if len(actions) == 0 {
+			fmt.Fprintln(w.out, "    No actions given; the resource was not added.")
+
+			continue
+		}
+
+		// Repeating a resource adds to its actions.
+		if i, ok := seen[id]; ok {
+			out[i].Actions = mergeActions(out[i].Actions, actions)
+
+			continue
+		}
+
+		seen[id] = len(out)
+
+		out = append(out, wizardResource{ID: id, Actions: actions})
+	}
+}
+
+// splitActions splits a comma- or space-separated list, dropping empty and repeated actions.
+func splitActions(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+
+	return mergeActions(nil, fields)
+}
+
+func mergeActions(actions, more []string) []string {
+	for _, a := range more {
+		dup := false
+
+		for _, existing := range actions {
+			if existing == a {
+				dup = true
+
+				break
+			}
+		}
+
+		if !dup {
+			actions = append(actions, a)
+		}
+	}
+
+	return actions
+}
+
+// writeWizardPolicy validates the policy and writes it along with an env file listing its token
+// variables.
+func writeWizardPolicy(out io.Writer, p wizardPolicy, policyPath, envPath string) error {
+	var buf bytes.Buffer
+
+	buf.WriteString("# Generated by iam-runtime-static init.\n")
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(p); err != nil {
+		return err
+	}
+
+	b := buf.Bytes()
+
+	// Validate the policy before writing it. Token variables are not set yet, so only errors
+	// matter.
+	read := func(string) ([]byte, error) {
+		return b, nil
+	}
+
+	for _, d := range server.Validate(policyPath, nil, read) {
+		if d.Severity == server.SeverityError {
+			return fmt.Errorf("policy is invalid: %s", d)
+		}
+	}
+
+	var env strings.Builder
+
+	env.WriteString("# Set a token for each subject. Load with: set -a; . " + sourcePath(envPath) + "; set +a\n")
+
+	for _, sub := range p.Subjects {
+		fmt.Fprintf(&env, "# %s\n%s=\n", sub.ID, sub.Tokens[0].EnvVar)
+	}
+
+	if err := os.WriteFile(policyPath, b, 0o644); err != nil {
+		return err
+	}
+
+	// The template holds tokens once filled in.
+	if err := os.WriteFile(envPath, []byte(env.String()), 0o600); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\nWrote %s and %s. Fill in the tokens in %s, then run:\n\n", policyPath, envPath, envPath)
+	fmt.Fprintf(out, "  set -a; . %s; set +a\n", sourcePath(envPath))
+	fmt.Fprintf(out, "  %s serve --policy %s\n", appName, policyPath)
+
+	return nil
+}
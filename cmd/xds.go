@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/component"
+	"github.com/metal-toolbox/iam-runtime-static/internal/config"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/orca"
+	"google.golang.org/grpc/xds"
+)
+
+// grpcServer is the subset of the gRPC server API used to serve the runtime. It is satisfied by
+// both *grpc.Server and *xds.GRPCServer.
+type grpcServer interface {
+	grpc.ServiceRegistrar
+	Serve(lis net.Listener) error
+	GracefulStop()
+	Stop()
+}
+
+// newGRPCServer creates a gRPC server for the runtime. If xDS is enabled, the server is
+// configured by the xDS management server named in the bootstrap file and reports load to
+// clients using per-call ORCA metrics in response trailers. extra options are added to those
+// derived from cfg.
+func newGRPCServer(ctx context.Context, cfg config.Config, extra ...grpc.ServerOption) (grpcServer, error) {
+	opts := append(grpcServerOptions(cfg.GRPC), extra...)
+
+	// Validated to succeed.
+	components, _ := cfg.Components.Set()
+
+	if components.Enabled(component.Tracing, cfg.ComponentConfigured(component.Tracing)) {
+		opts = append(opts, grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	}
+
+	if !cfg.XDS.Enabled {
+		return grpc.NewServer(opts...), nil
+	}
+
+	recorder := orca.NewServerMetricsRecorder()
+	tracker := &qpsTracker{recorder: recorder}
+
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(tracker.unaryInterceptor),
+		orca.CallMetricsServerOption(recorder),
+		xds.ServingModeCallback(func(addr net.Addr, args xds.ServingModeChangeArgs) {
+			logger.Infow("xDS serving mode changed",
+				"address", addr.String(),
+				"mode", args.Mode.String(),
+				"error", args.Err,
+			)
+		}),
+	)
+
+	srv, err := xds.NewGRPCServer(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	go tracker.run(ctx)
+
+	return srv, nil
+}
+
+// qpsTracker counts unary requests and periodically reports the observed rate as the server's
+// QPS in ORCA load reports.
+type qpsTracker struct {
+	recorder orca.ServerMetricsRecorder
+	count    atomic.Int64
+}
+
+func (t *qpsTracker) unaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	t.count.Add(1)
+
+	return handler(ctx, req)
+}
+
+func (t *qpsTracker) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.recorder.SetQPS(float64(t.count.Swap(0)))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package alert sends notifications about authorization decisions on sensitive actions and about
+// rejected policy updates.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// sendTimeout bounds how long a single webhook delivery may take.
+const sendTimeout = 10 * time.Second
+
+// Alert kinds.
+const (
+	// KindSensitiveDecision alerts on an authorization decision on a sensitive action.
+	KindSensitiveDecision = "sensitive_decision"
+	// KindPolicyRejected alerts on a policy update that was refused, leaving the previous policy
+	// active. Message describes why.
+	KindPolicyRejected = "policy_rejected"
+)
+
+// Event describes an authorization decision on a sensitive action, or a rejected policy update.
+type Event struct {
+	// Kind is one of the Kind constants.
+	Kind string `json:"kind"`
+	// Message describes the event, if it is not a decision.
+	Message string `json:"message,omitempty"`
+	// Subject is the subject the decision was made for.
+	Subject string `json:"subject"`
+	// Actor is the delegate acting on behalf of Subject, if any.
+	Actor      string    `json:"actor,omitempty"`
+	Action     string    `json:"action"`
+	ResourceID string    `json:"resourceId"`
+	Allowed    bool      `json:"allowed"`
+	Time       time.Time `json:"time"`
+	// Metadata holds the captured request metadata, if any.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Notifier delivers alert events. Notify must not block the caller.
+type Notifier interface {
+	Notify(ev Event)
+}
+
+// Webhook is a Notifier that POSTs each event as JSON to a URL.
+type Webhook struct {
+	url    string
+	client *http.Client
+	logger *zap.SugaredLogger
+}
+
+// NewWebhook creates a Notifier posting events to the given URL.
+func NewWebhook(url string, logger *zap.SugaredLogger) *Webhook {
+	return &Webhook{
+		url: url,
+		client: &http.Client{
+			Timeout: sendTimeout,
+		},
+		logger: logger,
+	}
+}
+
+// Notify sends the event in the background. Delivery failures are logged.
+func (w *Webhook) Notify(ev Event) {
+	go func() {
+		if err := w.send(ev); err != nil {
+			w.logger.Warnw("failed to send alert", "error", err, "kind", ev.Kind, "subject", ev.Subject, "action", ev.Action)
+		}
+	}()
+}
+
+func (w *Webhook) send(ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,288 @@
+// Package apitier assigns the gRPC APIs the runtime serves a stability tier. Experimental APIs are
+// only registered on the gRPC server when enabled explicitly, so clients in shared environments
+// cannot come to rely on them by accident.
+package apitier
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/credentials"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/identity"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authentication"
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Tier is the stability of an API.
+type Tier string
+
+// Stability tiers.
+const (
+	// Stable APIs are always registered, and only change compatibly.
+	Stable Tier = "stable"
+	// Experimental APIs are only registered if enabled, and may change or be removed in any
+	// release.
+	Experimental Tier = "experimental"
+)
+
+// API names.
+const (
+	Authorization     = "authorization"
+	Authentication    = "authentication"
+	Identity          = "identity"
+	Health            = "health"
+	Admin             = "admin"
+	Credentials       = "credentials"
+	CredentialListing = "credential-listing"
+	PolicyMutations   = "policy-mutations"
+	MintToken         = "mint-token"
+	SubjectUsage      = "subject-usage"
+	SubjectExpiry     = "subject-expiry"
+	PolicyExport      = "policy-export"
+)
+
+// API is a group of RPCs sharing a tier.
+type API struct {
+	Name    string
+	Tier    Tier
+	Service string
+	// Methods lists the RPCs of the service the API is made of, or is empty if it is made of every
+	// RPC of the service not in another API.
+	Methods []string
+}
+
+// APIs lists every API the runtime serves.
+var APIs = []API{
+	{Name: Authorization, Tier: Stable, Service: authorization.Authorization_ServiceDesc.ServiceName},
+	{Name: Authentication, Tier: Stable, Service: authentication.Authentication_ServiceDesc.ServiceName},
+	{Name: Identity, Tier: Stable, Service: identity.Identity_ServiceDesc.ServiceName},
+	{Name: Health, Tier: Stable, Service: healthpb.Health_ServiceDesc.ServiceName},
+	{Name: Admin, Tier: Stable, Service: admin.Admin_ServiceDesc.ServiceName},
+	{Name: Credentials, Tier: Experimental, Service: credentials.Credentials_ServiceDesc.ServiceName},
+	{Name: CredentialListing, Tier: Experimental, Service: credentials.Credentials_ServiceDesc.ServiceName, Methods: []string{"ListCredentials"}},
+	{
+		Name:    PolicyMutations,
+		Tier:    Experimental,
+		Service: admin.Admin_ServiceDesc.ServiceName,
+		Methods: []string{"PatchPolicy", "AddSubject", "RemoveSubject", "GrantAccess", "RevokeAccess"},
+	},
+	{Name: MintToken, Tier: Experimental, Service: admin.Admin_ServiceDesc.ServiceName, Methods: []string{"MintToken"}},
+	{Name: SubjectUsage, Tier: Experimental, Service: admin.Admin_ServiceDesc.ServiceName, Methods: []string{"GetSubjectUsage"}},
+	{Name: SubjectExpiry, Tier: Experimental, Service: admin.Admin_ServiceDesc.ServiceName, Methods: []string{"EnableSubject"}},
+	{Name: PolicyExport, Tier: Experimental, Service: admin.Admin_ServiceDesc.ServiceName, Methods: []string{"ExportPolicy"}},
+}
+
+// ErrUnknownAPI represents an error where an API name is not that of an experimental API.
+var ErrUnknownAPI = errors.New("unknown experimental API")
+
+// Lookup returns the API a method belongs to, given as its service name and method name. Methods
+// of services the runtime does not list belong to no API, and are reported as not found.
+func Lookup(service, method string) (API, bool) {
+	var (
+		out   API
+		found bool
+	)
+
+	for _, api := range APIs {
+		if api.Service != service {
+			continue
+		}
+
+		for _, m := range api.Methods {
+			if m == method {
+				return api, true
+			}
+		}
+
+		if len(api.Methods) == 0 {
+			out, found = api, true
+		}
+	}
+
+	return out, found
+}
+
+// Names returns the names of every API, in the order they are listed.
+func Names() []string {
+	out := make([]string, len(APIs))
+
+	for i, api := range APIs {
+		out[i] = api.Name
+	}
+
+	return out
+}
+
+// ExperimentalNames returns the names of the experimental APIs, in the order they are listed.
+func ExperimentalNames() []string {
+	var out []string
+
+	for _, api := range APIs {
+		if api.Tier == Experimental {
+			out = append(out, api.Name)
+		}
+	}
+
+	return out
+}
+
+// Gate records which experimental APIs are enabled.
+type Gate struct {
+	all     bool
+	enabled map[string]bool
+	// The APIs a listener is limited to, or nil for every API
+	only map[string]bool
+}
+
+// NewGate returns a gate enabling the named experimental APIs, or all of them if all is set.
+func NewGate(all bool, names []string) (*Gate, error) {
+	out := &Gate{
+		all:     all,
+		enabled: make(map[string]bool, len(names)),
+	}
+
+	experimental := ExperimentalNames()
+
+	for _, name := range names {
+		if !contains(experimental, name) {
+			return nil, fmt.Errorf("%w '%s': must be one of %s", ErrUnknownAPI, name, strings.Join(experimental, ", "))
+		}
+
+		out.enabled[name] = true
+	}
+
+	return out, nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Only returns a gate allowing the APIs g allows that are named, for a listener limited to them.
+// The health API is always allowed, so every listener can be health checked. If names is empty,
+// g is returned.
+func (g *Gate) Only(names []string) *Gate {
+	if len(names) == 0 {
+		return g
+	}
+
+	out := *g
+	out.only = map[string]bool{Health: true}
+
+	for _, name := range names {
+		out.only[name] = true
+	}
+
+	return &out
+}
+
+// Allowed reports whether the named API is served: if it is stable, or an enabled experimental API,
+// and the gate is not limited to other APIs.
+func (g *Gate) Allowed(name string) bool {
+	if g.only != nil && !g.only[name] {
+		return false
+	}
+
+	for _, api := range APIs {
+		if api.Name == name {
+			return api.Tier == Stable || g.all || g.enabled[name]
+		}
+	}
+
+	return false
+}
+
+// MethodAllowed reports whether the method with the given full name, such as
+// /runtime.iam.static.admin.v1.Admin/MintToken, is served. Methods belonging to no API are.
+func (g *Gate) MethodAllowed(fullMethod string) bool {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+
+	api, ok := Lookup(service, method)
+	if !ok {
+		return true
+	}
+
+	return g.Allowed(api.Name)
+}
+
+// Enabled returns the names of the experimental APIs served, in the order they are listed.
+func (g *Gate) Enabled() []string {
+	var out []string
+
+	for _, name := range ExperimentalNames() {
+		if g.Allowed(name) {
+			out = append(out, name)
+		}
+	}
+
+	return out
+}
+
+// registrar registers only the methods a gate allows.
+type registrar struct {
+	grpc.ServiceRegistrar
+
+	gate   *Gate
+	logger *zap.SugaredLogger
+}
+
+// Registrar returns a registrar registering services with reg without the methods of the
+// experimental APIs gate does not enable, which clients then see as unimplemented. Services left
+// without methods are not registered at all.
+func Registrar(reg grpc.ServiceRegistrar, gate *Gate, logger *zap.SugaredLogger) grpc.ServiceRegistrar {
+	return &registrar{
+		ServiceRegistrar: reg,
+		gate:             gate,
+		logger:           logger,
+	}
+}
+
+func (r *registrar) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	gated := *desc
+	gated.Methods = nil
+	gated.Streams = nil
+
+	var skipped []string
+
+	for _, m := range desc.Methods {
+		if !r.gate.MethodAllowed("/" + desc.ServiceName + "/" + m.MethodName) {
+			skipped = append(skipped, m.MethodName)
+
+			continue
+		}
+
+		gated.Methods = append(gated.Methods, m)
+	}
+
+	for _, s := range desc.Streams {
+		if !r.gate.MethodAllowed("/" + desc.ServiceName + "/" + s.StreamName) {
+			skipped = append(skipped, s.StreamName)
+
+			continue
+		}
+
+		gated.Streams = append(gated.Streams, s)
+	}
+
+	if len(skipped) > 0 {
+		r.logger.Debugw("experimental RPCs not registered", "service", desc.ServiceName, "rpcs", skipped)
+	}
+
+	if len(gated.Methods) == 0 && len(gated.Streams) == 0 {
+		return
+	}
+
+	r.ServiceRegistrar.RegisterService(&gated, impl)
+}
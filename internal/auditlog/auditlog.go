@@ -0,0 +1,406 @@
+// Package auditlog records events from the event bus in a numbered log that collectors read from
+// a cursor and acknowledge, so decisions are delivered at least once even if a collector
+// disconnects. With a store file, the log and acknowledgments survive runtime restarts.
+package auditlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/internal/linebuf"
+
+	"go.uber.org/zap"
+)
+
+// DefaultRetention is the number of records kept when Config.Retention is not set.
+const DefaultRetention = 10000
+
+// maxRecordSize bounds the length of a record read from the store.
+const maxRecordSize = 1 << 20
+
+var (
+	// ErrCursorExpired is returned when records after a cursor are no longer retained.
+	ErrCursorExpired = errors.New("audit records after cursor are no longer retained")
+	// ErrCursorAhead is returned when acknowledging a cursor that has not been written.
+	ErrCursorAhead = errors.New("audit cursor is ahead of the log")
+	// ErrNoConsumer is returned when acknowledging without naming a consumer.
+	ErrNoConsumer = errors.New("no audit consumer given")
+)
+
+// Config configures the log.
+type Config struct {
+	// Path is the store file records are appended to, as JSON lines. Acknowledgments are stored
+	// next to it, in Path with a .cursors suffix. If empty, the log is kept in memory only.
+	Path string
+	// Retention is the number of most recent records kept. If zero, DefaultRetention is used.
+	Retention int
+}
+
+// Record is an event in the log.
+type Record struct {
+	// Cursor numbers the record. Cursors start at one and increase by one per record.
+	Cursor uint64          `json:"cursor"`
+	Kind   string          `json:"kind"`
+	Time   time.Time       `json:"time"`
+	Event  json.RawMessage `json:"event"`
+}
+
+// Log is an event bus subscriber recording events. It is safe for concurrent use.
+type Log struct {
+	path   string
+	retain int
+	logger *zap.SugaredLogger
+
+	mu sync.Mutex
+	// Retained records, oldest first
+	records []Record
+	// Cursor of the next record
+	next uint64
+	// Store file and the number of records written to it since it was last compacted
+	file    *os.File
+	written int
+	// Last cursor acknowledged by each consumer
+	acks map[string]uint64
+	// Closed and replaced when a record is appended
+	appended chan struct{}
+}
+
+// Open returns a log, reading the records and acknowledgments in the store file if one is
+// configured.
+func Open(cfg Config, logger *zap.SugaredLogger) (*Log, error) {
+	retain := cfg.Retention
+	if retain <= 0 {
+		retain = DefaultRetention
+	}
+
+	l := &Log{
+		path:     cfg.Path,
+		retain:   retain,
+		logger:   logger,
+		next:     1,
+		acks:     make(map[string]uint64),
+		appended: make(chan struct{}),
+	}
+
+	if cfg.Path == "" {
+		return l, nil
+	}
+
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+
+	// Start from a compacted store, which also drops any partially written last record.
+	if err := l.compact(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// load reads the store and cursors files, if they exist.
+func (l *Log) load() error {
+	f, err := os.Open(l.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, maxRecordSize)
+
+		for line := 1; scanner.Scan(); line++ {
+			var rec Record
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.Cursor < l.next {
+				l.logger.Warnw("skipping unreadable audit record", "path", l.path, "line", line)
+
+				continue
+			}
+
+			l.add(rec)
+		}
+
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("reading audit log %s: %w", l.path, err)
+		}
+	}
+
+	b, err := os.ReadFile(l.cursorsPath())
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if err := json.Unmarshal(b, &l.acks); err != nil {
+		return fmt.Errorf("reading audit cursors %s: %w", l.cursorsPath(), err)
+	}
+
+	return nil
+}
+
+func (l *Log) cursorsPath() string {
+	return l.path + ".cursors"
+}
+
+// add retains a record, dropping the oldest beyond the retention limit.
+func (l *Log) add(rec Record) {
+	l.records = append(l.records, rec)
+	l.next = rec.Cursor + 1
+
+	if len(l.records) > l.retain {
+		// Reslicing keeps appends cheap; the dropped records are freed when append next
+		// reallocates.
+		l.records = l.records[len(l.records)-l.retain:]
+	}
+}
+
+// compact rewrites the store with only the retained records, replacing it atomically.
+func (l *Log) compact() error {
+	tmp := l.path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	for _, rec := range l.records {
+		if err := enc.Encode(rec); err != nil {
+			f.Close()
+
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err := os.Rename(tmp, l.path); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if l.file != nil {
+		l.file.Close()
+	}
+
+	l.file = f
+	l.written = len(l.records)
+
+	return nil
+}
+
+// Handle appends ev to the log. It implements events.Handler. Store errors are logged, and the
+// record is kept in memory.
+func (l *Log) Handle(ev events.Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		l.logger.Warnw("failed to encode audit event", "error", err, "kind", ev.Kind())
+
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec := Record{
+		Cursor: l.next,
+		Kind:   ev.Kind(),
+		Time:   time.Now().UTC(),
+		Event:  data,
+	}
+
+	l.add(rec)
+
+	if l.file != nil {
+		if err := l.persist(rec); err != nil {
+			l.logger.Errorw("failed to store audit record", "error", err, "path", l.path, "cursor", rec.Cursor)
+		}
+	}
+
+	close(l.appended)
+	l.appended = make(chan struct{})
+}
+
+// persist appends a record to the store, compacting it once it holds twice the retained records.
+func (l *Log) persist(rec Record) error {
+	buf := linebuf.Get()
+	defer linebuf.Put(buf)
+
+	line, err := buf.Encode(rec)
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.file.Write(line); err != nil {
+		return err
+	}
+
+	l.written++
+
+	if l.written > 2*l.retain {
+		return l.compact()
+	}
+
+	return nil
+}
+
+// Read returns up to max records after the given cursor, oldest first, and a channel closed when
+// another record is appended. A zero cursor reads from the oldest retained record. It returns
+// ErrCursorExpired if records after the cursor were dropped.
+func (l *Log) Read(after uint64, max int) ([]Record, <-chan struct{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if after > 0 && len(l.records) > 0 && after+1 < l.records[0].Cursor {
+		return nil, nil, fmt.Errorf("cursor %d: oldest retained record is %d: %w", after, l.records[0].Cursor, ErrCursorExpired)
+	}
+
+	var out []Record
+
+	if len(l.records) > 0 && after < l.next-1 {
+		start := 0
+		if after >= l.records[0].Cursor {
+			start = int(after + 1 - l.records[0].Cursor)
+		}
+
+		end := len(l.records)
+		if max > 0 && end-start > max {
+			end = start + max
+		}
+
+		out = append(out, l.records[start:end]...)
+	}
+
+	return out, l.appended, nil
+}
+
+// Query returns up to max retained records after the given cursor for which match returns true,
+// oldest first, and reports whether more records match.
+// Unlike Read, a cursor older than the retained records is not an error: the query starts with the
+// oldest one.
+func (l *Log) Query(after uint64, max int, match func(Record) bool) ([]Record, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start := 0
+	if len(l.records) > 0 && after >= l.records[0].Cursor {
+		start = int(after + 1 - l.records[0].Cursor)
+	}
+
+	var out []Record
+
+	for i := start; i < len(l.records); i++ {
+		if !match(l.records[i]) {
+			continue
+		}
+
+		if len(out) == max {
+			return out, true
+		}
+
+		out = append(out, l.records[i])
+	}
+
+	return out, false
+}
+
+// Last returns the cursor of the most recent record, or zero if none were written.
+func (l *Log) Last() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.next - 1
+}
+
+// Acked returns the last cursor acknowledged by the consumer, or zero if it has not acknowledged
+// any.
+func (l *Log) Acked(consumer string) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.acks[consumer]
+}
+
+// Ack records that the consumer has processed the records up to and including cursor, and returns
+// its acknowledged cursor. Acknowledgments never move backwards, so redelivered records can be
+// acknowledged again safely.
+func (l *Log) Ack(consumer string, cursor uint64) (uint64, error) {
+	if consumer == "" {
+		return 0, ErrNoConsumer
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if cursor >= l.next {
+		return 0, fmt.Errorf("cursor %d: last record is %d: %w", cursor, l.next-1, ErrCursorAhead)
+	}
+
+	if cursor <= l.acks[consumer] {
+		return l.acks[consumer], nil
+	}
+
+	l.acks[consumer] = cursor
+
+	if l.path != "" {
+		if err := l.storeAcks(); err != nil {
+			return 0, err
+		}
+	}
+
+	return cursor, nil
+}
+
+// storeAcks replaces the cursors file atomically.
+func (l *Log) storeAcks() error {
+	b, err := json.Marshal(l.acks)
+	if err != nil {
+		return err
+	}
+
+	tmp := l.cursorsPath() + ".tmp"
+
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, l.cursorsPath())
+}
+
+// Close flushes and closes the store.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := errors.Join(l.file.Sync(), l.file.Close())
+	l.file = nil
+
+	return err
+}
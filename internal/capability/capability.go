@@ -0,0 +1,249 @@
+// Package capability provides functions and data for issuing and verifying capability tokens:
+// credentials that carry their own signed, scoped grant, so they are accepted without being listed
+// in the policy. Like macaroons, tokens can be attenuated by their holders with caveats.
+package capability
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Prefix starts every capability token, after any credential namespace prefix.
+const Prefix = "cap."
+
+// MinKeySize is the smallest signing key accepted, in bytes.
+const MinKeySize = 32
+
+var (
+	// ErrInvalidKey represents an error where a signing key is too short.
+	ErrInvalidKey = errors.New("invalid capability signing key")
+	// ErrInvalidToken represents an error where a token is malformed or its signature does not
+	// match.
+	ErrInvalidToken = errors.New("invalid capability token")
+	// ErrExpired represents an error where a token's grant has expired.
+	ErrExpired = errors.New("capability token expired")
+)
+
+// Grant is the scoped grant a capability token carries: the subject it authenticates, and the
+// actions on resources it is limited to. Actions and resources may be patterns, as in the policy.
+type Grant struct {
+	Subject   string    `json:"sub"`
+	Actions   []string  `json:"actions"`
+	Resources []string  `json:"resources"`
+	ExpiresAt time.Time `json:"exp"`
+
+	// Caveats are the restrictions added to the token since it was issued, in order. They are set
+	// by Verify.
+	Caveats []Caveat `json:"-"`
+}
+
+// Caveat is a restriction added to a capability token by its holder, deriving a narrower token
+// without the signing key. A request must satisfy every caveat of a token, as well as its grant.
+type Caveat struct {
+	// Actions and Resources, if set, further limit the actions and resources allowed. They may be
+	// patterns.
+	Actions   []string `json:"actions,omitempty"`
+	Resources []string `json:"resources,omitempty"`
+	// ExpiresAt, if set, expires the token early.
+	ExpiresAt *time.Time `json:"exp,omitempty"`
+}
+
+func (c Caveat) validate() error {
+	if len(c.Actions) == 0 && len(c.Resources) == 0 && c.ExpiresAt == nil {
+		return errors.New("caveat restricts nothing")
+	}
+
+	return nil
+}
+
+// Expiry returns when the token expires: the earliest of its grant's expiry and those of its
+// caveats.
+func (g Grant) Expiry() time.Time {
+	out := g.ExpiresAt
+
+	for _, c := range g.Caveats {
+		if c.ExpiresAt != nil && c.ExpiresAt.Before(out) {
+			out = *c.ExpiresAt
+		}
+	}
+
+	return out
+}
+
+func (g Grant) validate() error {
+	switch {
+	case g.Subject == "":
+		return errors.New("subject is empty")
+	case len(g.Actions) == 0:
+		return errors.New("actions are empty")
+	case len(g.Resources) == 0:
+		return errors.New("resources are empty")
+	case g.ExpiresAt.IsZero():
+		return errors.New("expiry is not set")
+	}
+
+	return nil
+}
+
+// Signer issues and verifies capability tokens signed with HMAC-SHA256.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner returns a signer using key, which must be at least MinKeySize bytes.
+func NewSigner(key []byte) (*Signer, error) {
+	if len(key) < MinKeySize {
+		return nil, fmt.Errorf("%w: key must be at least %d bytes, got %d", ErrInvalidKey, MinKeySize, len(key))
+	}
+
+	return &Signer{key: key}, nil
+}
+
+// chain returns the signature of a token's payload and caveats, each given in their encoded form.
+// The payload is signed with the key, and each caveat with the signature before it, so a holder
+// can add a caveat knowing only the token's signature, but cannot remove one.
+func chain(key []byte, payload string, caveats []string) []byte {
+	sig := mac(key, payload)
+
+	for _, c := range caveats {
+		sig = mac(sig, c)
+	}
+
+	return sig
+}
+
+func mac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+func encode(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decode(part string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// Issue returns a token carrying g. Caveats in g are ignored.
+func (s *Signer) Issue(g Grant) (string, error) {
+	if err := g.validate(); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	g.ExpiresAt = g.ExpiresAt.UTC().Truncate(time.Second)
+
+	payload, err := encode(g)
+	if err != nil {
+		return "", err
+	}
+
+	return Prefix + payload + "." + base64.RawURLEncoding.EncodeToString(mac(s.key, payload)), nil
+}
+
+// IsToken reports whether credential has the form of a capability token.
+func IsToken(credential string) bool {
+	return strings.HasPrefix(credential, Prefix)
+}
+
+// split returns the encoded payload, caveats, and signature of a token. A token is the prefix and
+// its base64url-encoded parts separated by dots: the grant, each caveat, and the signature.
+func split(token string) (payload string, caveats []string, sig []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(token, Prefix), ".")
+	if !IsToken(token) || len(parts) < 2 {
+		return "", nil, nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	sig, err = base64.RawURLEncoding.DecodeString(parts[len(parts)-1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	return parts[0], parts[1 : len(parts)-1], sig, nil
+}
+
+// Attenuate returns a token that is token restricted by caveat. It does not need the signing key,
+// and does not check token's signature.
+func Attenuate(token string, caveat Caveat) (string, error) {
+	if err := caveat.validate(); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	payload, caveats, sig, err := split(token)
+	if err != nil {
+		return "", err
+	}
+
+	if caveat.ExpiresAt != nil {
+		exp := caveat.ExpiresAt.UTC().Truncate(time.Second)
+		caveat.ExpiresAt = &exp
+	}
+
+	encoded, err := encode(caveat)
+	if err != nil {
+		return "", err
+	}
+
+	parts := append(append([]string{payload}, caveats...), encoded, base64.RawURLEncoding.EncodeToString(mac(sig, encoded)))
+
+	return Prefix + strings.Join(parts, "."), nil
+}
+
+// Verify checks the signature of token and returns its grant and caveats if it has not expired at
+// now.
+func (s *Signer) Verify(token string, now time.Time) (Grant, error) {
+	payload, caveats, sig, err := split(token)
+	if err != nil {
+		return Grant{}, err
+	}
+
+	if !hmac.Equal(sig, chain(s.key, payload, caveats)) {
+		return Grant{}, fmt.Errorf("%w: signature does not match", ErrInvalidToken)
+	}
+
+	var g Grant
+	if err := decode(payload, &g); err != nil {
+		return Grant{}, fmt.Errorf("%w: malformed payload", ErrInvalidToken)
+	}
+
+	if err := g.validate(); err != nil {
+		return Grant{}, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	for i, part := range caveats {
+		var c Caveat
+		if err := decode(part, &c); err != nil {
+			return Grant{}, fmt.Errorf("%w: caveat %d: malformed caveat", ErrInvalidToken, i+1)
+		}
+
+		if err := c.validate(); err != nil {
+			return Grant{}, fmt.Errorf("%w: caveat %d: %s", ErrInvalidToken, i+1, err)
+		}
+
+		g.Caveats = append(g.Caveats, c)
+	}
+
+	if exp := g.Expiry(); !now.Before(exp) {
+		return Grant{}, fmt.Errorf("%w at %s", ErrExpired, exp.Format(time.RFC3339))
+	}
+
+	return g, nil
+}
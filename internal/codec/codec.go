@@ -0,0 +1,49 @@
+// Package codec implements and registers a deterministic protobuf codec for gRPC.
+//
+// The default gRPC codec serializes map fields (such as subject claims and structured
+// configuration) in random order. Importing this package replaces it with a codec that always
+// serializes maps sorted by key, so identical responses are byte-for-byte identical and can be
+// compared in golden files and diffs.
+package codec
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/encoding"
+	// Ensure the default codec is registered before it is replaced.
+	_ "google.golang.org/grpc/encoding/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Name is the name registered for the codec. It replaces the default protobuf codec.
+const Name = "proto"
+
+var marshalOptions = proto.MarshalOptions{Deterministic: true}
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+type codec struct{}
+
+func (codec) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal, message is %T, want proto.Message", v)
+	}
+
+	return marshalOptions.Marshal(msg)
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal, message is %T, want proto.Message", v)
+	}
+
+	return proto.Unmarshal(data, msg)
+}
+
+func (codec) Name() string {
+	return Name
+}
@@ -0,0 +1,75 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+)
+
+// orderingKeys are unsorted, mixed-case, and non-ASCII, so any ordering other than by bytes puts
+// them in a different order.
+var orderingKeys = []string{"zoë", "Zed", "émile", "alice", "Ärger", "Bob", "日本", "bob"}
+
+func TestRegistered(t *testing.T) {
+	if _, ok := encoding.GetCodec(Name).(codec); !ok {
+		t.Fatalf("codec %q is %T, want codec", Name, encoding.GetCodec(Name))
+	}
+}
+
+func TestMarshalDeterministic(t *testing.T) {
+	// Messages with the same map entries, inserted in opposite orders.
+	forward := &admin.GetStatsResponse{DeniedBySubject: make(map[string]uint64)}
+	reverse := &admin.GetStatsResponse{DeniedBySubject: make(map[string]uint64)}
+
+	for i, key := range orderingKeys {
+		forward.DeniedBySubject[key] = uint64(i)
+	}
+
+	for i := len(orderingKeys) - 1; i >= 0; i-- {
+		reverse.DeniedBySubject[orderingKeys[i]] = uint64(i)
+	}
+
+	want, err := codec{}.Marshal(forward)
+	if err != nil {
+		t.Fatalf("marshaling: %s", err)
+	}
+
+	// Map iteration order is randomized on every range, so repeated marshals would differ if
+	// entries were not sorted.
+	for i := 0; i < 100; i++ {
+		for _, msg := range []*admin.GetStatsResponse{forward, reverse} {
+			got, err := codec{}.Marshal(msg)
+			if err != nil {
+				t.Fatalf("marshaling: %s", err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Fatalf("marshal %d differs:\ngot  %x\nwant %x", i, got, want)
+			}
+		}
+	}
+
+	var decoded admin.GetStatsResponse
+	if err := (codec{}).Unmarshal(want, &decoded); err != nil {
+		t.Fatalf("unmarshaling: %s", err)
+	}
+
+	if !proto.Equal(&decoded, forward) {
+		t.Errorf("round trip got %v, want %v", &decoded, forward)
+	}
+}
+
+func TestMarshalNotProto(t *testing.T) {
+	if _, err := (codec{}).Marshal("not a message"); err == nil {
+		t.Error("marshaling a string succeeded, want an error")
+	}
+
+	var s string
+	if err := (codec{}).Unmarshal(nil, &s); err == nil {
+		t.Error("unmarshaling into a string succeeded, want an error")
+	}
+}
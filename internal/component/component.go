@@ -0,0 +1,197 @@
+// Package component is the registry of the runtime's optional components. Each component is
+// enabled when its configuration sets it up, unless it is disabled explicitly, and is only
+// initialized if enabled, so minimal deployments pay nothing for components they do not use.
+package component
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Component names.
+const (
+	Metrics       = "metrics"
+	Gateway       = "gateway"
+	Tracing       = "tracing"
+	Profiling     = "profiling"
+	Events        = "events"
+	Audit         = "audit"
+	DecisionLog   = "decision-log"
+	Admin         = "admin"
+	Relationships = "relationships"
+	Coverage      = "coverage"
+	Usage         = "usage"
+	Emulation     = "emulation"
+)
+
+// Info describes a component.
+type Info struct {
+	Name        string
+	Description string
+	// Requires names the configuration a component needs before it can be enabled explicitly. It
+	// is empty if the component is configured by default.
+	Requires string
+}
+
+// Catalog lists every component, in the order they are started.
+var Catalog = []Info{
+	{Name: Tracing, Description: "OTLP trace export", Requires: "tracing.enabled"},
+	{Name: Profiling, Description: "continuous profiles pushed to a profiling server", Requires: "profiling.server-url"},
+	{Name: Emulation, Description: "latency and faults injected by action and RPC profiles", Requires: "emulation.action-profiles or emulation.rpc-profiles"},
+	{Name: Events, Description: "decision and policy events published to brokers", Requires: "events.nats.url or events.kafka.brokers"},
+	{Name: Admin, Description: "the admin API and the audit log it streams", Requires: "admin.enabled"},
+	{Name: Audit, Description: "the persistent audit store", Requires: "audit.store"},
+	{Name: DecisionLog, Description: "JSON records of each request", Requires: "decision-log.stdout or decision-log.file"},
+	{Name: Relationships, Description: "the relationship RPCs and the relationships they write"},
+	{Name: Coverage, Description: "counts of the requests each grant allowed, read from the admin API", Requires: "admin.enabled"},
+	{Name: Usage, Description: "counts of the requests of each subject, read from the admin API", Requires: "admin.enabled"},
+	{Name: Metrics, Description: "the metrics, health, and refresh endpoints", Requires: "metrics.listen"},
+	{Name: Gateway, Description: "the HTTP gateway", Requires: "gateway.listen"},
+}
+
+// ErrUnknownComponent represents an error where a component name is not in the catalog.
+var ErrUnknownComponent = errors.New("unknown component")
+
+// ErrConflict represents an error where a component is both enabled and disabled.
+var ErrConflict = errors.New("component both enabled and disabled")
+
+// Lookup returns the catalog entry of the named component.
+func Lookup(name string) (Info, bool) {
+	for _, info := range Catalog {
+		if info.Name == name {
+			return info, true
+		}
+	}
+
+	return Info{}, false
+}
+
+// Names returns the names of every component, in catalog order.
+func Names() []string {
+	out := make([]string, len(Catalog))
+	for i, info := range Catalog {
+		out[i] = info.Name
+	}
+
+	return out
+}
+
+// Set records the components enabled or disabled explicitly.
+type Set struct {
+	explicit map[string]bool
+}
+
+// NewSet returns the set enabling and disabling the given components.
+func NewSet(enabled, disabled []string) (*Set, error) {
+	out := &Set{explicit: make(map[string]bool, len(enabled)+len(disabled))}
+
+	for _, name := range enabled {
+		if _, ok := Lookup(name); !ok {
+			return nil, fmt.Errorf("%w '%s': must be one of %s", ErrUnknownComponent, name, strings.Join(Names(), ", "))
+		}
+
+		out.explicit[name] = true
+	}
+
+	for _, name := range disabled {
+		if _, ok := Lookup(name); !ok {
+			return nil, fmt.Errorf("%w '%s': must be one of %s", ErrUnknownComponent, name, strings.Join(Names(), ", "))
+		}
+
+		if out.explicit[name] {
+			return nil, fmt.Errorf("%w: %s", ErrConflict, name)
+		}
+
+		out.explicit[name] = false
+	}
+
+	return out, nil
+}
+
+// Enabled reports whether the named component is enabled: as set explicitly, or otherwise if
+// configured reports that its configuration sets it up.
+func (s *Set) Enabled(name string, configured bool) bool {
+	if enabled, ok := s.explicit[name]; ok {
+		return enabled
+	}
+
+	return configured
+}
+
+// Forced reports whether the named component is enabled explicitly.
+func (s *Set) Forced(name string) bool {
+	return s.explicit[name]
+}
+
+// StartFunc initializes a component. The returned function, if not nil, stops it. A nil StartFunc
+// is given for components with nothing to initialize.
+type StartFunc func(ctx context.Context) (stop func(), err error)
+
+// Registry starts enabled components and stops them in reverse order.
+type Registry struct {
+	set    *Set
+	logger *zap.SugaredLogger
+
+	enabled []string
+	stops   []func()
+}
+
+// NewRegistry returns a registry starting the components enabled by set.
+func NewRegistry(set *Set, logger *zap.SugaredLogger) *Registry {
+	return &Registry{
+		set:    set,
+		logger: logger,
+	}
+}
+
+// Enabled reports whether the named component is enabled, as for Set.Enabled.
+func (r *Registry) Enabled(name string, configured bool) bool {
+	return r.set.Enabled(name, configured)
+}
+
+// Start calls start if the named component is enabled, and reports whether it was. The component
+// is only initialized, and only stopped by Stop, if it is enabled and start succeeds.
+func (r *Registry) Start(ctx context.Context, name string, configured bool, start StartFunc) (bool, error) {
+	if !r.set.Enabled(name, configured) {
+		r.logger.Debugw("component disabled", "component", name)
+
+		return false, nil
+	}
+
+	var stop func()
+
+	if start != nil {
+		var err error
+
+		stop, err = start(ctx)
+		if err != nil {
+			return true, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	r.enabled = append(r.enabled, name)
+
+	if stop != nil {
+		r.stops = append(r.stops, stop)
+	}
+
+	return true, nil
+}
+
+// Started returns the names of the components started, in the order they were started.
+func (r *Registry) Started() []string {
+	return append([]string(nil), r.enabled...)
+}
+
+// Stop stops every started component, in reverse order.
+func (r *Registry) Stop() {
+	for i := len(r.stops) - 1; i >= 0; i-- {
+		r.stops[i]()
+	}
+
+	r.stops = nil
+}
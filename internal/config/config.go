@@ -0,0 +1,1621 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/apitier"
+	"github.com/metal-toolbox/iam-runtime-static/internal/component"
+	"github.com/metal-toolbox/iam-runtime-static/internal/emulation"
+	"github.com/metal-toolbox/iam-runtime-static/internal/enrich"
+	"github.com/metal-toolbox/iam-runtime-static/internal/features"
+	"github.com/metal-toolbox/iam-runtime-static/internal/listener"
+	"github.com/metal-toolbox/iam-runtime-static/internal/metrics"
+	"github.com/metal-toolbox/iam-runtime-static/internal/profiling"
+	"github.com/metal-toolbox/iam-runtime-static/internal/resourceid"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+)
+
+// StdinPolicy is the policy path that reads the policy from stdin.
+const StdinPolicy = "-"
+
+// minPseudonymizeKeyLength is the minimum length of the event pseudonymization key.
+const minPseudonymizeKeyLength = 32
+
+// Config represents the effective runtime configuration, merged from flags, the config file, and
+// the environment.
+type Config struct {
+	Listen string `mapstructure:"listen" yaml:"listen"`
+	// Socket sets the mode and ownership of the listen address if it is a Unix socket.
+	Socket Socket `mapstructure:"socket" yaml:"socket"`
+	// TLS terminates TLS on the listen address if it is a TCP address.
+	TLS TLS `mapstructure:"tls" yaml:"tls"`
+	// ListenAPIs limits the listen address to the named APIs. Every API is served if empty.
+	ListenAPIs []string `mapstructure:"listen-apis" yaml:"listen-apis"`
+	// Listeners are additional addresses the runtime serves on, each with its own settings.
+	Listeners []Listener `mapstructure:"listeners" yaml:"listeners"`
+
+	Policy string `mapstructure:"policy" yaml:"policy"`
+	// PolicyDir is a directory of policy files merged into the policy, read instead of Policy.
+	PolicyDir string `mapstructure:"policy-dir" yaml:"policy-dir"`
+	// PolicyYAML is an inline policy document in YAML or JSON, read instead of Policy. It is
+	// redacted, since it is usually too long to be useful in configuration dumps.
+	PolicyYAML string `mapstructure:"policy-yaml" yaml:"policy-yaml" secret:"true"`
+	// PolicyOverlays are merged over the policy in order.
+	PolicyOverlays []string `mapstructure:"policy-overlays" yaml:"policy-overlays"`
+	// PolicyWatch reloads the policy when it or one of its overlays changes.
+	PolicyWatch bool `mapstructure:"policy-watch" yaml:"policy-watch"`
+	// PolicyGit syncs the policy from a git repository instead of reading Policy.
+	PolicyGit PolicyGit `mapstructure:"policy-git" yaml:"policy-git"`
+	// PolicyHub mirrors the policy of another instance instead of reading Policy.
+	PolicyHub PolicyHub `mapstructure:"policy-hub" yaml:"policy-hub"`
+	// PolicyEncryption configures decryption of policies encrypted at rest.
+	PolicyEncryption PolicyEncryption `mapstructure:"policy-encryption" yaml:"policy-encryption"`
+	// PolicyGuard rejects policy reloads that drop too much of the active policy.
+	PolicyGuard PolicyGuard `mapstructure:"policy-guard" yaml:"policy-guard"`
+	// ExpectedTraffic warms decisions on known requests and reports those a policy would deny.
+	ExpectedTraffic ExpectedTraffic `mapstructure:"expected-traffic" yaml:"expected-traffic"`
+
+	// DecisionCacheTTL is how long clients may cache CheckAccess results. No hint is sent if zero.
+	DecisionCacheTTL time.Duration `mapstructure:"decision-cache-ttl" yaml:"decision-cache-ttl"`
+	// ClockSkew is how long grants and JWTs are still accepted after they expire.
+	ClockSkew time.Duration `mapstructure:"clock-skew" yaml:"clock-skew"`
+	// ShutdownTimeout is how long in-flight requests may take to finish once the runtime is asked
+	// to stop, before they are cancelled. Requests are waited for indefinitely if zero.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown-timeout" yaml:"shutdown-timeout"`
+	// JSONErrors also writes a JSON error report to stderr when the runtime fails to start.
+	JSONErrors bool `mapstructure:"json-errors" yaml:"json-errors"`
+	// Startup configures how failures of non-critical subsystems at startup are handled.
+	Startup Startup `mapstructure:"startup" yaml:"startup"`
+	// Components enables and disables optional components regardless of their configuration.
+	Components Components `mapstructure:"components" yaml:"components"`
+	// ExperimentalAPIs enables experimental APIs, which are not served otherwise.
+	ExperimentalAPIs ExperimentalAPIs `mapstructure:"experimental-apis" yaml:"experimental-apis"`
+	// SessionCache caches the subject each credential authenticates per gRPC connection.
+	SessionCache bool `mapstructure:"session-cache" yaml:"session-cache"`
+	// ConnectionSubjects stamps each gRPC connection with the first subject authenticated on it.
+	ConnectionSubjects bool `mapstructure:"connection-subjects" yaml:"connection-subjects"`
+	// SubjectLimits limits the connections and requests each subject may hold.
+	SubjectLimits SubjectLimits `mapstructure:"subject-limits" yaml:"subject-limits"`
+	// RecentDecisions keeps the most recent decisions in memory.
+	RecentDecisions RecentDecisions `mapstructure:"recent-decisions" yaml:"recent-decisions"`
+
+	Logging  Logging  `mapstructure:"logging" yaml:"logging"`
+	GRPC     GRPC     `mapstructure:"grpc" yaml:"grpc"`
+	XDS      XDS      `mapstructure:"xds" yaml:"xds"`
+	Admin    Admin    `mapstructure:"admin" yaml:"admin"`
+	Metrics  Metrics  `mapstructure:"metrics" yaml:"metrics"`
+	Gateway  Gateway  `mapstructure:"gateway" yaml:"gateway"`
+	Tracing  Tracing  `mapstructure:"tracing" yaml:"tracing"`
+	Refresh  Refresh  `mapstructure:"refresh" yaml:"refresh"`
+	Alert    Alert    `mapstructure:"alert" yaml:"alert"`
+	Events   Events   `mapstructure:"events" yaml:"events"`
+	Audit    Audit    `mapstructure:"audit" yaml:"audit"`
+	Features Features `mapstructure:"features" yaml:"features"`
+	OAuth2   OAuth2   `mapstructure:"oauth2" yaml:"oauth2"`
+	// DecisionLog records each authentication and access check request.
+	DecisionLog DecisionLog `mapstructure:"decision-log" yaml:"decision-log"`
+	// Emulation adds production-like latency and errors to access checks.
+	Emulation Emulation `mapstructure:"emulation" yaml:"emulation"`
+
+	// CredentialHeader is read for the credential when a request's Credential field is empty.
+	CredentialHeader CredentialHeader `mapstructure:"credential-header" yaml:"credential-header"`
+	// CredentialNamespace limits the runtime to credentials with a prefix.
+	CredentialNamespace CredentialNamespace `mapstructure:"credential-namespace" yaml:"credential-namespace"`
+	// Shadow mirrors a sample of requests to another runtime and logs decisions it disagrees with.
+	Shadow Shadow `mapstructure:"shadow" yaml:"shadow"`
+	// CredentialChecks explains common mistakes when a credential is rejected.
+	CredentialChecks CredentialChecks `mapstructure:"credential-checks" yaml:"credential-checks"`
+	// CredentialRotation lets subjects rotate their own credentials.
+	CredentialRotation CredentialRotation `mapstructure:"credential-rotation" yaml:"credential-rotation"`
+	// TokenCommands runs the commands of policy tokens with an exec source.
+	TokenCommands TokenCommands `mapstructure:"token-commands" yaml:"token-commands"`
+	// StaleSubjects disables subjects that have not been seen for too long.
+	StaleSubjects StaleSubjects `mapstructure:"stale-subjects" yaml:"stale-subjects"`
+	// Relationships configures the relationship RPCs.
+	Relationships Relationships `mapstructure:"relationships" yaml:"relationships"`
+	// DenialHints explains denied access checks to developers. It reveals the policy to callers.
+	DenialHints bool `mapstructure:"denial-hints" yaml:"denial-hints"`
+	// CheckAccess configures how access checks the policy cannot decide are answered.
+	CheckAccess CheckAccess `mapstructure:"check-access" yaml:"check-access"`
+	// Authorization decides access checks with several backends and combines their decisions.
+	Authorization Authorization `mapstructure:"authorization" yaml:"authorization"`
+	// ResourceIDs normalizes resource IDs in the policy and in requests.
+	ResourceIDs ResourceIDs `mapstructure:"resource-ids" yaml:"resource-ids"`
+	// DenialMessages replaces the messages of denials with the given reason codes.
+	DenialMessages map[string]string `mapstructure:"denial-messages" yaml:"denial-messages"`
+	// Identity selects the workload identity served by the Identity service.
+	Identity Identity `mapstructure:"identity" yaml:"identity"`
+	// JWT authenticates subjects with JWTs signed by an identity provider.
+	JWT JWT `mapstructure:"jwt" yaml:"jwt"`
+	// Capabilities authenticates subjects with capability tokens carrying a signed grant.
+	Capabilities Capabilities `mapstructure:"capabilities" yaml:"capabilities"`
+	// Probe checks the runtime end to end with a dedicated probe subject.
+	Probe Probe `mapstructure:"probe" yaml:"probe"`
+	// ClaimEnrichers add claims to authenticated subjects, in order.
+	ClaimEnrichers []ClaimEnricher `mapstructure:"claim-enrichers" yaml:"claim-enrichers"`
+	// Profiling pushes continuous profiles to a profiling server.
+	Profiling Profiling `mapstructure:"profiling" yaml:"profiling"`
+}
+
+// Logging represents logging configuration.
+type Logging struct {
+	Debug  bool `mapstructure:"debug" yaml:"debug"`
+	Pretty bool `mapstructure:"pretty" yaml:"pretty"`
+}
+
+// GRPC represents gRPC transport configuration.
+type GRPC struct {
+	MaxRecvMsgSize int `mapstructure:"max-recv-msg-size" yaml:"max-recv-msg-size"`
+	MaxSendMsgSize int `mapstructure:"max-send-msg-size" yaml:"max-send-msg-size"`
+}
+
+// XDS represents xDS serving configuration.
+type XDS struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+}
+
+// Listener represents an address the runtime serves on.
+type Listener struct {
+	// Address is a Unix socket path or a TCP address, as accepted by listen.
+	Address string `mapstructure:"address" yaml:"address"`
+	// Socket sets the mode and ownership of a Unix socket.
+	Socket Socket `mapstructure:"socket" yaml:"socket"`
+	// TLS terminates TLS on a TCP address.
+	TLS TLS `mapstructure:"tls" yaml:"tls"`
+	// APIs limits the listener to the named APIs, such as authentication or authorization. Every
+	// API is served if empty. Health checks are always served.
+	APIs []string `mapstructure:"apis" yaml:"apis"`
+}
+
+// Serves reports whether the listener serves the named API.
+func (l Listener) Serves(name string) bool {
+	if len(l.APIs) == 0 || name == apitier.Health {
+		return true
+	}
+
+	for _, api := range l.APIs {
+		if api == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Socket represents the file mode and ownership of a Unix socket listener.
+type Socket struct {
+	// Mode is the octal file mode of the socket, such as 0660. The umask applies if empty.
+	Mode string `mapstructure:"mode" yaml:"mode"`
+	// Owner is the user owning the socket, by name or ID.
+	Owner string `mapstructure:"owner" yaml:"owner"`
+	// Group is the group owning the socket, by name or ID.
+	Group string `mapstructure:"group" yaml:"group"`
+}
+
+// TLS represents the TLS configuration of a TCP listener.
+type TLS struct {
+	// Cert is a PEM certificate file. TLS is disabled if empty.
+	Cert string `mapstructure:"cert" yaml:"cert"`
+	// Key is the PEM private key file of the certificate.
+	Key string `mapstructure:"key" yaml:"key"`
+	// ClientCA is a PEM CA bundle. If set, clients must present a certificate it signed (mTLS).
+	ClientCA string `mapstructure:"client-ca" yaml:"client-ca"`
+}
+
+// Enabled reports whether the listener terminates TLS.
+func (t TLS) Enabled() bool {
+	return t.Cert != ""
+}
+
+// PolicyGit represents configuration for syncing the policy from a git repository.
+type PolicyGit struct {
+	// URL may embed credentials, so it is treated as a secret.
+	URL      string        `mapstructure:"url" yaml:"url" secret:"true"`
+	Branch   string        `mapstructure:"branch" yaml:"branch"`
+	Tag      string        `mapstructure:"tag" yaml:"tag"`
+	Path     string        `mapstructure:"path" yaml:"path"`
+	Interval time.Duration `mapstructure:"interval" yaml:"interval"`
+	Username string        `mapstructure:"username" yaml:"username"`
+	Password string        `mapstructure:"password" yaml:"password" secret:"true"`
+	// CacheFile keeps a copy of the last synced policy, which the runtime can start from if the
+	// repository is unreachable.
+	CacheFile string `mapstructure:"cache-file" yaml:"cache-file"`
+}
+
+// Enabled reports whether git sync is configured.
+func (g PolicyGit) Enabled() bool {
+	return g.URL != ""
+}
+
+// PolicyHub represents configuration for mirroring the policy of another instance, the hub, using
+// its admin API.
+type PolicyHub struct {
+	// Address is the address of the hub's admin API: a unix socket path, or tcp://host:port.
+	Address string `mapstructure:"address" yaml:"address"`
+	// Token is the hub's admin token.
+	Token    string        `mapstructure:"token" yaml:"token" secret:"true"`
+	Interval time.Duration `mapstructure:"interval" yaml:"interval"`
+}
+
+// Enabled reports whether mirroring a hub is configured.
+func (h PolicyHub) Enabled() bool {
+	return h.Address != ""
+}
+
+// Components represents the optional components enabled or disabled explicitly. Components not
+// listed are enabled if they are configured.
+type Components struct {
+	// Enabled lists components that must be enabled. Startup fails if one is not configured.
+	Enabled []string `mapstructure:"enabled" yaml:"enabled"`
+	// Disabled lists components that are not initialized, even if they are configured.
+	Disabled []string `mapstructure:"disabled" yaml:"disabled"`
+}
+
+// Set returns the set of components enabled and disabled explicitly.
+func (c Components) Set() (*component.Set, error) {
+	return component.NewSet(c.Enabled, c.Disabled)
+}
+
+// ExperimentalAPIs represents the experimental APIs served.
+type ExperimentalAPIs struct {
+	// All enables every experimental API.
+	All bool `mapstructure:"all" yaml:"all"`
+	// Enabled lists experimental APIs to enable.
+	Enabled []string `mapstructure:"enabled" yaml:"enabled"`
+}
+
+// Gate returns the gate registering the enabled experimental APIs.
+func (e ExperimentalAPIs) Gate() (*apitier.Gate, error) {
+	return apitier.NewGate(e.All, e.Enabled)
+}
+
+func (c Config) validateExperimentalAPIs() []error {
+	gate, err := c.ExperimentalAPIs.Gate()
+	if err != nil {
+		return []error{fmt.Errorf("experimental-apis.enabled: %w: %w", err, ErrInvalidValue)}
+	}
+
+	var errs []error
+
+	if c.CredentialRotation.Enabled && !gate.Allowed(apitier.Credentials) {
+		errs = append(errs, fmt.Errorf("credential-rotation.enabled: the Credentials service is experimental and requires experimental-apis.enabled to include %s: %w", apitier.Credentials, ErrConflictingOptions))
+	}
+
+	for i, l := range c.AllListeners() {
+		key := "listen-apis"
+		if i > 0 {
+			key = fmt.Sprintf("listeners[%d].apis", i-1)
+		}
+
+		for _, name := range l.APIs {
+			switch {
+			case !slices.Contains(apitier.Names(), name):
+				errs = append(errs, fmt.Errorf("%s: unknown API '%s': must be one of %s: %w", key, name, strings.Join(apitier.Names(), ", "), ErrInvalidValue))
+			case !gate.Allowed(name):
+				errs = append(errs, fmt.Errorf("%s: %s is experimental and requires experimental-apis.enabled to include it: %w", key, name, ErrConflictingOptions))
+			}
+		}
+	}
+
+	if c.StaleSubjects.After > 0 && !gate.Allowed(apitier.SubjectExpiry) {
+		errs = append(errs, fmt.Errorf("stale-subjects.after: enabling disabled subjects again is experimental and requires experimental-apis.enabled to include %s: %w", apitier.SubjectExpiry, ErrConflictingOptions))
+	}
+
+	return errs
+}
+
+// ComponentConfigured reports whether the configuration sets up the named component, which
+// enables it unless it is disabled explicitly.
+func (c Config) ComponentConfigured(name string) bool {
+	switch name {
+	case component.Metrics:
+		return c.Metrics.Listen != ""
+	case component.Gateway:
+		return c.Gateway.Listen != ""
+	case component.Tracing:
+		return c.Tracing.Enabled
+	case component.Profiling:
+		return c.Profiling.Enabled()
+	case component.Events:
+		return c.Events.Enabled()
+	case component.Audit:
+		return c.Audit.Store != ""
+	case component.DecisionLog:
+		return c.DecisionLog.Enabled()
+	case component.Admin:
+		return c.Admin.Enabled
+	case component.Relationships:
+		return true
+	case component.Coverage, component.Usage:
+		// Coverage and usage are only read from the admin API.
+		return c.Admin.Enabled
+	case component.Emulation:
+		return len(c.Emulation.ActionProfiles) > 0 || len(c.Emulation.RPCProfiles) > 0
+	default:
+		return false
+	}
+}
+
+func (c Config) validateComponents() []error {
+	set, err := c.Components.Set()
+	if err != nil {
+		return []error{fmt.Errorf("components: %w: %w", err, ErrInvalidValue)}
+	}
+
+	var errs []error
+
+	for _, info := range component.Catalog {
+		if set.Forced(info.Name) && !c.ComponentConfigured(info.Name) {
+			errs = append(errs, fmt.Errorf("components.enabled: %s requires %s: %w", info.Name, info.Requires, ErrConflictingOptions))
+		}
+	}
+
+	return errs
+}
+
+// Subsystems whose startup failures can be tolerated.
+const (
+	SubsystemMetrics     = "metrics"
+	SubsystemAudit       = "audit"
+	SubsystemDecisionLog = "decision-log"
+	SubsystemEvents      = "events"
+	SubsystemPolicyGit   = "policy-git"
+)
+
+// FailOpenSubsystems lists the subsystems that may fail open at startup.
+var FailOpenSubsystems = []string{SubsystemMetrics, SubsystemAudit, SubsystemDecisionLog, SubsystemEvents, SubsystemPolicyGit}
+
+// Startup represents how failures of non-critical subsystems at startup are handled. By default,
+// any failure aborts startup.
+type Startup struct {
+	// FailOpen lists the subsystems, from FailOpenSubsystems, which are degraded with a warning
+	// instead of aborting startup if they fail to start.
+	FailOpen []string `mapstructure:"fail-open" yaml:"fail-open"`
+}
+
+// FailsOpen reports whether a failure of subsystem at startup degrades it instead of aborting.
+func (s Startup) FailsOpen(subsystem string) bool {
+	return slices.Contains(s.FailOpen, subsystem)
+}
+
+func (s Startup) validate(git PolicyGit) []error {
+	var errs []error
+
+	for _, name := range s.FailOpen {
+		if !slices.Contains(FailOpenSubsystems, name) {
+			errs = append(errs, fmt.Errorf("startup.fail-open: unknown subsystem '%s': must be one of %s: %w", name, strings.Join(FailOpenSubsystems, ", "), ErrInvalidValue))
+		}
+	}
+
+	if s.FailsOpen(SubsystemPolicyGit) && git.CacheFile == "" {
+		errs = append(errs, fmt.Errorf("startup.fail-open: policy-git requires policy-git.cache-file to start from: %w", ErrConflictingOptions))
+	}
+
+	return errs
+}
+
+// PolicyEncryption represents configuration for decrypting age-encrypted policies. At most one
+// identity source may be set.
+type PolicyEncryption struct {
+	// Identity is an age identity (AGE-SECRET-KEY-1...).
+	Identity string `mapstructure:"identity" yaml:"identity" secret:"true"`
+	// IdentityFile is a file containing age identities.
+	IdentityFile string `mapstructure:"identity-file" yaml:"identity-file"`
+	// IdentityCommand is a shell command printing age identities, such as a KMS or secret manager
+	// CLI invocation.
+	IdentityCommand string `mapstructure:"identity-command" yaml:"identity-command"`
+}
+
+func (e PolicyEncryption) validate() []error {
+	var errs []error
+
+	set := 0
+
+	for _, v := range []string{e.Identity, e.IdentityFile, e.IdentityCommand} {
+		if v != "" {
+			set++
+		}
+	}
+
+	if set > 1 {
+		errs = append(errs, fmt.Errorf("policy-encryption: only one of identity, identity-file, and identity-command may be set: %w", ErrConflictingOptions))
+	}
+
+	if e.IdentityFile != "" {
+		if err := requireFile(e.IdentityFile); err != nil {
+			errs = append(errs, fmt.Errorf("policy-encryption.identity-file: %w", err))
+		}
+	}
+
+	return errs
+}
+
+// Metrics represents metrics and health endpoint configuration.
+type Metrics struct {
+	// Listen is the HTTP address serving /metrics and /healthz. Metrics are disabled if empty,
+	// unless they are exported over OTLP.
+	Listen string `mapstructure:"listen" yaml:"listen"`
+	// Exporter selects how metrics are published: prometheus (scraped from /metrics) or otlp.
+	Exporter string `mapstructure:"exporter" yaml:"exporter"`
+	OTLP     OTLP   `mapstructure:"otlp" yaml:"otlp"`
+}
+
+// Gateway represents configuration for the HTTP gateway, which serves AuthenticateSubject and
+// CheckAccess as JSON endpoints.
+type Gateway struct {
+	// Listen is the HTTP address of the gateway. The gateway is disabled if empty.
+	Listen string `mapstructure:"listen" yaml:"listen"`
+}
+
+// RecentDecisions represents configuration for the recent decisions kept in memory.
+type RecentDecisions struct {
+	// Size is the number of decisions kept. The default is 100.
+	Size int `mapstructure:"size" yaml:"size"`
+	// HTTP serves the decisions from /debug/decisions on the metrics listener.
+	HTTP bool `mapstructure:"http" yaml:"http"`
+}
+
+// OTLP represents configuration for exporting metrics to an OpenTelemetry collector.
+type OTLP struct {
+	// Endpoint is the collector's host:port. If empty, the OTEL_EXPORTER_OTLP_* environment
+	// variables are used.
+	Endpoint string        `mapstructure:"endpoint" yaml:"endpoint"`
+	Insecure bool          `mapstructure:"insecure" yaml:"insecure"`
+	Interval time.Duration `mapstructure:"interval" yaml:"interval"`
+}
+
+// Tracing represents configuration for exporting traces to an OpenTelemetry collector.
+type Tracing struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Endpoint is the collector's host:port. If empty, the OTEL_EXPORTER_OTLP_* environment
+	// variables are used.
+	Endpoint string `mapstructure:"endpoint" yaml:"endpoint"`
+	Insecure bool   `mapstructure:"insecure" yaml:"insecure"`
+	// SampleRatio is the fraction of traces started by the runtime that are sampled, from 0 to 1.
+	// Traces propagated by callers follow the caller's sampling decision.
+	SampleRatio float64 `mapstructure:"sample-ratio" yaml:"sample-ratio"`
+}
+
+// Refresh represents configuration for the policy refresh webhook.
+type Refresh struct {
+	// Token is the bearer token callers must present. The webhook is disabled if empty.
+	Token string `mapstructure:"token" yaml:"token" secret:"true"`
+}
+
+// CredentialHeader represents configuration for taking credentials from gRPC metadata.
+type CredentialHeader struct {
+	// Name is the metadata header, such as authorization. Credentials are only read from
+	// requests if empty.
+	Name string `mapstructure:"name" yaml:"name"`
+	// Prefix, such as "Bearer ", is removed from the header value.
+	Prefix string `mapstructure:"prefix" yaml:"prefix"`
+}
+
+// CredentialNamespace represents configuration for sharing a host with other runtimes by claiming
+// only credentials with a prefix.
+type CredentialNamespace struct {
+	// Prefix, such as static_, starts every credential the runtime accepts. Every credential is
+	// accepted if empty.
+	Prefix string `mapstructure:"prefix" yaml:"prefix"`
+	// RejectCode is the gRPC status code, such as failed_precondition, returned for credentials
+	// without the prefix when there is no upstream. The default is failed_precondition.
+	RejectCode string `mapstructure:"reject-code" yaml:"reject-code"`
+	// Upstream is the address of the runtime that credentials without the prefix are forwarded
+	// to: a unix socket path, or tcp://host:port.
+	Upstream string `mapstructure:"upstream" yaml:"upstream"`
+}
+
+// Code returns the status code for rejected credentials.
+func (n CredentialNamespace) Code() (codes.Code, error) {
+	if n.RejectCode == "" {
+		return codes.FailedPrecondition, nil
+	}
+
+	var code codes.Code
+	if err := code.UnmarshalJSON([]byte(`"` + strings.ToUpper(n.RejectCode) + `"`)); err != nil || code == codes.OK {
+		return 0, fmt.Errorf("%s: must be a gRPC status code other than ok: %w", n.RejectCode, ErrInvalidValue)
+	}
+
+	return code, nil
+}
+
+// Shadow represents configuration for mirroring requests to another runtime, such as one about
+// to replace this one, and comparing its decisions.
+type Shadow struct {
+	// Address is the address of the shadow runtime: a unix socket path, or tcp://host:port.
+	// Requests are not mirrored if empty.
+	Address string `mapstructure:"address" yaml:"address"`
+	// SampleRatio is the fraction of AuthenticateSubject and CheckAccess requests mirrored, from
+	// 0 to 1. The serve command defaults it to 1.
+	SampleRatio float64 `mapstructure:"sample-ratio" yaml:"sample-ratio"`
+	// Timeout bounds each mirrored request. The default is 5s.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
+}
+
+// Enabled reports whether requests are mirrored.
+func (s Shadow) Enabled() bool {
+	return s.Address != ""
+}
+
+// CredentialChecks represents configuration for checking rejected credentials.
+type CredentialChecks struct {
+	// Enabled explains why a credential looking like a JWT, a private key, or a token with an
+	// authorization scheme or whitespace left on it was rejected.
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// MaxLength rejects longer credentials before they are looked up. There is no limit if zero.
+	MaxLength int `mapstructure:"max-length" yaml:"max-length"`
+}
+
+// CredentialRotation represents configuration for the Credentials service.
+type CredentialRotation struct {
+	// Enabled serves RotateCredential.
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Store is the file rotated credentials are kept in, so they survive restarts. They are kept in
+	// memory only if empty.
+	Store string `mapstructure:"store" yaml:"store"`
+	// Grace is how long a replaced credential is still accepted.
+	Grace time.Duration `mapstructure:"grace" yaml:"grace"`
+}
+
+// TokenCommands represents configuration for policy tokens printed by a command when the policy
+// is loaded.
+type TokenCommands struct {
+	// Enabled runs token commands. Policies with command tokens fail to load otherwise, since
+	// anyone who can change the policy, such as through git or the admin API, could run commands.
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Timeout is how long a command may run before it is killed. The default is 10s.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
+	// Env names the environment variables passed to commands; no others are. The default is PATH
+	// and HOME.
+	Env []string `mapstructure:"env" yaml:"env"`
+	// Dir is the working directory of commands. The default is the runtime's.
+	Dir string `mapstructure:"dir" yaml:"dir"`
+}
+
+// StaleSubjects represents configuration for disabling subjects that have not been seen for too
+// long.
+type StaleSubjects struct {
+	// After disables subjects not authenticated for this long. Subjects are never disabled if zero.
+	After time.Duration `mapstructure:"after" yaml:"after"`
+	// Store is the file when subjects were last seen, and which were disabled, is kept in, so they
+	// survive restarts. They are kept in memory only if empty.
+	Store string `mapstructure:"store" yaml:"store"`
+	// Exempt lists the subjects that are never disabled.
+	Exempt []string `mapstructure:"exempt" yaml:"exempt"`
+}
+
+// Relationships represents configuration for the relationship RPCs.
+type Relationships struct {
+	// PropagationDelay is how long relationship writes take to become visible to access checks.
+	PropagationDelay time.Duration `mapstructure:"propagation-delay" yaml:"propagation-delay"`
+	// Ownership maps relations, such as owner, to the actions a relationship of the relation
+	// from a resource to a policy subject grants the subject on the resource.
+	Ownership map[string][]string `mapstructure:"ownership" yaml:"ownership"`
+}
+
+// How access checks naming no actions are answered.
+const (
+	EmptyActionsAllow   = "allow"
+	EmptyActionsDeny    = "deny"
+	EmptyActionsInvalid = "invalid"
+)
+
+// How access checks naming an action on a resource more than once are answered.
+const (
+	DuplicateActionsEvaluate = "evaluate"
+	DuplicateActionsReject   = "reject"
+)
+
+// CheckAccess represents configuration for access checks whose answer does not follow from the
+// policy.
+type CheckAccess struct {
+	// EmptyActions is how checks naming no actions are answered: allow, deny with
+	// PermissionDenied, or invalid, which rejects them with InvalidArgument. The default is allow.
+	EmptyActions string `mapstructure:"empty-actions" yaml:"empty-actions"`
+	// DuplicateActions is how checks naming an action on a resource more than once are answered:
+	// evaluate, which checks and reports each, or reject, which rejects them with InvalidArgument.
+	// The default is evaluate.
+	DuplicateActions string `mapstructure:"duplicate-actions" yaml:"duplicate-actions"`
+	// MaxRules fails checks with ResourceExhausted once evaluating their actions examines more
+	// grant entries, counting conditional grants. There is no limit if zero.
+	MaxRules int `mapstructure:"max-rules" yaml:"max-rules"`
+	// MaxDepth fails checks with ResourceExhausted when relationships lead farther from a checked
+	// resource than this many hops without allowing the action. There is no limit if zero.
+	MaxDepth int `mapstructure:"max-depth" yaml:"max-depth"`
+}
+
+// EmptyActionsCode returns the status code for checks naming no actions, or OK if they are
+// allowed.
+func (c CheckAccess) EmptyActionsCode() (codes.Code, error) {
+	switch c.EmptyActions {
+	case "", EmptyActionsAllow:
+		return codes.OK, nil
+	case EmptyActionsDeny:
+		return codes.PermissionDenied, nil
+	case EmptyActionsInvalid:
+		return codes.InvalidArgument, nil
+	default:
+		return 0, fmt.Errorf("%s: must be one of %s, %s, %s: %w", c.EmptyActions, EmptyActionsAllow, EmptyActionsDeny, EmptyActionsInvalid, ErrInvalidValue)
+	}
+}
+
+// RejectsDuplicates reports whether checks naming an action on a resource more than once are
+// rejected.
+func (c CheckAccess) RejectsDuplicates() bool {
+	return c.DuplicateActions == DuplicateActionsReject
+}
+
+func (c CheckAccess) validate() []error {
+	var errs []error
+
+	if _, err := c.EmptyActionsCode(); err != nil {
+		errs = append(errs, fmt.Errorf("check-access.empty-actions: %w", err))
+	}
+
+	switch c.DuplicateActions {
+	case "", DuplicateActionsEvaluate, DuplicateActionsReject:
+	default:
+		errs = append(errs, fmt.Errorf("check-access.duplicate-actions: %s: must be one of %s, %s: %w", c.DuplicateActions, DuplicateActionsEvaluate, DuplicateActionsReject, ErrInvalidValue))
+	}
+
+	if c.MaxRules < 0 {
+		errs = append(errs, fmt.Errorf("check-access.max-rules: %d: %w", c.MaxRules, ErrInvalidValue))
+	}
+
+	if c.MaxDepth < 0 {
+		errs = append(errs, fmt.Errorf("check-access.max-depth: %d: %w", c.MaxDepth, ErrInvalidValue))
+	}
+
+	return errs
+}
+
+// Authorization backends.
+const (
+	BackendPolicy        = "policy"
+	BackendRelationships = "relationships"
+	BackendUpstream      = "upstream"
+)
+
+// How the decisions of authorization backends are combined.
+const (
+	CombinePriority     = "priority"
+	CombineFirstAllow   = "first-allow"
+	CombineAllMustAllow = "all-must-allow"
+)
+
+// Authorization represents configuration for deciding access checks with several backends.
+type Authorization struct {
+	// Backends lists the backends deciding access checks, in the order they are consulted:
+	// policy, relationships, and upstream. If empty, checks are decided by the policy and then by
+	// relationships.
+	Backends []string `mapstructure:"backends" yaml:"backends"`
+	// Combine is how the decisions of the backends are combined: priority, first-allow, or
+	// all-must-allow. The default is priority.
+	Combine string `mapstructure:"combine" yaml:"combine"`
+	// Upstream is the runtime the upstream backend forwards checks to: a unix socket path, or
+	// tcp://host:port.
+	Upstream string `mapstructure:"upstream" yaml:"upstream"`
+	// Timeout bounds each check forwarded by the upstream backend. The default is 5s.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
+}
+
+// Enabled reports whether backends are configured.
+func (a Authorization) Enabled() bool {
+	return len(a.Backends) > 0
+}
+
+func (a Authorization) validate() []error {
+	var errs []error
+
+	seen := make(map[string]bool)
+
+	for _, name := range a.Backends {
+		switch {
+		case name != BackendPolicy && name != BackendRelationships && name != BackendUpstream:
+			errs = append(errs, fmt.Errorf("authorization.backends: %s: must be one of %s, %s, %s: %w", name, BackendPolicy, BackendRelationships, BackendUpstream, ErrInvalidValue))
+		case seen[name]:
+			errs = append(errs, fmt.Errorf("authorization.backends: %s is listed more than once: %w", name, ErrInvalidValue))
+		}
+
+		seen[name] = true
+	}
+
+	switch a.Combine {
+	case "", CombinePriority, CombineFirstAllow, CombineAllMustAllow:
+	default:
+		errs = append(errs, fmt.Errorf("authorization.combine: %s: must be one of %s, %s, %s: %w", a.Combine, CombinePriority, CombineFirstAllow, CombineAllMustAllow, ErrInvalidValue))
+	}
+
+	if a.Combine != "" && !a.Enabled() {
+		errs = append(errs, fmt.Errorf("authorization.combine: combining decisions requires authorization.backends: %w", ErrConflictingOptions))
+	}
+
+	if seen[BackendUpstream] && a.Upstream == "" {
+		errs = append(errs, fmt.Errorf("authorization.backends: the upstream backend requires authorization.upstream: %w", ErrConflictingOptions))
+	}
+
+	if a.Upstream != "" {
+		if !seen[BackendUpstream] {
+			errs = append(errs, fmt.Errorf("authorization.upstream: an upstream runtime requires the upstream backend in authorization.backends: %w", ErrConflictingOptions))
+		}
+
+		if _, err := listener.Parse(a.Upstream); err != nil {
+			errs = append(errs, fmt.Errorf("authorization.upstream: %w", err))
+		}
+	}
+
+	if a.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("authorization.timeout: %s: %w", a.Timeout, ErrInvalidValue))
+	}
+
+	return errs
+}
+
+// ResourceIDs represents configuration for normalizing resource IDs.
+type ResourceIDs struct {
+	// Normalize lists the normalizers applied to resource IDs, in order, from
+	// resourceid.Normalizers. IDs are used as written if it is empty.
+	Normalize []string `mapstructure:"normalize" yaml:"normalize"`
+}
+
+// Pipeline returns the pipeline applying the configured normalizers.
+func (c ResourceIDs) Pipeline() (resourceid.Pipeline, error) {
+	p, err := resourceid.New(c.Normalize)
+	if err != nil {
+		return resourceid.Pipeline{}, fmt.Errorf("resource-ids.normalize: %w: %w", err, ErrInvalidValue)
+	}
+
+	return p, nil
+}
+
+// Identity represents configuration for the Identity service.
+type Identity struct {
+	// Workload is the ID of the policy identity whose access token is returned. It may be empty
+	// if the policy defines a single identity.
+	Workload string `mapstructure:"workload" yaml:"workload"`
+}
+
+// JWT represents configuration for authenticating subjects with JWTs. Exactly one of JWKSURL and
+// PublicKeyFile must be set to enable it.
+type JWT struct {
+	// JWKSURL is fetched for the JSON Web Key Set whose keys sign tokens.
+	JWKSURL string `mapstructure:"jwks-url" yaml:"jwks-url"`
+	// JWKSRefreshInterval is how long fetched keys are used. The default is five minutes.
+	JWKSRefreshInterval time.Duration `mapstructure:"jwks-refresh-interval" yaml:"jwks-refresh-interval"`
+	// PublicKeyFile is a PEM-encoded public key or certificate that signs tokens.
+	PublicKeyFile string `mapstructure:"public-key-file" yaml:"public-key-file"`
+	// Issuers, if set, are the only iss claims accepted.
+	Issuers []string `mapstructure:"issuers" yaml:"issuers"`
+	// Audience, if set, must be one of a token's aud claims.
+	Audience string `mapstructure:"audience" yaml:"audience"`
+}
+
+// Enabled reports whether JWT authentication is configured.
+func (j JWT) Enabled() bool {
+	return j.JWKSURL != "" || j.PublicKeyFile != ""
+}
+
+// Capabilities represents configuration for capability tokens, which carry a grant signed with a
+// shared key, so they are accepted without being listed in the policy.
+type Capabilities struct {
+	// SigningKeyFile holds the key capability tokens are signed with. Capability tokens are only
+	// accepted if it is set.
+	SigningKeyFile string `mapstructure:"signing-key-file" yaml:"signing-key-file"`
+}
+
+// Probe represents configuration for the self-test probe, which authenticates a probe subject and
+// checks its access to a probe resource over the runtime listener.
+type Probe struct {
+	// Credential is the probe subject's token. Probing is disabled if empty.
+	Credential string `mapstructure:"credential" yaml:"credential" secret:"true"`
+	// Action and Resource must be allowed for the probe subject.
+	Action   string `mapstructure:"action" yaml:"action"`
+	Resource string `mapstructure:"resource" yaml:"resource"`
+	// SelfTest exits at startup if the first probe fails.
+	SelfTest bool `mapstructure:"self-test" yaml:"self-test"`
+	// Interval is how often the probe runs after startup. It only runs once if zero.
+	Interval time.Duration `mapstructure:"interval" yaml:"interval"`
+	// Timeout bounds each probe. The default is five seconds.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
+}
+
+// Enabled reports whether the probe is configured.
+func (p Probe) Enabled() bool {
+	return p.Credential != ""
+}
+
+// OAuth2 represents configuration for the OAuth2 client_credentials token endpoint.
+type OAuth2 struct {
+	// Enabled serves the token endpoint at /oauth2/token on the metrics listener.
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// TokenTTL is how long issued access tokens are valid. The default is one hour.
+	TokenTTL time.Duration `mapstructure:"token-ttl" yaml:"token-ttl"`
+}
+
+// PolicyGuard represents the sanity checks made before a reloaded policy replaces the active one.
+type PolicyGuard struct {
+	// MaxSubjectDropPercent rejects reloads removing more than this percentage of subjects. The
+	// check is disabled if zero.
+	MaxSubjectDropPercent float64 `mapstructure:"max-subject-drop-percent" yaml:"max-subject-drop-percent"`
+	// MaxGrantDropPercent rejects reloads removing more than this percentage of grant actions. The
+	// check is disabled if zero.
+	MaxGrantDropPercent float64 `mapstructure:"max-grant-drop-percent" yaml:"max-grant-drop-percent"`
+	// HistorySize is the number of previous policies kept in memory.
+	HistorySize int `mapstructure:"history-size" yaml:"history-size"`
+}
+
+// ExpectedTraffic represents configuration for the requests a policy is checked against whenever
+// it is loaded.
+type ExpectedTraffic struct {
+	// File is a YAML or JSON list of subject, action, and resource tuples.
+	File string `mapstructure:"file" yaml:"file"`
+	// RequireAllowed rejects a policy that would deny any of the requests.
+	RequireAllowed bool `mapstructure:"require-allowed" yaml:"require-allowed"`
+}
+
+// Alert represents configuration for alerts on sensitive actions and rejected policy reloads.
+type Alert struct {
+	// WebhookURL receives a JSON POST for each decision on a sensitive action and each rejected
+	// policy reload. Alerts are disabled if empty.
+	WebhookURL string `mapstructure:"webhook-url" yaml:"webhook-url" secret:"true"`
+}
+
+// defaultProfilingAppName is the application name profiles are pushed under if none is configured.
+const defaultProfilingAppName = "iam-runtime-static"
+
+// Profiling represents configuration for pushing continuous profiles to a profiling server, such
+// as Pyroscope.
+type Profiling struct {
+	// ServerURL is the base URL of the profiling server. Profiling is disabled if empty.
+	ServerURL string `mapstructure:"server-url" yaml:"server-url"`
+	// AppName names the application on the server. The default is iam-runtime-static.
+	AppName string `mapstructure:"app-name" yaml:"app-name"`
+	// Tags are attached to every profile, such as the environment or instance.
+	Tags map[string]string `mapstructure:"tags" yaml:"tags"`
+	// Profiles are the profile types pushed: cpu, heap, allocs, goroutine, mutex, or block. The
+	// default is cpu and heap.
+	Profiles []string `mapstructure:"profiles" yaml:"profiles"`
+	// Interval is how often profiles are pushed. The default is 15 seconds.
+	Interval time.Duration `mapstructure:"interval" yaml:"interval"`
+	// AuthToken, if set, is sent to the server as a bearer token.
+	AuthToken string `mapstructure:"auth-token" yaml:"auth-token" secret:"true"`
+}
+
+// Enabled reports whether profiles are pushed.
+func (p Profiling) Enabled() bool {
+	return p.ServerURL != ""
+}
+
+// Config returns the profiling configuration in the form used by the profiling package.
+func (p Profiling) Config() profiling.Config {
+	appName := p.AppName
+	if appName == "" {
+		appName = defaultProfilingAppName
+	}
+
+	return profiling.Config{
+		ServerURL: p.ServerURL,
+		AppName:   appName,
+		Tags:      p.Tags,
+		Profiles:  p.Profiles,
+		Interval:  p.Interval,
+		AuthToken: p.AuthToken,
+	}
+}
+
+// Events represents configuration for publishing decision and policy events to brokers.
+type Events struct {
+	// Environment identifies this runtime in published events. If empty, the hostname is used.
+	Environment string `mapstructure:"environment" yaml:"environment"`
+	// PseudonymizeKey, if set, replaces subject and resource IDs in published events with keyed
+	// HMAC pseudonyms.
+	PseudonymizeKey string      `mapstructure:"pseudonymize-key" yaml:"pseudonymize-key" secret:"true"`
+	NATS            EventsNATS  `mapstructure:"nats" yaml:"nats"`
+	Kafka           EventsKafka `mapstructure:"kafka" yaml:"kafka"`
+}
+
+// Enabled reports whether any event broker is configured.
+func (e Events) Enabled() bool {
+	return e.NATS.URL != "" || len(e.Kafka.Brokers) > 0
+}
+
+// EventsNATS represents configuration for publishing events to NATS.
+type EventsNATS struct {
+	// URL may embed credentials, so it is treated as a secret.
+	URL           string `mapstructure:"url" yaml:"url" secret:"true"`
+	SubjectPrefix string `mapstructure:"subject-prefix" yaml:"subject-prefix"`
+}
+
+// EventsKafka represents configuration for publishing events to Kafka.
+type EventsKafka struct {
+	Brokers []string `mapstructure:"brokers" yaml:"brokers"`
+	Topic   string   `mapstructure:"topic" yaml:"topic"`
+}
+
+// Audit represents configuration for correlating decisions with application requests.
+type Audit struct {
+	// MetadataKeys are incoming gRPC metadata keys, such as traceparent, captured into decision
+	// events and audit logs.
+	MetadataKeys []string `mapstructure:"metadata-keys" yaml:"metadata-keys"`
+	// EchoClaims returns the captured metadata as claims from AuthenticateSubject.
+	EchoClaims bool `mapstructure:"echo-claims" yaml:"echo-claims"`
+	// Store is the file the audit log streamed from the admin API is kept in, so it and
+	// collectors' acknowledgments survive restarts. If empty, the log is kept in memory.
+	Store string `mapstructure:"store" yaml:"store"`
+	// Retention is the number of audit records kept. The default is 10000.
+	Retention int `mapstructure:"retention" yaml:"retention"`
+}
+
+// SubjectLimits represents configuration for per-subject connection and request limits. Zero is
+// unlimited.
+type SubjectLimits struct {
+	// MaxConnections is the most gRPC connections stamped with a subject at once.
+	MaxConnections int `mapstructure:"max-connections" yaml:"max-connections"`
+	// MaxStreams is the most requests a subject may have in progress at once.
+	MaxStreams int `mapstructure:"max-streams" yaml:"max-streams"`
+}
+
+// DecisionLog represents configuration for the decision log, which writes a JSON record of each
+// AuthenticateSubject and CheckAccess request.
+type DecisionLog struct {
+	// Stdout writes records to standard output.
+	Stdout bool `mapstructure:"stdout" yaml:"stdout"`
+	// File is a file records are appended to, rotated once it reaches MaxSize.
+	File string `mapstructure:"file" yaml:"file"`
+	// MaxSize is the size in megabytes at which the file is rotated. The default is 100.
+	MaxSize int `mapstructure:"max-size" yaml:"max-size"`
+	// MaxBackups is the number of rotated files kept. The default is 5.
+	MaxBackups int `mapstructure:"max-backups" yaml:"max-backups"`
+}
+
+// Enabled reports whether the decision log has a sink.
+func (d DecisionLog) Enabled() bool {
+	return d.Stdout || d.File != ""
+}
+
+// Features represents the experimental feature flags enabled at startup.
+type Features struct {
+	// Enabled flags apply to all subjects.
+	Enabled []string `mapstructure:"enabled" yaml:"enabled"`
+	// Subjects maps subject IDs to flags enabled for that subject only.
+	Subjects map[string][]string `mapstructure:"subjects" yaml:"subjects"`
+}
+
+// Emulation represents latency and error emulation for access checks and RPCs.
+type Emulation struct {
+	// ActionProfiles are matched against each checked action in order; the first match applies.
+	ActionProfiles []ActionProfile `mapstructure:"action-profiles" yaml:"action-profiles"`
+	// RPCProfiles are matched against the method name of each RPC call in order; the first match
+	// applies.
+	RPCProfiles []RPCProfile `mapstructure:"rpc-profiles" yaml:"rpc-profiles"`
+}
+
+// ActionProfile assigns latency and an error rate to actions matching glob patterns.
+type ActionProfile struct {
+	Actions   []string      `mapstructure:"actions" yaml:"actions"`
+	Latency   time.Duration `mapstructure:"latency" yaml:"latency"`
+	Jitter    time.Duration `mapstructure:"jitter" yaml:"jitter"`
+	ErrorRate float64       `mapstructure:"error-rate" yaml:"error-rate"`
+	ErrorCode string        `mapstructure:"error-code" yaml:"error-code"`
+}
+
+// Profiles returns the action profiles in the form used by the emulation package.
+func (e Emulation) Profiles() []emulation.Profile {
+	out := make([]emulation.Profile, 0, len(e.ActionProfiles))
+
+	for _, p := range e.ActionProfiles {
+		out = append(out, emulation.Profile(p))
+	}
+
+	return out
+}
+
+// RPCProfile assigns latency and injected faults to RPCs matching glob patterns.
+type RPCProfile struct {
+	RPCs      []string      `mapstructure:"rpcs" yaml:"rpcs"`
+	Latency   time.Duration `mapstructure:"latency" yaml:"latency"`
+	Jitter    time.Duration `mapstructure:"jitter" yaml:"jitter"`
+	ErrorRate float64       `mapstructure:"error-rate" yaml:"error-rate"`
+	ErrorCode string        `mapstructure:"error-code" yaml:"error-code"`
+}
+
+// RPCs returns the RPC profiles in the form used by the emulation package.
+func (e Emulation) RPCs() []emulation.RPCProfile {
+	out := make([]emulation.RPCProfile, 0, len(e.RPCProfiles))
+
+	for _, p := range e.RPCProfiles {
+		out = append(out, emulation.RPCProfile(p))
+	}
+
+	return out
+}
+
+// ClaimEnricher represents a claim enricher. Type selects which of the other fields are used.
+type ClaimEnricher struct {
+	// Type is static, template, or http.
+	Type string `mapstructure:"type" yaml:"type"`
+	// Subjects maps subject IDs, or * for all subjects, to the claims a static enricher adds.
+	Subjects map[string]map[string]string `mapstructure:"subjects" yaml:"subjects,omitempty"`
+	// Claims maps claim names to templates evaluated against the claims so far.
+	Claims map[string]string `mapstructure:"claims" yaml:"claims,omitempty"`
+	// URL receives the claims so far and responds with claims to add.
+	URL string `mapstructure:"url" yaml:"url,omitempty"`
+	// Timeout bounds each HTTP lookup. The default is two seconds.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout,omitempty"`
+	// Optional ignores errors from the enricher instead of failing authentication.
+	Optional bool `mapstructure:"optional" yaml:"optional,omitempty"`
+}
+
+// Enrichers returns the claim enrichers in the form used by the enrich package.
+func (c Config) Enrichers() []enrich.Config {
+	out := make([]enrich.Config, 0, len(c.ClaimEnrichers))
+
+	for _, e := range c.ClaimEnrichers {
+		out = append(out, enrich.Config(e))
+	}
+
+	return out
+}
+
+// Admin represents admin API configuration.
+type Admin struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Token is the token admin API calls must carry as a bearer Authorization header. Setting it
+	// enables the calls that mutate the active policy and mint tokens.
+	Token string `mapstructure:"token" yaml:"token" secret:"true"`
+}
+
+// Load reads the configuration from the given viper instance.
+func Load(v *viper.Viper) (Config, error) {
+	var out Config
+	if err := v.Unmarshal(&out); err != nil {
+		return Config{}, err
+	}
+
+	return out, nil
+}
+
+// LoadStrict reads the configuration from the given viper instance like Load, but returns an
+// error if any configured keys are not recognized.
+func LoadStrict(v *viper.Viper) (Config, error) {
+	var out Config
+	if err := v.UnmarshalExact(&out); err != nil {
+		return Config{}, err
+	}
+
+	return out, nil
+}
+
+// InlinePolicy reports whether the base policy is given inline or on stdin rather than read from
+// a file or directory.
+func (c Config) InlinePolicy() bool {
+	return c.PolicyYAML != "" || c.Policy == StdinPolicy
+}
+
+// PolicySource returns the path the base policy is read from: the policy directory if one is
+// configured, or the policy file.
+func (c Config) PolicySource() string {
+	if c.PolicyDir != "" {
+		return c.PolicyDir
+	}
+
+	return c.Policy
+}
+
+// AllListeners returns the addresses the runtime serves on: listen, then the additional listeners.
+func (c Config) AllListeners() []Listener {
+	return append([]Listener{{Address: c.Listen, Socket: c.Socket, TLS: c.TLS, APIs: c.ListenAPIs}}, c.Listeners...)
+}
+
+// PlaintextListen returns the first address the runtime serves the named APIs on without TLS, for
+// connecting to itself, and reports false if there is none.
+func (c Config) PlaintextListen(apis ...string) (string, bool) {
+	for _, l := range c.AllListeners() {
+		if l.TLS.Enabled() {
+			continue
+		}
+
+		served := true
+
+		for _, api := range apis {
+			served = served && l.Serves(api)
+		}
+
+		if served {
+			return l.Address, true
+		}
+	}
+
+	return "", false
+}
+
+// Validate checks the configuration for malformed or out of range values, mutually exclusive
+// options, and references to files that do not exist. All problems found are returned.
+func (c Config) Validate() error {
+	var errs []error
+
+	addr, err := listener.Parse(c.Listen)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("listen: %w", err))
+	} else {
+		errs = append(errs, c.AllListeners()[0].validate("", addr)...)
+	}
+
+	for i, l := range c.Listeners {
+		prefix := fmt.Sprintf("listeners[%d].", i)
+
+		extra, err := listener.Parse(l.Address)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%saddress: %w", prefix, err))
+
+			continue
+		}
+
+		errs = append(errs, l.validate(prefix, extra)...)
+	}
+
+	switch {
+	case c.PolicyHub.Enabled():
+		errs = append(errs, c.PolicyHub.validate()...)
+
+		if c.PolicyGit.Enabled() {
+			errs = append(errs, fmt.Errorf("policy-git: a policy synced from git cannot be combined with policy-hub: %w", ErrConflictingOptions))
+		}
+
+		if c.PolicyDir != "" {
+			errs = append(errs, fmt.Errorf("policy-dir: a policy directory cannot be combined with policy-hub: %w", ErrConflictingOptions))
+		}
+
+		if c.PolicyYAML != "" {
+			errs = append(errs, fmt.Errorf("policy-yaml: an inline policy cannot be combined with policy-hub: %w", ErrConflictingOptions))
+		}
+	case c.PolicyGit.Enabled():
+		errs = append(errs, c.PolicyGit.validate()...)
+
+		if c.PolicyDir != "" {
+			errs = append(errs, fmt.Errorf("policy-dir: a policy directory cannot be combined with policy-git: %w", ErrConflictingOptions))
+		}
+
+		if c.PolicyYAML != "" {
+			errs = append(errs, fmt.Errorf("policy-yaml: an inline policy cannot be combined with policy-git: %w", ErrConflictingOptions))
+		}
+	case c.PolicyDir != "":
+		if c.PolicyYAML != "" {
+			errs = append(errs, fmt.Errorf("policy-yaml: an inline policy cannot be combined with policy-dir: %w", ErrConflictingOptions))
+		}
+
+		if err := requireDir(c.PolicyDir); err != nil {
+			errs = append(errs, fmt.Errorf("policy-dir: %w", err))
+		}
+	case c.InlinePolicy():
+		// Inline and stdin policies are checked when they are read.
+	default:
+		if err := requireFile(c.Policy); err != nil {
+			errs = append(errs, fmt.Errorf("policy: %w", err))
+		}
+	}
+
+	for _, path := range c.PolicyOverlays {
+		if err := requireFile(path); err != nil {
+			errs = append(errs, fmt.Errorf("policy-overlays: %w", err))
+		}
+	}
+
+	errs = append(errs, c.PolicyEncryption.validate()...)
+
+	if c.ExpectedTraffic.File != "" {
+		if err := requireFile(c.ExpectedTraffic.File); err != nil {
+			errs = append(errs, fmt.Errorf("expected-traffic.file: %w", err))
+		}
+	} else if c.ExpectedTraffic.RequireAllowed {
+		errs = append(errs, fmt.Errorf("expected-traffic.require-allowed: requires expected-traffic.file: %w", ErrConflictingOptions))
+	}
+
+	if p := c.PolicyGuard.MaxSubjectDropPercent; p < 0 || p > 100 {
+		errs = append(errs, fmt.Errorf("policy-guard.max-subject-drop-percent: %g: must be between 0 and 100: %w", p, ErrInvalidValue))
+	}
+
+	if p := c.PolicyGuard.MaxGrantDropPercent; p < 0 || p > 100 {
+		errs = append(errs, fmt.Errorf("policy-guard.max-grant-drop-percent: %g: must be between 0 and 100: %w", p, ErrInvalidValue))
+	}
+
+	if c.PolicyGuard.HistorySize < 0 {
+		errs = append(errs, fmt.Errorf("policy-guard.history-size: %d: %w", c.PolicyGuard.HistorySize, ErrInvalidValue))
+	}
+
+	if c.GRPC.MaxRecvMsgSize < 0 {
+		errs = append(errs, fmt.Errorf("grpc.max-recv-msg-size: %d: %w", c.GRPC.MaxRecvMsgSize, ErrInvalidValue))
+	}
+
+	if c.GRPC.MaxSendMsgSize < 0 {
+		errs = append(errs, fmt.Errorf("grpc.max-send-msg-size: %d: %w", c.GRPC.MaxSendMsgSize, ErrInvalidValue))
+	}
+
+	if c.DecisionCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("decision-cache-ttl: %s: %w", c.DecisionCacheTTL, ErrInvalidValue))
+	}
+
+	if c.ClockSkew < 0 {
+		errs = append(errs, fmt.Errorf("clock-skew: %s: %w", c.ClockSkew, ErrInvalidValue))
+	}
+
+	if c.ShutdownTimeout < 0 {
+		errs = append(errs, fmt.Errorf("shutdown-timeout: %s: %w", c.ShutdownTimeout, ErrInvalidValue))
+	}
+
+	errs = append(errs, c.Startup.validate(c.PolicyGit)...)
+	errs = append(errs, c.validateComponents()...)
+	errs = append(errs, c.validateExperimentalAPIs()...)
+
+	if c.Refresh.Token != "" && c.Metrics.Listen == "" {
+		errs = append(errs, fmt.Errorf("refresh.token: the refresh webhook requires metrics.listen: %w", ErrConflictingOptions))
+	}
+
+	if c.CredentialHeader.Prefix != "" && c.CredentialHeader.Name == "" {
+		errs = append(errs, fmt.Errorf("credential-header.prefix: a prefix requires credential-header.name: %w", ErrConflictingOptions))
+	}
+
+	if c.PolicyWatch && c.PolicyGit.Enabled() {
+		errs = append(errs, fmt.Errorf("policy-watch: a policy synced from git cannot be watched: %w", ErrConflictingOptions))
+	}
+
+	if c.PolicyWatch && c.PolicyHub.Enabled() {
+		errs = append(errs, fmt.Errorf("policy-watch: a policy mirrored from a hub cannot be watched: %w", ErrConflictingOptions))
+	}
+
+	if c.CredentialNamespace.Prefix == "" && (c.CredentialNamespace.Upstream != "" || c.CredentialNamespace.RejectCode != "") {
+		errs = append(errs, fmt.Errorf("credential-namespace: upstream and reject-code require credential-namespace.prefix: %w", ErrConflictingOptions))
+	}
+
+	if _, err := c.CredentialNamespace.Code(); err != nil {
+		errs = append(errs, fmt.Errorf("credential-namespace.reject-code: %w", err))
+	}
+
+	if c.CredentialNamespace.Upstream != "" {
+		if _, err := listener.Parse(c.CredentialNamespace.Upstream); err != nil {
+			errs = append(errs, fmt.Errorf("credential-namespace.upstream: %w", err))
+		}
+	}
+
+	if c.Shadow.Address != "" {
+		if _, err := listener.Parse(c.Shadow.Address); err != nil {
+			errs = append(errs, fmt.Errorf("shadow.address: %w", err))
+		}
+	}
+
+	if c.Shadow.SampleRatio < 0 || c.Shadow.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("shadow.sample-ratio: %g: must be between 0 and 1: %w", c.Shadow.SampleRatio, ErrInvalidValue))
+	}
+
+	if c.Shadow.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("shadow.timeout: %s: %w", c.Shadow.Timeout, ErrInvalidValue))
+	}
+
+	if c.CredentialChecks.MaxLength < 0 {
+		errs = append(errs, fmt.Errorf("credential-checks.max-length: %d: %w", c.CredentialChecks.MaxLength, ErrInvalidValue))
+	}
+
+	if c.TokenCommands.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("token-commands.timeout: %s: %w", c.TokenCommands.Timeout, ErrInvalidValue))
+	}
+
+	if !c.TokenCommands.Enabled && (len(c.TokenCommands.Env) > 0 || c.TokenCommands.Dir != "") {
+		errs = append(errs, fmt.Errorf("token-commands: env and dir require token-commands.enabled: %w", ErrConflictingOptions))
+	}
+
+	if c.CredentialRotation.Store != "" && !c.CredentialRotation.Enabled {
+		errs = append(errs, fmt.Errorf("credential-rotation.store: a store requires credential-rotation.enabled: %w", ErrConflictingOptions))
+	}
+
+	if c.CredentialRotation.Grace < 0 {
+		errs = append(errs, fmt.Errorf("credential-rotation.grace: %s: %w", c.CredentialRotation.Grace, ErrInvalidValue))
+	}
+
+	switch {
+	case c.StaleSubjects.After < 0:
+		errs = append(errs, fmt.Errorf("stale-subjects.after: %s: %w", c.StaleSubjects.After, ErrInvalidValue))
+	case c.StaleSubjects.After == 0 && (c.StaleSubjects.Store != "" || len(c.StaleSubjects.Exempt) > 0):
+		errs = append(errs, fmt.Errorf("stale-subjects: a store or exempt subjects require stale-subjects.after: %w", ErrConflictingOptions))
+	case c.StaleSubjects.After > 0 && !c.Admin.Enabled:
+		errs = append(errs, fmt.Errorf("stale-subjects.after: disabled subjects are enabled again with the admin API, which requires admin.enabled: %w", ErrConflictingOptions))
+	}
+
+	if c.RecentDecisions.Size < 0 {
+		errs = append(errs, fmt.Errorf("recent-decisions.size: %d: %w", c.RecentDecisions.Size, ErrInvalidValue))
+	}
+
+	if c.RecentDecisions.HTTP && c.Metrics.Listen == "" {
+		errs = append(errs, fmt.Errorf("recent-decisions.http: the debug endpoint requires metrics.listen: %w", ErrConflictingOptions))
+	}
+
+	errs = append(errs, c.CheckAccess.validate()...)
+	errs = append(errs, c.Authorization.validate()...)
+
+	if _, err := c.ResourceIDs.Pipeline(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Relationships.PropagationDelay < 0 {
+		errs = append(errs, fmt.Errorf("relationships.propagation-delay: %s: %w", c.Relationships.PropagationDelay, ErrInvalidValue))
+	}
+
+	for relation, actions := range c.Relationships.Ownership {
+		if len(actions) == 0 || slices.Contains(actions, "") {
+			errs = append(errs, fmt.Errorf("relationships.ownership.%s: actions must be non-empty: %w", relation, ErrInvalidValue))
+		}
+	}
+
+	if c.Admin.Token != "" && !c.Admin.Enabled {
+		errs = append(errs, fmt.Errorf("admin.token: the admin API is not enabled: %w", ErrConflictingOptions))
+	}
+
+	if c.Audit.Store != "" && !c.Admin.Enabled {
+		errs = append(errs, fmt.Errorf("audit.store: the audit log is only streamed from the admin API: %w", ErrConflictingOptions))
+	}
+
+	if c.Audit.Retention < 0 {
+		errs = append(errs, fmt.Errorf("audit.retention: %d: %w", c.Audit.Retention, ErrInvalidValue))
+	}
+
+	if c.SubjectLimits.MaxConnections < 0 {
+		errs = append(errs, fmt.Errorf("subject-limits.max-connections: %d: %w", c.SubjectLimits.MaxConnections, ErrInvalidValue))
+	}
+
+	if c.SubjectLimits.MaxStreams < 0 {
+		errs = append(errs, fmt.Errorf("subject-limits.max-streams: %d: %w", c.SubjectLimits.MaxStreams, ErrInvalidValue))
+	}
+
+	if c.DecisionLog.MaxSize < 0 {
+		errs = append(errs, fmt.Errorf("decision-log.max-size: %d: %w", c.DecisionLog.MaxSize, ErrInvalidValue))
+	}
+
+	if c.DecisionLog.MaxBackups < 0 {
+		errs = append(errs, fmt.Errorf("decision-log.max-backups: %d: %w", c.DecisionLog.MaxBackups, ErrInvalidValue))
+	}
+
+	if c.JWT.JWKSURL != "" && c.JWT.PublicKeyFile != "" {
+		errs = append(errs, fmt.Errorf("jwt: set either jwt.jwks-url or jwt.public-key-file: %w", ErrConflictingOptions))
+	}
+
+	if c.JWT.JWKSRefreshInterval < 0 {
+		errs = append(errs, fmt.Errorf("jwt.jwks-refresh-interval: %s: %w", c.JWT.JWKSRefreshInterval, ErrInvalidValue))
+	}
+
+	if c.Capabilities.SigningKeyFile != "" {
+		if err := requireFile(c.Capabilities.SigningKeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("capabilities.signing-key-file: %w", err))
+		}
+	}
+
+	if (c.Probe.SelfTest || c.Probe.Interval > 0) && !c.Probe.Enabled() {
+		errs = append(errs, fmt.Errorf("probe: probing requires probe.credential: %w", ErrConflictingOptions))
+	}
+
+	if c.Probe.Enabled() && (c.Probe.Action == "" || c.Probe.Resource == "") {
+		errs = append(errs, fmt.Errorf("probe: probing requires probe.action and probe.resource: %w", ErrConflictingOptions))
+	}
+
+	if _, ok := c.PlaintextListen(apitier.Authentication, apitier.Authorization); c.Probe.Enabled() && !ok {
+		errs = append(errs, fmt.Errorf("probe: probing requires a listener without TLS serving the authentication and authorization APIs: %w", ErrConflictingOptions))
+	}
+
+	if c.Probe.Interval < 0 {
+		errs = append(errs, fmt.Errorf("probe.interval: %s: %w", c.Probe.Interval, ErrInvalidValue))
+	}
+
+	if c.Probe.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("probe.timeout: %s: %w", c.Probe.Timeout, ErrInvalidValue))
+	}
+
+	if c.OAuth2.Enabled && c.Metrics.Listen == "" {
+		errs = append(errs, fmt.Errorf("oauth2.enabled: the token endpoint requires metrics.listen: %w", ErrConflictingOptions))
+	}
+
+	if c.OAuth2.TokenTTL < 0 {
+		errs = append(errs, fmt.Errorf("oauth2.token-ttl: %s: %w", c.OAuth2.TokenTTL, ErrInvalidValue))
+	}
+
+	switch c.Metrics.Exporter {
+	case "", metrics.ExporterPrometheus, metrics.ExporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf("metrics.exporter: %s: must be %s or %s: %w", c.Metrics.Exporter, metrics.ExporterPrometheus, metrics.ExporterOTLP, ErrInvalidValue))
+	}
+
+	if c.Metrics.OTLP.Interval < 0 {
+		errs = append(errs, fmt.Errorf("metrics.otlp.interval: %s: %w", c.Metrics.OTLP.Interval, ErrInvalidValue))
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sample-ratio: %g: must be between 0 and 1: %w", c.Tracing.SampleRatio, ErrInvalidValue))
+	}
+
+	// A short key makes pseudonyms easy to reverse by brute force over likely IDs.
+	if c.Events.PseudonymizeKey != "" && len(c.Events.PseudonymizeKey) < minPseudonymizeKeyLength {
+		errs = append(errs, fmt.Errorf("events.pseudonymize-key: must be at least %d bytes: %w", minPseudonymizeKeyLength, ErrInvalidValue))
+	}
+
+	if len(c.Events.Kafka.Brokers) > 0 && c.Events.Kafka.Topic == "" {
+		errs = append(errs, fmt.Errorf("events.kafka.topic: topic is empty: %w", ErrInvalidValue))
+	}
+
+	if c.Alert.WebhookURL != "" {
+		if u, err := url.Parse(c.Alert.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("alert.webhook-url: must be an http or https URL: %w", ErrInvalidValue))
+		}
+	}
+
+	if c.Profiling.Interval < 0 {
+		errs = append(errs, fmt.Errorf("profiling.interval: %s: %w", c.Profiling.Interval, ErrInvalidValue))
+	}
+
+	if c.Profiling.Enabled() {
+		if _, err := profiling.New(c.Profiling.Config(), nil); err != nil {
+			errs = append(errs, fmt.Errorf("profiling: %w", err))
+		}
+	}
+
+	if _, err := features.New(c.Features.Enabled, c.Features.Subjects); err != nil {
+		errs = append(errs, fmt.Errorf("features: %w", err))
+	}
+
+	if _, err := emulation.New(c.Emulation.Profiles()); err != nil {
+		errs = append(errs, fmt.Errorf("emulation.action-profiles: %w", err))
+	}
+
+	if _, err := emulation.NewRPC(c.Emulation.RPCs()); err != nil {
+		errs = append(errs, fmt.Errorf("emulation.rpc-profiles: %w", err))
+	}
+
+	if _, err := enrich.New(c.Enrichers(), nil); err != nil {
+		errs = append(errs, fmt.Errorf("claim-enrichers: %w", err))
+	}
+
+	// xDS listener resources are keyed by host and port, so xDS cannot serve on a Unix socket.
+	if c.XDS.Enabled && err == nil && addr.Network == listener.NetworkUnix {
+		errs = append(errs, fmt.Errorf("xds.enabled: xDS requires a TCP listen address: %w", ErrConflictingOptions))
+	}
+
+	for _, l := range c.AllListeners() {
+		if c.XDS.Enabled && l.TLS.Enabled() {
+			errs = append(errs, fmt.Errorf("xds.enabled: xDS configures its own transport security, so listeners cannot use TLS: %w", ErrConflictingOptions))
+
+			break
+		}
+	}
+
+	for _, l := range c.AllListeners() {
+		if c.XDS.Enabled && len(l.APIs) > 0 {
+			errs = append(errs, fmt.Errorf("xds.enabled: xDS serves every API on one server, so listeners cannot limit their APIs: %w", ErrConflictingOptions))
+
+			break
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate checks the settings of a listener bound to addr. prefix is prepended to the keys in
+// errors.
+func (l Listener) validate(prefix string, addr listener.Address) []error {
+	var errs []error
+
+	socketSet := l.Socket.Mode != "" || l.Socket.Owner != "" || l.Socket.Group != ""
+
+	if socketSet && addr.Network != listener.NetworkUnix {
+		errs = append(errs, fmt.Errorf("%ssocket: socket settings require a Unix socket address: %w", prefix, ErrConflictingOptions))
+	}
+
+	if l.Socket.Mode != "" {
+		if _, err := listener.ParseMode(l.Socket.Mode); err != nil {
+			errs = append(errs, fmt.Errorf("%ssocket.mode: %w", prefix, err))
+		}
+	}
+
+	if l.TLS == (TLS{}) {
+		return errs
+	}
+
+	if addr.Network == listener.NetworkUnix {
+		errs = append(errs, fmt.Errorf("%stls: TLS requires a TCP address: %w", prefix, ErrConflictingOptions))
+	}
+
+	if l.TLS.Cert == "" || l.TLS.Key == "" {
+		errs = append(errs, fmt.Errorf("%stls: tls.cert and tls.key must both be set: %w", prefix, ErrConflictingOptions))
+	}
+
+	files := []struct{ key, path string }{
+		{"cert", l.TLS.Cert},
+		{"key", l.TLS.Key},
+		{"client-ca", l.TLS.ClientCA},
+	}
+
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+
+		if err := requireFile(f.path); err != nil {
+			errs = append(errs, fmt.Errorf("%stls.%s: %w", prefix, f.key, err))
+		}
+	}
+
+	return errs
+}
+
+func (g PolicyGit) validate() []error {
+	var errs []error
+
+	if g.Path == "" {
+		errs = append(errs, fmt.Errorf("policy-git.path: path is empty: %w", ErrInvalidValue))
+	}
+
+	if g.Branch != "" && g.Tag != "" {
+		errs = append(errs, fmt.Errorf("policy-git: branch and tag cannot both be set: %w", ErrConflictingOptions))
+	}
+
+	if g.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("policy-git.interval: %s: must be positive: %w", g.Interval, ErrInvalidValue))
+	}
+
+	return errs
+}
+
+func (h PolicyHub) validate() []error {
+	var errs []error
+
+	if _, err := listener.Parse(h.Address); err != nil {
+		errs = append(errs, fmt.Errorf("policy-hub.address: %w", err))
+	}
+
+	if h.Token == "" {
+		errs = append(errs, fmt.Errorf("policy-hub.token: the hub only exports its policy with its admin token: %w", ErrInvalidValue))
+	}
+
+	if h.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("policy-hub.interval: %s: must be positive: %w", h.Interval, ErrInvalidValue))
+	}
+
+	return errs
+}
+
+func requireDir(path string) error {
+	if path == "" {
+		return fmt.Errorf("path is empty: %w", ErrInvalidValue)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, ErrMissingFile)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s: is not a directory: %w", path, ErrInvalidValue)
+	}
+
+	return nil
+}
+
+func requireFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("path is empty: %w", ErrInvalidValue)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, ErrMissingFile)
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("%s: is a directory: %w", path, ErrInvalidValue)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestCheckAccessActionList(t *testing.T) {
+	tests := []struct {
+		name             string
+		emptyActions     string
+		duplicateActions string
+		code             codes.Code
+		rejects          bool
+		invalid          bool
+	}{
+		{name: "defaults", code: codes.OK},
+		{name: "allow and evaluate", emptyActions: EmptyActionsAllow, duplicateActions: DuplicateActionsEvaluate, code: codes.OK},
+		{name: "deny", emptyActions: EmptyActionsDeny, code: codes.PermissionDenied},
+		{name: "invalid and reject", emptyActions: EmptyActionsInvalid, duplicateActions: DuplicateActionsReject, code: codes.InvalidArgument, rejects: true},
+		{name: "unknown empty actions", emptyActions: "ignore", invalid: true},
+		{name: "unknown duplicate actions", duplicateActions: "merge", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := CheckAccess{EmptyActions: tt.emptyActions, DuplicateActions: tt.duplicateActions}
+
+			errs := c.validate()
+
+			if tt.invalid {
+				if len(errs) != 1 || !errors.Is(errs[0], ErrInvalidValue) {
+					t.Fatalf("got errors %v, want one invalid value", errs)
+				}
+
+				return
+			}
+
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+
+			code, err := c.EmptyActionsCode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if code != tt.code {
+				t.Errorf("got empty actions code %s, want %s", code, tt.code)
+			}
+
+			if c.RejectsDuplicates() != tt.rejects {
+				t.Errorf("got rejects duplicates %t, want %t", c.RejectsDuplicates(), tt.rejects)
+			}
+		})
+	}
+}
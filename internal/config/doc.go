@@ -0,0 +1,2 @@
+// Package config provides functions and data for loading and validating the runtime configuration.
+package config
@@ -0,0 +1,12 @@
+package config
+
+import "errors"
+
+var (
+	// ErrInvalidValue represents an error where a configuration value is malformed or out of range.
+	ErrInvalidValue = errors.New("invalid value")
+	// ErrMissingFile represents an error where a file referenced by the configuration does not exist.
+	ErrMissingFile = errors.New("missing file")
+	// ErrConflictingOptions represents an error where mutually exclusive options were set together.
+	ErrConflictingOptions = errors.New("conflicting options")
+)
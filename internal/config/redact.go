@@ -0,0 +1,69 @@
+package config
+
+import (
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RedactedValue replaces the value of secret fields in redacted configurations.
+const RedactedValue = "[REDACTED]"
+
+// Redacted returns a copy of the configuration with every non-empty string field tagged
+// `secret:"true"` replaced by RedactedValue, suitable for printing or returning to operators.
+func (c Config) Redacted() Config {
+	out := c
+
+	redact(reflect.ValueOf(&out).Elem())
+
+	return out
+}
+
+func redact(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+
+			if t.Field(i).Tag.Get("secret") == "true" && field.Kind() == reflect.String {
+				if field.String() != "" {
+					field.SetString(RedactedValue)
+				}
+
+				continue
+			}
+
+			redact(field)
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+
+		// Copy slices so the original configuration is never modified.
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(cp, v)
+		v.Set(cp)
+
+		for i := 0; i < v.Len(); i++ {
+			redact(v.Index(i))
+		}
+	}
+}
+
+// RedactedMap returns the redacted configuration as a generic map keyed by configuration key.
+func (c Config) RedactedMap() (map[string]any, error) {
+	b, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return nil, err
+	}
+
+	var out map[string]any
+	if err := yaml.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
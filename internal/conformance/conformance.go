@@ -0,0 +1,257 @@
+// Package conformance runs authentication and authorization scenarios against an iam-runtime
+// endpoint and compares the outcomes with expectations and, optionally, with a reference runtime
+// such as the static runtime loaded with the same policy.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authentication"
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// onBehalfOfMetadataKey matches the metadata key read by the static runtime for delegated calls.
+const onBehalfOfMetadataKey = "on-behalf-of"
+
+var (
+	// ErrInvalidScenario represents an error where a scenario file was malformed.
+	ErrInvalidScenario = errors.New("invalid scenario")
+)
+
+// Suite is a set of scenarios loaded from a scenario file.
+type Suite struct {
+	// Env provides variables for credential expansion, taking precedence over the process
+	// environment. The static reference runtime resolves policy tokens from it as well.
+	Env map[string]string `yaml:"env"`
+	// Scenarios run in order.
+	Scenarios []Scenario `yaml:"scenarios"`
+}
+
+// Scenario is a single call to the runtime and its expected outcome.
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Credential is sent with the call. ${VAR} references are expanded.
+	Credential string `yaml:"credential"`
+	// OnBehalfOf, if set, makes the call on behalf of another subject.
+	OnBehalfOf string `yaml:"onBehalfOf,omitempty"`
+	// Authenticate calls AuthenticateSubject. Exactly one of Authenticate and Check must be set.
+	Authenticate bool `yaml:"authenticate,omitempty"`
+	// Check calls CheckAccess with the given actions.
+	Check []Action `yaml:"check,omitempty"`
+	// Expect is the expected outcome. It may be omitted when a reference runtime is used.
+	Expect *Expectation `yaml:"expect,omitempty"`
+}
+
+// Action is an action on a resource.
+type Action struct {
+	Action   string `yaml:"action"`
+	Resource string `yaml:"resource"`
+}
+
+// Expectation describes the outcome of a call.
+type Expectation struct {
+	// Code is a gRPC status code name, such as ok or permission_denied.
+	Code string `yaml:"code"`
+	// Claims must be returned by AuthenticateSubject. Other returned claims are ignored.
+	Claims map[string]string `yaml:"claims,omitempty"`
+}
+
+// Outcome is what a runtime returned for a scenario.
+type Outcome struct {
+	Code   codes.Code
+	Claims map[string]string
+}
+
+// Result is the result of running a scenario.
+type Result struct {
+	Scenario string
+	Target   Outcome
+	// Failures describe how the target differed from the expectation or reference. The
+	// scenario passed if there are none.
+	Failures []string
+}
+
+// Passed reports whether the scenario passed.
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Load reads a scenario file.
+func Load(path string) (*Suite, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var suite Suite
+	if err := yaml.Unmarshal(b, &suite); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := suite.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &suite, nil
+}
+
+func (s *Suite) validate() error {
+	var errs []error
+
+	for i, sc := range s.Scenarios {
+		name := sc.Name
+		if name == "" {
+			name = fmt.Sprintf("scenario %d", i)
+		}
+
+		if sc.Authenticate == (len(sc.Check) > 0) {
+			errs = append(errs, fmt.Errorf("%s: exactly one of authenticate and check must be set: %w", name, ErrInvalidScenario))
+		}
+
+		if sc.Expect != nil {
+			if _, err := parseCode(sc.Expect.Code); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+
+			if len(sc.Expect.Claims) > 0 && !sc.Authenticate {
+				errs = append(errs, fmt.Errorf("%s: claims can only be expected from authenticate: %w", name, ErrInvalidScenario))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Getenv returns the value of a variable from the suite's env, falling back to the process
+// environment.
+func (s *Suite) Getenv(key string) string {
+	if v, ok := s.Env[key]; ok {
+		return v
+	}
+
+	return os.Getenv(key)
+}
+
+// Run runs every scenario against target. If reference is not nil, each scenario also runs
+// against it, and the target must return the same code and the same claims. Each call is limited
+// to timeout if it is positive.
+func (s *Suite) Run(ctx context.Context, target, reference grpc.ClientConnInterface, timeout time.Duration) []Result {
+	results := make([]Result, 0, len(s.Scenarios))
+
+	for i, sc := range s.Scenarios {
+		name := sc.Name
+		if name == "" {
+			name = fmt.Sprintf("scenario %d", i)
+		}
+
+		res := Result{
+			Scenario: name,
+			Target:   s.call(ctx, target, sc, timeout),
+		}
+
+		if sc.Expect != nil {
+			// The code was checked by validate.
+			code, _ := parseCode(sc.Expect.Code)
+			expected := Outcome{Code: code, Claims: sc.Expect.Claims}
+
+			res.Failures = append(res.Failures, compare("expected", expected, res.Target)...)
+		}
+
+		if sc.Expect == nil && reference == nil {
+			res.Failures = append(res.Failures, "no expectation and no reference runtime")
+		}
+
+		if reference != nil {
+			res.Failures = append(res.Failures, compare("reference", s.call(ctx, reference, sc, timeout), res.Target)...)
+		}
+
+		results = append(results, res)
+	}
+
+	return results
+}
+
+func (s *Suite) call(ctx context.Context, conn grpc.ClientConnInterface, sc Scenario, timeout time.Duration) Outcome {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if sc.OnBehalfOf != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, onBehalfOfMetadataKey, sc.OnBehalfOf)
+	}
+
+	credential := os.Expand(sc.Credential, s.Getenv)
+
+	if sc.Authenticate {
+		resp, err := authentication.NewAuthenticationClient(conn).AuthenticateSubject(ctx, &authentication.AuthenticateSubjectRequest{
+			Credential: credential,
+		})
+		if err != nil {
+			return Outcome{Code: status.Code(err)}
+		}
+
+		return Outcome{Code: codes.OK, Claims: resp.SubjectClaims}
+	}
+
+	req := &authorization.CheckAccessRequest{
+		Credential: credential,
+	}
+
+	for _, action := range sc.Check {
+		req.Actions = append(req.Actions, &authorization.AccessRequestAction{
+			Action:     action.Action,
+			ResourceId: action.Resource,
+		})
+	}
+
+	_, err := authorization.NewAuthorizationClient(conn).CheckAccess(ctx, req)
+
+	return Outcome{Code: status.Code(err)}
+}
+
+// compare returns the differences between want and got. Only claims present in want are compared.
+func compare(source string, want, got Outcome) []string {
+	var out []string
+
+	if want.Code != got.Code {
+		out = append(out, fmt.Sprintf("%s code %s, got %s", source, want.Code, got.Code))
+	}
+
+	keys := make([]string, 0, len(want.Claims))
+	for k := range want.Claims {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if got.Code == codes.OK && got.Claims[k] != want.Claims[k] {
+			out = append(out, fmt.Sprintf("%s claim %s=%q, got %q", source, k, want.Claims[k], got.Claims[k]))
+		}
+	}
+
+	return out
+}
+
+func parseCode(name string) (codes.Code, error) {
+	var code codes.Code
+	if err := code.UnmarshalJSON([]byte(`"` + strings.ToUpper(name) + `"`)); err != nil {
+		return 0, fmt.Errorf("code %q: %w", name, ErrInvalidScenario)
+	}
+
+	return code, nil
+}
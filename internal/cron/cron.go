@@ -0,0 +1,241 @@
+// Package cron provides functions and data for parsing cron expressions and evaluating the
+// recurring windows they open.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSchedule represents an error where a cron expression could not be parsed.
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// horizon bounds how far ahead schedules are searched, so expressions that never match, such as
+// February 30, end the search.
+const horizon = 5 * 366 * 24 * time.Hour
+
+// field describes one field of a cron expression.
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	// Day of week 7 is also Sunday.
+	dowField = field{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// Schedule is a parsed five-field cron expression: minute, hour, day of month, month, and day of
+// week.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// As in cron, if both days are restricted, a time matches if either does.
+	domAny, dowAny bool
+}
+
+// Parse parses a cron expression. Each field is *, a value, a range a-b, or a comma-separated list
+// of them, and values and ranges may have a step such as */15. Months and days of the week may be
+// given by their three-letter English names.
+func Parse(spec string) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("%w: %s: expected 5 fields, got %d", ErrInvalidSchedule, spec, len(fields))
+	}
+
+	var (
+		out Schedule
+		err error
+	)
+
+	targets := []struct {
+		bits *uint64
+		f    field
+	}{
+		{&out.minute, minuteField},
+		{&out.hour, hourField},
+		{&out.dom, domField},
+		{&out.month, monthField},
+		{&out.dow, dowField},
+	}
+
+	for i, t := range targets {
+		if *t.bits, err = parseField(fields[i], t.f); err != nil {
+			return Schedule{}, fmt.Errorf("%w: %s: %w", ErrInvalidSchedule, spec, err)
+		}
+	}
+
+	out.domAny = fields[2] == "*"
+	out.dowAny = fields[4] == "*"
+
+	if out.dow&(1<<7) != 0 {
+		out.dow |= 1
+	}
+
+	return out, nil
+}
+
+func parseField(spec string, f field) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(spec, ",") {
+		rng, stepSpec, hasStep := strings.Cut(part, "/")
+
+		step := 1
+
+		if hasStep {
+			n, err := strconv.Atoi(stepSpec)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: invalid step '%s'", f.name, stepSpec)
+			}
+
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+
+		if rng != "*" {
+			loSpec, hiSpec, isRange := strings.Cut(rng, "-")
+
+			var err error
+			if lo, err = f.value(loSpec); err != nil {
+				return 0, err
+			}
+
+			hi = lo
+
+			switch {
+			case isRange:
+				if hi, err = f.value(hiSpec); err != nil {
+					return 0, err
+				}
+			case hasStep:
+				hi = f.max
+			}
+
+			if lo > hi {
+				return 0, fmt.Errorf("%s: range '%s' is reversed", f.name, rng)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+func (f field) value(spec string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(spec, name) {
+			return f.min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(spec)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: '%s' must be between %d and %d", f.name, spec, f.min, f.max)
+	}
+
+	return v, nil
+}
+
+func (s Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<t.Weekday()) != 0
+
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// Next returns the first time after t that matches the schedule, in t's location. It returns the
+// zero time if the schedule does not match within five years.
+func (s Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	limit := t.Add(horizon)
+
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// Window is a recurring period that opens at the times of a schedule, evaluated in a location,
+// and stays open for a fixed duration.
+type Window struct {
+	Schedule Schedule
+	Duration time.Duration
+	// Location is the time zone the schedule is evaluated in. If nil, UTC is used.
+	Location *time.Location
+}
+
+func (w Window) location() *time.Location {
+	if w.Location == nil {
+		return time.UTC
+	}
+
+	return w.Location
+}
+
+// Open reports whether the window is open at t: whether it opened at or before t, less than
+// Duration ago.
+func (w Window) Open(t time.Time) bool {
+	start := w.Schedule.Next(t.Add(-w.Duration).In(w.location()))
+
+	return !start.IsZero() && !start.After(t)
+}
+
+// NextChange returns the first time after t at which the window opens or closes. Overlapping
+// windows close when the last of them does. It returns the zero time if the window never changes
+// within five years.
+func (w Window) NextChange(t time.Time) time.Time {
+	if !w.Open(t) {
+		return w.Schedule.Next(t.In(w.location()))
+	}
+
+	end := t
+	limit := t.Add(horizon)
+
+	for start := w.Schedule.Next(t.Add(-w.Duration).In(w.location())); !start.IsZero() && !start.After(end); start = w.Schedule.Next(start) {
+		if e := start.Add(w.Duration); e.After(end) {
+			end = e
+		}
+
+		if end.After(limit) {
+			return time.Time{}
+		}
+	}
+
+	return end
+}
@@ -0,0 +1,187 @@
+// Package decisionlog writes one structured record per authentication or access check request to
+// standard output or a rotating file, so security reviews can see what a runtime allowed and
+// denied, for whom, and how long it took.
+package decisionlog
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/linebuf"
+
+	"go.uber.org/zap"
+)
+
+// ErrNoSinks is returned by New when neither standard output nor a file is configured.
+var ErrNoSinks = errors.New("no decision log sinks configured")
+
+// Request methods recorded in Record.Method.
+const (
+	MethodAuthenticateSubject = "AuthenticateSubject"
+	MethodCheckAccess         = "CheckAccess"
+)
+
+// Decisions recorded in Record.Decision.
+const (
+	// DecisionAllow is recorded for requests that succeeded.
+	DecisionAllow = "allow"
+	// DecisionDeny is recorded for requests refused because the credential was not accepted or an
+	// action was not permitted.
+	DecisionDeny = "deny"
+	// DecisionError is recorded for requests that failed for any other reason, such as invalid
+	// arguments or an unavailable enricher.
+	DecisionError = "error"
+)
+
+// Config configures the decision log.
+type Config struct {
+	// Stdout writes records to standard output, one JSON object per line.
+	Stdout bool
+	File   FileConfig
+}
+
+// FileConfig configures writing records to a rotating file. Writing to a file is disabled if Path
+// is empty.
+type FileConfig struct {
+	Path string
+	// MaxSize is the size in bytes at which the file is rotated. If zero, DefaultMaxSize is used.
+	MaxSize int64
+	// MaxBackups is the number of rotated files kept, as Path.1 (newest) to Path.N. If zero,
+	// DefaultMaxBackups is used.
+	MaxBackups int
+}
+
+// Record describes a request and its outcome.
+type Record struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	// Subject is the subject the request was decided for, if it was authenticated.
+	Subject string `json:"subject,omitempty"`
+	// Actor is the delegate acting on behalf of Subject, if any.
+	Actor string `json:"actor,omitempty"`
+	// ConnectionSubject is the subject stamped on the connection the request arrived on, if any.
+	ConnectionSubject string `json:"connectionSubject,omitempty"`
+	// Peer is the network address of the caller, if known.
+	Peer    string   `json:"peer,omitempty"`
+	Actions []Action `json:"actions,omitempty"`
+	// Decision is one of the Decision constants.
+	Decision string `json:"decision"`
+	// Code is the gRPC status code of a failed request.
+	Code string `json:"code,omitempty"`
+	// Reason is the denial reason code of a failed request, if it has one.
+	Reason        string  `json:"reason,omitempty"`
+	LatencyMillis float64 `json:"latencyMs"`
+	// Metadata holds the configured incoming request metadata, such as traceparent.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Action is an action checked by a request.
+type Action struct {
+	Action     string `json:"action"`
+	ResourceID string `json:"resourceId"`
+	// Allowed reports whether the action was evaluated and permitted.
+	Allowed bool `json:"allowed"`
+}
+
+// sink writes encoded records.
+type sink interface {
+	name() string
+	write(line []byte) error
+	close() error
+}
+
+// Log writes records to the configured sinks. It is safe for concurrent use.
+type Log struct {
+	logger *zap.SugaredLogger
+
+	mu    sync.Mutex
+	sinks []sink
+}
+
+// New opens the configured sinks and returns a Log. Records for standard output are written to
+// stdout.
+func New(cfg Config, stdout io.Writer, logger *zap.SugaredLogger) (*Log, error) {
+	var sinks []sink
+
+	if cfg.Stdout {
+		sinks = append(sinks, writerSink{w: stdout})
+	}
+
+	if cfg.File.Path != "" {
+		s, err := openFileSink(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+
+		sinks = append(sinks, s)
+	}
+
+	if len(sinks) == 0 {
+		return nil, ErrNoSinks
+	}
+
+	return &Log{
+		logger: logger,
+		sinks:  sinks,
+	}, nil
+}
+
+// Write writes rec to every sink. Sink errors are logged, and the record is still written to the
+// other sinks.
+func (l *Log) Write(rec Record) {
+	buf := linebuf.Get()
+	defer linebuf.Put(buf)
+
+	line, err := buf.Encode(rec)
+	if err != nil {
+		l.logger.Warnw("failed to encode decision record", "error", err, "method", rec.Method)
+
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, s := range l.sinks {
+		if err := s.write(line); err != nil {
+			l.logger.Errorw("failed to write decision record", "error", err, "sink", s.name())
+		}
+	}
+}
+
+// Close closes the sinks.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var errs []error
+
+	for _, s := range l.sinks {
+		if err := s.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// writerSink writes records to a writer it does not own, such as standard output.
+type writerSink struct {
+	w io.Writer
+}
+
+func (writerSink) name() string {
+	return "stdout"
+}
+
+func (s writerSink) write(line []byte) error {
+	_, err := s.w.Write(line)
+
+	return err
+}
+
+func (writerSink) close() error {
+	return nil
+}
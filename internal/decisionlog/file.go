@@ -0,0 +1,114 @@
+package decisionlog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	// DefaultMaxSize is the size at which the decision log file is rotated when
+	// FileConfig.MaxSize is not set.
+	DefaultMaxSize = 100 << 20
+	// DefaultMaxBackups is the number of rotated decision log files kept when
+	// FileConfig.MaxBackups is not set.
+	DefaultMaxBackups = 5
+)
+
+// fileSink appends records to a file, rotating it once it would grow past its maximum size.
+type fileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	size int64
+}
+
+func openFileSink(cfg FileConfig) (*fileSink, error) {
+	s := &fileSink{
+		path:       cfg.Path,
+		maxSize:    cfg.MaxSize,
+		maxBackups: cfg.MaxBackups,
+	}
+
+	if s.maxSize <= 0 {
+		s.maxSize = DefaultMaxSize
+	}
+
+	if s.maxBackups <= 0 {
+		s.maxBackups = DefaultMaxBackups
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+
+		return err
+	}
+
+	s.file = f
+	s.size = info.Size()
+
+	return nil
+}
+
+func (*fileSink) name() string {
+	return "file"
+}
+
+func (s *fileSink) write(line []byte) error {
+	// A record larger than the maximum size is still written, to a file of its own.
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+
+	return err
+}
+
+// rotate renames the file to path.1, shifting older backups up and dropping the oldest, and opens
+// a new file. If renaming fails, the current file is reopened so records are still written.
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		err := os.Rename(backupPath(s.path, i), backupPath(s.path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Join(err, s.open())
+		}
+	}
+
+	if err := os.Rename(s.path, backupPath(s.path, 1)); err != nil {
+		return errors.Join(err, s.open())
+	}
+
+	return s.open()
+}
+
+func (s *fileSink) close() error {
+	return s.file.Close()
+}
+
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
@@ -0,0 +1,260 @@
+// Package emulation makes the runtime resemble a production authorization backend by adding
+// per-action latency and errors to access checks, and per-RPC latency and faults to any call, for
+// performance and resilience testing.
+package emulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrInvalidProfile represents an error where an action profile was malformed.
+	ErrInvalidProfile = errors.New("invalid emulation profile")
+)
+
+// Profile describes how checks of matching actions behave.
+type Profile struct {
+	// Actions are glob patterns, such as *_delete, matched against action names.
+	Actions []string
+	// Latency is added to each matching check.
+	Latency time.Duration
+	// Jitter is the maximum random latency added on top of Latency.
+	Jitter time.Duration
+	// ErrorRate is the fraction of matching checks, from 0 to 1, that fail.
+	ErrorRate float64
+	// ErrorCode is the gRPC status code of injected failures, such as unavailable. The default is
+	// unavailable.
+	ErrorCode string
+}
+
+// profile is a validated Profile.
+type profile struct {
+	Profile
+	code codes.Code
+}
+
+// Profiles applies the first matching profile to each action in a check. It is safe for
+// concurrent use.
+type Profiles struct {
+	profiles []profile
+}
+
+// New validates the given profiles and returns them as Profiles, in priority order.
+func New(profiles []Profile) (*Profiles, error) {
+	out := &Profiles{}
+
+	for i, p := range profiles {
+		if len(p.Actions) == 0 {
+			return nil, fmt.Errorf("profile %d: no actions: %w", i, ErrInvalidProfile)
+		}
+
+		code, err := validate(p.Actions, p.Latency, p.Jitter, p.ErrorRate, p.ErrorCode)
+		if err != nil {
+			return nil, fmt.Errorf("profile %d: %w", i, err)
+		}
+
+		out.profiles = append(out.profiles, profile{Profile: p, code: code})
+	}
+
+	return out, nil
+}
+
+// validate checks the patterns and behavior shared by action and RPC profiles, and returns the
+// parsed error code.
+func validate(patterns []string, latency, jitter time.Duration, errorRate float64, errorCode string) (codes.Code, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return 0, fmt.Errorf("%s: %w", pattern, ErrInvalidProfile)
+		}
+	}
+
+	if latency < 0 || jitter < 0 {
+		return 0, fmt.Errorf("latency and jitter must not be negative: %w", ErrInvalidProfile)
+	}
+
+	if errorRate < 0 || errorRate > 1 {
+		return 0, fmt.Errorf("error rate %g: must be between 0 and 1: %w", errorRate, ErrInvalidProfile)
+	}
+
+	return parseCode(errorCode)
+}
+
+func parseCode(name string) (codes.Code, error) {
+	if name == "" {
+		return codes.Unavailable, nil
+	}
+
+	var code codes.Code
+	if err := code.UnmarshalJSON([]byte(`"` + strings.ToUpper(name) + `"`)); err != nil {
+		return 0, fmt.Errorf("error code %s: %w", name, ErrInvalidProfile)
+	}
+
+	if code == codes.OK {
+		return 0, fmt.Errorf("error code %s: must not be ok: %w", name, ErrInvalidProfile)
+	}
+
+	return code, nil
+}
+
+// match returns the first profile matching action.
+func (p *Profiles) match(action string) (profile, bool) {
+	for _, candidate := range p.profiles {
+		for _, pattern := range candidate.Actions {
+			if ok, _ := path.Match(pattern, action); ok {
+				return candidate, true
+			}
+		}
+	}
+
+	return profile{}, false
+}
+
+// Apply delays a check of the given actions by the largest latency of their profiles, as if they
+// were evaluated in parallel, and then returns an injected error if any profile fails the check.
+// It returns the context's error if ctx is done first.
+func (p *Profiles) Apply(ctx context.Context, actions []string) error {
+	if p == nil || len(p.profiles) == 0 {
+		return nil
+	}
+
+	var (
+		delay    time.Duration
+		injected error
+	)
+
+	for _, action := range actions {
+		prof, ok := p.match(action)
+		if !ok {
+			continue
+		}
+
+		delay = max(delay, latency(prof.Latency, prof.Jitter))
+
+		if injected == nil && fails(prof.ErrorRate) {
+			injected = status.Errorf(prof.code, "injected error for action '%s'", action)
+		}
+	}
+
+	if err := sleep(ctx, delay); err != nil {
+		return err
+	}
+
+	return injected
+}
+
+// RPCProfile describes how calls of matching RPCs behave.
+type RPCProfile struct {
+	// RPCs are glob patterns, such as CheckAccess or *Credential, matched against RPC method
+	// names.
+	RPCs []string
+	// Latency is added to each matching call.
+	Latency time.Duration
+	// Jitter is the maximum random latency added on top of Latency.
+	Jitter time.Duration
+	// ErrorRate is the fraction of matching calls, from 0 to 1, that fail.
+	ErrorRate float64
+	// ErrorCode is the gRPC status code of injected failures, such as unavailable or
+	// deadline_exceeded. permission_denied forces a denial and unauthenticated a rejected
+	// credential. The default is unavailable.
+	ErrorCode string
+}
+
+// rpcProfile is a validated RPCProfile.
+type rpcProfile struct {
+	RPCProfile
+	code codes.Code
+}
+
+// RPCProfiles applies the first matching profile to each RPC call. It is safe for concurrent use.
+type RPCProfiles struct {
+	profiles []rpcProfile
+}
+
+// NewRPC validates the given profiles and returns them as RPCProfiles, in priority order.
+func NewRPC(profiles []RPCProfile) (*RPCProfiles, error) {
+	out := &RPCProfiles{}
+
+	for i, p := range profiles {
+		if len(p.RPCs) == 0 {
+			return nil, fmt.Errorf("RPC profile %d: no RPCs: %w", i, ErrInvalidProfile)
+		}
+
+		code, err := validate(p.RPCs, p.Latency, p.Jitter, p.ErrorRate, p.ErrorCode)
+		if err != nil {
+			return nil, fmt.Errorf("RPC profile %d: %w", i, err)
+		}
+
+		out.profiles = append(out.profiles, rpcProfile{RPCProfile: p, code: code})
+	}
+
+	return out, nil
+}
+
+// Apply delays a call of the RPC with the given method name by its profile's latency, and then
+// returns the status code of an injected failure, or OK if the call proceeds. It returns the
+// context's error if ctx is done first.
+func (p *RPCProfiles) Apply(ctx context.Context, method string) (codes.Code, error) {
+	if p == nil {
+		return codes.OK, nil
+	}
+
+	for _, prof := range p.profiles {
+		for _, pattern := range prof.RPCs {
+			if ok, _ := path.Match(pattern, method); !ok {
+				continue
+			}
+
+			if err := sleep(ctx, latency(prof.Latency, prof.Jitter)); err != nil {
+				return codes.OK, err
+			}
+
+			if fails(prof.ErrorRate) {
+				return prof.code, nil
+			}
+
+			return codes.OK, nil
+		}
+	}
+
+	return codes.OK, nil
+}
+
+// latency returns base plus a random duration of up to jitter.
+func latency(base, jitter time.Duration) time.Duration {
+	if jitter > 0 {
+		base += time.Duration(rand.Int63n(int64(jitter) + 1))
+	}
+
+	return base
+}
+
+// fails reports whether a call fails, given the fraction of calls that do.
+func fails(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
+
+// sleep waits for d, returning the context's error as a gRPC status if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-timer.C:
+		return nil
+	}
+}
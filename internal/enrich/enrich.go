@@ -0,0 +1,285 @@
+// Package enrich adds claims to authenticated subjects, so services that key on claims issued by a
+// production identity provider, such as an organization ID or email address, can be tested
+// against the static runtime.
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Enricher types selectable in Config.
+const (
+	TypeStatic   = "static"
+	TypeTemplate = "template"
+	TypeHTTP     = "http"
+)
+
+// defaultHTTPTimeout bounds HTTP lookups when Config.Timeout is not set.
+const defaultHTTPTimeout = 2 * time.Second
+
+// allSubjects keys the static claims added to every subject.
+const allSubjects = "*"
+
+var (
+	// ErrInvalidEnricher represents an error where an enricher was misconfigured.
+	ErrInvalidEnricher = errors.New("invalid claim enricher")
+)
+
+// reservedClaims are set by the runtime and never changed by enrichers.
+var reservedClaims = []string{"sub", "act"}
+
+// Enricher returns claims to add to an authenticated subject's claims. The given claims must not be
+// modified.
+type Enricher interface {
+	Enrich(ctx context.Context, claims map[string]string) (map[string]string, error)
+}
+
+// EnricherFunc adapts a function to the Enricher interface.
+type EnricherFunc func(ctx context.Context, claims map[string]string) (map[string]string, error)
+
+// Enrich calls f.
+func (f EnricherFunc) Enrich(ctx context.Context, claims map[string]string) (map[string]string, error) {
+	return f(ctx, claims)
+}
+
+// Config describes an enricher.
+type Config struct {
+	// Type is static, template, or http.
+	Type string
+	// Subjects maps subject IDs to the claims a static enricher adds for them. Claims under *
+	// are added for every subject, unless overridden by the subject's own.
+	Subjects map[string]map[string]string
+	// Claims maps claim names to text/template templates evaluated by a template enricher
+	// against the claims so far, such as {{.sub}}@example.com.
+	Claims map[string]string
+	// URL receives a JSON POST of the claims so far from an http enricher, and must respond with
+	// a JSON object of string claims to add.
+	URL string
+	// Timeout bounds each HTTP lookup. The default is two seconds.
+	Timeout time.Duration
+	// Optional ignores errors from the enricher, after logging them, instead of failing
+	// authentication.
+	Optional bool
+}
+
+// Step is an enricher in a chain.
+type Step struct {
+	// Name identifies the step in logs and errors.
+	Name     string
+	Enricher Enricher
+	// Optional ignores errors from the enricher instead of failing the chain.
+	Optional bool
+}
+
+// Chain applies enrichers in order. Each enricher sees the claims added by those before it, and
+// may override them, but not the reserved sub and act claims. It is safe for concurrent use.
+type Chain struct {
+	steps  []Step
+	logger *zap.SugaredLogger
+}
+
+// NewChain returns a chain running the given steps in order.
+func NewChain(steps []Step, logger *zap.SugaredLogger) *Chain {
+	return &Chain{
+		steps:  steps,
+		logger: logger,
+	}
+}
+
+// New validates the given configurations and returns a chain running them in order.
+func New(cfgs []Config, logger *zap.SugaredLogger) (*Chain, error) {
+	steps := make([]Step, 0, len(cfgs))
+
+	for i, cfg := range cfgs {
+		e, err := newEnricher(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("enricher %d: %w", i, err)
+		}
+
+		steps = append(steps, Step{
+			Name:     fmt.Sprintf("%d (%s)", i, cfg.Type),
+			Enricher: e,
+			Optional: cfg.Optional,
+		})
+	}
+
+	return NewChain(steps, logger), nil
+}
+
+func newEnricher(cfg Config) (Enricher, error) {
+	switch cfg.Type {
+	case TypeStatic:
+		if len(cfg.Subjects) == 0 {
+			return nil, fmt.Errorf("static: no subjects: %w", ErrInvalidEnricher)
+		}
+
+		return staticEnricher(cfg.Subjects), nil
+	case TypeTemplate:
+		return newTemplateEnricher(cfg.Claims)
+	case TypeHTTP:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("http: no url: %w", ErrInvalidEnricher)
+		}
+
+		if cfg.Timeout < 0 {
+			return nil, fmt.Errorf("http: timeout %s: %w", cfg.Timeout, ErrInvalidEnricher)
+		}
+
+		return newHTTPEnricher(cfg.URL, cfg.Timeout), nil
+	default:
+		return nil, fmt.Errorf("type %q: must be %s, %s, or %s: %w", cfg.Type, TypeStatic, TypeTemplate, TypeHTTP, ErrInvalidEnricher)
+	}
+}
+
+// Apply runs the chain, adding claims to the given map. It is safe to call on a nil chain.
+func (c *Chain) Apply(ctx context.Context, claims map[string]string) error {
+	if c == nil {
+		return nil
+	}
+
+	for _, step := range c.steps {
+		added, err := step.Enricher.Enrich(ctx, claims)
+		if err != nil {
+			if step.Optional {
+				c.logger.Warnw("optional claim enricher failed", "enricher", step.Name, "subject", claims["sub"], "error", err)
+
+				continue
+			}
+
+			return fmt.Errorf("claim enricher %s: %w", step.Name, err)
+		}
+
+		for k, v := range added {
+			if !isReserved(k) {
+				claims[k] = v
+			}
+		}
+	}
+
+	return nil
+}
+
+func isReserved(claim string) bool {
+	for _, r := range reservedClaims {
+		if claim == r {
+			return true
+		}
+	}
+
+	return false
+}
+
+// staticEnricher adds fixed claims by subject.
+type staticEnricher map[string]map[string]string
+
+func (e staticEnricher) Enrich(_ context.Context, claims map[string]string) (map[string]string, error) {
+	out := make(map[string]string)
+
+	for k, v := range e[allSubjects] {
+		out[k] = v
+	}
+
+	for k, v := range e[claims["sub"]] {
+		out[k] = v
+	}
+
+	return out, nil
+}
+
+// templateEnricher derives claims from the claims so far.
+type templateEnricher map[string]*template.Template
+
+func newTemplateEnricher(claims map[string]string) (templateEnricher, error) {
+	if len(claims) == 0 {
+		return nil, fmt.Errorf("template: no claims: %w", ErrInvalidEnricher)
+	}
+
+	out := make(templateEnricher, len(claims))
+
+	for name, text := range claims {
+		tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("template: %s: %v: %w", name, err, ErrInvalidEnricher)
+		}
+
+		out[name] = tmpl
+	}
+
+	return out, nil
+}
+
+func (e templateEnricher) Enrich(_ context.Context, claims map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(e))
+
+	for name, tmpl := range e {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, claims); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		out[name] = b.String()
+	}
+
+	return out, nil
+}
+
+// httpEnricher looks claims up from an external service.
+type httpEnricher struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPEnricher(url string, timeout time.Duration) *httpEnricher {
+	if timeout == 0 {
+		timeout = defaultHTTPTimeout
+	}
+
+	return &httpEnricher{
+		url: url,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+func (e *httpEnricher) Enrich(ctx context.Context, claims map[string]string) (map[string]string, error) {
+	body, err := json.Marshal(map[string]any{"claims": claims})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", e.url, resp.Status)
+	}
+
+	var out map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("%s: decoding claims: %w", e.url, err)
+	}
+
+	return out, nil
+}
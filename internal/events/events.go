@@ -0,0 +1,272 @@
+// Package events provides a typed, in-process event bus. Handlers publish events describing what
+// happened, and cross-cutting features such as audit logging, metrics, and notifications subscribe
+// to them.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event kinds.
+const (
+	KindPolicyLoaded        = "policy_loaded"
+	KindDecisionMade        = "decision_made"
+	KindTokenRevoked        = "token_revoked"
+	KindRelationshipChanged = "relationship_changed"
+	KindGrantExpired        = "grant_expired"
+	KindPolicyRejected      = "policy_rejected"
+	KindPolicyRolledBack    = "policy_rolled_back"
+	KindCredentialRotated   = "credential_rotated"
+	KindOnCallChanged       = "on_call_changed"
+	KindSubjectDisabled     = "subject_disabled"
+	KindSubjectEnabled      = "subject_enabled"
+)
+
+// Event is a typed event published on a Bus.
+type Event interface {
+	// Kind returns the kind of event, one of the Kind constants.
+	Kind() string
+}
+
+// PolicyLoaded is published when a policy becomes active.
+type PolicyLoaded struct {
+	Source   string    `json:"source"`
+	Revision string    `json:"revision"`
+	Time     time.Time `json:"time"`
+}
+
+// Kind implements Event.
+func (PolicyLoaded) Kind() string { return KindPolicyLoaded }
+
+// PolicyRejected is published when a policy update fails the reload guard and the active policy
+// is kept.
+type PolicyRejected struct {
+	Source   string `json:"source"`
+	Revision string `json:"revision"`
+	// ActiveRevision is the revision of the policy that remains active.
+	ActiveRevision string    `json:"activeRevision"`
+	Reason         string    `json:"reason"`
+	Time           time.Time `json:"time"`
+}
+
+// Kind implements Event.
+func (PolicyRejected) Kind() string { return KindPolicyRejected }
+
+// PolicyRolledBack is published when a retained policy is made active again using the admin API.
+type PolicyRolledBack struct {
+	Source   string `json:"source"`
+	Revision string `json:"revision"`
+	// FromRevision is the revision of the policy that was replaced.
+	FromRevision string `json:"fromRevision"`
+	// RequestedBy names who rolled back, as given by the caller.
+	RequestedBy string `json:"requestedBy,omitempty"`
+	// Peer is the network address of the caller, if known.
+	Peer   string    `json:"peer,omitempty"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// Kind implements Event.
+func (PolicyRolledBack) Kind() string { return KindPolicyRolledBack }
+
+// DecisionMade is published for each action evaluated by an access check.
+type DecisionMade struct {
+	// Subject is the subject the decision was made for.
+	Subject string `json:"subject"`
+	// Actor is the delegate acting on behalf of Subject, if any.
+	Actor string `json:"actor,omitempty"`
+	// ConnectionSubject is the subject stamped on the connection the check arrived on, if any.
+	ConnectionSubject string `json:"connectionSubject,omitempty"`
+	Action            string `json:"action"`
+	ResourceID        string `json:"resourceId"`
+	Allowed           bool   `json:"allowed"`
+	// RuleIDs identifies the policy rules that allowed the action, if they have IDs.
+	RuleIDs []string `json:"ruleIds,omitempty"`
+	// Grants are the policy grants that allowed the action.
+	Grants []MatchedGrant `json:"grants,omitempty"`
+	// Backends are the decisions of the authorization backends consulted, in order, if several
+	// backends are configured.
+	Backends []BackendDecision `json:"backends,omitempty"`
+	// Sensitive reports whether the policy marks the action as sensitive.
+	Sensitive bool `json:"sensitive,omitempty"`
+	// ActionDeprecation is the deprecation message for the action, if it is deprecated.
+	ActionDeprecation string `json:"actionDeprecation,omitempty"`
+	// ResourceDeprecation is the deprecation message for the resource, if it is deprecated.
+	ResourceDeprecation string `json:"resourceDeprecation,omitempty"`
+	// Metadata holds the configured incoming request metadata, such as traceparent, for
+	// correlating decisions with application requests.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Time     time.Time         `json:"time"`
+}
+
+// Kind implements Event.
+func (DecisionMade) Kind() string { return KindDecisionMade }
+
+// BackendDecision is the decision of one authorization backend on an action: allow, deny, or
+// abstain, if it has no opinion.
+type BackendDecision struct {
+	Backend  string `json:"backend"`
+	Decision string `json:"decision"`
+}
+
+// MatchedGrant identifies one action of a subject or role grant that allowed a decision.
+type MatchedGrant struct {
+	// Subject is the ID of the subject holding the grant, if it is a subject grant.
+	Subject string `json:"subject,omitempty"`
+	// Role is the id@version reference of the role holding the grant, if it is a role grant.
+	Role       string `json:"role,omitempty"`
+	ResourceID string `json:"resourceId"`
+	// Action is the action as written in the grant, which may imply the decided action.
+	Action string `json:"action"`
+	RuleID string `json:"ruleId,omitempty"`
+}
+
+// TokenRevoked is published when a subject's credential stops being accepted.
+type TokenRevoked struct {
+	Subject string    `json:"subject"`
+	EnvVar  string    `json:"envVar"`
+	Time    time.Time `json:"time"`
+}
+
+// Kind implements Event.
+func (TokenRevoked) Kind() string { return KindTokenRevoked }
+
+// CredentialRotated is published when a subject replaces its credential with a new one.
+type CredentialRotated struct {
+	Subject string `json:"subject"`
+	// PreviousExpiresAt is when the replaced credential stops being accepted.
+	PreviousExpiresAt time.Time `json:"previousExpiresAt"`
+	Time              time.Time `json:"time"`
+}
+
+// Kind implements Event.
+func (CredentialRotated) Kind() string { return KindCredentialRotated }
+
+// RelationshipChanged is published when a relationship is created or deleted.
+type RelationshipChanged struct {
+	ResourceID string `json:"resourceId"`
+	Relation   string `json:"relation"`
+	SubjectID  string `json:"subjectId"`
+	// Deleted reports whether the relationship was deleted rather than created.
+	Deleted bool      `json:"deleted,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Kind implements Event.
+func (RelationshipChanged) Kind() string { return KindRelationshipChanged }
+
+// GrantExpired is published when a grant with an expiry lapses and is removed from evaluation.
+type GrantExpired struct {
+	// Subject is the subject holding the grant, if it is a subject grant.
+	Subject string `json:"subject,omitempty"`
+	// Role is the id@version reference of the role holding the grant, if it is a role grant.
+	Role       string    `json:"role,omitempty"`
+	ResourceID string    `json:"resourceId"`
+	Actions    []string  `json:"actions"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Time       time.Time `json:"time"`
+}
+
+// Kind implements Event.
+func (GrantExpired) Kind() string { return KindGrantExpired }
+
+// OnCallChanged is published when the window of an on-call schedule opens or closes, granting or
+// removing its subjects' temporary access.
+type OnCallChanged struct {
+	Schedule string   `json:"schedule"`
+	Subjects []string `json:"subjects"`
+	// Open reports whether the window opened rather than closed.
+	Open bool      `json:"open"`
+	Time time.Time `json:"time"`
+}
+
+// Kind implements Event.
+func (OnCallChanged) Kind() string { return KindOnCallChanged }
+
+// SubjectDisabled is published when a subject is disabled for not having been seen for the
+// configured stale-subject period.
+type SubjectDisabled struct {
+	Subject string `json:"subject"`
+	// LastSeen is when the subject was last authenticated, if it has been since it was tracked.
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+	// IdleSince is when the subject was last seen, tracked, or enabled again.
+	IdleSince time.Time `json:"idleSince"`
+	Time      time.Time `json:"time"`
+}
+
+// Kind implements Event.
+func (SubjectDisabled) Kind() string { return KindSubjectDisabled }
+
+// SubjectEnabled is published when a disabled subject is enabled again using the admin API.
+type SubjectEnabled struct {
+	Subject    string    `json:"subject"`
+	DisabledAt time.Time `json:"disabledAt"`
+	// Peer is the network address of the caller, if known.
+	Peer string    `json:"peer,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// Kind implements Event.
+func (SubjectEnabled) Kind() string { return KindSubjectEnabled }
+
+// Handler receives events from a Bus. Handlers are called synchronously on the publishing
+// goroutine, so they must not block; slow work should be handed off.
+type Handler func(ev Event)
+
+// Bus delivers published events to every subscribed handler in subscription order.
+type Bus struct {
+	mu       sync.RWMutex
+	nextID   int
+	handlers map[int]Handler
+	order    []int
+}
+
+// NewBus creates an empty event bus.
+func NewBus() *Bus {
+	return &Bus{
+		handlers: make(map[int]Handler),
+	}
+}
+
+// Subscribe registers h to receive events. The returned function removes the subscription.
+func (b *Bus) Subscribe(h Handler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+
+	b.handlers[id] = h
+	b.order = append(b.order, id)
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.handlers, id)
+
+		for i, candidate := range b.order {
+			if candidate == id {
+				b.order = append(b.order[:i:i], b.order[i+1:]...)
+
+				break
+			}
+		}
+	}
+}
+
+// Publish delivers ev to every subscribed handler.
+func (b *Bus) Publish(ev Event) {
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.order))
+
+	for _, id := range b.order {
+		handlers = append(handlers, b.handlers[id])
+	}
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		h(ev)
+	}
+}
@@ -0,0 +1,8 @@
+package features
+
+import "errors"
+
+var (
+	// ErrUnknownFlag represents an error where a feature flag name was not recognized.
+	ErrUnknownFlag = errors.New("unknown feature flag")
+)
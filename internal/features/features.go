@@ -0,0 +1,180 @@
+// Package features gates experimental runtime behaviors behind flags that can be enabled for the
+// whole instance or for individual subjects, so risky subsystems can be rolled out selectively in
+// shared environments.
+package features
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Flag names an experimental behavior.
+type Flag string
+
+// Known feature flags.
+const (
+	// Wildcards enables wildcard matching of actions and resource IDs in grants.
+	Wildcards Flag = "wildcards"
+	// Relationships makes grants on a resource apply to the resources related to it with the
+	// relationship RPCs.
+	Relationships Flag = "relationships"
+	// Chaos enables injected latency and errors for testing client resilience.
+	Chaos Flag = "chaos"
+)
+
+var descriptions = map[Flag]string{
+	Wildcards:     "wildcard matching of actions and resource IDs in grants",
+	Relationships: "grants applying through relationships written with the relationship RPCs",
+	Chaos:         "injected latency and errors for testing client resilience",
+}
+
+// Known returns the names of all known flags in sorted order.
+func Known() []Flag {
+	out := make([]Flag, 0, len(descriptions))
+	for f := range descriptions {
+		out = append(out, f)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+
+	return out
+}
+
+// Description returns a short description of what a flag enables.
+func (f Flag) Description() string {
+	return descriptions[f]
+}
+
+// Parse returns the flag with the given name, or an error if it is not known.
+func Parse(name string) (Flag, error) {
+	f := Flag(name)
+	if _, ok := descriptions[f]; !ok {
+		return "", fmt.Errorf("%s: %w", name, ErrUnknownFlag)
+	}
+
+	return f, nil
+}
+
+// State describes a flag's current settings.
+type State struct {
+	Flag Flag
+	// Enabled is whether the flag is enabled for subjects without an override.
+	Enabled bool
+	// Subjects maps subject IDs to their overrides.
+	Subjects map[string]bool
+}
+
+// Set holds the feature flags of a single runtime instance. It is safe for concurrent use. The
+// zero value is not usable; use New.
+type Set struct {
+	mu       sync.RWMutex
+	global   map[Flag]bool
+	subjects map[Flag]map[string]bool
+}
+
+// New returns a Set with the named flags enabled globally and, for each subject ID in subjects,
+// the named flags enabled for that subject.
+func New(enabled []string, subjects map[string][]string) (*Set, error) {
+	s := &Set{
+		global:   make(map[Flag]bool),
+		subjects: make(map[Flag]map[string]bool),
+	}
+
+	for _, name := range enabled {
+		f, err := Parse(name)
+		if err != nil {
+			return nil, err
+		}
+
+		s.global[f] = true
+	}
+
+	for subject, names := range subjects {
+		for _, name := range names {
+			f, err := Parse(name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", subject, err)
+			}
+
+			s.setSubject(f, subject, true)
+		}
+	}
+
+	return s, nil
+}
+
+// Enabled reports whether f is enabled for the given subject. A subject override takes precedence
+// over the global setting. An empty subject reports the global setting.
+func (s *Set) Enabled(f Flag, subject string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if subject != "" {
+		if enabled, ok := s.subjects[f][subject]; ok {
+			return enabled
+		}
+	}
+
+	return s.global[f]
+}
+
+// Set enables or disables f globally if subject is empty, or for the given subject otherwise.
+func (s *Set) Set(f Flag, subject string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if subject == "" {
+		s.global[f] = enabled
+
+		return
+	}
+
+	s.setSubject(f, subject, enabled)
+}
+
+// Clear removes the given subject's override for f, so the global setting applies to it.
+func (s *Set) Clear(f Flag, subject string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subjects[f], subject)
+}
+
+func (s *Set) setSubject(f Flag, subject string, enabled bool) {
+	if s.subjects[f] == nil {
+		s.subjects[f] = make(map[string]bool)
+	}
+
+	s.subjects[f][subject] = enabled
+}
+
+// State returns the current settings of f.
+func (s *Set) State(f Flag) State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := State{
+		Flag:     f,
+		Enabled:  s.global[f],
+		Subjects: make(map[string]bool, len(s.subjects[f])),
+	}
+
+	for subject, enabled := range s.subjects[f] {
+		out.Subjects[subject] = enabled
+	}
+
+	return out
+}
+
+// States returns the current settings of all known flags, sorted by name.
+func (s *Set) States() []State {
+	known := Known()
+
+	out := make([]State, 0, len(known))
+	for _, f := range known {
+		out = append(out, s.State(f))
+	}
+
+	return out
+}
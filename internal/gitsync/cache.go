@@ -0,0 +1,96 @@
+package gitsync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoCache represents an error where no cached policy is available.
+var ErrNoCache = errors.New("no cached policy")
+
+// cacheEntry is the format of the cache file.
+type cacheEntry struct {
+	// Source is the policy location the entry was synced from, as returned by Source.
+	Source   string `json:"source"`
+	Revision string `json:"revision"`
+	Policy   []byte `json:"policy"`
+}
+
+// Cache records data, synced at revision, as the last applied policy file, if a cache file is
+// configured. Policies applied by Run and Poll are cached automatically. Failures are logged, since
+// the cache is only a fallback.
+func (s *Syncer) Cache(data []byte, revision string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cache(data, revision)
+}
+
+func (s *Syncer) cache(data []byte, revision string) {
+	if s.cfg.CacheFile == "" {
+		return
+	}
+
+	if err := s.writeCache(cacheEntry{Source: s.Source(), Revision: revision, Policy: data}); err != nil {
+		s.logger.Warnw("failed to cache synced policy", "path", s.cfg.CacheFile, "error", err)
+	}
+}
+
+// writeCache replaces the cache file atomically, so a crash never leaves a partial copy. The file
+// is only readable by its owner, since policies hold token digests.
+func (s *Syncer) writeCache(entry cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.cfg.CacheFile), filepath.Base(s.cfg.CacheFile)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.cfg.CacheFile)
+}
+
+// Cached returns the contents and revision of the cached policy file. It returns ErrNoCache if no
+// cache file is configured, it does not exist, or it was synced from another repository, ref, or
+// path.
+func (s *Syncer) Cached() ([]byte, string, error) {
+	if s.cfg.CacheFile == "" {
+		return nil, "", ErrNoCache
+	}
+
+	data, err := os.ReadFile(s.cfg.CacheFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", ErrNoCache
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	var entry cacheEntry
+
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", s.cfg.CacheFile, err)
+	}
+
+	if entry.Source != s.Source() {
+		return nil, "", fmt.Errorf("%w: %s was synced from %s", ErrNoCache, s.cfg.CacheFile, entry.Source)
+	}
+
+	return entry.Policy, entry.Revision, nil
+}
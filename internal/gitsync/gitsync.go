@@ -0,0 +1,253 @@
+// Package gitsync provides functions for syncing a policy file from a git repository.
+package gitsync
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/metrics"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBranch = "main"
+	remoteName    = "origin"
+)
+
+// Config represents the repository location of a policy file.
+type Config struct {
+	// URL is the repository URL.
+	URL string
+	// Branch is the branch to sync. If neither Branch nor Tag is set, main is used.
+	Branch string
+	// Tag is the tag to sync.
+	Tag string
+	// Path is the path of the policy file within the repository.
+	Path string
+	// Interval is how often the repository is polled.
+	Interval time.Duration
+	// Username and Password are used for HTTP basic authentication if set.
+	Username string
+	Password string
+	// CacheFile, if set, keeps a copy of the last applied policy file, which Cached reads.
+	CacheFile string
+}
+
+// Syncer polls a git repository for changes to a policy file. Repository data is kept in memory,
+// and only for the duration of each fetch.
+type Syncer struct {
+	cfg    Config
+	logger *zap.SugaredLogger
+
+	// Serializes fetches and guards lastRevision
+	mu           sync.Mutex
+	lastRevision string
+}
+
+// New creates a new syncer for the given repository.
+func New(cfg Config, logger *zap.SugaredLogger) (*Syncer, error) {
+	if err := remoteConfig(cfg.URL).Validate(); err != nil {
+		return nil, err
+	}
+
+	out := &Syncer{
+		cfg:    cfg,
+		logger: logger,
+	}
+
+	return out, nil
+}
+
+func remoteConfig(url string) *gitconfig.RemoteConfig {
+	return &gitconfig.RemoteConfig{
+		Name: remoteName,
+		URLs: []string{url},
+	}
+}
+
+// newRepository returns an empty in-memory repository with the remote configured. Each fetch uses
+// a new one, so objects from earlier commits are not kept for the life of the process.
+func (s *Syncer) newRepository() (*git.Repository, error) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := repo.CreateRemote(remoteConfig(s.cfg.URL)); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// Source returns a description of the synced policy location. Credentials in the repository URL
+// are left out, since the source is logged and reported with the policy.
+func (s *Syncer) Source() string {
+	return fmt.Sprintf("%s@%s:%s", withoutUserinfo(s.cfg.URL), s.refName().Short(), s.cfg.Path)
+}
+
+// withoutUserinfo returns rawURL without its user name and password, if it is a URL that has them.
+// Other repository locations, such as scp-like addresses, are returned unchanged.
+func withoutUserinfo(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+
+	u.User = nil
+
+	return u.String()
+}
+
+func (s *Syncer) refName() plumbing.ReferenceName {
+	switch {
+	case s.cfg.Tag != "":
+		return plumbing.NewTagReferenceName(s.cfg.Tag)
+	case s.cfg.Branch != "":
+		return plumbing.NewBranchReferenceName(s.cfg.Branch)
+	default:
+		return plumbing.NewBranchReferenceName(defaultBranch)
+	}
+}
+
+func (s *Syncer) auth() transport.AuthMethod {
+	if s.cfg.Username == "" && s.cfg.Password == "" {
+		return nil
+	}
+
+	return &http.BasicAuth{
+		Username: s.cfg.Username,
+		Password: s.cfg.Password,
+	}
+}
+
+// Sync fetches the configured ref and returns the contents of the policy file and the SHA of the
+// commit it was read from.
+func (s *Syncer) Sync(ctx context.Context) ([]byte, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sync(ctx)
+}
+
+func (s *Syncer) sync(ctx context.Context) ([]byte, string, error) {
+	ref := s.refName()
+	spec := gitconfig.RefSpec(fmt.Sprintf("+%s:%s", ref, ref))
+
+	repo, err := s.newRepository()
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []gitconfig.RefSpec{spec},
+		Depth:      1,
+		Auth:       s.auth(),
+		Tags:       git.NoTags,
+		Force:      true,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("fetching %s: %w", ref, err)
+	}
+
+	resolved, err := repo.Reference(ref, true)
+	if err != nil {
+		return nil, "", fmt.Errorf("resolving %s: %w", ref, err)
+	}
+
+	commit, err := commitObject(repo, resolved.Hash())
+	if err != nil {
+		return nil, "", fmt.Errorf("resolving %s: %w", ref, err)
+	}
+
+	file, err := commit.File(s.cfg.Path)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", s.cfg.Path, err)
+	}
+
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", s.cfg.Path, err)
+	}
+
+	return []byte(contents), commit.Hash.String(), nil
+}
+
+// commitObject returns the commit in repo for a hash, dereferencing annotated tags.
+func commitObject(repo *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	if tag, err := repo.TagObject(hash); err == nil {
+		return tag.Commit()
+	}
+
+	return repo.CommitObject(hash)
+}
+
+// Run polls the repository every interval until ctx is canceled, calling fn with the policy file
+// contents each time a new commit is synced. If fn returns an error, the revision is retried on the
+// next poll. The revision given is treated as already applied.
+func (s *Syncer) Run(ctx context.Context, revision string, fn func(data []byte, revision string) error) {
+	s.mu.Lock()
+	s.lastRevision = revision
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.Poll(ctx, fn); err != nil {
+			s.logger.Errorw("policy sync failed", "source", s.Source(), "error", err)
+		}
+	}
+}
+
+// Poll syncs the repository immediately, calling fn with the policy file contents if a new commit
+// was synced. It is safe to call concurrently with Run.
+func (s *Syncer) Poll(ctx context.Context, fn func(data []byte, revision string) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, revision, err := s.sync(ctx)
+	if err != nil {
+		metrics.RecordPolicySync(metrics.SyncResultFailed)
+
+		return err
+	}
+
+	if revision == s.lastRevision {
+		metrics.RecordPolicySync(metrics.SyncResultUnchanged)
+
+		return nil
+	}
+
+	if err := fn(data, revision); err != nil {
+		metrics.RecordPolicySync(metrics.SyncResultFailed)
+
+		return fmt.Errorf("revision %s: %w", revision, err)
+	}
+
+	metrics.RecordPolicySync(metrics.SyncResultUpdated)
+
+	s.lastRevision = revision
+
+	s.cache(data, revision)
+
+	return nil
+}
@@ -0,0 +1,158 @@
+// Package hubsync provides functions for mirroring the policy of another iam-runtime-static
+// instance, the hub, using its admin API. Spokes serve the hub's subjects and grants read-only, so
+// one instance is the source of truth for many ephemeral ones.
+package hubsync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/listener"
+	"github.com/metal-toolbox/iam-runtime-static/internal/metrics"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Config represents the hub a policy is mirrored from.
+type Config struct {
+	// Address is the address of the hub's admin API: a unix socket path, or tcp://host:port.
+	Address string
+	// Token is the hub's admin token, which exports require.
+	Token string
+	// Interval is how often the hub is polled.
+	Interval time.Duration
+}
+
+// Syncer polls a hub for changes to its policy.
+type Syncer struct {
+	cfg    Config
+	client admin.AdminClient
+	logger *zap.SugaredLogger
+
+	// Serializes exports and guards lastRevision
+	mu           sync.Mutex
+	lastRevision string
+}
+
+// New creates a new syncer for the given hub. The hub is not contacted until the first sync.
+func New(cfg Config, logger *zap.SugaredLogger) (*Syncer, error) {
+	addr, err := listener.Parse(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+
+	if cfg.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken(cfg.Token)))
+	}
+
+	conn, err := grpc.Dial(addr.DialTarget(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Syncer{
+		cfg:    cfg,
+		client: admin.NewAdminClient(conn),
+		logger: logger,
+	}
+
+	return out, nil
+}
+
+// Source returns a description of the mirrored policy location.
+func (s *Syncer) Source() string {
+	return "hub:" + s.cfg.Address
+}
+
+// Sync exports the hub's active policy and returns it as a JSON policy document, with the hub's
+// revision of it.
+func (s *Syncer) Sync(ctx context.Context) ([]byte, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sync(ctx)
+}
+
+func (s *Syncer) sync(ctx context.Context) ([]byte, string, error) {
+	resp, err := s.client.ExportPolicy(ctx, &admin.ExportPolicyRequest{})
+	if err != nil {
+		return nil, "", fmt.Errorf("exporting policy from %s: %w", s.cfg.Address, err)
+	}
+
+	return resp.Policy, resp.Revision, nil
+}
+
+// Run polls the hub every interval until ctx is canceled, calling fn with the policy each time a
+// new revision is synced. If fn returns an error, the revision is retried on the next poll. The
+// revision given is treated as already applied.
+func (s *Syncer) Run(ctx context.Context, revision string, fn func(data []byte, revision string) error) {
+	s.mu.Lock()
+	s.lastRevision = revision
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.Poll(ctx, fn); err != nil {
+			s.logger.Errorw("policy sync failed", "source", s.Source(), "error", err)
+		}
+	}
+}
+
+// Poll syncs the hub immediately, calling fn with the policy if a new revision was synced. It is
+// safe to call concurrently with Run.
+func (s *Syncer) Poll(ctx context.Context, fn func(data []byte, revision string) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, revision, err := s.sync(ctx)
+	if err != nil {
+		metrics.RecordPolicySync(metrics.SyncResultFailed)
+
+		return err
+	}
+
+	if revision == s.lastRevision {
+		metrics.RecordPolicySync(metrics.SyncResultUnchanged)
+
+		return nil
+	}
+
+	if err := fn(data, revision); err != nil {
+		metrics.RecordPolicySync(metrics.SyncResultFailed)
+
+		return fmt.Errorf("revision %s: %w", revision, err)
+	}
+
+	metrics.RecordPolicySync(metrics.SyncResultUpdated)
+
+	s.lastRevision = revision
+
+	return nil
+}
+
+// bearerToken sends the hub's admin token as a bearer Authorization header with each call.
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity reports false, since the admin API is often served on a Unix socket.
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
+}
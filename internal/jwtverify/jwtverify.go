@@ -0,0 +1,497 @@
+// Package jwtverify verifies JWTs signed by an identity provider, so the static runtime can
+// authenticate services that already present real OIDC tokens, such as in staging.
+package jwtverify
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// defaultJWKSRefreshInterval is how long a fetched key set is used when Config.JWKSRefreshInterval
+// is not set.
+const defaultJWKSRefreshInterval = 5 * time.Minute
+
+// minJWKSRefetchInterval limits how often a token signed by an unknown key causes the key set to be
+// fetched again, so unknown keys cannot be used to flood the identity provider.
+const minJWKSRefetchInterval = 10 * time.Second
+
+// jwksFetchTimeout bounds each key set fetch.
+const jwksFetchTimeout = 5 * time.Second
+
+var (
+	// ErrInvalidConfig represents an error where the verifier was misconfigured.
+	ErrInvalidConfig = errors.New("invalid JWT verification config")
+	// ErrUnknownKey represents an error where a token was signed by a key that is not trusted.
+	ErrUnknownKey = errors.New("token signed by an unknown key")
+	// ErrKeysUnavailable represents an error where the signing keys could not be fetched.
+	ErrKeysUnavailable = errors.New("signing keys unavailable")
+	// ErrUntrustedIssuer represents an error where a token's issuer is not trusted.
+	ErrUntrustedIssuer = errors.New("token issuer is not trusted")
+)
+
+// signingMethods are the asymmetric algorithms accepted. The key type must match the algorithm, so
+// a public key can never be used as an HMAC secret.
+var signingMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// Config describes how tokens are verified. Exactly one of JWKSURL and PublicKey must be set.
+type Config struct {
+	// JWKSURL is fetched for the JSON Web Key Set whose keys sign tokens.
+	JWKSURL string
+	// JWKSRefreshInterval is how long a fetched key set is used before it is fetched again. The
+	// default is five minutes. A token signed by an unknown key causes an earlier fetch.
+	JWKSRefreshInterval time.Duration
+	// PublicKey is a PEM-encoded public key or certificate that signs tokens.
+	PublicKey []byte
+	// Issuers, if not empty, are the only iss claims accepted.
+	Issuers []string
+	// Audience, if set, must be one of the token's aud claims.
+	Audience string
+	// Leeway tolerates clock skew with the issuer when checking the exp, nbf, and iat claims.
+	Leeway time.Duration
+}
+
+// Identity is the verified issuer and subject of a token.
+type Identity struct {
+	Issuer  string
+	Subject string
+}
+
+// Verifier verifies tokens. It is safe for concurrent use.
+type Verifier struct {
+	parser  *jwt.Parser
+	issuers map[string]bool
+	keys    keySource
+}
+
+// New validates the given configuration and returns a verifier.
+func New(cfg Config, logger *zap.SugaredLogger) (*Verifier, error) {
+	var keys keySource
+
+	switch {
+	case cfg.JWKSURL != "" && len(cfg.PublicKey) > 0:
+		return nil, fmt.Errorf("set either a JWKS URL or a public key, not both: %w", ErrInvalidConfig)
+	case cfg.JWKSURL != "":
+		if cfg.JWKSRefreshInterval < 0 {
+			return nil, fmt.Errorf("JWKS refresh interval %s: %w", cfg.JWKSRefreshInterval, ErrInvalidConfig)
+		}
+
+		keys = newJWKS(cfg.JWKSURL, cfg.JWKSRefreshInterval, logger)
+	case len(cfg.PublicKey) > 0:
+		key, err := parsePublicKey(cfg.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = staticKey{key}
+	default:
+		return nil, fmt.Errorf("no JWKS URL or public key: %w", ErrInvalidConfig)
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
+	issuers := make(map[string]bool, len(cfg.Issuers))
+	for _, iss := range cfg.Issuers {
+		issuers[iss] = true
+	}
+
+	return &Verifier{
+		parser:  jwt.NewParser(opts...),
+		issuers: issuers,
+		keys:    keys,
+	}, nil
+}
+
+// Verify checks the token's signature, expiry, issuer, and audience, and returns its identity.
+func (v *Verifier) Verify(ctx context.Context, token string) (Identity, error) {
+	var claims jwt.RegisteredClaims
+
+	_, err := v.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		return v.keys.key(ctx, kid)
+	})
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if len(v.issuers) > 0 && !v.issuers[claims.Issuer] {
+		return Identity{}, fmt.Errorf("%q: %w", claims.Issuer, ErrUntrustedIssuer)
+	}
+
+	if claims.Subject == "" {
+		return Identity{}, fmt.Errorf("token has no sub claim: %w", jwt.ErrTokenInvalidClaims)
+	}
+
+	return Identity{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+	}, nil
+}
+
+// keySource returns the public key for a key ID.
+type keySource interface {
+	key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// staticKey is a single configured key, used regardless of key ID.
+type staticKey struct {
+	pub crypto.PublicKey
+}
+
+func (k staticKey) key(context.Context, string) (crypto.PublicKey, error) {
+	return k.pub, nil
+}
+
+func parsePublicKey(b []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("public key is not PEM-encoded: %w", ErrInvalidConfig)
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("public key: %v: %w", err, ErrInvalidConfig)
+		}
+
+		return key, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("public key: %v: %w", err, ErrInvalidConfig)
+		}
+
+		return key, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("certificate: %v: %w", err, ErrInvalidConfig)
+		}
+
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("PEM block %q is not a public key or certificate: %w", block.Type, ErrInvalidConfig)
+	}
+}
+
+// jwks is a JSON Web Key Set fetched from a URL and cached.
+type jwks struct {
+	url      string
+	interval time.Duration
+	client   *http.Client
+	logger   *zap.SugaredLogger
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// fetchErr is why the last fetch failed, or nil if it succeeded.
+	fetchErr error
+	// refreshing is closed when the fetch in progress completes, or nil if none is.
+	refreshing chan struct{}
+}
+
+func newJWKS(url string, interval time.Duration, logger *zap.SugaredLogger) *jwks {
+	if interval == 0 {
+		interval = defaultJWKSRefreshInterval
+	}
+
+	return &jwks{
+		url:      url,
+		interval: interval,
+		client: &http.Client{
+			Timeout: jwksFetchTimeout,
+		},
+		logger: logger,
+	}
+}
+
+// key returns the key with the given ID. While the set is fetched, requests for a cached key are
+// answered from the stale set, and others wait for the fetch or until ctx is done. Concurrent
+// requests share a single fetch.
+func (s *jwks) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+
+	age := time.Since(s.fetchedAt)
+
+	key, ok := s.lookup(kid)
+
+	// Fetch again when the set is stale, or when the key is unknown since it may have been
+	// rotated in. An unknown key may also be in the set being fetched.
+	if age < s.interval && (ok || (age < minJWKSRefetchInterval && s.refreshing == nil)) {
+		defer s.mu.Unlock()
+
+		return s.result(kid, key, ok)
+	}
+
+	done := s.refresh()
+
+	// Keep using a stale key rather than delaying every request until the fetch completes.
+	if ok {
+		s.mu.Unlock()
+
+		return key, nil
+	}
+
+	s.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: waiting for JWKS: %v", ErrKeysUnavailable, ctx.Err())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok = s.lookup(kid)
+
+	return s.result(kid, key, ok)
+}
+
+// result returns the outcome of looking up the key with the given ID in the current set. The
+// caller must hold mu.
+func (s *jwks) result(kid string, key crypto.PublicKey, ok bool) (crypto.PublicKey, error) {
+	// No key set has been fetched since the identity provider became unreachable.
+	if s.keys == nil {
+		if s.fetchErr != nil {
+			return nil, fmt.Errorf("%w: %v", ErrKeysUnavailable, s.fetchErr)
+		}
+
+		return nil, fmt.Errorf("%w: JWKS has not been fetched", ErrKeysUnavailable)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("key ID %q: %w", kid, ErrUnknownKey)
+	}
+
+	return key, nil
+}
+
+// refresh starts fetching the set, unless a fetch is already in progress, and returns a channel
+// closed when the fetch completes. The fetch is not canceled with the request that started it, so
+// requests waiting for it are not failed by another's cancellation. The caller must hold mu.
+func (s *jwks) refresh() <-chan struct{} {
+	if s.refreshing != nil {
+		return s.refreshing
+	}
+
+	// Record the attempt even on failure, so an unreachable identity provider is not retried on
+	// every request.
+	s.fetchedAt = time.Now()
+
+	done := make(chan struct{})
+	s.refreshing = done
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+		defer cancel()
+
+		keys, err := s.fetch(ctx)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.fetchErr = err
+
+		switch {
+		case err == nil:
+			s.keys = keys
+		case s.keys != nil:
+			// Keep using a stale key set rather than failing every request.
+			s.logger.Warnw("failed to refresh JWKS, using cached keys", "url", s.url, "error", err)
+		}
+
+		s.refreshing = nil
+		close(done)
+	}()
+
+	return done
+}
+
+// lookup returns the key with the given ID. Tokens without a key ID are accepted when the set has
+// a single key. The caller must hold mu.
+func (s *jwks) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+
+	key, ok := s.keys[kid]
+
+	return key, ok
+}
+
+// fetch fetches and decodes the key set. It does not hold mu.
+func (s *jwks) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS: %s: unexpected status %s", s.url, resp.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+
+	for _, k := range set.Keys {
+		// Skip encryption keys and key types that cannot verify the accepted algorithms.
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		pub, err := k.publicKey()
+		if err != nil {
+			s.logger.Warnw("skipping JWKS key", "url", s.url, "kid", k.Kid, "error", err)
+
+			continue
+		}
+
+		keys[k.Kid] = pub
+	}
+
+	s.logger.Debugw("fetched JWKS", "url", s.url, "keys", len(keys))
+
+	return keys, nil
+}
+
+// jsonWebKey is a public key in a JSON Web Key Set, as defined by RFC 7517.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %w", err)
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("e: %w", err)
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("e: exponent too large")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("x: %d bytes, expected %d", len(x), ed25519.PublicKeySize)
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
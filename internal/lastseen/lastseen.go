@@ -0,0 +1,241 @@
+// Package lastseen stores when each policy subject was last authenticated, and which subjects were
+// disabled for not having been seen for too long, so stale subjects are found across restarts.
+package lastseen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrNotDisabled is returned when enabling a subject that is not disabled.
+var ErrNotDisabled = errors.New("subject is not disabled")
+
+// Record is what is stored about a subject.
+type Record struct {
+	// Tracked is when the subject was first tracked, or last enabled again. A subject is idle from
+	// then until it is first seen.
+	Tracked time.Time `json:"tracked"`
+	// LastSeen is when the subject was last authenticated. It is nil if it has not been since it
+	// was tracked.
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+	// DisabledAt is when the subject was disabled. It is nil if the subject is enabled.
+	DisabledAt *time.Time `json:"disabledAt,omitempty"`
+}
+
+// IdleSince returns when the subject was last active: when it was last seen, or when it was
+// tracked or enabled again if that is later.
+func (r Record) IdleSince() time.Time {
+	if r.LastSeen != nil && r.LastSeen.After(r.Tracked) {
+		return *r.LastSeen
+	}
+
+	return r.Tracked
+}
+
+// Disabled reports whether the subject is disabled.
+func (r Record) Disabled() bool {
+	return r.DisabledAt != nil
+}
+
+// Store holds the records of subjects, keyed by subject ID. It is safe for concurrent use.
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	records map[string]Record
+	// dirty reports whether records changed since they were last saved.
+	dirty bool
+}
+
+// Open returns a store, reading the records in the file at path if it exists. If path is empty,
+// records are kept in memory only and every subject is tracked afresh when the runtime restarts.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		records: make(map[string]Record),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return s, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &s.records); err != nil {
+		return nil, fmt.Errorf("reading subject last-seen times %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// Lookup returns the record of a subject.
+func (s *Store) Lookup(subjectID string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[subjectID]
+
+	return rec, ok
+}
+
+// Seen records that the subject was authenticated at now. It is kept in memory until the next Save.
+func (s *Store) Seen(subjectID string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[subjectID]
+	if !ok {
+		rec.Tracked = now
+	}
+
+	rec.LastSeen = &now
+	s.records[subjectID] = rec
+	s.dirty = true
+}
+
+// Track starts tracking the given subjects at now, if they are not tracked already.
+func (s *Store) Track(subjectIDs []string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range subjectIDs {
+		if _, ok := s.records[id]; ok {
+			continue
+		}
+
+		s.records[id] = Record{Tracked: now}
+		s.dirty = true
+	}
+}
+
+// Retain stops tracking subjects other than the given ones, such as subjects removed from the
+// policy. A subject added again is tracked afresh, and enabled.
+func (s *Store) Retain(subjectIDs []string) {
+	keep := make(map[string]bool, len(subjectIDs))
+	for _, id := range subjectIDs {
+		keep[id] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.records {
+		if !keep[id] {
+			delete(s.records, id)
+			s.dirty = true
+		}
+	}
+}
+
+// Disable disables the subject at now, and saves the store. It returns the subject's record before
+// it was disabled.
+func (s *Store) Disable(subjectID string, now time.Time) (Record, error) {
+	return s.update(subjectID, func(rec *Record) error {
+		rec.DisabledAt = &now
+
+		return nil
+	})
+}
+
+// Enable enables a disabled subject again, and saves the store. The subject is idle from now, so it
+// is not disabled again before it has had time to be seen. It returns ErrNotDisabled if the subject
+// is not disabled, and the subject's record from before it was enabled otherwise.
+func (s *Store) Enable(subjectID string, now time.Time) (Record, error) {
+	return s.update(subjectID, func(rec *Record) error {
+		if !rec.Disabled() {
+			return ErrNotDisabled
+		}
+
+		rec.DisabledAt = nil
+		rec.Tracked = now
+
+		return nil
+	})
+}
+
+// update applies fn to the subject's record and saves the store, keeping the record unchanged if
+// either fails. It returns the record from before fn was applied.
+func (s *Store) update(subjectID string, fn func(*Record) error) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.records[subjectID]
+
+	rec := old
+	if err := fn(&rec); err != nil {
+		return old, err
+	}
+
+	s.records[subjectID] = rec
+
+	if err := s.save(); err != nil {
+		s.records[subjectID] = old
+
+		return old, err
+	}
+
+	return old, nil
+}
+
+// Save writes the records to the store file if they changed since they were last saved.
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+
+	return s.save()
+}
+
+// save implements Save, writing the records whether or not they changed. The caller must hold mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		s.dirty = false
+
+		return nil
+	}
+
+	b, err := json.Marshal(s.records)
+	if err != nil {
+		return err
+	}
+
+	// Write a temporary file next to the store and rename it, so the store is never truncated.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	s.dirty = false
+
+	return nil
+}
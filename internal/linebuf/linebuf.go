@@ -0,0 +1,55 @@
+// Package linebuf pools the buffers records are encoded into as JSON lines, so logs written for
+// every request do not allocate a new buffer for each record.
+package linebuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// maxPooledSize is the capacity above which a buffer is dropped rather than pooled, so one large
+// record does not pin its buffer for the life of the process.
+const maxPooledSize = 64 << 10
+
+// Buffer encodes values as JSON lines. Get one with Get and return it with Put.
+type Buffer struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+var pool = sync.Pool{
+	New: func() any {
+		b := &Buffer{}
+		b.enc = json.NewEncoder(&b.buf)
+
+		return b
+	},
+}
+
+// Get returns an empty buffer from the pool.
+func Get() *Buffer {
+	return pool.Get().(*Buffer)
+}
+
+// Put returns b to the pool. Lines returned by b must not be used afterwards.
+func Put(b *Buffer) {
+	if b.buf.Cap() > maxPooledSize {
+		return
+	}
+
+	b.buf.Reset()
+	pool.Put(b)
+}
+
+// Encode replaces the contents of b with v encoded as JSON, as by json.Marshal, followed by a
+// newline, and returns them. The line is only valid until b is next used or returned to the pool.
+func (b *Buffer) Encode(v any) ([]byte, error) {
+	b.buf.Reset()
+
+	if err := b.enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return b.buf.Bytes(), nil
+}
@@ -0,0 +1,163 @@
+package listener
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// NetworkUnix is the network for Unix domain sockets.
+	NetworkUnix = "unix"
+	// NetworkTCP is the network for dual-stack TCP listeners.
+	NetworkTCP = "tcp"
+	// NetworkTCP4 is the network for IPv4-only TCP listeners.
+	NetworkTCP4 = "tcp4"
+	// NetworkTCP6 is the network for IPv6-only TCP listeners.
+	NetworkTCP6 = "tcp6"
+)
+
+// Address represents a validated network address to listen on.
+type Address struct {
+	// Network is one of unix, tcp, tcp4, or tcp6.
+	Network string
+	// Address is the socket path for unix networks and a host:port pair otherwise.
+	Address string
+}
+
+// String returns the address as a URL-like string.
+func (a Address) String() string {
+	return a.Network + "://" + a.Address
+}
+
+// Parse parses and validates a listener address. Supported forms are:
+//
+//   - /path/to/runtime.sock, ./runtime.sock, or unix:///path/to/runtime.sock for Unix domain sockets
+//   - tcp://host:port or host:port for dual-stack TCP
+//   - tcp4://host:port and tcp6://host:port for single-stack TCP
+//
+// IPv6 literals must be enclosed in brackets (e.g., [::1]:8080) and may carry an interface zone
+// (e.g., [fe80::1%eth0]:8080), which must name an existing interface. An empty host binds all
+// interfaces; for tcp this is a dual-stack listener.
+func Parse(addr string) (Address, error) {
+	if addr == "" {
+		return Address{}, fmt.Errorf("%w: address is empty", ErrInvalidAddress)
+	}
+
+	network, rest, found := strings.Cut(addr, "://")
+	if !found {
+		network, rest = NetworkTCP, addr
+
+		if looksLikePath(addr) {
+			network = NetworkUnix
+		}
+	}
+
+	switch network {
+	case NetworkUnix:
+		if rest == "" {
+			return Address{}, fmt.Errorf("%w: %s: socket path is empty", ErrInvalidAddress, addr)
+		}
+
+		return Address{Network: NetworkUnix, Address: rest}, nil
+	case NetworkTCP, NetworkTCP4, NetworkTCP6:
+		if err := validateHostPort(network, rest); err != nil {
+			return Address{}, fmt.Errorf("%s: %w", addr, err)
+		}
+
+		return Address{Network: network, Address: rest}, nil
+	default:
+		return Address{}, fmt.Errorf("%w: %s: unsupported network '%s'", ErrInvalidAddress, addr, network)
+	}
+}
+
+func validateHostPort(network, hostPort string) error {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		if strings.Count(hostPort, ":") > 1 && !strings.HasPrefix(hostPort, "[") {
+			return fmt.Errorf("%w: IPv6 literals must be enclosed in brackets, e.g. [::1]:8080", ErrInvalidAddress)
+		}
+
+		return fmt.Errorf("%w: %s", ErrInvalidAddress, err)
+	}
+
+	if _, err := net.LookupPort(network, port); err != nil {
+		return fmt.Errorf("%w: invalid port '%s'", ErrInvalidAddress, port)
+	}
+
+	if host == "" {
+		return nil
+	}
+
+	ipStr, zone, hasZone := strings.Cut(host, "%")
+
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		if hasZone {
+			return fmt.Errorf("%w: zone is only valid on IPv6 literals", ErrInvalidAddress)
+		}
+
+		// Host names are resolved when binding.
+		return nil
+	}
+
+	isV4 := ip.To4() != nil
+
+	switch {
+	case network == NetworkTCP4 && !isV4:
+		return fmt.Errorf("%w: %s is not an IPv4 address", ErrNetworkMismatch, ipStr)
+	case network == NetworkTCP6 && isV4:
+		return fmt.Errorf("%w: %s is not an IPv6 address", ErrNetworkMismatch, ipStr)
+	}
+
+	if hasZone {
+		if isV4 {
+			return fmt.Errorf("%w: zone is only valid on IPv6 literals", ErrInvalidAddress)
+		}
+
+		if err := validateZone(zone); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateZone(zone string) error {
+	if zone == "" {
+		return fmt.Errorf("%w: zone is empty", ErrInvalidAddress)
+	}
+
+	if idx, err := strconv.Atoi(zone); err == nil {
+		if _, err := net.InterfaceByIndex(idx); err != nil {
+			return fmt.Errorf("%w: %s", ErrUnknownInterface, zone)
+		}
+
+		return nil
+	}
+
+	if _, err := net.InterfaceByName(zone); err != nil {
+		return fmt.Errorf("%w: %s", ErrUnknownInterface, zone)
+	}
+
+	return nil
+}
+
+// looksLikePath reports whether an address without a scheme should be treated as a socket path.
+func looksLikePath(addr string) bool {
+	return strings.HasPrefix(addr, "/") || strings.HasPrefix(addr, ".") || !strings.Contains(addr, ":")
+}
+
+// DialTarget returns a gRPC dial target for connecting to the address.
+func (a Address) DialTarget() string {
+	if a.Network == NetworkUnix {
+		if strings.HasPrefix(a.Address, "/") {
+			return "unix://" + a.Address
+		}
+
+		return "unix:" + a.Address
+	}
+
+	return a.Address
+}
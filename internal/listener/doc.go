@@ -0,0 +1,3 @@
+// Package listener provides functions and data for parsing, validating, and binding the network
+// addresses the IAM runtime listens on.
+package listener
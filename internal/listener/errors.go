@@ -0,0 +1,19 @@
+package listener
+
+import "errors"
+
+var (
+	// ErrInvalidAddress represents an error where a listener address could not be parsed.
+	ErrInvalidAddress = errors.New("invalid address")
+	// ErrUnknownInterface represents an error where an IPv6 zone referenced a nonexistent interface.
+	ErrUnknownInterface = errors.New("unknown interface")
+	// ErrNetworkMismatch represents an error where an IP literal does not match the requested network.
+	ErrNetworkMismatch = errors.New("address does not match network")
+	// ErrInvalidSocketMode represents an error where a Unix socket file mode could not be parsed.
+	ErrInvalidSocketMode = errors.New("invalid socket mode")
+	// ErrUnknownOwner represents an error where a Unix socket owner or group does not exist.
+	ErrUnknownOwner = errors.New("unknown socket owner")
+	// ErrInvalidTLS represents an error where a listener's TLS certificate, key, or CA could not be
+	// loaded.
+	ErrInvalidTLS = errors.New("invalid TLS configuration")
+)
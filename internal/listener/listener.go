@@ -0,0 +1,178 @@
+package listener
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// Options are the settings of a listener beyond its address.
+type Options struct {
+	// Mode is the file mode of a Unix socket. If zero, the mode is left as set by the umask.
+	Mode os.FileMode
+	// Owner is the user owning a Unix socket, by name or ID. If empty, the owner is unchanged.
+	Owner string
+	// Group is the group owning a Unix socket, by name or ID. If empty, the group is unchanged.
+	Group string
+	// TLS terminates TLS on accepted TCP connections if set.
+	TLS *tls.Config
+}
+
+// Listen binds the given address. For tcp networks with an unspecified or empty host, the
+// resulting listener accepts both IPv4 and IPv6 connections.
+func Listen(addr Address) (net.Listener, error) {
+	return ListenOptions(addr, Options{})
+}
+
+// ListenOptions binds the given address like Listen, then applies the given options: Unix sockets
+// get their mode and ownership, and TCP listeners terminate TLS. A Unix socket with a mode or
+// ownership cannot be connected to until they are applied.
+func ListenOptions(addr Address, opts Options) (net.Listener, error) {
+	if addr.Network == NetworkUnix && (opts.Mode != 0 || opts.Owner != "" || opts.Group != "") {
+		return listenUnix(addr.Address, opts)
+	}
+
+	lis, err := net.Listen(addr.Network, addr.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if addr.Network != NetworkUnix && opts.TLS != nil {
+		lis = tls.NewListener(lis, opts.TLS)
+	}
+
+	return lis, nil
+}
+
+// listenUnix binds the Unix socket at path with the given mode and ownership. The socket is bound
+// in a new directory only its owner can enter, next to path, and only linked to path once they are
+// applied, so nobody else can connect in between.
+func listenUnix(path string, opts Options) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock-")
+	if err != nil {
+		return nil, fmt.Errorf("creating socket directory: %w", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	private := filepath.Join(dir, "s")
+
+	lis, err := net.ListenUnix(NetworkUnix, &net.UnixAddr{Name: private, Net: NetworkUnix})
+	if err != nil {
+		return nil, err
+	}
+
+	// The socket is removed by its final path instead.
+	lis.SetUnlinkOnClose(false)
+
+	if err := setSocketPermissions(private, opts); err != nil {
+		lis.Close()
+
+		return nil, err
+	}
+
+	// Unlike a rename, linking fails if path exists rather than replacing another socket.
+	if err := os.Link(private, path); err != nil {
+		lis.Close()
+
+		return nil, fmt.Errorf("binding socket: %w", err)
+	}
+
+	return &unixListener{UnixListener: lis, path: path}, nil
+}
+
+// unixListener is a Unix socket bound by listenUnix, known by its final path.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+// Addr implements net.Listener.
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: NetworkUnix}
+}
+
+// Close implements net.Listener, removing the socket.
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+
+	if rmErr := os.Remove(l.path); err == nil && !errors.Is(rmErr, os.ErrNotExist) {
+		err = rmErr
+	}
+
+	return err
+}
+
+func setSocketPermissions(path string, opts Options) error {
+	if opts.Owner != "" || opts.Group != "" {
+		uid, gid, err := lookupOwner(opts.Owner, opts.Group)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Chown(path, uid, gid); err != nil {
+			return fmt.Errorf("setting socket owner: %w", err)
+		}
+	}
+
+	if opts.Mode != 0 {
+		if err := os.Chmod(path, opts.Mode); err != nil {
+			return fmt.Errorf("setting socket mode: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ParseMode parses the octal file mode of a Unix socket, such as 0660.
+func ParseMode(mode string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m == 0 || m > 0o777 {
+		return 0, fmt.Errorf("%w: %s: mode must be an octal permission between 0001 and 0777", ErrInvalidSocketMode, mode)
+	}
+
+	return os.FileMode(m), nil
+}
+
+// lookupOwner resolves a user and group, by name or ID, to the IDs passed to chown. An empty user
+// or group resolves to -1, which leaves it unchanged.
+func lookupOwner(owner, group string) (int, int, error) {
+	uid, gid := -1, -1
+
+	if owner != "" {
+		id := owner
+
+		if _, err := strconv.Atoi(owner); err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return 0, 0, fmt.Errorf("%w: user %s: %w", ErrUnknownOwner, owner, err)
+			}
+
+			id = u.Uid
+		}
+
+		uid, _ = strconv.Atoi(id)
+	}
+
+	if group != "" {
+		id := group
+
+		if _, err := strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return 0, 0, fmt.Errorf("%w: group %s: %w", ErrUnknownOwner, group, err)
+			}
+
+			id = g.Gid
+		}
+
+		gid, _ = strconv.Atoi(id)
+	}
+
+	return uid, gid, nil
+}
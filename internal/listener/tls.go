@@ -0,0 +1,43 @@
+package listener
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// LoadTLS loads the TLS configuration of a listener from PEM files: a certificate and key, and
+// optionally a CA bundle that client certificates must be signed by (mTLS). Clients negotiate
+// HTTP/2, as gRPC requires.
+func LoadTLS(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: loading certificate: %w", ErrInvalidTLS, err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2"},
+	}
+
+	if clientCAFile == "" {
+		return cfg, nil
+	}
+
+	b, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading client CA: %w", ErrInvalidTLS, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("%w: %s: no PEM certificates found", ErrInvalidTLS, clientCAFile)
+	}
+
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return cfg, nil
+}
@@ -0,0 +1,353 @@
+// Package lsp implements a minimal Language Server Protocol server over stdio that publishes
+// policy validation diagnostics to editors as policy files are edited.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+)
+
+// JSON-RPC error codes.
+const (
+	codeMethodNotFound = -32601
+)
+
+// LSP diagnostic severities.
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+// ValidateFunc validates the policy and its overlays, reading files with read, which returns the
+// editor's unsaved contents for open documents.
+type ValidateFunc func(read server.ReadFileFunc) []server.Diagnostic
+
+// Server is a language server publishing policy diagnostics.
+type Server struct {
+	files    []string
+	validate ValidateFunc
+
+	mu        sync.Mutex
+	buffers   map[string][]byte
+	published map[string]struct{}
+
+	w io.Writer
+}
+
+// New creates a language server for the given policy files, which must be absolute paths.
+// Diagnostics for these files are always published, even when they are not open.
+func New(files []string, validate ValidateFunc) *Server {
+	return &Server{
+		files:     files,
+		validate:  validate,
+		buffers:   make(map[string][]byte),
+		published: make(map[string]struct{}),
+	}
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	// Result is omitted on errors, but encodes as null for requests without a result.
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *responseError  `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type textDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type documentParams struct {
+	TextDocument   textDocument `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type diagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type publishParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+// Serve reads requests from r and writes responses and notifications to w until the client sends
+// exit or r is closed.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.w = w
+
+	tp := textproto.NewReader(bufio.NewReader(r))
+
+	for {
+		req, err := readMessage(tp)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		exit, err := s.handle(req)
+		if err != nil {
+			return err
+		}
+
+		if exit {
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(req request) (bool, error) {
+	switch req.Method {
+	case "initialize":
+		return false, s.reply(req.ID, map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": map[string]any{
+					"openClose": true,
+					// Full document sync.
+					"change": 1,
+					"save":   true,
+				},
+			},
+			"serverInfo": map[string]any{
+				"name": "iam-runtime-static",
+			},
+		})
+	case "initialized", "textDocument/didSave":
+		return false, s.publish()
+	case "textDocument/didOpen", "textDocument/didChange", "textDocument/didClose":
+		var params documentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return false, err
+		}
+
+		s.updateBuffer(req.Method, params)
+
+		return false, s.publish()
+	case "shutdown":
+		return false, s.reply(req.ID, nil)
+	case "exit":
+		return true, nil
+	}
+
+	// Unknown notifications are ignored; unknown requests get an error.
+	if req.ID == nil {
+		return false, nil
+	}
+
+	return false, s.write(response{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Error: &responseError{
+			Code:    codeMethodNotFound,
+			Message: fmt.Sprintf("method not found: %s", req.Method),
+		},
+	})
+}
+
+func (s *Server) updateBuffer(method string, params documentParams) {
+	path, err := uriToPath(params.TextDocument.URI)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch method {
+	case "textDocument/didOpen":
+		s.buffers[path] = []byte(params.TextDocument.Text)
+	case "textDocument/didChange":
+		if n := len(params.ContentChanges); n > 0 {
+			s.buffers[path] = []byte(params.ContentChanges[n-1].Text)
+		}
+	case "textDocument/didClose":
+		delete(s.buffers, path)
+	}
+}
+
+// read returns the editor's contents for open documents and the file's contents otherwise.
+func (s *Server) read(path string) ([]byte, error) {
+	s.mu.Lock()
+	b, ok := s.buffers[path]
+	s.mu.Unlock()
+
+	if ok {
+		return b, nil
+	}
+
+	return os.ReadFile(path)
+}
+
+// publish validates the policy and publishes diagnostics for every policy file, clearing them for
+// files that no longer have problems.
+func (s *Server) publish() error {
+	byPath := make(map[string][]diagnostic)
+
+	for _, path := range s.files {
+		byPath[path] = []diagnostic{}
+	}
+
+	for path := range s.published {
+		byPath[path] = []diagnostic{}
+	}
+
+	for _, d := range s.validate(s.read) {
+		line := d.Line - 1
+		if line < 0 {
+			line = 0
+		}
+
+		severity := severityError
+		if d.Severity == server.SeverityWarning {
+			severity = severityWarning
+		}
+
+		path, _ := filepath.Abs(d.Path)
+
+		byPath[path] = append(byPath[path], diagnostic{
+			Range: lspRange{
+				Start: position{Line: line},
+				// Clients clamp the end to the line length, so this covers the whole line.
+				End: position{Line: line, Character: 1 << 16},
+			},
+			Severity: severity,
+			Source:   "iam-runtime-static",
+			Message:  d.Message,
+		})
+	}
+
+	s.published = make(map[string]struct{})
+
+	for path, diags := range byPath {
+		if len(diags) > 0 {
+			s.published[path] = struct{}{}
+		}
+
+		err := s.write(notification{
+			JSONRPC: "2.0",
+			Method:  "textDocument/publishDiagnostics",
+			Params: publishParams{
+				URI:         pathToURI(path),
+				Diagnostics: diags,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) reply(id json.RawMessage, result any) error {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return s.write(response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result:  b,
+	})
+}
+
+func (s *Server) write(msg any) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(b), b)
+
+	return err
+}
+
+func readMessage(tp *textproto.Reader) (request, error) {
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return request{}, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return request{}, fmt.Errorf("invalid Content-Length: %w", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(tp.R, body); err != nil {
+		return request{}, err
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return request{}, err
+	}
+
+	return req, nil
+}
+
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported URI scheme: %s", u.Scheme)
+	}
+
+	return filepath.Clean(u.Path), nil
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
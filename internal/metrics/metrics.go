@@ -0,0 +1,250 @@
+// Package metrics provides Prometheus metrics and health reporting for the runtime.
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const namespace = "iam_runtime_static"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	policyInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "policy_info",
+		Help:      "Information about the active policy. The value is always 1.",
+	}, []string{"source", "revision"})
+
+	policySyncs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "policy_syncs_total",
+		Help:      "Number of remote policy sync attempts by result.",
+	}, []string{"result"})
+
+	deprecatedUsage = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deprecated_usage_total",
+		Help:      "Number of access checks using a deprecated action or resource, by subject.",
+	}, []string{"subject", "kind", "name"})
+
+	eventPublishes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_publishes_total",
+		Help:      "Number of events published to external brokers by sink and result.",
+	}, []string{"sink", "result"})
+
+	sessionLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "session_cache_lookups_total",
+		Help:      "Number of credential lookups in per-connection session caches by result.",
+	}, []string{"result"})
+
+	subjectConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "subject_connections",
+		Help:      "Number of open gRPC connections by the subject first authenticated on them.",
+	}, []string{"subject"})
+
+	shadowComparisons = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shadow_comparisons_total",
+		Help:      "Number of requests mirrored to a shadow runtime by RPC and result.",
+	}, []string{"rpc", "result"})
+
+	probes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "probes_total",
+		Help:      "Number of self-test probes by result.",
+	}, []string{"result"})
+
+	probeSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "probe_success",
+		Help:      "Whether the latest self-test probe passed (1) or failed (0).",
+	})
+
+	probeDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "probe_duration_seconds",
+		Help:      "How long the latest self-test probe took.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		policyInfo,
+		policySyncs,
+		deprecatedUsage,
+		eventPublishes,
+		sessionLookups,
+		subjectConnections,
+		shadowComparisons,
+		probes,
+		probeSuccess,
+		probeDuration,
+	)
+}
+
+// Sync results recorded by RecordPolicySync.
+const (
+	SyncResultUpdated   = "updated"
+	SyncResultUnchanged = "unchanged"
+	SyncResultFailed    = "failed"
+)
+
+// SetPolicyInfo records the source and revision of the active policy.
+func SetPolicyInfo(source, revision string) {
+	policyInfo.Reset()
+	policyInfo.WithLabelValues(source, revision).Set(1)
+
+	if inst := otlp.Load(); inst != nil {
+		inst.setPolicyInfo(source, revision)
+	}
+}
+
+// RecordPolicySync records the result of a remote policy sync attempt.
+func RecordPolicySync(result string) {
+	policySyncs.WithLabelValues(result).Inc()
+
+	if inst := otlp.Load(); inst != nil {
+		inst.policySyncs.Add(context.Background(), 1, metric.WithAttributes(attribute.String("result", result)))
+	}
+}
+
+// Deprecation kinds recorded by RecordDeprecatedUsage.
+const (
+	DeprecationKindAction   = "action"
+	DeprecationKindResource = "resource"
+)
+
+// RecordDeprecatedUsage records a subject's use of a deprecated action or resource.
+func RecordDeprecatedUsage(subject, kind, name string) {
+	deprecatedUsage.WithLabelValues(subject, kind, name).Inc()
+
+	if inst := otlp.Load(); inst != nil {
+		inst.deprecatedUsage.Add(context.Background(), 1, metric.WithAttributes(
+			attribute.String("subject", subject),
+			attribute.String("kind", kind),
+			attribute.String("name", name),
+		))
+	}
+}
+
+// Publish results recorded by RecordEventPublish.
+const (
+	PublishResultPublished = "published"
+	PublishResultFailed    = "failed"
+	// PublishResultDropped is recorded with an empty sink when the publish queue is full.
+	PublishResultDropped = "dropped"
+)
+
+// RecordEventPublish records the result of publishing an event to an external broker.
+func RecordEventPublish(sink, result string) {
+	eventPublishes.WithLabelValues(sink, result).Inc()
+
+	if inst := otlp.Load(); inst != nil {
+		inst.eventPublishes.Add(context.Background(), 1, metric.WithAttributes(
+			attribute.String("sink", sink),
+			attribute.String("result", result),
+		))
+	}
+}
+
+// Session cache results recorded by RecordSessionLookup.
+const (
+	SessionResultHit  = "hit"
+	SessionResultMiss = "miss"
+)
+
+// RecordSessionLookup records the result of a credential lookup in a session cache.
+func RecordSessionLookup(result string) {
+	sessionLookups.WithLabelValues(result).Inc()
+
+	if inst := otlp.Load(); inst != nil {
+		inst.sessionLookups.Add(context.Background(), 1, metric.WithAttributes(attribute.String("result", result)))
+	}
+}
+
+// AddSubjectConnections adds delta to the number of open connections stamped with a subject.
+func AddSubjectConnections(subject string, delta int64) {
+	subjectConnections.WithLabelValues(subject).Add(float64(delta))
+
+	if inst := otlp.Load(); inst != nil {
+		inst.subjectConnections.Add(context.Background(), delta, metric.WithAttributes(attribute.String("subject", subject)))
+	}
+}
+
+// Shadow comparison results recorded by RecordShadowComparison.
+const (
+	ShadowResultMatch    = "match"
+	ShadowResultMismatch = "mismatch"
+	// ShadowResultError is recorded when the shadow runtime fails to answer.
+	ShadowResultError = "error"
+	// ShadowResultDropped is recorded when too many mirrored requests are in flight.
+	ShadowResultDropped = "dropped"
+)
+
+// RecordShadowComparison records the result of comparing a decision with a shadow runtime's.
+func RecordShadowComparison(rpc, result string) {
+	shadowComparisons.WithLabelValues(rpc, result).Inc()
+
+	if inst := otlp.Load(); inst != nil {
+		inst.shadowComparisons.Add(context.Background(), 1, metric.WithAttributes(
+			attribute.String("rpc", rpc),
+			attribute.String("result", result),
+		))
+	}
+}
+
+// Probe results recorded by RecordProbe.
+const (
+	ProbeResultPassed = "passed"
+	ProbeResultFailed = "failed"
+)
+
+// RecordProbe records the result and duration of a self-test probe.
+func RecordProbe(passed bool, duration time.Duration) {
+	result, success := ProbeResultFailed, 0
+	if passed {
+		result, success = ProbeResultPassed, 1
+	}
+
+	probes.WithLabelValues(result).Inc()
+	probeSuccess.Set(float64(success))
+	probeDuration.Set(duration.Seconds())
+
+	if inst := otlp.Load(); inst != nil {
+		inst.probes.Add(context.Background(), 1, metric.WithAttributes(attribute.String("result", result)))
+		inst.setProbe(int64(success), duration)
+	}
+}
+
+// Handler returns an HTTP handler serving Prometheus metrics at /metrics and a JSON health report
+// produced by health at /healthz. When metrics are exported over OTLP, /metrics is not served.
+func Handler(health func() any) http.Handler {
+	mux := http.NewServeMux()
+
+	if !otlpEnabled() {
+		mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	}
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		_ = json.NewEncoder(w).Encode(health())
+	})
+
+	return mux
+}
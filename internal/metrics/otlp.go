@@ -0,0 +1,230 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// Exporters selectable with the metrics exporter option.
+const (
+	ExporterPrometheus = "prometheus"
+	ExporterOTLP       = "otlp"
+)
+
+// OTLPConfig configures exporting metrics to an OpenTelemetry collector.
+type OTLPConfig struct {
+	// Endpoint is the collector's host:port. If empty, the OTEL_EXPORTER_OTLP_* environment
+	// variables are used.
+	Endpoint string
+	// Insecure disables TLS to the collector.
+	Insecure bool
+	// Interval is how often metrics are exported.
+	Interval time.Duration
+}
+
+// otlpInstruments mirrors the Prometheus metrics as OpenTelemetry instruments. Instrument names
+// drop the _total suffix, which OTLP to Prometheus conversion adds back for counters.
+type otlpInstruments struct {
+	policySyncs     metric.Int64Counter
+	deprecatedUsage metric.Int64Counter
+	eventPublishes  metric.Int64Counter
+	sessionLookups  metric.Int64Counter
+	probes          metric.Int64Counter
+
+	shadowComparisons metric.Int64Counter
+
+	subjectConnections metric.Int64UpDownCounter
+
+	mu             sync.Mutex
+	policySource   string
+	policyRevision string
+	probed         bool
+	probeSuccess   int64
+	probeDuration  time.Duration
+}
+
+var otlp atomic.Pointer[otlpInstruments]
+
+// otlpEnabled reports whether metrics are exported over OTLP instead of served for scraping.
+func otlpEnabled() bool {
+	return otlp.Load() != nil
+}
+
+// StartOTLP exports the runtime's metrics to an OpenTelemetry collector over gRPC instead of
+// serving them at /metrics. The returned function flushes and stops the exporter.
+func StartOTLP(ctx context.Context, cfg OTLPConfig, serviceName string) (func(context.Context) error, error) {
+	var opts []otlpmetricgrpc.Option
+
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlpmetricgrpc.WithEndpoint(cfg.Endpoint))
+	}
+
+	if cfg.Insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+
+	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var readerOpts []sdkmetric.PeriodicReaderOption
+	if cfg.Interval > 0 {
+		readerOpts = append(readerOpts, sdkmetric.WithInterval(cfg.Interval))
+	}
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, readerOpts...)),
+		sdkmetric.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+
+	inst, err := newOTLPInstruments(provider.Meter("github.com/metal-toolbox/iam-runtime-static"))
+	if err != nil {
+		_ = provider.Shutdown(ctx)
+
+		return nil, err
+	}
+
+	otlp.Store(inst)
+
+	return provider.Shutdown, nil
+}
+
+func newOTLPInstruments(meter metric.Meter) (*otlpInstruments, error) {
+	out := &otlpInstruments{}
+
+	var err error
+
+	out.policySyncs, err = meter.Int64Counter(namespace+"_policy_syncs",
+		metric.WithDescription("Number of remote policy sync attempts by result."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	out.deprecatedUsage, err = meter.Int64Counter(namespace+"_deprecated_usage",
+		metric.WithDescription("Number of access checks using a deprecated action or resource, by subject."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	out.eventPublishes, err = meter.Int64Counter(namespace+"_event_publishes",
+		metric.WithDescription("Number of events published to external brokers by sink and result."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	out.sessionLookups, err = meter.Int64Counter(namespace+"_session_cache_lookups",
+		metric.WithDescription("Number of credential lookups in per-connection session caches by result."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	out.subjectConnections, err = meter.Int64UpDownCounter(namespace+"_subject_connections",
+		metric.WithDescription("Number of open gRPC connections by the subject first authenticated on them."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	out.shadowComparisons, err = meter.Int64Counter(namespace+"_shadow_comparisons",
+		metric.WithDescription("Number of requests mirrored to a shadow runtime by RPC and result."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	out.probes, err = meter.Int64Counter(namespace+"_probes",
+		metric.WithDescription("Number of self-test probes by result."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableGauge(namespace+"_probe_success",
+		metric.WithDescription("Whether the latest self-test probe passed (1) or failed (0)."),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			out.mu.Lock()
+			defer out.mu.Unlock()
+
+			if out.probed {
+				o.Observe(out.probeSuccess)
+			}
+
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Float64ObservableGauge(namespace+"_probe_duration_seconds",
+		metric.WithDescription("How long the latest self-test probe took."),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			out.mu.Lock()
+			defer out.mu.Unlock()
+
+			if out.probed {
+				o.Observe(out.probeDuration.Seconds())
+			}
+
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableGauge(namespace+"_policy_info",
+		metric.WithDescription("Information about the active policy. The value is always 1."),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			out.mu.Lock()
+			defer out.mu.Unlock()
+
+			if out.policySource == "" && out.policyRevision == "" {
+				return nil
+			}
+
+			o.Observe(1, metric.WithAttributes(
+				attribute.String("source", out.policySource),
+				attribute.String("revision", out.policyRevision),
+			))
+
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (i *otlpInstruments) setPolicyInfo(source, revision string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.policySource = source
+	i.policyRevision = revision
+}
+
+func (i *otlpInstruments) setProbe(success int64, duration time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.probed = true
+	i.probeSuccess = success
+	i.probeDuration = duration
+}
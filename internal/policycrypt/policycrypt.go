@@ -0,0 +1,161 @@
+// Package policycrypt decrypts policy files encrypted at rest with age
+// (https://age-encryption.org), so hosts need not keep readable permission maps on disk. The whole
+// file is encrypted, in either the binary or the ASCII-armored format.
+package policycrypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// identityCommandTimeout bounds how long an identity command, such as a KMS CLI, may run.
+const identityCommandTimeout = 30 * time.Second
+
+var (
+	// ErrNoIdentity is returned when an encrypted policy is read but no identity is configured.
+	ErrNoIdentity = errors.New("policy is encrypted but no decryption identity is configured")
+
+	// ErrConflictingIdentities is returned when more than one identity source is configured.
+	ErrConflictingIdentities = errors.New("only one of identity, identity file, and identity command may be set")
+)
+
+// binaryHeader begins every binary age file.
+const binaryHeader = "age-encryption.org/v1\n"
+
+// Config describes where to find the age identity used to decrypt policies. At most one source
+// may be set.
+type Config struct {
+	// Identity is an age identity (AGE-SECRET-KEY-1...), usually passed in the environment.
+	Identity string
+	// IdentityFile is a file containing one or more age identities.
+	IdentityFile string
+	// IdentityCommand is run with sh -c and must print one or more age identities on stdout. It
+	// lets the identity be fetched from a KMS or secret manager at startup.
+	IdentityCommand string
+}
+
+// Decrypter decrypts encrypted policies and passes plaintext policies through unchanged. The zero
+// value has no identities, so it rejects encrypted policies with ErrNoIdentity.
+type Decrypter struct {
+	identities []age.Identity
+}
+
+// New returns a Decrypter using the identities from the configured source. If no source is set,
+// the Decrypter only accepts plaintext policies.
+func New(ctx context.Context, cfg Config) (*Decrypter, error) {
+	sources := 0
+
+	for _, v := range []string{cfg.Identity, cfg.IdentityFile, cfg.IdentityCommand} {
+		if v != "" {
+			sources++
+		}
+	}
+
+	if sources > 1 {
+		return nil, ErrConflictingIdentities
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+
+	switch {
+	case cfg.Identity != "":
+		data = []byte(cfg.Identity)
+	case cfg.IdentityFile != "":
+		data, err = os.ReadFile(cfg.IdentityFile)
+	case cfg.IdentityCommand != "":
+		data, err = runIdentityCommand(ctx, cfg.IdentityCommand)
+	default:
+		return &Decrypter{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing policy decryption identity: %w", err)
+	}
+
+	return &Decrypter{identities: identities}, nil
+}
+
+func runIdentityCommand(ctx context.Context, command string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, identityCommandTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running policy identity command: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+// IsEncrypted reports whether data is an age-encrypted file.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(binaryHeader)) || bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(armor.Header))
+}
+
+// Decrypt returns the plaintext of data if it is encrypted, or data itself otherwise.
+func (d *Decrypter) Decrypt(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+
+	if len(d.identities) == 0 {
+		return nil, ErrNoIdentity
+	}
+
+	var src io.Reader = bytes.NewReader(data)
+	if !bytes.HasPrefix(data, []byte(binaryHeader)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimLeft(data, " \t\r\n")))
+	}
+
+	r, err := age.Decrypt(src, d.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting policy: %w", err)
+	}
+
+	return io.ReadAll(r)
+}
+
+// Wrap returns a file reader that decrypts the contents returned by read.
+func (d *Decrypter) Wrap(read func(path string) ([]byte, error)) func(path string) ([]byte, error) {
+	return func(path string) ([]byte, error) {
+		data, err := read(path)
+		if err != nil {
+			return nil, err
+		}
+
+		out, err := d.Decrypt(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		return out, nil
+	}
+}
+
+// ReadFile reads the named file and decrypts it if needed.
+func (d *Decrypter) ReadFile(path string) ([]byte, error) {
+	return d.Wrap(os.ReadFile)(path)
+}
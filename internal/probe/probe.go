@@ -0,0 +1,157 @@
+// Package probe checks a running iam-runtime end to end for synthetic monitoring, by authenticating
+// a dedicated probe subject and checking its access to a probe resource over the runtime's own
+// listener.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/metrics"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authentication"
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// defaultTimeout bounds a probe when Config.Timeout is not set.
+const defaultTimeout = 5 * time.Second
+
+// Config describes the probe subject and the access it must be granted.
+type Config struct {
+	// Credential is the probe subject's token.
+	Credential string
+	// Action and Resource are checked with CheckAccess, which must allow them.
+	Action   string
+	Resource string
+	// Timeout bounds each probe. The default is five seconds.
+	Timeout time.Duration
+}
+
+// Result is the outcome of a probe.
+type Result struct {
+	OK bool `json:"ok"`
+	// Subject is the sub claim returned for the probe credential.
+	Subject string `json:"subject,omitempty"`
+	// Error describes the failed step if the probe did not pass.
+	Error     string        `json:"error,omitempty"`
+	Latency   time.Duration `json:"latency"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+// Prober runs probes against a runtime and keeps the latest result.
+type Prober struct {
+	cfg    Config
+	conn   grpc.ClientConnInterface
+	logger *zap.SugaredLogger
+
+	last atomic.Pointer[Result]
+}
+
+// New creates a prober calling the runtime over conn.
+func New(cfg Config, conn grpc.ClientConnInterface, logger *zap.SugaredLogger) *Prober {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	return &Prober{
+		cfg:    cfg,
+		conn:   conn,
+		logger: logger,
+	}
+}
+
+// Probe authenticates the probe subject and checks its access, records the result in metrics, and
+// returns it.
+func (p *Prober) Probe(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	subject, err := p.probe(ctx)
+
+	res := Result{
+		OK:        err == nil,
+		Subject:   subject,
+		Latency:   time.Since(start),
+		CheckedAt: start,
+	}
+
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	p.last.Store(&res)
+
+	metrics.RecordProbe(res.OK, res.Latency)
+
+	return res
+}
+
+func (p *Prober) probe(ctx context.Context) (string, error) {
+	authResp, err := authentication.NewAuthenticationClient(p.conn).AuthenticateSubject(ctx, &authentication.AuthenticateSubjectRequest{
+		Credential: p.cfg.Credential,
+	})
+	if err != nil {
+		return "", fmt.Errorf("authenticating probe subject: %w", err)
+	}
+
+	subject := authResp.SubjectClaims["sub"]
+
+	_, err = authorization.NewAuthorizationClient(p.conn).CheckAccess(ctx, &authorization.CheckAccessRequest{
+		Credential: p.cfg.Credential,
+		Actions: []*authorization.AccessRequestAction{
+			{
+				Action:     p.cfg.Action,
+				ResourceId: p.cfg.Resource,
+			},
+		},
+	})
+	if err != nil {
+		return subject, fmt.Errorf("checking access to %s on %s: %w", p.cfg.Action, p.cfg.Resource, err)
+	}
+
+	return subject, nil
+}
+
+// Last returns the result of the latest probe, or nil if none has run. It is safe to call on a nil
+// prober.
+func (p *Prober) Last() *Result {
+	if p == nil {
+		return nil
+	}
+
+	return p.last.Load()
+}
+
+// Run probes every interval until ctx is done, logging failures and recoveries.
+func (p *Prober) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		prev := p.Last()
+
+		res := p.Probe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case !res.OK && (prev == nil || prev.OK):
+			p.logger.Errorw("self-test probe failed", "error", res.Error)
+		case res.OK && prev != nil && !prev.OK:
+			p.logger.Infow("self-test probe recovered", "latency", res.Latency)
+		}
+	}
+}
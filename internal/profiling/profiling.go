@@ -0,0 +1,275 @@
+// Package profiling continuously profiles the runtime and pushes the profiles to a profiling
+// server's pprof ingest endpoint, such as Pyroscope's, so long-running instances can be profiled
+// retroactively when a latency regression is reported.
+package profiling
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Profile types.
+const (
+	ProfileCPU       = "cpu"
+	ProfileHeap      = "heap"
+	ProfileAllocs    = "allocs"
+	ProfileGoroutine = "goroutine"
+	ProfileMutex     = "mutex"
+	ProfileBlock     = "block"
+)
+
+// Profiles lists the supported profile types.
+var Profiles = []string{ProfileCPU, ProfileHeap, ProfileAllocs, ProfileGoroutine, ProfileMutex, ProfileBlock}
+
+// DefaultProfiles are the profile types pushed when none are configured.
+var DefaultProfiles = []string{ProfileCPU, ProfileHeap}
+
+// DefaultInterval is how often profiles are pushed when no interval is configured.
+const DefaultInterval = 15 * time.Second
+
+// ingestPath is the path of the ingest endpoint, relative to the server URL.
+const ingestPath = "ingest"
+
+// sendTimeout bounds how long pushing a single profile may take.
+const sendTimeout = 10 * time.Second
+
+// Sampling rates enabled for the mutex and block profiles, which are off by default.
+const (
+	mutexProfileFraction = 5
+	blockProfileRate     = 10000
+)
+
+// ErrInvalidConfig represents an error where the profiling configuration is malformed.
+var ErrInvalidConfig = errors.New("invalid profiling configuration")
+
+// Config describes where profiles are pushed and which are collected.
+type Config struct {
+	// ServerURL is the base URL of the profiling server.
+	ServerURL string
+	// AppName names the application on the server.
+	AppName string
+	// Tags are attached to every profile, such as the environment or instance.
+	Tags map[string]string
+	// Profiles are the profile types collected, from Profiles. DefaultProfiles are used if empty.
+	Profiles []string
+	// Interval is how often profiles are pushed. The CPU profile covers the whole interval.
+	Interval time.Duration
+	// AuthToken, if set, is sent as a bearer token.
+	AuthToken string
+}
+
+// Pusher collects profiles and pushes them to a profiling server.
+type Pusher struct {
+	cfg    Config
+	ingest *url.URL
+	client *http.Client
+	logger *zap.SugaredLogger
+}
+
+// New creates a pusher for cfg.
+func New(cfg Config, logger *zap.SugaredLogger) (*Pusher, error) {
+	u, err := url.Parse(cfg.ServerURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: server URL must be an http or https URL", ErrInvalidConfig)
+	}
+
+	if cfg.AppName == "" {
+		return nil, fmt.Errorf("%w: app name is empty", ErrInvalidConfig)
+	}
+
+	for _, p := range cfg.Profiles {
+		if !known(p) {
+			return nil, fmt.Errorf("%w: unknown profile '%s': must be one of %s", ErrInvalidConfig, p, strings.Join(Profiles, ", "))
+		}
+	}
+
+	if len(cfg.Profiles) == 0 {
+		cfg.Profiles = DefaultProfiles
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+
+	return &Pusher{
+		cfg:    cfg,
+		ingest: u.JoinPath(ingestPath),
+		client: &http.Client{
+			Timeout: sendTimeout,
+		},
+		logger: logger,
+	}, nil
+}
+
+func known(profile string) bool {
+	for _, p := range Profiles {
+		if p == profile {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Run collects and pushes profiles every interval until ctx is done. Failures to push are logged,
+// and the next interval's profiles are pushed as usual.
+func (p *Pusher) Run(ctx context.Context) {
+	cpu := p.enabled(ProfileCPU)
+
+	if p.enabled(ProfileMutex) {
+		runtime.SetMutexProfileFraction(mutexProfileFraction)
+	}
+
+	if p.enabled(ProfileBlock) {
+		runtime.SetBlockProfileRate(blockProfileRate)
+	}
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	var cpuProfile bytes.Buffer
+
+	from := time.Now()
+
+	if cpu {
+		if err := pprof.StartCPUProfile(&cpuProfile); err != nil {
+			p.logger.Warnw("failed to start CPU profiling; CPU profiles will not be pushed", "error", err)
+
+			cpu = false
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if cpu {
+				pprof.StopCPUProfile()
+			}
+
+			return
+		case until := <-ticker.C:
+			if cpu {
+				pprof.StopCPUProfile()
+				p.push(ProfileCPU, cpuProfile.Bytes(), from, until)
+
+				cpuProfile.Reset()
+
+				if err := pprof.StartCPUProfile(&cpuProfile); err != nil {
+					p.logger.Warnw("failed to restart CPU profiling; CPU profiles will not be pushed", "error", err)
+
+					cpu = false
+				}
+			}
+
+			for _, name := range p.cfg.Profiles {
+				if name == ProfileCPU {
+					continue
+				}
+
+				var buf bytes.Buffer
+
+				if err := pprof.Lookup(name).WriteTo(&buf, 0); err != nil {
+					p.logger.Warnw("failed to collect profile", "profile", name, "error", err)
+
+					continue
+				}
+
+				p.push(name, buf.Bytes(), from, until)
+			}
+
+			from = until
+		}
+	}
+}
+
+func (p *Pusher) enabled(profile string) bool {
+	for _, name := range p.cfg.Profiles {
+		if name == profile {
+			return true
+		}
+	}
+
+	return false
+}
+
+// push sends a pprof-encoded profile covering from to until, logging any failure.
+func (p *Pusher) push(profile string, data []byte, from, until time.Time) {
+	if err := p.send(profile, data, from, until); err != nil {
+		p.logger.Warnw("failed to push profile", "profile", profile, "error", err)
+	}
+}
+
+func (p *Pusher) send(profile string, data []byte, from, until time.Time) error {
+	u := *p.ingest
+
+	q := url.Values{}
+	q.Set("name", p.seriesName(profile))
+	q.Set("from", strconv.FormatInt(from.Unix(), 10))
+	q.Set("until", strconv.FormatInt(until.Unix(), 10))
+	q.Set("format", "pprof")
+	q.Set("spyName", "gospy")
+	u.RawQuery = q.Encode()
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	if p.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.AuthToken)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// seriesName returns the name a profile is ingested under: the app name and profile type, with
+// the tags in braces, such as iam-runtime-static.cpu{env=staging}.
+func (p *Pusher) seriesName(profile string) string {
+	name := p.cfg.AppName + "." + profile
+
+	if len(p.cfg.Tags) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(p.cfg.Tags))
+	for k := range p.cfg.Tags {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	tags := make([]string, len(keys))
+	for i, k := range keys {
+		tags[i] = k + "=" + p.cfg.Tags[k]
+	}
+
+	return name + "{" + strings.Join(tags, ",") + "}"
+}
@@ -0,0 +1,102 @@
+// Package pseudonym replaces identifiers in exported decision data with keyed HMAC pseudonyms, so
+// the data can be analyzed without revealing service identities. The same identifier always maps
+// to the same pseudonym under a given key.
+package pseudonym
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+)
+
+// Prefix marks pseudonymized identifiers.
+const Prefix = "hmac:"
+
+// pseudonymBytes is the length of the truncated HMAC used as a pseudonym.
+const pseudonymBytes = 16
+
+// Pseudonymizer computes pseudonyms with a secret key.
+type Pseudonymizer struct {
+	key []byte
+}
+
+// New returns a Pseudonymizer using key. Anyone holding the key can confirm whether a pseudonym
+// belongs to a known identifier, so it must be kept from the data's recipients.
+func New(key []byte) *Pseudonymizer {
+	return &Pseudonymizer{key: key}
+}
+
+// ID returns the pseudonym for id. The empty ID is left empty.
+func (p *Pseudonymizer) ID(id string) string {
+	if id == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(id))
+
+	return Prefix + hex.EncodeToString(mac.Sum(nil)[:pseudonymBytes])
+}
+
+// Event returns ev with subject, actor, and resource IDs pseudonymized. Other events are returned
+// unchanged.
+func (p *Pseudonymizer) Event(ev events.Event) events.Event {
+	switch ev := ev.(type) {
+	case events.DecisionMade:
+		ev.Subject = p.ID(ev.Subject)
+		ev.Actor = p.ID(ev.Actor)
+		ev.ResourceID = p.ID(ev.ResourceID)
+
+		if len(ev.Grants) > 0 {
+			grants := make([]events.MatchedGrant, len(ev.Grants))
+			for i, g := range ev.Grants {
+				g.Subject = p.ID(g.Subject)
+				g.ResourceID = p.ID(g.ResourceID)
+				grants[i] = g
+			}
+
+			ev.Grants = grants
+		}
+
+		return ev
+	case events.TokenRevoked:
+		ev.Subject = p.ID(ev.Subject)
+
+		return ev
+	case events.CredentialRotated:
+		ev.Subject = p.ID(ev.Subject)
+
+		return ev
+	case events.RelationshipChanged:
+		ev.ResourceID = p.ID(ev.ResourceID)
+		ev.SubjectID = p.ID(ev.SubjectID)
+
+		return ev
+	case events.GrantExpired:
+		ev.Subject = p.ID(ev.Subject)
+		ev.ResourceID = p.ID(ev.ResourceID)
+
+		return ev
+	case events.SubjectDisabled:
+		ev.Subject = p.ID(ev.Subject)
+
+		return ev
+	case events.SubjectEnabled:
+		ev.Subject = p.ID(ev.Subject)
+
+		return ev
+	case events.OnCallChanged:
+		subjects := make([]string, len(ev.Subjects))
+		for i, id := range ev.Subjects {
+			subjects[i] = p.ID(id)
+		}
+
+		ev.Subjects = subjects
+
+		return ev
+	}
+
+	return ev
+}
@@ -0,0 +1,43 @@
+package publish
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaBatchTimeout bounds how long events wait to be batched. The writer's default of one second
+// would delay every event, since they are written one at a time.
+const kafkaBatchTimeout = 10 * time.Millisecond
+
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func newKafkaSink(cfg KafkaConfig) *kafkaSink {
+	return &kafkaSink{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			BatchTimeout: kafkaBatchTimeout,
+		},
+	}
+}
+
+func (s *kafkaSink) name() string {
+	return "kafka"
+}
+
+// publish writes the event keyed by its kind, so events of the same kind stay ordered.
+func (s *kafkaSink) publish(ctx context.Context, kind string, data []byte) error {
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(kind),
+		Value: data,
+	})
+}
+
+func (s *kafkaSink) close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,47 @@
+package publish
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+)
+
+type natsSink struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+// newNATSSink connects to NATS. Ephemeral environments may start before NATS is reachable, so the
+// connection is retried in the background rather than failing startup.
+func newNATSSink(cfg NATSConfig) (*natsSink, error) {
+	conn, err := nats.Connect(cfg.URL,
+		nats.Name("iam-runtime-static"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &natsSink{
+		conn:   conn,
+		prefix: cfg.SubjectPrefix,
+	}, nil
+}
+
+func (s *natsSink) name() string {
+	return "nats"
+}
+
+func (s *natsSink) publish(_ context.Context, kind string, data []byte) error {
+	subject := kind
+	if s.prefix != "" {
+		subject = s.prefix + "." + kind
+	}
+
+	return s.conn.Publish(subject, data)
+}
+
+func (s *natsSink) close() error {
+	return s.conn.Drain()
+}
@@ -0,0 +1,203 @@
+// Package publish forwards events from the event bus to NATS subjects or Kafka topics, so
+// authorization telemetry from many environments can be aggregated centrally.
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/internal/metrics"
+	"github.com/metal-toolbox/iam-runtime-static/internal/pseudonym"
+
+	"go.uber.org/zap"
+)
+
+// DefaultBufferSize is the number of events queued for publishing before new events are dropped.
+const DefaultBufferSize = 1024
+
+// ErrNoSinks is returned by New when neither NATS nor Kafka is configured.
+var ErrNoSinks = errors.New("no event sinks configured")
+
+// Config configures event publishing.
+type Config struct {
+	// Environment identifies this runtime in published events.
+	Environment string
+	// BufferSize is the number of events queued for publishing. If zero, DefaultBufferSize is used.
+	BufferSize int
+	// PseudonymizeKey, if set, replaces subject and resource IDs in published events with keyed
+	// HMAC pseudonyms.
+	PseudonymizeKey []byte
+
+	NATS  NATSConfig
+	Kafka KafkaConfig
+}
+
+// NATSConfig configures publishing to NATS. Publishing is disabled if URL is empty.
+type NATSConfig struct {
+	URL string
+	// SubjectPrefix is prepended to the event kind to form the subject, as prefix.kind.
+	SubjectPrefix string
+}
+
+// KafkaConfig configures publishing to Kafka. Publishing is disabled if Brokers is empty.
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+}
+
+// envelope is the JSON message published for each event.
+type envelope struct {
+	Kind        string       `json:"kind"`
+	Environment string       `json:"environment,omitempty"`
+	Event       events.Event `json:"event"`
+}
+
+type message struct {
+	kind string
+	data []byte
+}
+
+// sink publishes encoded events to a broker.
+type sink interface {
+	name() string
+	publish(ctx context.Context, kind string, data []byte) error
+	close() error
+}
+
+// Forwarder is an event bus subscriber publishing events to the configured sinks. Events are
+// queued and published in the background so the bus is never blocked on a broker.
+type Forwarder struct {
+	environment string
+	pseudonyms  *pseudonym.Pseudonymizer
+	sinks       []sink
+	queue       chan message
+	logger      *zap.SugaredLogger
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// New connects to the configured sinks and returns a Forwarder. Call Run to start publishing.
+func New(cfg Config, logger *zap.SugaredLogger) (*Forwarder, error) {
+	var sinks []sink
+
+	if cfg.NATS.URL != "" {
+		s, err := newNATSSink(cfg.NATS)
+		if err != nil {
+			return nil, err
+		}
+
+		sinks = append(sinks, s)
+	}
+
+	if len(cfg.Kafka.Brokers) > 0 {
+		sinks = append(sinks, newKafkaSink(cfg.Kafka))
+	}
+
+	if len(sinks) == 0 {
+		return nil, ErrNoSinks
+	}
+
+	size := cfg.BufferSize
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+
+	var pseudonyms *pseudonym.Pseudonymizer
+	if len(cfg.PseudonymizeKey) > 0 {
+		pseudonyms = pseudonym.New(cfg.PseudonymizeKey)
+	}
+
+	return &Forwarder{
+		environment: cfg.Environment,
+		pseudonyms:  pseudonyms,
+		sinks:       sinks,
+		queue:       make(chan message, size),
+		logger:      logger,
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// Handle queues ev for publishing. It implements events.Handler. If the queue is full, the event
+// is dropped.
+func (f *Forwarder) Handle(ev events.Event) {
+	if f.pseudonyms != nil {
+		ev = f.pseudonyms.Event(ev)
+	}
+
+	data, err := json.Marshal(envelope{
+		Kind:        ev.Kind(),
+		Environment: f.environment,
+		Event:       ev,
+	})
+	if err != nil {
+		f.logger.Warnw("failed to encode event", "error", err, "kind", ev.Kind())
+
+		return
+	}
+
+	select {
+	case f.queue <- message{kind: ev.Kind(), data: data}:
+	default:
+		metrics.RecordEventPublish("", metrics.PublishResultDropped)
+	}
+}
+
+// Run publishes queued events until ctx is canceled or Close is called.
+func (f *Forwarder) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-f.done:
+			return
+		case msg := <-f.queue:
+			f.publish(ctx, msg)
+		}
+	}
+}
+
+// Close publishes any queued events, waiting up to timeout, and disconnects from the sinks.
+func (f *Forwarder) Close(timeout time.Duration) error {
+	f.closeOnce.Do(func() { close(f.done) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+drain:
+	for {
+		select {
+		case msg := <-f.queue:
+			f.publish(ctx, msg)
+		default:
+			break drain
+		}
+	}
+
+	var errs []error
+
+	for _, s := range f.sinks {
+		if err := s.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (f *Forwarder) publish(ctx context.Context, msg message) {
+	for _, s := range f.sinks {
+		if err := s.publish(ctx, msg.kind, msg.data); err != nil {
+			f.logger.Warnw("failed to publish event", "error", err, "sink", s.name(), "kind", msg.kind)
+			metrics.RecordEventPublish(s.name(), metrics.PublishResultFailed)
+
+			continue
+		}
+
+		metrics.RecordEventPublish(s.name(), metrics.PublishResultPublished)
+	}
+}
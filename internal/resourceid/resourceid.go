@@ -0,0 +1,104 @@
+// Package resourceid normalizes resource IDs, so that a policy and the services checking access
+// against it agree on a resource even when they write its ID differently, such as in another case
+// or as part of a URL.
+package resourceid
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Normalizers.
+const (
+	// Lowercase lowercases IDs.
+	Lowercase = "lowercase"
+	// StripURL replaces an absolute URL, such as https://api.example.com/loadbalancers/loadbal-abc,
+	// with the last segment of its path, loadbal-abc.
+	StripURL = "strip-url"
+	// UUID rewrites a UUID ending an ID, after any prefix ending in a separator, in its canonical
+	// form: lowercase and hyphenated, without braces or a urn:uuid: prefix.
+	UUID = "uuid"
+)
+
+// Normalizers lists the supported normalizers.
+var Normalizers = []string{Lowercase, StripURL, UUID}
+
+// ErrUnknownNormalizer is returned when a pipeline names a normalizer that does not exist.
+var ErrUnknownNormalizer = errors.New("unknown resource ID normalizer")
+
+// uuidPattern matches an ID ending in a UUID in any common representation. The prefix is empty or
+// ends in a character that cannot be part of the UUID.
+var uuidPattern = regexp.MustCompile(`^(|.*?[^0-9A-Za-z])(?i:urn:uuid:)?\{?([0-9A-Fa-f]{8})-?([0-9A-Fa-f]{4})-?([0-9A-Fa-f]{4})-?([0-9A-Fa-f]{4})-?([0-9A-Fa-f]{12})\}?$`)
+
+// Pipeline applies normalizers to resource IDs in order. The zero value leaves IDs unchanged.
+type Pipeline struct {
+	names []string
+}
+
+// New returns a pipeline applying the named normalizers, from Normalizers, in the given order.
+func New(names []string) (Pipeline, error) {
+	for _, name := range names {
+		switch name {
+		case Lowercase, StripURL, UUID:
+		default:
+			return Pipeline{}, fmt.Errorf("%w '%s': must be one of %s", ErrUnknownNormalizer, name, strings.Join(Normalizers, ", "))
+		}
+	}
+
+	return Pipeline{names: names}, nil
+}
+
+// Enabled reports whether the pipeline changes any IDs.
+func (p Pipeline) Enabled() bool {
+	return len(p.names) > 0
+}
+
+// Normalize returns the normalized form of id. Normalizing an ID twice gives the same result as
+// normalizing it once. IDs containing *, which are resource patterns, are only lowercased, since
+// the other normalizers could widen what they match.
+func (p Pipeline) Normalize(id string) string {
+	pattern := strings.Contains(id, "*")
+
+	for _, name := range p.names {
+		switch {
+		case name == Lowercase:
+			id = strings.ToLower(id)
+		case pattern:
+		case name == StripURL:
+			id = stripURL(id)
+		case name == UUID:
+			id = canonicalUUID(id)
+		}
+	}
+
+	return id
+}
+
+// stripURL returns the last segment of the path of id if it is an absolute URL with a path, or id.
+func stripURL(id string) string {
+	u, err := url.Parse(id)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return id
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if last := segments[len(segments)-1]; last != "" {
+		return last
+	}
+
+	return id
+}
+
+// canonicalUUID returns id with the UUID ending it in canonical form, or id if it does not end in
+// one.
+func canonicalUUID(id string) string {
+	m := uuidPattern.FindStringSubmatch(id)
+	if m == nil {
+		return id
+	}
+
+	return m[1] + strings.ToLower(strings.Join(m[2:], "-"))
+}
@@ -0,0 +1,169 @@
+// Package rotation stores credentials rotated by subjects: the credentials issued in place of
+// policy tokens, and the replaced credentials still accepted during a grace period. Only SHA-256
+// digests of credentials are stored, so the store file does not reveal them.
+package rotation
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// credentialBytes is the number of random bytes in a rotated credential.
+const credentialBytes = 32
+
+// ErrRetired is returned when rotating a credential that has already been replaced.
+var ErrRetired = errors.New("credential has already been rotated")
+
+// Record is a stored credential.
+type Record struct {
+	// Subject is the ID of the policy subject the credential authenticates.
+	Subject string `json:"subject"`
+	// Static reports whether the credential is a token from the policy rather than one issued by
+	// rotation.
+	Static bool `json:"static,omitempty"`
+	// ExpiresAt is when a replaced credential stops being accepted. It is nil for a subject's
+	// current credential.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Expired reports whether a replaced credential is no longer accepted at now.
+func (r Record) Expired(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(*r.ExpiresAt)
+}
+
+// Store holds rotated credentials, keyed by digest. It is safe for concurrent use.
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// Open returns a store, reading the records in the file at path if it exists. If path is empty,
+// records are kept in memory only and are lost when the runtime restarts.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		records: make(map[string]Record),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return s, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &s.records); err != nil {
+		return nil, fmt.Errorf("reading rotated credentials %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// Lookup returns the record for a credential, whether or not it has expired.
+func (s *Store) Lookup(credential string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[digest(credential)]
+
+	return rec, ok
+}
+
+// Records returns the records of the subject's credentials, keyed by the hex-encoded SHA-256
+// digest of the credential, whether or not they have expired.
+func (s *Store) Records(subjectID string) map[string]Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]Record)
+
+	for d, rec := range s.records {
+		if rec.Subject == subjectID {
+			out[d] = rec
+		}
+	}
+
+	return out
+}
+
+// Rotate issues a new credential for the subject, starting with prefix, and replaces credential,
+// which is then accepted until expiresAt. static reports whether credential is a token from the
+// policy. It returns ErrRetired if credential was already replaced. Expired records of issued
+// credentials are dropped; those of policy tokens are kept, so the tokens stay rejected.
+func (s *Store) Rotate(subjectID, credential string, static bool, prefix string, expiresAt time.Time) (string, error) {
+	b := make([]byte, credentialBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	issued := prefix + base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := digest(credential)
+	if rec, ok := s.records[old]; ok && rec.ExpiresAt != nil {
+		return "", ErrRetired
+	}
+
+	next := make(map[string]Record, len(s.records)+2)
+
+	for d, rec := range s.records {
+		if !rec.Static && rec.Expired(now) {
+			continue
+		}
+
+		next[d] = rec
+	}
+
+	next[old] = Record{Subject: subjectID, Static: static, ExpiresAt: &expiresAt}
+	next[digest(issued)] = Record{Subject: subjectID}
+
+	if s.path != "" {
+		if err := store(s.path, next); err != nil {
+			return "", err
+		}
+	}
+
+	s.records = next
+
+	return issued, nil
+}
+
+// store replaces the file at path atomically.
+func store(path string, records map[string]Record) error {
+	b, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func digest(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+
+	return hex.EncodeToString(sum[:])
+}
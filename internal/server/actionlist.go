@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
+
+// checkActionList returns an error if req names no actions and such checks are not allowed, or
+// names an action on a resource more than once and such checks are rejected. Duplicates are
+// reported with a BadRequest detail with a violation for each repeated action, whose field is the
+// repeat's index.
+func (s *server) checkActionList(subjectID string, req *authorization.CheckAccessRequest) error {
+	if len(req.Actions) == 0 {
+		if s.emptyActionsCode == codes.OK {
+			return nil
+		}
+
+		s.logger.Warnw("rejected access check naming no actions", "subject", subjectID)
+
+		return s.deny(s.emptyActionsCode, reasonNoActions, "subject", subjectID)
+	}
+
+	if !s.rejectDuplicateActions {
+		return nil
+	}
+
+	type key struct{ action, resourceID string }
+
+	first := make(map[key]int, len(req.Actions))
+
+	var (
+		violations []*errdetails.BadRequest_FieldViolation
+		duplicates []string
+	)
+
+	for i, action := range req.Actions {
+		k := key{action.Action, action.ResourceId}
+
+		j, seen := first[k]
+		if !seen {
+			first[k] = i
+
+			continue
+		}
+
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       fmt.Sprintf("actions[%d]", i),
+			Description: fmt.Sprintf("duplicates actions[%d]", j),
+		})
+
+		pair := fmt.Sprintf("'%s' on '%s'", action.Action, action.ResourceId)
+		if !containsString(duplicates, pair) {
+			duplicates = append(duplicates, pair)
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	s.logger.Warnw("rejected access check naming actions more than once", "subject", subjectID, "duplicates", duplicates)
+
+	stat := s.denial(codes.InvalidArgument, reasonDuplicateActions, "duplicates", strings.Join(duplicates, ", "))
+
+	withDetails, err := stat.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return stat.Err()
+	}
+
+	return withDetails.Err()
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// actionListPolicy grants alice lb_get on lb-a only.
+var actionListPolicy = policy{Subjects: []policySubject{
+	testSubject("alice", policyResource{ID: "lb-a", Actions: []string{"lb_get"}}),
+}}
+
+// errorReason returns the denial reason of err, or an empty string if it has none.
+func errorReason(err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+
+	return ""
+}
+
+func TestCheckAccessEmptyActions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		code codes.Code
+	}{
+		{name: "allow by default", code: codes.OK},
+		{name: "allow", opts: []Option{WithEmptyActions(codes.OK)}, code: codes.OK},
+		{name: "deny", opts: []Option{WithEmptyActions(codes.PermissionDenied)}, code: codes.PermissionDenied},
+		{name: "invalid", opts: []Option{WithEmptyActions(codes.InvalidArgument)}, code: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, actionListPolicy, tt.opts...)
+
+			err := checkTestAccess(s, "alice")
+
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("got code %s, want %s: %v", code, tt.code, err)
+			}
+
+			if tt.code != codes.OK {
+				if reason := errorReason(err); reason != reasonNoActions {
+					t.Errorf("got reason %q, want %q", reason, reasonNoActions)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckAccessDuplicateActions(t *testing.T) {
+	granted := &authorization.AccessRequestAction{Action: "lb_get", ResourceId: "lb-a"}
+	denied := &authorization.AccessRequestAction{Action: "lb_delete", ResourceId: "lb-a"}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		actions []*authorization.AccessRequestAction
+		code    codes.Code
+		// Fields of the BadRequest violations, for rejected checks
+		fields []string
+	}{
+		{
+			name:    "evaluate granted duplicates",
+			actions: []*authorization.AccessRequestAction{granted, granted},
+			code:    codes.OK,
+		},
+		{
+			name:    "evaluate denied duplicates",
+			actions: []*authorization.AccessRequestAction{granted, denied, denied},
+			code:    codes.PermissionDenied,
+		},
+		{
+			name:    "reject granted duplicates",
+			opts:    []Option{WithDuplicateActionsRejected()},
+			actions: []*authorization.AccessRequestAction{granted, granted},
+			code:    codes.InvalidArgument,
+			fields:  []string{"actions[1]"},
+		},
+		{
+			name:    "reject each repeat",
+			opts:    []Option{WithDuplicateActionsRejected()},
+			actions: []*authorization.AccessRequestAction{granted, denied, granted, denied, granted},
+			code:    codes.InvalidArgument,
+			fields:  []string{"actions[2]", "actions[3]", "actions[4]"},
+		},
+		{
+			name:    "reject allows distinct actions",
+			opts:    []Option{WithDuplicateActionsRejected()},
+			actions: []*authorization.AccessRequestAction{granted, {Action: "lb_get", ResourceId: "lb-b"}},
+			code:    codes.PermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, actionListPolicy, tt.opts...)
+
+			err := checkTestAccess(s, "alice", tt.actions...)
+
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("got code %s, want %s: %v", code, tt.code, err)
+			}
+
+			if tt.code != codes.InvalidArgument {
+				return
+			}
+
+			if reason := errorReason(err); reason != reasonDuplicateActions {
+				t.Errorf("got reason %q, want %q", reason, reasonDuplicateActions)
+			}
+
+			var fields []string
+
+			for _, d := range status.Convert(err).Details() {
+				if bad, ok := d.(*errdetails.BadRequest); ok {
+					for _, v := range bad.FieldViolations {
+						fields = append(fields, v.Field)
+					}
+				}
+			}
+
+			if len(fields) != len(tt.fields) {
+				t.Fatalf("got violations %v, want %v", fields, tt.fields)
+			}
+
+			for i := range fields {
+				if fields[i] != tt.fields[i] {
+					t.Errorf("got violations %v, want %v", fields, tt.fields)
+				}
+			}
+		})
+	}
+}
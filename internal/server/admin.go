@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *server) GetConfig(_ context.Context, _ *admin.GetConfigRequest) (*admin.GetConfigResponse, error) {
+	s.logger.Info("received GetConfig request")
+
+	cfg, err := structpb.NewStruct(s.config)
+	if err != nil {
+		s.logger.Errorw("failed to encode configuration", "error", err)
+
+		return nil, status.Errorf(codes.Internal, "failed to encode configuration")
+	}
+
+	return &admin.GetConfigResponse{Config: cfg}, nil
+}
+
+func (s *server) GetStats(_ context.Context, req *admin.GetStatsRequest) (*admin.GetStatsResponse, error) {
+	snap := s.stats.snapshot(int(req.MaxRecentDecisions))
+	info := s.PolicyInfo()
+
+	resp := &admin.GetStatsResponse{
+		PolicySource:    info.Source,
+		PolicyRevision:  info.Revision,
+		StartedAt:       timestamppb.New(snap.startedAt),
+		Allowed:         snap.allowed,
+		Denied:          snap.denied,
+		DeniedBySubject: snap.deniedBySubject,
+	}
+
+	for _, d := range snap.recent {
+		resp.RecentDecisions = append(resp.RecentDecisions, &admin.Decision{
+			Subject:    d.Subject,
+			Actor:      d.Actor,
+			Action:     d.Action,
+			ResourceId: d.ResourceID,
+			Allowed:    d.Allowed,
+			Time:       timestamppb.New(d.Time),
+		})
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Analysis checks.
+const (
+	// CheckPolicySource flags subjects that may act on where the policy is stored, and so can
+	// change their own grants.
+	CheckPolicySource = "policy-source"
+	// CheckAdminWildcard flags subjects with admin access that also hold wildcard grants.
+	CheckAdminWildcard = "admin-wildcard"
+	// CheckDelegationCycle flags subjects that may act on behalf of each other.
+	CheckDelegationCycle = "delegation-cycle"
+)
+
+// AnalyzeOptions describe the parts of a deployment that a policy cannot describe itself.
+type AnalyzeOptions struct {
+	// PolicyResources are resource IDs or patterns standing for where the policy is stored, such
+	// as the git repository it is synced from.
+	PolicyResources []string
+	// AdminActions are actions or patterns that give access to the admin API, such as through a
+	// gateway that checks them.
+	AdminActions []string
+}
+
+// Finding is a privilege-escalation path found in a policy.
+type Finding struct {
+	Check string `json:"check"`
+	// Subjects are the subjects involved, sorted.
+	Subjects []string `json:"subjects"`
+	Message  string   `json:"message"`
+}
+
+// String formats the finding as check: message.
+func (f Finding) String() string {
+	return f.Check + ": " + f.Message
+}
+
+// Analyze reads the policy at policyPath, applies any overlays, and returns the
+// privilege-escalation paths found in it, sorted by check and subjects. Grants are considered
+// whether or not they have expired. Files are read with read, or only plaintext policies are
+// accepted if read is nil.
+func Analyze(policyPath string, overlayPaths []string, read ReadFileFunc, opts AnalyzeOptions) ([]Finding, error) {
+	p, err := readPolicyFiles(readerOrDefault(read), policyPath, overlayPaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled, err := compileSubjects(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Finding
+
+	out = append(out, policySourceFindings(compiled, opts.PolicyResources)...)
+	out = append(out, adminWildcardFindings(compiled, opts.AdminActions)...)
+	out = append(out, delegationCycleFindings(compiled)...)
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Check != out[j].Check {
+			return out[i].Check < out[j].Check
+		}
+
+		return strings.Join(out[i].Subjects, ",") < strings.Join(out[j].Subjects, ",")
+	})
+
+	return out, nil
+}
+
+// effectiveEntries returns the resource entries of a compiled subject that checkAccess uses.
+func effectiveEntries(sub policySubject) []policyResource {
+	last := make(map[string]int, len(sub.Resources))
+	for i, res := range sub.Resources {
+		last[res.ID] = i
+	}
+
+	out := make([]policyResource, 0, len(last))
+
+	for i, res := range sub.Resources {
+		if last[res.ID] == i {
+			out = append(out, res)
+		}
+	}
+
+	return out
+}
+
+// overlaps reports whether two resource IDs or actions, either of which may be a pattern, can
+// name the same thing. Patterns are compared by matching one against the other as written, which
+// catches the broad patterns worth flagging.
+func overlaps(a, b string) bool {
+	return a == b || (isPattern(a) && matchPattern(a, b)) || (isPattern(b) && matchPattern(b, a))
+}
+
+// policySourceFindings flags subjects granted actions on a policy resource, and the subjects that
+// may perform those actions on their behalf.
+func policySourceFindings(compiled []policySubject, policyResources []string) []Finding {
+	if len(policyResources) == 0 {
+		return nil
+	}
+
+	// Map from subject IDs to the actions they may perform on policy resources
+	writers := make(map[string][]string)
+
+	var out []Finding
+
+	for _, sub := range compiled {
+		var grants, actions []string
+
+		for _, res := range effectiveEntries(sub) {
+			if !overlapsAny(policyResources, res.ID) {
+				continue
+			}
+
+			actions = append(actions, res.Actions...)
+			grants = append(grants, fmt.Sprintf("%s on %s", strings.Join(sortedUnique(res.Actions), ", "), res.ID))
+		}
+
+		if len(grants) == 0 {
+			continue
+		}
+
+		writers[sub.ID] = sortedUnique(actions)
+
+		out = append(out, Finding{
+			Check:    CheckPolicySource,
+			Subjects: []string{sub.ID},
+			Message:  fmt.Sprintf("subject %s may perform %s, which holds the policy, so it can change its own grants", sub.ID, strings.Join(grants, "; ")),
+		})
+	}
+
+	for _, sub := range compiled {
+		for _, del := range sub.Delegations {
+			actions, ok := writers[del.Subject]
+			if !ok {
+				continue
+			}
+
+			var delegated []string
+
+			for _, action := range actions {
+				if overlapsAny(del.Actions, action) {
+					delegated = append(delegated, action)
+				}
+			}
+
+			if len(delegated) == 0 {
+				continue
+			}
+
+			out = append(out, Finding{
+				Check:    CheckPolicySource,
+				Subjects: sortedUnique([]string{sub.ID, del.Subject}),
+				Message:  fmt.Sprintf("subject %s may perform %s on behalf of %s, which can change the policy", sub.ID, strings.Join(delegated, ", "), del.Subject),
+			})
+		}
+	}
+
+	return out
+}
+
+// adminWildcardFindings flags subjects granted an admin action that also hold a grant whose
+// resource ID or action is a pattern.
+func adminWildcardFindings(compiled []policySubject, adminActions []string) []Finding {
+	if len(adminActions) == 0 {
+		return nil
+	}
+
+	var out []Finding
+
+	for _, sub := range compiled {
+		var admin, wildcards []string
+
+		for _, res := range effectiveEntries(sub) {
+			for _, action := range sortedUnique(res.Actions) {
+				if overlapsAny(adminActions, action) {
+					admin = append(admin, fmt.Sprintf("%s on %s", action, res.ID))
+				}
+
+				if isPattern(res.ID) || isPattern(action) {
+					wildcards = append(wildcards, fmt.Sprintf("%s on %s", action, res.ID))
+				}
+			}
+		}
+
+		if len(admin) == 0 || len(wildcards) == 0 {
+			continue
+		}
+
+		out = append(out, Finding{
+			Check:    CheckAdminWildcard,
+			Subjects: []string{sub.ID},
+			Message:  fmt.Sprintf("subject %s has admin access (%s) and wildcard grants (%s)", sub.ID, strings.Join(admin, "; "), strings.Join(wildcards, "; ")),
+		})
+	}
+
+	return out
+}
+
+// delegationCycleFindings flags each set of subjects that may act on behalf of each other,
+// directly or through a chain of delegations, once.
+func delegationCycleFindings(compiled []policySubject) []Finding {
+	delegates := make(map[string][]string)
+
+	for _, sub := range compiled {
+		for _, del := range sub.Delegations {
+			delegates[sub.ID] = append(delegates[sub.ID], del.Subject)
+		}
+	}
+
+	reachable := transitiveClosure(delegates)
+	seen := make(map[string]bool)
+
+	var out []Finding
+
+	for _, id := range sortedKeys(delegates) {
+		// Subjects cannot delegate to themselves, so a cycle is a subject reachable from the
+		// subjects it reaches.
+		members := []string{id}
+
+		for _, other := range reachable[id] {
+			if containsString(reachable[other], id) {
+				members = append(members, other)
+			}
+		}
+
+		if len(members) == 1 {
+			continue
+		}
+
+		members = sortedUnique(members)
+
+		key := strings.Join(members, ",")
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+
+		out = append(out, Finding{
+			Check:    CheckDelegationCycle,
+			Subjects: members,
+			Message:  fmt.Sprintf("subjects %s may act on behalf of each other, so each holds the others' grants", strings.Join(members, ", ")),
+		})
+	}
+
+	return out
+}
+
+func overlapsAny(values []string, v string) bool {
+	for _, candidate := range values {
+		if overlaps(candidate, v) {
+			return true
+		}
+	}
+
+	return false
+}
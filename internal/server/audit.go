@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/auditlog"
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// auditBatchSize is the number of records read from the audit log at a time while streaming.
+const auditBatchSize = 100
+
+const (
+	// defaultAuditPageSize is the number of records QueryAudit returns if the page size is not set.
+	defaultAuditPageSize = 100
+	// maxAuditPageSize is the most records QueryAudit returns.
+	maxAuditPageSize = 1000
+)
+
+func (s *server) TailAudit(req *admin.TailAuditRequest, stream admin.Admin_TailAuditServer) error {
+	s.logger.Infow("received TailAudit request", "consumer", req.Consumer, "cursor", req.Cursor, "follow", req.Follow)
+
+	if s.audit == nil {
+		return status.Errorf(codes.FailedPrecondition, "the audit log is not enabled")
+	}
+
+	after := req.Cursor
+	if after == 0 && req.Consumer != "" {
+		after = s.audit.Acked(req.Consumer)
+	}
+
+	ctx := stream.Context()
+
+	for {
+		records, appended, err := s.audit.Read(after, auditBatchSize)
+		if err != nil {
+			if errors.Is(err, auditlog.ErrCursorExpired) {
+				return status.Errorf(codes.OutOfRange, "%s", err)
+			}
+
+			return status.Errorf(codes.Internal, "reading audit log: %s", err)
+		}
+
+		for _, rec := range records {
+			msg, err := auditRecord(rec)
+			if err != nil {
+				s.logger.Errorw("failed to encode audit record", "cursor", rec.Cursor, "error", err)
+
+				return status.Errorf(codes.Internal, "failed to encode audit record %d", rec.Cursor)
+			}
+
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+
+			after = rec.Cursor
+		}
+
+		if len(records) == auditBatchSize {
+			continue
+		}
+
+		if !req.Follow {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-appended:
+		}
+	}
+}
+
+func (s *server) AckAudit(_ context.Context, req *admin.AckAuditRequest) (*admin.AckAuditResponse, error) {
+	if s.audit == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "the audit log is not enabled")
+	}
+
+	cursor, err := s.audit.Ack(req.Consumer, req.Cursor)
+	switch {
+	case errors.Is(err, auditlog.ErrNoConsumer), errors.Is(err, auditlog.ErrCursorAhead):
+		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+	case err != nil:
+		s.logger.Errorw("failed to store audit acknowledgment", "consumer", req.Consumer, "cursor", req.Cursor, "error", err)
+
+		return nil, status.Errorf(codes.Internal, "failed to store acknowledgment")
+	}
+
+	return &admin.AckAuditResponse{Cursor: cursor}, nil
+}
+
+func (s *server) QueryAudit(_ context.Context, req *admin.QueryAuditRequest) (*admin.QueryAuditResponse, error) {
+	if s.audit == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "the audit log is not enabled")
+	}
+
+	var after uint64
+
+	if req.PageToken != "" {
+		cursor, err := strconv.ParseUint(req.PageToken, 10, 64)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid page token")
+		}
+
+		after = cursor
+	}
+
+	size := int(req.PageSize)
+	switch {
+	case size <= 0:
+		size = defaultAuditPageSize
+	case size > maxAuditPageSize:
+		size = maxAuditPageSize
+	}
+
+	records, more := s.audit.Query(after, size, auditFilter(req))
+
+	resp := &admin.QueryAuditResponse{
+		Records: make([]*admin.AuditRecord, 0, len(records)),
+	}
+
+	for _, rec := range records {
+		msg, err := auditRecord(rec)
+		if err != nil {
+			s.logger.Errorw("failed to encode audit record", "cursor", rec.Cursor, "error", err)
+
+			return nil, status.Errorf(codes.Internal, "failed to encode audit record %d", rec.Cursor)
+		}
+
+		resp.Records = append(resp.Records, msg)
+	}
+
+	if more {
+		resp.NextPageToken = strconv.FormatUint(records[len(records)-1].Cursor, 10)
+	}
+
+	return resp, nil
+}
+
+// auditFilter returns a function reporting whether a record matches the query. Records of other
+// kinds never match the decision filters.
+func auditFilter(req *admin.QueryAuditRequest) func(auditlog.Record) bool {
+	decisions := req.Subject != "" || req.Action != "" || req.ResourceId != "" ||
+		req.Decision != admin.DecisionOutcome_DECISION_OUTCOME_UNSPECIFIED
+
+	return func(rec auditlog.Record) bool {
+		if req.Kind != "" && rec.Kind != req.Kind {
+			return false
+		}
+
+		if req.Since != nil && rec.Time.Before(req.Since.AsTime()) {
+			return false
+		}
+
+		if req.Until != nil && !rec.Time.Before(req.Until.AsTime()) {
+			return false
+		}
+
+		if !decisions {
+			return true
+		}
+
+		if rec.Kind != events.KindDecisionMade {
+			return false
+		}
+
+		var ev events.DecisionMade
+		if err := json.Unmarshal(rec.Event, &ev); err != nil {
+			return false
+		}
+
+		switch {
+		case req.Subject != "" && ev.Subject != req.Subject && ev.Actor != req.Subject:
+			return false
+		case req.Action != "" && ev.Action != req.Action:
+			return false
+		case req.ResourceId != "" && ev.ResourceID != req.ResourceId:
+			return false
+		case req.Decision == admin.DecisionOutcome_DECISION_OUTCOME_ALLOWED && !ev.Allowed:
+			return false
+		case req.Decision == admin.DecisionOutcome_DECISION_OUTCOME_DENIED && ev.Allowed:
+			return false
+		}
+
+		return true
+	}
+}
+
+func auditRecord(rec auditlog.Record) (*admin.AuditRecord, error) {
+	var fields map[string]any
+	if err := json.Unmarshal(rec.Event, &fields); err != nil {
+		return nil, err
+	}
+
+	ev, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return &admin.AuditRecord{
+		Cursor: rec.Cursor,
+		Kind:   rec.Kind,
+		Time:   timestamppb.New(rec.Time),
+		Event:  ev,
+	}, nil
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Decision is an authorization backend's answer to whether a subject may perform an action.
+type Decision int
+
+// Backend decisions.
+const (
+	// Abstain means the backend has no opinion, leaving the decision to other backends.
+	Abstain Decision = iota
+	Allow
+	Deny
+)
+
+// String returns the name of the decision, as recorded in decision events.
+func (d Decision) String() string {
+	switch d {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	default:
+		return "abstain"
+	}
+}
+
+// Combinator is how the decisions of several authorization backends are combined into the answer
+// to an access check. Backends are consulted in order, and only until the answer is known.
+type Combinator int
+
+// Combinators.
+const (
+	// Priority takes the decision of the first backend that allows or denies the action. Backends
+	// that abstain fall through to the next. Actions no backend decides are denied.
+	Priority Combinator = iota
+	// FirstAllow allows actions any backend allows, even if an earlier backend denies them.
+	FirstAllow
+	// AllMustAllow allows only actions every backend allows. A backend that abstains denies them.
+	AllMustAllow
+)
+
+// Backend names.
+const (
+	BackendPolicy        = "policy"
+	BackendRelationships = "relationships"
+	BackendUpstream      = "upstream"
+)
+
+// defaultUpstreamTimeout bounds checks forwarded by the upstream backend without a timeout.
+const defaultUpstreamTimeout = 5 * time.Second
+
+// Backend decides access checks, alone or combined with other backends by WithAuthorizationBackends.
+type Backend interface {
+	// Name identifies the backend in decision events, the audit log, traces, and denial hints.
+	Name() string
+
+	decide(ctx context.Context, s *server, c backendCheck) (Decision, []grantRef)
+}
+
+// backendCheck is an action of an access check, as decided by a backend.
+type backendCheck struct {
+	st  *policyState
+	sub policySubject
+	// Credential the check was made with, for backends forwarding it
+	credential string
+	action     string
+	resourceID string
+	now        time.Time
+}
+
+// PolicyBackend returns the backend deciding checks with the policy: its grants and denies on the
+// resource, on its type and parent, and conditional grants. It abstains on actions the policy
+// neither grants nor denies.
+func PolicyBackend() Backend {
+	return policyBackend{}
+}
+
+type policyBackend struct{}
+
+func (policyBackend) Name() string {
+	return BackendPolicy
+}
+
+func (policyBackend) decide(ctx context.Context, s *server, c backendCheck) (Decision, []grantRef) {
+	return s.decidePolicy(ctx, c.st, c.sub, c.action, c.resourceID, c.now)
+}
+
+// RelationshipsBackend returns the backend deciding checks with relationships: ownership grants,
+// and with the relationships feature flag, grants on related resources. It never denies an action.
+func RelationshipsBackend() Backend {
+	return relationshipsBackend{}
+}
+
+type relationshipsBackend struct{}
+
+func (relationshipsBackend) Name() string {
+	return BackendRelationships
+}
+
+func (relationshipsBackend) decide(ctx context.Context, s *server, c backendCheck) (Decision, []grantRef) {
+	return s.decideRelated(ctx, c.st, c.sub, c.action, c.resourceID, c.now)
+}
+
+// UpstreamBackend returns the backend forwarding each action to the runtime on conn, with the
+// check's credential and metadata, as credentials outside the credential namespace are. It allows
+// actions the runtime allows and denies actions it denies with PermissionDenied. It abstains if
+// the check fails otherwise, such as when the runtime does not know the credential, or does not
+// answer within timeout, or 5 seconds if timeout is zero.
+func UpstreamBackend(conn grpc.ClientConnInterface, timeout time.Duration) Backend {
+	if timeout <= 0 {
+		timeout = defaultUpstreamTimeout
+	}
+
+	return upstreamBackend{client: authorization.NewAuthorizationClient(conn), timeout: timeout}
+}
+
+type upstreamBackend struct {
+	client  authorization.AuthorizationClient
+	timeout time.Duration
+}
+
+func (upstreamBackend) Name() string {
+	return BackendUpstream
+}
+
+func (b upstreamBackend) decide(ctx context.Context, s *server, c backendCheck) (Decision, []grantRef) {
+	credential := s.requestCredential(ctx, c.credential)
+
+	ctx, cancel := context.WithTimeout(upstreamContext(ctx), b.timeout)
+	defer cancel()
+
+	_, err := b.client.CheckAccess(ctx, &authorization.CheckAccessRequest{
+		Credential: credential,
+		Actions:    []*authorization.AccessRequestAction{{Action: c.action, ResourceId: c.resourceID}},
+	})
+
+	switch status.Code(err) {
+	case codes.OK:
+		return Allow, nil
+	case codes.PermissionDenied:
+		return Deny, nil
+	default:
+		s.logger.Warnw("upstream backend failed to decide access check, abstaining",
+			"subject", c.sub.ID,
+			"action", c.action,
+			"resource_id", c.resourceID,
+			"error", err,
+		)
+
+		return Abstain, nil
+	}
+}
+
+// backendSet is the configured authorization backends and how their decisions are combined.
+type backendSet struct {
+	combinator Combinator
+	backends   []Backend
+}
+
+// decide combines the decisions of the backends on an action, and returns whether it is allowed,
+// the grants that allow it, and the decision of each backend consulted, in order.
+func (b *backendSet) decide(ctx context.Context, s *server, c backendCheck) (bool, []grantRef, []events.BackendDecision) {
+	results := make([]events.BackendDecision, 0, len(b.backends))
+
+	var matched []grantRef
+
+	for _, backend := range b.backends {
+		d, grants := backend.decide(ctx, s, c)
+		results = append(results, events.BackendDecision{Backend: backend.Name(), Decision: d.String()})
+
+		switch b.combinator {
+		case FirstAllow:
+			if d == Allow {
+				return true, grants, results
+			}
+		case AllMustAllow:
+			if d != Allow {
+				return false, nil, results
+			}
+
+			matched = appendGrants(matched, grants)
+		default:
+			if d != Abstain {
+				return d == Allow, grants, results
+			}
+		}
+	}
+
+	if b.combinator == AllMustAllow {
+		return len(b.backends) > 0, matched, results
+	}
+
+	return false, nil, results
+}
+
+// decide reports whether sub may perform action on the resource, and returns the grants that allow
+// it, as allows does. If authorization backends are configured, it combines their decisions
+// instead, and also returns the decision of each backend consulted. credential is the credential
+// the check was made with.
+func (s *server) decide(ctx context.Context, st *policyState, sub policySubject, credential, action, resourceID string, now time.Time) (bool, []grantRef, []events.BackendDecision) {
+	if s.backends == nil {
+		allowed, grants := s.allows(ctx, st, sub, action, resourceID, now)
+
+		return allowed, grants, nil
+	}
+
+	// The token's grant limits the subject whatever the backends decide.
+	if !inScope(sub, action, resourceID) {
+		return false, nil, nil
+	}
+
+	return s.backends.decide(ctx, s, backendCheck{
+		st:         st,
+		sub:        sub,
+		credential: credential,
+		action:     action,
+		resourceID: resourceID,
+		now:        now,
+	})
+}
+
+// addBackendsEvent adds an event to span with the backend decisions on an action, if backends are
+// configured. Each decision is recorded as backend=decision, in the order the backends were
+// consulted.
+func addBackendsEvent(span trace.Span, action *authorization.AccessRequestAction, backends []events.BackendDecision) {
+	if backends == nil || !span.IsRecording() {
+		return
+	}
+
+	span.AddEvent("backends decided", trace.WithAttributes(
+		attrAction.String(action.Action),
+		attrResourceID.String(action.ResourceId),
+		attrBackends.StringSlice(backendDecisionStrings(backends)),
+	))
+}
+
+// backendDecisionStrings formats backend decisions as backend=decision.
+func backendDecisionStrings(backends []events.BackendDecision) []string {
+	out := make([]string, 0, len(backends))
+
+	for _, b := range backends {
+		out = append(out, b.Backend+"="+b.Decision)
+	}
+
+	return out
+}
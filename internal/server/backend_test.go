@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+)
+
+// stubBackend decides every check the same way.
+type stubBackend struct {
+	name     string
+	decision Decision
+}
+
+func (b stubBackend) Name() string {
+	return b.name
+}
+
+func (b stubBackend) decide(context.Context, *server, backendCheck) (Decision, []grantRef) {
+	if b.decision == Allow {
+		return Allow, []grantRef{{ResourceID: b.name}}
+	}
+
+	return b.decision, nil
+}
+
+func TestBackendCombinators(t *testing.T) {
+	tests := []struct {
+		name       string
+		combinator Combinator
+		decisions  []Decision
+		allowed    bool
+		// consulted is the decision of each backend consulted, in order.
+		consulted []string
+	}{
+		{"priority allow", Priority, []Decision{Allow, Deny}, true, []string{"a=allow"}},
+		{"priority deny", Priority, []Decision{Deny, Allow}, false, []string{"a=deny"}},
+		{"priority abstain falls through", Priority, []Decision{Abstain, Allow}, true, []string{"a=abstain", "b=allow"}},
+		{"priority all abstain", Priority, []Decision{Abstain, Abstain}, false, []string{"a=abstain", "b=abstain"}},
+		{"first allow overrides deny", FirstAllow, []Decision{Deny, Allow}, true, []string{"a=deny", "b=allow"}},
+		{"first allow stops at allow", FirstAllow, []Decision{Allow, Deny}, true, []string{"a=allow"}},
+		{"first allow none allow", FirstAllow, []Decision{Deny, Abstain}, false, []string{"a=deny", "b=abstain"}},
+		{"all must allow", AllMustAllow, []Decision{Allow, Allow}, true, []string{"a=allow", "b=allow"}},
+		{"all must allow deny", AllMustAllow, []Decision{Allow, Deny, Allow}, false, []string{"a=allow", "b=deny"}},
+		{"all must allow abstain", AllMustAllow, []Decision{Abstain, Allow}, false, []string{"a=abstain"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			set := backendSet{combinator: tc.combinator}
+			for i, d := range tc.decisions {
+				set.backends = append(set.backends, stubBackend{name: string(rune('a' + i)), decision: d})
+			}
+
+			allowed, grants, backends := set.decide(context.Background(), nil, backendCheck{})
+
+			if allowed != tc.allowed {
+				t.Errorf("allowed is %t, want %t", allowed, tc.allowed)
+			}
+
+			if got := backendDecisionStrings(backends); !slices.Equal(got, tc.consulted) {
+				t.Errorf("consulted %q, want %q", got, tc.consulted)
+			}
+
+			if !allowed && grants != nil {
+				t.Errorf("denied action has grants %v", grants)
+			}
+		})
+	}
+}
+
+func TestBackendDecisionEvents(t *testing.T) {
+	p := policy{Subjects: []policySubject{
+		testSubject("alice", policyResource{ID: "lb-a", Actions: []string{"get"}}),
+	}}
+
+	bus := events.NewBus()
+
+	var decisions []events.DecisionMade
+
+	bus.Subscribe(func(ev events.Event) {
+		if d, ok := ev.(events.DecisionMade); ok {
+			decisions = append(decisions, d)
+		}
+	})
+
+	s := newTestServer(t, p, WithEventBus(bus), WithAuthorizationBackends(FirstAllow,
+		PolicyBackend(),
+		stubBackend{name: "stub", decision: Deny},
+	))
+
+	err := checkTestAccess(s, "alice",
+		&authorization.AccessRequestAction{Action: "get", ResourceId: "lb-a"},
+		&authorization.AccessRequestAction{Action: "update", ResourceId: "lb-a"},
+	)
+
+	denied, err := deniedActions(err)
+	if err != nil {
+		t.Fatalf("checking access: %s", err)
+	}
+
+	if !slices.Equal(mapKeys(denied), []int{1}) {
+		t.Errorf("denied actions %v, want [1]", denied)
+	}
+
+	want := [][]string{
+		{"policy=allow"},
+		{"policy=abstain", "stub=deny"},
+	}
+
+	if len(decisions) != len(want) {
+		t.Fatalf("published %d decisions, want %d", len(decisions), len(want))
+	}
+
+	for i, d := range decisions {
+		if got := backendDecisionStrings(d.Backends); !slices.Equal(got, want[i]) {
+			t.Errorf("decision %d backends are %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+// mapKeys returns the keys of a set of indexes, sorted.
+func mapKeys(set map[int]bool) []int {
+	out := make([]int, 0, len(set))
+	for i := range set {
+		out = append(out, i)
+	}
+
+	slices.Sort(out)
+
+	return out
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"google.golang.org/grpc/codes"
+)
+
+// Limits named by an exceeded evaluation budget. They match the check-access configuration keys.
+const (
+	budgetLimitRules = "max-rules"
+	budgetLimitDepth = "max-depth"
+)
+
+// evalBudget limits the work one access check may do, so a pathological policy or relationship
+// graph cannot stall the runtime. Zero limits are unlimited.
+type evalBudget struct {
+	// Most grant entries examined across the check's actions
+	maxRules int
+	// Most relationship hops followed from a checked resource
+	maxDepth int
+}
+
+func (b evalBudget) enabled() bool {
+	return b.maxRules > 0 || b.maxDepth > 0
+}
+
+// evaluation is the work done by an access check, counted against its budget. Its methods may
+// be called on a nil evaluation, for checks without a budget.
+type evaluation struct {
+	budget evalBudget
+	// The number of grant entries examined so far
+	rules int
+	// The limit exceeded, if any. The check's decisions are unknown once it is set
+	exceeded string
+}
+
+// evaluationKey is the context key of an access check's evaluation.
+type evaluationKey struct{}
+
+// startEvaluation returns a context carrying the evaluation of an access check, if the server has
+// an evaluation budget. The evaluation is nil otherwise.
+func (s *server) startEvaluation(ctx context.Context) (context.Context, *evaluation) {
+	if !s.budget.enabled() {
+		return ctx, nil
+	}
+
+	ev := &evaluation{budget: s.budget}
+
+	return context.WithValue(ctx, evaluationKey{}, ev), ev
+}
+
+// evaluationFrom returns the evaluation of the access check ctx belongs to, or nil.
+func evaluationFrom(ctx context.Context) *evaluation {
+	ev, _ := ctx.Value(evaluationKey{}).(*evaluation)
+
+	return ev
+}
+
+// examine counts n more grant entries examined. It reports false once the budget is exceeded.
+func (e *evaluation) examine(n int) bool {
+	if e == nil {
+		return true
+	}
+
+	if e.exceeded != "" {
+		return false
+	}
+
+	e.rules += n
+
+	if e.budget.maxRules > 0 && e.rules > e.budget.maxRules {
+		e.exceeded = budgetLimitRules
+
+		return false
+	}
+
+	return true
+}
+
+// maxDepth returns the most relationship hops to follow, or zero for no limit.
+func (e *evaluation) maxDepth() int {
+	if e == nil {
+		return 0
+	}
+
+	return e.budget.maxDepth
+}
+
+// exceedDepth records that relationships were not followed to the end.
+func (e *evaluation) exceedDepth() {
+	if e != nil && e.exceeded == "" {
+		e.exceeded = budgetLimitDepth
+	}
+}
+
+// exhausted reports whether the budget was exceeded.
+func (e *evaluation) exhausted() bool {
+	return e != nil && e.exceeded != ""
+}
+
+// grantCost returns the number of grant entries checkAccess examines for sub: the entry for the
+// resource and those whose resource ID is a pattern, or every entry if sub's grants are not
+// indexed.
+func grantCost(sub policySubject) int {
+	if sub.index == nil {
+		return len(sub.Resources)
+	}
+
+	return 1 + len(sub.index.patterns)
+}
+
+// budgetExceeded returns the error for an access check that exceeded its evaluation budget while
+// evaluating action. The check fails as a whole, since its decisions are unknown.
+func (s *server) budgetExceeded(ev *evaluation, subjectID string, action *authorization.AccessRequestAction) error {
+	max := ev.budget.maxRules
+	if ev.exceeded == budgetLimitDepth {
+		max = ev.budget.maxDepth
+	}
+
+	s.logger.Warnw("access check exceeded its evaluation budget",
+		"subject", subjectID,
+		"limit", ev.exceeded,
+		"max", max,
+		"rules_examined", ev.rules,
+		"action", action.Action,
+		"resource_id", action.ResourceId,
+	)
+
+	return s.deny(codes.ResourceExhausted, reasonBudgetExceeded,
+		"subject", subjectID,
+		"limit", ev.exceeded,
+		"max", strconv.Itoa(max),
+		"rules_examined", strconv.Itoa(ev.rules),
+		"action", action.Action,
+		"resource_id", action.ResourceId,
+	)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/capability"
+)
+
+// isCapability reports whether credential is a capability token, once any namespace prefix is
+// removed.
+func (s *server) isCapability(credential string) bool {
+	return s.capabilities != nil && capability.IsToken(strings.TrimPrefix(credential, s.namespace.prefix))
+}
+
+// authenticateCapability verifies a capability token and returns its subject from the policy,
+// limited to the token's grant.
+func (s *server) authenticateCapability(st *policyState, credential string) (policySubject, error) {
+	grant, err := s.capabilities.Verify(strings.TrimPrefix(credential, s.namespace.prefix), s.now())
+	if err != nil {
+		s.logger.Warnw("rejected capability token", "error", err, "expired", errors.Is(err, capability.ErrExpired))
+
+		return policySubject{}, s.invalidCredential(reasonCapabilityInvalid, "error", err.Error())
+	}
+
+	sub, ok := st.subjects[grant.Subject]
+	if !ok {
+		s.logger.Warnw("rejected capability token for a subject not in the policy", "subject", grant.Subject)
+
+		return policySubject{}, s.invalidCredential(reasonCapabilitySubjectUnknown, "subject", grant.Subject)
+	}
+
+	sub.scope = &grant
+
+	return sub, nil
+}
+
+// inScope reports whether sub may attempt action on the resource: whether it is not limited to a
+// capability token's grant, or the grant and each of the token's caveats cover both.
+func inScope(sub policySubject, action, resourceID string) bool {
+	if sub.scope == nil {
+		return true
+	}
+
+	if !scopeCovers(sub.scope.Actions, sub.scope.Resources, action, resourceID) {
+		return false
+	}
+
+	for _, c := range sub.scope.Caveats {
+		if !scopeCovers(c.Actions, c.Resources, action, resourceID) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// scopeCovers reports whether action and the resource match the given actions and resources. An
+// empty list matches anything.
+func scopeCovers(actions, resources []string, action, resourceID string) bool {
+	if len(actions) > 0 && !matchesAny(actions, action) {
+		return false
+	}
+
+	if len(resources) == 0 {
+		return true
+	}
+
+	for _, id := range resources {
+		if resourceMatches(id, resourceID) {
+			return true
+		}
+	}
+
+	return false
+}
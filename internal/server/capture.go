@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/client"
+)
+
+// CaptureClient is the part of a runtime client CapturePolicy calls. It is implemented by
+// client.Client, for any iam-runtime.
+type CaptureClient interface {
+	AuthenticateSubject(ctx context.Context, credential string) (map[string]string, error)
+	CheckAccess(ctx context.Context, credential string, actions ...client.Action) error
+}
+
+// CaptureOptions chooses what CapturePolicy captures.
+type CaptureOptions struct {
+	// Subjects name the environment variables holding the credentials of the captured subjects,
+	// optionally preceded by the subject's ID and =, as in ID=ENV_VAR. Without an ID, the subject
+	// is named by the sub claim the runtime returns. Captured subjects are authenticated by the
+	// same variables, so the policy never holds their credentials.
+	Subjects []string
+	// Resources are the resource IDs access is checked on.
+	Resources []string
+	// Actions are the actions checked on each resource.
+	Actions []string
+	// Getenv resolves the environment variables of Subjects.
+	Getenv func(key string) string
+}
+
+func (o CaptureOptions) validate() error {
+	switch {
+	case len(o.Subjects) == 0:
+		return fmt.Errorf("no subjects to capture: %w", ErrInvalidValue)
+	case len(o.Resources) == 0:
+		return fmt.Errorf("no resources to capture: %w", ErrInvalidValue)
+	case len(o.Actions) == 0:
+		return fmt.Errorf("no actions to capture: %w", ErrInvalidValue)
+	}
+
+	for _, id := range o.Resources {
+		if err := checkID("resource ID", id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CapturePolicy writes a policy replicating the decisions of a live runtime to w. Each subject is
+// authenticated with its credential, and granted the actions the runtime allows it on each
+// resource, so the static runtime answers the same for the captured subjects, resources, and
+// actions. The subject's claims, other than those the static runtime sets itself, are kept.
+func CapturePolicy(ctx context.Context, w io.Writer, c CaptureClient, opts CaptureOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	out := policy{}
+	seen := make(map[string]string, len(opts.Subjects))
+
+	for _, spec := range opts.Subjects {
+		sub, err := captureSubject(ctx, c, spec, opts)
+		if err != nil {
+			return err
+		}
+
+		if other, ok := seen[sub.ID]; ok {
+			return fmt.Errorf("%s: credentials of %s and %s belong to the same subject: %w", sub.ID, other, spec, ErrInvalidValue)
+		}
+
+		seen[sub.ID] = spec
+
+		out.Subjects = append(out.Subjects, sub)
+	}
+
+	return encodePolicy(w, out)
+}
+
+// captureSubject authenticates the subject whose credential spec names and checks its access.
+func captureSubject(ctx context.Context, c CaptureClient, spec string, opts CaptureOptions) (policySubject, error) {
+	id, envVar, named := strings.Cut(spec, "=")
+	if !named {
+		envVar = spec
+	}
+
+	if envVar == "" {
+		return policySubject{}, fmt.Errorf("%s: environment variable is empty: %w", spec, ErrInvalidValue)
+	}
+
+	credential := opts.Getenv(envVar)
+	if credential == "" {
+		return policySubject{}, fmt.Errorf("%s: %w", envVar, ErrMissingToken)
+	}
+
+	claims, err := c.AuthenticateSubject(ctx, credential)
+	if err != nil {
+		return policySubject{}, fmt.Errorf("%s: authenticating: %w", envVar, err)
+	}
+
+	if !named {
+		id = claims["sub"]
+
+		if err := checkID("subject ID", id); err != nil {
+			return policySubject{}, fmt.Errorf("%s: sub claim: %w; name the subject as ID=%s", envVar, err, envVar)
+		}
+	} else if err := checkID("subject ID", id); err != nil {
+		return policySubject{}, fmt.Errorf("%s: %w", spec, err)
+	}
+
+	sub := policySubject{
+		ID:     id,
+		Tokens: []policyToken{{EnvVar: envVar}},
+	}
+
+	for name, value := range claims {
+		if containsString(reservedPolicyClaims, name) {
+			continue
+		}
+
+		if sub.Claims == nil {
+			sub.Claims = make(map[string]any, len(claims))
+		}
+
+		sub.Claims[name] = value
+	}
+
+	for _, resourceID := range opts.Resources {
+		allowed, err := captureAccess(ctx, c, credential, resourceID, opts.Actions)
+		if err != nil {
+			return policySubject{}, fmt.Errorf("%s: %s: %w", id, resourceID, err)
+		}
+
+		if len(allowed) > 0 {
+			sub.Resources = append(sub.Resources, policyResource{ID: resourceID, Actions: allowed})
+		}
+	}
+
+	return sub, nil
+}
+
+// captureAccess returns the actions the runtime allows the credential's subject on the resource.
+// All actions are checked in one call; if the runtime denies some without saying which, as other
+// runtimes than this one may, each action is checked on its own.
+func captureAccess(ctx context.Context, c CaptureClient, credential, resourceID string, actions []string) ([]string, error) {
+	checked := make([]client.Action, len(actions))
+	for i, action := range actions {
+		checked[i] = client.Action{Action: action, ResourceID: resourceID}
+	}
+
+	err := c.CheckAccess(ctx, credential, checked...)
+	if err == nil {
+		return append([]string(nil), actions...), nil
+	}
+
+	var denial *client.Error
+	if !errors.As(err, &denial) || !errors.Is(err, client.ErrPermissionDenied) {
+		return nil, err
+	}
+
+	var allowed []string
+
+	if len(denial.Denied) > 0 {
+		denied := make(map[string]bool, len(denial.Denied))
+		for _, a := range denial.Denied {
+			denied[a.Action] = true
+		}
+
+		for _, action := range actions {
+			if !denied[action] {
+				allowed = append(allowed, action)
+			}
+		}
+
+		return allowed, nil
+	}
+
+	for _, a := range checked {
+		err := c.CheckAccess(ctx, credential, a)
+
+		switch {
+		case err == nil:
+			allowed = append(allowed, a.Action)
+		case errors.Is(err, client.ErrPermissionDenied):
+		default:
+			return nil, err
+		}
+	}
+
+	return allowed, nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// reservedPolicyClaims are set by the runtime and cannot be declared by policy subjects.
+var reservedPolicyClaims = []string{"sub", "act"}
+
+// validateClaims checks that every subject's claims have names that are not reserved and values
+// that can be returned as claims.
+func validateClaims(p policy) error {
+	for _, sub := range p.Subjects {
+		for _, name := range sortedKeys(sub.Claims) {
+			if name == "" {
+				return fmt.Errorf("%s: claims: claim name is empty: %w", sub.ID, ErrInvalidValue)
+			}
+
+			if containsString(reservedPolicyClaims, name) {
+				return fmt.Errorf("%s: claims: %s: claim is set by the runtime: %w", sub.ID, name, ErrInvalidValue)
+			}
+
+			if _, err := claimValue(sub.Claims[name]); err != nil {
+				return fmt.Errorf("%s: claims: %s: %w", sub.ID, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// subjectClaims returns the claims a subject declares, and its tenant if it is scoped to one, as
+// returned by AuthenticateSubject.
+func subjectClaims(sub policySubject) map[string]string {
+	out := make(map[string]string, len(sub.Claims)+1)
+
+	for name, v := range sub.Claims {
+		if s, err := claimValue(v); err == nil {
+			out[name] = s
+		}
+	}
+
+	if sub.Tenant != "" {
+		out[tenantClaim] = sub.Tenant
+	}
+
+	return out
+}
+
+// claimValue encodes a declared claim value. Strings are returned as they are, and other values,
+// such as lists and nested maps, as JSON, since claims are strings.
+func claimValue(v any) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("value cannot be encoded as JSON: %w", ErrInvalidValue)
+	}
+
+	return string(b), nil
+}
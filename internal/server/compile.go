@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// compiledHeader begins every compiled policy artifact and is followed by the digest of the
+// source policy.
+const compiledHeader = "# compiled policy, source sha256:"
+
+// Compile reads the policy at policyPath, applies any overlays, and writes a compiled artifact to
+// w: a policy with role grants, inherited grants, and implied actions expanded into each subject,
+// so it can be served without them. The artifact records the digest of its source and is
+// byte-for-byte identical for identical inputs, containing no timestamps or host details. Files
+// are read with read, or only plaintext policies are accepted if read is nil.
+func Compile(policyPath string, overlayPaths []string, w io.Writer, read ReadFileFunc) error {
+	p, err := readPolicyFiles(readerOrDefault(read), policyPath, overlayPaths...)
+	if err != nil {
+		return err
+	}
+
+	return compilePolicy(w, p)
+}
+
+// VerifyCompiled checks that artifact is exactly the artifact Compile produces for the policy at
+// policyPath with the given overlays, returning an error wrapping ErrArtifactMismatch if not.
+func VerifyCompiled(policyPath string, overlayPaths []string, artifact []byte, read ReadFileFunc) error {
+	p, err := readPolicyFiles(readerOrDefault(read), policyPath, overlayPaths...)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := compilePolicy(&buf, p); err != nil {
+		return err
+	}
+
+	if bytes.Equal(buf.Bytes(), artifact) {
+		return nil
+	}
+
+	return fmt.Errorf("line %d differs: %w", firstDifferingLine(buf.Bytes(), artifact), ErrArtifactMismatch)
+}
+
+func compilePolicy(w io.Writer, p policy) error {
+	// Expanded grants cannot carry the expiries of the grants they were merged from.
+	if expiring := grantsExpiring(p, time.Time{}, time.Time{}); len(expiring) > 0 {
+		g := expiring[0]
+
+		return fmt.Errorf("%s%s: %s: grants with expiresAt cannot be compiled: %w", g.Subject, g.Role, g.ResourceID, ErrInvalidValue)
+	}
+
+	// Expanded grants cannot open and close with on-call windows either.
+	if len(p.OnCall) > 0 {
+		return fmt.Errorf("on-call schedule %s: on-call schedules cannot be compiled: %w", p.OnCall[0].ID, ErrInvalidValue)
+	}
+
+	// Nor can they be evaluated for each check, as conditional grants are.
+	if owner, resourceID, ok := firstConditional(p); ok {
+		return fmt.Errorf("%s: %s: grants with conditions cannot be compiled: %w", owner, resourceID, ErrInvalidValue)
+	}
+
+	digest, err := policyDigest(p)
+	if err != nil {
+		return err
+	}
+
+	compiled, err := compileSubjects(p)
+	if err != nil {
+		return err
+	}
+
+	for i := range compiled {
+		compiled[i].Roles = nil
+
+		for j, res := range compiled[i].Resources {
+			ruleID, err := compiledRuleID(res)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %w", compiled[i].ID, res.ID, err)
+			}
+
+			compiled[i].Resources[j].RuleID = ruleID
+		}
+	}
+
+	// Validated by compileSubjects.
+	tenants, _ := resourceTenants(p)
+
+	// Containment is expanded into the grants, but still decides which tenant owns a resource.
+	out := canonicalPolicy(policy{
+		Tenants:        tenantResources(tenants),
+		Sensitive:      p.Sensitive,
+		Deprecated:     p.Deprecated,
+		StrictUnknowns: p.StrictUnknowns,
+		Identities:     p.Identities,
+		Subjects:       compiled,
+	})
+
+	if _, err := fmt.Fprintf(w, "%s%s\n", compiledHeader, digest); err != nil {
+		return err
+	}
+
+	return encodePolicy(w, out)
+}
+
+// compiledRuleID returns the single rule ID an expanded grant can carry in an artifact. Merged
+// grants whose actions come from different rules cannot be represented.
+func compiledRuleID(res policyResource) (string, error) {
+	var ruleID string
+
+	for i, action := range res.Actions {
+		ids := ruleIDs(res.rules[action])
+		if len(ids) > 1 {
+			return "", fmt.Errorf("%s: granted by rules %s: merged grants cannot be compiled: %w", action, strings.Join(ids, ", "), ErrInvalidValue)
+		}
+
+		var id string
+		if len(ids) == 1 {
+			id = ids[0]
+		}
+
+		if i > 0 && id != ruleID {
+			return "", fmt.Errorf("actions granted by different rules: merged grants cannot be compiled: %w", ErrInvalidValue)
+		}
+
+		ruleID = id
+	}
+
+	return ruleID, nil
+}
+
+// firstDifferingLine returns the 1-based number of the first line that differs between a and b.
+func firstDifferingLine(a, b []byte) int {
+	as := bufio.NewScanner(bytes.NewReader(a))
+	bs := bufio.NewScanner(bytes.NewReader(b))
+
+	line := 1
+
+	for {
+		aok, bok := as.Scan(), bs.Scan()
+		if !aok || !bok || as.Text() != bs.Text() {
+			return line
+		}
+
+		line++
+	}
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// grantConditions limit when a grant applies. Unlike expiries, they are evaluated for each access
+// check, against the time of the check and the request's metadata.
+type grantConditions struct {
+	// ValidAfter and ValidBefore, if set, bound when the grant applies.
+	ValidAfter  *time.Time `yaml:"validAfter,omitempty" json:"validAfter,omitempty"`
+	ValidBefore *time.Time `yaml:"validBefore,omitempty" json:"validBefore,omitempty"`
+	// Attributes map request metadata keys to the value each must have, or a pattern it must
+	// match.
+	Attributes map[string]string `yaml:"attributes,omitempty" json:"attributes,omitempty"`
+}
+
+// conditionalGrant is a grant with conditions, compiled for a subject. Conditional grants are kept
+// apart from the subject's other grants, so they add to them rather than replacing a grant on the
+// same resource.
+type conditionalGrant struct {
+	conditions *grantConditions
+	// grants holds the grant as a subject of its own, with the grants it gives on contained
+	// resources and implied actions.
+	grants policySubject
+}
+
+func (c *grantConditions) validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if c.ValidAfter == nil && c.ValidBefore == nil && len(c.Attributes) == 0 {
+		return fmt.Errorf("conditions are empty: %w", ErrMissingValue)
+	}
+
+	if c.ValidAfter != nil && c.ValidBefore != nil && !c.ValidAfter.Before(*c.ValidBefore) {
+		return fmt.Errorf("conditions: validAfter must be before validBefore: %w", ErrInvalidValue)
+	}
+
+	for key := range c.Attributes {
+		if key == "" || strings.ToLower(key) != key {
+			return fmt.Errorf("conditions: attribute '%s' must be a lowercase metadata key: %w", key, ErrInvalidValue)
+		}
+	}
+
+	return nil
+}
+
+// holds reports whether the conditions are met at now by a request with the given metadata. The
+// time bounds are widened by skew, as expiries are.
+func (c *grantConditions) holds(md metadata.MD, now time.Time, skew time.Duration) bool {
+	if c.ValidAfter != nil && now.Add(skew).Before(*c.ValidAfter) {
+		return false
+	}
+
+	if c.ValidBefore != nil && !now.Add(-skew).Before(*c.ValidBefore) {
+		return false
+	}
+
+	for key, want := range c.Attributes {
+		values := md.Get(key)
+		if len(values) == 0 || !matchesAny([]string{want}, values[0]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String describes the conditions in an explanation.
+func (c *grantConditions) String() string {
+	var parts []string
+
+	if c.ValidAfter != nil {
+		parts = append(parts, "after "+c.ValidAfter.UTC().Format(time.RFC3339))
+	}
+
+	if c.ValidBefore != nil {
+		parts = append(parts, "before "+c.ValidBefore.UTC().Format(time.RFC3339))
+	}
+
+	for _, key := range sortedKeys(c.Attributes) {
+		parts = append(parts, fmt.Sprintf("with %s matching %s", key, c.Attributes[key]))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// key identifies the conditions, so grants on the same resource with different conditions are
+// kept apart.
+func (c *grantConditions) key() string {
+	if c == nil {
+		return ""
+	}
+
+	return c.String()
+}
+
+// unconditional returns the resources that have no conditions.
+func unconditional(resources []policyResource) []policyResource {
+	out := make([]policyResource, 0, len(resources))
+
+	for _, res := range resources {
+		if res.Conditions == nil {
+			out = append(out, res)
+		}
+	}
+
+	return out
+}
+
+// compileConditional returns the conditional grants of a subject, from its own resources and
+// those of its roles, the roles they include, each compiled with the grants it gives on contained
+// resources and implied actions. Role references are expected to have been checked.
+func compileConditional(sub policySubject, idx roleIndex, descendants, closure map[string][]string) []conditionalGrant {
+	var out []conditionalGrant
+
+	add := func(res policyResource, subject, role, ruleID string) {
+		if res.Conditions == nil {
+			return
+		}
+
+		grant := policySubject{ID: sub.ID, Resources: []policyResource{withGrant(res, subject, role, ruleID)}}
+
+		out = append(out, conditionalGrant{
+			conditions: res.Conditions,
+			grants:     expandSubject(expandHierarchy(grant, descendants), closure),
+		})
+	}
+
+	for _, res := range sub.Resources {
+		add(res, sub.ID, "", res.RuleID)
+	}
+
+	for _, ref := range sub.Roles {
+		roles, _ := idx.expand(ref)
+
+		for _, role := range roles {
+			for _, res := range role.Resources {
+				ruleID := res.RuleID
+				if ruleID == "" {
+					ruleID = role.RuleID
+				}
+
+				add(res, "", role.ref(), ruleID)
+			}
+		}
+	}
+
+	return out
+}
+
+// allowsConditionally reports whether one of sub's conditional grants whose conditions the
+// request meets at now gives it the action on the resource, and returns the grants that do.
+func (s *server) allowsConditionally(ctx context.Context, sub policySubject, action, resourceID string, now time.Time) (bool, []grantRef) {
+	if len(sub.conditional) == 0 || !evaluationFrom(ctx).examine(len(sub.conditional)) {
+		return false, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var out []grantRef
+
+	for _, g := range sub.conditional {
+		if g.conditions.holds(md, now, s.clockSkew) && checkAccess(g.grants, action, resourceID) {
+			out = appendGrants(out, matchedGrants(g.grants, action, resourceID))
+		}
+	}
+
+	return len(out) > 0, out
+}
+
+// firstConditional returns the subject ID or role reference holding the first conditional grant in
+// p, and the grant's resource ID, if p has one.
+func firstConditional(p policy) (owner, resourceID string, ok bool) {
+	for _, sub := range p.Subjects {
+		for _, res := range sub.Resources {
+			if res.Conditions != nil {
+				return sub.ID, res.ID, true
+			}
+		}
+	}
+
+	for _, role := range p.Roles {
+		for _, res := range role.Resources {
+			if res.Conditions != nil {
+				return role.ref(), res.ID, true
+			}
+		}
+	}
+
+	return "", "", false
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/metrics"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+)
+
+// connectionKey is the context key of a connection's state.
+type connectionKey struct{}
+
+// connection is the state the server keeps for a gRPC connection.
+type connection struct {
+	sessions sessionCache
+
+	mu sync.Mutex
+	// The ID of the first subject authenticated on the connection, if stamping is enabled
+	subject string
+}
+
+// connectionFrom returns the state of the connection ctx belongs to, or nil if the server's stats
+// handler is not installed.
+func connectionFrom(ctx context.Context) *connection {
+	conn, _ := ctx.Value(connectionKey{}).(*connection)
+
+	return conn
+}
+
+// ConnectionSubject returns the ID of the subject stamped on the connection ctx belongs to. A
+// connection is stamped with the first subject authenticated on it when connection subjects are
+// enabled, so interceptors running after that call see the subject for every later call on the
+// connection.
+func ConnectionSubject(ctx context.Context) (string, bool) {
+	conn := connectionFrom(ctx)
+	if conn == nil {
+		return "", false
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	return conn.subject, conn.subject != ""
+}
+
+// connectionHandler is a gRPC stats handler giving each connection its state.
+type connectionHandler struct {
+	s *server
+}
+
+func (connectionHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, connectionKey{}, &connection{})
+}
+
+func (h connectionHandler) HandleConn(ctx context.Context, cs stats.ConnStats) {
+	if _, ok := cs.(*stats.ConnEnd); !ok {
+		return
+	}
+
+	if subject, ok := ConnectionSubject(ctx); ok {
+		h.s.subjectConnections.release(subject)
+		h.s.recordSubjectConnections(subject, -1)
+	}
+}
+
+func (h connectionHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	if h.s.maxSubjectStreams == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, rpcKey{}, &rpcState{})
+}
+
+func (h connectionHandler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	if _, ok := rs.(*stats.End); !ok {
+		return
+	}
+
+	if rpc, _ := ctx.Value(rpcKey{}).(*rpcState); rpc != nil && rpc.subject != "" {
+		h.s.subjectStreams.release(rpc.subject)
+	}
+}
+
+func (s *server) StatsHandler() stats.Handler {
+	return connectionHandler{s: s}
+}
+
+// stampConnection records subjectID as the subject of the connection ctx belongs to, unless
+// stamping is disabled or the connection already has one. It fails if the subject already holds
+// the most connections allowed, leaving the connection unstamped.
+func (s *server) stampConnection(ctx context.Context, subjectID string) error {
+	conn := connectionFrom(ctx)
+	if !s.connectionSubjects || conn == nil {
+		return nil
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.subject != "" {
+		return nil
+	}
+
+	if !s.subjectConnections.acquire(subjectID, s.maxSubjectConnections) {
+		s.logger.Warnw("rejected request over the subject's connection limit", "subject", subjectID, "limit", s.maxSubjectConnections)
+
+		return s.deny(codes.ResourceExhausted, reasonConnectionLimitExceeded, "subject", subjectID, "limit", strconv.Itoa(s.maxSubjectConnections))
+	}
+
+	conn.subject = subjectID
+
+	s.recordSubjectConnections(subjectID, 1)
+
+	return nil
+}
+
+func (s *server) recordSubjectConnections(subjectID string, delta int64) {
+	if s.recordMetrics {
+		metrics.AddSubjectConnections(subjectID, delta)
+	}
+}
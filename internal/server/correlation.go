@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// capturedMetadata returns the values of the configured metadata keys present on the incoming
+// request, or nil if there are none.
+func (s *server) capturedMetadata(ctx context.Context) map[string]string {
+	if len(s.metadataKeys) == 0 {
+		return nil
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	var out map[string]string
+
+	for _, key := range s.metadataKeys {
+		values := md.Get(key)
+		if len(values) == 0 {
+			continue
+		}
+
+		if out == nil {
+			out = make(map[string]string, len(s.metadataKeys))
+		}
+
+		out[key] = values[0]
+	}
+
+	return out
+}
+
+// metadataFields returns captured metadata as alternating logger keys and values.
+func metadataFields(md map[string]string) []any {
+	fields := make([]any, 0, 2*len(md))
+
+	for k, v := range md {
+		fields = append(fields, "metadata."+k, v)
+	}
+
+	return fields
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grantHits counts the requests a grant action has allowed.
+type grantHits struct {
+	count   uint64
+	lastHit time.Time
+}
+
+// grantCoverage counts how often each grant action allows a request.
+type grantCoverage struct {
+	mu sync.Mutex
+
+	since time.Time
+	hits  map[grantRef]grantHits
+}
+
+func newGrantCoverage() *grantCoverage {
+	return &grantCoverage{
+		since: time.Now(),
+		hits:  make(map[grantRef]grantHits),
+	}
+}
+
+// handle records the grants matched by allowed decisions. It implements events.Handler.
+func (c *grantCoverage) handle(ev events.Event) {
+	decision, ok := ev.(events.DecisionMade)
+	if !ok || !decision.Allowed {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, g := range decision.Grants {
+		ref := grantRef(g)
+
+		h := c.hits[ref]
+		h.count++
+		h.lastHit = decision.Time
+		c.hits[ref] = h
+	}
+}
+
+// report returns the counters for every grant action in p, and resets all counters if reset is
+// set. Counters for grants no longer in the policy are not reported.
+func (c *grantCoverage) report(p policy, reset bool) (time.Time, []grantRef, map[grantRef]grantHits) {
+	refs := policyGrants(p)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	since := c.since
+
+	hits := make(map[grantRef]grantHits, len(refs))
+	for _, ref := range refs {
+		hits[ref] = c.hits[ref]
+	}
+
+	if reset {
+		c.resetLocked()
+	}
+
+	return since, refs, hits
+}
+
+// reset discards the recorded hits.
+func (c *grantCoverage) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.resetLocked()
+}
+
+func (c *grantCoverage) resetLocked() {
+	c.since = time.Now()
+	c.hits = make(map[grantRef]grantHits)
+}
+
+// policyGrants returns each action of each subject and role grant in p, ordered by holder,
+// resource, and action.
+func policyGrants(p policy) []grantRef {
+	var out []grantRef
+
+	collect := func(subject, role, roleRuleID string, resources []policyResource) {
+		for _, res := range resources {
+			ruleID := res.RuleID
+			if ruleID == "" {
+				ruleID = roleRuleID
+			}
+
+			for _, action := range res.Actions {
+				out = append(out, grantRef{
+					Subject:    subject,
+					Role:       role,
+					ResourceID: res.ID,
+					Action:     action,
+					RuleID:     ruleID,
+				})
+			}
+		}
+	}
+
+	for _, sub := range p.Subjects {
+		collect(sub.ID, "", "", sub.Resources)
+	}
+
+	for _, role := range p.Roles {
+		collect("", role.ref(), role.RuleID, role.Resources)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+
+		switch {
+		case a.Subject != b.Subject:
+			return a.Subject < b.Subject
+		case a.Role != b.Role:
+			return a.Role < b.Role
+		case a.ResourceID != b.ResourceID:
+			return a.ResourceID < b.ResourceID
+		default:
+			return a.Action < b.Action
+		}
+	})
+
+	return out
+}
+
+func (s *server) GetCoverage(_ context.Context, req *admin.GetCoverageRequest) (*admin.GetCoverageResponse, error) {
+	s.logger.Info("received GetCoverage request")
+
+	if s.coverage == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "coverage is not enabled")
+	}
+
+	if req.ResetCounters {
+		if err := s.requireAdminToken("resetting counters"); err != nil {
+			return nil, err
+		}
+	}
+
+	st := s.state.Load()
+
+	since, refs, hits := s.coverage.report(activeGrants(st.policy, s.evaluatedAt(s.now())), req.ResetCounters)
+
+	resp := &admin.GetCoverageResponse{
+		Since: timestamppb.New(since),
+		Total: uint32(len(refs)),
+	}
+
+	for _, ref := range refs {
+		h := hits[ref]
+		if h.count > 0 {
+			resp.Matched++
+
+			if req.UnmatchedOnly {
+				continue
+			}
+		}
+
+		g := &admin.GrantCoverage{
+			Subject:    ref.Subject,
+			Role:       ref.Role,
+			ResourceId: ref.ResourceID,
+			Action:     ref.Action,
+			RuleId:     ref.RuleID,
+			Hits:       h.count,
+		}
+
+		if h.count > 0 {
+			g.LastHit = timestamppb.New(h.lastHit)
+		}
+
+		resp.Grants = append(resp.Grants, g)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestCredential returns the credential for a request: the request's own credential if set, or
+// otherwise the value of the configured metadata header with the configured prefix removed.
+func (s *server) requestCredential(ctx context.Context, credential string) string {
+	if credential != "" || s.credentialHeader == "" {
+		return credential
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(s.credentialHeader)
+	if len(values) == 0 {
+		return ""
+	}
+
+	value := values[0]
+
+	if s.credentialPrefix == "" {
+		return value
+	}
+
+	// Authorization schemes such as Bearer are case-insensitive.
+	if len(value) < len(s.credentialPrefix) || !strings.EqualFold(value[:len(s.credentialPrefix)], s.credentialPrefix) {
+		return ""
+	}
+
+	return value[len(s.credentialPrefix):]
+}
+
+// authenticate returns the subject authenticated by a request's credential. If the credential is
+// not recognized and credential checks are enabled, the error explains why the credential looks
+// like the wrong kind of value.
+func (s *server) authenticate(ctx context.Context, st *policyState, credential string) (sub policySubject, err error) {
+	ctx, span := tracer.Start(ctx, "authenticate")
+
+	defer func() {
+		if err == nil {
+			span.SetAttributes(attrSubject.String(sub.ID))
+			requestFrom(ctx).setSubject(sub.ID, "")
+
+			now := s.now()
+
+			if s.usage != nil {
+				s.usage.authenticated(sub.ID, now)
+			}
+
+			if s.lastSeen != nil {
+				s.lastSeen.Seen(sub.ID, now)
+			}
+		}
+
+		endSpan(span, err)
+	}()
+
+	sub, err = s.authenticateCredential(ctx, st, credential)
+	if err != nil {
+		return policySubject{}, err
+	}
+
+	if err := s.checkSubjectEnabled(sub.ID); err != nil {
+		return policySubject{}, err
+	}
+
+	if err := s.admitSubject(ctx, sub.ID); err != nil {
+		return policySubject{}, err
+	}
+
+	return sub, nil
+}
+
+// authenticateCredential implements authenticate.
+func (s *server) authenticateCredential(ctx context.Context, st *policyState, credential string) (policySubject, error) {
+	credential = s.requestCredential(ctx, credential)
+
+	if s.maxCredentialLength > 0 && len(credential) > s.maxCredentialLength {
+		return policySubject{}, s.deny(codes.InvalidArgument, reasonCredentialTooLong,
+			"length", strconv.Itoa(len(credential)),
+			"max_length", strconv.Itoa(s.maxCredentialLength),
+		)
+	}
+
+	sub, ok := s.lookupSession(ctx, st, credential)
+	if ok {
+		s.credentialUse.used(credential, s.now())
+
+		return sub, nil
+	}
+
+	if s.isCapability(credential) {
+		return s.authenticateCapability(st, credential)
+	}
+
+	if s.jwt != nil && looksLikeJWT(credential) {
+		return s.authenticateJWT(ctx, st, credential)
+	}
+
+	if s.credentialChecks {
+		opaque := len(st.tokens) > 0 || len(st.tokenDigests) > 0 || len(st.clients) > 0
+
+		if reason, fields := credentialMismatch(credential, opaque, s.jwt != nil); reason != "" {
+			// Never log the credential itself, least of all a private key.
+			if reason == reasonPrivateKeyCredential {
+				s.logger.Errorw("rejected credential", "reason", reason)
+			} else {
+				s.logger.Warnw("rejected credential", "reason", reason)
+			}
+
+			return policySubject{}, s.deny(codes.Unauthenticated, reason, fields...)
+		}
+	}
+
+	return policySubject{}, s.deny(codes.Unauthenticated, reasonInvalidCredential)
+}
+
+// credentialMismatch returns the reason code, and its metadata, for why an unrecognized credential
+// looks like a different kind of value than those accepted, or an empty string if it does not.
+// opaque and jwts report whether opaque tokens and JWTs are accepted.
+func credentialMismatch(credential string, opaque, jwts bool) (reason string, fields []string) {
+	trimmed := strings.TrimSpace(credential)
+
+	switch {
+	case strings.Contains(credential, "PRIVATE KEY-----"):
+		return reasonPrivateKeyCredential, nil
+	case looksLikeJWT(trimmed) && !jwts:
+		return reasonUnexpectedJWT, nil
+	case trimmed != credential:
+		return reasonCredentialWhitespace, nil
+	}
+
+	if scheme, _, ok := strings.Cut(credential, " "); ok && isAuthScheme(scheme) {
+		return reasonCredentialAuthScheme, []string{"scheme", scheme}
+	}
+
+	if jwts && !opaque {
+		return reasonJWTRequired, nil
+	}
+
+	return "", nil
+}
+
+// looksLikeJWT reports whether s has three base64url segments, the first of which decodes to a
+// JOSE header.
+func looksLikeJWT(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return false
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+	if err != nil {
+		return false
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+
+	return json.Unmarshal(b, &header) == nil && header.Alg != ""
+}
+
+func isAuthScheme(s string) bool {
+	switch strings.ToLower(s) {
+	case "bearer", "basic", "token", "dpop":
+		return true
+	default:
+		return false
+	}
+}
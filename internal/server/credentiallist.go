@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/rotation"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/credentials"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxCredentialUses is the most credentials whose last use is remembered. Past it, every
+// credential's last use is forgotten, as the session cache does with its entries.
+const maxCredentialUses = 10000
+
+// fingerprintLength is the number of hex characters of a credential's digest in its fingerprint.
+const fingerprintLength = 16
+
+// Sources of listed credentials.
+const (
+	credentialSourceEnv     = "env"
+	credentialSourceFile    = "file"
+	credentialSourceSHA256  = "sha256"
+	credentialSourceExec    = "exec"
+	credentialSourceRotated = "rotated"
+	credentialSourceOAuth2  = "oauth2"
+	credentialSourceMinted  = "minted"
+)
+
+// policyCredential is a policy token of a subject, by the digest of its value.
+type policyCredential struct {
+	digest tokenDigest
+	token  policyToken
+	// index is the token's position among the subject's tokens.
+	index int
+}
+
+// source returns where the token comes from, and its environment variable, file, or position.
+func (c policyCredential) source() (source, ref string) {
+	switch {
+	case c.token.File != "":
+		return credentialSourceFile, c.token.File
+	case c.token.SHA256 != "":
+		return credentialSourceSHA256, ""
+	case c.token.Exec != "":
+		// Commands may carry arguments the subject should not see.
+		return credentialSourceExec, c.token.ref(c.index)
+	default:
+		return credentialSourceEnv, c.token.EnvVar
+	}
+}
+
+// credentialUse records when each credential last authenticated a request, by digest. Its methods
+// may be called on a nil credentialUse, which records nothing.
+type credentialUse struct {
+	mu       sync.Mutex
+	lastUsed map[tokenDigest]time.Time
+}
+
+func newCredentialUse() *credentialUse {
+	return &credentialUse{lastUsed: make(map[tokenDigest]time.Time)}
+}
+
+// used records that credential authenticated a request at now.
+func (u *credentialUse) used(credential string, now time.Time) {
+	if u == nil {
+		return
+	}
+
+	digest := digestToken(credential)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, ok := u.lastUsed[digest]; !ok && len(u.lastUsed) >= maxCredentialUses {
+		u.lastUsed = make(map[tokenDigest]time.Time)
+	}
+
+	u.lastUsed[digest] = now
+}
+
+// last returns when the credential with the given digest last authenticated a request.
+func (u *credentialUse) last(digest tokenDigest) (time.Time, bool) {
+	if u == nil {
+		return time.Time{}, false
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	t, ok := u.lastUsed[digest]
+
+	return t, ok
+}
+
+// reset forgets when every credential was last used.
+func (u *credentialUse) reset() {
+	if u == nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.lastUsed = make(map[tokenDigest]time.Time)
+}
+
+func (s *server) ListCredentials(ctx context.Context, req *credentials.ListCredentialsRequest) (*credentials.ListCredentialsResponse, error) {
+	s.logger.Info("received ListCredentials request")
+
+	// Only this runtime's credentials are listed, so foreign credentials are never forwarded.
+	credential, foreign := s.foreignCredential(ctx, req.Credential)
+	if foreign {
+		return nil, s.rejectForeign()
+	}
+
+	st := s.state.Load()
+
+	sub, err := s.authenticate(ctx, st, req.Credential)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkPeer(ctx, st, sub); err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	current := digestToken(credential)
+
+	var records map[string]rotation.Record
+	if s.rotation != nil {
+		records = s.rotation.Records(sub.ID)
+	}
+
+	out := &credentials.ListCredentialsResponse{}
+
+	for _, tok := range st.subjectTokens[sub.ID] {
+		rec, rotated := records[hex.EncodeToString(tok.digest[:])]
+		if rotated && rec.Expired(now) {
+			// Rotated out, so no longer accepted.
+			continue
+		}
+
+		source, ref := tok.source()
+		info := s.credentialInfo(tok.digest, current, source, ref)
+
+		if rotated && rec.ExpiresAt != nil {
+			info.ExpiresAt = timestamppb.New(*rec.ExpiresAt)
+		}
+
+		out.Credentials = append(out.Credentials, info)
+	}
+
+	var issued []*credentials.CredentialInfo
+
+	for d, rec := range records {
+		if rec.Static || rec.Expired(now) {
+			continue
+		}
+
+		var digest tokenDigest
+
+		// Digests are written by the store, so they are always well formed.
+		_, _ = hex.Decode(digest[:], []byte(d))
+
+		info := s.credentialInfo(digest, current, credentialSourceRotated, "")
+
+		if rec.ExpiresAt != nil {
+			info.ExpiresAt = timestamppb.New(*rec.ExpiresAt)
+		}
+
+		issued = append(issued, info)
+	}
+
+	for digest, tok := range s.issued.forSubject(sub.ID, now) {
+		info := s.credentialInfo(digest, current, credentialSourceMinted, "")
+
+		if tok.clientID != "" {
+			info.Source, info.Ref = credentialSourceOAuth2, tok.clientID
+		}
+
+		info.ExpiresAt = timestamppb.New(tok.expiresAt)
+		issued = append(issued, info)
+	}
+
+	// Credentials that never expire come first, then those expiring soonest.
+	sort.Slice(issued, func(i, j int) bool {
+		a, b := issued[i], issued[j]
+
+		if (a.ExpiresAt == nil) != (b.ExpiresAt == nil) {
+			return a.ExpiresAt == nil
+		}
+
+		if a.ExpiresAt != nil && !a.ExpiresAt.AsTime().Equal(b.ExpiresAt.AsTime()) {
+			return a.ExpiresAt.AsTime().Before(b.ExpiresAt.AsTime())
+		}
+
+		return a.Fingerprint < b.Fingerprint
+	})
+
+	out.Credentials = append(out.Credentials, issued...)
+
+	return out, nil
+}
+
+// credentialInfo returns the metadata of the credential with the given digest. current is the
+// digest of the credential the request was authenticated with.
+func (s *server) credentialInfo(digest, current tokenDigest, source, ref string) *credentials.CredentialInfo {
+	out := &credentials.CredentialInfo{
+		Fingerprint: hex.EncodeToString(digest[:])[:fingerprintLength],
+		Source:      source,
+		Ref:         ref,
+		Current:     digest == current,
+	}
+
+	if t, ok := s.credentialUse.last(digest); ok {
+		out.LastUsedAt = timestamppb.New(t)
+	}
+
+	return out
+}
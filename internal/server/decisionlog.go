@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/decisionlog"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestKey is the context key of the decision record of the request being handled.
+type requestKey struct{}
+
+// requestRecord collects the decision record of a request as it is handled.
+type requestRecord struct {
+	rec   decisionlog.Record
+	start time.Time
+	// The number of actions decided so far. Actions are decided in request order
+	decided int
+}
+
+// maxPooledActions is the number of actions above which a request record is dropped rather than
+// pooled, so one large check does not pin its actions for the life of the process.
+const maxPooledActions = 256
+
+// requestRecords pools request records, which are garbage once written.
+var requestRecords = sync.Pool{
+	New: func() any { return new(requestRecord) },
+}
+
+// requestFrom returns the decision record of the request ctx belongs to, or nil if the decision
+// log is disabled.
+func requestFrom(ctx context.Context) *requestRecord {
+	r, _ := ctx.Value(requestKey{}).(*requestRecord)
+
+	return r
+}
+
+// setSubject records who the request is decided for. actorID is empty unless the request was
+// delegated.
+func (r *requestRecord) setSubject(subjectID, actorID string) {
+	if r == nil {
+		return
+	}
+
+	r.rec.Subject = subjectID
+	r.rec.Actor = actorID
+}
+
+// decide records the decision on the next action of the request.
+func (r *requestRecord) decide(allowed bool) {
+	if r == nil || r.decided >= len(r.rec.Actions) {
+		return
+	}
+
+	r.rec.Actions[r.decided].Allowed = allowed
+	r.decided++
+}
+
+// logRequest starts the decision record of a request, if the decision log is enabled. Call the
+// returned function with the request's error once it is handled to write the record.
+func (s *server) logRequest(ctx context.Context, method string, actions []*authorization.AccessRequestAction) (context.Context, func(err error)) {
+	if s.decisionLog == nil {
+		return ctx, func(error) {}
+	}
+
+	r := requestRecords.Get().(*requestRecord)
+	*r = requestRecord{
+		rec:   decisionlog.Record{Method: method, Actions: r.rec.Actions[:0]},
+		start: time.Now(),
+	}
+
+	for _, action := range actions {
+		r.rec.Actions = append(r.rec.Actions, decisionlog.Action{Action: action.Action, ResourceID: action.ResourceId})
+	}
+
+	ctx = context.WithValue(ctx, requestKey{}, r)
+
+	return ctx, func(err error) {
+		rec := r.rec
+		rec.Time = r.start.UTC()
+		rec.LatencyMillis = float64(time.Since(r.start).Microseconds()) / 1000
+		rec.ConnectionSubject, _ = ConnectionSubject(ctx)
+		rec.Metadata = s.capturedMetadata(ctx)
+
+		// Unix socket peers are unnamed, so only network peers are recorded.
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil && p.Addr.Network() != "unix" {
+			rec.Peer = p.Addr.String()
+		}
+
+		rec.Decision, rec.Code, rec.Reason = requestOutcome(err)
+
+		s.decisionLog.Write(rec)
+
+		// The log has encoded the record, so its actions can be reused. Nothing else holds the record
+		// once the request is handled.
+		if cap(r.rec.Actions) <= maxPooledActions {
+			requestRecords.Put(r)
+		}
+	}
+}
+
+// requestOutcome returns the decision, status code, and denial reason of a request's error.
+func requestOutcome(err error) (decision, code, reason string) {
+	if err == nil {
+		return decisionlog.DecisionAllow, "", ""
+	}
+
+	stat := status.Convert(err)
+
+	for _, detail := range stat.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == denialDomain {
+			reason = info.Reason
+		}
+	}
+
+	switch stat.Code() {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return decisionlog.DecisionDeny, stat.Code().String(), reason
+	default:
+		return decisionlog.DecisionError, stat.Code().String(), reason
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"io"
+	"testing"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/decisionlog"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"go.uber.org/zap"
+)
+
+// BenchmarkCheckAccessDecisionLog checks several actions with every decision logged. Request
+// records and check results are pooled, so their allocations should not show up per check.
+func BenchmarkCheckAccessDecisionLog(b *testing.B) {
+	l, err := decisionlog.New(decisionlog.Config{Stdout: true}, io.Discard, zap.NewNop().Sugar())
+	if err != nil {
+		b.Fatalf("creating decision log: %s", err)
+	}
+
+	defer l.Close()
+
+	s := newTestServer(b, policy{Subjects: []policySubject{
+		testSubject("alice",
+			policyResource{ID: "lb-a", Actions: []string{"lb_get", "lb_update"}},
+			policyResource{ID: "lb-b", Actions: []string{"lb_get"}},
+		),
+	}}, WithDecisionLog(l))
+
+	actions := []*authorization.AccessRequestAction{
+		{Action: "lb_get", ResourceId: "lb-a"},
+		{Action: "lb_update", ResourceId: "lb-a"},
+		{Action: "lb_get", ResourceId: "lb-b"},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := checkTestAccess(s, "alice", actions...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestCheckAccessDecisionLogAllocs checks that logging decisions allocates no more for a check of
+// many actions than for a check of one, since request records are pooled with their actions.
+func TestCheckAccessDecisionLogAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("pools drop items at random with the race detector")
+	}
+
+	l, err := decisionlog.New(decisionlog.Config{Stdout: true}, io.Discard, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("creating decision log: %s", err)
+	}
+
+	defer l.Close()
+
+	p := policy{Subjects: []policySubject{
+		testSubject("alice", policyResource{ID: "lb-a", Actions: []string{"lb_get"}}),
+	}}
+
+	logged, unlogged := newTestServer(t, p, WithDecisionLog(l)), newTestServer(t, p)
+
+	// extraAllocs returns the allocations decision logging adds to a check of n actions.
+	extraAllocs := func(n int) float64 {
+		actions := make([]*authorization.AccessRequestAction, n)
+		for i := range actions {
+			actions[i] = &authorization.AccessRequestAction{Action: "lb_get", ResourceId: "lb-a"}
+		}
+
+		with := testing.AllocsPerRun(100, func() { _ = checkTestAccess(logged, "alice", actions...) })
+		without := testing.AllocsPerRun(100, func() { _ = checkTestAccess(unlogged, "alice", actions...) })
+
+		return with - without
+	}
+
+	one, many := extraAllocs(1), extraAllocs(50)
+
+	if many > one {
+		t.Errorf("decision logging allocates %.0f times for 50 actions, more than the %.0f times for 1", many, one)
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// onBehalfOfMetadataKey is the gRPC metadata key naming the subject a request is made on behalf of.
+const onBehalfOfMetadataKey = "on-behalf-of"
+
+// onBehalfOf returns the subject ID the request is made on behalf of, if any.
+func onBehalfOf(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	values := md.Get(onBehalfOfMetadataKey)
+	if len(values) == 0 || values[0] == "" {
+		return "", false
+	}
+
+	return values[0], true
+}
+
+// findDelegation returns the delegation from actor to the given principal, if any.
+func findDelegation(actor policySubject, principalID string) (policyDelegation, bool) {
+	for _, del := range actor.Delegations {
+		if del.Subject == principalID {
+			return del, true
+		}
+	}
+
+	return policyDelegation{}, false
+}
+
+// validateDelegations checks that every delegation refers to another subject in the policy.
+func validateDelegations(p policy) error {
+	ids := make(map[string]struct{}, len(p.Subjects))
+	for _, sub := range p.Subjects {
+		ids[sub.ID] = struct{}{}
+	}
+
+	for _, sub := range p.Subjects {
+		for _, del := range sub.Delegations {
+			if del.Subject == sub.ID {
+				return fmt.Errorf("%s: delegations: subject cannot delegate to itself: %w", sub.ID, ErrInvalidValue)
+			}
+
+			if _, ok := ids[del.Subject]; !ok {
+				return fmt.Errorf("%s: delegations: %s: %w", sub.ID, del.Subject, ErrMissingValue)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkDelegatedAccess checks a request made by actor on behalf of the given principal. Each action
+// must be both delegated to the actor and permitted for the principal.
+func (s *server) checkDelegatedAccess(ctx context.Context, st *policyState, actor policySubject, principalID string, req *authorization.CheckAccessRequest) (*authorization.CheckAccessResponse, error) {
+	requestFrom(ctx).setSubject(principalID, actor.ID)
+
+	del, ok := findDelegation(actor, principalID)
+	if !ok {
+		s.logger.Warnw("denied delegated access check", "subject", principalID, "actor", actor.ID, "reason", "no delegation")
+
+		return nil, s.deny(codes.PermissionDenied, reasonDelegationDenied, "actor", actor.ID, "subject", principalID)
+	}
+
+	// authenticate only checked the actor, and delegated checks do not mark the principal seen.
+	if err := s.checkSubjectEnabled(principalID); err != nil {
+		s.logger.Warnw("denied delegated access check", "subject", principalID, "actor", actor.ID, "reason", "subject disabled")
+
+		return nil, err
+	}
+
+	principal := st.subjects[principalID]
+
+	// The actor stays within its own tenant when acting on behalf of another subject.
+	if err := s.checkTenants(ctx, st, req, principalID, actor.ID, actor, principal); err != nil {
+		return nil, err
+	}
+
+	results := getCheckResults()
+	defer putCheckResults(results)
+
+	_, span := tracer.Start(ctx, "evaluate", trace.WithAttributes(
+		attrSubject.String(principalID),
+		attrActor.String(actor.ID),
+		attrActions.Int(len(req.Actions)),
+	))
+
+	// As in CheckAccess, every action is evaluated against st at one instant.
+	now := s.now()
+
+	ctx, ev := s.startEvaluation(ctx)
+
+	for i, action := range req.Actions {
+		var (
+			allowed  bool
+			grants   []grantRef
+			backends []events.BackendDecision
+		)
+
+		if matchesAny(del.Actions, action.Action) && inScope(actor, action.Action, action.ResourceId) {
+			allowed, grants, backends = s.decide(ctx, st, principal, req.Credential, action.Action, action.ResourceId, now)
+		}
+
+		if ev.exhausted() {
+			span.End()
+
+			return nil, s.budgetExceeded(ev, principalID, action)
+		}
+
+		addBackendsEvent(span, action, backends)
+		s.publishDecision(ctx, st, principalID, actor.ID, action.Action, action.ResourceId, allowed, grants, backends)
+
+		if !allowed {
+			results.deny(i, backends)
+
+			continue
+		}
+
+		results.matched = appendGrants(results.matched, grants)
+	}
+
+	span.SetAttributes(attrDenied.Int(len(results.denied)))
+	span.End()
+
+	if len(results.denied) > 0 {
+		s.logger.Warnw("denied delegated access check",
+			"subject", principalID,
+			"actor", actor.ID,
+			"denied", deniedPairs(req, results.denied),
+			"actions", len(req.Actions),
+		)
+
+		err := s.denyActions(reasonDelegatedActionDenied, req, results.denied, func(action *authorization.AccessRequestAction) []string {
+			return []string{
+				"actor", actor.ID,
+				"subject", principalID,
+				"action", action.Action,
+				"resource_id", action.ResourceId,
+			}
+		})
+
+		return nil, s.withDenialHints(err, st, principalID, req, results,
+			fmt.Sprintf("%s is granted it, but its delegation to %s does not cover it", principalID, actor.ID))
+	}
+
+	if md := matchedRulesTrailer(results.matched); md != nil {
+		_ = grpc.SetTrailer(ctx, md)
+	}
+
+	s.logger.Infow("allowed delegated access check", "subject", principalID, "actor", actor.ID, "actions", len(req.Actions))
+
+	return &authorization.CheckAccessResponse{}, nil
+}
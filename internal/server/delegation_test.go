@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/lastseen"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestDelegatedAccessDisabledPrincipal(t *testing.T) {
+	robot := testSubject("robot")
+	robot.Delegations = []policyDelegation{{Subject: "alice", Actions: []string{"lb_get"}}}
+
+	p := policy{Subjects: []policySubject{
+		testSubject("alice", policyResource{ID: "lb-a", Actions: []string{"lb_get"}}),
+		robot,
+	}}
+
+	store, err := lastseen.Open("")
+	if err != nil {
+		t.Fatalf("opening last-seen store: %s", err)
+	}
+
+	s := newTestServer(t, p, WithStaleSubjectExpiry(store, time.Hour, nil))
+	t.Cleanup(func() { s.staleTimer.Stop() })
+
+	check := func() error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(onBehalfOfMetadataKey, "alice"))
+
+		_, err := s.CheckAccess(ctx, &authorization.CheckAccessRequest{
+			Credential: testToken("robot"),
+			Actions:    []*authorization.AccessRequestAction{{Action: "lb_get", ResourceId: "lb-a"}},
+		})
+
+		return err
+	}
+
+	if err := check(); err != nil {
+		t.Fatalf("checking on behalf of an enabled subject: %s", err)
+	}
+
+	if _, err := store.Disable("alice", time.Now()); err != nil {
+		t.Fatalf("disabling alice: %s", err)
+	}
+
+	err = check()
+	if code := status.Code(err); code != codes.PermissionDenied {
+		t.Fatalf("checking on behalf of a disabled subject returned %s, want %s", code, codes.PermissionDenied)
+	}
+
+	if reason := errorReason(err); reason != reasonSubjectDisabled {
+		t.Errorf("reason is %q, want %q", reason, reasonSubjectDisabled)
+	}
+
+	// The disabled principal does not disable its delegate.
+	if err := checkTestAccess(s, "robot"); err != nil {
+		t.Errorf("checking as the delegate: %s", err)
+	}
+}
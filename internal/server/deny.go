@@ -0,0 +1,110 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+)
+
+// policyDeny rejects actions on a resource even if a grant allows them. Denies are evaluated
+// before grants, so they carve exceptions out of broad access, such as a role's.
+type policyDeny struct {
+	ID      string   `yaml:"id" json:"id"`
+	Actions []string `yaml:"actions" json:"actions"`
+
+	// role is the id@version reference of the role the deny came from, once subjects are compiled.
+	role string
+}
+
+// checkDenies checks that every deny names a resource and at least one action.
+func checkDenies(denies []policyDeny) error {
+	for _, d := range denies {
+		if err := checkID("deny resource ID", d.ID); err != nil {
+			return fmt.Errorf("deny: %w", err)
+		}
+
+		if len(d.Actions) == 0 {
+			return fmt.Errorf("deny: %s: actions are empty: %w", d.ID, ErrMissingValue)
+		}
+
+		for _, action := range d.Actions {
+			if err := checkID("action", action); err != nil {
+				return fmt.Errorf("deny: %s: %w", d.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandDenies returns a copy of sub with the denies of its referenced roles, and the roles they
+// include, added to its own. Like grants, a deny on a resource also applies to every resource it
+// contains, directly or indirectly. Role references are expected to have been checked.
+func expandDenies(sub policySubject, idx roleIndex, descendants map[string][]string) policySubject {
+	out := sub
+	out.Deny = append([]policyDeny(nil), sub.Deny...)
+
+	for _, ref := range sub.Roles {
+		roles, _ := idx.expand(ref)
+
+		for _, role := range roles {
+			for _, d := range role.Deny {
+				d.role = role.ref()
+				out.Deny = append(out.Deny, d)
+			}
+		}
+	}
+
+	for _, d := range out.Deny {
+		for _, child := range descendants[d.ID] {
+			out.Deny = append(out.Deny, policyDeny{ID: child, Actions: d.Actions, role: d.role})
+		}
+	}
+
+	return out
+}
+
+// findDeny returns the first of the subject's denies rejecting action on the resource, if any.
+// Resource IDs and actions in denies may be patterns.
+func findDeny(sub policySubject, action, resourceID string) (policyDeny, bool) {
+	for _, d := range sub.Deny {
+		if resourceMatches(d.ID, resourceID) && matchesAny(d.Actions, action) {
+			return d, true
+		}
+	}
+
+	return policyDeny{}, false
+}
+
+// mergeDeny unions the actions of d into the deny on the same resource, or appends it.
+func mergeDeny(denies []policyDeny, d policyDeny) []policyDeny {
+	for i, candidate := range denies {
+		if candidate.ID != d.ID {
+			continue
+		}
+
+		denies[i] = policyDeny{ID: d.ID, Actions: mergeStrings(candidate.Actions, d.Actions)}
+
+		return denies
+	}
+
+	return append(denies, policyDeny{ID: d.ID, Actions: d.Actions})
+}
+
+// canonicalDenies returns denies merged by resource, with sorted, unique actions, sorted by
+// resource.
+func canonicalDenies(in []policyDeny) []policyDeny {
+	var out []policyDeny
+	for _, d := range in {
+		out = mergeDeny(out, d)
+	}
+
+	for i := range out {
+		out[i].Actions = sortedUnique(out[i].Actions)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+
+	return out
+}
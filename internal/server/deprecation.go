@@ -0,0 +1,34 @@
+package server
+
+// policyDeprecations marks actions and resources as deprecated. Each maps a name to a message
+// describing what to use instead. Deprecated names are still evaluated normally.
+type policyDeprecations struct {
+	Actions   map[string]string `yaml:"actions,omitempty" json:"actions,omitempty"`
+	Resources map[string]string `yaml:"resources,omitempty" json:"resources,omitempty"`
+}
+
+// mergeDeprecations returns base with the overlay's deprecations added.
+func mergeDeprecations(base, overlay policyDeprecations) policyDeprecations {
+	return policyDeprecations{
+		Actions:   mergeStringMaps(base.Actions, overlay.Actions),
+		Resources: mergeStringMaps(base.Resources, overlay.Resources),
+	}
+}
+
+func mergeStringMaps[V any](base, overlay map[string]V) map[string]V {
+	if len(base) == 0 && len(overlay) == 0 {
+		return nil
+	}
+
+	out := make(map[string]V, len(base)+len(overlay))
+
+	for k, v := range base {
+		out[k] = v
+	}
+
+	for k, v := range overlay {
+		out[k] = v
+	}
+
+	return out
+}
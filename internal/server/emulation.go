@@ -0,0 +1,28 @@
+package server
+
+import (
+	"context"
+	"path"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func (s *server) EmulationUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		rpc := path.Base(info.FullMethod)
+
+		code, err := s.rpcProfiles.Apply(ctx, rpc)
+		if err != nil {
+			return nil, err
+		}
+
+		if code != codes.OK {
+			s.logger.Debugw("injected fault", "rpc", rpc, "code", code.String())
+
+			return nil, s.deny(code, reasonInjectedFault, "rpc", rpc)
+		}
+
+		return handler(ctx, req)
+	}
+}
@@ -7,4 +7,23 @@ var (
 	ErrDuplicateValue = errors.New("duplicate value")
 	// ErrMissingValue represents an error where a required value was missing from a policy.
 	ErrMissingValue = errors.New("missing value")
+	// ErrMissingToken represents an error where a policy token or client secret had no value.
+	ErrMissingToken = errors.New("missing token")
+	// ErrInvalidValue represents an error where a policy value was malformed.
+	ErrInvalidValue = errors.New("invalid value")
+	// ErrInvalidPatch represents an error where a policy overlay contained an invalid patch marker.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrInvalidClient represents an error where OAuth2 client credentials were not recognized.
+	ErrInvalidClient = errors.New("invalid client credentials")
+	// ErrPolicyRejected represents an error where a policy update failed the reload guard.
+	ErrPolicyRejected = errors.New("policy update rejected")
+	// ErrArtifactMismatch represents an error where a compiled policy artifact does not match its
+	// source policy.
+	ErrArtifactMismatch = errors.New("compiled artifact does not match source policy")
+	// ErrClockNotAdjustable represents an error where the clock of a server without an adjustable
+	// clock was advanced.
+	ErrClockNotAdjustable = errors.New("clock is not adjustable")
+	// ErrTokenCommandsDisabled represents an error where a policy token is printed by a command,
+	// but the runtime does not run token commands.
+	ErrTokenCommandsDisabled = errors.New("token commands are disabled")
 )
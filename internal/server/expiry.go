@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// expiringGrant is a subject or role grant with an expiry.
+type expiringGrant struct {
+	// Subject is the ID of the subject holding the grant, if it is a subject grant.
+	Subject string
+	// Role is the id@version reference of the role holding the grant, if it is a role grant.
+	Role       string
+	ResourceID string
+	Actions    []string
+	ExpiresAt  time.Time
+}
+
+// expired reports whether a grant has expired at now.
+func expired(res policyResource, now time.Time) bool {
+	return res.ExpiresAt != nil && !now.Before(*res.ExpiresAt)
+}
+
+// activeGrants returns a copy of p without the subject and role grants that have expired at now,
+// and with the grants of the on-call schedules open at now added to their subjects.
+func activeGrants(p policy, now time.Time) policy {
+	active := func(in []policyResource) []policyResource {
+		var out []policyResource
+
+		for _, res := range in {
+			if !expired(res, now) {
+				out = append(out, res)
+			}
+		}
+
+		return out
+	}
+
+	onCall := openOnCall(p, now)
+
+	out := p
+
+	out.Subjects = make([]policySubject, len(p.Subjects))
+	for i, sub := range p.Subjects {
+		sub.Resources = active(sub.Resources)
+
+		for _, o := range onCall[sub.ID] {
+			sub.Resources = append(sub.Resources, active(o.Resources)...)
+			sub.Roles = append(sub.Roles[:len(sub.Roles):len(sub.Roles)], o.Roles...)
+		}
+
+		out.Subjects[i] = sub
+	}
+
+	out.Roles = make([]policyRole, len(p.Roles))
+	for i, role := range p.Roles {
+		role.Resources = active(role.Resources)
+		out.Roles[i] = role
+	}
+
+	return out
+}
+
+// grantsExpiring returns the grants in p that expire after the given time and no later than
+// until, ordered by expiry, then by subject, role, and resource ID. A zero until has no upper
+// bound.
+func grantsExpiring(p policy, after, until time.Time) []expiringGrant {
+	var out []expiringGrant
+
+	collect := func(subject, role string, resources []policyResource) {
+		for _, res := range resources {
+			if res.ExpiresAt == nil || !res.ExpiresAt.After(after) {
+				continue
+			}
+
+			if !until.IsZero() && res.ExpiresAt.After(until) {
+				continue
+			}
+
+			out = append(out, expiringGrant{
+				Subject:    subject,
+				Role:       role,
+				ResourceID: res.ID,
+				Actions:    res.Actions,
+				ExpiresAt:  *res.ExpiresAt,
+			})
+		}
+	}
+
+	for _, sub := range p.Subjects {
+		collect(sub.ID, "", sub.Resources)
+	}
+
+	for _, role := range p.Roles {
+		collect("", role.ref(), role.Resources)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+
+		switch {
+		case !a.ExpiresAt.Equal(b.ExpiresAt):
+			return a.ExpiresAt.Before(b.ExpiresAt)
+		case a.Subject != b.Subject:
+			return a.Subject < b.Subject
+		case a.Role != b.Role:
+			return a.Role < b.Role
+		default:
+			return a.ResourceID < b.ResourceID
+		}
+	})
+
+	return out
+}
+
+// evaluatedAt returns the time grant expiries are evaluated at when the clock reads now: now less
+// the clock-skew tolerance, so that grants apply until the tolerance has passed after they expire.
+func (s *server) evaluatedAt(now time.Time) time.Time {
+	return now.Add(-s.clockSkew)
+}
+
+// scheduleExpirySweep arranges for the policy to be swept when the next grant in p expires, or the
+// next on-call window in p opens or closes, at now, an evaluation time from evaluatedAt. The
+// caller must hold updateMu or otherwise have exclusive access to the server.
+func (s *server) scheduleExpirySweep(p policy, now time.Time) {
+	if s.expiryTimer != nil {
+		s.expiryTimer.Stop()
+		s.expiryTimer = nil
+	}
+
+	next, ok := nextOnCallChange(p, now)
+
+	if upcoming := grantsExpiring(p, now, time.Time{}); len(upcoming) > 0 && (!ok || upcoming[0].ExpiresAt.Before(next)) {
+		next, ok = upcoming[0].ExpiresAt, true
+	}
+
+	if !ok {
+		return
+	}
+
+	s.expiryTimer = time.AfterFunc(next.Sub(now), s.sweepExpiredGrants)
+}
+
+// sweepExpiredGrants recompiles the active policy without the grants that expired since it was
+// last compiled, and with the on-call windows that are open now, publishing an event for each
+// change, and schedules the next sweep.
+func (s *server) sweepExpiredGrants() {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	st := s.state.Load()
+	now := s.now()
+	evaluated := s.evaluatedAt(now)
+
+	lapsed := grantsExpiring(st.policy, st.compiledAt, evaluated)
+	changed := onCallChanges(st.policy, st.compiledAt, evaluated)
+
+	if len(lapsed) > 0 || len(changed) > 0 {
+		next, err := s.newPolicyState(st.policy, evaluated)
+		if err != nil {
+			// Grants change when the policy is next loaded; until then, keep retrying.
+			s.logger.Errorw("failed to sweep expired grants", "error", err)
+
+			s.expiryTimer = time.AfterFunc(time.Minute, s.sweepExpiredGrants)
+
+			return
+		}
+
+		next.info = st.info
+		s.state.Store(next)
+
+		for _, g := range lapsed {
+			s.bus.Publish(events.GrantExpired{
+				Subject:    g.Subject,
+				Role:       g.Role,
+				ResourceID: g.ResourceID,
+				Actions:    g.Actions,
+				ExpiresAt:  g.ExpiresAt,
+				Time:       now,
+			})
+		}
+
+		for _, c := range changed {
+			s.bus.Publish(events.OnCallChanged{
+				Schedule: c.ID,
+				Subjects: c.Subjects,
+				Open:     c.open,
+				Time:     now,
+			})
+		}
+	}
+
+	s.scheduleExpirySweep(st.policy, evaluated)
+}
+
+func (s *server) ListExpiringGrants(_ context.Context, req *admin.ListExpiringGrantsRequest) (*admin.ListExpiringGrantsResponse, error) {
+	s.logger.Info("received ListExpiringGrants request")
+
+	if req.Within != nil && req.Within.AsDuration() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "within must not be negative")
+	}
+
+	// List the grants that still apply, including those within the clock-skew tolerance.
+	now := s.evaluatedAt(s.now())
+
+	var until time.Time
+	if req.Within != nil && req.Within.AsDuration() > 0 {
+		until = now.Add(req.Within.AsDuration())
+	}
+
+	resp := &admin.ListExpiringGrantsResponse{}
+
+	for _, g := range grantsExpiring(s.state.Load().policy, now, until) {
+		resp.Grants = append(resp.Grants, &admin.ExpiringGrant{
+			Subject:    g.Subject,
+			Role:       g.Role,
+			ResourceId: g.ResourceID,
+			Actions:    sortedUnique(g.Actions),
+			ExpiresAt:  timestamppb.New(g.ExpiresAt),
+		})
+	}
+
+	return resp, nil
+}
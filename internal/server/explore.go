@@ -0,0 +1,417 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Explorer answers questions about a policy without serving it, for interactive exploration.
+// Tokens are never resolved.
+type Explorer struct {
+	policy   policy
+	roles    roleIndex
+	closure  map[string][]string
+	subjects map[string]policySubject
+
+	// Map from resources to the resources containing them
+	ancestors map[string][]string
+
+	// Map from resources owned by tenants to their tenants
+	tenants map[string]string
+
+	// The policy and roles including expired grants, to explain denials they would have allowed
+	all      policy
+	allRoles roleIndex
+
+	evaluatedAt time.Time
+	clockSkew   time.Duration
+}
+
+// Grant is an effective resource grant: the actions a subject may perform on a resource,
+// including actions granted by roles and implied by other actions.
+type Grant struct {
+	ResourceID string
+	Actions    []string
+}
+
+// Explanation describes why a subject may or may not perform an action on a resource.
+type Explanation struct {
+	// Allowed reports whether the subject's unconditional grants allow the action. Conditional
+	// grants depend on the request, so they are listed in Reasons but not evaluated.
+	Allowed bool
+	// Reasons lists each rule that grants the action, or why none applies.
+	Reasons []string
+	// EvaluatedAt is the time grant expiries were evaluated at: the time the explorer was created,
+	// less ClockSkew.
+	EvaluatedAt time.Time
+	ClockSkew   time.Duration
+}
+
+// NewExplorer reads the policy at policyPath, applies any overlays, and returns an Explorer for
+// the result. Files are read with read, or only plaintext policies are accepted if read is nil.
+// Grants apply until clockSkew has passed after they expire, as when served with the same
+// tolerance.
+func NewExplorer(policyPath string, overlayPaths []string, read ReadFileFunc, clockSkew time.Duration) (*Explorer, error) {
+	all, err := readPolicyFiles(readerOrDefault(read), policyPath, overlayPaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Explore the policy as it is evaluated now, without expired grants.
+	return newExplorer(all, time.Now().Add(-clockSkew), clockSkew)
+}
+
+// newExplorer returns an Explorer for a policy read and merged with its overlays, as evaluated at
+// evaluatedAt, which is already adjusted for clockSkew.
+func newExplorer(all policy, evaluatedAt time.Time, clockSkew time.Duration) (*Explorer, error) {
+	allRoles, err := newRoleIndex(all.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	p := activeGrants(all, evaluatedAt)
+
+	compiled, err := compileSubjects(p)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := newRoleIndex(p.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects := make(map[string]policySubject, len(compiled))
+	for _, sub := range compiled {
+		subjects[sub.ID] = sub
+	}
+
+	// Validated by compileSubjects.
+	tenants, _ := resourceTenants(p)
+
+	return &Explorer{
+		policy:      p,
+		roles:       roles,
+		closure:     transitiveClosure(p.Implies),
+		subjects:    subjects,
+		ancestors:   ancestorResources(transitiveClosure(p.Contains)),
+		tenants:     tenants,
+		all:         all,
+		allRoles:    allRoles,
+		evaluatedAt: evaluatedAt,
+		clockSkew:   clockSkew,
+	}, nil
+}
+
+// Subjects returns the IDs of the policy's subjects, sorted.
+func (e *Explorer) Subjects() []string {
+	out := make([]string, 0, len(e.subjects))
+	for id := range e.subjects {
+		out = append(out, id)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// HasSubject reports whether the policy defines the given subject.
+func (e *Explorer) HasSubject(id string) bool {
+	_, ok := e.subjects[id]
+
+	return ok
+}
+
+// Grants returns the subject's effective grants, sorted by resource ID.
+func (e *Explorer) Grants(subjectID string) []Grant {
+	sub := e.subjects[subjectID]
+
+	var out []Grant
+	for _, res := range canonicalResources(sub.Resources) {
+		out = append(out, Grant{ResourceID: res.ID, Actions: res.Actions})
+	}
+
+	return out
+}
+
+// Explain reports whether the subject may perform the action on the resource, and why.
+func (e *Explorer) Explain(subjectID, action, resourceID string) Explanation {
+	sub, ok := e.subjects[subjectID]
+	if !ok {
+		return Explanation{
+			Reasons:     []string{fmt.Sprintf("subject %s is not defined", subjectID)},
+			EvaluatedAt: e.evaluatedAt,
+			ClockSkew:   e.clockSkew,
+		}
+	}
+
+	out := Explanation{
+		Allowed:     checkAccess(sub, action, resourceID),
+		EvaluatedAt: e.evaluatedAt,
+		ClockSkew:   e.clockSkew,
+	}
+
+	if owner, cross := crossTenant(e.tenants, sub, resourceID); cross {
+		out.Allowed = false
+		out.Reasons = append(out.Reasons, fmt.Sprintf("%s belongs to tenant %s, but %s is scoped to tenant %s, overriding any grants", resourceID, owner, subjectID, sub.Tenant))
+
+		return out
+	}
+
+	if d, denied := findDeny(sub, action, resourceID); denied {
+		source := "directly"
+		if d.role != "" {
+			source = "by role " + d.role
+		}
+
+		out.Reasons = append(out.Reasons, fmt.Sprintf("%s denied %s on %s, overriding any grants", action, source, d.ID))
+
+		return out
+	}
+
+	raw := rawSubject(e.policy, subjectID)
+	conditional := e.conditionalReasons(raw, action, resourceID)
+	raw.Resources = unconditional(raw.Resources)
+
+	// checkAccess uses the subject's last entry for a resource, so only that entry applies.
+	var last *policyResource
+
+	for i := range raw.Resources {
+		if raw.Resources[i].ID == resourceID {
+			last = &raw.Resources[i]
+		}
+	}
+
+	// Reasons are grouped by how the action is granted, and sorted within each group, so they do
+	// not depend on the order of the policy.
+	var direct, patterns, roles, inherited []string
+
+	if last != nil {
+		direct = e.reasons(last.Actions, action, "granted directly"+ruleLabel(last.RuleID)+expiryLabel(last.ExpiresAt))
+	}
+
+	for _, res := range patternResources(raw, resourceID) {
+		patterns = append(patterns, e.reasons(res.Actions, action, "granted directly"+patternLabel(res.ID)+ruleLabel(res.RuleID)+expiryLabel(res.ExpiresAt))...)
+	}
+
+	for _, role := range subjectRoles(e.roles, raw) {
+		for _, res := range unconditional(role.Resources) {
+			if resourceMatches(res.ID, resourceID) {
+				ruleID := res.RuleID
+				if ruleID == "" {
+					ruleID = role.RuleID
+				}
+
+				roles = append(roles, e.reasons(res.Actions, action, "granted by role "+role.ref()+patternLabel(res.ID)+ruleLabel(ruleID)+expiryLabel(res.ExpiresAt))...)
+			}
+		}
+	}
+
+	for _, ancestor := range e.ancestors[resourceID] {
+		inherited = append(inherited, e.inheritedReasons(raw, action, ancestor, resourceID)...)
+	}
+
+	for _, group := range [][]string{direct, patterns, roles, inherited, conditional} {
+		sort.Strings(group)
+		out.Reasons = append(out.Reasons, group...)
+	}
+
+	if len(out.Reasons) > 0 {
+		return out
+	}
+
+	lapsed := e.expiredReasons(subjectID, action, resourceID)
+	sort.Strings(lapsed)
+
+	out.Reasons = append(out.Reasons, lapsed...)
+
+	grants := e.Grants(subjectID)
+
+	found := false
+
+	for _, g := range grants {
+		if resourceMatches(g.ResourceID, resourceID) {
+			out.Reasons = append(out.Reasons, fmt.Sprintf("%s is granted only %v on %s", subjectID, g.Actions, g.ResourceID))
+			found = true
+		}
+	}
+
+	if found {
+		return out
+	}
+
+	out.Reasons = append(out.Reasons, fmt.Sprintf("%s has no grants on %s", subjectID, resourceID))
+
+	return out
+}
+
+// inheritedReasons returns a reason for each grant on ancestor, which contains resourceID, that
+// gives the subject the action.
+func (e *Explorer) inheritedReasons(raw policySubject, action, ancestor, resourceID string) []string {
+	var out []string
+
+	contains := " on " + ancestor + ", which contains " + resourceID
+
+	if res, ok := findResource(raw, ancestor); ok {
+		out = append(out, e.reasons(res.Actions, action, "granted directly"+contains+ruleLabel(res.RuleID)+expiryLabel(res.ExpiresAt))...)
+	}
+
+	for _, role := range subjectRoles(e.roles, raw) {
+		for _, res := range unconditional(role.Resources) {
+			if res.ID != ancestor {
+				continue
+			}
+
+			ruleID := res.RuleID
+			if ruleID == "" {
+				ruleID = role.RuleID
+			}
+
+			out = append(out, e.reasons(res.Actions, action, "granted by role "+role.ref()+contains+ruleLabel(ruleID)+expiryLabel(res.ExpiresAt))...)
+		}
+	}
+
+	return out
+}
+
+// conditionalReasons returns a reason for each conditional grant of the raw subject or its roles
+// that gives it the action on the resource, directly or through a resource containing it, if the
+// request meets the grant's conditions.
+func (e *Explorer) conditionalReasons(raw policySubject, action, resourceID string) []string {
+	var out []string
+
+	collect := func(resources []policyResource, source string) {
+		for _, res := range resources {
+			if res.Conditions == nil {
+				continue
+			}
+
+			label := source + patternLabel(res.ID)
+
+			switch {
+			case resourceMatches(res.ID, resourceID):
+			case containsString(e.ancestors[resourceID], res.ID):
+				label = source + " on " + res.ID + ", which contains " + resourceID
+			default:
+				continue
+			}
+
+			out = append(out, e.reasons(res.Actions, action, label+", only when checked "+res.Conditions.String())...)
+		}
+	}
+
+	collect(raw.Resources, "granted directly")
+
+	for _, role := range subjectRoles(e.roles, raw) {
+		collect(role.Resources, "granted by role "+role.ref())
+	}
+
+	return out
+}
+
+// reasons returns a reason for each granted action that is, matches, or implies the requested
+// action.
+func (e *Explorer) reasons(granted []string, action, source string) []string {
+	var out []string
+
+	for _, g := range granted {
+		switch {
+		case g == action:
+			out = append(out, fmt.Sprintf("%s %s", action, source))
+		case isPattern(g) && matchPattern(g, action):
+			out = append(out, fmt.Sprintf("%s matched by %s %s", action, g, source))
+		case containsString(e.closure[g], action):
+			out = append(out, fmt.Sprintf("%s implied by %s %s", action, g, source))
+		}
+	}
+
+	return out
+}
+
+// expiredReasons returns a reason for each expired grant that would otherwise give the subject the
+// action on the resource.
+func (e *Explorer) expiredReasons(subjectID, action, resourceID string) []string {
+	var out []string
+
+	collect := func(resources []policyResource, source string) {
+		for _, res := range resources {
+			if !resourceMatches(res.ID, resourceID) || !expired(res, e.evaluatedAt) {
+				continue
+			}
+
+			granted := e.reasons(res.Actions, action, source)
+			for _, reason := range granted {
+				out = append(out, fmt.Sprintf("%s, but expired at %s, before the evaluated time %s", reason, res.ExpiresAt.Format(time.RFC3339), e.evaluatedAt.Format(time.RFC3339)))
+			}
+		}
+	}
+
+	raw := rawSubject(e.all, subjectID)
+
+	collect(raw.Resources, "granted directly")
+
+	for _, role := range subjectRoles(e.allRoles, raw) {
+		collect(role.Resources, "granted by role "+role.ref())
+	}
+
+	return out
+}
+
+// subjectRoles returns the roles the subject references and the roles they include, each once.
+func subjectRoles(idx roleIndex, sub policySubject) []policyRole {
+	var out []policyRole
+
+	seen := make(map[string]bool)
+
+	for _, ref := range sub.Roles {
+		// Validated when the explorer was created.
+		roles, _ := idx.expand(ref)
+
+		for _, role := range roles {
+			if !seen[role.ref()] {
+				seen[role.ref()] = true
+				out = append(out, role)
+			}
+		}
+	}
+
+	return out
+}
+
+func rawSubject(p policy, id string) policySubject {
+	for _, sub := range p.Subjects {
+		if sub.ID == id {
+			return sub
+		}
+	}
+
+	return policySubject{}
+}
+
+// ruleLabel describes the rule ID of a grant in an explanation, if it has one.
+func ruleLabel(ruleID string) string {
+	if ruleID == "" {
+		return ""
+	}
+
+	return " (rule " + ruleID + ")"
+}
+
+// patternLabel describes the resource ID pattern of a grant in an explanation, if it is one.
+func patternLabel(id string) string {
+	if !isPattern(id) {
+		return ""
+	}
+
+	return " by pattern " + id
+}
+
+// expiryLabel describes when a grant expires in an explanation, if it does.
+func expiryLabel(expiresAt *time.Time) string {
+	if expiresAt == nil {
+		return ""
+	}
+
+	return " until " + expiresAt.Format(time.RFC3339)
+}
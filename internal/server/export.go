@@ -0,0 +1,325 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Export formats.
+const (
+	ExportYAML = "yaml"
+	ExportJSON = "json"
+)
+
+// EffectivePolicy is a policy with everything that affects evaluation resolved, for diffing and
+// for analyzers that do not understand the policy schema: each subject's grants with roles,
+// inherited grants, and implied actions expanded, and the source grants and conditions of every
+// action.
+type EffectivePolicy struct {
+	Subjects []EffectiveSubject `yaml:"subjects" json:"subjects"`
+}
+
+// EffectiveSubject is a subject's resolved grants.
+type EffectiveSubject struct {
+	ID          string                `yaml:"id" json:"id"`
+	Resources   []EffectiveResource   `yaml:"resources" json:"resources"`
+	Delegations []EffectiveDelegation `yaml:"delegations,omitempty" json:"delegations,omitempty"`
+	// Tenant is the tenant the subject is scoped to. Grants on resources of other tenants do not
+	// apply.
+	Tenant string `yaml:"tenant,omitempty" json:"tenant,omitempty"`
+	// Conditions restrict every grant of the subject.
+	Conditions *EffectiveConditions `yaml:"conditions,omitempty" json:"conditions,omitempty"`
+}
+
+// EffectiveResource is the actions a subject may perform on a resource, or on every resource
+// matching a pattern.
+type EffectiveResource struct {
+	ID      string            `yaml:"id" json:"id"`
+	Pattern bool              `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	Actions []EffectiveAction `yaml:"actions" json:"actions"`
+}
+
+// EffectiveAction is an action granted on a resource, with the grants it comes from.
+type EffectiveAction struct {
+	Action  string           `yaml:"action" json:"action"`
+	Pattern bool             `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	Sources []EffectiveGrant `yaml:"sources" json:"sources"`
+}
+
+// EffectiveGrant is a grant in the source policy giving an action.
+type EffectiveGrant struct {
+	// Subject or Role holds the grant. Role is an id@version reference.
+	Subject string `yaml:"subject,omitempty" json:"subject,omitempty"`
+	Role    string `yaml:"role,omitempty" json:"role,omitempty"`
+	// ResourceID and Action are as written in the grant. They differ from the effective resource
+	// and action when the grant is inherited from a containing resource or implies the action.
+	ResourceID string               `yaml:"resourceId" json:"resourceId"`
+	Action     string               `yaml:"action" json:"action"`
+	RuleID     string               `yaml:"ruleId,omitempty" json:"ruleId,omitempty"`
+	Inherited  bool                 `yaml:"inherited,omitempty" json:"inherited,omitempty"`
+	Implied    bool                 `yaml:"implied,omitempty" json:"implied,omitempty"`
+	Conditions *EffectiveConditions `yaml:"conditions,omitempty" json:"conditions,omitempty"`
+}
+
+// EffectiveDelegation is the actions a subject may perform on behalf of another.
+type EffectiveDelegation struct {
+	Subject string   `yaml:"subject" json:"subject"`
+	Actions []string `yaml:"actions" json:"actions"`
+}
+
+// EffectiveConditions are the conditions under which a grant applies.
+type EffectiveConditions struct {
+	// ExpiresAt is when the grant stops applying.
+	ExpiresAt *time.Time `yaml:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	// Networks are the CIDR ranges requests must come from.
+	Networks []string `yaml:"networks,omitempty" json:"networks,omitempty"`
+	// ValidAfter, ValidBefore, and Attributes are the conditions of a conditional grant, evaluated
+	// for each check.
+	ValidAfter  *time.Time        `yaml:"validAfter,omitempty" json:"validAfter,omitempty"`
+	ValidBefore *time.Time        `yaml:"validBefore,omitempty" json:"validBefore,omitempty"`
+	Attributes  map[string]string `yaml:"attributes,omitempty" json:"attributes,omitempty"`
+}
+
+// Export reads the policy at policyPath, applies any overlays, and writes it to w in the given
+// format: its canonical form, as written by Snapshot, or if effective is set, its EffectivePolicy.
+// Grants are included whether or not they have expired. Files are read with read, or only
+// plaintext policies are accepted if read is nil.
+func Export(policyPath string, overlayPaths []string, w io.Writer, read ReadFileFunc, format string, effective bool) error {
+	p, err := readPolicyFiles(readerOrDefault(read), policyPath, overlayPaths...)
+	if err != nil {
+		return err
+	}
+
+	var out any = canonicalPolicy(p)
+
+	if effective {
+		out, err = effectivePolicy(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case ExportYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+
+		return enc.Close()
+	case ExportJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(out)
+	default:
+		return fmt.Errorf("export format '%s': %w", format, ErrInvalidValue)
+	}
+}
+
+func effectivePolicy(p policy) (EffectivePolicy, error) {
+	compiled, err := compileSubjects(p)
+	if err != nil {
+		return EffectivePolicy{}, err
+	}
+
+	expiries, err := grantExpiries(p)
+	if err != nil {
+		return EffectivePolicy{}, err
+	}
+
+	out := EffectivePolicy{Subjects: make([]EffectiveSubject, 0, len(compiled))}
+
+	for _, sub := range compiled {
+		es := EffectiveSubject{
+			ID:        sub.ID,
+			Resources: effectiveResources(sub, expiries),
+			Tenant:    sub.Tenant,
+		}
+
+		for _, g := range sub.conditional {
+			es.Resources = mergeEffectiveResources(es.Resources, conditionalResources(g, expiries))
+		}
+
+		for _, del := range sub.Delegations {
+			es.Delegations = append(es.Delegations, EffectiveDelegation{Subject: del.Subject, Actions: sortedUnique(del.Actions)})
+		}
+
+		sort.SliceStable(es.Delegations, func(i, j int) bool {
+			return es.Delegations[i].Subject < es.Delegations[j].Subject
+		})
+
+		if len(sub.AllowedNetworks) > 0 {
+			es.Conditions = &EffectiveConditions{Networks: sortedUnique(sub.AllowedNetworks)}
+		}
+
+		out.Subjects = append(out.Subjects, es)
+	}
+
+	sort.SliceStable(out.Subjects, func(i, j int) bool {
+		return out.Subjects[i].ID < out.Subjects[j].ID
+	})
+
+	return out, nil
+}
+
+// effectiveResources returns the entries of a compiled subject that apply during evaluation,
+// sorted.
+func effectiveResources(sub policySubject, expiries map[grantRef]*time.Time) []EffectiveResource {
+	entries := effectiveEntries(sub)
+	out := make([]EffectiveResource, 0, len(entries))
+
+	for _, res := range entries {
+		er := EffectiveResource{ID: res.ID, Pattern: isPattern(res.ID)}
+
+		for _, action := range sortedUnique(res.Actions) {
+			ea := EffectiveAction{Action: action, Pattern: isPattern(action)}
+
+			for _, ref := range res.rules[action] {
+				g := EffectiveGrant{
+					Subject:    ref.Subject,
+					Role:       ref.Role,
+					ResourceID: ref.ResourceID,
+					Action:     ref.Action,
+					RuleID:     ref.RuleID,
+					Inherited:  ref.ResourceID != res.ID,
+					Implied:    ref.Action != action,
+				}
+
+				if expiresAt := expiries[ref]; expiresAt != nil {
+					g.Conditions = &EffectiveConditions{ExpiresAt: expiresAt}
+				}
+
+				ea.Sources = append(ea.Sources, g)
+			}
+
+			sort.SliceStable(ea.Sources, func(i, j int) bool {
+				return effectiveGrantKey(ea.Sources[i]) < effectiveGrantKey(ea.Sources[j])
+			})
+
+			er.Actions = append(er.Actions, ea)
+		}
+
+		out = append(out, er)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+
+	return out
+}
+
+// conditionalResources returns the entries of a conditional grant, with its conditions set on
+// every source.
+func conditionalResources(g conditionalGrant, expiries map[grantRef]*time.Time) []EffectiveResource {
+	out := effectiveResources(g.grants, expiries)
+
+	for _, er := range out {
+		for _, ea := range er.Actions {
+			for k := range ea.Sources {
+				c := &EffectiveConditions{
+					ValidAfter:  g.conditions.ValidAfter,
+					ValidBefore: g.conditions.ValidBefore,
+					Attributes:  g.conditions.Attributes,
+				}
+
+				if ea.Sources[k].Conditions != nil {
+					c.ExpiresAt = ea.Sources[k].Conditions.ExpiresAt
+				}
+
+				ea.Sources[k].Conditions = c
+			}
+		}
+	}
+
+	return out
+}
+
+// mergeEffectiveResources adds the actions and sources of the resources in add to those of the
+// same resource in out, keeping both sorted.
+func mergeEffectiveResources(out, add []EffectiveResource) []EffectiveResource {
+	for _, er := range add {
+		i := slices.IndexFunc(out, func(existing EffectiveResource) bool {
+			return existing.ID == er.ID
+		})
+		if i < 0 {
+			out = append(out, er)
+
+			continue
+		}
+
+		for _, ea := range er.Actions {
+			j := slices.IndexFunc(out[i].Actions, func(existing EffectiveAction) bool {
+				return existing.Action == ea.Action
+			})
+			if j < 0 {
+				out[i].Actions = append(out[i].Actions, ea)
+
+				continue
+			}
+
+			out[i].Actions[j].Sources = append(out[i].Actions[j].Sources, ea.Sources...)
+		}
+
+		sort.SliceStable(out[i].Actions, func(a, b int) bool {
+			return out[i].Actions[a].Action < out[i].Actions[b].Action
+		})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+
+	return out
+}
+
+func effectiveGrantKey(g EffectiveGrant) string {
+	return g.Subject + "\x00" + g.Role + "\x00" + g.ResourceID + "\x00" + g.Action + "\x00" + g.RuleID
+}
+
+// grantExpiries maps each action of the policy's subject and role grants that expire to the
+// expiry of the entry evaluation uses.
+func grantExpiries(p policy) (map[grantRef]*time.Time, error) {
+	out := make(map[grantRef]*time.Time)
+
+	add := func(res policyResource, subject, role, ruleID string) {
+		for _, action := range res.Actions {
+			out[grantRef{Subject: subject, Role: role, ResourceID: res.ID, Action: action, RuleID: ruleID}] = res.ExpiresAt
+		}
+	}
+
+	for _, sub := range p.Subjects {
+		for _, res := range sub.Resources {
+			add(res, sub.ID, "", res.RuleID)
+		}
+	}
+
+	idx, err := newRoleIndex(p.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sub := range p.Subjects {
+		for _, role := range subjectRoles(idx, sub) {
+			for _, res := range role.Resources {
+				ruleID := res.RuleID
+				if ruleID == "" {
+					ruleID = role.RuleID
+				}
+
+				add(res, "", role.ref(), ruleID)
+			}
+		}
+	}
+
+	return out, nil
+}
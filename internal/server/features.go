@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/features"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *server) ListFeatures(_ context.Context, _ *admin.ListFeaturesRequest) (*admin.ListFeaturesResponse, error) {
+	s.logger.Info("received ListFeatures request")
+
+	resp := &admin.ListFeaturesResponse{}
+
+	for _, st := range s.features.States() {
+		resp.Features = append(resp.Features, featureProto(st))
+	}
+
+	return resp, nil
+}
+
+func (s *server) SetFeature(_ context.Context, req *admin.SetFeatureRequest) (*admin.SetFeatureResponse, error) {
+	s.logger.Info("received SetFeature request")
+
+	if err := s.requireAdminToken("changing feature flags"); err != nil {
+		return nil, err
+	}
+
+	f, err := features.Parse(req.Name)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid feature: %s", err)
+	}
+
+	switch {
+	case req.Clear && req.Subject == "":
+		return nil, status.Errorf(codes.InvalidArgument, "clearing an override requires a subject")
+	case req.Clear:
+		s.features.Clear(f, req.Subject)
+	default:
+		s.features.Set(f, req.Subject, req.Enabled)
+	}
+
+	s.logger.Infow("feature flag changed", "feature", f, "subject", req.Subject, "enabled", req.Enabled, "clear", req.Clear)
+
+	return &admin.SetFeatureResponse{Feature: featureProto(s.features.State(f))}, nil
+}
+
+func featureProto(st features.State) *admin.Feature {
+	return &admin.Feature{
+		Name:        string(st.Flag),
+		Description: st.Flag.Description(),
+		Enabled:     st.Enabled,
+		Subjects:    st.Subjects,
+	}
+}
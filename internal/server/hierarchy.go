@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+)
+
+// validateHierarchy checks that resource containment names resources by exact ID and has no
+// cycles.
+func validateHierarchy(c policy) error {
+	parents := make([]string, 0, len(c.Contains))
+
+	for parent, children := range c.Contains {
+		for _, id := range append([]string{parent}, children...) {
+			if id == "" || isPattern(id) {
+				return fmt.Errorf("contains: resource ID '%s' must be an exact ID: %w", id, ErrInvalidValue)
+			}
+		}
+
+		parents = append(parents, parent)
+	}
+
+	sort.Strings(parents)
+
+	descendants := transitiveClosure(c.Contains)
+
+	// The closure leaves a resource out of its own descendants, so look for it below its children.
+	for _, parent := range parents {
+		for _, child := range c.Contains[parent] {
+			if child == parent || containsString(descendants[child], parent) {
+				return fmt.Errorf("contains: resource %s contains itself: %w", parent, ErrInvalidValue)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ancestorResources inverts a table of descendants, mapping each resource to every resource that
+// contains it, directly or indirectly, sorted.
+func ancestorResources(descendants map[string][]string) map[string][]string {
+	out := make(map[string][]string)
+
+	for parent, children := range descendants {
+		for _, child := range children {
+			out[child] = append(out[child], parent)
+		}
+	}
+
+	for _, parents := range out {
+		sort.Strings(parents)
+	}
+
+	return out
+}
+
+// expandHierarchy returns a copy of sub whose grants on a resource also apply to every resource
+// it contains, directly or indirectly. Only the entry checkAccess uses for a resource is
+// inherited, and grants on resource ID patterns are not.
+func expandHierarchy(sub policySubject, descendants map[string][]string) policySubject {
+	if len(descendants) == 0 {
+		return sub
+	}
+
+	last := make(map[string]int, len(sub.Resources))
+	for i, res := range sub.Resources {
+		last[res.ID] = i
+	}
+
+	out := sub
+	out.Resources = append([]policyResource(nil), sub.Resources...)
+
+	for i, res := range sub.Resources {
+		if last[res.ID] != i {
+			continue
+		}
+
+		for _, child := range descendants[res.ID] {
+			out.Resources = mergeResourceActions(out.Resources, policyResource{ID: child, Actions: res.Actions, rules: res.rules})
+		}
+	}
+
+	return out
+}
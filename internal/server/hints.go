@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// maxHintResources is the most other resources a hint lists a denied action as granted on.
+const maxHintResources = 3
+
+// denialHintsDetail is the Detail of the DebugInfo carrying denial hints.
+const denialHintsDetail = "developer hints for the denied actions; their wording may change"
+
+// withDenialHints adds a DebugInfo detail to err, a denial of the actions of req given by their
+// indexes in results, with a hint for each explaining why the policy does not give them to
+// subjectID, if denial hints are enabled. allowedHint explains the denial of an action the
+// subject's grants do allow. If backends are configured, each hint ends with their decisions.
+// Each stack entry has the form actions[i]: hint.
+func (s *server) withDenialHints(err error, st *policyState, subjectID string, req *authorization.CheckAccessRequest, results *checkResults, allowedHint string) error {
+	if !s.denialHints || st.explorer == nil {
+		return err
+	}
+
+	stat, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	entries := make([]string, 0, len(results.denied))
+
+	for k, i := range results.denied {
+		action := req.Actions[i]
+		hint := st.explorer.denialHint(subjectID, action.Action, action.ResourceId, allowedHint)
+
+		if backends := results.backends[k]; len(backends) > 0 {
+			hint += "; backends decided " + strings.Join(backendDecisionStrings(backends), ", ")
+		}
+
+		entries = append(entries, fmt.Sprintf("actions[%d]: %s", i, hint))
+	}
+
+	withHints, detailErr := stat.WithDetails(&errdetails.DebugInfo{
+		StackEntries: entries,
+		Detail:       denialHintsDetail,
+	})
+	if detailErr != nil {
+		return err
+	}
+
+	return withHints.Err()
+}
+
+// denialHint explains why the subject may not perform the action on the resource: the subject's
+// nearest grants on the resource, or the other resources it has the action on, which often point
+// to a mistyped resource ID. allowedHint is given if the subject's grants do allow the action.
+func (e *Explorer) denialHint(subjectID, action, resourceID, allowedHint string) string {
+	explanation := e.Explain(subjectID, action, resourceID)
+	if explanation.Allowed {
+		return allowedHint
+	}
+
+	reasons := explanation.Reasons
+
+	var elsewhere []string
+
+	for _, g := range e.Grants(subjectID) {
+		if !resourceMatches(g.ResourceID, resourceID) && containsString(g.Actions, action) {
+			elsewhere = append(elsewhere, g.ResourceID)
+		}
+	}
+
+	if len(elsewhere) > 0 {
+		more := ""
+		if len(elsewhere) > maxHintResources {
+			more = fmt.Sprintf(" and %d more", len(elsewhere)-maxHintResources)
+			elsewhere = elsewhere[:maxHintResources]
+		}
+
+		reasons = append(reasons, fmt.Sprintf("%s is granted %s on %s%s", subjectID, action, strings.Join(elsewhere, ", "), more))
+	}
+
+	return strings.Join(reasons, "; ")
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// defaultPolicyHistorySize is the number of previous policies kept in memory by default.
+const defaultPolicyHistorySize = 5
+
+// ReloadGuard rejects policy updates that remove much more of the policy than a push should. It
+// protects shared environments from truncated or otherwise bad policies.
+type ReloadGuard struct {
+	// MaxSubjectDropPercent rejects an update removing more than this percentage of the active
+	// policy's subjects. Zero disables the check.
+	MaxSubjectDropPercent float64
+	// MaxGrantDropPercent rejects an update removing more than this percentage of the active
+	// policy's grant actions. Zero disables the check.
+	MaxGrantDropPercent float64
+}
+
+// check returns an error wrapping ErrPolicyRejected if replacing current with next fails a check.
+func (g ReloadGuard) check(current, next policy) error {
+	if err := checkDrop("subjects", len(current.Subjects), len(next.Subjects), g.MaxSubjectDropPercent); err != nil {
+		return err
+	}
+
+	return checkDrop("grant actions", len(policyGrants(current)), len(policyGrants(next)), g.MaxGrantDropPercent)
+}
+
+func checkDrop(what string, before, after int, maxPercent float64) error {
+	if maxPercent <= 0 || before == 0 || after >= before {
+		return nil
+	}
+
+	dropped := 100 * float64(before-after) / float64(before)
+	if dropped > maxPercent {
+		return fmt.Errorf("%s would drop from %d to %d (%.1f%%, limit %.1f%%): %w", what, before, after, dropped, maxPercent, ErrPolicyRejected)
+	}
+
+	return nil
+}
+
+// rejectPolicy publishes the rejection of a policy update.
+func (s *server) rejectPolicy(source, revision string, reason error) {
+	current := s.state.Load().info
+
+	s.bus.Publish(events.PolicyRejected{
+		Source:         source,
+		Revision:       revision,
+		ActiveRevision: current.Revision,
+		Reason:         reason.Error(),
+		Time:           s.now(),
+	})
+}
+
+// remember adds a replaced policy state to the history, dropping the oldest states beyond the
+// configured size. The caller must hold updateMu.
+func (s *server) remember(st *policyState) {
+	if st == nil || s.historySize <= 0 {
+		return
+	}
+
+	s.history = append(s.history, st)
+
+	if len(s.history) > s.historySize {
+		s.history = append(s.history[:0:0], s.history[len(s.history)-s.historySize:]...)
+	}
+}
+
+// rollback makes the newest retained state with the given revision active again, keeping the
+// replaced state in the history. The caller must hold updateMu.
+func (s *server) rollback(revision string, now time.Time) (from, to *policyState, err error) {
+	idx := -1
+
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if s.history[i].info.Revision == revision {
+			idx = i
+
+			break
+		}
+	}
+
+	if idx < 0 {
+		return nil, nil, fmt.Errorf("revision %s: %w", revision, ErrMissingValue)
+	}
+
+	target := s.history[idx]
+
+	// Grants may have expired while the snapshot was retained.
+	evaluated := s.evaluatedAt(now)
+
+	next := target
+	if len(grantsExpiring(target.policy, target.compiledAt, evaluated)) > 0 {
+		next, err = s.newPolicyState(target.policy, evaluated)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		copied := *target
+		next = &copied
+	}
+
+	next.info = target.info
+	next.info.LoadedAt = now
+
+	from = s.state.Load()
+
+	s.history = append(s.history[:idx:idx], s.history[idx+1:]...)
+	s.state.Store(next)
+	s.remember(from)
+	s.scheduleExpirySweep(next.policy, evaluated)
+
+	return from, next, nil
+}
+
+func policySnapshot(st *policyState, active bool) *admin.PolicySnapshot {
+	return &admin.PolicySnapshot{
+		Source:   st.info.Source,
+		Revision: st.info.Revision,
+		LoadedAt: timestamppb.New(st.info.LoadedAt),
+		Active:   active,
+		Subjects: uint32(len(st.policy.Subjects)),
+	}
+}
+
+func (s *server) ListPolicySnapshots(_ context.Context, _ *admin.ListPolicySnapshotsRequest) (*admin.ListPolicySnapshotsResponse, error) {
+	s.logger.Info("received ListPolicySnapshots request")
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	resp := &admin.ListPolicySnapshotsResponse{
+		Snapshots: []*admin.PolicySnapshot{policySnapshot(s.state.Load(), true)},
+	}
+
+	for i := len(s.history) - 1; i >= 0; i-- {
+		resp.Snapshots = append(resp.Snapshots, policySnapshot(s.history[i], false))
+	}
+
+	return resp, nil
+}
+
+func (s *server) RollbackPolicy(ctx context.Context, req *admin.RollbackPolicyRequest) (*admin.RollbackPolicyResponse, error) {
+	s.logger.Info("received RollbackPolicy request")
+
+	if err := s.requireAdminToken("rolling back the policy"); err != nil {
+		return nil, err
+	}
+
+	if req.Revision == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "revision is required")
+	}
+
+	if req.Reason == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "reason is required")
+	}
+
+	if err := s.checkPolicyWritable(); err != nil {
+		return nil, err
+	}
+
+	var peerAddr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddr = p.Addr.String()
+	}
+
+	now := s.now()
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	from, to, err := s.rollback(req.Revision, now)
+	if err != nil {
+		if errors.Is(err, ErrMissingValue) {
+			return nil, status.Errorf(codes.NotFound, "no retained snapshot: %s", err)
+		}
+
+		return nil, status.Errorf(codes.FailedPrecondition, "rolling back: %s", err)
+	}
+
+	s.bus.Publish(events.PolicyRolledBack{
+		Source:       to.info.Source,
+		Revision:     to.info.Revision,
+		FromRevision: from.info.Revision,
+		RequestedBy:  req.RequestedBy,
+		Peer:         peerAddr,
+		Reason:       req.Reason,
+		Time:         now,
+	})
+
+	s.bus.Publish(events.PolicyLoaded{
+		Source:   to.info.Source,
+		Revision: to.info.Revision,
+		Time:     now,
+	})
+
+	return &admin.RollbackPolicyResponse{Policy: policySnapshot(to, true)}, nil
+}
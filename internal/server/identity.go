@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/identity"
+
+	"google.golang.org/grpc/codes"
+)
+
+// validateIdentities checks that every workload identity has a unique ID and a token variable.
+func validateIdentities(p policy) error {
+	seen := make(map[string]bool, len(p.Identities))
+
+	for _, id := range p.Identities {
+		if id.ID == "" {
+			return fmt.Errorf("identity ID is empty: %w", ErrMissingValue)
+		}
+
+		if id.TokenEnvVar == "" {
+			return fmt.Errorf("identity %s: token variable is empty: %w", id.ID, ErrMissingValue)
+		}
+
+		if seen[id.ID] {
+			return fmt.Errorf("identity %s: %w", id.ID, ErrDuplicateValue)
+		}
+
+		seen[id.ID] = true
+	}
+
+	return nil
+}
+
+// resolveIdentities returns the access token of each workload identity.
+func (s *server) resolveIdentities(p policy) (map[string]string, error) {
+	out := make(map[string]string, len(p.Identities))
+
+	for _, id := range p.Identities {
+		token := s.getenv(id.TokenEnvVar)
+		if token == "" {
+			return nil, fmt.Errorf("identity %s: %s: %w", id.ID, id.TokenEnvVar, ErrMissingValue)
+		}
+
+		out[id.ID] = token
+	}
+
+	return out, nil
+}
+
+// mergeIdentities returns base with the identities in overlay added, replacing those with the same
+// ID.
+func mergeIdentities(base, overlay []policyIdentity) []policyIdentity {
+	out := append([]policyIdentity(nil), base...)
+
+	for _, id := range overlay {
+		replaced := false
+
+		for i, existing := range out {
+			if existing.ID == id.ID {
+				out[i] = id
+				replaced = true
+
+				break
+			}
+		}
+
+		if !replaced {
+			out = append(out, id)
+		}
+	}
+
+	return out
+}
+
+func (s *server) GetAccessToken(_ context.Context, _ *identity.GetAccessTokenRequest) (*identity.GetAccessTokenResponse, error) {
+	s.logger.Info("received GetAccessToken request")
+
+	st := s.state.Load()
+
+	id := s.workloadIdentity
+	if id == "" {
+		if len(st.identities) != 1 {
+			return nil, s.deny(codes.FailedPrecondition, reasonWorkloadIdentityRequired, "identities", strconv.Itoa(len(st.identities)))
+		}
+
+		for only := range st.identities {
+			id = only
+		}
+	}
+
+	token, ok := st.identities[id]
+	if !ok {
+		return nil, s.deny(codes.FailedPrecondition, reasonUnknownIdentity, "identity", id)
+	}
+
+	return &identity.GetAccessTokenResponse{Token: token}, nil
+}
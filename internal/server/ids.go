@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// validateIDs checks that subjects, roles, resources, actions, and token sources are named,
+// that no name has surrounding whitespace or control characters, which make it impossible to match
+// from a request that looks the same, and that subject IDs are unique.
+func validateIDs(p policy) error {
+	seen := make(map[string]struct{}, len(p.Subjects))
+
+	for _, sub := range p.Subjects {
+		if err := checkID("subject ID", sub.ID); err != nil {
+			return err
+		}
+
+		if _, ok := seen[sub.ID]; ok {
+			return fmt.Errorf("%s: subject is defined more than once: %w", sub.ID, ErrDuplicateValue)
+		}
+
+		seen[sub.ID] = struct{}{}
+
+		for i, tok := range sub.Tokens {
+			if err := tok.validate(i); err != nil {
+				return fmt.Errorf("%s: %w", sub.ID, err)
+			}
+		}
+
+		if err := checkResourceIDs(sub.Resources); err != nil {
+			return fmt.Errorf("%s: %w", sub.ID, err)
+		}
+
+		if err := checkDenies(sub.Deny); err != nil {
+			return fmt.Errorf("%s: %w", sub.ID, err)
+		}
+	}
+
+	for _, role := range p.Roles {
+		if err := checkID("role ID", role.ID); err != nil {
+			return fmt.Errorf("roles: %w", err)
+		}
+
+		if err := checkResourceIDs(role.Resources); err != nil {
+			return fmt.Errorf("role %s: %w", role.ref(), err)
+		}
+
+		if err := checkDenies(role.Deny); err != nil {
+			return fmt.Errorf("role %s: %w", role.ref(), err)
+		}
+	}
+
+	return nil
+}
+
+func checkResourceIDs(resources []policyResource) error {
+	for _, res := range resources {
+		if err := checkID("resource ID", res.ID); err != nil {
+			return err
+		}
+
+		for _, action := range res.Actions {
+			if err := checkID("action", action); err != nil {
+				return fmt.Errorf("%s: %w", res.ID, err)
+			}
+		}
+
+		if err := res.Conditions.validate(); err != nil {
+			return fmt.Errorf("%s: %w", res.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// checkID returns an error describing what is wrong with a name of the given kind, if anything.
+// The error starts with the name, so it can be located in the policy.
+func checkID(kind, id string) error {
+	if id == "" {
+		return fmt.Errorf("%s is empty: %w", kind, ErrMissingValue)
+	}
+
+	if strings.TrimSpace(id) != id || strings.IndexFunc(id, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%s: %s has surrounding whitespace or control characters: %w", id, kind, ErrInvalidValue)
+	}
+
+	return nil
+}
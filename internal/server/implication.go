@@ -0,0 +1,94 @@
+package server
+
+// transitiveClosure returns the transitive closure of the given table, such as an implication
+// table mapping each action to every action it implies, directly or indirectly.
+func transitiveClosure(table map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(table))
+
+	for key := range table {
+		seen := map[string]struct{}{key: {}}
+		queue := append([]string(nil), table[key]...)
+
+		var closure []string
+
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+
+			if _, ok := seen[next]; ok {
+				continue
+			}
+
+			seen[next] = struct{}{}
+			closure = append(closure, next)
+			queue = append(queue, table[next]...)
+		}
+
+		out[key] = closure
+	}
+
+	return out
+}
+
+// expandActions returns actions with every implied action appended.
+func expandActions(actions []string, closure map[string][]string) []string {
+	out := append([]string(nil), actions...)
+
+	for _, action := range actions {
+		for _, implied := range closure[action] {
+			if !containsString(out, implied) {
+				out = append(out, implied)
+			}
+		}
+	}
+
+	return out
+}
+
+// expandSubject returns a copy of sub with implied actions added to its resources and
+// delegations, so evaluation only needs to look for the requested action.
+func expandSubject(sub policySubject, closure map[string][]string) policySubject {
+	if len(closure) == 0 {
+		return sub
+	}
+
+	out := sub
+
+	out.Resources = make([]policyResource, len(sub.Resources))
+	for i, res := range sub.Resources {
+		res.Actions = expandActions(res.Actions, closure)
+		res.rules = expandRules(res.rules, closure)
+		out.Resources[i] = res
+	}
+
+	out.Delegations = make([]policyDelegation, len(sub.Delegations))
+	for i, del := range sub.Delegations {
+		del.Actions = expandActions(del.Actions, closure)
+		out.Delegations[i] = del
+	}
+
+	return out
+}
+
+// mergeTables unions the overlay's table, such as an implication table, into the base table.
+func mergeTables(base, overlay map[string][]string) map[string][]string {
+	if len(base) == 0 && len(overlay) == 0 {
+		return nil
+	}
+
+	out := make(map[string][]string, len(base)+len(overlay))
+
+	for key, values := range base {
+		out[key] = append([]string(nil), values...)
+	}
+
+	for key, values := range overlay {
+		for _, v := range values {
+			if !containsString(out[key], v) {
+				out[key] = append(out[key], v)
+			}
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,79 @@
+package server
+
+// grantIndex indexes a compiled subject's grants by resource ID and action, so access checks take
+// constant time however many grants the subject has, rather than scanning them. Grants whose
+// resource ID is a pattern are still matched in turn, but only those grants.
+type grantIndex struct {
+	// Actions of each of the subject's entries, in order
+	entries []indexedActions
+	// Position of the applying entry for each resource ID: the last one
+	byID map[string]int
+	// Positions of the entries whose resource ID is a pattern, in order
+	patterns []int
+}
+
+// indexedActions are the actions of a subject's entry for a resource: those granted as written,
+// and those that are patterns.
+type indexedActions struct {
+	actions  map[string]struct{}
+	patterns []string
+}
+
+// newGrantIndex indexes the grants of a compiled subject.
+func newGrantIndex(sub policySubject) *grantIndex {
+	idx := &grantIndex{
+		entries: make([]indexedActions, len(sub.Resources)),
+		byID:    make(map[string]int, len(sub.Resources)),
+	}
+
+	for i, res := range sub.Resources {
+		entry := indexedActions{actions: make(map[string]struct{}, len(res.Actions))}
+
+		for _, action := range res.Actions {
+			entry.actions[action] = struct{}{}
+
+			if isPattern(action) {
+				entry.patterns = append(entry.patterns, action)
+			}
+		}
+
+		idx.entries[i] = entry
+		idx.byID[res.ID] = i
+
+		if isPattern(res.ID) {
+			idx.patterns = append(idx.patterns, i)
+		}
+	}
+
+	return idx
+}
+
+// allows reports whether the entry grants action, as written or through an action pattern.
+func (a indexedActions) allows(action string) bool {
+	if _, ok := a.actions[action]; ok {
+		return true
+	}
+
+	for _, pattern := range a.patterns {
+		if matchPattern(pattern, action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkAccess implements checkAccess for a subject whose grants are indexed by idx.
+func (idx *grantIndex) checkAccess(sub policySubject, action, resourceID string) bool {
+	if i, ok := idx.byID[resourceID]; ok && idx.entries[i].allows(action) {
+		return true
+	}
+
+	for _, i := range idx.patterns {
+		if id := sub.Resources[i].ID; id != resourceID && matchPattern(id, resourceID) && idx.entries[i].allows(action) {
+			return true
+		}
+	}
+
+	return false
+}
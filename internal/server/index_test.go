@@ -0,0 +1,39 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+)
+
+// BenchmarkCheckAccess checks one action of a subject with more and more grants. Grants are
+// indexed, so the time per check should not grow with their number.
+func BenchmarkCheckAccess(b *testing.B) {
+	for _, grants := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("grants=%d", grants), func(b *testing.B) {
+			resources := make([]policyResource, grants)
+			for i := range resources {
+				resources[i] = policyResource{ID: fmt.Sprintf("resource-%d", i), Actions: []string{"read", "update"}}
+			}
+
+			s := newTestServer(b, policy{Subjects: []policySubject{testSubject("alice", resources...)}})
+
+			// A grant in the middle, so a scan would have to examine half of them.
+			action := &authorization.AccessRequestAction{Action: "update", ResourceId: fmt.Sprintf("resource-%d", grants/2)}
+
+			if err := checkTestAccess(s, "alice", action); err != nil {
+				b.Fatalf("check denied: %s", err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if err := checkTestAccess(s, "alice", action); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
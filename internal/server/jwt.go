@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/jwtverify"
+
+	"google.golang.org/grpc/codes"
+)
+
+// validateJWTSubjects checks that every JWT subject names an issuer and subject, and that no two
+// policy subjects share one.
+func validateJWTSubjects(p policy) error {
+	owners := make(map[policyJWTSubject]string)
+
+	for _, sub := range p.Subjects {
+		for _, js := range sub.JWTSubjects {
+			if js.Issuer == "" || js.Subject == "" {
+				return fmt.Errorf("%s: JWT subject needs an issuer and a subject: %w", sub.ID, ErrMissingValue)
+			}
+
+			if owner, ok := owners[js]; ok && owner != sub.ID {
+				return fmt.Errorf("%s: JWT subject %s from %s is already mapped to %s: %w", sub.ID, js.Subject, js.Issuer, owner, ErrDuplicateValue)
+			}
+
+			owners[js] = sub.ID
+		}
+	}
+
+	return nil
+}
+
+// authenticateJWT verifies a JWT credential and returns the policy subject its issuer and subject
+// are mapped to. The credential is never logged.
+func (s *server) authenticateJWT(ctx context.Context, st *policyState, credential string) (policySubject, error) {
+	id, err := s.jwt.Verify(ctx, credential)
+	if err != nil {
+		if errors.Is(err, jwtverify.ErrKeysUnavailable) {
+			s.logger.Errorw("failed to verify JWT", "error", err)
+
+			return policySubject{}, s.deny(codes.Unavailable, reasonSigningKeysUnavailable)
+		}
+
+		s.logger.Warnw("rejected JWT", "error", err)
+
+		return policySubject{}, s.invalidCredential(reasonJWTInvalid, "error", err.Error())
+	}
+
+	sub, ok := st.jwtSubjects[id]
+	if !ok {
+		s.logger.Warnw("rejected JWT not mapped to a subject", "issuer", id.Issuer, "jwt_subject", id.Subject)
+
+		return policySubject{}, s.invalidCredential(reasonJWTSubjectUnmapped, "issuer", id.Issuer, "jwt_subject", id.Subject)
+	}
+
+	return sub, nil
+}
+
+// invalidCredential returns the error for a rejected credential, with the given reason code and
+// metadata if credential checks are enabled.
+func (s *server) invalidCredential(reason string, fields ...string) error {
+	if !s.credentialChecks {
+		return s.deny(codes.Unauthenticated, reasonInvalidCredential)
+	}
+
+	return s.deny(codes.Unauthenticated, reason, fields...)
+}
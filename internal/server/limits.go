@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+)
+
+// subjectCounter counts the connections or streams held by each subject.
+type subjectCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newSubjectCounter() *subjectCounter {
+	return &subjectCounter{counts: make(map[string]int)}
+}
+
+// acquire counts one more for subjectID unless it already holds max. A max of zero is unlimited.
+func (c *subjectCounter) acquire(subjectID string, max int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if max > 0 && c.counts[subjectID] >= max {
+		return false
+	}
+
+	c.counts[subjectID]++
+
+	return true
+}
+
+func (c *subjectCounter) release(subjectID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[subjectID]--
+
+	if c.counts[subjectID] <= 0 {
+		delete(c.counts, subjectID)
+	}
+}
+
+// rpcKey is the context key of an RPC's state.
+type rpcKey struct{}
+
+// rpcState is the state the server keeps for an RPC while it is handled.
+type rpcState struct {
+	// The subject counted against the stream limit for the RPC, if any
+	subject string
+}
+
+// admitSubject checks the connection and stream limits for a subject authenticated on the
+// connection and RPC ctx belongs to, stamping the connection with it and counting the RPC against
+// its streams. Each connection and RPC is counted for the first subject it authenticates.
+func (s *server) admitSubject(ctx context.Context, subjectID string) error {
+	if err := s.stampConnection(ctx, subjectID); err != nil {
+		return err
+	}
+
+	rpc, _ := ctx.Value(rpcKey{}).(*rpcState)
+	if s.maxSubjectStreams == 0 || rpc == nil || rpc.subject != "" {
+		return nil
+	}
+
+	if !s.subjectStreams.acquire(subjectID, s.maxSubjectStreams) {
+		s.logger.Warnw("rejected request over the subject's stream limit", "subject", subjectID, "limit", s.maxSubjectStreams)
+
+		return s.deny(codes.ResourceExhausted, reasonStreamLimitExceeded, "subject", subjectID, "limit", strconv.Itoa(s.maxSubjectStreams))
+	}
+
+	rpc.subject = subjectID
+
+	return nil
+}
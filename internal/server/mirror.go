@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mirrorPolicy returns a copy of p that another instance can serve without the secrets only this
+// one has: every token is replaced by its SHA-256 digest, and OAuth2 clients and workload
+// identities, whose secrets cannot be hashed, are left out.
+func (s *server) mirrorPolicy(p policy) (policy, error) {
+	out := p
+	out.Identities = nil
+	out.Subjects = make([]policySubject, len(p.Subjects))
+
+	for i, sub := range p.Subjects {
+		sub.Clients = nil
+		sub.Tokens = make([]policyToken, len(p.Subjects[i].Tokens))
+
+		for j, tok := range p.Subjects[i].Tokens {
+			if tok.SHA256 != "" {
+				sub.Tokens[j] = tok
+
+				continue
+			}
+
+			value, err := resolveToken(tok, s.getenv, s.tokenCommands)
+			if err != nil {
+				return policy{}, fmt.Errorf("%s: %s: %w", sub.ID, tok.ref(j), err)
+			}
+
+			if value == "" {
+				return policy{}, fmt.Errorf("%s: %s: %w", sub.ID, tok.ref(j), ErrMissingToken)
+			}
+
+			digest := digestToken(value)
+			sub.Tokens[j] = policyToken{SHA256: hex.EncodeToString(digest[:])}
+		}
+
+		out.Subjects[i] = sub
+	}
+
+	return out, nil
+}
+
+// checkPolicyWritable returns a FailedPrecondition status if the active policy is mirrored from
+// another instance, and so may only be changed there.
+func (s *server) checkPolicyWritable() error {
+	if s.mirroredFrom == "" {
+		return nil
+	}
+
+	return status.Errorf(codes.FailedPrecondition, "the policy is mirrored from %s and is read-only; change it there", s.mirroredFrom)
+}
+
+func (s *server) ExportPolicy(_ context.Context, _ *admin.ExportPolicyRequest) (*admin.ExportPolicyResponse, error) {
+	s.logger.Info("received ExportPolicy request")
+
+	// Exports carry token digests, so they are not served without authentication either.
+	if err := s.requireAdminToken("exporting the policy"); err != nil {
+		return nil, err
+	}
+
+	st := s.state.Load()
+
+	mirrored, err := s.mirrorPolicy(st.policy)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "exporting policy: %s", err)
+	}
+
+	b, err := json.Marshal(mirrored)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "exporting policy: %s", err)
+	}
+
+	return &admin.ExportPolicyResponse{
+		Source:   st.info.Source,
+		Revision: st.info.Revision,
+		Policy:   b,
+	}, nil
+}
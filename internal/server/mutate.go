@@ -0,0 +1,304 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"slices"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// adminMethodPrefix is the prefix of the full method names of admin API calls.
+var adminMethodPrefix = "/" + admin.Admin_ServiceDesc.ServiceName + "/"
+
+// authorizeAdmin checks that ctx carries the admin token as a bearer Authorization header, if an
+// admin token is configured.
+func (s *server) authorizeAdmin(ctx context.Context) error {
+	if s.adminToken == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	for _, v := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "a valid admin token is required")
+}
+
+// requireAdminToken fails the admin call described by what unless an admin token is configured.
+// Without one, admin calls are not authenticated, so the admin API only serves calls that read
+// state.
+func (s *server) requireAdminToken(what string) error {
+	if s.adminToken == "" {
+		return status.Errorf(codes.FailedPrecondition, "%s requires an admin token", what)
+	}
+
+	return nil
+}
+
+func (s *server) AdminUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if strings.HasPrefix(info.FullMethod, adminMethodPrefix) {
+			if err := s.authorizeAdmin(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (s *server) AdminStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if strings.HasPrefix(info.FullMethod, adminMethodPrefix) {
+			if err := s.authorizeAdmin(ss.Context()); err != nil {
+				return err
+			}
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// mutatePolicy applies fn to the active policy like a patch and returns the revision of the
+// result. Errors returned by fn are expected to be gRPC statuses; validation errors are reported as
+// invalid arguments.
+func (s *server) mutatePolicy(op string, fn func(policy) (policy, error)) (string, error) {
+	if err := s.checkPolicyWritable(); err != nil {
+		return "", err
+	}
+
+	if err := s.requireAdminToken("mutating the policy"); err != nil {
+		return "", err
+	}
+
+	patched, err := s.patchPolicy(fn)
+	if err != nil {
+		s.logger.Warnw("rejected policy mutation", "operation", op, "error", err)
+
+		if _, ok := status.FromError(err); ok {
+			return "", err
+		}
+
+		return "", status.Errorf(codes.InvalidArgument, "invalid policy mutation: %s", err)
+	}
+
+	revision, err := policyDigest(patched)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to compute policy revision")
+	}
+
+	s.logger.Infow("applied policy mutation", "operation", op, "revision", revision)
+
+	return revision, nil
+}
+
+// subjectIndex returns the index of the subject with the given ID in p, or -1 if there is none.
+func subjectIndex(p policy, id string) int {
+	return slices.IndexFunc(p.Subjects, func(sub policySubject) bool {
+		return sub.ID == id
+	})
+}
+
+// withSubject returns a copy of p in which fn has modified a copy of the subject with the given
+// ID. It returns a NotFound status if there is no such subject.
+func withSubject(p policy, id string, fn func(*policySubject) error) (policy, error) {
+	i := subjectIndex(p, id)
+	if i < 0 {
+		return policy{}, status.Errorf(codes.NotFound, "subject %s not found", id)
+	}
+
+	p.Subjects = slices.Clone(p.Subjects)
+
+	sub := p.Subjects[i]
+	sub.Resources = slices.Clone(sub.Resources)
+
+	if err := fn(&sub); err != nil {
+		return policy{}, err
+	}
+
+	p.Subjects[i] = sub
+
+	return p, nil
+}
+
+// directGrantIndex returns the index of the subject's grant on the resource that has neither an
+// expiry nor conditions, or -1 if there is none.
+func directGrantIndex(sub policySubject, resourceID string) int {
+	return slices.IndexFunc(sub.Resources, func(res policyResource) bool {
+		return res.ID == resourceID && res.ExpiresAt == nil && res.Conditions == nil
+	})
+}
+
+func (s *server) AddSubject(_ context.Context, req *admin.AddSubjectRequest) (*admin.AddSubjectResponse, error) {
+	s.logger.Infow("received AddSubject request", "subject", req.SubjectId)
+
+	if req.SubjectId == "" {
+		return nil, status.Error(codes.InvalidArgument, "a subject ID is required")
+	}
+
+	sub := policySubject{
+		ID:    req.SubjectId,
+		Roles: req.Roles,
+	}
+
+	for _, g := range req.Grants {
+		sub.Resources = append(sub.Resources, policyResource{ID: g.ResourceId, Actions: g.Actions})
+	}
+
+	revision, err := s.mutatePolicy("add_subject", func(p policy) (policy, error) {
+		if subjectIndex(p, sub.ID) >= 0 {
+			return policy{}, status.Errorf(codes.AlreadyExists, "subject %s already exists", sub.ID)
+		}
+
+		p.Subjects = append(slices.Clone(p.Subjects), sub)
+
+		return p, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &admin.AddSubjectResponse{Revision: revision}, nil
+}
+
+func (s *server) RemoveSubject(_ context.Context, req *admin.RemoveSubjectRequest) (*admin.RemoveSubjectResponse, error) {
+	s.logger.Infow("received RemoveSubject request", "subject", req.SubjectId)
+
+	revision, err := s.mutatePolicy("remove_subject", func(p policy) (policy, error) {
+		i := subjectIndex(p, req.SubjectId)
+		if i < 0 {
+			return policy{}, status.Errorf(codes.NotFound, "subject %s not found", req.SubjectId)
+		}
+
+		p.Subjects = slices.Delete(slices.Clone(p.Subjects), i, i+1)
+
+		return p, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &admin.RemoveSubjectResponse{Revision: revision}, nil
+}
+
+func (s *server) GrantAccess(_ context.Context, req *admin.GrantAccessRequest) (*admin.GrantAccessResponse, error) {
+	s.logger.Infow("received GrantAccess request", "subject", req.SubjectId, "resource_id", req.ResourceId, "actions", req.Actions)
+
+	if len(req.Actions) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one action is required")
+	}
+
+	resourceID := s.normalizeResourceID(req.ResourceId)
+
+	revision, err := s.mutatePolicy("grant_access", func(p policy) (policy, error) {
+		return withSubject(p, req.SubjectId, func(sub *policySubject) error {
+			i := directGrantIndex(*sub, resourceID)
+			if i < 0 {
+				sub.Resources = append(sub.Resources, policyResource{ID: resourceID, Actions: req.Actions})
+
+				return nil
+			}
+
+			actions := slices.Clone(sub.Resources[i].Actions)
+
+			for _, action := range req.Actions {
+				if !slices.Contains(actions, action) {
+					actions = append(actions, action)
+				}
+			}
+
+			sub.Resources[i].Actions = actions
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &admin.GrantAccessResponse{Revision: revision}, nil
+}
+
+func (s *server) RevokeAccess(_ context.Context, req *admin.RevokeAccessRequest) (*admin.RevokeAccessResponse, error) {
+	s.logger.Infow("received RevokeAccess request", "subject", req.SubjectId, "resource_id", req.ResourceId, "actions", req.Actions)
+
+	resourceID := s.normalizeResourceID(req.ResourceId)
+
+	revision, err := s.mutatePolicy("revoke_access", func(p policy) (policy, error) {
+		return withSubject(p, req.SubjectId, func(sub *policySubject) error {
+			i := directGrantIndex(*sub, resourceID)
+			if i < 0 {
+				return status.Errorf(codes.NotFound, "subject %s has no grant on %s", req.SubjectId, req.ResourceId)
+			}
+
+			actions := slices.DeleteFunc(slices.Clone(sub.Resources[i].Actions), func(action string) bool {
+				return slices.Contains(req.Actions, action)
+			})
+
+			if len(req.Actions) == 0 || len(actions) == 0 {
+				sub.Resources = slices.Delete(sub.Resources, i, i+1)
+
+				return nil
+			}
+
+			sub.Resources[i].Actions = actions
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &admin.RevokeAccessResponse{Revision: revision}, nil
+}
+
+func (s *server) MintToken(_ context.Context, req *admin.MintTokenRequest) (*admin.MintTokenResponse, error) {
+	s.logger.Infow("received MintToken request", "subject", req.SubjectId)
+
+	if err := s.requireAdminToken("minting tokens"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.state.Load().subjects[req.SubjectId]; !ok {
+		return nil, status.Errorf(codes.NotFound, "subject %s not found", req.SubjectId)
+	}
+
+	ttl := s.issuedTokenTTL
+
+	if req.Ttl != nil {
+		if err := req.Ttl.CheckValid(); err != nil || req.Ttl.AsDuration() <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "ttl must be positive")
+		}
+
+		ttl = req.Ttl.AsDuration()
+	}
+
+	now := s.now()
+	expiresAt := now.Add(ttl)
+
+	token, err := s.issued.issue(s.namespace.prefix, req.SubjectId, "", now, expiresAt)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to mint token")
+	}
+
+	s.logger.Infow("minted token", "subject", req.SubjectId, "expires_at", expiresAt)
+
+	return &admin.MintTokenResponse{
+		Token:     token,
+		ExpiresAt: timestamppb.New(expiresAt),
+	}, nil
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authentication"
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// credentialNamespace is the credential prefix a runtime claims when sharing a host with other
+// runtimes, and what happens to credentials without it.
+type credentialNamespace struct {
+	prefix string
+	// Code rejected credentials fail with, when there is no upstream
+	code codes.Code
+	// Runtime that credentials without the prefix are forwarded to, if set
+	upstream grpc.ClientConnInterface
+}
+
+// foreignCredential reports whether a request's credential lacks the configured namespace prefix.
+// Without a namespace, every credential belongs to this runtime.
+func (s *server) foreignCredential(ctx context.Context, credential string) (string, bool) {
+	credential = s.requestCredential(ctx, credential)
+
+	if s.namespace.prefix == "" {
+		return credential, false
+	}
+
+	return credential, !strings.HasPrefix(credential, s.namespace.prefix)
+}
+
+// rejectForeign returns the error for a credential outside the namespace when there is no upstream.
+func (s *server) rejectForeign() error {
+	return s.deny(s.namespace.code, reasonForeignCredential, "prefix", s.namespace.prefix)
+}
+
+// checkNamespaceTokens rejects policy tokens that could never be presented, because they lack the
+// namespace prefix. ref identifies the token, as returned by policyToken.ref.
+func (s *server) checkNamespaceTokens(sub policySubject, ref, value string) error {
+	if s.namespace.prefix == "" || strings.HasPrefix(value, s.namespace.prefix) {
+		return nil
+	}
+
+	return fmt.Errorf("%s: %s: token does not start with the credential prefix '%s': %w", sub.ID, ref, s.namespace.prefix, ErrInvalidValue)
+}
+
+// upstreamContext returns a context for forwarding a request, carrying the incoming request's
+// metadata, such as on-behalf-of, but not the transport's own.
+func upstreamContext(ctx context.Context) context.Context {
+	in, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	out := metadata.MD{}
+
+	for k, v := range in {
+		if strings.HasPrefix(k, ":") || strings.HasPrefix(k, "grpc-") || k == "content-type" || k == "user-agent" {
+			continue
+		}
+
+		out[k] = v
+	}
+
+	return metadata.NewOutgoingContext(ctx, out)
+}
+
+// forwardAuthenticateSubject forwards a request with a credential outside the namespace upstream.
+func (s *server) forwardAuthenticateSubject(ctx context.Context, credential string) (*authentication.AuthenticateSubjectResponse, error) {
+	if s.namespace.upstream == nil {
+		return nil, s.rejectForeign()
+	}
+
+	s.logger.Debug("forwarding AuthenticateSubject request upstream")
+
+	return authentication.NewAuthenticationClient(s.namespace.upstream).AuthenticateSubject(upstreamContext(ctx), &authentication.AuthenticateSubjectRequest{
+		Credential: credential,
+	})
+}
+
+// forwardCheckAccess forwards a request with a credential outside the namespace upstream.
+func (s *server) forwardCheckAccess(ctx context.Context, credential string, req *authorization.CheckAccessRequest) (*authorization.CheckAccessResponse, error) {
+	if s.namespace.upstream == nil {
+		return nil, s.rejectForeign()
+	}
+
+	s.logger.Debug("forwarding CheckAccess request upstream")
+
+	return authorization.NewAuthorizationClient(s.namespace.upstream).CheckAccess(upstreamContext(ctx), &authorization.CheckAccessRequest{
+		Credential: credential,
+		Actions:    req.Actions,
+	})
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+)
+
+// parseNetworks parses CIDR ranges, treating bare IP addresses as single-host ranges.
+func parseNetworks(values []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(values))
+
+	for _, v := range values {
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(v)
+			if addrErr != nil {
+				return nil, fmt.Errorf("%s: not a CIDR range or IP address: %w", v, ErrInvalidValue)
+			}
+
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		out = append(out, prefix.Masked())
+	}
+
+	return out, nil
+}
+
+// validateNetworks checks that every subject's allowed networks parse.
+func validateNetworks(p policy) error {
+	for _, sub := range p.Subjects {
+		if _, err := parseNetworks(sub.AllowedNetworks); err != nil {
+			return fmt.Errorf("%s: %w", sub.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// checkPeer rejects requests from a subject's credential that arrive over TCP from outside the
+// subject's allowed networks. Subjects without allowed networks, and requests over Unix sockets,
+// are not restricted.
+func (s *server) checkPeer(ctx context.Context, st *policyState, sub policySubject) error {
+	networks := st.networks[sub.ID]
+	if len(networks) == 0 {
+		return nil
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	tcpAddr, ok := p.Addr.(*net.TCPAddr)
+	if !ok {
+		return nil
+	}
+
+	addr, ok := netip.AddrFromSlice(tcpAddr.IP)
+	if !ok {
+		return s.deny(codes.PermissionDenied, reasonNetworkDenied, "subject", sub.ID, "peer", tcpAddr.IP.String())
+	}
+
+	addr = addr.Unmap()
+
+	for _, network := range networks {
+		if network.Contains(addr) {
+			return nil
+		}
+	}
+
+	fields := append([]any{"subject", sub.ID, "peer", addr.String()}, metadataFields(s.capturedMetadata(ctx))...)
+	s.logger.Warnw("credential used from a disallowed network", fields...)
+
+	return s.deny(codes.PermissionDenied, reasonNetworkDenied, "subject", sub.ID, "peer", addr.String())
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultIssuedTokenTTL is how long access tokens issued to OAuth2 clients are valid by default.
+const defaultIssuedTokenTTL = time.Hour
+
+// issuedTokenBytes is the number of random bytes in an issued access token.
+const issuedTokenBytes = 32
+
+// IssuedToken is an access token issued to an OAuth2 client.
+type IssuedToken struct {
+	AccessToken string
+	ExpiresIn   time.Duration
+}
+
+// clientSecret is a resolved OAuth2 client secret and the subject it authenticates.
+type clientSecret struct {
+	subjectID string
+	secret    string
+}
+
+// issuedToken records the subject an issued access token authenticates and when it expires.
+type issuedToken struct {
+	subjectID string
+	// The OAuth2 client the token was issued to, or empty for a minted token
+	clientID  string
+	expiresAt time.Time
+}
+
+// issuedTokens holds the access tokens issued to OAuth2 clients. Tokens are kept in memory only,
+// so they are invalidated when the server restarts.
+type issuedTokens struct {
+	mu     sync.Mutex
+	tokens map[string]issuedToken
+}
+
+func newIssuedTokens() *issuedTokens {
+	return &issuedTokens{tokens: make(map[string]issuedToken)}
+}
+
+// issue creates a token for the given subject and OAuth2 client valid until expiresAt, discarding
+// tokens expired at now. The token starts with prefix.
+func (t *issuedTokens) issue(prefix, subjectID, clientID string, now, expiresAt time.Time) (string, error) {
+	b := make([]byte, issuedTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	token := prefix + base64.RawURLEncoding.EncodeToString(b)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for tok, issued := range t.tokens {
+		if !now.Before(issued.expiresAt) {
+			delete(t.tokens, tok)
+		}
+	}
+
+	t.tokens[token] = issuedToken{subjectID: subjectID, clientID: clientID, expiresAt: expiresAt}
+
+	return token, nil
+}
+
+// lookup returns the subject ID a token unexpired at now was issued to.
+func (t *issuedTokens) lookup(token string, now time.Time) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	issued, ok := t.tokens[token]
+	if !ok || !now.Before(issued.expiresAt) {
+		return "", false
+	}
+
+	return issued.subjectID, true
+}
+
+// forSubject returns the tokens issued to the given subject that are unexpired at now, by digest.
+func (t *issuedTokens) forSubject(subjectID string, now time.Time) map[tokenDigest]issuedToken {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make(map[tokenDigest]issuedToken)
+
+	for tok, issued := range t.tokens {
+		if issued.subjectID == subjectID && now.Before(issued.expiresAt) {
+			out[digestToken(tok)] = issued
+		}
+	}
+
+	return out
+}
+
+// reset discards every issued token.
+func (t *issuedTokens) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tokens = make(map[string]issuedToken)
+}
+
+// validateClients checks that OAuth2 client IDs are unique across the policy.
+func validateClients(p policy) error {
+	owners := make(map[string]string)
+
+	for _, sub := range p.Subjects {
+		for _, client := range sub.Clients {
+			if client.ID == "" {
+				return fmt.Errorf("%s: client ID is empty: %w", sub.ID, ErrMissingValue)
+			}
+
+			if owner, ok := owners[client.ID]; ok {
+				return fmt.Errorf("%s: client %s is already defined by %s: %w", sub.ID, client.ID, owner, ErrDuplicateValue)
+			}
+
+			owners[client.ID] = sub.ID
+		}
+	}
+
+	return nil
+}
+
+// lookupCredential returns the subject authenticated by a credential: a static token from the
+// policy that has not been rotated out, a credential issued by rotation, or an unexpired token
+// issued to one of the subject's OAuth2 clients. stable reports whether the result only changes
+// when the policy is reloaded or a credential is rotated: whether the credential is a policy token
+// that was never rotated.
+func (s *server) lookupCredential(st *policyState, credential string) (sub policySubject, ok, stable bool) {
+	sub, ok, rejected, rotated := s.lookupRotated(st, credential)
+	if ok || rejected {
+		return sub, ok, false
+	}
+
+	if sub, ok := st.lookupToken(credential); ok {
+		return sub, true, !rotated
+	}
+
+	subjectID, ok := s.issued.lookup(credential, s.now())
+	if !ok {
+		return policySubject{}, false, false
+	}
+
+	// The subject may have been removed from the policy since the token was issued.
+	sub, ok = st.subjects[subjectID]
+
+	return sub, ok, false
+}
+
+func (s *server) IssueClientToken(clientID, secret string) (IssuedToken, error) {
+	client, ok := s.state.Load().clients[clientID]
+
+	// Compare even for unknown clients, so response times do not reveal which client IDs exist.
+	match := subtle.ConstantTimeCompare([]byte(client.secret), []byte(secret)) == 1
+	if !ok || !match {
+		return IssuedToken{}, ErrInvalidClient
+	}
+
+	now := s.now()
+
+	token, err := s.issued.issue(s.namespace.prefix, client.subjectID, clientID, now, now.Add(s.issuedTokenTTL))
+	if err != nil {
+		return IssuedToken{}, err
+	}
+
+	s.logger.Infow("issued access token", "subject", client.subjectID, "client_id", clientID)
+
+	return IssuedToken{AccessToken: token, ExpiresIn: s.issuedTokenTTL}, nil
+}
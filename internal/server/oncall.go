@@ -0,0 +1,183 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/cron"
+)
+
+// policyOnCall grants subjects temporary access during the recurring windows of a schedule, such
+// as an on-call rotation's elevated access.
+type policyOnCall struct {
+	ID       string   `yaml:"id" json:"id"`
+	Subjects []string `yaml:"subjects" json:"subjects"`
+	// Schedule is a five-field cron expression for when each window opens, such as "0 9 * * 1-5".
+	Schedule string `yaml:"schedule" json:"schedule"`
+	// Duration is how long each window stays open, such as 8h.
+	Duration string `yaml:"duration" json:"duration"`
+	// TimeZone is the IANA time zone the schedule is evaluated in. It defaults to UTC.
+	TimeZone string `yaml:"timeZone,omitempty" json:"timeZone,omitempty"`
+	// Resources and Roles are granted to the subjects while a window is open.
+	Resources []policyResource `yaml:"resources,omitempty" json:"resources,omitempty"`
+	Roles     []string         `yaml:"roles,omitempty" json:"roles,omitempty"`
+}
+
+// window returns the recurring window of the schedule.
+func (o policyOnCall) window() (cron.Window, error) {
+	schedule, err := cron.Parse(o.Schedule)
+	if err != nil {
+		return cron.Window{}, err
+	}
+
+	d, err := time.ParseDuration(o.Duration)
+	if err != nil || d <= 0 {
+		return cron.Window{}, fmt.Errorf("duration '%s' must be a positive duration such as 8h: %w", o.Duration, ErrInvalidValue)
+	}
+
+	loc := time.UTC
+
+	if o.TimeZone != "" {
+		if loc, err = time.LoadLocation(o.TimeZone); err != nil {
+			return cron.Window{}, fmt.Errorf("time zone '%s': %w", o.TimeZone, ErrInvalidValue)
+		}
+	}
+
+	return cron.Window{Schedule: schedule, Duration: d, Location: loc}, nil
+}
+
+// validateOnCall checks that every on-call schedule has a unique ID and a valid window, and grants
+// valid resources and defined roles to defined subjects.
+func validateOnCall(p policy, roles roleIndex) error {
+	subjects := make(map[string]bool, len(p.Subjects))
+	for _, sub := range p.Subjects {
+		subjects[sub.ID] = true
+	}
+
+	seen := make(map[string]bool, len(p.OnCall))
+
+	for _, o := range p.OnCall {
+		if err := checkID("on-call schedule ID", o.ID); err != nil {
+			return fmt.Errorf("onCall: %w", err)
+		}
+
+		if seen[o.ID] {
+			return fmt.Errorf("on-call schedule %s: %w", o.ID, ErrDuplicateValue)
+		}
+
+		seen[o.ID] = true
+
+		if _, err := o.window(); err != nil {
+			return fmt.Errorf("on-call schedule %s: %w", o.ID, err)
+		}
+
+		if len(o.Subjects) == 0 {
+			return fmt.Errorf("on-call schedule %s: subjects are empty: %w", o.ID, ErrMissingValue)
+		}
+
+		for _, id := range o.Subjects {
+			if !subjects[id] {
+				return fmt.Errorf("on-call schedule %s: subject %s: %w", o.ID, id, ErrMissingValue)
+			}
+		}
+
+		if err := checkResourceIDs(o.Resources); err != nil {
+			return fmt.Errorf("on-call schedule %s: %w", o.ID, err)
+		}
+
+		for _, ref := range o.Roles {
+			if _, err := roles.resolve(ref); err != nil {
+				return fmt.Errorf("on-call schedule %s: %w", o.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// openOnCall returns the subjects' on-call schedules in p whose windows are open at now, keyed by
+// subject ID. Invalid schedules are skipped; compileSubjects rejects them.
+func openOnCall(p policy, now time.Time) map[string][]policyOnCall {
+	out := make(map[string][]policyOnCall)
+
+	for _, o := range p.OnCall {
+		w, err := o.window()
+		if err != nil || !w.Open(now) {
+			continue
+		}
+
+		for _, id := range o.Subjects {
+			out[id] = append(out[id], o)
+		}
+	}
+
+	return out
+}
+
+// onCallChange is an on-call schedule whose window opened or closed.
+type onCallChange struct {
+	policyOnCall
+	open bool
+}
+
+// onCallChanges returns the on-call schedules in p whose windows are open at exactly one of from
+// and to.
+func onCallChanges(p policy, from, to time.Time) []onCallChange {
+	var out []onCallChange
+
+	for _, o := range p.OnCall {
+		w, err := o.window()
+		if err != nil {
+			continue
+		}
+
+		if was, is := w.Open(from), w.Open(to); was != is {
+			out = append(out, onCallChange{policyOnCall: o, open: is})
+		}
+	}
+
+	return out
+}
+
+// nextOnCallChange returns when the next on-call window in p, after now, opens or closes. It
+// reports false if none ever does.
+func nextOnCallChange(p policy, now time.Time) (time.Time, bool) {
+	var next time.Time
+
+	for _, o := range p.OnCall {
+		w, err := o.window()
+		if err != nil {
+			continue
+		}
+
+		if t := w.NextChange(now); !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+
+	return next, !next.IsZero()
+}
+
+// mergeOnCall merges overlay on-call schedules into base, replacing schedules with the same ID.
+func mergeOnCall(base, overlay []policyOnCall) []policyOnCall {
+	out := append([]policyOnCall(nil), base...)
+
+	for _, o := range overlay {
+		replaced := false
+
+		for i, existing := range out {
+			if existing.ID == o.ID {
+				out[i] = o
+				replaced = true
+
+				break
+			}
+		}
+
+		if !replaced {
+			out = append(out, o)
+		}
+	}
+
+	return out
+}
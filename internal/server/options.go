@@ -0,0 +1,514 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/alert"
+	"github.com/metal-toolbox/iam-runtime-static/internal/auditlog"
+	"github.com/metal-toolbox/iam-runtime-static/internal/capability"
+	"github.com/metal-toolbox/iam-runtime-static/internal/decisionlog"
+	"github.com/metal-toolbox/iam-runtime-static/internal/emulation"
+	"github.com/metal-toolbox/iam-runtime-static/internal/enrich"
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/internal/features"
+	"github.com/metal-toolbox/iam-runtime-static/internal/jwtverify"
+	"github.com/metal-toolbox/iam-runtime-static/internal/lastseen"
+	"github.com/metal-toolbox/iam-runtime-static/internal/policycrypt"
+	"github.com/metal-toolbox/iam-runtime-static/internal/resourceid"
+	"github.com/metal-toolbox/iam-runtime-static/internal/rotation"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Option configures optional server behavior.
+type Option func(*server)
+
+// WithConfig sets the effective runtime configuration returned by the admin GetConfig RPC. Callers
+// are responsible for redacting secrets before passing the configuration.
+func WithConfig(cfg map[string]any) Option {
+	return func(s *server) {
+		s.config = cfg
+	}
+}
+
+// WithPolicyOverlays sets overlay policy files that are merged over the base policy in order.
+func WithPolicyOverlays(paths ...string) Option {
+	return func(s *server) {
+		s.policyOverlays = paths
+	}
+}
+
+// WithPolicyDecrypter sets the decrypter used for policies and overlays encrypted at rest. By
+// default, encrypted policies are rejected.
+func WithPolicyDecrypter(d *policycrypt.Decrypter) Option {
+	return func(s *server) {
+		s.decrypter = d
+	}
+}
+
+// WithEnv sets the function used to resolve token environment variables, so servers in the same
+// process can resolve the same variable names to different credentials. By default, the process
+// environment is used.
+func WithEnv(getenv func(key string) string) Option {
+	return func(s *server) {
+		s.getenv = getenv
+	}
+}
+
+// WithTokenCommands runs the commands of policy tokens with an exec source, passing them only the
+// environment variables named by env, or PATH and HOME if env is empty, in dir, or the runtime's
+// working directory if dir is empty. Commands are killed after timeout, or after 10 seconds if
+// timeout is zero. Without this option, policies with command tokens fail to load.
+func WithTokenCommands(timeout time.Duration, env []string, dir string) Option {
+	if timeout <= 0 {
+		timeout = defaultTokenCommandTimeout
+	}
+
+	if len(env) == 0 {
+		env = defaultTokenCommandEnv
+	}
+
+	return func(s *server) {
+		s.tokenCommands = &tokenCommands{
+			timeout: timeout,
+			env:     env,
+			dir:     dir,
+		}
+	}
+}
+
+// WithoutMetrics stops the server from recording to the process-wide metrics registry. Metrics
+// describe a single active policy, so when several servers run in one process, at most one should
+// record them. Decision statistics remain available from the admin API.
+func WithoutMetrics() Option {
+	return func(s *server) {
+		s.recordMetrics = false
+	}
+}
+
+// WithSessionCache caches the subject each credential authenticates per gRPC connection, so
+// clients making many calls over one connection skip repeated credential lookups. The server's
+// StatsHandler must be installed on the gRPC server.
+func WithSessionCache() Option {
+	return func(s *server) {
+		s.sessionCache = true
+	}
+}
+
+// WithConnectionSubjects stamps each gRPC connection with the first subject authenticated on it,
+// for ConnectionSubject, decision events, and per-subject connection metrics. Requires the stats
+// handler from StatsHandler.
+func WithConnectionSubjects() Option {
+	return func(s *server) {
+		s.connectionSubjects = true
+	}
+}
+
+// WithFeatures sets the feature flags gating experimental behaviors. By default, all flags are
+// disabled. Flags can be changed at runtime with the admin SetFeature RPC.
+func WithFeatures(set *features.Set) Option {
+	return func(s *server) {
+		s.features = set
+	}
+}
+
+// WithActionProfiles adds the latency and errors of the matching profile to checks of each action,
+// so performance tests see production-like behavior. Checks of actions without a profile are
+// unaffected.
+func WithActionProfiles(profiles *emulation.Profiles) Option {
+	return func(s *server) {
+		s.profiles = profiles
+	}
+}
+
+// WithRPCProfiles adds the latency and injected faults of the matching profile to calls of each RPC
+// served with EmulationUnaryInterceptor, so clients can be tested against a misbehaving runtime.
+// Calls of RPCs without a profile are unaffected.
+func WithRPCProfiles(profiles *emulation.RPCProfiles) Option {
+	return func(s *server) {
+		s.rpcProfiles = profiles
+	}
+}
+
+// WithPolicyLoadHook calls fn with true when the server starts loading a policy, including the
+// initial one, and with false once it has finished, whether or not the policy was accepted. fn is
+// called with the server's load lock held, so it must not call into the server.
+func WithPolicyLoadHook(fn func(loading bool)) Option {
+	return func(s *server) {
+		s.loadHook = fn
+	}
+}
+
+// WithReloadGuard rejects policy updates that fail the given checks against the active policy,
+// keeping the active policy. The initial policy is not checked. By default, no checks are made.
+func WithReloadGuard(guard ReloadGuard) Option {
+	return func(s *server) {
+		s.reloadGuard = guard
+	}
+}
+
+// WithExpectedTraffic warms the decisions on the expected requests whenever a policy is loaded,
+// logging those the policy would deny. If requireAllowed is set, a policy denying any of them is
+// rejected: the initial policy fails to load, and updates keep the active policy.
+func WithExpectedTraffic(expected []ExpectedRequest, requireAllowed bool) Option {
+	return func(s *server) {
+		s.expectedTraffic = expected
+		s.requireExpectedAllowed = requireAllowed
+	}
+}
+
+// WithPolicyHistory sets how many previously active policies are kept in memory. The default is
+// five.
+func WithPolicyHistory(size int) Option {
+	return func(s *server) {
+		s.historySize = size
+	}
+}
+
+// WithIssuedTokenTTL sets how long access tokens issued to OAuth2 clients are valid. The default is
+// one hour.
+func WithIssuedTokenTTL(ttl time.Duration) Option {
+	return func(s *server) {
+		s.issuedTokenTTL = ttl
+	}
+}
+
+// WithAdminToken sets the token admin API calls must carry as a bearer Authorization header. It
+// also enables the admin calls that mutate the active policy and mint tokens, which are rejected
+// without it.
+func WithAdminToken(token string) Option {
+	return func(s *server) {
+		s.adminToken = token
+	}
+}
+
+// WithAlertNotifier sets the notifier that receives decisions on sensitive actions.
+func WithAlertNotifier(n alert.Notifier) Option {
+	return func(s *server) {
+		s.alerts = n
+	}
+}
+
+// WithEventBus sets the bus the server publishes policy and decision events on, so callers can
+// subscribe their own handlers. By default the server uses a private bus. Servers must not share a
+// bus, since each records the decisions published on it.
+func WithEventBus(bus *events.Bus) Option {
+	return func(s *server) {
+		s.bus = bus
+	}
+}
+
+// WithAuditLog records policy and decision events in l, and serves them to collectors from the
+// admin TailAudit and AckAudit RPCs and to queries from QueryAudit.
+func WithAuditLog(l *auditlog.Log) Option {
+	return func(s *server) {
+		s.audit = l
+	}
+}
+
+// WithSubjectLimits limits the gRPC connections and in-progress RPCs each subject may hold,
+// failing requests beyond them with ResourceExhausted. A limit of zero is unlimited. Connections
+// count for the first subject authenticated on them, and limiting them stamps connections as
+// WithConnectionSubjects does. Requires the stats handler from StatsHandler.
+func WithSubjectLimits(maxConnections, maxStreams int) Option {
+	return func(s *server) {
+		s.maxSubjectConnections = maxConnections
+		s.maxSubjectStreams = maxStreams
+
+		if maxConnections > 0 {
+			s.connectionSubjects = true
+		}
+	}
+}
+
+// WithDecisionLog writes a record of each AuthenticateSubject and CheckAccess request to l.
+func WithDecisionLog(l *decisionlog.Log) Option {
+	return func(s *server) {
+		s.decisionLog = l
+	}
+}
+
+// WithRecentDecisions keeps the n most recent decisions in memory for the admin API and the debug
+// endpoint. If n is not positive, DefaultRecentDecisions are kept.
+func WithRecentDecisions(n int) Option {
+	return func(s *server) {
+		s.recentDecisions = n
+	}
+}
+
+// WithDecisionCacheTTL hints to clients that CheckAccess results may be cached for ttl. No hint is
+// sent if ttl is zero.
+func WithDecisionCacheTTL(ttl time.Duration) Option {
+	return func(s *server) {
+		s.decisionCacheTTL = ttl
+	}
+}
+
+// WithClockSkew keeps grants applying for the given tolerance after they expire, so that machines
+// whose clocks differ slightly agree on decisions near an expiry.
+func WithClockSkew(d time.Duration) Option {
+	return func(s *server) {
+		s.clockSkew = d
+	}
+}
+
+// WithAdjustableClock evaluates grant expiries and conditions, on-call windows, relationship
+// visibility, and credential lifetimes on a clock that AdvanceClock moves forward, for tests of
+// time-dependent policies. The clock starts at start, or at the system time if start is zero, and
+// then runs with the system clock.
+func WithAdjustableClock(start time.Time) Option {
+	return func(s *server) {
+		s.clock = new(adjustableClock)
+
+		if !start.IsZero() {
+			s.clock.start = time.Until(start)
+			s.clock.offset = s.clock.start
+		}
+	}
+}
+
+// WithRelationshipPropagationDelay delays the visibility of relationship writes to access checks
+// by d, so applications can test their handling of eventually consistent authorization backends.
+func WithRelationshipPropagationDelay(d time.Duration) Option {
+	return func(s *server) {
+		if s.relationships != nil {
+			s.relationships.delay = d
+		}
+	}
+}
+
+// WithResourceIDNormalizer normalizes resource IDs with the given pipeline: those of every policy
+// loaded, and those of access checks, relationships, and admin grants before they are evaluated or
+// stored, so both sides agree on a resource however they write its ID.
+func WithResourceIDNormalizer(p resourceid.Pipeline) Option {
+	return func(s *server) {
+		s.resourceIDs = p
+	}
+}
+
+// WithOwnership makes relationships of the given relations grant actions: a relationship of a
+// relation from a resource to a policy subject, such as owner, grants the subject the relation's
+// actions on the resource, and the actions they imply, as if the policy did.
+func WithOwnership(relations map[string][]string) Option {
+	return func(s *server) {
+		s.ownership = relations
+	}
+}
+
+// WithoutRelationships disables the relationship RPCs, which then fail with FailedPrecondition, and
+// stops access checks from following relationships.
+func WithoutRelationships() Option {
+	return func(s *server) {
+		s.relationships = nil
+	}
+}
+
+// WithoutUsage stops the server from counting the requests of each subject, so GetSubjectUsage
+// fails with FailedPrecondition.
+func WithoutUsage() Option {
+	return func(s *server) {
+		s.usage = nil
+	}
+}
+
+// WithoutCoverage stops the server from counting the requests each grant allows, so GetCoverage
+// fails with FailedPrecondition.
+func WithoutCoverage() Option {
+	return func(s *server) {
+		s.coverage = nil
+	}
+}
+
+// WithCredentialHeader takes the credential from the given incoming gRPC metadata header when a
+// request's Credential field is empty, for clients that can only inject headers. The prefix, such
+// as "Bearer ", is matched case-insensitively and removed from the value; values without it are
+// ignored.
+func WithCredentialHeader(header, prefix string) Option {
+	return func(s *server) {
+		s.credentialHeader = strings.ToLower(header)
+		s.credentialPrefix = prefix
+	}
+}
+
+// WithCredentialNamespace makes the runtime claim only credentials starting with prefix, such as
+// "static_", so it can share a host with other runtimes. Requests with other credentials are
+// forwarded to upstream if it is not nil, and otherwise fail with code, or FailedPrecondition if
+// code is OK. Every policy token must start with the prefix, and issued OAuth2 access tokens start
+// with it too.
+func WithCredentialNamespace(prefix string, code codes.Code, upstream grpc.ClientConnInterface) Option {
+	if code == codes.OK {
+		code = codes.FailedPrecondition
+	}
+
+	return func(s *server) {
+		s.namespace = credentialNamespace{
+			prefix:   prefix,
+			code:     code,
+			upstream: upstream,
+		}
+	}
+}
+
+// WithShadowRuntime mirrors sampleRate of AuthenticateSubject and CheckAccess requests, from 0 to
+// 1, to the runtime on conn, logging requests it decides differently. Mirrored requests time out
+// after timeout, or after 5 seconds if timeout is zero. ShadowUnaryInterceptor must be installed.
+func WithShadowRuntime(conn grpc.ClientConnInterface, sampleRate float64, timeout time.Duration) Option {
+	if timeout <= 0 {
+		timeout = defaultShadowTimeout
+	}
+
+	return func(s *server) {
+		s.shadow = &shadowRuntime{
+			conn:       conn,
+			sampleRate: sampleRate,
+			timeout:    timeout,
+			inFlight:   make(chan struct{}, maxShadowInFlight),
+		}
+	}
+}
+
+// WithCredentialChecks explains why an unrecognized credential was rejected when it looks like a
+// JWT, a private key, or a token with an authorization scheme or surrounding whitespace left on it,
+// instead of only reporting an invalid credential. Credentials longer than maxLength bytes are
+// rejected before they are looked up, unless maxLength is zero.
+func WithCredentialChecks(enabled bool, maxLength int) Option {
+	return func(s *server) {
+		s.credentialChecks = enabled
+		s.maxCredentialLength = maxLength
+	}
+}
+
+// WithDenialMessages replaces the catalog messages for denials with the given reason codes, such as
+// ACTION_DENIED. Messages may refer to the denial's metadata as {key}, for example {action}. Codes
+// are matched case-insensitively; use CheckDenialMessages to reject unknown codes.
+func WithDenialMessages(messages map[string]string) Option {
+	return func(s *server) {
+		s.denialMessages = make(map[string]string, len(messages))
+		for reason, msg := range messages {
+			s.denialMessages[strings.ToUpper(reason)] = msg
+		}
+	}
+}
+
+// WithClaimEnrichers adds the chain's claims to those returned by AuthenticateSubject. If a
+// required enricher fails, authentication fails with Unavailable.
+func WithClaimEnrichers(chain *enrich.Chain) Option {
+	return func(s *server) {
+		s.enrichers = chain
+	}
+}
+
+// WithJWTVerifier authenticates subjects by JWTs verified by v, mapping their iss and sub claims to
+// the policy's JWT subjects. Credentials that are not JWTs are looked up as tokens as usual.
+func WithJWTVerifier(v *jwtverify.Verifier) Option {
+	return func(s *server) {
+		s.jwt = v
+	}
+}
+
+// WithCapabilitySigner accepts capability tokens signed by signer. A capability token
+// authenticates the policy subject it names, but only for the actions and resources of the grant
+// it carries.
+func WithCapabilitySigner(signer *capability.Signer) Option {
+	return func(s *server) {
+		s.capabilities = signer
+	}
+}
+
+// WithCredentialRotation lets subjects rotate their policy tokens and rotated credentials using the
+// Credentials service, recording them in store. Replaced credentials are accepted for grace.
+func WithCredentialRotation(store *rotation.Store, grace time.Duration) Option {
+	return func(s *server) {
+		s.rotation = store
+		s.rotationGrace = grace
+	}
+}
+
+// WithStaleSubjectExpiry disables subjects not authenticated for after, recording when subjects
+// were last seen in store. Subjects in exempt are never disabled. Disabled subjects are denied
+// until they are enabled again with EnableSubject.
+func WithStaleSubjectExpiry(store *lastseen.Store, after time.Duration, exempt []string) Option {
+	return func(s *server) {
+		s.lastSeen = store
+		s.staleAfter = after
+		s.staleExempt = exempt
+	}
+}
+
+// WithDenialHints adds a hint to denied access checks explaining, for each denied action, why the
+// policy does not allow it, such as the subject's nearest grant. Hints reveal the policy to
+// callers, so they are meant for development only.
+func WithDenialHints() Option {
+	return func(s *server) {
+		s.denialHints = true
+	}
+}
+
+// WithEmptyActions answers access checks naming no actions with code, such as PermissionDenied or
+// InvalidArgument. They are allowed if code is OK, as they are by default.
+func WithEmptyActions(code codes.Code) Option {
+	return func(s *server) {
+		s.emptyActionsCode = code
+	}
+}
+
+// WithDuplicateActionsRejected rejects access checks naming an action on a resource more than
+// once with InvalidArgument, instead of evaluating each.
+func WithDuplicateActionsRejected() Option {
+	return func(s *server) {
+		s.rejectDuplicateActions = true
+	}
+}
+
+// WithAuthorizationBackends decides access checks with the given backends, consulted in order, and
+// combines their decisions with combinator, instead of deciding them with the policy and then with
+// relationships. The decisions of the backends consulted for each action are recorded in decision
+// events, the audit log, traces, and denial hints. Denies in the policy are only decisions of the
+// policy backend, so with FirstAllow, another backend may allow what the policy denies.
+func WithAuthorizationBackends(combinator Combinator, backends ...Backend) Option {
+	return func(s *server) {
+		s.backends = &backendSet{combinator: combinator, backends: backends}
+	}
+}
+
+// WithEvaluationBudget fails access checks with ResourceExhausted once evaluating their actions
+// examines more than maxRules grant entries, counting conditional grants, or follows
+// relationships more than maxDepth hops from a checked resource. Zero limits are unlimited.
+func WithEvaluationBudget(maxRules, maxDepth int) Option {
+	return func(s *server) {
+		s.budget = evalBudget{maxRules: maxRules, maxDepth: maxDepth}
+	}
+}
+
+// WithMirroredPolicy marks the policy as mirrored from another instance, described by source.
+// Patches, mutations, and rollbacks fail with FailedPrecondition, since the next sync would undo
+// them.
+func WithMirroredPolicy(source string) Option {
+	return func(s *server) {
+		s.mirroredFrom = source
+	}
+}
+
+// WithWorkloadIdentity sets the policy identity whose access token the Identity service returns.
+// By default, the policy's only identity is used.
+func WithWorkloadIdentity(id string) Option {
+	return func(s *server) {
+		s.workloadIdentity = id
+	}
+}
+
+// WithMetadataCapture records the values of the given incoming gRPC metadata keys, such as
+// traceparent, in decision events and audit logs. If echoClaims is set, they are also returned as
+// claims from AuthenticateSubject, without overriding the sub and act claims.
+func WithMetadataCapture(keys []string, echoClaims bool) Option {
+	return func(s *server) {
+		s.metadataKeys = nil
+		for _, key := range keys {
+			s.metadataKeys = append(s.metadataKeys, strings.ToLower(key))
+		}
+
+		s.echoMetadataClaims = echoClaims
+	}
+}
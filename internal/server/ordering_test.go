@@ -0,0 +1,584 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/auditlog"
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/internal/features"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/credentials"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// Unsorted, mixed-case, and non-ASCII IDs. Sorting by locale rather than by bytes, or not
+// sorting, puts them in a different order than the sorted lists below.
+var (
+	orderingSubjects  = []string{"zoë", "Zed", "émile", "alice", "Ärger", "Bob"}
+	orderingResources = []string{"lb-Ω", "LB-b", "lb-a", "lb-Á"}
+	orderingActions   = []string{"update", "Get", "ünlink", "delete"}
+
+	sortedSubjects  = []string{"Bob", "Zed", "alice", "zoë", "Ärger", "émile"}
+	sortedResources = []string{"LB-b", "lb-a", "lb-Á", "lb-Ω"}
+	sortedActions   = []string{"Get", "delete", "update", "ünlink"}
+)
+
+// orderingPolicy returns a policy granting every ordering subject every ordering action on every
+// ordering resource. If reversed is set, subjects, resources, and actions are listed in reverse.
+func orderingPolicy(reversed bool) policy {
+	order := orderer(reversed)
+
+	var p policy
+
+	for _, id := range order(orderingSubjects) {
+		var resources []policyResource
+
+		for _, res := range order(orderingResources) {
+			resources = append(resources, policyResource{ID: res, Actions: order(orderingActions)})
+		}
+
+		p.Subjects = append(p.Subjects, testSubject(id, resources...))
+	}
+
+	return p
+}
+
+// orderer returns a function copying a list, in reverse if reversed is set.
+func orderer(reversed bool) func(in []string) []string {
+	return func(in []string) []string {
+		out := slices.Clone(in)
+		if reversed {
+			slices.Reverse(out)
+		}
+
+		return out
+	}
+}
+
+// writeOrderingPolicy writes orderingPolicy(reversed) to a file and returns its path.
+func writeOrderingPolicy(t *testing.T, reversed bool) string {
+	t.Helper()
+
+	b, err := yaml.Marshal(orderingPolicy(reversed))
+	if err != nil {
+		t.Fatalf("marshaling policy: %s", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatalf("writing policy: %s", err)
+	}
+
+	return path
+}
+
+func TestPolicyOutputOrdering(t *testing.T) {
+	forward := writeOrderingPolicy(t, false)
+	reverse := writeOrderingPolicy(t, true)
+
+	outputs := []struct {
+		name  string
+		write func(path string, w *bytes.Buffer) error
+	}{
+		{"snapshot", func(path string, w *bytes.Buffer) error {
+			return Snapshot(path, nil, w, nil)
+		}},
+		{"export yaml", func(path string, w *bytes.Buffer) error {
+			return Export(path, nil, w, nil, ExportYAML, false)
+		}},
+		{"export json", func(path string, w *bytes.Buffer) error {
+			return Export(path, nil, w, nil, ExportJSON, false)
+		}},
+		{"export effective yaml", func(path string, w *bytes.Buffer) error {
+			return Export(path, nil, w, nil, ExportYAML, true)
+		}},
+		{"export effective json", func(path string, w *bytes.Buffer) error {
+			return Export(path, nil, w, nil, ExportJSON, true)
+		}},
+	}
+
+	for _, tc := range outputs {
+		t.Run(tc.name, func(t *testing.T) {
+			var want bytes.Buffer
+			if err := tc.write(forward, &want); err != nil {
+				t.Fatalf("writing: %s", err)
+			}
+
+			for i := 0; i < 10; i++ {
+				for _, path := range []string{forward, reverse} {
+					var got bytes.Buffer
+					if err := tc.write(path, &got); err != nil {
+						t.Fatalf("writing: %s", err)
+					}
+
+					if !bytes.Equal(got.Bytes(), want.Bytes()) {
+						t.Fatalf("output %d of %s differs:\n%s\nwant:\n%s", i, path, got.String(), want.String())
+					}
+				}
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := Export(reverse, nil, &buf, nil, ExportJSON, true); err != nil {
+		t.Fatalf("exporting: %s", err)
+	}
+
+	var effective EffectivePolicy
+	if err := json.Unmarshal(buf.Bytes(), &effective); err != nil {
+		t.Fatalf("decoding export: %s", err)
+	}
+
+	var subjects []string
+
+	for _, sub := range effective.Subjects {
+		subjects = append(subjects, sub.ID)
+
+		var resources []string
+
+		for _, res := range sub.Resources {
+			resources = append(resources, res.ID)
+
+			var actions []string
+			for _, action := range res.Actions {
+				actions = append(actions, action.Action)
+			}
+
+			if !slices.Equal(actions, sortedActions) {
+				t.Errorf("subject %s resource %s actions are %q, want %q", sub.ID, res.ID, actions, sortedActions)
+			}
+		}
+
+		if !slices.Equal(resources, sortedResources) {
+			t.Errorf("subject %s resources are %q, want %q", sub.ID, resources, sortedResources)
+		}
+	}
+
+	if !slices.Equal(subjects, sortedSubjects) {
+		t.Errorf("subjects are %q, want %q", subjects, sortedSubjects)
+	}
+}
+
+func TestReportOrdering(t *testing.T) {
+	reports := []struct {
+		name string
+		// get returns the report with its timestamps cleared, and a key for each of its entries.
+		get func(s *server) (proto.Message, []string, error)
+		// want is the key of each entry, in order.
+		want []string
+	}{
+		{
+			name: "coverage",
+			get: func(s *server) (proto.Message, []string, error) {
+				resp, err := s.GetCoverage(context.Background(), &admin.GetCoverageRequest{})
+				if err != nil {
+					return nil, nil, err
+				}
+
+				resp.Since = nil
+
+				var keys []string
+				for _, g := range resp.Grants {
+					keys = append(keys, g.Subject+" "+g.ResourceId+" "+g.Action)
+				}
+
+				return resp, keys, nil
+			},
+			want: func() []string {
+				var out []string
+
+				for _, sub := range sortedSubjects {
+					for _, res := range sortedResources {
+						for _, action := range sortedActions {
+							out = append(out, sub+" "+res+" "+action)
+						}
+					}
+				}
+
+				return out
+			}(),
+		},
+		{
+			name: "usage",
+			get: func(s *server) (proto.Message, []string, error) {
+				resp, err := s.GetSubjectUsage(context.Background(), &admin.GetSubjectUsageRequest{})
+				if err != nil {
+					return nil, nil, err
+				}
+
+				resp.Since = nil
+
+				var subjects []string
+				for _, u := range resp.Subjects {
+					subjects = append(subjects, u.Subject)
+				}
+
+				return resp, subjects, nil
+			},
+			want: sortedSubjects,
+		},
+	}
+
+	forward := newTestServer(t, orderingPolicy(false))
+	reverse := newTestServer(t, orderingPolicy(true))
+	marshal := proto.MarshalOptions{Deterministic: true}
+
+	for _, tc := range reports {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, keys, err := tc.get(forward)
+			if err != nil {
+				t.Fatalf("getting report: %s", err)
+			}
+
+			if !slices.Equal(keys, tc.want) {
+				t.Errorf("entries are %q, want %q", keys, tc.want)
+			}
+
+			want, err := marshal.Marshal(resp)
+			if err != nil {
+				t.Fatalf("marshaling: %s", err)
+			}
+
+			for i := 0; i < 10; i++ {
+				for _, s := range []*server{forward, reverse} {
+					resp, _, err := tc.get(s)
+					if err != nil {
+						t.Fatalf("getting report: %s", err)
+					}
+
+					got, err := marshal.Marshal(resp)
+					if err != nil {
+						t.Fatalf("marshaling: %s", err)
+					}
+
+					if !bytes.Equal(got, want) {
+						t.Fatalf("report %d differs:\n%v", i, resp)
+					}
+				}
+			}
+		})
+	}
+}
+
+// orderingExpiry is when every grant of expiringOrderingPolicy expires, so the list of expiring
+// grants is ordered by its other fields alone.
+var orderingExpiry = time.Now().Add(24 * time.Hour).Truncate(time.Second)
+
+// expiringOrderingPolicy returns orderingPolicy(reversed), with every grant expiring at
+// orderingExpiry, and a role holding the same grants for the first subject.
+func expiringOrderingPolicy(reversed bool) policy {
+	p := orderingPolicy(reversed)
+
+	for i := range p.Subjects {
+		for j := range p.Subjects[i].Resources {
+			p.Subjects[i].Resources[j].ExpiresAt = &orderingExpiry
+		}
+	}
+
+	p.Roles = []policyRole{{ID: "operator", Resources: p.Subjects[0].Resources}}
+	p.Subjects[0].Roles = []string{"operator"}
+
+	return p
+}
+
+func TestListOrdering(t *testing.T) {
+	lists := []struct {
+		name string
+		// server returns a server holding the list's data, added in reverse if reversed is set.
+		server func(t *testing.T, reversed bool) *server
+		// get returns the list with the fields that vary between servers cleared.
+		get func(s *server) (proto.Message, error)
+	}{
+		{
+			name: "features",
+			server: func(t *testing.T, reversed bool) *server {
+				s := newTestServer(t, orderingPolicy(reversed))
+
+				for _, f := range features.Known() {
+					for _, id := range orderer(reversed)(orderingSubjects) {
+						s.features.Set(f, id, slices.Index(orderingSubjects, id)%2 == 0)
+					}
+				}
+
+				return s
+			},
+			get: func(s *server) (proto.Message, error) {
+				return s.ListFeatures(context.Background(), &admin.ListFeaturesRequest{})
+			},
+		},
+		{
+			name: "expiring grants",
+			server: func(t *testing.T, reversed bool) *server {
+				return newTestServer(t, expiringOrderingPolicy(reversed))
+			},
+			get: func(s *server) (proto.Message, error) {
+				return s.ListExpiringGrants(context.Background(), &admin.ListExpiringGrantsRequest{})
+			},
+		},
+		{
+			name: "policy snapshots",
+			server: func(t *testing.T, reversed bool) *server {
+				s := newTestServer(t, orderingPolicy(reversed), WithPolicyHistory(5))
+
+				for i := 1; i <= 3; i++ {
+					if err := s.setPolicy(orderingPolicy(reversed), "test", fmt.Sprintf("r%d", i)); err != nil {
+						t.Fatalf("setting policy: %s", err)
+					}
+				}
+
+				return s
+			},
+			get: func(s *server) (proto.Message, error) {
+				resp, err := s.ListPolicySnapshots(context.Background(), &admin.ListPolicySnapshotsRequest{})
+				if err != nil {
+					return nil, err
+				}
+
+				var revisions []string
+
+				for _, snap := range resp.Snapshots {
+					snap.LoadedAt = nil
+					revisions = append(revisions, snap.Revision)
+				}
+
+				// The active policy, then the replaced policies, most recent first.
+				if want := []string{"r3", "r2", "r1"}; !slices.Equal(revisions[:3], want) {
+					return nil, fmt.Errorf("revisions are %q, want %q first", revisions, want)
+				}
+
+				return resp, nil
+			},
+		},
+		{
+			name: "credentials",
+			server: func(t *testing.T, reversed bool) *server {
+				s := newTestServer(t, orderingPolicy(reversed))
+
+				expiresAt := time.Now().Add(time.Hour)
+
+				// Tokens expiring at the same time are ordered by fingerprint.
+				for _, tok := range orderer(reversed)([]string{"minted-a", "minted-b", "minted-c", "minted-d"}) {
+					s.issued.tokens[tok] = issuedToken{subjectID: "alice", expiresAt: expiresAt}
+				}
+
+				for _, client := range orderer(reversed)([]string{"client-a", "client-b"}) {
+					s.issued.tokens["token-"+client] = issuedToken{subjectID: "alice", clientID: client, expiresAt: expiresAt.Add(time.Minute)}
+				}
+
+				return s
+			},
+			get: func(s *server) (proto.Message, error) {
+				resp, err := s.ListCredentials(context.Background(), &credentials.ListCredentialsRequest{Credential: testToken("alice")})
+				if err != nil {
+					return nil, err
+				}
+
+				for _, c := range resp.Credentials {
+					c.LastUsedAt = nil
+					c.ExpiresAt = nil
+				}
+
+				return resp, nil
+			},
+		},
+		{
+			name: "audit",
+			server: func(t *testing.T, reversed bool) *server {
+				l, err := auditlog.Open(auditlog.Config{}, zap.NewNop().Sugar())
+				if err != nil {
+					t.Fatalf("opening audit log: %s", err)
+				}
+
+				s := newTestServer(t, orderingPolicy(reversed), WithAuditLog(l))
+
+				for _, id := range orderingSubjects {
+					metadata := make(map[string]string)
+					for _, key := range orderer(reversed)(orderingActions) {
+						metadata[key] = id
+					}
+
+					s.bus.Publish(events.DecisionMade{
+						Subject:    id,
+						Action:     "get",
+						ResourceID: "lb-a",
+						RuleIDs:    sortedActions,
+						Metadata:   metadata,
+						Time:       orderingExpiry,
+					})
+				}
+
+				return s
+			},
+			get: func(s *server) (proto.Message, error) {
+				resp, err := s.QueryAudit(context.Background(), &admin.QueryAuditRequest{Kind: events.KindDecisionMade})
+				if err != nil {
+					return nil, err
+				}
+
+				var subjects []string
+
+				for _, rec := range resp.Records {
+					rec.Time = nil
+					subjects = append(subjects, rec.Event.Fields["subject"].GetStringValue())
+				}
+
+				// Records are in the order they were appended.
+				if !slices.Equal(subjects, orderingSubjects) {
+					return nil, fmt.Errorf("subjects are %q, want %q", subjects, orderingSubjects)
+				}
+
+				return resp, nil
+			},
+		},
+	}
+
+	marshal := proto.MarshalOptions{Deterministic: true}
+
+	for _, tc := range lists {
+		t.Run(tc.name, func(t *testing.T) {
+			forward, reverse := tc.server(t, false), tc.server(t, true)
+
+			resp, err := tc.get(forward)
+			if err != nil {
+				t.Fatalf("listing: %s", err)
+			}
+
+			want, err := marshal.Marshal(resp)
+			if err != nil {
+				t.Fatalf("marshaling: %s", err)
+			}
+
+			for i := 0; i < 10; i++ {
+				for _, s := range []*server{forward, reverse} {
+					resp, err := tc.get(s)
+					if err != nil {
+						t.Fatalf("listing: %s", err)
+					}
+
+					got, err := marshal.Marshal(resp)
+					if err != nil {
+						t.Fatalf("marshaling: %s", err)
+					}
+
+					if !bytes.Equal(got, want) {
+						t.Fatalf("list %d differs:\n%v", i, resp)
+					}
+				}
+			}
+		})
+	}
+}
+
+// hintOrderingPolicy returns a policy giving alice each action on lb-a by several grants, or
+// from several grants that do not apply, listed in reverse if reversed is set.
+func hintOrderingPolicy(reversed bool) policy {
+	order := orderer(reversed)
+	expired := time.Now().Add(-time.Hour)
+
+	grants := func(resources ...policyResource) []policyResource {
+		if reversed {
+			slices.Reverse(resources)
+		}
+
+		return resources
+	}
+
+	var roles []policyRole
+
+	for _, id := range order([]string{"viewer", "editor", "auditor"}) {
+		roles = append(roles, policyRole{ID: id, Resources: grants(
+			policyResource{ID: "lb-a", Actions: order([]string{"get", "list"})},
+			policyResource{ID: "lb-a", Actions: []string{"delete"}, ExpiresAt: &expired},
+		)})
+	}
+
+	alice := testSubject("alice", grants(
+		policyResource{ID: "lb-a", Actions: order([]string{"get", "list", "watch"})},
+		policyResource{ID: "lb-*", Actions: []string{"get"}},
+		policyResource{ID: "*-a", Actions: []string{"get"}},
+		policyResource{ID: "lb-a", Actions: []string{"update"}, Conditions: &grantConditions{Attributes: map[string]string{"env": "prod"}}},
+		policyResource{ID: "lb-*", Actions: []string{"update"}, Conditions: &grantConditions{Attributes: map[string]string{"team": "net"}}},
+		policyResource{ID: "lb-b", Actions: []string{"scale"}},
+		policyResource{ID: "lb-c", Actions: []string{"scale"}},
+		policyResource{ID: "lb-d", Actions: []string{"scale"}},
+		policyResource{ID: "lb-e", Actions: []string{"scale"}},
+	)...)
+	alice.Roles = order([]string{"viewer", "editor", "auditor"})
+
+	return policy{Subjects: []policySubject{alice}, Roles: roles}
+}
+
+func TestExplainOrdering(t *testing.T) {
+	forward := newTestServer(t, hintOrderingPolicy(false), WithDenialHints())
+	reverse := newTestServer(t, hintOrderingPolicy(true), WithDenialHints())
+
+	for _, action := range []string{"get", "update", "delete", "scale"} {
+		t.Run(action, func(t *testing.T) {
+			want := forward.state.Load().explorer.Explain("alice", action, "lb-a").Reasons
+
+			if len(want) < 2 {
+				t.Fatalf("explanation has reasons %q, want several", want)
+			}
+
+			for i := 0; i < 10; i++ {
+				for _, s := range []*server{forward, reverse} {
+					if got := s.state.Load().explorer.Explain("alice", action, "lb-a").Reasons; !slices.Equal(got, want) {
+						t.Fatalf("explanation %d is %q, want %q", i, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDenialHintOrdering(t *testing.T) {
+	forward := newTestServer(t, hintOrderingPolicy(false), WithDenialHints())
+	reverse := newTestServer(t, hintOrderingPolicy(true), WithDenialHints())
+
+	hints := func(s *server) []string {
+		t.Helper()
+
+		err := checkTestAccess(s, "alice",
+			&authorization.AccessRequestAction{Action: "update", ResourceId: "lb-a"},
+			&authorization.AccessRequestAction{Action: "delete", ResourceId: "lb-a"},
+			&authorization.AccessRequestAction{Action: "scale", ResourceId: "lb-a"},
+		)
+
+		for _, d := range status.Convert(err).Details() {
+			if info, ok := d.(*errdetails.DebugInfo); ok {
+				return info.StackEntries
+			}
+		}
+
+		t.Fatalf("denial %v has no hints", err)
+
+		return nil
+	}
+
+	want := hints(forward)
+	if len(want) != 3 {
+		t.Fatalf("got hints %q, want one per denied action", want)
+	}
+
+	for i := 0; i < 10; i++ {
+		for _, s := range []*server{forward, reverse} {
+			if got := hints(s); !slices.Equal(got, want) {
+				t.Fatalf("hints %d are:\n%q\nwant:\n%q", i, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// Patch markers control how overlay entries are merged into the base policy.
+const (
+	// patchMerge merges an entry into the matching base entry, or adds it if none exists. Tokens
+	// and resources are merged by ID and actions are unioned. This is the default.
+	patchMerge = "merge"
+	// patchAdd adds an entry that must not already exist in the base policy.
+	patchAdd = "add"
+	// patchReplace replaces the matching base entry, which must exist, with the overlay entry.
+	patchReplace = "replace"
+	// patchRemove removes the matching base entry, which must exist.
+	patchRemove = "remove"
+)
+
+// readPolicyFiles reads the policy at policyPath with read and applies each overlay on top of it in
+// order.
+func readPolicyFiles(read ReadFileFunc, policyPath string, overlayPaths ...string) (policy, error) {
+	base, err := readPolicyFile(read, policyPath)
+	if err != nil {
+		return policy{}, err
+	}
+
+	if err := checkNoPatchMarkers(base); err != nil {
+		return policy{}, fmt.Errorf("%s: %w", policyPath, err)
+	}
+
+	return applyOverlayFiles(read, base, overlayPaths...)
+}
+
+// applyOverlayFiles reads each overlay with read and applies it on top of base in order.
+func applyOverlayFiles(read ReadFileFunc, base policy, overlayPaths ...string) (policy, error) {
+	for _, path := range overlayPaths {
+		overlay, err := readPolicyFile(read, path)
+		if err != nil {
+			return policy{}, err
+		}
+
+		base, err = applyOverlay(base, overlay)
+		if err != nil {
+			return policy{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return base, nil
+}
+
+// readPolicyFile reads the policy file at path, or merges the policy files in it if it is a
+// directory.
+func readPolicyFile(read ReadFileFunc, path string) (policy, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return readPolicyDir(read, path)
+	}
+
+	b, err := read(path)
+	if err != nil {
+		return policy{}, err
+	}
+
+	return readPolicy(bytes.NewReader(b))
+}
+
+func checkNoPatchMarkers(p policy) error {
+	for _, sub := range p.Subjects {
+		if sub.Patch != "" {
+			return fmt.Errorf("%s: patch markers are only allowed in overlays: %w", sub.ID, ErrInvalidPatch)
+		}
+
+		for _, res := range sub.Resources {
+			if res.Patch != "" {
+				return fmt.Errorf("%s: %s: patch markers are only allowed in overlays: %w", sub.ID, res.ID, ErrInvalidPatch)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyOverlay returns the result of merging overlay into base according to each entry's patch
+// marker. Base is not modified.
+func applyOverlay(base, overlay policy) (policy, error) {
+	subjects := append([]policySubject(nil), base.Subjects...)
+
+	for _, sub := range overlay.Subjects {
+		idx := indexSubject(subjects, sub.ID)
+
+		switch patchOrDefault(sub.Patch) {
+		case patchAdd:
+			if idx >= 0 {
+				return policy{}, fmt.Errorf("%s: %w", sub.ID, ErrDuplicateValue)
+			}
+
+			subjects = append(subjects, stripPatch(sub))
+		case patchReplace:
+			if idx < 0 {
+				return policy{}, fmt.Errorf("%s: cannot replace: %w", sub.ID, ErrMissingValue)
+			}
+
+			subjects[idx] = stripPatch(sub)
+		case patchRemove:
+			if idx < 0 {
+				return policy{}, fmt.Errorf("%s: cannot remove: %w", sub.ID, ErrMissingValue)
+			}
+
+			subjects = append(subjects[:idx:idx], subjects[idx+1:]...)
+		case patchMerge:
+			if idx < 0 {
+				subjects = append(subjects, stripPatch(sub))
+
+				continue
+			}
+
+			merged, err := mergeSubject(subjects[idx], sub)
+			if err != nil {
+				return policy{}, err
+			}
+
+			subjects[idx] = merged
+		default:
+			return policy{}, fmt.Errorf("%s: unknown patch '%s': %w", sub.ID, sub.Patch, ErrInvalidPatch)
+		}
+	}
+
+	return policy{
+		Implies:    mergeTables(base.Implies, overlay.Implies),
+		Contains:   mergeTables(base.Contains, overlay.Contains),
+		Tenants:    mergeTables(base.Tenants, overlay.Tenants),
+		Roles:      mergeRoles(base.Roles, overlay.Roles),
+		Sensitive:  mergeStrings(base.Sensitive, overlay.Sensitive),
+		Deprecated: mergeDeprecations(base.Deprecated, overlay.Deprecated),
+		// An overlay can make a policy strict, but not relax it.
+		StrictUnknowns: base.StrictUnknowns || overlay.StrictUnknowns,
+		Identities:     mergeIdentities(base.Identities, overlay.Identities),
+		OnCall:         mergeOnCall(base.OnCall, overlay.OnCall),
+		Subjects:       subjects,
+	}, nil
+}
+
+func mergeSubject(base, overlay policySubject) (policySubject, error) {
+	out := policySubject{
+		ID:               base.ID,
+		Tokens:           append([]policyToken(nil), base.Tokens...),
+		Resources:        append([]policyResource(nil), base.Resources...),
+		Roles:            append([]string(nil), base.Roles...),
+		Delegations:      append([]policyDelegation(nil), base.Delegations...),
+		Deny:             append([]policyDeny(nil), base.Deny...),
+		Clients:          append([]policyClient(nil), base.Clients...),
+		JWTSubjects:      append([]policyJWTSubject(nil), base.JWTSubjects...),
+		AllowedNetworks:  mergeStrings(base.AllowedNetworks, overlay.AllowedNetworks),
+		ResponseMetadata: mergeResponseMetadata(base.ResponseMetadata, overlay.ResponseMetadata),
+		Claims:           mergeStringMaps(base.Claims, overlay.Claims),
+		Tenant:           base.Tenant,
+	}
+
+	if overlay.Tenant != "" {
+		out.Tenant = overlay.Tenant
+	}
+
+	for _, js := range overlay.JWTSubjects {
+		if !containsJWTSubject(out.JWTSubjects, js) {
+			out.JWTSubjects = append(out.JWTSubjects, js)
+		}
+	}
+
+	for _, ref := range overlay.Roles {
+		if !containsString(out.Roles, ref) {
+			out.Roles = append(out.Roles, ref)
+		}
+	}
+
+	for _, tok := range overlay.Tokens {
+		if !containsToken(out.Tokens, tok) {
+			out.Tokens = append(out.Tokens, tok)
+		}
+	}
+
+	for _, del := range overlay.Delegations {
+		out.Delegations = mergeDelegation(out.Delegations, del)
+	}
+
+	for _, client := range overlay.Clients {
+		out.Clients = mergeClient(out.Clients, client)
+	}
+
+	for _, d := range overlay.Deny {
+		out.Deny = mergeDeny(out.Deny, d)
+	}
+
+	for _, res := range overlay.Resources {
+		idx := indexResource(out.Resources, res)
+
+		switch patchOrDefault(res.Patch) {
+		case patchAdd:
+			if idx >= 0 {
+				return policySubject{}, fmt.Errorf("%s: %s: %w", base.ID, res.ID, ErrDuplicateValue)
+			}
+
+			out.Resources = append(out.Resources, policyResource{ID: res.ID, RuleID: res.RuleID, Actions: res.Actions, ExpiresAt: res.ExpiresAt, Conditions: res.Conditions})
+		case patchReplace:
+			if idx < 0 {
+				return policySubject{}, fmt.Errorf("%s: %s: cannot replace: %w", base.ID, res.ID, ErrMissingValue)
+			}
+
+			out.Resources[idx] = policyResource{ID: res.ID, RuleID: res.RuleID, Actions: res.Actions, ExpiresAt: res.ExpiresAt, Conditions: res.Conditions}
+		case patchRemove:
+			if idx < 0 {
+				return policySubject{}, fmt.Errorf("%s: %s: cannot remove: %w", base.ID, res.ID, ErrMissingValue)
+			}
+
+			out.Resources = append(out.Resources[:idx:idx], out.Resources[idx+1:]...)
+		case patchMerge:
+			if idx < 0 {
+				out.Resources = append(out.Resources, policyResource{ID: res.ID, RuleID: res.RuleID, Actions: res.Actions, ExpiresAt: res.ExpiresAt, Conditions: res.Conditions})
+
+				continue
+			}
+
+			actions := append([]string(nil), out.Resources[idx].Actions...)
+			for _, action := range res.Actions {
+				if !containsString(actions, action) {
+					actions = append(actions, action)
+				}
+			}
+
+			// The merged grant expires when the overlay says, if it sets an expiry.
+			expiresAt := out.Resources[idx].ExpiresAt
+			if res.ExpiresAt != nil {
+				expiresAt = res.ExpiresAt
+			}
+
+			ruleID := out.Resources[idx].RuleID
+			if res.RuleID != "" {
+				ruleID = res.RuleID
+			}
+
+			out.Resources[idx] = policyResource{ID: res.ID, RuleID: ruleID, Actions: actions, ExpiresAt: expiresAt, Conditions: res.Conditions}
+		default:
+			return policySubject{}, fmt.Errorf("%s: %s: unknown patch '%s': %w", base.ID, res.ID, res.Patch, ErrInvalidPatch)
+		}
+	}
+
+	return out, nil
+}
+
+// mergeDelegation unions the actions of del into the matching delegation, or appends it.
+func mergeDelegation(delegations []policyDelegation, del policyDelegation) []policyDelegation {
+	for i, candidate := range delegations {
+		if candidate.Subject != del.Subject {
+			continue
+		}
+
+		actions := append([]string(nil), candidate.Actions...)
+		for _, action := range del.Actions {
+			if !containsString(actions, action) {
+				actions = append(actions, action)
+			}
+		}
+
+		delegations[i] = policyDelegation{Subject: del.Subject, Actions: actions}
+
+		return delegations
+	}
+
+	return append(delegations, del)
+}
+
+// mergeClient replaces the client with the same ID, so overlays can change a client's secret, or
+// appends it.
+func mergeClient(clients []policyClient, client policyClient) []policyClient {
+	for i, candidate := range clients {
+		if candidate.ID == client.ID {
+			clients[i] = client
+
+			return clients
+		}
+	}
+
+	return append(clients, client)
+}
+
+// mergeStrings returns base with the values of overlay it does not already contain appended.
+func mergeStrings(base, overlay []string) []string {
+	out := append([]string(nil), base...)
+
+	for _, v := range overlay {
+		if !containsString(out, v) {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+func patchOrDefault(patch string) string {
+	if patch == "" {
+		return patchMerge
+	}
+
+	return patch
+}
+
+func stripPatch(sub policySubject) policySubject {
+	out := policySubject{
+		ID:               sub.ID,
+		Tokens:           sub.Tokens,
+		Roles:            sub.Roles,
+		Delegations:      sub.Delegations,
+		Deny:             sub.Deny,
+		Clients:          sub.Clients,
+		JWTSubjects:      sub.JWTSubjects,
+		AllowedNetworks:  sub.AllowedNetworks,
+		ResponseMetadata: sub.ResponseMetadata,
+		Claims:           sub.Claims,
+		Tenant:           sub.Tenant,
+	}
+
+	for _, res := range sub.Resources {
+		out.Resources = append(out.Resources, policyResource{ID: res.ID, RuleID: res.RuleID, Actions: res.Actions, ExpiresAt: res.ExpiresAt, Conditions: res.Conditions})
+	}
+
+	return out
+}
+
+func indexSubject(subjects []policySubject, id string) int {
+	for i, sub := range subjects {
+		if sub.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// indexResource returns the index of the entry an overlay entry patches: the first on the same
+// resource with the same conditions, or -1 if there is none.
+func indexResource(resources []policyResource, patch policyResource) int {
+	for i, res := range resources {
+		if res.ID == patch.ID && res.Conditions.key() == patch.Conditions.key() {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func containsToken(tokens []policyToken, tok policyToken) bool {
+	for _, candidate := range tokens {
+		if candidate == tok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsJWTSubject(subjects []policyJWTSubject, js policyJWTSubject) bool {
+	for _, candidate := range subjects {
+		if candidate == js {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+
+	return false
+}
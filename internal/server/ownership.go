@@ -0,0 +1,74 @@
+package server
+
+import (
+	"sort"
+	"time"
+)
+
+// ownershipRulePrefix starts the rule ID reported for grants given by a relationship, followed by
+// the relation.
+const ownershipRulePrefix = "relation:"
+
+// ownerActions returns, for each relation with ownership grants, the actions it grants with the
+// actions they imply in p.
+func (s *server) ownerActions(p policy) map[string][]string {
+	if len(s.ownership) == 0 {
+		return nil
+	}
+
+	closure := transitiveClosure(p.Implies)
+	out := make(map[string][]string, len(s.ownership))
+
+	for relation, actions := range s.ownership {
+		out[relation] = expandActions(actions, closure)
+	}
+
+	return out
+}
+
+// allowsOwner reports whether a relationship from the resource to sub, of a relation with
+// ownership grants, gives sub the action on the resource at now, and returns the grants that do.
+func (s *server) allowsOwner(st *policyState, sub policySubject, action, resourceID string, now time.Time) (bool, []grantRef) {
+	if len(st.ownerActions) == 0 || s.relationships == nil {
+		return false, nil
+	}
+
+	var out []grantRef
+
+	for _, relation := range s.relationships.relations(resourceID, s.normalizeResourceID(sub.ID), now) {
+		for _, granted := range st.ownerActions[relation] {
+			if granted != action && !(isPattern(granted) && matchPattern(granted, action)) {
+				continue
+			}
+
+			out = append(out, grantRef{
+				Subject:    sub.ID,
+				ResourceID: resourceID,
+				Action:     granted,
+				RuleID:     ownershipRulePrefix + relation,
+			})
+
+			break
+		}
+	}
+
+	return len(out) > 0, out
+}
+
+// relations returns the relations from resourceID to subjectID visible at now, in sorted order.
+func (r *relationshipStore) relations(resourceID, subjectID string, now time.Time) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var out []string
+
+	for key, edge := range r.edges[resourceID] {
+		if key.subjectID == subjectID && edge.visible(now) {
+			out = append(out, key.relation)
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
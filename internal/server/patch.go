@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// policySourceAdmin is the source recorded for policies modified using the admin API.
+const policySourceAdmin = "admin"
+
+// applyJSONPatch applies an RFC 6902 JSON Patch document to the JSON form of a policy.
+func applyJSONPatch(p policy, patchDoc []byte) (policy, error) {
+	patch, err := jsonpatch.DecodePatch(patchDoc)
+	if err != nil {
+		return policy{}, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+
+	doc, err := json.Marshal(p)
+	if err != nil {
+		return policy{}, err
+	}
+
+	patched, err := patch.Apply(doc)
+	if err != nil {
+		return policy{}, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+
+	var out policy
+	if err := dec.Decode(&out); err != nil {
+		return policy{}, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+
+	if err := checkNoPatchMarkers(out); err != nil {
+		return policy{}, err
+	}
+
+	return out, nil
+}
+
+// applyMergePatch merges a policy overlay document into a policy.
+func applyMergePatch(p policy, patchDoc []byte) (policy, error) {
+	overlay, err := readPolicy(bytes.NewReader(patchDoc))
+	if err != nil {
+		return policy{}, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+
+	return applyOverlay(p, overlay)
+}
+
+// patchPolicy applies fn to the active policy and swaps in the result. Concurrent updates are
+// serialized so no update is lost.
+func (s *server) patchPolicy(fn func(policy) (policy, error)) (policy, error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	patched, err := fn(s.state.Load().policy)
+	if err != nil {
+		return policy{}, err
+	}
+
+	if err := s.setPolicy(patched, policySourceAdmin, ""); err != nil {
+		return policy{}, err
+	}
+
+	return patched, nil
+}
+
+func (s *server) PatchPolicy(_ context.Context, req *admin.PatchPolicyRequest) (*admin.PatchPolicyResponse, error) {
+	s.logger.Info("received PatchPolicy request")
+
+	if err := s.requireAdminToken("patching the policy"); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkPolicyWritable(); err != nil {
+		return nil, err
+	}
+
+	var fn func(policy) (policy, error)
+
+	switch patch := req.Patch.(type) {
+	case *admin.PatchPolicyRequest_JsonPatch:
+		fn = func(p policy) (policy, error) {
+			return applyJSONPatch(p, patch.JsonPatch)
+		}
+	case *admin.PatchPolicyRequest_MergePatch:
+		fn = func(p policy) (policy, error) {
+			return applyMergePatch(p, patch.MergePatch)
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "a patch is required")
+	}
+
+	patched, err := s.patchPolicy(fn)
+	if err != nil {
+		s.logger.Warnw("rejected policy patch", "error", err)
+
+		return nil, status.Errorf(codes.InvalidArgument, "invalid policy patch: %s", err)
+	}
+
+	s.logger.Infow("applied policy patch", "subjects", len(patched.Subjects))
+
+	var buf bytes.Buffer
+	if err := encodePolicy(&buf, canonicalPolicy(patched)); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode policy")
+	}
+
+	return &admin.PatchPolicyResponse{Policy: buf.String()}, nil
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"sort"
+	"strings"
+)
+
+// isPattern reports whether a granted resource ID or action is a glob pattern.
+func isPattern(s string) bool {
+	return strings.Contains(s, "*")
+}
+
+// matchPattern reports whether name matches pattern, in which each * matches any run of
+// characters, including none. A pattern without * only matches itself.
+func matchPattern(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+
+	first, last := parts[0], parts[len(parts)-1]
+	if !strings.HasPrefix(name, first) || !strings.HasSuffix(name[len(first):], last) {
+		return false
+	}
+
+	rest := name[len(first) : len(name)-len(last)]
+
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+
+		rest = rest[i+len(part):]
+	}
+
+	return true
+}
+
+// matchesAny reports whether name is, or matches a pattern in, granted.
+func matchesAny(granted []string, name string) bool {
+	for _, g := range granted {
+		if g == name || (isPattern(g) && matchPattern(g, name)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resourceMatches reports whether a granted resource ID is, or is a pattern matching, resourceID.
+func resourceMatches(id, resourceID string) bool {
+	return id == resourceID || (isPattern(id) && matchPattern(id, resourceID))
+}
+
+// patternResources returns the subject's grants whose resource ID is a pattern matching
+// resourceID.
+func patternResources(sub policySubject, resourceID string) []policyResource {
+	var out []policyResource
+
+	if sub.index != nil {
+		for _, i := range sub.index.patterns {
+			if res := sub.Resources[i]; res.ID != resourceID && matchPattern(res.ID, resourceID) {
+				out = append(out, res)
+			}
+		}
+
+		return out
+	}
+
+	for _, res := range sub.Resources {
+		if res.ID != resourceID && resourceMatches(res.ID, resourceID) {
+			out = append(out, res)
+		}
+	}
+
+	return out
+}
+
+// actionGrants returns the grants giving action on res, including those of matching action
+// patterns.
+func actionGrants(res policyResource, action string) []grantRef {
+	out := appendGrants(nil, res.rules[action])
+
+	var patterns []string
+
+	for granted := range res.rules {
+		if granted != action && isPattern(granted) && matchPattern(granted, action) {
+			patterns = append(patterns, granted)
+		}
+	}
+
+	sort.Strings(patterns)
+
+	for _, granted := range patterns {
+		out = appendGrants(out, res.rules[granted])
+	}
+
+	return out
+}
@@ -2,27 +2,129 @@ package server
 
 import (
 	"io"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/capability"
 
 	"gopkg.in/yaml.v3"
 )
 
+// policyToken is where a subject's static token comes from. Exactly one source is set.
 type policyToken struct {
-	EnvVar string `yaml:"envVar"`
+	// EnvVar names the environment variable holding the token.
+	EnvVar string `yaml:"envVar,omitempty" json:"envVar,omitempty"`
+	// File is the path of a file holding the token, such as a mounted Kubernetes secret.
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
+	// SHA256 is the hex-encoded SHA-256 digest of the token, so the policy never holds the token.
+	SHA256 string `yaml:"sha256,omitempty" json:"sha256,omitempty"`
+	// Exec is a shell command printing the token, for credentials that can only be obtained when
+	// the policy is loaded. Commands run only if the runtime enables them.
+	Exec string `yaml:"exec,omitempty" json:"exec,omitempty"`
+}
+
+// policyJWTSubject identifies a subject by the claims of a verified JWT.
+type policyJWTSubject struct {
+	Issuer  string `yaml:"issuer" json:"issuer"`
+	Subject string `yaml:"subject" json:"subject"`
+}
+
+// policyIdentity is a workload identity and the environment variable holding its access token.
+type policyIdentity struct {
+	ID          string `yaml:"id" json:"id"`
+	TokenEnvVar string `yaml:"tokenEnvVar" json:"tokenEnvVar"`
 }
 
 type policyResource struct {
-	ID      string
-	Actions []string
+	ID string `yaml:"id" json:"id"`
+	// RuleID optionally identifies the grant in CheckAccess trailers and decision events.
+	RuleID  string   `yaml:"ruleId,omitempty" json:"ruleId,omitempty"`
+	Actions []string `yaml:"actions" json:"actions"`
+	// ExpiresAt, if set, is when the grant stops applying.
+	ExpiresAt *time.Time `yaml:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	// Conditions, if set, limit when the grant applies. A conditional grant adds to the subject's
+	// other grants on the resource instead of replacing them.
+	Conditions *grantConditions `yaml:"conditions,omitempty" json:"conditions,omitempty"`
+	// Patch controls how the resource is merged when it appears in an overlay.
+	Patch string `yaml:"patch,omitempty" json:"patch,omitempty"`
+
+	// rules maps each action to the source grants giving it, once subjects are compiled.
+	rules map[string][]grantRef
+}
+
+// policyDelegation grants the owning subject the ability to act on behalf of another subject for
+// a subset of actions.
+type policyDelegation struct {
+	Subject string   `yaml:"subject" json:"subject"`
+	Actions []string `yaml:"actions" json:"actions"`
+}
+
+// policyClient is an OAuth2 client that can exchange its secret for an access token for the owning
+// subject.
+type policyClient struct {
+	ID           string `yaml:"id" json:"id"`
+	SecretEnvVar string `yaml:"secretEnvVar" json:"secretEnvVar"`
 }
 
 type policySubject struct {
-	ID        string
-	Tokens    []policyToken
-	Resources []policyResource
+	ID        string           `yaml:"id" json:"id"`
+	Tokens    []policyToken    `yaml:"tokens" json:"tokens"`
+	Resources []policyResource `yaml:"resources" json:"resources"`
+	// Roles references roles by ID, optionally pinned to a version as id@version.
+	Roles       []string           `yaml:"roles,omitempty" json:"roles,omitempty"`
+	Delegations []policyDelegation `yaml:"delegations,omitempty" json:"delegations,omitempty"`
+	Clients     []policyClient     `yaml:"clients,omitempty" json:"clients,omitempty"`
+	// Deny rejects actions on resources even if the subject's grants or roles allow them.
+	Deny []policyDeny `yaml:"deny,omitempty" json:"deny,omitempty"`
+	// AllowedNetworks restricts the subject's credentials to requests from these CIDR ranges when
+	// serving over TCP.
+	AllowedNetworks []string `yaml:"allowedNetworks,omitempty" json:"allowedNetworks,omitempty"`
+	// JWTSubjects authenticate the subject with JWTs verified by the configured identity provider,
+	// by their iss and sub claims.
+	JWTSubjects []policyJWTSubject `yaml:"jwtSubjects,omitempty" json:"jwtSubjects,omitempty"`
+	// ResponseMetadata is returned as gRPC headers and trailers with every response to the
+	// subject's credentials.
+	ResponseMetadata *policyResponseMetadata `yaml:"responseMetadata,omitempty" json:"responseMetadata,omitempty"`
+	// Claims are returned by AuthenticateSubject along with sub. Values that are not strings, such
+	// as lists and nested maps, are returned as JSON.
+	Claims map[string]any `yaml:"claims,omitempty" json:"claims,omitempty"`
+	// Tenant scopes the subject to a tenant: it is denied access to resources of other tenants,
+	// whatever its grants, and AuthenticateSubject returns the tenant as a claim.
+	Tenant string `yaml:"tenant,omitempty" json:"tenant,omitempty"`
+	// Patch controls how the subject is merged when it appears in an overlay.
+	Patch string `yaml:"patch,omitempty" json:"patch,omitempty"`
+
+	// index indexes the subject's grants once it is compiled into a policy state.
+	index *grantIndex
+	// scope limits the subject to a capability token's grant, when authenticated by one.
+	scope *capability.Grant
+	// conditional holds the subject's conditional grants once it is compiled.
+	conditional []conditionalGrant
 }
 
 type policy struct {
-	Subjects []policySubject
+	// Implies maps an action to the lesser actions it grants, such as an update action implying
+	// the matching get action. Implications are transitive.
+	Implies map[string][]string `yaml:"implies,omitempty" json:"implies,omitempty"`
+	// Contains maps a resource to the resources it contains, such as a tenant containing its load
+	// balancers. Grants on a resource apply to everything it contains, transitively.
+	Contains map[string][]string `yaml:"contains,omitempty" json:"contains,omitempty"`
+	// Tenants maps a tenant to the resources it owns. A tenant also owns every resource they
+	// contain. Resources no tenant owns are shared by all tenants.
+	Tenants map[string][]string `yaml:"tenants,omitempty" json:"tenants,omitempty"`
+	Roles   []policyRole        `yaml:"roles,omitempty" json:"roles,omitempty"`
+	// Sensitive lists actions whose decisions are logged at higher severity and sent to the
+	// alert webhook.
+	Sensitive []string `yaml:"sensitive,omitempty" json:"sensitive,omitempty"`
+	// Deprecated marks actions and resources that subjects should migrate off of.
+	Deprecated policyDeprecations `yaml:"deprecated,omitempty" json:"deprecated,omitempty"`
+	// StrictUnknowns rejects access checks naming an action or resource that the policy does not
+	// declare, instead of denying them.
+	StrictUnknowns bool `yaml:"strictUnknowns,omitempty" json:"strictUnknowns,omitempty"`
+	// Identities are the workload identities whose access tokens the Identity service returns.
+	Identities []policyIdentity `yaml:"identities,omitempty" json:"identities,omitempty"`
+	// OnCall grants subjects temporary access during recurring windows.
+	OnCall   []policyOnCall  `yaml:"onCall,omitempty" json:"onCall,omitempty"`
+	Subjects []policySubject `yaml:"subjects" json:"subjects"`
 }
 
 func readPolicy(r io.Reader) (policy, error) {
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IsPolicyFile reports whether a file with the given name is read from a policy directory: a YAML
+// or JSON file that is not hidden.
+func IsPolicyFile(name string) bool {
+	base := filepath.Base(name)
+	if strings.HasPrefix(base, ".") {
+		return false
+	}
+
+	switch filepath.Ext(base) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// PolicyDirFiles returns the paths of the policy files in dir, sorted by name. Subdirectories are
+// not read.
+func PolicyDirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+
+	for _, entry := range entries {
+		if !entry.IsDir() && IsPolicyFile(entry.Name()) {
+			out = append(out, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s: no policy files found: %w", dir, ErrMissingValue)
+	}
+
+	sort.Strings(out)
+
+	return out, nil
+}
+
+// ReadPolicyDir reads the policy files in dir with read and returns them merged into a single
+// policy document. Files are merged in name order; see mergePolicyFiles for how they combine. If
+// read is nil, only plaintext policies can be read.
+func ReadPolicyDir(dir string, read ReadFileFunc) ([]byte, error) {
+	p, err := readPolicyDir(readerOrDefault(read), dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(p)
+}
+
+func readPolicyDir(read ReadFileFunc, dir string) (policy, error) {
+	paths, err := PolicyDirFiles(dir)
+	if err != nil {
+		return policy{}, err
+	}
+
+	policies := make([]policy, 0, len(paths))
+
+	for _, path := range paths {
+		b, err := read(path)
+		if err != nil {
+			return policy{}, err
+		}
+
+		p, err := readPolicy(bytes.NewReader(b))
+		if err != nil {
+			return policy{}, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if err := checkNoPatchMarkers(p); err != nil {
+			return policy{}, fmt.Errorf("%s: %w", path, err)
+		}
+
+		policies = append(policies, p)
+	}
+
+	return mergePolicyFiles(paths, policies)
+}
+
+// mergePolicyFiles merges the policies read from the files at paths, in order. Unlike overlays,
+// the files are peers: a subject, role version, identity, or on-call schedule may only be defined
+// in one of them, and an action or resource may only be deprecated with one message.
+// Implications, containment, and sensitive actions are unioned, and the merged policy is strict if
+// any file is.
+func mergePolicyFiles(paths []string, policies []policy) (policy, error) {
+	var (
+		out        policy
+		subjects   = make(map[string]string)
+		roles      = make(map[string]string)
+		identities = make(map[string]string)
+		onCall     = make(map[string]string)
+	)
+
+	for i, p := range policies {
+		path := paths[i]
+
+		for _, sub := range p.Subjects {
+			if err := claim(subjects, sub.ID, path); err != nil {
+				return policy{}, fmt.Errorf("%s: subject %w", sub.ID, err)
+			}
+		}
+
+		for _, role := range p.Roles {
+			if err := claim(roles, role.ref(), path); err != nil {
+				return policy{}, fmt.Errorf("role %s: role %w", role.ref(), err)
+			}
+		}
+
+		for _, id := range p.Identities {
+			if err := claim(identities, id.ID, path); err != nil {
+				return policy{}, fmt.Errorf("%s: identity %w", id.ID, err)
+			}
+		}
+
+		for _, o := range p.OnCall {
+			if err := claim(onCall, o.ID, path); err != nil {
+				return policy{}, fmt.Errorf("on-call schedule %s: schedule %w", o.ID, err)
+			}
+		}
+
+		if key := deprecationConflict(out.Deprecated.Actions, p.Deprecated.Actions); key != "" {
+			return policy{}, fmt.Errorf("%s: action is deprecated with a different message in %s: %w", key, path, ErrDuplicateValue)
+		}
+
+		if key := deprecationConflict(out.Deprecated.Resources, p.Deprecated.Resources); key != "" {
+			return policy{}, fmt.Errorf("%s: resource is deprecated with a different message in %s: %w", key, path, ErrDuplicateValue)
+		}
+
+		out = policy{
+			Implies:        mergeTables(out.Implies, p.Implies),
+			Contains:       mergeTables(out.Contains, p.Contains),
+			Tenants:        mergeTables(out.Tenants, p.Tenants),
+			Roles:          append(out.Roles, p.Roles...),
+			Sensitive:      mergeStrings(out.Sensitive, p.Sensitive),
+			Deprecated:     mergeDeprecations(out.Deprecated, p.Deprecated),
+			StrictUnknowns: out.StrictUnknowns || p.StrictUnknowns,
+			Identities:     append(out.Identities, p.Identities...),
+			OnCall:         append(out.OnCall, p.OnCall...),
+			Subjects:       append(out.Subjects, p.Subjects...),
+		}
+	}
+
+	return out, nil
+}
+
+// claim records path as the file defining key, failing if another file already does.
+func claim(owners map[string]string, key, path string) error {
+	if owner, ok := owners[key]; ok {
+		if owner == path {
+			return fmt.Errorf("is defined more than once in %s: %w", path, ErrDuplicateValue)
+		}
+
+		return fmt.Errorf("is defined in both %s and %s: %w", owner, path, ErrDuplicateValue)
+	}
+
+	owners[key] = path
+
+	return nil
+}
+
+// deprecationConflict returns the first key, in order, deprecated with different messages in
+// base and overlay, or an empty string if there is none.
+func deprecationConflict(base, overlay map[string]string) string {
+	keys := make([]string, 0, len(overlay))
+
+	for key := range overlay {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if msg, ok := base[key]; ok && msg != overlay[key] {
+			return key
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// denialDomain is the ErrorInfo domain of denials. Matches client.ReasonDomain.
+const denialDomain = "iam-runtime-static"
+
+// Reason codes attached to denials. They are stable, so clients can map them to their own
+// messages. Matches the client.Reason constants.
+const (
+	reasonCredentialTooLong        = "CREDENTIAL_TOO_LONG"
+	reasonInvalidCredential        = "INVALID_CREDENTIAL"
+	reasonPrivateKeyCredential     = "PRIVATE_KEY_CREDENTIAL"
+	reasonUnexpectedJWT            = "UNEXPECTED_JWT"
+	reasonCredentialWhitespace     = "CREDENTIAL_WHITESPACE"
+	reasonCredentialAuthScheme     = "CREDENTIAL_AUTH_SCHEME"
+	reasonJWTRequired              = "JWT_REQUIRED"
+	reasonJWTInvalid               = "JWT_INVALID"
+	reasonJWTSubjectUnmapped       = "JWT_SUBJECT_UNMAPPED"
+	reasonSigningKeysUnavailable   = "SIGNING_KEYS_UNAVAILABLE"
+	reasonCapabilityInvalid        = "CAPABILITY_INVALID"
+	reasonCapabilitySubjectUnknown = "CAPABILITY_SUBJECT_UNKNOWN"
+	reasonForeignCredential        = "FOREIGN_CREDENTIAL"
+	reasonNetworkDenied            = "NETWORK_DENIED"
+	reasonDelegationDenied         = "DELEGATION_DENIED"
+	reasonDelegatedActionDenied    = "DELEGATED_ACTION_DENIED"
+	reasonActionDenied             = "ACTION_DENIED"
+	reasonUndeclaredNames          = "UNDECLARED_NAMES"
+	reasonEnrichmentFailed         = "ENRICHMENT_FAILED"
+	reasonWorkloadIdentityRequired = "WORKLOAD_IDENTITY_REQUIRED"
+	reasonUnknownIdentity          = "UNKNOWN_IDENTITY"
+	reasonRotationDisabled         = "ROTATION_DISABLED"
+	reasonCredentialNotRotatable   = "CREDENTIAL_NOT_ROTATABLE"
+	reasonCredentialRetired        = "CREDENTIAL_RETIRED"
+	reasonConnectionLimitExceeded  = "CONNECTION_LIMIT_EXCEEDED"
+	reasonStreamLimitExceeded      = "STREAM_LIMIT_EXCEEDED"
+	reasonInjectedFault            = "INJECTED_FAULT"
+	reasonCrossTenant              = "CROSS_TENANT"
+	reasonSubjectDisabled          = "SUBJECT_DISABLED"
+	reasonNoActions                = "NO_ACTIONS"
+	reasonDuplicateActions         = "DUPLICATE_ACTIONS"
+	reasonBudgetExceeded           = "EVALUATION_BUDGET_EXCEEDED"
+)
+
+// denialMessages is the default message catalog. Each message may refer to the denial's metadata
+// as {key}.
+var denialMessages = map[string]string{
+	reasonCredentialTooLong:        "credential is {length} bytes, longer than the maximum of {max_length}",
+	reasonInvalidCredential:        "invalid credential",
+	reasonPrivateKeyCredential:     "invalid credential: credential looks like a PEM private key; send the subject's token, and rotate the key since it was sent to the runtime",
+	reasonUnexpectedJWT:            "invalid credential: credential looks like a JWT, but the policy only defines opaque tokens",
+	reasonCredentialWhitespace:     "invalid credential: credential has leading or trailing whitespace",
+	reasonCredentialAuthScheme:     `invalid credential: credential starts with the "{scheme}" authorization scheme; send the token only`,
+	reasonJWTRequired:              "invalid credential: credential is not a JWT, but the policy only accepts JWTs",
+	reasonJWTInvalid:               "invalid credential: JWT verification failed: {error}",
+	reasonJWTSubjectUnmapped:       "invalid credential: JWT subject '{jwt_subject}' from issuer '{issuer}' is not mapped to a policy subject",
+	reasonSigningKeysUnavailable:   "JWT signing keys are unavailable",
+	reasonCapabilityInvalid:        "invalid credential: capability token verification failed: {error}",
+	reasonCapabilitySubjectUnknown: "invalid credential: capability token subject '{subject}' is not in the policy",
+	reasonForeignCredential:        "credential does not belong to this runtime: expected prefix '{prefix}'",
+	reasonNetworkDenied:            "subject '{subject}' may not be used from {peer}",
+	reasonDelegationDenied:         "subject '{actor}' may not act on behalf of '{subject}'",
+	reasonDelegatedActionDenied:    "subject '{actor}' acting on behalf of '{subject}' does not have permission to perform '{action}' on resource '{resource_id}'",
+	reasonActionDenied:             "subject does not have permission to perform '{action}' on resource '{resource_id}'",
+	reasonUndeclaredNames:          "policy does not declare {names}",
+	reasonEnrichmentFailed:         "failed to enrich subject claims",
+	reasonWorkloadIdentityRequired: "the policy defines {identities} identities; set the workload identity to choose one",
+	reasonUnknownIdentity:          "the policy does not define identity '{identity}'",
+	reasonRotationDisabled:         "credential rotation is not enabled",
+	reasonCredentialNotRotatable:   "only policy tokens and rotated credentials can be rotated",
+	reasonCredentialRetired:        "credential has already been rotated; rotate the current credential",
+	reasonConnectionLimitExceeded:  "subject '{subject}' has reached its limit of {limit} open connections",
+	reasonStreamLimitExceeded:      "subject '{subject}' has reached its limit of {limit} requests in progress",
+	reasonInjectedFault:            "fault injected into {rpc}",
+	reasonCrossTenant:              "subject '{subject}' of tenant '{tenant}' may not access resource '{resource_id}' of tenant '{resource_tenant}'",
+	reasonSubjectDisabled:          "subject '{subject}' was disabled for not being seen since {idle_since}; ask an operator to enable it again",
+	reasonNoActions:                "access check names no actions",
+	reasonDuplicateActions:         "access check names {duplicates} more than once",
+	reasonBudgetExceeded:           "access check exceeded its evaluation budget ({limit} {max}) evaluating '{action}' on resource '{resource_id}'",
+}
+
+// CheckDenialMessages checks that every message in a catalog override is for a known reason code.
+// Codes are matched case-insensitively.
+func CheckDenialMessages(messages map[string]string) error {
+	for reason := range messages {
+		if _, ok := denialMessages[strings.ToUpper(reason)]; !ok {
+			return fmt.Errorf("denial message for %s: unknown reason code: %w", reason, ErrInvalidValue)
+		}
+	}
+
+	return nil
+}
+
+// denial returns the status for a refused request. Its message comes from the catalog, and an
+// ErrorInfo detail carries the reason code and fields, given as key-value pairs.
+func (s *server) denial(code codes.Code, reason string, fields ...string) *status.Status {
+	metadata := make(map[string]string, len(fields)/2)
+
+	for i := 0; i+1 < len(fields); i += 2 {
+		metadata[fields[i]] = fields[i+1]
+	}
+
+	stat := status.New(code, s.denialMessage(reason, metadata))
+
+	withDetails, err := stat.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   denialDomain,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return stat
+	}
+
+	return withDetails
+}
+
+// deny returns the error for a refused request. See denial.
+func (s *server) deny(code codes.Code, reason string, fields ...string) error {
+	return s.denial(code, reason, fields...).Err()
+}
+
+// denyActions returns the error for an access check with denied actions, given by their indexes in
+// req. Its message and ErrorInfo describe the first denied action, with the number of denied
+// actions in the denied field, and a PreconditionFailure detail has a violation for each denied
+// action, with the action's index as its subject. fields returns the metadata for an action.
+func (s *server) denyActions(reason string, req *authorization.CheckAccessRequest, denied []int, fields func(*authorization.AccessRequestAction) []string) error {
+	first := append(fields(req.Actions[denied[0]]), "denied", strconv.Itoa(len(denied)))
+	stat := s.denial(codes.PermissionDenied, reason, first...)
+
+	violations := make([]*errdetails.PreconditionFailure_Violation, 0, len(denied))
+
+	for _, i := range denied {
+		kv := fields(req.Actions[i])
+		metadata := make(map[string]string, len(kv)/2)
+
+		for j := 0; j+1 < len(kv); j += 2 {
+			metadata[kv[j]] = kv[j+1]
+		}
+
+		violations = append(violations, &errdetails.PreconditionFailure_Violation{
+			Type:        reason,
+			Subject:     fmt.Sprintf("actions[%d]", i),
+			Description: s.denialMessage(reason, metadata),
+		})
+	}
+
+	withDetails, err := stat.WithDetails(&errdetails.PreconditionFailure{Violations: violations})
+	if err != nil {
+		return stat.Err()
+	}
+
+	return withDetails.Err()
+}
+
+// denialMessage returns the catalog message for reason with its metadata filled in. Placeholders
+// without a value are left as they are.
+func (s *server) denialMessage(reason string, metadata map[string]string) string {
+	msg, ok := s.denialMessages[reason]
+	if !ok {
+		msg = denialMessages[reason]
+	}
+
+	if len(metadata) == 0 {
+		return msg
+	}
+
+	pairs := make([]string, 0, 2*len(metadata))
+
+	for k, v := range metadata {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+
+	return strings.NewReplacer(pairs...).Replace(msg)
+}
@@ -0,0 +1,367 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/internal/features"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// relationshipKey identifies a relationship from a resource.
+type relationshipKey struct {
+	relation  string
+	subjectID string
+}
+
+// relationshipEdge records when a relationship becomes visible to access checks and, once deleted,
+// when it stops being visible.
+type relationshipEdge struct {
+	visibleAt time.Time
+	hiddenAt  time.Time
+}
+
+// visible reports whether the relationship applies to access checks at now.
+func (e relationshipEdge) visible(now time.Time) bool {
+	return !now.Before(e.visibleAt) && (e.hiddenAt.IsZero() || now.Before(e.hiddenAt))
+}
+
+// relationshipStore holds relationships written with the relationship RPCs, in memory only.
+// Writes become visible to access checks after the propagation delay, to simulate an eventually
+// consistent backend.
+type relationshipStore struct {
+	delay time.Duration
+
+	mu    sync.RWMutex
+	edges map[string]map[relationshipKey]relationshipEdge
+}
+
+func newRelationshipStore() *relationshipStore {
+	return &relationshipStore{
+		edges: make(map[string]map[relationshipKey]relationshipEdge),
+	}
+}
+
+// reset deletes every relationship immediately.
+func (r *relationshipStore) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.edges = make(map[string]map[relationshipKey]relationshipEdge)
+}
+
+// create adds relationships from resourceID and returns those that did not already exist.
+func (r *relationshipStore) create(resourceID string, keys []relationshipKey, now time.Time) []relationshipKey {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.prune(now)
+
+	edges := r.edges[resourceID]
+	if edges == nil {
+		edges = make(map[relationshipKey]relationshipEdge)
+		r.edges[resourceID] = edges
+	}
+
+	var created []relationshipKey
+
+	for _, key := range keys {
+		edge, ok := edges[key]
+
+		switch {
+		case ok && edge.hiddenAt.IsZero():
+			continue
+		case ok:
+			// Recreated before its deletion became visible: it never disappears.
+			edge.hiddenAt = time.Time{}
+		default:
+			edge = relationshipEdge{visibleAt: now.Add(r.delay)}
+		}
+
+		edges[key] = edge
+		created = append(created, key)
+	}
+
+	return created
+}
+
+// delete removes relationships from resourceID and returns those that existed.
+func (r *relationshipStore) delete(resourceID string, keys []relationshipKey, now time.Time) []relationshipKey {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.prune(now)
+
+	edges := r.edges[resourceID]
+
+	var deleted []relationshipKey
+
+	for _, key := range keys {
+		edge, ok := edges[key]
+		if !ok || !edge.hiddenAt.IsZero() {
+			continue
+		}
+
+		edge.hiddenAt = now.Add(r.delay)
+		edges[key] = edge
+		deleted = append(deleted, key)
+	}
+
+	return deleted
+}
+
+// prune drops deleted relationships that are no longer visible. The caller must hold the write
+// lock.
+func (r *relationshipStore) prune(now time.Time) {
+	for resourceID, edges := range r.edges {
+		for key, edge := range edges {
+			if !edge.hiddenAt.IsZero() && !now.Before(edge.hiddenAt) {
+				delete(edges, key)
+			}
+		}
+
+		if len(edges) == 0 {
+			delete(r.edges, resourceID)
+		}
+	}
+}
+
+// related returns the resources reachable from resourceID through relationships visible at now,
+// nearest first and in sorted order at each distance. resourceID itself is not included. Unless
+// maxDepth is zero, only resources at most maxDepth relationships away are returned, and false is
+// reported if there are farther ones.
+func (r *relationshipStore) related(resourceID string, now time.Time, maxDepth int) ([]string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := map[string]bool{resourceID: true}
+
+	var out []string
+
+	for depth, next := 0, []string{resourceID}; len(next) > 0; depth++ {
+		var found []string
+
+		for _, id := range next {
+			for key, edge := range r.edges[id] {
+				if edge.visible(now) && !seen[key.subjectID] {
+					seen[key.subjectID] = true
+					found = append(found, key.subjectID)
+				}
+			}
+		}
+
+		if maxDepth > 0 && depth == maxDepth && len(found) > 0 {
+			return out, false
+		}
+
+		sort.Strings(found)
+		out = append(out, found...)
+		next = found
+	}
+
+	return out, true
+}
+
+// allows reports whether sub may perform action on the resource, and returns the grants that
+// allow it. The policy decides first, and relationships decide what it has no opinion on, as the
+// policy and relationships backends do with the priority combinator. A subject authenticated by a
+// capability token is only allowed what the token's grant covers. The grant entries examined and
+// the relationships followed count against the evaluation budget of the check ctx belongs to, if
+// any; once it is exceeded, false is returned.
+func (s *server) allows(ctx context.Context, st *policyState, sub policySubject, action, resourceID string, now time.Time) (bool, []grantRef) {
+	if !inScope(sub, action, resourceID) {
+		return false, nil
+	}
+
+	if d, grants := s.decidePolicy(ctx, st, sub, action, resourceID, now); d != Abstain {
+		return d == Allow, grants
+	}
+
+	d, grants := s.decideRelated(ctx, st, sub, action, resourceID, now)
+
+	return d == Allow, grants
+}
+
+// decidePolicy decides whether the policy allows sub to perform action on the resource, and
+// returns the grants that allow it. Denies on the resource deny it, and so do denies on its type
+// and parent, if it is a type-level ID. Grants on the resource, and on its type and parent, allow
+// it. The decisions on expected requests are taken from the warmed decisions of st. Conditional
+// grants apply if the request meets their conditions at now. Otherwise the policy abstains.
+func (s *server) decidePolicy(ctx context.Context, st *policyState, sub policySubject, action, resourceID string, now time.Time) (Decision, []grantRef) {
+	// Denies on the resource also override grants on resources it is related to.
+	if _, denied := findDeny(sub, action, resourceID); denied {
+		return Deny, nil
+	}
+
+	typeResources := typeGrantResources(resourceID)
+
+	for _, id := range typeResources {
+		if _, denied := findDeny(sub, action, id); denied {
+			return Deny, nil
+		}
+	}
+
+	ev := evaluationFrom(ctx)
+	cost := grantCost(sub)
+
+	if d, ok := st.warmed[warmKey{subjectID: sub.ID, action: action, resourceID: resourceID}]; ok {
+		if d.allowed {
+			return Allow, d.grants
+		}
+	} else if !ev.examine(cost) {
+		return Abstain, nil
+	} else if checkAccess(sub, action, resourceID) {
+		return Allow, matchedGrants(sub, action, resourceID)
+	}
+
+	if ok, grants := s.allowsConditionally(ctx, sub, action, resourceID, now); ok {
+		return Allow, grants
+	}
+
+	for _, id := range typeResources {
+		if !ev.examine(cost) {
+			return Abstain, nil
+		}
+
+		if checkAccess(sub, action, id) {
+			return Allow, matchedGrants(sub, action, id)
+		}
+
+		if ok, grants := s.allowsConditionally(ctx, sub, action, id, now); ok {
+			return Allow, grants
+		}
+	}
+
+	return Abstain, nil
+}
+
+// decideRelated decides whether relationships allow sub to perform action on the resource, and
+// returns the grants that allow it. Relationships of a relation with ownership grants give their
+// subject the relation's actions on the resource. If relationships are enabled for the subject,
+// grants on resources the resource is related to apply to it too, so a grant on a parent or owner
+// covers its children. Relationships that have not expired by now are followed. Relationships never
+// deny an action, so otherwise they abstain.
+func (s *server) decideRelated(ctx context.Context, st *policyState, sub policySubject, action, resourceID string, now time.Time) (Decision, []grantRef) {
+	if ok, grants := s.allowsOwner(st, sub, action, resourceID, now); ok {
+		return Allow, grants
+	}
+
+	if s.relationships == nil || !s.features.Enabled(features.Relationships, sub.ID) {
+		return Abstain, nil
+	}
+
+	ev := evaluationFrom(ctx)
+	cost := grantCost(sub)
+
+	reachable, complete := s.relationships.related(resourceID, now, ev.maxDepth())
+
+	for _, related := range reachable {
+		if !ev.examine(cost) {
+			return Abstain, nil
+		}
+
+		if checkAccess(sub, action, related) {
+			return Allow, matchedGrants(sub, action, related)
+		}
+
+		if ok, grants := s.allowsConditionally(ctx, sub, action, related, now); ok {
+			return Allow, grants
+		}
+
+		if ok, grants := s.allowsOwner(st, sub, action, related, now); ok {
+			return Allow, grants
+		}
+	}
+
+	// Grants on nearer resources still allow the action, but without one, the decision depends on
+	// the resources that were not reached.
+	if !complete {
+		ev.exceedDepth()
+	}
+
+	return Abstain, nil
+}
+
+func (s *server) CreateRelationships(_ context.Context, req *authorization.CreateRelationshipsRequest) (*authorization.CreateRelationshipsResponse, error) {
+	s.logger.Infow("received CreateRelationships request", "resource_id", req.ResourceId, "relationships", len(req.Relationships))
+
+	if s.relationships == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "relationships are not enabled")
+	}
+
+	resourceID := s.normalizeResourceID(req.ResourceId)
+
+	keys, err := s.relationshipKeys(resourceID, req.Relationships)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+
+	for _, key := range s.relationships.create(resourceID, keys, now) {
+		s.publishRelationship(resourceID, key, false, now)
+	}
+
+	return &authorization.CreateRelationshipsResponse{}, nil
+}
+
+func (s *server) DeleteRelationships(_ context.Context, req *authorization.DeleteRelationshipsRequest) (*authorization.DeleteRelationshipsResponse, error) {
+	s.logger.Infow("received DeleteRelationships request", "resource_id", req.ResourceId, "relationships", len(req.Relationships))
+
+	if s.relationships == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "relationships are not enabled")
+	}
+
+	resourceID := s.normalizeResourceID(req.ResourceId)
+
+	keys, err := s.relationshipKeys(resourceID, req.Relationships)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+
+	for _, key := range s.relationships.delete(resourceID, keys, now) {
+		s.publishRelationship(resourceID, key, true, now)
+	}
+
+	return &authorization.DeleteRelationshipsResponse{}, nil
+}
+
+// relationshipKeys checks the relationships of a write request and returns their keys, with their
+// subject IDs normalized.
+func (s *server) relationshipKeys(resourceID string, rels []*authorization.Relationship) ([]relationshipKey, error) {
+	if resourceID == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "resource ID is empty")
+	}
+
+	out := make([]relationshipKey, 0, len(rels))
+
+	for i, rel := range rels {
+		if rel.Relation == "" || rel.SubjectId == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "relationship %d: relation and subject ID are required", i)
+		}
+
+		// The subject of a relationship is a resource whose grants apply to resourceID, or a policy
+		// subject owning it, so its ID is normalized like theirs.
+		out = append(out, relationshipKey{relation: rel.Relation, subjectID: s.normalizeResourceID(rel.SubjectId)})
+	}
+
+	return out, nil
+}
+
+func (s *server) publishRelationship(resourceID string, key relationshipKey, deleted bool, now time.Time) {
+	s.bus.Publish(events.RelationshipChanged{
+		ResourceID: resourceID,
+		Relation:   key.relation,
+		SubjectID:  key.subjectID,
+		Deleted:    deleted,
+		Time:       now,
+	})
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+)
+
+// normalizeResourceID returns the normalized form of a resource ID.
+func (s *server) normalizeResourceID(id string) string {
+	return s.resourceIDs.Normalize(id)
+}
+
+// normalizePolicy returns a copy of p with every resource ID normalized: those of grants, denies,
+// containment, tenants, and deprecations. p is not modified, since its slices and maps may be
+// shared with the active policy.
+func (s *server) normalizePolicy(p policy) policy {
+	if !s.resourceIDs.Enabled() {
+		return p
+	}
+
+	out := p
+	out.Contains = s.normalizeResourceMap(p.Contains, true)
+	out.Tenants = s.normalizeResourceMap(p.Tenants, false)
+
+	if p.Deprecated.Resources != nil {
+		out.Deprecated.Resources = make(map[string]string, len(p.Deprecated.Resources))
+
+		for id, message := range p.Deprecated.Resources {
+			out.Deprecated.Resources[s.normalizeResourceID(id)] = message
+		}
+	}
+
+	out.Roles = make([]policyRole, len(p.Roles))
+
+	for i, role := range p.Roles {
+		role.Resources = s.normalizeResources(role.Resources)
+		role.Deny = s.normalizeDenies(role.Deny)
+		out.Roles[i] = role
+	}
+
+	out.OnCall = make([]policyOnCall, len(p.OnCall))
+
+	for i, o := range p.OnCall {
+		o.Resources = s.normalizeResources(o.Resources)
+		out.OnCall[i] = o
+	}
+
+	out.Subjects = make([]policySubject, len(p.Subjects))
+
+	for i, sub := range p.Subjects {
+		sub.Resources = s.normalizeResources(sub.Resources)
+		sub.Deny = s.normalizeDenies(sub.Deny)
+		out.Subjects[i] = sub
+	}
+
+	return out
+}
+
+func (s *server) normalizeResources(resources []policyResource) []policyResource {
+	if resources == nil {
+		return nil
+	}
+
+	out := make([]policyResource, len(resources))
+
+	for i, res := range resources {
+		res.ID = s.normalizeResourceID(res.ID)
+		out[i] = res
+	}
+
+	return out
+}
+
+func (s *server) normalizeDenies(denies []policyDeny) []policyDeny {
+	if denies == nil {
+		return nil
+	}
+
+	out := make([]policyDeny, len(denies))
+
+	for i, d := range denies {
+		d.ID = s.normalizeResourceID(d.ID)
+		out[i] = d
+	}
+
+	return out
+}
+
+// normalizeResourceMap normalizes the resource IDs in the values of m, and in its keys if keys is
+// set. Values of keys that normalize to the same ID are merged.
+func (s *server) normalizeResourceMap(m map[string][]string, keys bool) map[string][]string {
+	if m == nil {
+		return nil
+	}
+
+	out := make(map[string][]string, len(m))
+
+	for k, ids := range m {
+		if keys {
+			k = s.normalizeResourceID(k)
+		}
+
+		for _, id := range ids {
+			out[k] = append(out[k], s.normalizeResourceID(id))
+		}
+	}
+
+	return out
+}
+
+// normalizeCheckRequest returns req with the resource IDs of its actions normalized. req is not
+// modified; if no ID changes, it is returned as is.
+func (s *server) normalizeCheckRequest(req *authorization.CheckAccessRequest) *authorization.CheckAccessRequest {
+	if !s.resourceIDs.Enabled() {
+		return req
+	}
+
+	var actions []*authorization.AccessRequestAction
+
+	for i, action := range req.Actions {
+		id := s.normalizeResourceID(action.ResourceId)
+		if id == action.ResourceId {
+			continue
+		}
+
+		if actions == nil {
+			actions = make([]*authorization.AccessRequestAction, len(req.Actions))
+			copy(actions, req.Actions)
+		}
+
+		actions[i] = &authorization.AccessRequestAction{Action: action.Action, ResourceId: id}
+	}
+
+	if actions == nil {
+		return req
+	}
+
+	return &authorization.CheckAccessRequest{Credential: req.Credential, Actions: actions}
+}
+
+// normalizeExpectedTraffic returns the expected requests with their resource IDs normalized.
+func (s *server) normalizeExpectedTraffic(expected []ExpectedRequest) []ExpectedRequest {
+	if !s.resourceIDs.Enabled() || expected == nil {
+		return expected
+	}
+
+	out := make([]ExpectedRequest, len(expected))
+
+	for i, req := range expected {
+		req.Resource = s.normalizeResourceID(req.Resource)
+		out[i] = req
+	}
+
+	return out
+}
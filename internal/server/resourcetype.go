@@ -0,0 +1,51 @@
+package server
+
+import "strings"
+
+// typeResourcePrefix starts the resource IDs of resource types. Access checks name a type, such as
+// type:loadbalancer, or a type in a parent, such as type:loadbalancer@tnntten-a, for actions on
+// resources that do not exist yet, such as creating one.
+const typeResourcePrefix = "type:"
+
+// parseTypeResource splits a type-level resource ID of the form type:<type> or
+// type:<type>@<parent> into the resource ID of the type, type:<type>, and the parent's ID, which is
+// empty if there is none. ok is false if resourceID is not a type-level ID.
+func parseTypeResource(resourceID string) (typeID, parentID string, ok bool) {
+	rest, ok := strings.CutPrefix(resourceID, typeResourcePrefix)
+	if !ok {
+		return "", "", false
+	}
+
+	name, parentID, scoped := strings.Cut(rest, "@")
+	if name == "" || (scoped && parentID == "") {
+		return "", "", false
+	}
+
+	return typeResourcePrefix + name, parentID, true
+}
+
+// typeGrantResources returns the resources other than resourceID whose grants and denies apply to
+// it if it is a type-level ID: the type, whatever the parent, and the parent, along with anything
+// containing the parent. It returns nil for other resource IDs.
+func typeGrantResources(resourceID string) []string {
+	typeID, parentID, ok := parseTypeResource(resourceID)
+	if !ok {
+		return nil
+	}
+
+	if parentID == "" {
+		return nil
+	}
+
+	return []string{typeID, parentID}
+}
+
+// typeResourceParent returns the parent named by a type-level resource ID, or resourceID itself
+// otherwise, which is the resource whose tenant the resource belongs to.
+func typeResourceParent(resourceID string) string {
+	if _, parentID, ok := parseTypeResource(resourceID); ok && parentID != "" {
+		return parentID
+	}
+
+	return resourceID
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// policyResponseMetadata is gRPC metadata returned with every response to a subject, such as
+// simulated quota headers or organization IDs.
+type policyResponseMetadata struct {
+	Headers  map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Trailers map[string]string `yaml:"trailers,omitempty" json:"trailers,omitempty"`
+}
+
+// reservedMetadataKeys are set by the runtime itself and cannot be configured per subject.
+var reservedMetadataKeys = []string{cacheTTLMetadataKey, matchedRulesMetadataKey}
+
+// mergeResponseMetadata returns base with the overlay's headers and trailers added. Overlay values
+// take precedence.
+func mergeResponseMetadata(base, overlay *policyResponseMetadata) *policyResponseMetadata {
+	if base == nil {
+		return overlay
+	}
+
+	if overlay == nil {
+		return base
+	}
+
+	return &policyResponseMetadata{
+		Headers:  mergeStringMaps(base.Headers, overlay.Headers),
+		Trailers: mergeStringMaps(base.Trailers, overlay.Trailers),
+	}
+}
+
+// validateResponseMetadata checks that every subject's response metadata keys are valid, lower-case
+// gRPC metadata keys that are not reserved by gRPC or the runtime.
+func validateResponseMetadata(p policy) error {
+	for _, sub := range p.Subjects {
+		if sub.ResponseMetadata == nil {
+			continue
+		}
+
+		for _, keys := range []struct {
+			field string
+			md    map[string]string
+		}{
+			{"headers", sub.ResponseMetadata.Headers},
+			{"trailers", sub.ResponseMetadata.Trailers},
+		} {
+			for _, key := range sortedKeys(keys.md) {
+				if err := checkMetadataKey(key); err != nil {
+					return fmt.Errorf("%s: responseMetadata: %s: %s: %w", sub.ID, keys.field, key, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkMetadataKey(key string) error {
+	if key == "" {
+		return ErrInvalidValue
+	}
+
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return fmt.Errorf("keys may only contain lower-case letters, digits, '-', '_', and '.': %w", ErrInvalidValue)
+		}
+	}
+
+	if strings.HasPrefix(key, "grpc-") || strings.HasSuffix(key, "-bin") {
+		return fmt.Errorf("grpc- and -bin keys are reserved: %w", ErrInvalidValue)
+	}
+
+	if containsString(reservedMetadataKeys, key) {
+		return fmt.Errorf("key is set by the runtime: %w", ErrInvalidValue)
+	}
+
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// sendResponseMetadata sets the subject's configured headers and trailers on the response.
+func sendResponseMetadata(ctx context.Context, sub policySubject) {
+	if sub.ResponseMetadata == nil {
+		return
+	}
+
+	if len(sub.ResponseMetadata.Headers) > 0 {
+		_ = grpc.SetHeader(ctx, metadata.New(sub.ResponseMetadata.Headers))
+	}
+
+	if len(sub.ResponseMetadata.Trailers) > 0 {
+		_ = grpc.SetTrailer(ctx, metadata.New(sub.ResponseMetadata.Trailers))
+	}
+}
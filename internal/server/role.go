@@ -0,0 +1,247 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// roleVersionSeparator separates a role ID from a pinned version in a role reference.
+const roleVersionSeparator = "@"
+
+// policyRole is a versioned, named set of resource grants that subjects can reference.
+type policyRole struct {
+	ID      string `yaml:"id" json:"id"`
+	Version string `yaml:"version,omitempty" json:"version,omitempty"`
+	// RuleID optionally identifies grants of the role that have no rule ID of their own.
+	RuleID    string           `yaml:"ruleId,omitempty" json:"ruleId,omitempty"`
+	Resources []policyResource `yaml:"resources" json:"resources"`
+	// Roles are references to other roles whose grants the role includes.
+	Roles []string `yaml:"roles,omitempty" json:"roles,omitempty"`
+	// Deny rejects actions on resources for the role's subjects, even if a grant allows them.
+	Deny []policyDeny `yaml:"deny,omitempty" json:"deny,omitempty"`
+}
+
+// ref returns the pinned reference for the role.
+func (r policyRole) ref() string {
+	if r.Version == "" {
+		return r.ID
+	}
+
+	return r.ID + roleVersionSeparator + r.Version
+}
+
+// roleIndex maps role IDs to their versions, sorted from oldest to newest.
+type roleIndex map[string][]policyRole
+
+func newRoleIndex(roles []policyRole) (roleIndex, error) {
+	out := make(roleIndex)
+
+	for _, role := range roles {
+		if role.ID == "" || strings.Contains(role.ID, roleVersionSeparator) {
+			return nil, fmt.Errorf("roles: '%s': %w", role.ID, ErrInvalidValue)
+		}
+
+		for _, existing := range out[role.ID] {
+			if existing.Version == role.Version {
+				return nil, fmt.Errorf("roles: %s: %w", role.ref(), ErrDuplicateValue)
+			}
+		}
+
+		out[role.ID] = append(out[role.ID], role)
+	}
+
+	for _, versions := range out {
+		sort.Slice(versions, func(i, j int) bool {
+			return compareVersions(versions[i].Version, versions[j].Version) < 0
+		})
+	}
+
+	// Check every role's inclusions, even for roles no subject references.
+	for _, role := range roles {
+		if _, err := out.expand(role.ref()); err != nil {
+			return nil, fmt.Errorf("roles: %w", err)
+		}
+	}
+
+	return out, nil
+}
+
+// expand returns the role named by ref followed by every role it includes, directly or through
+// other roles, each once.
+func (idx roleIndex) expand(ref string) ([]policyRole, error) {
+	var (
+		out  []policyRole
+		seen = make(map[string]bool)
+	)
+
+	var visit func(ref string, path []string) error
+
+	visit = func(ref string, path []string) error {
+		role, err := idx.resolve(ref)
+		if err != nil {
+			if len(path) > 0 {
+				return fmt.Errorf("%s includes undefined %w", path[len(path)-1], err)
+			}
+
+			return err
+		}
+
+		for _, on := range path {
+			if on == role.ref() {
+				return fmt.Errorf("role cycle %s -> %s: %w", strings.Join(path, " -> "), role.ref(), ErrInvalidValue)
+			}
+		}
+
+		if seen[role.ref()] {
+			return nil
+		}
+
+		seen[role.ref()] = true
+		out = append(out, role)
+
+		path = append(path, role.ref())
+
+		for _, included := range role.Roles {
+			if err := visit(included, path); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := visit(ref, nil); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// resolve returns the role named by ref. A reference of the form id@version pins that version;
+// a bare id resolves to the newest version of the role.
+func (idx roleIndex) resolve(ref string) (policyRole, error) {
+	id, version, pinned := strings.Cut(ref, roleVersionSeparator)
+
+	versions := idx[id]
+	if len(versions) == 0 {
+		return policyRole{}, fmt.Errorf("role %s: %w", ref, ErrMissingValue)
+	}
+
+	if !pinned {
+		return versions[len(versions)-1], nil
+	}
+
+	for _, role := range versions {
+		if role.Version == version {
+			return role, nil
+		}
+	}
+
+	return policyRole{}, fmt.Errorf("role %s: %w", ref, ErrMissingValue)
+}
+
+// expandRoles returns a copy of sub with the grants of its referenced roles, and the roles they
+// include, merged into its resources.
+func expandRoles(sub policySubject, idx roleIndex) (policySubject, error) {
+	if len(sub.Roles) == 0 {
+		return sub, nil
+	}
+
+	out := sub
+	out.Resources = append([]policyResource(nil), sub.Resources...)
+
+	for _, ref := range sub.Roles {
+		roles, err := idx.expand(ref)
+		if err != nil {
+			return policySubject{}, fmt.Errorf("%s: %w", sub.ID, err)
+		}
+
+		for _, role := range roles {
+			for _, res := range unconditional(role.Resources) {
+				ruleID := res.RuleID
+				if ruleID == "" {
+					ruleID = role.RuleID
+				}
+
+				out.Resources = mergeResourceActions(out.Resources, withGrant(res, "", role.ref(), ruleID))
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// mergeResourceActions unions the actions of res into the entry checkAccess would use for the
+// same resource, or appends it.
+func mergeResourceActions(resources []policyResource, res policyResource) []policyResource {
+	for i := len(resources) - 1; i >= 0; i-- {
+		if resources[i].ID != res.ID {
+			continue
+		}
+
+		actions := append([]string(nil), resources[i].Actions...)
+		for _, action := range res.Actions {
+			if !containsString(actions, action) {
+				actions = append(actions, action)
+			}
+		}
+
+		resources[i] = policyResource{ID: res.ID, Actions: actions, rules: mergeRules(resources[i].rules, res.rules)}
+
+		return resources
+	}
+
+	return append(resources, policyResource{ID: res.ID, Actions: res.Actions, rules: res.rules})
+}
+
+// mergeRoles returns base with the overlay's roles added. An overlay role replaces a base role
+// with the same ID and version.
+func mergeRoles(base, overlay []policyRole) []policyRole {
+	out := append([]policyRole(nil), base...)
+
+	for _, role := range overlay {
+		replaced := false
+
+		for i, existing := range out {
+			if existing.ID == role.ID && existing.Version == role.Version {
+				out[i] = role
+				replaced = true
+
+				break
+			}
+		}
+
+		if !replaced {
+			out = append(out, role)
+		}
+	}
+
+	return out
+}
+
+// compareVersions orders role versions such as v1, v2, and v10 by their numeric components,
+// falling back to lexical order for components that are not numbers.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			if an < bn {
+				return -1
+			}
+
+			return 1
+		case (aErr != nil || bErr != nil) && as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+
+	return len(as) - len(bs)
+}
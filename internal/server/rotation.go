@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/internal/rotation"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/credentials"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// lookupRotated returns the subject authenticated by a credential issued by rotation. rejected
+// reports whether the credential was replaced and its grace period has ended, in which case it
+// must not be accepted even if it is a policy token. recorded reports whether rotation has any
+// record of the credential.
+func (s *server) lookupRotated(st *policyState, credential string) (sub policySubject, ok, rejected, recorded bool) {
+	if s.rotation == nil {
+		return policySubject{}, false, false, false
+	}
+
+	rec, found := s.rotation.Lookup(credential)
+	switch {
+	case !found:
+		return policySubject{}, false, false, false
+	case rec.Expired(s.now()):
+		return policySubject{}, false, true, true
+	case rec.Static:
+		// Policy tokens are looked up in the policy, so removing them from it still revokes them.
+		return policySubject{}, false, false, true
+	}
+
+	// The subject may have been removed from the policy since the credential was issued.
+	sub, ok = st.subjects[rec.Subject]
+
+	return sub, ok, false, true
+}
+
+func (s *server) RotateCredential(ctx context.Context, req *credentials.RotateCredentialRequest) (*credentials.RotateCredentialResponse, error) {
+	s.logger.Info("received RotateCredential request")
+
+	if s.rotation == nil {
+		return nil, s.deny(codes.FailedPrecondition, reasonRotationDisabled)
+	}
+
+	// Rotated credentials are only recorded here, so foreign credentials are never forwarded.
+	credential, foreign := s.foreignCredential(ctx, req.Credential)
+	if foreign {
+		return nil, s.rejectForeign()
+	}
+
+	st := s.state.Load()
+
+	sub, err := s.authenticate(ctx, st, req.Credential)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkPeer(ctx, st, sub); err != nil {
+		return nil, err
+	}
+
+	_, static := st.lookupToken(credential)
+	if !static {
+		if rec, ok := s.rotation.Lookup(credential); !ok || rec.Static {
+			return nil, s.deny(codes.FailedPrecondition, reasonCredentialNotRotatable)
+		}
+	}
+
+	now := s.now()
+	expiresAt := now.Add(s.rotationGrace)
+
+	issued, err := s.rotation.Rotate(sub.ID, credential, static, s.namespace.prefix, expiresAt)
+	switch {
+	case errors.Is(err, rotation.ErrRetired):
+		return nil, s.deny(codes.FailedPrecondition, reasonCredentialRetired)
+	case err != nil:
+		s.logger.Errorw("failed to store rotated credential", "subject", sub.ID, "error", err)
+
+		return nil, status.Errorf(codes.Internal, "failed to store rotated credential")
+	}
+
+	// Drop the credential resolutions cached by connections.
+	s.credentialGeneration.Add(1)
+
+	s.bus.Publish(events.CredentialRotated{
+		Subject:           sub.ID,
+		PreviousExpiresAt: expiresAt,
+		Time:              now,
+	})
+
+	return &credentials.RotateCredentialResponse{
+		Credential:        issued,
+		PreviousExpiresAt: timestamppb.New(expiresAt),
+	}, nil
+}
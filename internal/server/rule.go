@@ -0,0 +1,137 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// matchedRulesMetadataKey is the CheckAccess response trailer listing the IDs of the rules that
+// allowed the request. Matches client.MatchedRulesTrailer.
+const matchedRulesMetadataKey = "iam-runtime-static-matched-rules"
+
+// grantRef identifies one action of a subject or role grant in the source policy.
+type grantRef struct {
+	// Subject is the ID of the subject holding the grant, if it is a subject grant.
+	Subject string
+	// Role is the id@version reference of the role holding the grant, if it is a role grant.
+	Role       string
+	ResourceID string
+	// Action is the action as written in the grant, which may imply the requested action.
+	Action string
+	// RuleID is the grant's rule ID, if it has one.
+	RuleID string
+}
+
+// withGrant returns a copy of res with each of its actions attributed to the grant it came from.
+func withGrant(res policyResource, subject, role, ruleID string) policyResource {
+	res.rules = make(map[string][]grantRef, len(res.Actions))
+	for _, action := range res.Actions {
+		res.rules[action] = []grantRef{{
+			Subject:    subject,
+			Role:       role,
+			ResourceID: res.ID,
+			Action:     action,
+			RuleID:     ruleID,
+		}}
+	}
+
+	return res
+}
+
+// mergeRules returns the union of the grant attributions in a and b.
+func mergeRules(a, b map[string][]grantRef) map[string][]grantRef {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+
+	out := make(map[string][]grantRef, len(a)+len(b))
+
+	for _, rules := range []map[string][]grantRef{a, b} {
+		for action, refs := range rules {
+			out[action] = appendGrants(out[action], refs)
+		}
+	}
+
+	return out
+}
+
+// expandRules attributes implied actions to the grants of the actions that imply them.
+func expandRules(rules map[string][]grantRef, closure map[string][]string) map[string][]grantRef {
+	if len(rules) == 0 {
+		return rules
+	}
+
+	implied := make(map[string][]grantRef)
+
+	for action, refs := range rules {
+		for _, a := range closure[action] {
+			implied[a] = append(implied[a], refs...)
+		}
+	}
+
+	return mergeRules(rules, implied)
+}
+
+// matchedGrants returns the grants that give sub the action on the resource.
+func matchedGrants(sub policySubject, action, resourceID string) []grantRef {
+	var out []grantRef
+
+	if res, ok := findResource(sub, resourceID); ok {
+		out = actionGrants(res, action)
+	}
+
+	for _, res := range patternResources(sub, resourceID) {
+		out = appendGrants(out, actionGrants(res, action))
+	}
+
+	return out
+}
+
+// appendGrants appends the grants in refs that are not already in out.
+func appendGrants(out, refs []grantRef) []grantRef {
+	for _, ref := range refs {
+		found := false
+
+		for _, existing := range out {
+			if existing == ref {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			out = append(out, ref)
+		}
+	}
+
+	return out
+}
+
+// ruleIDs returns the sorted, unique rule IDs of the given grants.
+func ruleIDs(refs []grantRef) []string {
+	var out []string
+
+	for _, ref := range refs {
+		if ref.RuleID != "" && !containsString(out, ref.RuleID) {
+			out = append(out, ref.RuleID)
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// matchedRulesTrailer returns the trailer reporting the rule IDs of the given grants, or nil if
+// none of them have IDs.
+func matchedRulesTrailer(refs []grantRef) metadata.MD {
+	ids := ruleIDs(refs)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return metadata.Pairs(matchedRulesMetadataKey, strings.Join(ids, ","))
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/alert"
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+)
+
+// alertSubscriber returns an event handler sending decisions on sensitive actions and rejected
+// policy updates to n.
+func alertSubscriber(n alert.Notifier) events.Handler {
+	return func(ev events.Event) {
+		if rejected, ok := ev.(events.PolicyRejected); ok {
+			n.Notify(alert.Event{
+				Kind:    alert.KindPolicyRejected,
+				Message: fmt.Sprintf("policy %s from %s rejected, keeping %s: %s", rejected.Revision, rejected.Source, rejected.ActiveRevision, rejected.Reason),
+				Time:    rejected.Time,
+			})
+
+			return
+		}
+
+		decision, ok := ev.(events.DecisionMade)
+		if !ok || !decision.Sensitive {
+			return
+		}
+
+		n.Notify(alert.Event{
+			Kind:       alert.KindSensitiveDecision,
+			Subject:    decision.Subject,
+			Actor:      decision.Actor,
+			Action:     decision.Action,
+			ResourceID: decision.ResourceID,
+			Allowed:    decision.Allowed,
+			Time:       decision.Time,
+			Metadata:   decision.Metadata,
+		})
+	}
+}
@@ -1,18 +1,78 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"net/netip"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/alert"
+	"github.com/metal-toolbox/iam-runtime-static/internal/auditlog"
+	"github.com/metal-toolbox/iam-runtime-static/internal/capability"
+	"github.com/metal-toolbox/iam-runtime-static/internal/decisionlog"
+	"github.com/metal-toolbox/iam-runtime-static/internal/emulation"
+	"github.com/metal-toolbox/iam-runtime-static/internal/enrich"
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/internal/features"
+	"github.com/metal-toolbox/iam-runtime-static/internal/jwtverify"
+	"github.com/metal-toolbox/iam-runtime-static/internal/lastseen"
+	"github.com/metal-toolbox/iam-runtime-static/internal/policycrypt"
+	"github.com/metal-toolbox/iam-runtime-static/internal/resourceid"
+	"github.com/metal-toolbox/iam-runtime-static/internal/rotation"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/credentials"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/identity"
 
 	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authentication"
 	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
 )
 
+// checkAccess reports whether sub may perform action on the resource, through its entry for the
+// resource or a grant whose resource ID pattern matches it, unless one of its denies rejects it.
 func checkAccess(sub policySubject, action, resourceID string) bool {
+	if _, denied := findDeny(sub, action, resourceID); denied {
+		return false
+	}
+
+	if sub.index != nil {
+		return sub.index.checkAccess(sub, action, resourceID)
+	}
+
+	if resource, found := findResource(sub, resourceID); found && matchesAny(resource.Actions, action) {
+		return true
+	}
+
+	for _, resource := range patternResources(sub, resourceID) {
+		if matchesAny(resource.Actions, action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findResource returns the subject's last entry for the resource, which is the one that applies.
+func findResource(sub policySubject, resourceID string) (policyResource, bool) {
+	if sub.index != nil {
+		i, ok := sub.index.byID[resourceID]
+		if !ok {
+			return policyResource{}, false
+		}
+
+		return sub.Resources[i], true
+	}
+
 	var (
 		resource policyResource
 		found    bool
@@ -25,110 +85,996 @@ func checkAccess(sub policySubject, action, resourceID string) bool {
 		}
 	}
 
-	if !found {
-		return false
-	}
-
-	for _, candidate := range resource.Actions {
-		if candidate == action {
-			return true
-		}
-	}
-
-	return false
+	return resource, found
 }
 
+// cacheTTLMetadataKey is the response header hinting how long clients may cache a CheckAccess
+// result.
+const cacheTTLMetadataKey = "iam-runtime-static-cache-ttl"
+
 // Server represents an IAM runtime server.
 type Server interface {
+	admin.AdminServer
+	credentials.CredentialsServer
+	identity.IdentityServer
 	authentication.AuthenticationServer
 	authorization.AuthorizationServer
+
+	// PolicyInfo returns information about the active policy.
+	PolicyInfo() PolicyInfo
+	// RecentDecisions returns up to max of the most recent decisions, newest first, or all those
+	// kept if max is not positive.
+	RecentDecisions(max int) []events.DecisionMade
+	// IssueClientToken exchanges OAuth2 client credentials from the policy for an access token
+	// accepted in place of the owning subject's static tokens. It returns ErrInvalidClient if the
+	// credentials are not recognized.
+	IssueClientToken(clientID, secret string) (IssuedToken, error)
+	// StatsHandler returns the gRPC stats handler tracking the connections the server is served
+	// on, for per-connection state such as the session cache and connection subjects. Install it with grpc.StatsHandler.
+	StatsHandler() stats.Handler
+	// AdminUnaryInterceptor and AdminStreamInterceptor return gRPC interceptors requiring admin API
+	// calls to carry the admin token, if one is set with WithAdminToken. Install them with
+	// grpc.ChainUnaryInterceptor and grpc.ChainStreamInterceptor.
+	AdminUnaryInterceptor() grpc.UnaryServerInterceptor
+	AdminStreamInterceptor() grpc.StreamServerInterceptor
+	// EmulationUnaryInterceptor returns a gRPC interceptor adding the latency and faults of the
+	// profiles set with WithRPCProfiles to unary calls. Install it with grpc.ChainUnaryInterceptor.
+	EmulationUnaryInterceptor() grpc.UnaryServerInterceptor
+
+	// ShadowUnaryInterceptor returns a gRPC interceptor mirroring a sample of requests to the
+	// runtime set with WithShadowRuntime. Install it last with grpc.ChainUnaryInterceptor, so
+	// injected faults are not compared.
+	ShadowUnaryInterceptor() grpc.UnaryServerInterceptor
+	// UpdatePolicy reads a base policy from r, decrypting it if needed, applies the configured
+	// overlays, and atomically makes it the active policy. If the policy is invalid, the active
+	// policy is unchanged. If revision is empty, a digest of the policy is used.
+	UpdatePolicy(r io.Reader, source, revision string) error
+	// UpdatePolicyFile is UpdatePolicy for the base policy at path, merging the policy files in it
+	// if it is a directory.
+	UpdatePolicyFile(path string) error
+	// Now returns the time on the server's clock: the adjustable clock set with
+	// WithAdjustableClock, or the system clock.
+	Now() time.Time
+	// AdvanceClock moves the adjustable clock set with WithAdjustableClock forward by d, applying
+	// the grant expiries and on-call windows it moves past, and returns the new time. It returns
+	// ErrClockNotAdjustable if the server uses the system clock.
+	AdvanceClock(d time.Duration) (time.Time, error)
+	// ResetState deletes every relationship and issued access token, discards decision counters,
+	// coverage, usage, and when credentials were last used, and moves the adjustable clock, if set,
+	// back to where it started. The active policy is kept.
+	ResetState() error
+}
+
+// PolicyInfo describes the active policy.
+type PolicyInfo struct {
+	// Source describes where the policy was loaded from.
+	Source string `json:"source"`
+	// Revision identifies the policy version, such as a commit SHA or content digest.
+	Revision string `json:"revision"`
+	// LoadedAt is when the policy became active.
+	LoadedAt time.Time `json:"loadedAt"`
+}
+
+// policyState is an immutable snapshot of the server's active policy.
+type policyState struct {
+	// Policy document the state was built from
+	policy policy
+
+	// Where the policy came from and when it was loaded
+	info PolicyInfo
+
+	// When grant expirations were last applied
+	compiledAt time.Time
+
+	// Map from tokens to subjects, and from the digests of hashed tokens to subjects
+	tokens       map[string]policySubject
+	tokenDigests map[tokenDigest]policySubject
+
+	// Map from subject IDs to their policy tokens, by digest, for listing credentials
+	subjectTokens map[string][]policyCredential
+
+	// Map from subject IDs to subjects
+	subjects map[string]policySubject
+
+	// Map from workload identity IDs to their access tokens
+	identities map[string]string
+
+	// Map from verified JWT identities to subjects
+	jwtSubjects map[jwtverify.Identity]policySubject
+
+	// Map from OAuth2 client IDs to their secrets
+	clients map[string]clientSecret
+
+	// Map from subject IDs to the networks their credentials may be used from
+	networks map[string][]netip.Prefix
+
+	// Actions and resources declared in the policy, if it rejects checks naming unknown ones
+	declared *policyNames
+
+	// Map from resources owned by tenants to their tenants
+	tenants map[string]string
+
+	// Decisions on the expected requests, and the expected requests that are denied
+	warmed          map[warmKey]warmDecision
+	expectedDenials []ExpectedRequest
+
+	// Explains denials to developers, if denial hints are enabled
+	explorer *Explorer
+
+	// Map from relations with ownership grants to the actions they grant, with implied actions
+	ownerActions map[string][]string
 }
 
 type server struct {
-	// Map from tokens to subjects
-	tokens map[string]policySubject
+	// Active policy state, swapped atomically on updates
+	state atomic.Pointer[policyState]
+
+	// Serializes policy updates
+	updateMu sync.Mutex
+
+	// Told when UpdatePolicy starts and finishes loading policies, if set. loads counts the
+	// UpdatePolicy calls in progress, guarded by loadMu
+	loadHook func(loading bool)
+	loadMu   sync.Mutex
+	loads    int
+
+	// Effective runtime configuration, with secrets redacted
+	config map[string]any
+
+	// Overlay policy files merged over the base policy
+	policyOverlays []string
+
+	// Decrypts policies encrypted at rest
+	decrypter *policycrypt.Decrypter
+
+	// Resolves token environment variables
+	getenv func(key string) string
+	// Runs token commands, if they are enabled
+	tokenCommands *tokenCommands
+
+	// Whether decisions and policy loads are recorded in the process-wide metrics
+	recordMetrics bool
+
+	// Whether connections cache the subjects their credentials authenticate
+	sessionCache bool
+
+	// Whether connections are stamped with the first subject authenticated on them
+	connectionSubjects bool
+
+	// The most connections and in-progress RPCs each subject may hold, or zero if unlimited, and
+	// the connections and RPCs they hold
+	maxSubjectConnections int
+	maxSubjectStreams     int
+	subjectConnections    *subjectCounter
+	subjectStreams        *subjectCounter
+
+	// Incremented whenever a credential is rotated, invalidating session caches
+	credentialGeneration atomic.Uint64
+
+	// Gates experimental behaviors globally or per subject
+	features *features.Set
+
+	// Adds per-action latency and errors to access checks, if set
+	profiles *emulation.Profiles
+
+	// Adds per-RPC latency and faults to calls, if set
+	rpcProfiles *emulation.RPCProfiles
+
+	// Rejects policy updates that remove too much of the active policy
+	reloadGuard ReloadGuard
+
+	// Requests whose decisions are warmed whenever a policy is compiled, and whether a policy
+	// denying any of them is rejected
+	expectedTraffic        []ExpectedRequest
+	requireExpectedAllowed bool
+
+	// Previously active policies, oldest first, and how many are kept. Guarded by updateMu.
+	history     []*policyState
+	historySize int
+
+	// Fires when the next grant in the active policy expires
+	expiryTimer *time.Timer
+
+	// Access tokens issued to OAuth2 clients, and how long they are valid
+	issued         *issuedTokens
+	issuedTokenTTL time.Duration
+
+	// When each credential last authenticated a request, for ListCredentials
+	credentialUse *credentialUse
+
+	// Verifies capability tokens, if set
+	capabilities *capability.Signer
+
+	// Token admin API calls must carry, and that enables policy mutations, if set
+	adminToken string
+
+	// Instance the policy is mirrored from, which makes it read-only, if set
+	mirroredFrom string
+
+	// Whether denied access checks explain why the policy does not allow the denied actions
+	denialHints bool
+
+	// Map from relations to the actions a relationship of the relation from a resource to a
+	// subject grants the subject on the resource
+	ownership map[string][]string
+
+	// Status code for access checks naming no actions, or OK if they are allowed, and whether
+	// checks naming an action on a resource more than once are rejected
+	emptyActionsCode       codes.Code
+	rejectDuplicateActions bool
+
+	// Limits the work of each access check
+	budget evalBudget
+
+	// Backends deciding access checks, and how their decisions are combined, if set instead of
+	// the policy and then relationships
+	backends *backendSet
+
+	// Normalizes resource IDs in policies and requests, if enabled
+	resourceIDs resourceid.Pipeline
+
+	// Receives decisions on sensitive actions, if set
+	alerts alert.Notifier
+
+	// Carries policy and decision events to subscribers
+	bus *events.Bus
+
+	// Records events for collectors streaming them from the admin API, if set
+	audit *auditlog.Log
+
+	// Records each authentication and access check request, if set
+	decisionLog *decisionlog.Log
+
+	// Decision counters and recent decisions for the admin API, and how many recent decisions
+	// are kept
+	stats           *decisionStats
+	recentDecisions int
+
+	// Counts how often each grant allows a request, for the admin coverage report
+	coverage *grantCoverage
+	// Counts the requests of each subject, for the admin subject usage report
+	usage *subjectUsage
+
+	// How long clients may cache CheckAccess results, or zero for no hint
+	decisionCacheTTL time.Duration
+
+	// How long grants keep applying after they expire, to tolerate skew between clocks
+	clockSkew time.Duration
+
+	// Clock advanced with AdvanceClock, if set; otherwise the system clock is used
+	clock *adjustableClock
+
+	// Metadata header carrying the credential when a request has none, and the prefix stripped
+	// from its value
+	credentialHeader string
+	credentialPrefix string
+
+	// Credential prefix claimed by the runtime, and how other credentials are handled
+	namespace credentialNamespace
+
+	// Runtime a sample of requests is mirrored to, if set
+	shadow *shadowRuntime
+
+	// Whether unrecognized credentials are checked for common mistakes, and the longest credential
+	// accepted, or zero for no limit
+	credentialChecks    bool
+	maxCredentialLength int
+
+	// Messages replacing the catalog's for denials with each reason code
+	denialMessages map[string]string
+
+	// Adds claims to authenticated subjects, if set
+	enrichers *enrich.Chain
+
+	// Verifies JWT credentials, if set
+	jwt *jwtverify.Verifier
+
+	// Relationships written with the relationship RPCs
+	relationships *relationshipStore
+
+	// Credentials rotated by subjects, if rotation is enabled, and how long replaced credentials
+	// are still accepted
+	rotation      *rotation.Store
+	rotationGrace time.Duration
+
+	// When subjects were last seen, if stale-subject expiry is enabled, how long subjects may go
+	// unseen before they are disabled, and the subjects never disabled
+	lastSeen    *lastseen.Store
+	staleAfter  time.Duration
+	staleExempt []string
+
+	// Fires when stale subjects are next swept for. Guarded by updateMu.
+	staleTimer *time.Timer
+
+	// Workload identity whose access token the Identity service returns, if set
+	workloadIdentity string
+
+	// Incoming metadata keys captured for correlation, and whether they are echoed as claims
+	metadataKeys       []string
+	echoMetadataClaims bool
 
 	logger *zap.SugaredLogger
 
+	admin.UnimplementedAdminServer
+	credentials.UnimplementedCredentialsServer
+	identity.UnimplementedIdentityServer
 	authentication.UnimplementedAuthenticationServer
 	authorization.UnimplementedAuthorizationServer
 }
 
-// NewServer creates a new static runtime server.
-func NewServer(policyPath string, logger *zap.SugaredLogger) (Server, error) {
-	f, err := os.Open(policyPath)
-	if err != nil {
+// NewServer creates a new static runtime server with the base policy at policyPath, which may be a
+// directory of policy files to merge.
+func NewServer(policyPath string, logger *zap.SugaredLogger, opts ...Option) (Server, error) {
+	s := newServer(logger, opts...)
+
+	if err := s.UpdatePolicyFile(policyPath); err != nil {
 		return nil, err
 	}
 
-	defer f.Close()
+	return s, nil
+}
+
+// NewServerFromReader creates a new static runtime server with a base policy read from r. The
+// source and revision describe where the policy came from; if revision is empty, a digest of the
+// policy is used.
+func NewServerFromReader(r io.Reader, source, revision string, logger *zap.SugaredLogger, opts ...Option) (Server, error) {
+	s := newServer(logger, opts...)
 
-	policy, err := readPolicy(f)
-	if err != nil {
+	if err := s.UpdatePolicy(r, source, revision); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func newFromPolicy(c policy, logger *zap.SugaredLogger, opts ...Option) (*server, error) {
+	s := newServer(logger, opts...)
+
+	if err := s.setPolicy(c, "", ""); err != nil {
 		return nil, err
 	}
 
-	return newFromPolicy(policy, logger)
+	return s, nil
+}
+
+func newServer(logger *zap.SugaredLogger, opts ...Option) *server {
+	out := &server{
+		logger:             logger,
+		coverage:           newGrantCoverage(),
+		usage:              newSubjectUsage(),
+		relationships:      newRelationshipStore(),
+		getenv:             os.Getenv,
+		recordMetrics:      true,
+		subjectConnections: newSubjectCounter(),
+		subjectStreams:     newSubjectCounter(),
+		issued:             newIssuedTokens(),
+		credentialUse:      newCredentialUse(),
+		issuedTokenTTL:     defaultIssuedTokenTTL,
+		historySize:        defaultPolicyHistorySize,
+	}
+
+	for _, opt := range opts {
+		opt(out)
+	}
+
+	if out.bus == nil {
+		out.bus = events.NewBus()
+	}
+
+	out.stats = newDecisionStats(out.recentDecisions)
+	out.expectedTraffic = out.normalizeExpectedTraffic(out.expectedTraffic)
+
+	if out.features == nil {
+		// Enabling no flags cannot fail.
+		out.features, _ = features.New(nil, nil)
+	}
+
+	if out.decrypter == nil {
+		out.decrypter = new(policycrypt.Decrypter)
+	}
+
+	out.subscribeDefaults()
+
+	return out
+}
+
+func (s *server) PolicyInfo() PolicyInfo {
+	return s.state.Load().info
+}
+
+func (s *server) RecentDecisions(max int) []events.DecisionMade {
+	return s.stats.recentDecisions(max)
+}
+
+func (s *server) UpdatePolicyFile(path string) error {
+	defer s.startLoad()()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		return s.UpdatePolicy(f, path, "")
+	}
+
+	data, err := ReadPolicyDir(path, s.decrypter.ReadFile)
+	if err != nil {
+		return err
+	}
+
+	return s.UpdatePolicy(bytes.NewReader(data), path, "")
 }
 
-func newFromPolicy(c policy, logger *zap.SugaredLogger) (*server, error) {
+func (s *server) UpdatePolicy(r io.Reader, source, revision string) error {
+	defer s.startLoad()()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	data, err = s.decrypter.Decrypt(data)
+	if err != nil {
+		return err
+	}
+
+	base, err := readPolicy(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if err := checkNoPatchMarkers(base); err != nil {
+		return err
+	}
+
+	merged, err := applyOverlayFiles(s.decrypter.ReadFile, base, s.policyOverlays...)
+	if err != nil {
+		return err
+	}
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	return s.setPolicy(merged, source, revision)
+}
+
+// startLoad reports to the load hook that a policy is loading, and returns the function reporting
+// that it finished. The hook is only told that loading finished once no load is in progress.
+func (s *server) startLoad() func() {
+	if s.loadHook == nil {
+		return func() {}
+	}
+
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	s.loads++
+	if s.loads == 1 {
+		s.loadHook(true)
+	}
+
+	return func() {
+		s.loadMu.Lock()
+		defer s.loadMu.Unlock()
+
+		s.loads--
+		if s.loads == 0 {
+			s.loadHook(false)
+		}
+	}
+}
+
+// setPolicy resolves the tokens in the given policy and atomically makes it the server's active
+// policy. If the policy is invalid or fails the reload guard, the active policy is unchanged. If
+// revision is empty, a digest of the policy is used. The replaced policy is kept in the history.
+func (s *server) setPolicy(c policy, source, revision string) error {
+	now := s.now()
+	c = s.normalizePolicy(c)
+
+	state, err := s.newPolicyState(c, s.evaluatedAt(now))
+	if err != nil {
+		return err
+	}
+
+	if revision == "" {
+		digest, err := policyDigest(c)
+		if err != nil {
+			return err
+		}
+
+		revision = digest
+	}
+
+	current := s.state.Load()
+
+	if err := s.checkExpectedTraffic(state, source); err != nil {
+		if current != nil {
+			s.rejectPolicy(source, revision, err)
+		}
+
+		return err
+	}
+
+	if current != nil {
+		if err := s.reloadGuard.check(current.policy, c); err != nil {
+			s.rejectPolicy(source, revision, err)
+
+			return err
+		}
+	}
+
+	state.info = PolicyInfo{
+		Source:   source,
+		Revision: revision,
+		LoadedAt: now,
+	}
+
+	s.state.Store(state)
+	s.remember(current)
+
+	s.bus.Publish(events.PolicyLoaded{
+		Source:   source,
+		Revision: revision,
+		Time:     state.info.LoadedAt,
+	})
+
+	s.scheduleExpirySweep(c, s.evaluatedAt(now))
+	s.scheduleStaleSweep(c, now)
+
+	return nil
+}
+
+// newPolicyState compiles the grants in the given policy that are active at now, an evaluation
+// time from evaluatedAt, and resolves its tokens. The returned state has no PolicyInfo.
+func (s *server) newPolicyState(c policy, now time.Time) (*policyState, error) {
+	compiled, err := compileSubjects(activeGrants(c, now))
+	if err != nil {
+		return nil, err
+	}
+
 	tokens := make(map[string]policySubject)
+	tokenDigests := make(map[tokenDigest]policySubject)
+	subjectTokens := make(map[string][]policyCredential)
+	digests := make(map[tokenDigest]struct{})
+	subjects := make(map[string]policySubject, len(compiled))
+	clients := make(map[string]clientSecret)
+	networks := make(map[string][]netip.Prefix)
+	jwtSubjects := make(map[jwtverify.Identity]policySubject)
 
-	for _, sub := range c.Subjects {
-		for _, tok := range sub.Tokens {
-			tokValue := os.Getenv(tok.EnvVar)
-			if tokValue == "" {
-				err := fmt.Errorf("%s: %s: %w", sub.ID, tok.EnvVar, ErrMissingValue)
-				return nil, err
+	for _, sub := range compiled {
+		sub.index = newGrantIndex(sub)
+		subjects[sub.ID] = sub
+
+		for _, js := range sub.JWTSubjects {
+			jwtSubjects[jwtverify.Identity{Issuer: js.Issuer, Subject: js.Subject}] = sub
+		}
+
+		for i, tok := range sub.Tokens {
+			digest, hashed := tok.digest()
+
+			var tokValue string
+
+			if !hashed {
+				tokValue, err = resolveToken(tok, s.getenv, s.tokenCommands)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s: %w", sub.ID, tok.ref(i), err)
+				}
+
+				if tokValue == "" {
+					err := fmt.Errorf("%s: %s: %w", sub.ID, tok.ref(i), ErrMissingToken)
+					return nil, err
+				}
+
+				if err := s.checkNamespaceTokens(sub, tok.ref(i), tokValue); err != nil {
+					return nil, err
+				}
+
+				digest = digestToken(tokValue)
 			}
 
-			if _, ok := tokens[tokValue]; ok {
-				err := fmt.Errorf("%s: %s: %w", sub.ID, tok.EnvVar, ErrDuplicateValue)
+			// Tokens are compared by digest, so a plaintext token cannot also be hashed.
+			if _, ok := digests[digest]; ok {
+				err := fmt.Errorf("%s: %s: %w", sub.ID, tok.ref(i), ErrDuplicateValue)
 				return nil, err
 			}
 
-			tokens[tokValue] = sub
+			digests[digest] = struct{}{}
+			subjectTokens[sub.ID] = append(subjectTokens[sub.ID], policyCredential{digest: digest, token: tok, index: i})
+
+			if hashed {
+				tokenDigests[digest] = sub
+			} else {
+				tokens[tokValue] = sub
+			}
+		}
+
+		if len(sub.AllowedNetworks) > 0 {
+			// Validated by compileSubjects.
+			networks[sub.ID], _ = parseNetworks(sub.AllowedNetworks)
+		}
+
+		for _, client := range sub.Clients {
+			secret := s.getenv(client.SecretEnvVar)
+			if secret == "" {
+				return nil, fmt.Errorf("%s: %s: %w", sub.ID, client.SecretEnvVar, ErrMissingToken)
+			}
+
+			clients[client.ID] = clientSecret{subjectID: sub.ID, secret: secret}
 		}
 	}
 
-	out := &server{
-		tokens: tokens,
-		logger: logger,
+	out := &policyState{
+		policy:        c,
+		compiledAt:    now,
+		tokens:        tokens,
+		tokenDigests:  tokenDigests,
+		subjectTokens: subjectTokens,
+		subjects:      subjects,
+		jwtSubjects:   jwtSubjects,
+		clients:       clients,
+		networks:      networks,
+	}
+
+	if c.StrictUnknowns {
+		out.declared = declaredNames(c)
+	}
+
+	// Validated by compileSubjects.
+	out.tenants, _ = resourceTenants(c)
+
+	out.warmed, out.expectedDenials = warmDecisions(subjects, out.tenants, s.expectedTraffic)
+
+	identities, err := s.resolveIdentities(c)
+	if err != nil {
+		return nil, err
+	}
+
+	out.identities = identities
+	out.ownerActions = s.ownerActions(c)
+
+	if s.denialHints {
+		// Explain denials at the evaluation time of the checks, from the server's clock, which may be
+		// adjusted.
+		out.explorer, err = newExplorer(c, now, s.clockSkew)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return out, nil
 }
 
-func (s *server) AuthenticateSubject(_ context.Context, req *authentication.AuthenticateSubjectRequest) (*authentication.AuthenticateSubjectResponse, error) {
+// compileSubjects validates the structure of a policy and returns its subjects with role grants,
+// inherited grants, and implied actions expanded. Tokens are not resolved.
+func compileSubjects(c policy) ([]policySubject, error) {
+	if err := validateIDs(c); err != nil {
+		return nil, err
+	}
+
+	if err := validateDelegations(c); err != nil {
+		return nil, err
+	}
+
+	if err := validateClients(c); err != nil {
+		return nil, err
+	}
+
+	if err := validateNetworks(c); err != nil {
+		return nil, err
+	}
+
+	if err := validateResponseMetadata(c); err != nil {
+		return nil, err
+	}
+
+	if err := validateJWTSubjects(c); err != nil {
+		return nil, err
+	}
+
+	if err := validateClaims(c); err != nil {
+		return nil, err
+	}
+
+	if err := validateIdentities(c); err != nil {
+		return nil, err
+	}
+
+	if err := validateHierarchy(c); err != nil {
+		return nil, err
+	}
+
+	if err := validateTenants(c); err != nil {
+		return nil, err
+	}
+
+	roles, err := newRoleIndex(c.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateOnCall(c, roles); err != nil {
+		return nil, err
+	}
+
+	closure := transitiveClosure(c.Implies)
+	descendants := transitiveClosure(c.Contains)
+
+	out := make([]policySubject, 0, len(c.Subjects))
+
+	for _, sub := range c.Subjects {
+		conditional := compileConditional(sub, roles, descendants, closure)
+
+		direct := make([]policyResource, 0, len(sub.Resources))
+		for _, res := range unconditional(sub.Resources) {
+			direct = append(direct, withGrant(res, sub.ID, "", res.RuleID))
+		}
+
+		sub.Resources = direct
+
+		sub, err := expandRoles(sub, roles)
+		if err != nil {
+			return nil, err
+		}
+
+		sub = expandDenies(sub, roles, descendants)
+		sub = expandSubject(expandHierarchy(sub, descendants), closure)
+		sub.conditional = conditional
+
+		out = append(out, sub)
+	}
+
+	return out, nil
+}
+
+func (s *server) AuthenticateSubject(ctx context.Context, req *authentication.AuthenticateSubjectRequest) (_ *authentication.AuthenticateSubjectResponse, err error) {
 	s.logger.Info("received AuthenticateSubject request")
 
-	sub, ok := s.tokens[req.Credential]
-	if !ok {
-		return nil, status.Errorf(codes.Unauthenticated, "invalid credential")
+	ctx, logged := s.logRequest(ctx, decisionlog.MethodAuthenticateSubject, nil)
+	defer func() { logged(err) }()
+
+	if credential, foreign := s.foreignCredential(ctx, req.Credential); foreign {
+		return s.forwardAuthenticateSubject(ctx, credential)
+	}
+
+	st := s.state.Load()
+
+	sub, err := s.authenticate(ctx, st, req.Credential)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkPeer(ctx, st, sub); err != nil {
+		return nil, err
+	}
+
+	sendResponseMetadata(ctx, sub)
+
+	claims := subjectClaims(sub)
+	claims["sub"] = sub.ID
+
+	if principalID, ok := onBehalfOf(ctx); ok {
+		requestFrom(ctx).setSubject(principalID, sub.ID)
+
+		if _, ok := findDelegation(sub, principalID); !ok {
+			return nil, s.deny(codes.PermissionDenied, reasonDelegationDenied, "actor", sub.ID, "subject", principalID)
+		}
+
+		s.logger.Infow("authenticated delegated subject", "subject", principalID, "actor", sub.ID)
+
+		// Follow RFC 8693: the principal is the subject and the delegate is the actor. The claims
+		// describe the principal.
+		claims = subjectClaims(st.subjects[principalID])
+		claims["sub"] = principalID
+		claims["act"] = sub.ID
+	}
+
+	enrichCtx, span := tracer.Start(ctx, "enrich", trace.WithAttributes(attrSubject.String(claims["sub"])))
+	err = s.enrichers.Apply(enrichCtx, claims)
+
+	endSpan(span, err)
+
+	if err != nil {
+		s.logger.Errorw("failed to enrich subject claims", "subject", claims["sub"], "error", err)
+
+		return nil, s.deny(codes.Unavailable, reasonEnrichmentFailed)
+	}
+
+	if s.echoMetadataClaims {
+		for k, v := range s.capturedMetadata(ctx) {
+			if _, ok := claims[k]; !ok {
+				claims[k] = v
+			}
+		}
 	}
 
 	resp := &authentication.AuthenticateSubjectResponse{
-		SubjectClaims: map[string]string{
-			"sub": sub.ID,
-		},
+		SubjectClaims: claims,
 	}
 
 	return resp, nil
 }
 
-func (s *server) CheckAccess(_ context.Context, req *authorization.CheckAccessRequest) (*authorization.CheckAccessResponse, error) {
+func (s *server) CheckAccess(ctx context.Context, req *authorization.CheckAccessRequest) (_ *authorization.CheckAccessResponse, err error) {
 	s.logger.Info("received CheckAccess request")
 
-	sub, ok := s.tokens[req.Credential]
-	if !ok {
-		return nil, status.Errorf(codes.Unauthenticated, "invalid credential")
+	ctx, logged := s.logRequest(ctx, decisionlog.MethodCheckAccess, req.Actions)
+	defer func() { logged(err) }()
+
+	if credential, foreign := s.foreignCredential(ctx, req.Credential); foreign {
+		return s.forwardCheckAccess(ctx, credential, req)
 	}
 
-	for _, action := range req.Actions {
-		if ok := checkAccess(sub, action.Action, action.ResourceId); !ok {
-			return nil, status.Errorf(codes.PermissionDenied, "subject does not have permission to perform '%s' on resource '%s'", action.Action, action.ResourceId)
+	req = s.normalizeCheckRequest(req)
+
+	if s.decisionCacheTTL > 0 {
+		// Matches client.CacheTTLHeader.
+		_ = grpc.SetHeader(ctx, metadata.Pairs(cacheTTLMetadataKey, s.decisionCacheTTL.String()))
+	}
+
+	st := s.state.Load()
+
+	sub, err := s.authenticate(ctx, st, req.Credential)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkPeer(ctx, st, sub); err != nil {
+		return nil, err
+	}
+
+	sendResponseMetadata(ctx, sub)
+
+	if err := s.checkActionList(sub.ID, req); err != nil {
+		return nil, err
+	}
+
+	if s.profiles != nil {
+		if err := s.profiles.Apply(ctx, checkedActions(req)); err != nil {
+			return nil, err
 		}
 	}
 
+	if err := s.checkUnknowns(st, req.Actions); err != nil {
+		s.logger.Warnw("rejected access check naming undeclared actions or resources", "subject", sub.ID, "error", err)
+
+		return nil, err
+	}
+
+	principalID, delegated := onBehalfOf(ctx)
+	if delegated {
+		return s.checkDelegatedAccess(ctx, st, sub, principalID, req)
+	}
+
+	if err := s.checkTenants(ctx, st, req, sub.ID, "", sub); err != nil {
+		return nil, err
+	}
+
+	results := getCheckResults()
+	defer putCheckResults(results)
+
+	_, span := tracer.Start(ctx, "evaluate", trace.WithAttributes(
+		attrSubject.String(sub.ID),
+		attrActions.Int(len(req.Actions)),
+	))
+
+	// Every action is evaluated, so a denial reports all the actions that were denied. They are
+	// all evaluated against st, even if the policy is reloaded meanwhile, and at one instant, so
+	// the decisions are those of one policy at one time.
+	now := s.now()
+
+	ctx, ev := s.startEvaluation(ctx)
+
+	for i, action := range req.Actions {
+		allowed, grants, backends := s.decide(ctx, st, sub, req.Credential, action.Action, action.ResourceId, now)
+
+		if ev.exhausted() {
+			span.End()
+
+			return nil, s.budgetExceeded(ev, sub.ID, action)
+		}
+
+		addBackendsEvent(span, action, backends)
+		s.publishDecision(ctx, st, sub.ID, "", action.Action, action.ResourceId, allowed, grants, backends)
+
+		if !allowed {
+			results.deny(i, backends)
+
+			continue
+		}
+
+		results.matched = appendGrants(results.matched, grants)
+	}
+
+	span.SetAttributes(attrDenied.Int(len(results.denied)))
+	span.End()
+
+	if len(results.denied) > 0 {
+		s.logger.Warnw("denied access check", "subject", sub.ID, "denied", deniedPairs(req, results.denied), "actions", len(req.Actions))
+
+		err := s.denyActions(reasonActionDenied, req, results.denied, func(action *authorization.AccessRequestAction) []string {
+			return []string{
+				"subject", sub.ID,
+				"action", action.Action,
+				"resource_id", action.ResourceId,
+			}
+		})
+
+		return nil, s.withDenialHints(err, st, sub.ID, req, results,
+			"the policy grants it, but a rule depending on the request, such as a grant condition or feature flag, denied it")
+	}
+
+	if md := matchedRulesTrailer(results.matched); md != nil {
+		_ = grpc.SetTrailer(ctx, md)
+	}
+
 	return &authorization.CheckAccessResponse{}, nil
 }
+
+// deniedPairs describes the denied actions of req, given by their indexes, for logging.
+func deniedPairs(req *authorization.CheckAccessRequest, denied []int) []string {
+	out := make([]string, 0, len(denied))
+
+	for _, i := range denied {
+		out = append(out, fmt.Sprintf("%s on %s", req.Actions[i].Action, req.Actions[i].ResourceId))
+	}
+
+	return out
+}
+
+// checkResults collects the grants matched and the indexes of the actions denied by an access
+// check, with the backend decisions on each denied action, which are empty unless backends are
+// configured. They are pooled, since every check needs them and they are garbage once it is
+// answered.
+type checkResults struct {
+	matched  []grantRef
+	denied   []int
+	backends [][]events.BackendDecision
+}
+
+// deny records the denial of the action with index i, and the backend decisions on it.
+func (r *checkResults) deny(i int, backends []events.BackendDecision) {
+	r.denied = append(r.denied, i)
+	r.backends = append(r.backends, backends)
+}
+
+var checkResultsPool = sync.Pool{
+	New: func() any { return new(checkResults) },
+}
+
+// getCheckResults returns empty results from the pool.
+func getCheckResults() *checkResults {
+	return checkResultsPool.Get().(*checkResults)
+}
+
+// putCheckResults empties r and returns it to the pool, unless it grew too large to keep.
+func putCheckResults(r *checkResults) {
+	if cap(r.matched) > maxPooledActions || cap(r.denied) > maxPooledActions || cap(r.backends) > maxPooledActions {
+		return
+	}
+
+	// Clearing drops the matched grants' strings, so pooled results do not keep them alive.
+	clear(r.matched)
+	clear(r.backends)
+	r.matched, r.denied, r.backends = r.matched[:0], r.denied[:0], r.backends[:0]
+
+	checkResultsPool.Put(r)
+}
+
+// checkedActions returns the names of the actions checked by req.
+func checkedActions(req *authorization.CheckAccessRequest) []string {
+	out := make([]string, 0, len(req.Actions))
+
+	for _, action := range req.Actions {
+		out = append(out, action.Action)
+	}
+
+	return out
+}
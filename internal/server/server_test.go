@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testToken returns the token of the test subject with the given ID.
+func testToken(subjectID string) string {
+	return "token-" + subjectID
+}
+
+// testSubject returns a subject authenticated by testToken(id), granted resources.
+func testSubject(id string, resources ...policyResource) policySubject {
+	digest := sha256.Sum256([]byte(testToken(id)))
+
+	return policySubject{
+		ID:        id,
+		Tokens:    []policyToken{{SHA256: hex.EncodeToString(digest[:])}},
+		Resources: resources,
+	}
+}
+
+// newTestServer returns a server with policy p, which does not record metrics.
+func newTestServer(tb testing.TB, p policy, opts ...Option) *server {
+	tb.Helper()
+
+	s, err := newFromPolicy(p, zap.NewNop().Sugar(), append([]Option{WithoutMetrics()}, opts...)...)
+	if err != nil {
+		tb.Fatalf("creating server: %s", err)
+	}
+
+	return s
+}
+
+// checkTestAccess checks whether the test subject with the given ID may perform actions.
+func checkTestAccess(s *server, subjectID string, actions ...*authorization.AccessRequestAction) error {
+	_, err := s.CheckAccess(context.Background(), &authorization.CheckAccessRequest{
+		Credential: testToken(subjectID),
+		Actions:    actions,
+	})
+
+	return err
+}
+
+// deniedActions returns the indexes of the actions a CheckAccess error denied, as a set.
+func deniedActions(err error) (map[int]bool, error) {
+	out := make(map[int]bool)
+
+	if err == nil {
+		return out, nil
+	}
+
+	st := status.Convert(err)
+	if st.Code() != codes.PermissionDenied {
+		return nil, err
+	}
+
+	for _, d := range st.Details() {
+		failure, ok := d.(*errdetails.PreconditionFailure)
+		if !ok {
+			continue
+		}
+
+		for _, v := range failure.Violations {
+			var i int
+			if _, err := fmt.Sscanf(v.Subject, "actions[%d]", &i); err != nil {
+				return nil, fmt.Errorf("violation subject %q: %w", v.Subject, err)
+			}
+
+			out[i] = true
+		}
+	}
+
+	return out, nil
+}
+
+// TestCheckAccessConsistentDuringReloads checks many actions while the policy is reloaded, to
+// show that every action of a check is decided by the same policy. Alternate policies grant
+// opposite halves of the checked resources, so a check reading both would deny neither or both
+// halves, or parts of each.
+func TestCheckAccessConsistentDuringReloads(t *testing.T) {
+	const (
+		resources = 64
+		reloads   = 1000
+		checkers  = 4
+	)
+
+	// generation returns the policy granting the first half of the resources if first is set,
+	// or the second half.
+	generation := func(first bool) policy {
+		var granted []policyResource
+
+		for i := 0; i < resources; i++ {
+			if (i < resources/2) == first {
+				granted = append(granted, policyResource{ID: fmt.Sprintf("resource-%d", i), Actions: []string{"read"}})
+			}
+		}
+
+		return policy{Subjects: []policySubject{testSubject("alice", granted...)}}
+	}
+
+	s := newTestServer(t, generation(true))
+
+	actions := make([]*authorization.AccessRequestAction, resources)
+	for i := range actions {
+		actions[i] = &authorization.AccessRequestAction{Action: "read", ResourceId: fmt.Sprintf("resource-%d", i)}
+	}
+
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	for c := 0; c < checkers; c++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				denied, err := deniedActions(checkTestAccess(s, "alice", actions...))
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+
+					return
+				}
+
+				if len(denied) != resources/2 {
+					t.Errorf("check denied %d of %d actions, not half: %v", len(denied), resources, denied)
+
+					return
+				}
+
+				// The denied half must be the first or the second, whole.
+				firstDenied := denied[0]
+
+				for i := 0; i < resources; i++ {
+					if denied[i] != ((i < resources/2) == firstDenied) {
+						t.Errorf("check mixed decisions of two policies: denied %v", denied)
+
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < reloads; i++ {
+		if err := s.setPolicy(generation(i%2 == 1), "", ""); err != nil {
+			t.Fatalf("reloading policy: %s", err)
+		}
+	}
+
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/metrics"
+)
+
+// maxSessionEntries bounds the credentials cached per connection. A connection carrying more,
+// such as one from a proxy, starts over when the cache is full.
+const maxSessionEntries = 256
+
+// sessionEntry is a cached credential resolution.
+type sessionEntry struct {
+	sub policySubject
+	// The policy state and credential generation the credential was resolved against
+	st         *policyState
+	generation uint64
+}
+
+// sessionCache caches the subjects authenticated by credentials on one connection.
+type sessionCache struct {
+	mu      sync.Mutex
+	entries map[string]sessionEntry
+}
+
+// get returns the cached subject for credential if it was resolved against st and generation.
+func (c *sessionCache) get(credential string, st *policyState, generation uint64) (policySubject, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[credential]
+	if !ok {
+		return policySubject{}, false
+	}
+
+	if e.st != st || e.generation != generation {
+		delete(c.entries, credential)
+
+		return policySubject{}, false
+	}
+
+	return e.sub, true
+}
+
+func (c *sessionCache) put(credential string, e sessionEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil || len(c.entries) >= maxSessionEntries {
+		c.entries = make(map[string]sessionEntry)
+	}
+
+	c.entries[credential] = e
+}
+
+// lookupSession returns the subject authenticated by credential, from the connection's session
+// cache if possible. Only policy tokens that were never rotated are cached, since other
+// credentials expire. Entries are dropped when the policy is reloaded or recompiled and when any
+// credential is rotated.
+func (s *server) lookupSession(ctx context.Context, st *policyState, credential string) (policySubject, bool) {
+	conn := connectionFrom(ctx)
+	if !s.sessionCache || conn == nil {
+		sub, ok, _ := s.lookupCredential(st, credential)
+
+		return sub, ok
+	}
+
+	generation := s.credentialGeneration.Load()
+
+	if sub, ok := conn.sessions.get(credential, st, generation); ok {
+		s.recordSessionLookup(metrics.SessionResultHit)
+
+		return sub, true
+	}
+
+	s.recordSessionLookup(metrics.SessionResultMiss)
+
+	sub, ok, cacheable := s.lookupCredential(st, credential)
+	if ok && cacheable {
+		conn.sessions.put(credential, sessionEntry{sub: sub, st: st, generation: generation})
+	}
+
+	return sub, ok
+}
+
+func (s *server) recordSessionLookup(result string) {
+	if s.recordMetrics {
+		metrics.RecordSessionLookup(result)
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"math/rand"
+	"path"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/metrics"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authentication"
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultShadowTimeout bounds a mirrored request when no timeout is configured.
+const defaultShadowTimeout = 5 * time.Second
+
+// maxShadowInFlight is the most mirrored requests waiting on the shadow runtime at once. Requests
+// sampled beyond it are dropped, so a slow shadow cannot pile up goroutines.
+const maxShadowInFlight = 64
+
+// shadowRuntime is another runtime a sample of requests is mirrored to, so its decisions can be
+// compared with this one's before it takes over.
+type shadowRuntime struct {
+	conn       grpc.ClientConnInterface
+	sampleRate float64
+	timeout    time.Duration
+	// Holds a token for each mirrored request in flight
+	inFlight chan struct{}
+}
+
+// sampled reports whether a request should be mirrored.
+func (sh *shadowRuntime) sampled() bool {
+	return sh.sampleRate >= 1 || (sh.sampleRate > 0 && rand.Float64() < sh.sampleRate)
+}
+
+// ShadowUnaryInterceptor mirrors a sample of AuthenticateSubject and CheckAccess requests to the
+// shadow runtime once they are answered, logging those it decides differently. Mirroring never
+// delays or changes the answer given to the caller.
+func (s *server) ShadowUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+
+		if s.shadow == nil {
+			return resp, err
+		}
+
+		switch req.(type) {
+		case *authentication.AuthenticateSubjectRequest, *authorization.CheckAccessRequest:
+		default:
+			return resp, err
+		}
+
+		if !s.shadow.sampled() {
+			return resp, err
+		}
+
+		rpc := path.Base(info.FullMethod)
+
+		select {
+		case s.shadow.inFlight <- struct{}{}:
+		default:
+			metrics.RecordShadowComparison(rpc, metrics.ShadowResultDropped)
+
+			return resp, err
+		}
+
+		// The mirrored request outlives the caller's, but keeps its metadata, such as on-behalf-of.
+		shadowCtx := upstreamContext(context.WithoutCancel(ctx))
+
+		go func() {
+			defer func() { <-s.shadow.inFlight }()
+
+			s.compareShadow(shadowCtx, rpc, req, resp, err)
+		}()
+
+		return resp, err
+	}
+}
+
+// compareShadow sends req to the shadow runtime and compares its answer with the local one.
+func (s *server) compareShadow(ctx context.Context, rpc string, req, resp any, err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.shadow.timeout)
+	defer cancel()
+
+	var (
+		remoteResp any
+		remoteErr  error
+		fields     []any
+	)
+
+	switch req := req.(type) {
+	case *authentication.AuthenticateSubjectRequest:
+		var remote *authentication.AuthenticateSubjectResponse
+
+		remote, remoteErr = authentication.NewAuthenticationClient(s.shadow.conn).AuthenticateSubject(ctx, req)
+		remoteResp = remote
+
+		local, _ := resp.(*authentication.AuthenticateSubjectResponse)
+		fields = []any{"local_subject", local.GetSubjectClaims()["sub"], "remote_subject", remote.GetSubjectClaims()["sub"]}
+	case *authorization.CheckAccessRequest:
+		remoteResp, remoteErr = authorization.NewAuthorizationClient(s.shadow.conn).CheckAccess(ctx, req)
+
+		actions := make([]string, len(req.Actions))
+		for i, action := range req.Actions {
+			actions[i] = action.Action + " " + action.ResourceId
+		}
+
+		fields = []any{"actions", actions}
+	}
+
+	local, remote := status.Code(err), status.Code(remoteErr)
+
+	if shadowFailed(remote) {
+		metrics.RecordShadowComparison(rpc, metrics.ShadowResultError)
+		s.logger.Debugw("shadow runtime failed to answer mirrored request", "rpc", rpc, "error", remoteErr)
+
+		return
+	}
+
+	if local == remote && shadowSubjectsMatch(resp, remoteResp) {
+		metrics.RecordShadowComparison(rpc, metrics.ShadowResultMatch)
+
+		return
+	}
+
+	metrics.RecordShadowComparison(rpc, metrics.ShadowResultMismatch)
+
+	fields = append([]any{"rpc", rpc, "local", local.String(), "remote", remote.String()}, fields...)
+	s.logger.Warnw("shadow runtime decided mirrored request differently", fields...)
+}
+
+// shadowFailed reports whether the shadow runtime failed to answer with code, rather than
+// answering. Failures are counted, but not compared.
+func shadowFailed(code codes.Code) bool {
+	switch code {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Unavailable, codes.ResourceExhausted, codes.Unimplemented, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// shadowSubjectsMatch reports whether two AuthenticateSubject responses authenticated the same
+// subject. Other responses always match, since their status codes carry the whole decision.
+func shadowSubjectsMatch(local, remote any) bool {
+	l, ok := local.(*authentication.AuthenticateSubjectResponse)
+	if !ok {
+		return true
+	}
+
+	r, _ := remote.(*authentication.AuthenticateSubjectResponse)
+
+	return l.GetSubjectClaims()["sub"] == r.GetSubjectClaims()["sub"]
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Snapshot reads the policy at the given path, applies any overlays, and writes its canonical,
+// fully resolved form to w as YAML. The output is byte-for-byte identical for policies with the same effective grants,
+// making it suitable for committing as a golden file and diffing in reviews. Token values are
+// never resolved or included. Files are read with read, or only plaintext policies are accepted if
+// read is nil.
+func Snapshot(policyPath string, overlayPaths []string, w io.Writer, read ReadFileFunc) error {
+	p, err := readPolicyFiles(readerOrDefault(read), policyPath, overlayPaths...)
+	if err != nil {
+		return err
+	}
+
+	return encodePolicy(w, canonicalPolicy(p))
+}
+
+// policyDigest returns a hex-encoded SHA-256 digest of the canonical form of a policy.
+func policyDigest(p policy) (string, error) {
+	b, err := json.Marshal(canonicalPolicy(p))
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// encodePolicy writes the given policy to w as YAML.
+func encodePolicy(w io.Writer, p policy) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(p); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// canonicalPolicy returns the effective form of a policy: subjects, tokens, resources, and actions
+// are sorted, duplicate actions are removed, and duplicate resource entries within a subject are
+// collapsed to the entry that is used during evaluation.
+func canonicalPolicy(p policy) policy {
+	subjects := make([]policySubject, 0, len(p.Subjects))
+
+	for _, sub := range p.Subjects {
+		tokens := append([]policyToken(nil), sub.Tokens...)
+
+		sort.Slice(tokens, func(i, j int) bool {
+			a, b := tokens[i], tokens[j]
+
+			if a.EnvVar != b.EnvVar {
+				return a.EnvVar < b.EnvVar
+			}
+
+			if a.File != b.File {
+				return a.File < b.File
+			}
+
+			if a.SHA256 != b.SHA256 {
+				return a.SHA256 < b.SHA256
+			}
+
+			return a.Exec < b.Exec
+		})
+
+		resources := canonicalResources(sub.Resources)
+
+		var delegations []policyDelegation
+		for _, del := range sub.Delegations {
+			delegations = mergeDelegation(delegations, del)
+		}
+
+		for i := range delegations {
+			delegations[i].Actions = sortedUnique(delegations[i].Actions)
+		}
+
+		sort.Slice(delegations, func(i, j int) bool {
+			return delegations[i].Subject < delegations[j].Subject
+		})
+
+		var clients []policyClient
+		for _, client := range sub.Clients {
+			clients = mergeClient(clients, client)
+		}
+
+		sort.Slice(clients, func(i, j int) bool {
+			return clients[i].ID < clients[j].ID
+		})
+
+		jwtSubjects := append([]policyJWTSubject(nil), sub.JWTSubjects...)
+
+		sort.Slice(jwtSubjects, func(i, j int) bool {
+			if jwtSubjects[i].Issuer != jwtSubjects[j].Issuer {
+				return jwtSubjects[i].Issuer < jwtSubjects[j].Issuer
+			}
+
+			return jwtSubjects[i].Subject < jwtSubjects[j].Subject
+		})
+
+		subjects = append(subjects, policySubject{
+			ID:               sub.ID,
+			Tokens:           tokens,
+			Resources:        resources,
+			Roles:            sortedUnique(sub.Roles),
+			Delegations:      delegations,
+			Deny:             canonicalDenies(sub.Deny),
+			Clients:          clients,
+			JWTSubjects:      jwtSubjects,
+			AllowedNetworks:  sortedUnique(sub.AllowedNetworks),
+			ResponseMetadata: sub.ResponseMetadata,
+			Claims:           sub.Claims,
+			Tenant:           sub.Tenant,
+		})
+	}
+
+	sort.SliceStable(subjects, func(i, j int) bool {
+		return subjects[i].ID < subjects[j].ID
+	})
+
+	var implies map[string][]string
+	if len(p.Implies) > 0 {
+		implies = make(map[string][]string, len(p.Implies))
+		for action, implied := range p.Implies {
+			implies[action] = sortedUnique(implied)
+		}
+	}
+
+	var contains map[string][]string
+	if len(p.Contains) > 0 {
+		contains = make(map[string][]string, len(p.Contains))
+		for parent, children := range p.Contains {
+			contains[parent] = sortedUnique(children)
+		}
+	}
+
+	var tenants map[string][]string
+	if len(p.Tenants) > 0 {
+		tenants = make(map[string][]string, len(p.Tenants))
+		for tenant, resources := range p.Tenants {
+			tenants[tenant] = sortedUnique(resources)
+		}
+	}
+
+	var roles []policyRole
+	for _, role := range p.Roles {
+		roles = append(roles, policyRole{
+			ID:        role.ID,
+			Version:   role.Version,
+			RuleID:    role.RuleID,
+			Resources: canonicalResources(role.Resources),
+			Roles:     sortedUnique(role.Roles),
+			Deny:      canonicalDenies(role.Deny),
+		})
+	}
+
+	sort.SliceStable(roles, func(i, j int) bool {
+		if roles[i].ID != roles[j].ID {
+			return roles[i].ID < roles[j].ID
+		}
+
+		return compareVersions(roles[i].Version, roles[j].Version) < 0
+	})
+
+	identities := append([]policyIdentity(nil), p.Identities...)
+
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].ID < identities[j].ID
+	})
+
+	var onCall []policyOnCall
+	for _, o := range p.OnCall {
+		o.Subjects = sortedUnique(o.Subjects)
+		o.Resources = canonicalResources(o.Resources)
+		o.Roles = sortedUnique(o.Roles)
+		onCall = append(onCall, o)
+	}
+
+	sort.Slice(onCall, func(i, j int) bool {
+		return onCall[i].ID < onCall[j].ID
+	})
+
+	return policy{
+		Implies:        implies,
+		Contains:       contains,
+		Tenants:        tenants,
+		Roles:          roles,
+		Sensitive:      sortedUnique(p.Sensitive),
+		Deprecated:     p.Deprecated,
+		StrictUnknowns: p.StrictUnknowns,
+		Identities:     identities,
+		OnCall:         onCall,
+		Subjects:       subjects,
+	}
+}
+
+func canonicalResources(in []policyResource) []policyResource {
+	// checkAccess uses the last matching resource entry, so later entries take precedence.
+	// Conditional grants add to the entry instead, so they are kept by their conditions.
+	byID := make(map[string]policyResource, len(in))
+	for _, res := range in {
+		byID[res.ID+"\x00"+res.Conditions.key()] = res
+	}
+
+	resources := make([]policyResource, 0, len(byID))
+	for _, res := range byID {
+		resources = append(resources, policyResource{
+			ID:         res.ID,
+			RuleID:     res.RuleID,
+			Actions:    sortedUnique(res.Actions),
+			ExpiresAt:  utcTime(res.ExpiresAt),
+			Conditions: canonicalConditions(res.Conditions),
+		})
+	}
+
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].ID != resources[j].ID {
+			return resources[i].ID < resources[j].ID
+		}
+
+		return resources[i].Conditions.key() < resources[j].Conditions.key()
+	})
+
+	return resources
+}
+
+// utcTime returns a copy of t in UTC, or nil if t is nil.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	out := t.UTC()
+
+	return &out
+}
+
+// canonicalConditions returns a copy of c with its times in UTC.
+func canonicalConditions(c *grantConditions) *grantConditions {
+	if c == nil {
+		return nil
+	}
+
+	return &grantConditions{
+		ValidAfter:  utcTime(c.ValidAfter),
+		ValidBefore: utcTime(c.ValidBefore),
+		Attributes:  c.Attributes,
+	}
+}
+
+func sortedUnique(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	out := make([]string, 0, len(values))
+
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+
+		seen[v] = struct{}{}
+
+		out = append(out, v)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/internal/lastseen"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxStaleSweepInterval is the longest time between sweeps for stale subjects.
+const maxStaleSweepInterval = time.Hour
+
+// subjectIDs returns the IDs of the subjects in p.
+func subjectIDs(p policy) []string {
+	out := make([]string, len(p.Subjects))
+	for i, sub := range p.Subjects {
+		out[i] = sub.ID
+	}
+
+	return out
+}
+
+// scheduleStaleSweep starts tracking the subjects of p, a policy made active at now, and starts
+// sweeping for stale subjects if it has not yet. The caller must hold updateMu or otherwise have
+// exclusive access to the server.
+func (s *server) scheduleStaleSweep(p policy, now time.Time) {
+	if s.lastSeen == nil {
+		return
+	}
+
+	s.lastSeen.Track(subjectIDs(p), now)
+
+	if s.staleTimer == nil {
+		s.staleTimer = time.AfterFunc(s.staleSweepInterval(), s.sweepStaleSubjects)
+	}
+}
+
+// staleSweepInterval returns how long to wait between sweeps for stale subjects, so subjects are
+// disabled within an interval of becoming stale.
+func (s *server) staleSweepInterval() time.Duration {
+	if s.staleAfter < maxStaleSweepInterval {
+		return s.staleAfter
+	}
+
+	return maxStaleSweepInterval
+}
+
+// sweepStaleSubjects disables the subjects of the active policy not seen for the stale-subject
+// period, publishing an event for each, saves when subjects were last seen, and schedules the next
+// sweep. Subjects no longer in the policy stop being tracked.
+func (s *server) sweepStaleSubjects() {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	st := s.state.Load()
+	now := s.now()
+	ids := subjectIDs(st.policy)
+
+	s.lastSeen.Track(ids, now)
+	s.lastSeen.Retain(ids)
+
+	for _, id := range ids {
+		if containsString(s.staleExempt, id) {
+			continue
+		}
+
+		rec, _ := s.lastSeen.Lookup(id)
+		if rec.Disabled() || now.Sub(rec.IdleSince()) < s.staleAfter {
+			continue
+		}
+
+		if _, err := s.lastSeen.Disable(id, now); err != nil {
+			// The subject is disabled on a later sweep; until then, it stays enabled.
+			s.logger.Errorw("failed to disable stale subject", "subject", id, "error", err)
+
+			continue
+		}
+
+		s.bus.Publish(events.SubjectDisabled{
+			Subject:   id,
+			LastSeen:  rec.LastSeen,
+			IdleSince: rec.IdleSince(),
+			Time:      now,
+		})
+	}
+
+	if err := s.lastSeen.Save(); err != nil {
+		s.logger.Errorw("failed to save subject last-seen times", "error", err)
+	}
+
+	// The sweep may have been run early, such as when the clock is advanced.
+	s.staleTimer.Stop()
+	s.staleTimer = time.AfterFunc(s.staleSweepInterval(), s.sweepStaleSubjects)
+}
+
+// checkSubjectEnabled returns a denial if the subject was disabled for being stale.
+func (s *server) checkSubjectEnabled(subjectID string) error {
+	if s.lastSeen == nil {
+		return nil
+	}
+
+	rec, ok := s.lastSeen.Lookup(subjectID)
+	if !ok || !rec.Disabled() {
+		return nil
+	}
+
+	return s.deny(codes.PermissionDenied, reasonSubjectDisabled,
+		"subject", subjectID,
+		"idle_since", rec.IdleSince().UTC().Format(time.RFC3339),
+	)
+}
+
+func (s *server) EnableSubject(ctx context.Context, req *admin.EnableSubjectRequest) (*admin.EnableSubjectResponse, error) {
+	s.logger.Infow("received EnableSubject request", "subject", req.SubjectId)
+
+	if err := s.requireAdminToken("enabling subjects"); err != nil {
+		return nil, err
+	}
+
+	if s.lastSeen == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "stale-subject expiry is not enabled")
+	}
+
+	if req.SubjectId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "subject_id is required")
+	}
+
+	if subjectIndex(s.state.Load().policy, req.SubjectId) < 0 {
+		return nil, status.Errorf(codes.NotFound, "subject %s not found", req.SubjectId)
+	}
+
+	var peerAddr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddr = p.Addr.String()
+	}
+
+	now := s.now()
+
+	rec, err := s.lastSeen.Enable(req.SubjectId, now)
+
+	switch {
+	case errors.Is(err, lastseen.ErrNotDisabled):
+		return nil, status.Errorf(codes.FailedPrecondition, "subject %s is not disabled", req.SubjectId)
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "enabling subject: %s", err)
+	}
+
+	s.bus.Publish(events.SubjectEnabled{
+		Subject:    req.SubjectId,
+		DisabledAt: *rec.DisabledAt,
+		Peer:       peerAddr,
+		Time:       now,
+	})
+
+	return &admin.EnableSubjectResponse{DisabledAt: timestamppb.New(*rec.DisabledAt)}, nil
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+)
+
+// DefaultRecentDecisions is the number of recent decisions kept if WithRecentDecisions is not
+// given.
+const DefaultRecentDecisions = 100
+
+// decisionStats counts decisions and keeps the most recent ones in a ring buffer.
+type decisionStats struct {
+	mu sync.Mutex
+
+	startedAt       time.Time
+	allowed         uint64
+	denied          uint64
+	deniedBySubject map[string]uint64
+
+	recent []events.DecisionMade
+	// size is the number of decisions kept in recent.
+	size int
+	// next is the index the next decision is written to once recent is full.
+	next int
+}
+
+// newDecisionStats returns stats keeping the given number of recent decisions, or
+// DefaultRecentDecisions if size is not positive.
+func newDecisionStats(size int) *decisionStats {
+	if size <= 0 {
+		size = DefaultRecentDecisions
+	}
+
+	return &decisionStats{
+		startedAt:       time.Now(),
+		deniedBySubject: make(map[string]uint64),
+		size:            size,
+	}
+}
+
+// handle records decision events. It implements events.Handler.
+func (d *decisionStats) handle(ev events.Event) {
+	decision, ok := ev.(events.DecisionMade)
+	if !ok {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if decision.Allowed {
+		d.allowed++
+	} else {
+		d.denied++
+		d.deniedBySubject[decision.Subject]++
+	}
+
+	if len(d.recent) < d.size {
+		d.recent = append(d.recent, decision)
+
+		return
+	}
+
+	d.recent[d.next] = decision
+	d.next = (d.next + 1) % d.size
+}
+
+// decisionStatsSnapshot is a consistent copy of decisionStats.
+type decisionStatsSnapshot struct {
+	startedAt       time.Time
+	allowed         uint64
+	denied          uint64
+	deniedBySubject map[string]uint64
+	// recent is ordered newest first.
+	recent []events.DecisionMade
+}
+
+// snapshot copies the stats, with up to maxRecent recent decisions, or all of them if maxRecent is
+// not positive.
+func (d *decisionStats) snapshot(maxRecent int) decisionStatsSnapshot {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := decisionStatsSnapshot{
+		startedAt:       d.startedAt,
+		allowed:         d.allowed,
+		denied:          d.denied,
+		deniedBySubject: make(map[string]uint64, len(d.deniedBySubject)),
+		recent:          d.recentLocked(maxRecent),
+	}
+
+	for sub, n := range d.deniedBySubject {
+		out.deniedBySubject[sub] = n
+	}
+
+	return out
+}
+
+// reset discards the counters and recent decisions.
+func (d *decisionStats) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.startedAt = time.Now()
+	d.allowed = 0
+	d.denied = 0
+	d.deniedBySubject = make(map[string]uint64)
+	d.recent = nil
+	d.next = 0
+}
+
+// recentDecisions returns up to max recent decisions, newest first, or all of them if max is not
+// positive.
+func (d *decisionStats) recentDecisions(max int) []events.DecisionMade {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.recentLocked(max)
+}
+
+func (d *decisionStats) recentLocked(max int) []events.DecisionMade {
+	n := len(d.recent)
+	if max > 0 && max < n {
+		n = max
+	}
+
+	out := make([]events.DecisionMade, 0, n)
+
+	// The oldest decision is at next once the buffer has wrapped, and at 0 before then.
+	for i := len(d.recent) - 1; len(out) < n; i-- {
+		out = append(out, d.recent[(d.next+i)%len(d.recent)])
+	}
+
+	return out
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
+
+// policyNames is the set of actions and resources declared anywhere in a policy. Names declared
+// by patterns are matched against the patterns.
+type policyNames struct {
+	actions   map[string]struct{}
+	resources map[string]struct{}
+
+	actionPatterns   []string
+	resourcePatterns []string
+}
+
+func (n *policyNames) hasAction(action string) bool {
+	_, ok := n.actions[action]
+
+	return ok || matchesAny(n.actionPatterns, action)
+}
+
+func (n *policyNames) hasResource(resourceID string) bool {
+	if _, ok := n.resources[resourceID]; ok || matchesAny(n.resourcePatterns, resourceID) {
+		return true
+	}
+
+	// A resource type in a parent is declared if the type or the parent is.
+	for _, id := range typeGrantResources(resourceID) {
+		if n.hasResource(id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// declaredNames returns every action and resource named by the policy's grants, roles,
+// delegations, on-call schedules, implications, resource containment, tenants, sensitive actions,
+// and deprecations, including grants that have expired or whose on-call windows are closed.
+func declaredNames(p policy) *policyNames {
+	out := &policyNames{
+		actions:   make(map[string]struct{}),
+		resources: make(map[string]struct{}),
+	}
+
+	addActions := func(actions []string) {
+		for _, action := range actions {
+			if _, ok := out.actions[action]; !ok && isPattern(action) {
+				out.actionPatterns = append(out.actionPatterns, action)
+			}
+
+			out.actions[action] = struct{}{}
+		}
+	}
+
+	addResources := func(resources []policyResource) {
+		for _, res := range resources {
+			if _, ok := out.resources[res.ID]; !ok && isPattern(res.ID) {
+				out.resourcePatterns = append(out.resourcePatterns, res.ID)
+			}
+
+			out.resources[res.ID] = struct{}{}
+
+			addActions(res.Actions)
+		}
+	}
+
+	addDenies := func(denies []policyDeny) {
+		for _, d := range denies {
+			addResources([]policyResource{{ID: d.ID, Actions: d.Actions}})
+		}
+	}
+
+	for _, role := range p.Roles {
+		addResources(role.Resources)
+		addDenies(role.Deny)
+	}
+
+	for _, sub := range p.Subjects {
+		addResources(sub.Resources)
+		addDenies(sub.Deny)
+
+		for _, del := range sub.Delegations {
+			addActions(del.Actions)
+		}
+	}
+
+	for _, o := range p.OnCall {
+		addResources(o.Resources)
+	}
+
+	for action, implied := range p.Implies {
+		out.actions[action] = struct{}{}
+
+		addActions(implied)
+	}
+
+	for parent, children := range p.Contains {
+		out.resources[parent] = struct{}{}
+
+		for _, child := range children {
+			out.resources[child] = struct{}{}
+		}
+	}
+
+	for _, resources := range p.Tenants {
+		for _, res := range resources {
+			out.resources[res] = struct{}{}
+		}
+	}
+
+	addActions(p.Sensitive)
+
+	for action := range p.Deprecated.Actions {
+		out.actions[action] = struct{}{}
+	}
+
+	for res := range p.Deprecated.Resources {
+		out.resources[res] = struct{}{}
+	}
+
+	return out
+}
+
+// checkUnknowns returns an InvalidArgument error describing every action and resource in actions
+// that the policy does not declare, or nil if the policy is not strict or all are declared.
+func (s *server) checkUnknowns(st *policyState, actions []*authorization.AccessRequestAction) error {
+	if st.declared == nil {
+		return nil
+	}
+
+	var (
+		violations []*errdetails.BadRequest_FieldViolation
+		unknown    []string
+	)
+
+	for i, action := range actions {
+		if !st.declared.hasAction(action.Action) {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("actions[%d].action", i),
+				Description: fmt.Sprintf("action '%s' is not declared in the policy", action.Action),
+			})
+
+			unknown = append(unknown, fmt.Sprintf("action '%s'", action.Action))
+		}
+
+		if !st.declared.hasResource(action.ResourceId) {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("actions[%d].resource_id", i),
+				Description: fmt.Sprintf("resource '%s' is not declared in the policy", action.ResourceId),
+			})
+
+			unknown = append(unknown, fmt.Sprintf("resource '%s'", action.ResourceId))
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	stat := s.denial(codes.InvalidArgument, reasonUndeclaredNames, "names", strings.Join(unknown, ", "))
+
+	withDetails, err := stat.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return stat.Err()
+	}
+
+	return withDetails.Err()
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"context"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/internal/metrics"
+)
+
+// publishDecision publishes a decision on a single action, annotated from the given policy state.
+// actorID is empty unless the request was delegated, and backends is empty unless authorization
+// backends are configured.
+func (s *server) publishDecision(ctx context.Context, st *policyState, subjectID, actorID, action, resourceID string, allowed bool, grants []grantRef, backends []events.BackendDecision) {
+	requestFrom(ctx).decide(allowed)
+
+	connSubject, _ := ConnectionSubject(ctx)
+
+	s.bus.Publish(events.DecisionMade{
+		Subject:             subjectID,
+		Actor:               actorID,
+		ConnectionSubject:   connSubject,
+		Action:              action,
+		ResourceID:          resourceID,
+		Allowed:             allowed,
+		RuleIDs:             ruleIDs(grants),
+		Grants:              matchedGrantEvents(grants),
+		Backends:            backends,
+		Sensitive:           containsString(st.policy.Sensitive, action),
+		ActionDeprecation:   st.policy.Deprecated.Actions[action],
+		ResourceDeprecation: st.policy.Deprecated.Resources[resourceID],
+		Metadata:            s.capturedMetadata(ctx),
+		Time:                s.now(),
+	})
+}
+
+// subscribeDefaults subscribes the server's built-in audit, metrics, and alert handlers.
+func (s *server) subscribeDefaults() {
+	s.bus.Subscribe(s.auditSubscriber)
+
+	if s.recordMetrics {
+		s.bus.Subscribe(metricsSubscriber)
+	}
+
+	s.bus.Subscribe(s.stats.handle)
+
+	if s.coverage != nil {
+		s.bus.Subscribe(s.coverage.handle)
+	}
+
+	if s.usage != nil {
+		s.bus.Subscribe(s.usage.handle)
+	}
+
+	if s.alerts != nil {
+		s.bus.Subscribe(alertSubscriber(s.alerts))
+	}
+
+	if s.audit != nil {
+		s.bus.Subscribe(s.audit.Handle)
+	}
+}
+
+// auditSubscriber logs events that deserve attention: uses of deprecated names, decisions on
+// sensitive actions, expired grants, disabled and enabled subjects, relationship writes, and
+// rejected or rolled back policy updates.
+func (s *server) auditSubscriber(ev events.Event) {
+	if rejected, ok := ev.(events.PolicyRejected); ok {
+		s.logger.Errorw("policy update rejected, keeping active policy",
+			"source", rejected.Source,
+			"revision", rejected.Revision,
+			"active_revision", rejected.ActiveRevision,
+			"reason", rejected.Reason,
+		)
+
+		return
+	}
+
+	if rollback, ok := ev.(events.PolicyRolledBack); ok {
+		s.logger.Warnw("policy rolled back",
+			"source", rollback.Source,
+			"revision", rollback.Revision,
+			"from_revision", rollback.FromRevision,
+			"requested_by", rollback.RequestedBy,
+			"peer", rollback.Peer,
+			"reason", rollback.Reason,
+		)
+
+		return
+	}
+
+	if rotated, ok := ev.(events.CredentialRotated); ok {
+		s.logger.Infow("credential rotated",
+			"subject", rotated.Subject,
+			"previous_expires_at", rotated.PreviousExpiresAt,
+		)
+
+		return
+	}
+
+	if changed, ok := ev.(events.RelationshipChanged); ok {
+		msg := "relationship created"
+		if changed.Deleted {
+			msg = "relationship deleted"
+		}
+
+		s.logger.Infow(msg,
+			"resource_id", changed.ResourceID,
+			"relation", changed.Relation,
+			"subject_id", changed.SubjectID,
+		)
+
+		return
+	}
+
+	if lapsed, ok := ev.(events.GrantExpired); ok {
+		s.logger.Infow("grant expired",
+			"subject", lapsed.Subject,
+			"role", lapsed.Role,
+			"resource_id", lapsed.ResourceID,
+			"actions", lapsed.Actions,
+			"expires_at", lapsed.ExpiresAt,
+		)
+
+		return
+	}
+
+	if disabled, ok := ev.(events.SubjectDisabled); ok {
+		s.logger.Warnw("disabled stale subject",
+			"subject", disabled.Subject,
+			"last_seen", disabled.LastSeen,
+			"idle_since", disabled.IdleSince,
+		)
+
+		return
+	}
+
+	if enabled, ok := ev.(events.SubjectEnabled); ok {
+		s.logger.Infow("subject enabled",
+			"subject", enabled.Subject,
+			"disabled_at", enabled.DisabledAt,
+			"peer", enabled.Peer,
+		)
+
+		return
+	}
+
+	if changed, ok := ev.(events.OnCallChanged); ok {
+		msg := "on-call window closed"
+		if changed.Open {
+			msg = "on-call window opened"
+		}
+
+		s.logger.Infow(msg,
+			"schedule", changed.Schedule,
+			"subjects", changed.Subjects,
+		)
+
+		return
+	}
+
+	decision, ok := ev.(events.DecisionMade)
+	if !ok {
+		return
+	}
+
+	md := metadataFields(decision.Metadata)
+
+	if decision.ActionDeprecation != "" {
+		s.logger.Warnw("deprecated action used", append([]any{"subject", decision.Subject, "action", decision.Action, "message", decision.ActionDeprecation}, md...)...)
+	}
+
+	if decision.ResourceDeprecation != "" {
+		s.logger.Warnw("deprecated resource used", append([]any{"subject", decision.Subject, "resource_id", decision.ResourceID, "message", decision.ResourceDeprecation}, md...)...)
+	}
+
+	if decision.Sensitive {
+		fields := []any{
+			"subject", decision.Subject,
+			"action", decision.Action,
+			"resource_id", decision.ResourceID,
+			"allowed", decision.Allowed,
+		}
+
+		if len(decision.RuleIDs) > 0 {
+			fields = append(fields, "rules", decision.RuleIDs)
+		}
+
+		if len(decision.Backends) > 0 {
+			fields = append(fields, "backends", decision.Backends)
+		}
+
+		if decision.Actor != "" {
+			fields = append(fields, "actor", decision.Actor)
+		}
+
+		if decision.ConnectionSubject != "" {
+			fields = append(fields, "connection_subject", decision.ConnectionSubject)
+		}
+
+		s.logger.Warnw("sensitive action checked", append(fields, md...)...)
+	}
+}
+
+// metricsSubscriber records policy and decision events as metrics.
+func metricsSubscriber(ev events.Event) {
+	switch ev := ev.(type) {
+	case events.PolicyLoaded:
+		metrics.SetPolicyInfo(ev.Source, ev.Revision)
+	case events.DecisionMade:
+		if ev.ActionDeprecation != "" {
+			metrics.RecordDeprecatedUsage(ev.Subject, metrics.DeprecationKindAction, ev.Action)
+		}
+
+		if ev.ResourceDeprecation != "" {
+			metrics.RecordDeprecatedUsage(ev.Subject, metrics.DeprecationKindResource, ev.ResourceID)
+		}
+	}
+}
+
+// matchedGrantEvents converts the grants matched by a decision for its event.
+func matchedGrantEvents(grants []grantRef) []events.MatchedGrant {
+	if len(grants) == 0 {
+		return nil
+	}
+
+	out := make([]events.MatchedGrant, len(grants))
+	for i, g := range grants {
+		out[i] = events.MatchedGrant(g)
+	}
+
+	return out
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+)
+
+// syntheticTenantSize is the number of resources each tenant of a synthetic policy contains.
+const syntheticTenantSize = 100
+
+// syntheticTypes are the resource types of a synthetic policy. Resources are assigned types in
+// turn.
+var syntheticTypes = []string{"loadbalancer", "pool", "member", "certificate", "network"}
+
+// syntheticVerbs are the actions granted on each resource type, as <type>_<verb>.
+var syntheticVerbs = []string{"get", "list", "create", "update", "delete"}
+
+// SyntheticOptions size a synthetic policy.
+type SyntheticOptions struct {
+	Subjects  int
+	Resources int
+	Roles     int
+	// Seed determines the policy: the same options always generate the same policy.
+	Seed int64
+}
+
+func (o SyntheticOptions) validate() error {
+	switch {
+	case o.Subjects < 1:
+		return fmt.Errorf("subjects must be at least 1, got %d: %w", o.Subjects, ErrInvalidValue)
+	case o.Resources < 1:
+		return fmt.Errorf("resources must be at least 1, got %d: %w", o.Resources, ErrInvalidValue)
+	case o.Roles < 0:
+		return fmt.Errorf("roles must not be negative, got %d: %w", o.Roles, ErrInvalidValue)
+	}
+
+	return nil
+}
+
+// SyntheticToken returns the token of a subject in a synthetic policy generated with seed. The
+// policy holds only the token's digest, so benchmarks derive tokens with this function.
+func SyntheticToken(seed int64, subjectID string) string {
+	return fmt.Sprintf("synthetic-%d-%s", seed, subjectID)
+}
+
+// SyntheticSubjectID returns the ID of the ith subject, counting from zero, of a synthetic policy
+// with n subjects.
+func SyntheticSubjectID(i, n int) string {
+	return fmt.Sprintf("subject-%0*d", digits(n-1), i)
+}
+
+// GenerateSynthetic writes a synthetic policy for benchmarking to w. Resources of several types
+// are grouped into tenants, which contain them; roles grant actions on a few tenants; and each
+// subject holds a few roles and direct grants on individual resources, and sometimes a grant on
+// a resource pattern. Updates and deletes imply gets. The output depends only on opts.
+func GenerateSynthetic(w io.Writer, opts SyntheticOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	return encodePolicy(w, syntheticPolicy(opts))
+}
+
+func syntheticPolicy(opts SyntheticOptions) policy {
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	resourceIDs := make([]string, opts.Resources)
+	for i := range resourceIDs {
+		resourceIDs[i] = fmt.Sprintf("%s-%0*d", syntheticTypes[i%len(syntheticTypes)], digits(opts.Resources-1), i)
+	}
+
+	tenants := (opts.Resources + syntheticTenantSize - 1) / syntheticTenantSize
+	tenantIDs := make([]string, tenants)
+
+	out := policy{
+		Implies:  make(map[string][]string),
+		Contains: make(map[string][]string, tenants),
+	}
+
+	for i := range tenantIDs {
+		tenantIDs[i] = fmt.Sprintf("tenant-%0*d", digits(tenants-1), i)
+
+		end := min((i+1)*syntheticTenantSize, opts.Resources)
+		out.Contains[tenantIDs[i]] = resourceIDs[i*syntheticTenantSize : end]
+	}
+
+	for _, typ := range syntheticTypes {
+		get := typ + "_get"
+		out.Implies[typ+"_update"] = []string{get}
+		out.Implies[typ+"_delete"] = []string{get}
+	}
+
+	roleIDs := make([]string, opts.Roles)
+
+	for i := range roleIDs {
+		roleIDs[i] = fmt.Sprintf("role-%0*d", digits(opts.Roles-1), i)
+
+		role := policyRole{ID: roleIDs[i]}
+
+		for _, tenant := range pick(rng, tenantIDs, 1+rng.Intn(3)) {
+			role.Resources = append(role.Resources, policyResource{
+				ID:      tenant,
+				Actions: syntheticActions(rng, syntheticTypes[rng.Intn(len(syntheticTypes))]),
+			})
+		}
+
+		out.Roles = append(out.Roles, role)
+	}
+
+	out.Subjects = make([]policySubject, opts.Subjects)
+
+	for i := range out.Subjects {
+		id := SyntheticSubjectID(i, opts.Subjects)
+		digest := digestToken(SyntheticToken(opts.Seed, id))
+
+		sub := policySubject{
+			ID:     id,
+			Tokens: []policyToken{{SHA256: hex.EncodeToString(digest[:])}},
+			Roles:  pick(rng, roleIDs, rng.Intn(min(3, len(roleIDs))+1)),
+		}
+
+		for _, idx := range sample(rng, opts.Resources, 5+rng.Intn(16)) {
+			sub.Resources = append(sub.Resources, policyResource{
+				ID:      resourceIDs[idx],
+				Actions: syntheticActions(rng, syntheticTypes[idx%len(syntheticTypes)]),
+			})
+		}
+
+		// Some subjects, such as automation, are granted every resource of a type.
+		if rng.Intn(20) == 0 {
+			typ := syntheticTypes[rng.Intn(len(syntheticTypes))]
+
+			sub.Resources = append(sub.Resources, policyResource{ID: typ + "-*", Actions: []string{typ + "_get", typ + "_list"}})
+		}
+
+		out.Subjects[i] = sub
+	}
+
+	return out
+}
+
+// syntheticActions returns a random, non-empty subset of the actions on a resource type, sorted.
+func syntheticActions(rng *rand.Rand, typ string) []string {
+	verbs := pick(rng, syntheticVerbs, 1+rng.Intn(len(syntheticVerbs)))
+
+	out := make([]string, len(verbs))
+	for i, verb := range verbs {
+		out[i] = typ + "_" + verb
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// pick returns n distinct elements of values chosen at random, in their order in values.
+func pick(rng *rand.Rand, values []string, n int) []string {
+	idx := sample(rng, len(values), n)
+
+	out := make([]string, len(idx))
+	for i, j := range idx {
+		out[i] = values[j]
+	}
+
+	return out
+}
+
+// sample returns up to k distinct integers in [0, n) chosen at random, sorted. It takes time
+// proportional to k, not n, when k is much smaller than n.
+func sample(rng *rand.Rand, n, k int) []int {
+	k = min(k, n)
+
+	var out []int
+
+	if 2*k > n {
+		out = rng.Perm(n)[:k]
+	} else {
+		seen := make(map[int]bool, k)
+
+		for len(out) < k {
+			if i := rng.Intn(n); !seen[i] {
+				seen[i] = true
+				out = append(out, i)
+			}
+		}
+	}
+
+	sort.Ints(out)
+
+	return out
+}
+
+// digits returns the number of decimal digits in n, which must not be negative.
+func digits(n int) int {
+	return len(fmt.Sprint(max(n, 0)))
+}
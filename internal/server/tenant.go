@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+)
+
+// tenantClaim is the claim AuthenticateSubject returns the tenant of a tenant-scoped subject in.
+const tenantClaim = "tenant"
+
+// validateTenants checks that tenants own resources by exact ID, that no resource belongs to
+// more than one tenant, directly or through a resource containing it, and that subjects are only
+// scoped to tenants the policy declares.
+func validateTenants(p policy) error {
+	for _, tenant := range sortedKeys(p.Tenants) {
+		if err := checkID("tenant ID", tenant); err != nil {
+			return fmt.Errorf("tenants: %w", err)
+		}
+
+		for _, id := range p.Tenants[tenant] {
+			if id == "" || isPattern(id) {
+				return fmt.Errorf("tenants: %s: resource ID '%s' must be an exact ID: %w", tenant, id, ErrInvalidValue)
+			}
+		}
+	}
+
+	if _, err := resourceTenants(p); err != nil {
+		return err
+	}
+
+	for _, sub := range p.Subjects {
+		if sub.Tenant == "" {
+			continue
+		}
+
+		if _, ok := p.Tenants[sub.Tenant]; !ok {
+			return fmt.Errorf("%s: tenant %s is not declared in tenants: %w", sub.ID, sub.Tenant, ErrInvalidValue)
+		}
+
+		if _, ok := sub.Claims[tenantClaim]; ok {
+			return fmt.Errorf("%s: claims: %s: claim is set by the runtime for tenant-scoped subjects: %w", sub.ID, tenantClaim, ErrInvalidValue)
+		}
+	}
+
+	return nil
+}
+
+// resourceTenants maps every resource a tenant owns, directly or through a resource containing
+// it, to the tenant. It returns an error if a resource belongs to more than one tenant.
+func resourceTenants(p policy) (map[string]string, error) {
+	if len(p.Tenants) == 0 {
+		return nil, nil
+	}
+
+	descendants := transitiveClosure(p.Contains)
+	out := make(map[string]string)
+
+	for _, tenant := range sortedKeys(p.Tenants) {
+		for _, id := range p.Tenants[tenant] {
+			for _, res := range append([]string{id}, descendants[id]...) {
+				if owner, ok := out[res]; ok && owner != tenant {
+					return nil, fmt.Errorf("tenants: resource %s belongs to both %s and %s: %w", res, owner, tenant, ErrInvalidValue)
+				}
+
+				out[res] = tenant
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// tenantResources inverts a table of resource tenants, mapping each tenant to every resource it
+// owns, sorted.
+func tenantResources(tenants map[string]string) map[string][]string {
+	if len(tenants) == 0 {
+		return nil
+	}
+
+	out := make(map[string][]string)
+
+	for res, tenant := range tenants {
+		out[tenant] = append(out[tenant], res)
+	}
+
+	for _, resources := range out {
+		sort.Strings(resources)
+	}
+
+	return out
+}
+
+// crossTenant reports whether sub is scoped to a tenant and the resource belongs to another, and
+// returns the resource's tenant. A resource type in a parent belongs to the parent's tenant.
+func crossTenant(tenants map[string]string, sub policySubject, resourceID string) (string, bool) {
+	if sub.Tenant == "" {
+		return "", false
+	}
+
+	owner, ok := tenants[typeResourceParent(resourceID)]
+
+	return owner, ok && owner != sub.Tenant
+}
+
+// checkTenants returns a PermissionDenied error describing every action in req on a resource of
+// another tenant than one of the scoped subjects', or nil if there are none. The denied actions
+// are published as decisions for subjectID, acting through actorID if set.
+func (s *server) checkTenants(ctx context.Context, st *policyState, req *authorization.CheckAccessRequest, subjectID, actorID string, scoped ...policySubject) error {
+	if len(st.tenants) == 0 {
+		return nil
+	}
+
+	type violation struct {
+		subject policySubject
+		owner   string
+	}
+
+	var (
+		denied     []int
+		violations map[*authorization.AccessRequestAction]violation
+	)
+
+	for i, action := range req.Actions {
+		for _, sub := range scoped {
+			owner, cross := crossTenant(st.tenants, sub, action.ResourceId)
+			if !cross {
+				continue
+			}
+
+			if violations == nil {
+				violations = make(map[*authorization.AccessRequestAction]violation)
+			}
+
+			denied = append(denied, i)
+			violations[action] = violation{subject: sub, owner: owner}
+
+			s.publishDecision(ctx, st, subjectID, actorID, action.Action, action.ResourceId, false, nil, nil)
+
+			break
+		}
+	}
+
+	if len(denied) == 0 {
+		return nil
+	}
+
+	s.logger.Warnw("denied cross-tenant access check", "subject", subjectID, "actor", actorID, "denied", deniedPairs(req, denied), "actions", len(req.Actions))
+
+	return s.denyActions(reasonCrossTenant, req, denied, func(action *authorization.AccessRequestAction) []string {
+		v := violations[action]
+
+		return []string{
+			"subject", v.subject.ID,
+			"tenant", v.subject.Tenant,
+			"action", action.Action,
+			"resource_id", action.ResourceId,
+			"resource_tenant", v.owner,
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// tokenDigest is the SHA-256 digest of a token.
+type tokenDigest [sha256.Size]byte
+
+func digestToken(value string) tokenDigest {
+	return sha256.Sum256([]byte(value))
+}
+
+// ref returns where the token comes from, for errors: its environment variable, its file, or its
+// digest. It never includes the token itself. Commands may carry secrets in their arguments, so a
+// command token is identified by index, its position among the subject's tokens, as exec #n,
+// numbered from 1.
+func (t policyToken) ref(index int) string {
+	switch {
+	case t.File != "":
+		return t.File
+	case t.SHA256 != "":
+		return t.SHA256
+	case t.Exec != "":
+		return fmt.Sprintf("exec #%d", index+1)
+	default:
+		return t.EnvVar
+	}
+}
+
+// validate checks that the token has exactly one source and that it is well formed. index is the
+// token's position among the subject's tokens.
+func (t policyToken) validate(index int) error {
+	sources := 0
+
+	for _, source := range []string{t.EnvVar, t.File, t.SHA256, t.Exec} {
+		if source != "" {
+			sources++
+		}
+	}
+
+	if sources != 1 {
+		return fmt.Errorf("a token must set exactly one of envVar, file, sha256, and exec: %w", ErrInvalidValue)
+	}
+
+	switch {
+	case t.File != "":
+		return checkID("token file", t.File)
+	case t.Exec != "":
+		// checkID would include the command.
+		if strings.TrimSpace(t.Exec) != t.Exec || strings.IndexFunc(t.Exec, unicode.IsControl) >= 0 {
+			return fmt.Errorf("%s: token command has surrounding whitespace or control characters: %w", t.ref(index), ErrInvalidValue)
+		}
+
+		return nil
+	case t.SHA256 != "":
+		if _, ok := t.digest(); !ok {
+			return fmt.Errorf("%s: sha256 must be a hex-encoded SHA-256 digest: %w", t.SHA256, ErrInvalidValue)
+		}
+
+		return nil
+	default:
+		return checkID("token variable", t.EnvVar)
+	}
+}
+
+// digest returns the digest of a hashed token. It reports false for tokens stored elsewhere.
+func (t policyToken) digest() (tokenDigest, bool) {
+	var out tokenDigest
+
+	b, err := hex.DecodeString(t.SHA256)
+	if err != nil || len(b) != len(out) {
+		return out, false
+	}
+
+	copy(out[:], b)
+
+	return out, true
+}
+
+// resolveToken returns the value of a token read from its environment variable, using getenv, its
+// file, or the output of its command, run with commands, ignoring trailing newlines. The value is
+// empty if the variable is not set or the file or output is empty. Hashed tokens have no value.
+// Command tokens fail with ErrTokenCommandsDisabled if commands is nil.
+func resolveToken(tok policyToken, getenv func(key string) string, commands *tokenCommands) (string, error) {
+	switch {
+	case tok.SHA256 != "":
+		return "", nil
+	case tok.Exec != "":
+		if commands == nil {
+			return "", ErrTokenCommandsDisabled
+		}
+
+		return commands.run(tok.Exec, getenv)
+	case tok.File != "":
+		b, err := os.ReadFile(tok.File)
+		if err != nil {
+			return "", fmt.Errorf("reading token file: %w", err)
+		}
+
+		return strings.TrimRight(string(b), "\r\n"), nil
+	default:
+		return getenv(tok.EnvVar), nil
+	}
+}
+
+// lookupToken returns the subject a policy token authenticates. Hashed tokens are matched by the
+// digest of the credential.
+func (st *policyState) lookupToken(credential string) (policySubject, bool) {
+	if sub, ok := st.tokens[credential]; ok {
+		return sub, true
+	}
+
+	if len(st.tokenDigests) == 0 {
+		return policySubject{}, false
+	}
+
+	sub, ok := st.tokenDigests[digestToken(credential)]
+
+	return sub, ok
+}
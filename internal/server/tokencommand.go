@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// defaultTokenCommandTimeout bounds a token command when no timeout is configured.
+const defaultTokenCommandTimeout = 10 * time.Second
+
+// maxTokenCommandOutput is the most a token command may print, on stdout or stderr.
+const maxTokenCommandOutput = 64 << 10
+
+// defaultTokenCommandEnv are the environment variables passed to token commands when none are
+// configured.
+var defaultTokenCommandEnv = []string{"PATH", "HOME"}
+
+// errTokenCommandOutput is returned by writes past maxTokenCommandOutput.
+var errTokenCommandOutput = errors.New("token command output is too large")
+
+// tokenCommands runs the commands printing policy tokens.
+type tokenCommands struct {
+	timeout time.Duration
+	// Names of the environment variables commands are given; others are not
+	env []string
+	// Working directory of commands, or the runtime's if empty
+	dir string
+}
+
+// run runs command with sh -c and returns what it printed, ignoring trailing newlines. Commands
+// are given only the configured environment variables, read with getenv.
+func (c *tokenCommands) run(command string, getenv func(key string) string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	var stdout, stderr limitedBuffer
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = c.dir
+	cmd.Env = []string{}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Do not wait on children left holding stdout once the command is killed.
+	cmd.WaitDelay = time.Second
+
+	for _, name := range c.env {
+		if value := getenv(name); value != "" {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+
+	if err := cmd.Run(); err != nil {
+		switch {
+		case stdout.exceeded:
+			err = fmt.Errorf("%w: more than %d bytes", errTokenCommandOutput, maxTokenCommandOutput)
+		case ctx.Err() != nil:
+			err = fmt.Errorf("timed out after %s", c.timeout)
+		}
+
+		return "", fmt.Errorf("running token command: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// limitedBuffer is a buffer failing writes past maxTokenCommandOutput, which stops the command's
+// output from being read. The buffer is not embedded, so io.Copy cannot bypass Write with its
+// ReadFrom.
+type limitedBuffer struct {
+	buf bytes.Buffer
+	// Whether a write failed
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > maxTokenCommandOutput {
+		b.exceeded = true
+
+		return 0, errTokenCommandOutput
+	}
+
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
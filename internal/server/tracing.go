@@ -0,0 +1,34 @@
+package server
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+// tracer records spans around authentication and policy evaluation. Spans are dropped unless a
+// tracer provider is installed, as by tracing.Start.
+var tracer = otel.Tracer("github.com/metal-toolbox/iam-runtime-static")
+
+// Span attributes. Credentials are never recorded.
+const (
+	attrSubject = attribute.Key("iam.subject")
+	attrActor   = attribute.Key("iam.actor")
+	attrActions = attribute.Key("iam.actions")
+	attrDenied  = attribute.Key("iam.denied")
+
+	attrAction     = attribute.Key("iam.action")
+	attrResourceID = attribute.Key("iam.resource_id")
+	attrBackends   = attribute.Key("iam.backends")
+)
+
+// endSpan marks span as failed with the status code of err, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(otelcodes.Error, status.Code(err).String())
+	}
+
+	span.End()
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/events"
+	"github.com/metal-toolbox/iam-runtime-static/internal/lastseen"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/admin"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// usageCounts counts the requests of a subject.
+type usageCounts struct {
+	requests uint64
+	allowed  uint64
+	denied   uint64
+	lastSeen time.Time
+}
+
+// subjectUsage counts the requests each subject makes and when it was last seen.
+type subjectUsage struct {
+	mu sync.Mutex
+
+	since    time.Time
+	subjects map[string]usageCounts
+}
+
+func newSubjectUsage() *subjectUsage {
+	return &subjectUsage{
+		since:    time.Now(),
+		subjects: make(map[string]usageCounts),
+	}
+}
+
+// authenticated records a request the subject was authenticated for.
+func (u *subjectUsage) authenticated(subjectID string, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	c := u.subjects[subjectID]
+	c.requests++
+	c.lastSeen = now
+	u.subjects[subjectID] = c
+}
+
+// handle records the checked actions of decisions. It implements events.Handler.
+func (u *subjectUsage) handle(ev events.Event) {
+	decision, ok := ev.(events.DecisionMade)
+	if !ok {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	c := u.subjects[decision.Subject]
+
+	if decision.Allowed {
+		c.allowed++
+	} else {
+		c.denied++
+	}
+
+	if decision.Time.After(c.lastSeen) {
+		c.lastSeen = decision.Time
+	}
+
+	u.subjects[decision.Subject] = c
+}
+
+// report returns the counters of every subject in p, and resets all counters if reset is set.
+// Counters of subjects no longer in the policy are not reported.
+func (u *subjectUsage) report(p policy, reset bool) (time.Time, map[string]usageCounts) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	since := u.since
+
+	out := make(map[string]usageCounts, len(p.Subjects))
+	for _, sub := range p.Subjects {
+		out[sub.ID] = u.subjects[sub.ID]
+	}
+
+	if reset {
+		u.resetLocked()
+	}
+
+	return since, out
+}
+
+// reset discards the recorded usage.
+func (u *subjectUsage) reset() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.resetLocked()
+}
+
+func (u *subjectUsage) resetLocked() {
+	u.since = time.Now()
+	u.subjects = make(map[string]usageCounts)
+}
+
+func (s *server) GetSubjectUsage(_ context.Context, req *admin.GetSubjectUsageRequest) (*admin.GetSubjectUsageResponse, error) {
+	s.logger.Info("received GetSubjectUsage request")
+
+	if s.usage == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "subject usage is not enabled")
+	}
+
+	if req.ResetCounters {
+		if err := s.requireAdminToken("resetting counters"); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.IdleFor != nil && req.IdleFor.AsDuration() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "idle_for is negative")
+	}
+
+	st := s.state.Load()
+	now := s.now()
+
+	since, counts := s.usage.report(st.policy, req.ResetCounters)
+
+	subjects := append([]policySubject(nil), st.policy.Subjects...)
+	sort.SliceStable(subjects, func(i, j int) bool { return subjects[i].ID < subjects[j].ID })
+
+	resp := &admin.GetSubjectUsageResponse{
+		Since: timestamppb.New(since),
+		Total: uint32(len(subjects)),
+	}
+
+	for _, sub := range subjects {
+		c := counts[sub.ID]
+		seen := !c.lastSeen.IsZero()
+
+		if seen {
+			resp.Seen++
+		}
+
+		// With stale-subject expiry, subjects are idle from when they were last seen or tracked,
+		// across restarts and resets.
+		idleSince := c.lastSeen
+
+		var rec lastseen.Record
+		if s.lastSeen != nil {
+			rec, _ = s.lastSeen.Lookup(sub.ID)
+			if !rec.Tracked.IsZero() {
+				idleSince = rec.IdleSince()
+			}
+		}
+
+		if req.IdleFor != nil && !idleSince.IsZero() && now.Sub(idleSince) < req.IdleFor.AsDuration() {
+			continue
+		}
+
+		u := &admin.SubjectUsage{
+			Subject:  sub.ID,
+			Requests: c.requests,
+			Allowed:  c.allowed,
+			Denied:   c.denied,
+			Tokens:   uint32(len(sub.Tokens)),
+		}
+
+		if seen {
+			u.LastSeen = timestamppb.New(c.lastSeen)
+		}
+
+		if !rec.Tracked.IsZero() {
+			u.IdleSince = timestamppb.New(rec.IdleSince())
+		}
+
+		if rec.DisabledAt != nil {
+			u.DisabledAt = timestamppb.New(*rec.DisabledAt)
+		}
+
+		resp.Subjects = append(resp.Subjects, u)
+	}
+
+	return resp, nil
+}
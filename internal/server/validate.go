@@ -0,0 +1,391 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/policycrypt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severities of validation diagnostics.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic describes a problem found while validating a policy.
+type Diagnostic struct {
+	Path string `json:"path"`
+	// Line is the 1-based line the problem was found on, or 0 if it is not known.
+	Line     int    `json:"line,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// PolicySummary counts what a policy defines.
+type PolicySummary struct {
+	Subjects int `json:"subjects"`
+	// Roles counts role versions.
+	Roles int `json:"roles"`
+	// Resources counts the distinct resource IDs and patterns granted to subjects, including
+	// through roles and containing resources.
+	Resources int `json:"resources"`
+	Tokens    int `json:"tokens"`
+	// TokensSet counts the tokens that resolve to a value: hashed tokens, tokens whose environment
+	// variables are set, and tokens whose files can be read. Command tokens, which are not run,
+	// are counted as set.
+	TokensSet int `json:"tokensSet"`
+}
+
+// Summarize reads the policy at policyPath, applies any overlays, and counts what it defines.
+// Files are read with read, or only plaintext policies are accepted if read is nil.
+func Summarize(policyPath string, overlayPaths []string, read ReadFileFunc) (PolicySummary, error) {
+	p, err := readPolicyFiles(readerOrDefault(read), policyPath, overlayPaths...)
+	if err != nil {
+		return PolicySummary{}, err
+	}
+
+	compiled, err := compileSubjects(p)
+	if err != nil {
+		return PolicySummary{}, err
+	}
+
+	out := PolicySummary{Subjects: len(compiled), Roles: len(p.Roles)}
+	resources := make(map[string]struct{})
+
+	for _, sub := range compiled {
+		for _, res := range sub.Resources {
+			resources[res.ID] = struct{}{}
+		}
+
+		for _, tok := range sub.Tokens {
+			out.Tokens++
+
+			// Commands are only run by the runtime.
+			if _, hashed := tok.digest(); hashed || tok.Exec != "" {
+				out.TokensSet++
+			} else if value, _ := resolveToken(tok, os.Getenv, nil); value != "" {
+				out.TokensSet++
+			}
+		}
+	}
+
+	out.Resources = len(resources)
+
+	return out, nil
+}
+
+// String formats the diagnostic as path:line: severity: message.
+func (d Diagnostic) String() string {
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", d.Path, d.Severity, d.Message)
+	}
+
+	return fmt.Sprintf("%s:%d: %s: %s", d.Path, d.Line, d.Severity, d.Message)
+}
+
+// ReadFileFunc reads the contents of a policy file.
+type ReadFileFunc func(path string) ([]byte, error)
+
+// readerOrDefault returns read, or if it is nil, a reader that rejects encrypted policies.
+func readerOrDefault(read ReadFileFunc) ReadFileFunc {
+	if read != nil {
+		return read
+	}
+
+	return new(policycrypt.Decrypter).ReadFile
+}
+
+// yamlLinePattern matches the line numbers in YAML syntax and type errors.
+var yamlLinePattern = regexp.MustCompile(`line (\d+): (.*)`)
+
+// policyDocument is a policy file along with its YAML node tree, used to locate problems.
+type policyDocument struct {
+	path string
+	root yaml.Node
+}
+
+// Validate checks the policy at policyPath with the given overlays applied and returns the
+// problems found, or nil if the policy is valid. If policyPath is a directory, its policy files are
+// merged into the base policy. Files are read with read, which must decrypt encrypted policies; if
+// read is nil, only plaintext policies can be read. Tokens whose environment variables are not set
+// or whose files cannot be read are reported as warnings, since policies are often validated
+// without them.
+func Validate(policyPath string, overlayPaths []string, read ReadFileFunc) []Diagnostic {
+	read = readerOrDefault(read)
+
+	base, docs, diags := readBaseDocuments(policyPath, read)
+	if diags != nil {
+		return diags
+	}
+
+	for _, path := range overlayPaths {
+		overlay, doc, diags := readPolicyDocument(path, read)
+		if diags != nil {
+			return diags
+		}
+
+		docs = append(docs, doc)
+
+		var err error
+
+		base, err = applyOverlay(base, overlay)
+		if err != nil {
+			return []Diagnostic{locate(err, doc)}
+		}
+	}
+
+	compiled, err := compileSubjects(base)
+	if err != nil {
+		return []Diagnostic{locate(err, docs...)}
+	}
+
+	var out []Diagnostic
+
+	owners := make(map[tokenDigest]string)
+
+	for _, sub := range compiled {
+		for i, tok := range sub.Tokens {
+			// Commands are only run by the runtime, so their tokens cannot be checked here.
+			if tok.Exec != "" {
+				continue
+			}
+
+			digest, hashed := tok.digest()
+
+			if !hashed {
+				value, err := resolveToken(tok, os.Getenv, nil)
+				if value == "" {
+					d := locate(unsetTokenError(tok, sub.ID, err), docs...)
+					d.Severity = SeverityWarning
+					out = append(out, d)
+
+					continue
+				}
+
+				digest = digestToken(value)
+			}
+
+			if owner, ok := owners[digest]; ok {
+				out = append(out, locate(fmt.Errorf("%s: subject %s has the same token as %s: %w", tok.ref(i), sub.ID, owner, ErrDuplicateValue), docs...))
+
+				continue
+			}
+
+			owners[digest] = sub.ID
+		}
+
+		for _, client := range sub.Clients {
+			if os.Getenv(client.SecretEnvVar) == "" {
+				d := locate(fmt.Errorf("%s: secret environment variable for client %s of subject %s is not set", client.SecretEnvVar, client.ID, sub.ID), docs...)
+				d.Severity = SeverityWarning
+				out = append(out, d)
+			}
+		}
+	}
+
+	return out
+}
+
+// unsetTokenError describes why a token has no value, given the error resolving it, if any.
+func unsetTokenError(tok policyToken, subjectID string, err error) error {
+	switch {
+	case tok.File != "" && err != nil:
+		return fmt.Errorf("%s: token file for subject %s cannot be read: %w", tok.File, subjectID, err)
+	case tok.File != "":
+		return fmt.Errorf("%s: token file for subject %s is empty", tok.File, subjectID)
+	default:
+		return fmt.Errorf("%s: token environment variable for subject %s is not set", tok.EnvVar, subjectID)
+	}
+}
+
+// readBaseDocuments reads the base policy at path, merging the policy files in it if it is a
+// directory, and returns it with the documents it was read from.
+func readBaseDocuments(path string, read ReadFileFunc) (policy, []*policyDocument, []Diagnostic) {
+	paths := []string{path}
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		files, err := PolicyDirFiles(path)
+		if err != nil {
+			return policy{}, nil, []Diagnostic{{Path: path, Severity: SeverityError, Message: err.Error()}}
+		}
+
+		paths = files
+	}
+
+	policies := make([]policy, 0, len(paths))
+	docs := make([]*policyDocument, 0, len(paths))
+
+	for _, path := range paths {
+		p, doc, diags := readPolicyDocument(path, read)
+		if diags != nil {
+			return policy{}, nil, diags
+		}
+
+		if err := checkNoPatchMarkers(p); err != nil {
+			return policy{}, nil, []Diagnostic{locate(err, doc)}
+		}
+
+		policies = append(policies, p)
+		docs = append(docs, doc)
+	}
+
+	if len(policies) == 1 {
+		return policies[0], docs, nil
+	}
+
+	merged, err := mergePolicyFiles(paths, policies)
+	if err != nil {
+		// A conflict is introduced by the later of the files involved, so look there first.
+		reversed := make([]*policyDocument, 0, len(docs))
+
+		for i := len(docs) - 1; i >= 0; i-- {
+			reversed = append(reversed, docs[i])
+		}
+
+		return policy{}, nil, []Diagnostic{locate(err, reversed...)}
+	}
+
+	return merged, docs, nil
+}
+
+func readPolicyDocument(path string, read ReadFileFunc) (policy, *policyDocument, []Diagnostic) {
+	b, err := read(path)
+	if err != nil {
+		return policy{}, nil, []Diagnostic{{Path: path, Severity: SeverityError, Message: err.Error()}}
+	}
+
+	p, err := readPolicy(bytes.NewReader(b))
+	if err != nil {
+		return policy{}, nil, syntaxDiagnostics(path, err)
+	}
+
+	doc := &policyDocument{path: path}
+
+	// The document already decoded, so this cannot fail.
+	_ = yaml.Unmarshal(b, &doc.root)
+
+	return p, doc, nil
+}
+
+// syntaxDiagnostics splits a YAML error into a diagnostic per reported line.
+func syntaxDiagnostics(path string, err error) []Diagnostic {
+	matches := yamlLinePattern.FindAllStringSubmatch(err.Error(), -1)
+	if len(matches) == 0 {
+		return []Diagnostic{{Path: path, Severity: SeverityError, Message: err.Error()}}
+	}
+
+	out := make([]Diagnostic, 0, len(matches))
+
+	for _, m := range matches {
+		line, _ := strconv.Atoi(m[1])
+
+		out = append(out, Diagnostic{
+			Path:     path,
+			Line:     line,
+			Severity: SeverityError,
+			Message:  m[2],
+		})
+	}
+
+	return out
+}
+
+// locate returns an error diagnostic for err. Policy errors are prefixed with the IDs of the
+// subjects, roles, resources, or tokens they concern, from outermost to innermost, so the
+// diagnostic is placed on the first line in docs where the innermost ID that can be found appears
+// as a value. If none is found, the diagnostic is placed on the first document with no line.
+func locate(err error, docs ...*policyDocument) Diagnostic {
+	msg := err.Error()
+	parts := strings.Split(msg, ": ")
+
+	for i := len(parts) - 2; i >= 0; i-- {
+		// Role references are reported as "role id@version".
+		key := strings.TrimPrefix(parts[i], "role ")
+
+		for _, doc := range docs {
+			if line := findValueLine(&doc.root, key); line > 0 {
+				return Diagnostic{Path: doc.path, Line: line, Severity: SeverityError, Message: msg}
+			}
+		}
+	}
+
+	return Diagnostic{Path: docs[0].path, Severity: SeverityError, Message: msg}
+}
+
+// LocatePolicyError returns where the problem reported by err, an error loading the policy
+// document data, is: the path of the field it concerns, such as subjects[1].id, and its 1-based
+// line. YAML syntax and type errors have a line but no path. Either is empty if it is not known.
+// Problems are placed as Validate places them.
+func LocatePolicyError(data []byte, err error) (string, int) {
+	if m := yamlLinePattern.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+
+		return "", line
+	}
+
+	var root yaml.Node
+	if yaml.Unmarshal(data, &root) != nil {
+		return "", 0
+	}
+
+	parts := strings.Split(err.Error(), ": ")
+
+	for i := len(parts) - 2; i >= 0; i-- {
+		if path, line := findValuePath(&root, strings.TrimPrefix(parts[i], "role "), ""); line > 0 {
+			return path, line
+		}
+	}
+
+	return "", 0
+}
+
+// findValueLine returns the line of the first scalar value equal to value, or 0.
+func findValueLine(n *yaml.Node, value string) int {
+	_, line := findValuePath(n, value, "")
+
+	return line
+}
+
+// findValuePath returns the path and line of the first scalar value equal to value in n, whose
+// path is prefix, or 0 for the line if there is none.
+func findValuePath(n *yaml.Node, value, prefix string) (string, int) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, child := range n.Content {
+			if path, line := findValuePath(child, value, prefix); line > 0 {
+				return path, line
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range n.Content {
+			if path, line := findValuePath(child, value, fmt.Sprintf("%s[%d]", prefix, i)); line > 0 {
+				return path, line
+			}
+		}
+	case yaml.MappingNode:
+		// Content alternates keys and values; only values are considered.
+		for i := 1; i < len(n.Content); i += 2 {
+			key := n.Content[i-1].Value
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+
+			if path, line := findValuePath(n.Content[i], value, key); line > 0 {
+				return path, line
+			}
+		}
+	case yaml.ScalarNode:
+		if n.Value == value {
+			return prefix, n.Line
+		}
+	}
+
+	return "", 0
+}
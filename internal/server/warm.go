@@ -0,0 +1,110 @@
+package server
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExpectedRequest is an access check the runtime expects to see and allow.
+type ExpectedRequest struct {
+	Subject  string `yaml:"subject" json:"subject"`
+	Action   string `yaml:"action" json:"action"`
+	Resource string `yaml:"resource" json:"resource"`
+}
+
+// ReadExpectedTraffic reads the expected requests from a YAML or JSON file holding a list of them.
+func ReadExpectedTraffic(path string) ([]ExpectedRequest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []ExpectedRequest
+	if err := yaml.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i, req := range out {
+		if req.Subject == "" || req.Action == "" || req.Resource == "" {
+			return nil, fmt.Errorf("%s: request %d: subject, action, and resource are required: %w", path, i, ErrMissingValue)
+		}
+	}
+
+	return out, nil
+}
+
+// warmKey identifies a warmed decision.
+type warmKey struct {
+	subjectID  string
+	action     string
+	resourceID string
+}
+
+// warmDecision is the decision of the policy's grants on an expected request, without
+// relationships, which change independently of the policy.
+type warmDecision struct {
+	allowed bool
+	grants  []grantRef
+}
+
+// warmDecisions evaluates the expected requests against the given subjects, returning the
+// decisions and the requests that would be denied. Requests naming unknown subjects, or resources
+// of another tenant than the subject's, are denied.
+func warmDecisions(subjects map[string]policySubject, tenants map[string]string, expected []ExpectedRequest) (map[warmKey]warmDecision, []ExpectedRequest) {
+	if len(expected) == 0 {
+		return nil, nil
+	}
+
+	var (
+		out    = make(map[warmKey]warmDecision, len(expected))
+		denied []ExpectedRequest
+	)
+
+	for _, req := range expected {
+		sub, ok := subjects[req.Subject]
+		if !ok {
+			denied = append(denied, req)
+
+			continue
+		}
+
+		_, cross := crossTenant(tenants, sub, req.Resource)
+
+		d := warmDecision{allowed: !cross && checkAccess(sub, req.Action, req.Resource)}
+		if d.allowed {
+			d.grants = matchedGrants(sub, req.Action, req.Resource)
+		} else {
+			denied = append(denied, req)
+		}
+
+		out[warmKey{subjectID: sub.ID, action: req.Action, resourceID: req.Resource}] = d
+	}
+
+	return out, denied
+}
+
+// checkExpectedTraffic reports the expected requests the given policy state would deny. If
+// expected requests are required to be allowed, it returns an error wrapping ErrPolicyRejected
+// when any would be denied.
+func (s *server) checkExpectedTraffic(st *policyState, source string) error {
+	if len(s.expectedTraffic) == 0 {
+		return nil
+	}
+
+	for _, req := range st.expectedDenials {
+		s.logger.Warnw("expected request would be denied", "source", source, "subject", req.Subject, "action", req.Action, "resource_id", req.Resource)
+	}
+
+	s.logger.Infow("warmed decisions for expected traffic", "source", source, "expected", len(s.expectedTraffic), "denied", len(st.expectedDenials))
+
+	if !s.requireExpectedAllowed || len(st.expectedDenials) == 0 {
+		return nil
+	}
+
+	first := st.expectedDenials[0]
+
+	return fmt.Errorf("%d of %d expected requests would be denied, including %s on %s for %s: %w",
+		len(st.expectedDenials), len(s.expectedTraffic), first.Action, first.Resource, first.Subject, ErrPolicyRejected)
+}
@@ -0,0 +1,56 @@
+// Package tracing exports traces of the runtime's RPCs to an OpenTelemetry collector. Trace
+// context propagated by callers is continued, so the runtime's spans appear in their traces.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// Config configures exporting traces to an OpenTelemetry collector.
+type Config struct {
+	// Endpoint is the collector's host:port. If empty, the OTEL_EXPORTER_OTLP_* environment
+	// variables are used.
+	Endpoint string
+	// Insecure disables TLS to the collector.
+	Insecure bool
+	// SampleRatio is the fraction of traces started by the runtime that are sampled. Spans in
+	// traces propagated by callers follow the caller's sampling decision.
+	SampleRatio float64
+}
+
+// Start installs a tracer provider exporting spans over OTLP/gRPC, and the W3C trace context and
+// baggage propagators. The returned function flushes and stops the exporter.
+func Start(ctx context.Context, cfg Config, serviceName string) (func(context.Context) error, error) {
+	var opts []otlptracegrpc.Option
+
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+	}
+
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,91 @@
+// Package zstd implements and registers a zstd compressor for gRPC.
+//
+// Importing this package registers the compressor with the grpc encoding registry, after which
+// clients may request zstd-compressed messages using the "zstd" content coding.
+package zstd
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// Name is the name registered for the zstd compressor.
+const Name = "zstd"
+
+func init() {
+	encoding.RegisterCompressor(&compressor{})
+}
+
+type writer struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+// Close flushes the encoder and returns it to the pool.
+func (w *writer) Close() error {
+	defer w.pool.Put(w)
+
+	return w.Encoder.Close()
+}
+
+type reader struct {
+	*zstd.Decoder
+	pool     *sync.Pool
+	released bool
+}
+
+// Read reads decompressed data and returns the decoder to the pool once the stream is exhausted.
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.Decoder.Read(p)
+	if err == io.EOF && !r.released {
+		r.released = true
+		r.pool.Put(r)
+	}
+
+	return n, err
+}
+
+type compressor struct {
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+func (c *compressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	if z, ok := c.encoders.Get().(*writer); ok {
+		z.Encoder.Reset(w)
+		return z, nil
+	}
+
+	enc, err := zstd.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+
+	return &writer{Encoder: enc, pool: &c.encoders}, nil
+}
+
+func (c *compressor) Decompress(r io.Reader) (io.Reader, error) {
+	if z, ok := c.decoders.Get().(*reader); ok {
+		if err := z.Decoder.Reset(r); err != nil {
+			return nil, err
+		}
+
+		z.released = false
+
+		return z, nil
+	}
+
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+
+	return &reader{Decoder: dec, pool: &c.decoders}, nil
+}
+
+func (c *compressor) Name() string {
+	return Name
+}
@@ -0,0 +1,920 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: admin/admin.proto
+
+package admin
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Admin_GetConfig_FullMethodName           = "/runtime.iam.static.admin.v1.Admin/GetConfig"
+	Admin_PatchPolicy_FullMethodName         = "/runtime.iam.static.admin.v1.Admin/PatchPolicy"
+	Admin_GetStats_FullMethodName            = "/runtime.iam.static.admin.v1.Admin/GetStats"
+	Admin_ListFeatures_FullMethodName        = "/runtime.iam.static.admin.v1.Admin/ListFeatures"
+	Admin_SetFeature_FullMethodName          = "/runtime.iam.static.admin.v1.Admin/SetFeature"
+	Admin_ListExpiringGrants_FullMethodName  = "/runtime.iam.static.admin.v1.Admin/ListExpiringGrants"
+	Admin_GetCoverage_FullMethodName         = "/runtime.iam.static.admin.v1.Admin/GetCoverage"
+	Admin_GetSubjectUsage_FullMethodName     = "/runtime.iam.static.admin.v1.Admin/GetSubjectUsage"
+	Admin_EnableSubject_FullMethodName       = "/runtime.iam.static.admin.v1.Admin/EnableSubject"
+	Admin_ListPolicySnapshots_FullMethodName = "/runtime.iam.static.admin.v1.Admin/ListPolicySnapshots"
+	Admin_ExportPolicy_FullMethodName        = "/runtime.iam.static.admin.v1.Admin/ExportPolicy"
+	Admin_RollbackPolicy_FullMethodName      = "/runtime.iam.static.admin.v1.Admin/RollbackPolicy"
+	Admin_TailAudit_FullMethodName           = "/runtime.iam.static.admin.v1.Admin/TailAudit"
+	Admin_AckAudit_FullMethodName            = "/runtime.iam.static.admin.v1.Admin/AckAudit"
+	Admin_QueryAudit_FullMethodName          = "/runtime.iam.static.admin.v1.Admin/QueryAudit"
+	Admin_AddSubject_FullMethodName          = "/runtime.iam.static.admin.v1.Admin/AddSubject"
+	Admin_RemoveSubject_FullMethodName       = "/runtime.iam.static.admin.v1.Admin/RemoveSubject"
+	Admin_GrantAccess_FullMethodName         = "/runtime.iam.static.admin.v1.Admin/GrantAccess"
+	Admin_RevokeAccess_FullMethodName        = "/runtime.iam.static.admin.v1.Admin/RevokeAccess"
+	Admin_MintToken_FullMethodName           = "/runtime.iam.static.admin.v1.Admin/MintToken"
+)
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	// GetConfig returns the fully resolved runtime configuration.
+	GetConfig(ctx context.Context, in *GetConfigRequest, opts ...grpc.CallOption) (*GetConfigResponse, error)
+	// PatchPolicy applies a patch to the active policy document. The patched policy is validated
+	// and swapped in atomically; if it is invalid, the active policy is left unchanged.
+	PatchPolicy(ctx context.Context, in *PatchPolicyRequest, opts ...grpc.CallOption) (*PatchPolicyResponse, error)
+	// GetStats returns decision counters, the most recent decisions, and the active policy's
+	// revision, for monitoring a running instance.
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error)
+	// ListFeatures returns the settings of all known feature flags.
+	ListFeatures(ctx context.Context, in *ListFeaturesRequest, opts ...grpc.CallOption) (*ListFeaturesResponse, error)
+	// SetFeature enables or disables a feature flag globally or for a single subject. Changes are
+	// not persisted and are lost when the instance restarts.
+	SetFeature(ctx context.Context, in *SetFeatureRequest, opts ...grpc.CallOption) (*SetFeatureResponse, error)
+	// ListExpiringGrants returns the grants in the active policy that have not yet expired, soonest
+	// first.
+	ListExpiringGrants(ctx context.Context, in *ListExpiringGrantsRequest, opts ...grpc.CallOption) (*ListExpiringGrantsResponse, error)
+	// GetCoverage returns how often each action of each grant in the active policy has allowed a
+	// request, so unused grants can be found and test suites checked for the grants they exercise.
+	GetCoverage(ctx context.Context, in *GetCoverageRequest, opts ...grpc.CallOption) (*GetCoverageResponse, error)
+	// GetSubjectUsage returns how many requests each subject in the active policy has made and when
+	// it was last seen, so stale subjects and their tokens can be found and pruned.
+	GetSubjectUsage(ctx context.Context, in *GetSubjectUsageRequest, opts ...grpc.CallOption) (*GetSubjectUsageResponse, error)
+	// EnableSubject enables a subject disabled for not having been seen for the stale-subject period
+	// again. The subject is then idle from the time it is enabled.
+	EnableSubject(ctx context.Context, in *EnableSubjectRequest, opts ...grpc.CallOption) (*EnableSubjectResponse, error)
+	// ListPolicySnapshots returns the active policy and the previously active policies retained in
+	// memory, newest first.
+	ListPolicySnapshots(ctx context.Context, in *ListPolicySnapshotsRequest, opts ...grpc.CallOption) (*ListPolicySnapshotsResponse, error)
+	// ExportPolicy returns the active policy for another instance to mirror, with every token
+	// replaced by its SHA-256 digest so the export holds no credentials. Exports require the admin
+	// token.
+	ExportPolicy(ctx context.Context, in *ExportPolicyRequest, opts ...grpc.CallOption) (*ExportPolicyResponse, error)
+	// RollbackPolicy makes a retained policy snapshot active again. The previously active policy is
+	// retained in its place. Rollbacks are audited with the caller's name and reason.
+	RollbackPolicy(ctx context.Context, in *RollbackPolicyRequest, opts ...grpc.CallOption) (*RollbackPolicyResponse, error)
+	// TailAudit streams audit records after a cursor, oldest first. Records are delivered at least
+	// once: a consumer that acknowledges what it has processed with AckAudit resumes after its last
+	// acknowledged record when it reconnects, even across restarts if the audit store is
+	// configured.
+	TailAudit(ctx context.Context, in *TailAuditRequest, opts ...grpc.CallOption) (Admin_TailAuditClient, error)
+	// AckAudit records that a consumer has processed the audit records up to and including a
+	// cursor.
+	AckAudit(ctx context.Context, in *AckAuditRequest, opts ...grpc.CallOption) (*AckAuditResponse, error)
+	// QueryAudit returns the retained audit records matching a filter, oldest first, a page at a
+	// time.
+	QueryAudit(ctx context.Context, in *QueryAuditRequest, opts ...grpc.CallOption) (*QueryAuditResponse, error)
+	// AddSubject adds a subject to the active policy. Like patches, mutations are validated and
+	// swapped in atomically, and are lost when the policy is reloaded from its source. Mutations
+	// require the admin token.
+	AddSubject(ctx context.Context, in *AddSubjectRequest, opts ...grpc.CallOption) (*AddSubjectResponse, error)
+	// RemoveSubject removes a subject from the active policy. Tokens minted for the subject stop
+	// authenticating.
+	RemoveSubject(ctx context.Context, in *RemoveSubjectRequest, opts ...grpc.CallOption) (*RemoveSubjectResponse, error)
+	// GrantAccess grants a subject actions on a resource in the active policy.
+	GrantAccess(ctx context.Context, in *GrantAccessRequest, opts ...grpc.CallOption) (*GrantAccessResponse, error)
+	// RevokeAccess revokes actions on a resource from a subject's grants in the active policy.
+	RevokeAccess(ctx context.Context, in *RevokeAccessRequest, opts ...grpc.CallOption) (*RevokeAccessResponse, error)
+	// MintToken issues an ephemeral token authenticating a subject until it expires. Minted tokens
+	// are kept in memory only, so they are invalidated when the instance restarts.
+	MintToken(ctx context.Context, in *MintTokenRequest, opts ...grpc.CallOption) (*MintTokenResponse, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) GetConfig(ctx context.Context, in *GetConfigRequest, opts ...grpc.CallOption) (*GetConfigResponse, error) {
+	out := new(GetConfigResponse)
+	err := c.cc.Invoke(ctx, Admin_GetConfig_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) PatchPolicy(ctx context.Context, in *PatchPolicyRequest, opts ...grpc.CallOption) (*PatchPolicyResponse, error) {
+	out := new(PatchPolicyResponse)
+	err := c.cc.Invoke(ctx, Admin_PatchPolicy_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error) {
+	out := new(GetStatsResponse)
+	err := c.cc.Invoke(ctx, Admin_GetStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListFeatures(ctx context.Context, in *ListFeaturesRequest, opts ...grpc.CallOption) (*ListFeaturesResponse, error) {
+	out := new(ListFeaturesResponse)
+	err := c.cc.Invoke(ctx, Admin_ListFeatures_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetFeature(ctx context.Context, in *SetFeatureRequest, opts ...grpc.CallOption) (*SetFeatureResponse, error) {
+	out := new(SetFeatureResponse)
+	err := c.cc.Invoke(ctx, Admin_SetFeature_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListExpiringGrants(ctx context.Context, in *ListExpiringGrantsRequest, opts ...grpc.CallOption) (*ListExpiringGrantsResponse, error) {
+	out := new(ListExpiringGrantsResponse)
+	err := c.cc.Invoke(ctx, Admin_ListExpiringGrants_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetCoverage(ctx context.Context, in *GetCoverageRequest, opts ...grpc.CallOption) (*GetCoverageResponse, error) {
+	out := new(GetCoverageResponse)
+	err := c.cc.Invoke(ctx, Admin_GetCoverage_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetSubjectUsage(ctx context.Context, in *GetSubjectUsageRequest, opts ...grpc.CallOption) (*GetSubjectUsageResponse, error) {
+	out := new(GetSubjectUsageResponse)
+	err := c.cc.Invoke(ctx, Admin_GetSubjectUsage_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) EnableSubject(ctx context.Context, in *EnableSubjectRequest, opts ...grpc.CallOption) (*EnableSubjectResponse, error) {
+	out := new(EnableSubjectResponse)
+	err := c.cc.Invoke(ctx, Admin_EnableSubject_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListPolicySnapshots(ctx context.Context, in *ListPolicySnapshotsRequest, opts ...grpc.CallOption) (*ListPolicySnapshotsResponse, error) {
+	out := new(ListPolicySnapshotsResponse)
+	err := c.cc.Invoke(ctx, Admin_ListPolicySnapshots_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ExportPolicy(ctx context.Context, in *ExportPolicyRequest, opts ...grpc.CallOption) (*ExportPolicyResponse, error) {
+	out := new(ExportPolicyResponse)
+	err := c.cc.Invoke(ctx, Admin_ExportPolicy_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RollbackPolicy(ctx context.Context, in *RollbackPolicyRequest, opts ...grpc.CallOption) (*RollbackPolicyResponse, error) {
+	out := new(RollbackPolicyResponse)
+	err := c.cc.Invoke(ctx, Admin_RollbackPolicy_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) TailAudit(ctx context.Context, in *TailAuditRequest, opts ...grpc.CallOption) (Admin_TailAuditClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Admin_ServiceDesc.Streams[0], Admin_TailAudit_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &adminTailAuditClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Admin_TailAuditClient interface {
+	Recv() (*AuditRecord, error)
+	grpc.ClientStream
+}
+
+type adminTailAuditClient struct {
+	grpc.ClientStream
+}
+
+func (x *adminTailAuditClient) Recv() (*AuditRecord, error) {
+	m := new(AuditRecord)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *adminClient) AckAudit(ctx context.Context, in *AckAuditRequest, opts ...grpc.CallOption) (*AckAuditResponse, error) {
+	out := new(AckAuditResponse)
+	err := c.cc.Invoke(ctx, Admin_AckAudit_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) QueryAudit(ctx context.Context, in *QueryAuditRequest, opts ...grpc.CallOption) (*QueryAuditResponse, error) {
+	out := new(QueryAuditResponse)
+	err := c.cc.Invoke(ctx, Admin_QueryAudit_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) AddSubject(ctx context.Context, in *AddSubjectRequest, opts ...grpc.CallOption) (*AddSubjectResponse, error) {
+	out := new(AddSubjectResponse)
+	err := c.cc.Invoke(ctx, Admin_AddSubject_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RemoveSubject(ctx context.Context, in *RemoveSubjectRequest, opts ...grpc.CallOption) (*RemoveSubjectResponse, error) {
+	out := new(RemoveSubjectResponse)
+	err := c.cc.Invoke(ctx, Admin_RemoveSubject_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GrantAccess(ctx context.Context, in *GrantAccessRequest, opts ...grpc.CallOption) (*GrantAccessResponse, error) {
+	out := new(GrantAccessResponse)
+	err := c.cc.Invoke(ctx, Admin_GrantAccess_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RevokeAccess(ctx context.Context, in *RevokeAccessRequest, opts ...grpc.CallOption) (*RevokeAccessResponse, error) {
+	out := new(RevokeAccessResponse)
+	err := c.cc.Invoke(ctx, Admin_RevokeAccess_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) MintToken(ctx context.Context, in *MintTokenRequest, opts ...grpc.CallOption) (*MintTokenResponse, error) {
+	out := new(MintTokenResponse)
+	err := c.cc.Invoke(ctx, Admin_MintToken_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	// GetConfig returns the fully resolved runtime configuration.
+	GetConfig(context.Context, *GetConfigRequest) (*GetConfigResponse, error)
+	// PatchPolicy applies a patch to the active policy document. The patched policy is validated
+	// and swapped in atomically; if it is invalid, the active policy is left unchanged.
+	PatchPolicy(context.Context, *PatchPolicyRequest) (*PatchPolicyResponse, error)
+	// GetStats returns decision counters, the most recent decisions, and the active policy's
+	// revision, for monitoring a running instance.
+	GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error)
+	// ListFeatures returns the settings of all known feature flags.
+	ListFeatures(context.Context, *ListFeaturesRequest) (*ListFeaturesResponse, error)
+	// SetFeature enables or disables a feature flag globally or for a single subject. Changes are
+	// not persisted and are lost when the instance restarts.
+	SetFeature(context.Context, *SetFeatureRequest) (*SetFeatureResponse, error)
+	// ListExpiringGrants returns the grants in the active policy that have not yet expired, soonest
+	// first.
+	ListExpiringGrants(context.Context, *ListExpiringGrantsRequest) (*ListExpiringGrantsResponse, error)
+	// GetCoverage returns how often each action of each grant in the active policy has allowed a
+	// request, so unused grants can be found and test suites checked for the grants they exercise.
+	GetCoverage(context.Context, *GetCoverageRequest) (*GetCoverageResponse, error)
+	// GetSubjectUsage returns how many requests each subject in the active policy has made and when
+	// it was last seen, so stale subjects and their tokens can be found and pruned.
+	GetSubjectUsage(context.Context, *GetSubjectUsageRequest) (*GetSubjectUsageResponse, error)
+	// EnableSubject enables a subject disabled for not having been seen for the stale-subject period
+	// again. The subject is then idle from the time it is enabled.
+	EnableSubject(context.Context, *EnableSubjectRequest) (*EnableSubjectResponse, error)
+	// ListPolicySnapshots returns the active policy and the previously active policies retained in
+	// memory, newest first.
+	ListPolicySnapshots(context.Context, *ListPolicySnapshotsRequest) (*ListPolicySnapshotsResponse, error)
+	// ExportPolicy returns the active policy for another instance to mirror, with every token
+	// replaced by its SHA-256 digest so the export holds no credentials. Exports require the admin
+	// token.
+	ExportPolicy(context.Context, *ExportPolicyRequest) (*ExportPolicyResponse, error)
+	// RollbackPolicy makes a retained policy snapshot active again. The previously active policy is
+	// retained in its place. Rollbacks are audited with the caller's name and reason.
+	RollbackPolicy(context.Context, *RollbackPolicyRequest) (*RollbackPolicyResponse, error)
+	// TailAudit streams audit records after a cursor, oldest first. Records are delivered at least
+	// once: a consumer that acknowledges what it has processed with AckAudit resumes after its last
+	// acknowledged record when it reconnects, even across restarts if the audit store is
+	// configured.
+	TailAudit(*TailAuditRequest, Admin_TailAuditServer) error
+	// AckAudit records that a consumer has processed the audit records up to and including a
+	// cursor.
+	AckAudit(context.Context, *AckAuditRequest) (*AckAuditResponse, error)
+	// QueryAudit returns the retained audit records matching a filter, oldest first, a page at a
+	// time.
+	QueryAudit(context.Context, *QueryAuditRequest) (*QueryAuditResponse, error)
+	// AddSubject adds a subject to the active policy. Like patches, mutations are validated and
+	// swapped in atomically, and are lost when the policy is reloaded from its source. Mutations
+	// require the admin token.
+	AddSubject(context.Context, *AddSubjectRequest) (*AddSubjectResponse, error)
+	// RemoveSubject removes a subject from the active policy. Tokens minted for the subject stop
+	// authenticating.
+	RemoveSubject(context.Context, *RemoveSubjectRequest) (*RemoveSubjectResponse, error)
+	// GrantAccess grants a subject actions on a resource in the active policy.
+	GrantAccess(context.Context, *GrantAccessRequest) (*GrantAccessResponse, error)
+	// RevokeAccess revokes actions on a resource from a subject's grants in the active policy.
+	RevokeAccess(context.Context, *RevokeAccessRequest) (*RevokeAccessResponse, error)
+	// MintToken issues an ephemeral token authenticating a subject until it expires. Minted tokens
+	// are kept in memory only, so they are invalidated when the instance restarts.
+	MintToken(context.Context, *MintTokenRequest) (*MintTokenResponse, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) GetConfig(context.Context, *GetConfigRequest) (*GetConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConfig not implemented")
+}
+func (UnimplementedAdminServer) PatchPolicy(context.Context, *PatchPolicyRequest) (*PatchPolicyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PatchPolicy not implemented")
+}
+func (UnimplementedAdminServer) GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedAdminServer) ListFeatures(context.Context, *ListFeaturesRequest) (*ListFeaturesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFeatures not implemented")
+}
+func (UnimplementedAdminServer) SetFeature(context.Context, *SetFeatureRequest) (*SetFeatureResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetFeature not implemented")
+}
+func (UnimplementedAdminServer) ListExpiringGrants(context.Context, *ListExpiringGrantsRequest) (*ListExpiringGrantsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListExpiringGrants not implemented")
+}
+func (UnimplementedAdminServer) GetCoverage(context.Context, *GetCoverageRequest) (*GetCoverageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCoverage not implemented")
+}
+func (UnimplementedAdminServer) GetSubjectUsage(context.Context, *GetSubjectUsageRequest) (*GetSubjectUsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSubjectUsage not implemented")
+}
+func (UnimplementedAdminServer) EnableSubject(context.Context, *EnableSubjectRequest) (*EnableSubjectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnableSubject not implemented")
+}
+func (UnimplementedAdminServer) ListPolicySnapshots(context.Context, *ListPolicySnapshotsRequest) (*ListPolicySnapshotsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPolicySnapshots not implemented")
+}
+func (UnimplementedAdminServer) ExportPolicy(context.Context, *ExportPolicyRequest) (*ExportPolicyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportPolicy not implemented")
+}
+func (UnimplementedAdminServer) RollbackPolicy(context.Context, *RollbackPolicyRequest) (*RollbackPolicyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RollbackPolicy not implemented")
+}
+func (UnimplementedAdminServer) TailAudit(*TailAuditRequest, Admin_TailAuditServer) error {
+	return status.Errorf(codes.Unimplemented, "method TailAudit not implemented")
+}
+func (UnimplementedAdminServer) AckAudit(context.Context, *AckAuditRequest) (*AckAuditResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AckAudit not implemented")
+}
+func (UnimplementedAdminServer) QueryAudit(context.Context, *QueryAuditRequest) (*QueryAuditResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryAudit not implemented")
+}
+func (UnimplementedAdminServer) AddSubject(context.Context, *AddSubjectRequest) (*AddSubjectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddSubject not implemented")
+}
+func (UnimplementedAdminServer) RemoveSubject(context.Context, *RemoveSubjectRequest) (*RemoveSubjectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveSubject not implemented")
+}
+func (UnimplementedAdminServer) GrantAccess(context.Context, *GrantAccessRequest) (*GrantAccessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GrantAccess not implemented")
+}
+func (UnimplementedAdminServer) RevokeAccess(context.Context, *RevokeAccessRequest) (*RevokeAccessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeAccess not implemented")
+}
+func (UnimplementedAdminServer) MintToken(context.Context, *MintTokenRequest) (*MintTokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MintToken not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_GetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetConfig(ctx, req.(*GetConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_PatchPolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PatchPolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).PatchPolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_PatchPolicy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).PatchPolicy(ctx, req.(*PatchPolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListFeatures_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFeaturesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListFeatures(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListFeatures_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListFeatures(ctx, req.(*ListFeaturesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetFeature_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetFeatureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetFeature(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_SetFeature_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetFeature(ctx, req.(*SetFeatureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListExpiringGrants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListExpiringGrantsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListExpiringGrants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListExpiringGrants_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListExpiringGrants(ctx, req.(*ListExpiringGrantsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetCoverage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCoverageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetCoverage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetCoverage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetCoverage(ctx, req.(*GetCoverageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetSubjectUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSubjectUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetSubjectUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetSubjectUsage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetSubjectUsage(ctx, req.(*GetSubjectUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_EnableSubject_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnableSubjectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).EnableSubject(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_EnableSubject_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).EnableSubject(ctx, req.(*EnableSubjectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListPolicySnapshots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPolicySnapshotsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListPolicySnapshots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListPolicySnapshots_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListPolicySnapshots(ctx, req.(*ListPolicySnapshotsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ExportPolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportPolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ExportPolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ExportPolicy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ExportPolicy(ctx, req.(*ExportPolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RollbackPolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RollbackPolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RollbackPolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_RollbackPolicy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RollbackPolicy(ctx, req.(*RollbackPolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_TailAudit_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TailAuditRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AdminServer).TailAudit(m, &adminTailAuditServer{stream})
+}
+
+type Admin_TailAuditServer interface {
+	Send(*AuditRecord) error
+	grpc.ServerStream
+}
+
+type adminTailAuditServer struct {
+	grpc.ServerStream
+}
+
+func (x *adminTailAuditServer) Send(m *AuditRecord) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Admin_AckAudit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AckAuditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).AckAudit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_AckAudit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).AckAudit(ctx, req.(*AckAuditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_QueryAudit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryAuditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).QueryAudit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_QueryAudit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).QueryAudit(ctx, req.(*QueryAuditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_AddSubject_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddSubjectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).AddSubject(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_AddSubject_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).AddSubject(ctx, req.(*AddSubjectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RemoveSubject_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveSubjectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RemoveSubject(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_RemoveSubject_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RemoveSubject(ctx, req.(*RemoveSubjectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GrantAccess_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GrantAccessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GrantAccess(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GrantAccess_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GrantAccess(ctx, req.(*GrantAccessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RevokeAccess_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeAccessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RevokeAccess(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_RevokeAccess_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RevokeAccess(ctx, req.(*RevokeAccessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_MintToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MintTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).MintToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_MintToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).MintToken(ctx, req.(*MintTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "runtime.iam.static.admin.v1.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetConfig",
+			Handler:    _Admin_GetConfig_Handler,
+		},
+		{
+			MethodName: "PatchPolicy",
+			Handler:    _Admin_PatchPolicy_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _Admin_GetStats_Handler,
+		},
+		{
+			MethodName: "ListFeatures",
+			Handler:    _Admin_ListFeatures_Handler,
+		},
+		{
+			MethodName: "SetFeature",
+			Handler:    _Admin_SetFeature_Handler,
+		},
+		{
+			MethodName: "ListExpiringGrants",
+			Handler:    _Admin_ListExpiringGrants_Handler,
+		},
+		{
+			MethodName: "GetCoverage",
+			Handler:    _Admin_GetCoverage_Handler,
+		},
+		{
+			MethodName: "GetSubjectUsage",
+			Handler:    _Admin_GetSubjectUsage_Handler,
+		},
+		{
+			MethodName: "EnableSubject",
+			Handler:    _Admin_EnableSubject_Handler,
+		},
+		{
+			MethodName: "ListPolicySnapshots",
+			Handler:    _Admin_ListPolicySnapshots_Handler,
+		},
+		{
+			MethodName: "ExportPolicy",
+			Handler:    _Admin_ExportPolicy_Handler,
+		},
+		{
+			MethodName: "RollbackPolicy",
+			Handler:    _Admin_RollbackPolicy_Handler,
+		},
+		{
+			MethodName: "AckAudit",
+			Handler:    _Admin_AckAudit_Handler,
+		},
+		{
+			MethodName: "QueryAudit",
+			Handler:    _Admin_QueryAudit_Handler,
+		},
+		{
+			MethodName: "AddSubject",
+			Handler:    _Admin_AddSubject_Handler,
+		},
+		{
+			MethodName: "RemoveSubject",
+			Handler:    _Admin_RemoveSubject_Handler,
+		},
+		{
+			MethodName: "GrantAccess",
+			Handler:    _Admin_GrantAccess_Handler,
+		},
+		{
+			MethodName: "RevokeAccess",
+			Handler:    _Admin_RevokeAccess_Handler,
+		},
+		{
+			MethodName: "MintToken",
+			Handler:    _Admin_MintToken_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "TailAudit",
+			Handler:       _Admin_TailAudit_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "admin/admin.proto",
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds the decision cache. When it is full, expired entries are evicted, and if
+// none have expired the cache is cleared.
+const maxCacheEntries = 4096
+
+type cacheEntry struct {
+	err     error
+	expires time.Time
+}
+
+// decisionCache caches CheckAccess results keyed by credential and requested actions.
+type decisionCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	now     func() time.Time
+}
+
+func newDecisionCache() *decisionCache {
+	return &decisionCache{
+		entries: make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// cacheKey identifies a check without keeping the credential in memory. onBehalfOf is the
+// delegated subject, if any.
+func cacheKey(credential, onBehalfOf string, actions []Action) string {
+	h := sha256.New()
+	h.Write([]byte(credential))
+	h.Write([]byte{0})
+	h.Write([]byte(onBehalfOf))
+
+	for _, a := range actions {
+		h.Write([]byte{0})
+		h.Write([]byte(a.Action))
+		h.Write([]byte{0})
+		h.Write([]byte(a.ResourceID))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *decisionCache) get(key string) (error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !c.now().Before(entry.expires) {
+		return nil, false
+	}
+
+	return entry.err, true
+}
+
+func (c *decisionCache) put(key string, err error, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	if len(c.entries) >= maxCacheEntries {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+
+		if len(c.entries) >= maxCacheEntries {
+			c.entries = make(map[string]cacheEntry)
+		}
+	}
+
+	c.entries[key] = cacheEntry{err: err, expires: now.Add(ttl)}
+}
+
+// cacheable reports whether a CheckAccess result may be cached. Only decisions are cached;
+// transport and credential failures are not.
+func cacheable(err error) bool {
+	if err == nil {
+		return true
+	}
+
+	return errors.Is(err, ErrPermissionDenied)
+}
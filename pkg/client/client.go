@@ -0,0 +1,307 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/listener"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/credentials"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/identity"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authentication"
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// CacheTTLHeader is the response header in which the runtime hints how long a CheckAccess result
+// may be cached, as a Go duration string.
+const CacheTTLHeader = "iam-runtime-static-cache-ttl"
+
+// MatchedRulesTrailer is the response trailer in which the runtime lists, comma-separated, the
+// rule IDs of the policy grants that allowed a CheckAccess request.
+const MatchedRulesTrailer = "iam-runtime-static-matched-rules"
+
+// onBehalfOfHeader is the request metadata key naming the subject a delegated request is made for.
+const onBehalfOfHeader = "on-behalf-of"
+
+// DefaultMaxAttempts is the default number of attempts for calls that fail with Unavailable. With
+// the default backoff, calls are retried for about 1.5 seconds.
+const DefaultMaxAttempts = 5
+
+// Action is an action to check on a resource.
+type Action struct {
+	Action     string
+	ResourceID string
+}
+
+// CredentialInfo describes one of a subject's credentials, without revealing it.
+type CredentialInfo struct {
+	// Fingerprint is the first 16 hex characters of the SHA-256 digest of the credential.
+	Fingerprint string
+	// Source is env, file, sha256, or exec for policy tokens, rotated for credentials issued by
+	// rotation, oauth2 for OAuth2 access tokens, and minted for minted tokens.
+	Source string
+	// Ref is the environment variable or file of a policy token, or the OAuth2 client of an access
+	// token.
+	Ref string
+	// ExpiresAt is when the credential stops being accepted, or zero if it does not expire.
+	ExpiresAt time.Time
+	// LastUsedAt is when the credential last authenticated a request, or zero if it has not since
+	// the runtime started.
+	LastUsedAt time.Time
+	// Current reports whether the credential is the one the listing was authenticated with.
+	Current bool
+}
+
+// TypeResourceID returns the resource ID of a resource type in a parent, such as
+// type:loadbalancer@tnntten-a, for checking actions on resources that do not exist yet, such as
+// creating one. If parentID is empty, it is the ID of the type alone, such as type:loadbalancer.
+func TypeResourceID(resourceType, parentID string) string {
+	if parentID == "" {
+		return "type:" + resourceType
+	}
+
+	return "type:" + resourceType + "@" + parentID
+}
+
+// Client calls the authentication, authorization, identity, and credentials services of
+// iam-runtime-static.
+type Client struct {
+	conn  *grpc.ClientConn
+	authn authentication.AuthenticationClient
+	authz authorization.AuthorizationClient
+	ident identity.IdentityClient
+	creds credentials.CredentialsClient
+
+	cache      *decisionCache
+	defaultTTL time.Duration
+}
+
+type options struct {
+	maxAttempts int
+	defaultTTL  time.Duration
+	dialOpts    []grpc.DialOption
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+// WithMaxAttempts sets the number of attempts for calls that fail because the runtime is
+// unavailable, such as while it restarts. A value of 1 disables retries.
+func WithMaxAttempts(n int) Option {
+	return func(o *options) {
+		o.maxAttempts = n
+	}
+}
+
+// WithDefaultCacheTTL caches CheckAccess results for d when the runtime sends no cache TTL hint.
+// By default, results are only cached when the runtime sends a hint.
+func WithDefaultCacheTTL(d time.Duration) Option {
+	return func(o *options) {
+		o.defaultTTL = d
+	}
+}
+
+// WithDialOptions adds gRPC dial options, such as interceptors.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOpts = append(o.dialOpts, opts...)
+	}
+}
+
+// New creates a client for the runtime listening on address, which takes the same forms as the
+// runtime's --listen flag: a Unix socket path, or tcp://host:port.
+func New(address string, opts ...Option) (*Client, error) {
+	o := options{
+		maxAttempts: DefaultMaxAttempts,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	addr, err := listener.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+
+	if o.maxAttempts > 1 {
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(retryInterceptor(o.maxAttempts)))
+	}
+
+	conn, err := grpc.Dial(addr.DialTarget(), append(dialOpts, o.dialOpts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		conn:       conn,
+		authn:      authentication.NewAuthenticationClient(conn),
+		authz:      authorization.NewAuthorizationClient(conn),
+		ident:      identity.NewIdentityClient(conn),
+		creds:      credentials.NewCredentialsClient(conn),
+		cache:      newDecisionCache(),
+		defaultTTL: o.defaultTTL,
+	}, nil
+}
+
+// NewFromServices creates a client calling the given service clients instead of dialing the
+// runtime, such as those of an in-process fake from package fake. Options for dialing and retries
+// have no effect, and Close does nothing.
+func NewFromServices(authn authentication.AuthenticationClient, authz authorization.AuthorizationClient, ident identity.IdentityClient, creds credentials.CredentialsClient, opts ...Option) *Client {
+	var o options
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Client{
+		authn:      authn,
+		authz:      authz,
+		ident:      ident,
+		creds:      creds,
+		cache:      newDecisionCache(),
+		defaultTTL: o.defaultTTL,
+	}
+}
+
+// Close closes the connection to the runtime.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	return c.conn.Close()
+}
+
+// AuthenticateSubject returns the claims of the subject the credential belongs to.
+func (c *Client) AuthenticateSubject(ctx context.Context, credential string) (map[string]string, error) {
+	resp, err := c.authn.AuthenticateSubject(ctx, &authentication.AuthenticateSubjectRequest{
+		Credential: credential,
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	return resp.SubjectClaims, nil
+}
+
+// CheckAccess returns nil if the subject the credential belongs to may perform every action, or
+// an error wrapping ErrPermissionDenied if it may not, whose Denied field lists every denied action.
+// Results are cached as hinted by the runtime.
+func (c *Client) CheckAccess(ctx context.Context, credential string, actions ...Action) error {
+	key := cacheKey(credential, outgoingOnBehalfOf(ctx), actions)
+
+	if err, ok := c.cache.get(key); ok {
+		return err
+	}
+
+	req := &authorization.CheckAccessRequest{
+		Credential: credential,
+	}
+
+	for _, a := range actions {
+		req.Actions = append(req.Actions, &authorization.AccessRequestAction{
+			Action:     a.Action,
+			ResourceId: a.ResourceID,
+		})
+	}
+
+	var header metadata.MD
+
+	_, err := c.authz.CheckAccess(ctx, req, grpc.Header(&header))
+	err = wrapError(err)
+	setDenied(err, actions)
+
+	if cacheable(err) {
+		c.cache.put(key, err, c.cacheTTL(header))
+	}
+
+	return err
+}
+
+// GetAccessToken returns the access token of the runtime's workload identity.
+func (c *Client) GetAccessToken(ctx context.Context) (string, error) {
+	resp, err := c.ident.GetAccessToken(ctx, &identity.GetAccessTokenRequest{})
+	if err != nil {
+		return "", wrapError(err)
+	}
+
+	return resp.Token, nil
+}
+
+// RotateCredential replaces the subject's credential with a new one, which is returned along with
+// when the replaced credential stops being accepted. The new credential cannot be retrieved again.
+func (c *Client) RotateCredential(ctx context.Context, credential string) (string, time.Time, error) {
+	resp, err := c.creds.RotateCredential(ctx, &credentials.RotateCredentialRequest{Credential: credential})
+	if err != nil {
+		return "", time.Time{}, wrapError(err)
+	}
+
+	return resp.Credential, resp.PreviousExpiresAt.AsTime(), nil
+}
+
+// ListCredentials returns metadata about the credentials of the subject authenticated by
+// credential.
+func (c *Client) ListCredentials(ctx context.Context, credential string) ([]CredentialInfo, error) {
+	resp, err := c.creds.ListCredentials(ctx, &credentials.ListCredentialsRequest{Credential: credential})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	out := make([]CredentialInfo, len(resp.Credentials))
+
+	for i, info := range resp.Credentials {
+		out[i] = CredentialInfo{
+			Fingerprint: info.Fingerprint,
+			Source:      info.Source,
+			Ref:         info.Ref,
+			Current:     info.Current,
+		}
+
+		if info.ExpiresAt != nil {
+			out[i].ExpiresAt = info.ExpiresAt.AsTime()
+		}
+
+		if info.LastUsedAt != nil {
+			out[i].LastUsedAt = info.LastUsedAt.AsTime()
+		}
+	}
+
+	return out, nil
+}
+
+// cacheTTL returns the cache TTL hinted in the response header, or the default TTL.
+func (c *Client) cacheTTL(header metadata.MD) time.Duration {
+	values := header.Get(CacheTTLHeader)
+	if len(values) == 0 {
+		return c.defaultTTL
+	}
+
+	ttl, err := time.ParseDuration(values[0])
+	if err != nil {
+		return c.defaultTTL
+	}
+
+	return ttl
+}
+
+func outgoingOnBehalfOf(ctx context.Context) string {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(onBehalfOfHeader)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
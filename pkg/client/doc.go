@@ -0,0 +1,4 @@
+// Package client provides a client for iam-runtime-static configured for its semantics: it dials
+// Unix socket or TCP listen addresses, retries calls while the runtime is unavailable, caches
+// access decisions for as long as the runtime allows, and returns typed errors.
+package client
@@ -0,0 +1,284 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrUnauthenticated is returned when the runtime does not recognize the credential.
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrInvalidCredential matches errors for credentials the runtime rejected: every
+	// ErrUnauthenticated error, and credentials refused before being looked up, such as those
+	// longer than the runtime accepts. It does not match failures to verify a valid credential,
+	// such as when JWT signing keys are unavailable.
+	ErrInvalidCredential = errors.New("invalid credential")
+	// ErrPermissionDenied is returned when the subject may not perform a requested action.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrUnavailable is returned when the runtime could not be reached after retrying.
+	ErrUnavailable = errors.New("runtime unavailable")
+)
+
+// ReasonDomain is the ErrorInfo domain of the runtime's denials.
+const ReasonDomain = "iam-runtime-static"
+
+// Reason codes set on Error for denials. They are stable across releases, unlike messages.
+const (
+	// ReasonCredentialTooLong is set when the credential is longer than the runtime accepts.
+	ReasonCredentialTooLong = "CREDENTIAL_TOO_LONG"
+	// ReasonInvalidCredential is set when the credential is not recognized.
+	ReasonInvalidCredential = "INVALID_CREDENTIAL"
+	// ReasonPrivateKeyCredential is set when the credential looks like a PEM private key.
+	ReasonPrivateKeyCredential = "PRIVATE_KEY_CREDENTIAL"
+	// ReasonUnexpectedJWT is set when the credential looks like a JWT, but only opaque tokens are
+	// accepted.
+	ReasonUnexpectedJWT = "UNEXPECTED_JWT"
+	// ReasonCredentialWhitespace is set when the credential has leading or trailing whitespace.
+	ReasonCredentialWhitespace = "CREDENTIAL_WHITESPACE"
+	// ReasonCredentialAuthScheme is set when the credential starts with an authorization scheme,
+	// given in the scheme metadata.
+	ReasonCredentialAuthScheme = "CREDENTIAL_AUTH_SCHEME"
+	// ReasonJWTRequired is set when the credential is not a JWT, but only JWTs are accepted.
+	ReasonJWTRequired = "JWT_REQUIRED"
+	// ReasonJWTInvalid is set when a JWT fails verification.
+	ReasonJWTInvalid = "JWT_INVALID"
+	// ReasonJWTSubjectUnmapped is set when a JWT's issuer and subject are not mapped to a policy
+	// subject.
+	ReasonJWTSubjectUnmapped = "JWT_SUBJECT_UNMAPPED"
+	// ReasonSigningKeysUnavailable is set when the keys to verify JWTs could not be fetched.
+	ReasonSigningKeysUnavailable = "SIGNING_KEYS_UNAVAILABLE"
+	// ReasonCapabilityInvalid is set when a capability token is malformed, expired, or not signed
+	// with the runtime's signing key.
+	ReasonCapabilityInvalid = "CAPABILITY_INVALID"
+	// ReasonCapabilitySubjectUnknown is set when a capability token's subject is not in the policy.
+	ReasonCapabilitySubjectUnknown = "CAPABILITY_SUBJECT_UNKNOWN"
+	// ReasonForeignCredential is set when the credential lacks the runtime's credential prefix.
+	ReasonForeignCredential = "FOREIGN_CREDENTIAL"
+	// ReasonNetworkDenied is set when the subject may not be used from the caller's address.
+	ReasonNetworkDenied = "NETWORK_DENIED"
+	// ReasonDelegationDenied is set when the subject may not act on behalf of the requested
+	// principal.
+	ReasonDelegationDenied = "DELEGATION_DENIED"
+	// ReasonDelegatedActionDenied is set when an action is not both delegated and permitted for
+	// the principal.
+	ReasonDelegatedActionDenied = "DELEGATED_ACTION_DENIED"
+	// ReasonActionDenied is set when the subject may not perform an action on a resource.
+	ReasonActionDenied = "ACTION_DENIED"
+	// ReasonUndeclaredNames is set when an access check names actions or resources the policy
+	// does not declare.
+	ReasonUndeclaredNames = "UNDECLARED_NAMES"
+	// ReasonEnrichmentFailed is set when a required claim enricher failed.
+	ReasonEnrichmentFailed = "ENRICHMENT_FAILED"
+	// ReasonWorkloadIdentityRequired is set when the policy defines several identities and the
+	// runtime was not told which to serve.
+	ReasonWorkloadIdentityRequired = "WORKLOAD_IDENTITY_REQUIRED"
+	// ReasonUnknownIdentity is set when the workload identity is not defined by the policy.
+	ReasonUnknownIdentity = "UNKNOWN_IDENTITY"
+	// ReasonRotationDisabled is set when rotating a credential while rotation is not enabled.
+	ReasonRotationDisabled = "ROTATION_DISABLED"
+	// ReasonCredentialNotRotatable is set when rotating a credential that is neither a policy token
+	// nor a rotated credential, such as a JWT.
+	ReasonCredentialNotRotatable = "CREDENTIAL_NOT_ROTATABLE"
+	// ReasonCredentialRetired is set when rotating a credential that was already replaced.
+	ReasonCredentialRetired = "CREDENTIAL_RETIRED"
+	// ReasonConnectionLimitExceeded is set when the subject already holds the most connections
+	// the runtime allows per subject.
+	ReasonConnectionLimitExceeded = "CONNECTION_LIMIT_EXCEEDED"
+	// ReasonStreamLimitExceeded is set when the subject already has the most requests in progress
+	// the runtime allows per subject.
+	ReasonStreamLimitExceeded = "STREAM_LIMIT_EXCEEDED"
+	// ReasonInjectedFault is set when the call failed because of an RPC profile emulating a
+	// misbehaving runtime.
+	ReasonInjectedFault = "INJECTED_FAULT"
+	// ReasonCrossTenant is set when a subject scoped to a tenant was denied access to a resource
+	// of another tenant.
+	ReasonCrossTenant = "CROSS_TENANT"
+	// ReasonSubjectDisabled is set when the subject was disabled for not having been seen for the
+	// runtime's stale-subject period.
+	ReasonSubjectDisabled = "SUBJECT_DISABLED"
+	// ReasonNoActions is set when an access check names no actions and the runtime does not allow
+	// such checks.
+	ReasonNoActions = "NO_ACTIONS"
+	// ReasonDuplicateActions is set when an access check names an action on a resource more than
+	// once and the runtime rejects such checks.
+	ReasonDuplicateActions = "DUPLICATE_ACTIONS"
+	// ReasonEvaluationBudgetExceeded is set when evaluating an access check took more work than the
+	// runtime's evaluation budget allows. The check's decisions are unknown.
+	ReasonEvaluationBudgetExceeded = "EVALUATION_BUDGET_EXCEEDED"
+)
+
+// Error is returned for failed calls. It wraps one of the sentinel errors when the failure maps to
+// one, so callers can use errors.Is.
+type Error struct {
+	// Code is the gRPC status code returned by the runtime.
+	Code codes.Code
+	// Message is the runtime's description of the failure.
+	Message string
+	// Reason is the stable reason code for a denial, such as ReasonActionDenied, or empty if the
+	// runtime did not give one.
+	Reason string
+	// Metadata holds the denial's fields, such as action and resource_id.
+	Metadata map[string]string
+	// Denied holds every denied action of a CheckAccess call, in request order. Reason and
+	// Metadata describe the first.
+	Denied []Action
+	// Hints explains why each denied action was denied, as actions[i]: hint, if the runtime serves
+	// denial hints. Hints are for developers to read; their wording may change.
+	Hints []string
+
+	kind error
+	// denied holds the request indexes of the denied actions.
+	denied []int
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	if e.kind == nil {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", e.kind, e.Message)
+}
+
+// Unwrap returns the sentinel error for the failure, if any.
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+// Is reports whether the failure matches target, for sentinels other than the one Unwrap returns.
+func (e *Error) Is(target error) bool {
+	if target != ErrInvalidCredential {
+		return false
+	}
+
+	return e.Code == codes.Unauthenticated || e.Reason == ReasonCredentialTooLong || e.Reason == ReasonForeignCredential
+}
+
+// As sets target to the denied action if target is a *ActionDeniedError and the failure is the
+// denial of an action on a resource.
+func (e *Error) As(target any) bool {
+	t, ok := target.(*ActionDeniedError)
+	if !ok {
+		return false
+	}
+
+	switch e.Reason {
+	case ReasonActionDenied, ReasonDelegatedActionDenied, ReasonCrossTenant:
+	default:
+		return false
+	}
+
+	*t = ActionDeniedError{
+		Action:     e.Metadata["action"],
+		ResourceID: e.Metadata["resource_id"],
+		Reason:     e.Reason,
+	}
+
+	return true
+}
+
+// ActionDeniedError describes a CheckAccess denial of an action on a resource. It is found with
+// errors.As on errors returned by Client, and wraps ErrPermissionDenied. When several actions were
+// denied, it describes the first; Error.Denied lists them all.
+type ActionDeniedError struct {
+	// Action is the denied action.
+	Action string
+	// ResourceID is the resource the action was denied on.
+	ResourceID string
+	// Reason is the denial's reason code, such as ReasonActionDenied.
+	Reason string
+}
+
+// Error implements error.
+func (e ActionDeniedError) Error() string {
+	return fmt.Sprintf("%s: %s on %s", ErrPermissionDenied, e.Action, e.ResourceID)
+}
+
+// Unwrap returns ErrPermissionDenied.
+func (e ActionDeniedError) Unwrap() error {
+	return ErrPermissionDenied
+}
+
+// wrapError converts a gRPC error into an *Error.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	out := &Error{
+		Code:    st.Code(),
+		Message: st.Message(),
+	}
+
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if d.Domain == ReasonDomain && out.Reason == "" {
+				out.Reason = d.Reason
+				out.Metadata = d.Metadata
+			}
+		case *errdetails.PreconditionFailure:
+			out.denied = append(out.denied, actionIndexes(d)...)
+		case *errdetails.DebugInfo:
+			out.Hints = append(out.Hints, d.StackEntries...)
+		}
+	}
+
+	switch st.Code() {
+	case codes.Unauthenticated:
+		out.kind = ErrUnauthenticated
+	case codes.PermissionDenied:
+		out.kind = ErrPermissionDenied
+	case codes.Unavailable:
+		out.kind = ErrUnavailable
+	}
+
+	return out
+}
+
+// actionIndexes returns the request indexes of the actions named by a denial's violations, whose
+// subjects have the form actions[i].
+func actionIndexes(failure *errdetails.PreconditionFailure) []int {
+	var out []int
+
+	for _, v := range failure.Violations {
+		idx, ok := strings.CutPrefix(v.Subject, "actions[")
+		if !ok {
+			continue
+		}
+
+		i, err := strconv.Atoi(strings.TrimSuffix(idx, "]"))
+		if err != nil {
+			continue
+		}
+
+		out = append(out, i)
+	}
+
+	return out
+}
+
+// setDenied fills in the denied actions of a CheckAccess error.
+func setDenied(err error, actions []Action) {
+	var e *Error
+	if !errors.As(err, &e) {
+		return
+	}
+
+	for _, i := range e.denied {
+		if i >= 0 && i < len(actions) {
+			e.Denied = append(e.Denied, actions[i])
+		}
+	}
+}
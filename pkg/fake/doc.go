@@ -0,0 +1,5 @@
+// Package fake provides in-process implementations of the runtime's client interfaces, backed
+// directly by the static runtime's policy engine. Calls go through the same authentication and
+// authorization code as the runtime, without sockets or gRPC, so unit tests get identical
+// decisions with no network overhead.
+package fake
@@ -0,0 +1,232 @@
+package fake
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/client"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/credentials"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/identity"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authentication"
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Runtime is an in-process static runtime serving a policy.
+type Runtime struct {
+	srv server.Server
+}
+
+type options struct {
+	getenv func(key string) string
+	logger *zap.SugaredLogger
+}
+
+// Option configures a Runtime.
+type Option func(*options)
+
+// WithEnv sets the function used to resolve the policy's token environment variables, so tests
+// can supply credentials without changing the process environment. By default, the process
+// environment is used.
+func WithEnv(getenv func(key string) string) Option {
+	return func(o *options) {
+		o.getenv = getenv
+	}
+}
+
+// WithLogger sets the logger the runtime logs to. By default, nothing is logged.
+func WithLogger(logger *zap.SugaredLogger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// New creates a runtime serving the policy read from r.
+func New(r io.Reader, opts ...Option) (*Runtime, error) {
+	o := newOptions(opts)
+
+	srv, err := server.NewServerFromReader(r, "fake", "", o.logger, o.serverOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Runtime{srv: srv}, nil
+}
+
+// NewFromFile creates a runtime serving the policy at path, which may be a directory of policy
+// files to merge.
+func NewFromFile(path string, opts ...Option) (*Runtime, error) {
+	o := newOptions(opts)
+
+	srv, err := server.NewServer(path, o.logger, o.serverOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Runtime{srv: srv}, nil
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		logger: zap.NewNop().Sugar(),
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// serverOptions returns the server options for o. Fakes never record metrics, so several can run
+// in one test binary.
+func (o options) serverOptions() []server.Option {
+	out := []server.Option{server.WithoutMetrics()}
+
+	if o.getenv != nil {
+		out = append(out, server.WithEnv(o.getenv))
+	}
+
+	return out
+}
+
+// UpdatePolicy replaces the runtime's policy with the one read from r. If the policy is invalid,
+// the active policy is unchanged.
+func (rt *Runtime) UpdatePolicy(r io.Reader) error {
+	return rt.srv.UpdatePolicy(r, "fake", "")
+}
+
+// Client returns a client calling the runtime in-process. Options for dialing and retries have no
+// effect.
+func (rt *Runtime) Client(opts ...client.Option) *client.Client {
+	return client.NewFromServices(rt.Authentication(), rt.Authorization(), rt.Identity(), rt.Credentials(), opts...)
+}
+
+// Authentication returns an authentication client calling the runtime in-process.
+func (rt *Runtime) Authentication() authentication.AuthenticationClient {
+	return authenticationClient{rt.srv}
+}
+
+// Authorization returns an authorization client calling the runtime in-process.
+func (rt *Runtime) Authorization() authorization.AuthorizationClient {
+	return authorizationClient{rt.srv}
+}
+
+// Identity returns an identity client calling the runtime in-process.
+func (rt *Runtime) Identity() identity.IdentityClient {
+	return identityClient{rt.srv}
+}
+
+// Credentials returns a credentials client calling the runtime in-process.
+func (rt *Runtime) Credentials() credentials.CredentialsClient {
+	return credentialsClient{rt.srv}
+}
+
+type authenticationClient struct {
+	srv server.Server
+}
+
+func (c authenticationClient) AuthenticateSubject(ctx context.Context, in *authentication.AuthenticateSubjectRequest, opts ...grpc.CallOption) (*authentication.AuthenticateSubjectResponse, error) {
+	return call(ctx, "/runtime.iam.v1.Authentication/AuthenticateSubject", in, c.srv.AuthenticateSubject, opts)
+}
+
+type authorizationClient struct {
+	srv server.Server
+}
+
+func (c authorizationClient) CheckAccess(ctx context.Context, in *authorization.CheckAccessRequest, opts ...grpc.CallOption) (*authorization.CheckAccessResponse, error) {
+	return call(ctx, "/runtime.iam.v1.Authorization/CheckAccess", in, c.srv.CheckAccess, opts)
+}
+
+func (c authorizationClient) CreateRelationships(ctx context.Context, in *authorization.CreateRelationshipsRequest, opts ...grpc.CallOption) (*authorization.CreateRelationshipsResponse, error) {
+	return call(ctx, "/runtime.iam.v1.Authorization/CreateRelationships", in, c.srv.CreateRelationships, opts)
+}
+
+func (c authorizationClient) DeleteRelationships(ctx context.Context, in *authorization.DeleteRelationshipsRequest, opts ...grpc.CallOption) (*authorization.DeleteRelationshipsResponse, error) {
+	return call(ctx, "/runtime.iam.v1.Authorization/DeleteRelationships", in, c.srv.DeleteRelationships, opts)
+}
+
+type identityClient struct {
+	srv server.Server
+}
+
+func (c identityClient) GetAccessToken(ctx context.Context, in *identity.GetAccessTokenRequest, opts ...grpc.CallOption) (*identity.GetAccessTokenResponse, error) {
+	return call(ctx, identity.Identity_GetAccessToken_FullMethodName, in, c.srv.GetAccessToken, opts)
+}
+
+type credentialsClient struct {
+	srv server.Server
+}
+
+func (c credentialsClient) RotateCredential(ctx context.Context, in *credentials.RotateCredentialRequest, opts ...grpc.CallOption) (*credentials.RotateCredentialResponse, error) {
+	return call(ctx, credentials.Credentials_RotateCredential_FullMethodName, in, c.srv.RotateCredential, opts)
+}
+
+func (c credentialsClient) ListCredentials(ctx context.Context, in *credentials.ListCredentialsRequest, opts ...grpc.CallOption) (*credentials.ListCredentialsResponse, error) {
+	return call(ctx, credentials.Credentials_ListCredentials_FullMethodName, in, c.srv.ListCredentials, opts)
+}
+
+// call calls handler as the runtime's gRPC server would for method: the outgoing metadata of ctx
+// is passed as incoming metadata, and the headers and trailers the handler sets are returned
+// through the grpc.Header and grpc.Trailer call options. Other call options are ignored.
+func call[Req, Resp any](ctx context.Context, method string, in Req, handler func(context.Context, Req) (Resp, error), opts []grpc.CallOption) (Resp, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+
+	stream := &transportStream{method: method}
+
+	ctx = metadata.NewIncomingContext(ctx, md.Copy())
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+
+	resp, err := handler(ctx, in)
+
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case grpc.HeaderCallOption:
+			*o.HeaderAddr = stream.header
+		case grpc.TrailerCallOption:
+			*o.TrailerAddr = stream.trailer
+		}
+	}
+
+	return resp, err
+}
+
+// transportStream collects the headers and trailers set by a handler.
+type transportStream struct {
+	method string
+
+	mu      sync.Mutex
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *transportStream) Method() string {
+	return s.method
+}
+
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.header = metadata.Join(s.header, md)
+
+	return nil
+}
+
+func (s *transportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *transportStream) SetTrailer(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.trailer = metadata.Join(s.trailer, md)
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidConfig is returned when a middleware configuration is malformed.
+var ErrInvalidConfig = errors.New("invalid middleware config")
+
+// Config maps HTTP routes and gRPC methods to the action and resource checked for them.
+type Config struct {
+	Routes  []Route  `yaml:"routes"`
+	Methods []Method `yaml:"methods"`
+	// AllowUnmatched passes requests that match no route or method without a check. By default
+	// they are denied.
+	AllowUnmatched bool `yaml:"allowUnmatched"`
+}
+
+// Route maps HTTP requests to an action on a resource.
+type Route struct {
+	// Method is the HTTP method to match, or empty to match any method.
+	Method string `yaml:"method"`
+	// Path is the path to match. Segments of the form {name} match any single segment, and their
+	// values can be used in Resource. A last segment of the form {name...} matches the rest of the
+	// path, and * matches any single segment without naming it.
+	Path   string `yaml:"path"`
+	Action string `yaml:"action"`
+	// Resource is the resource ID to check. {name} is replaced with the matching path segment,
+	// {query.name} with the value of a query parameter, and {header.name} with the value of a
+	// request header.
+	Resource string `yaml:"resource"`
+}
+
+// Method maps a gRPC method to an action on a resource.
+type Method struct {
+	// Name is the full method name, such as /pkg.Service/Method. A name ending in /* matches every
+	// method of the service.
+	Name   string `yaml:"name"`
+	Action string `yaml:"action"`
+	// Resource is the resource ID to check. {key} is replaced with the value of the incoming
+	// metadata key.
+	Resource string `yaml:"resource"`
+}
+
+// LoadConfig reads a YAML middleware configuration from r.
+func LoadConfig(r io.Reader) (Config, error) {
+	var out Config
+
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&out); err != nil {
+		return Config{}, err
+	}
+
+	if err := out.validate(); err != nil {
+		return Config{}, err
+	}
+
+	return out, nil
+}
+
+func (c Config) validate() error {
+	for _, r := range c.Routes {
+		if !strings.HasPrefix(r.Path, "/") || r.Action == "" || r.Resource == "" {
+			return fmt.Errorf("route %s %s: path, action, and resource are required: %w", r.Method, r.Path, ErrInvalidConfig)
+		}
+
+		segs := strings.Split(strings.Trim(r.Path, "/"), "/")
+		for i, seg := range segs[:len(segs)-1] {
+			if strings.HasSuffix(seg, "...}") {
+				return fmt.Errorf("route %s %s: segment %d: only the last segment can match the rest of the path: %w", r.Method, r.Path, i, ErrInvalidConfig)
+			}
+		}
+	}
+
+	for _, m := range c.Methods {
+		if !strings.HasPrefix(m.Name, "/") || m.Action == "" || m.Resource == "" {
+			return fmt.Errorf("method %s: name, action, and resource are required: %w", m.Name, ErrInvalidConfig)
+		}
+	}
+
+	return nil
+}
+
+// expand replaces {name} placeholders in template using lookup. Unknown names expand to empty.
+func expand(template string, lookup func(name string) string) string {
+	var b strings.Builder
+
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			break
+		}
+
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			break
+		}
+
+		b.WriteString(template[:start])
+		b.WriteString(lookup(template[start+1 : start+end]))
+
+		template = template[start+end+1:]
+	}
+
+	b.WriteString(template)
+
+	return b.String()
+}
@@ -0,0 +1,4 @@
+// Package middleware protects net/http handlers and gRPC services with iam-runtime-static. It
+// extracts bearer credentials from requests, maps routes and methods to actions on resources
+// using a small Config, and calls CheckAccess before passing requests on.
+package middleware
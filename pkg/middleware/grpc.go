@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/client"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a gRPC interceptor checking each call against the method it
+// matches. The credential is read from the authorization metadata as a bearer token.
+func UnaryServerInterceptor(checker Checker, cfg Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := checkMethod(ctx, checker, cfg, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor checking each stream against the method it
+// matches, before the stream is handled.
+func StreamServerInterceptor(checker Checker, cfg Config) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkMethod(ss.Context(), checker, cfg, info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func checkMethod(ctx context.Context, checker Checker, cfg Config, fullMethod string) error {
+	method, ok := matchMethod(cfg.Methods, fullMethod)
+	if !ok {
+		if cfg.AllowUnmatched {
+			return nil
+		}
+
+		return status.Errorf(codes.PermissionDenied, "method %s is not mapped to an action", fullMethod)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	credential, ok := bearerToken(first(md, "authorization"))
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing bearer credential")
+	}
+
+	action := client.Action{
+		Action: method.Action,
+		ResourceID: expand(method.Resource, func(key string) string {
+			return first(md, key)
+		}),
+	}
+
+	if err := checker.CheckAccess(ctx, credential, action); err != nil {
+		return status.Error(grpcCode(err), err.Error())
+	}
+
+	return nil
+}
+
+func matchMethod(methods []Method, fullMethod string) (Method, bool) {
+	for _, m := range methods {
+		if m.Name == fullMethod {
+			return m, true
+		}
+
+		if service, ok := strings.CutSuffix(m.Name, "*"); ok && strings.HasPrefix(fullMethod, service) {
+			return m, true
+		}
+	}
+
+	return Method{}, false
+}
+
+func first(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func grpcCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, client.ErrUnauthenticated):
+		return codes.Unauthenticated
+	case errors.Is(err, client.ErrPermissionDenied):
+		return codes.PermissionDenied
+	default:
+		return codes.Unavailable
+	}
+}
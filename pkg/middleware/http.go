@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/metal-toolbox/iam-runtime-static/pkg/client"
+)
+
+// Checker checks access for a credential. *client.Client implements Checker.
+type Checker interface {
+	CheckAccess(ctx context.Context, credential string, actions ...client.Action) error
+}
+
+// HTTP returns middleware checking each request against the route it matches. Requests without a
+// bearer credential get 401, denied requests get 403, and requests that could not be checked get
+// 503.
+func HTTP(checker Checker, cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			action, ok := cfg.MatchRoute(r)
+			if !ok {
+				if cfg.AllowUnmatched {
+					next.ServeHTTP(w, r)
+
+					return
+				}
+
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+
+				return
+			}
+
+			credential, ok := bearerToken(r.Header.Get("Authorization"))
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+				return
+			}
+
+			if err := checker.CheckAccess(r.Context(), credential, action); err != nil {
+				code := httpStatus(err)
+				http.Error(w, http.StatusText(code), code)
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MatchRoute returns the action and resource ID checked for an HTTP request, from the first route
+// it matches, so tools and gateways can resolve requests the way the middleware does.
+func (c Config) MatchRoute(r *http.Request) (client.Action, bool) {
+	for _, route := range c.Routes {
+		if route.Method != "" && route.Method != r.Method {
+			continue
+		}
+
+		params, ok := matchPath(route.Path, r.URL.Path)
+		if !ok {
+			continue
+		}
+
+		return client.Action{
+			Action: route.Action,
+			ResourceID: expand(route.Resource, func(name string) string {
+				if key, ok := strings.CutPrefix(name, "query."); ok {
+					return r.URL.Query().Get(key)
+				}
+
+				if key, ok := strings.CutPrefix(name, "header."); ok {
+					return r.Header.Get(key)
+				}
+
+				return params[name]
+			}),
+		}, true
+	}
+
+	return client.Action{}, false
+}
+
+// matchPath matches a path against a pattern whose {name} and * segments match any single segment,
+// and whose last segment, if of the form {name...}, matches the rest of the path.
+func matchPath(pattern, path string) (map[string]string, bool) {
+	patternSegs := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegs := strings.Split(strings.Trim(path, "/"), "/")
+
+	params := make(map[string]string)
+
+	for i, seg := range patternSegs {
+		if i >= len(pathSegs) || pathSegs[i] == "" && seg != "" {
+			return nil, false
+		}
+
+		switch {
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "...}") && i == len(patternSegs)-1:
+			params[seg[1:len(seg)-4]] = strings.Join(pathSegs[i:], "/")
+
+			return params, true
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+			params[seg[1:len(seg)-1]] = pathSegs[i]
+		case seg != "*" && seg != pathSegs[i]:
+			return nil, false
+		}
+	}
+
+	return params, len(patternSegs) == len(pathSegs)
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, client.ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, client.ErrPermissionDenied):
+		return http.StatusForbidden
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
@@ -0,0 +1,5 @@
+// Package staticruntime embeds the static runtime in a Go program, such as a test suite, serving a
+// policy built in Go or read from a reader over real gRPC. Unlike package fake, calls go through a
+// gRPC server and client, with their interceptors, metadata, and status handling, so tests see
+// the runtime exactly as a deployed service would, without running the binary.
+package staticruntime
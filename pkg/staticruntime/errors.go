@@ -0,0 +1,52 @@
+package staticruntime
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+)
+
+// ErrPolicyInvalid is returned when the runtime is given a policy it rejects. Errors wrapping it
+// are *PolicyError values, which say where the problem is.
+var ErrPolicyInvalid = errors.New("invalid policy")
+
+// PolicyError is returned when a policy is rejected, and wraps both ErrPolicyInvalid and the
+// runtime's error.
+type PolicyError struct {
+	// Path is the path of the field the problem concerns in the policy document, such as
+	// subjects[1].id, or empty if it is not known.
+	Path string
+	// Line is the 1-based line of the problem in the policy document, or 0 if it is not known. For
+	// policies given to Start and UpdatePolicy, it is a line of the document they are encoded as.
+	Line int
+	// Err is the runtime's error.
+	Err error
+}
+
+// Error implements error.
+func (e *PolicyError) Error() string {
+	// YAML syntax and type errors already give their line.
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %s", ErrPolicyInvalid, e.Err)
+	}
+
+	return fmt.Sprintf("%s: %s (line %d): %s", ErrPolicyInvalid, e.Path, e.Line, e.Err)
+}
+
+// Unwrap returns ErrPolicyInvalid and the runtime's error.
+func (e *PolicyError) Unwrap() []error {
+	return []error{ErrPolicyInvalid, e.Err}
+}
+
+// policyError returns a *PolicyError for err, an error loading the policy document data, or nil
+// if err is nil.
+func policyError(data []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	path, line := server.LocatePolicyError(data, err)
+
+	return &PolicyError{Path: path, Line: line, Err: err}
+}
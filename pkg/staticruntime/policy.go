@@ -0,0 +1,149 @@
+package staticruntime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy is a policy built in Go. It covers the common parts of the policy file format; policies
+// using other features can be read with StartFromReader instead.
+type Policy struct {
+	// Implies maps an action to the lesser actions it grants, such as an update action implying
+	// the matching get action. Implications are transitive.
+	Implies map[string][]string
+	// Contains maps a resource to the resources it contains, such as a tenant containing its load
+	// balancers. Grants on a resource apply to everything it contains, transitively.
+	Contains map[string][]string
+	// Tenants maps a tenant to the resources it owns, and so everything they contain. Subjects
+	// scoped to a tenant are denied access to resources of other tenants.
+	Tenants  map[string][]string
+	Roles    []Role
+	Subjects []Subject
+}
+
+// Role is a named set of grants that subjects and other roles can reference.
+type Role struct {
+	ID string
+	// Roles are the IDs of roles whose grants and denies this role includes.
+	Roles  []string
+	Grants []Grant
+	Deny   []Grant
+}
+
+// Subject is a caller authenticated by one of its tokens.
+type Subject struct {
+	ID string
+	// Tokens are the credentials the subject authenticates with. The runtime is only given their
+	// digests.
+	Tokens []string
+	// Roles are the IDs of the roles the subject holds.
+	Roles  []string
+	Grants []Grant
+	// Deny rejects actions even if a grant or role allows them.
+	Deny []Grant
+	// Claims are returned when the subject is authenticated.
+	Claims map[string]any
+	// Tenant, if set, scopes the subject to a tenant from Policy.Tenants, which is returned as
+	// its tenant claim.
+	Tenant string
+}
+
+// Grant names actions on a resource. The resource ID and actions may be patterns, such as
+// loadbalancer-* or *_get.
+type Grant struct {
+	ResourceID string
+	Actions    []string
+}
+
+// policyFile, fileRole, fileSubject, fileToken, and fileResource mirror the policy file format.
+type policyFile struct {
+	Implies  map[string][]string `yaml:"implies,omitempty"`
+	Contains map[string][]string `yaml:"contains,omitempty"`
+	Tenants  map[string][]string `yaml:"tenants,omitempty"`
+	Roles    []fileRole          `yaml:"roles,omitempty"`
+	Subjects []fileSubject       `yaml:"subjects"`
+}
+
+type fileRole struct {
+	ID        string         `yaml:"id"`
+	Roles     []string       `yaml:"roles,omitempty"`
+	Resources []fileResource `yaml:"resources"`
+	Deny      []fileResource `yaml:"deny,omitempty"`
+}
+
+type fileSubject struct {
+	ID        string         `yaml:"id"`
+	Tokens    []fileToken    `yaml:"tokens"`
+	Roles     []string       `yaml:"roles,omitempty"`
+	Resources []fileResource `yaml:"resources"`
+	Deny      []fileResource `yaml:"deny,omitempty"`
+	Claims    map[string]any `yaml:"claims,omitempty"`
+	Tenant    string         `yaml:"tenant,omitempty"`
+}
+
+type fileToken struct {
+	SHA256 string `yaml:"sha256"`
+}
+
+type fileResource struct {
+	ID      string   `yaml:"id"`
+	Actions []string `yaml:"actions"`
+}
+
+// encode writes p to w in the policy file format.
+func (p Policy) encode(w io.Writer) error {
+	out := policyFile{
+		Implies:  p.Implies,
+		Contains: p.Contains,
+		Tenants:  p.Tenants,
+		Roles:    make([]fileRole, len(p.Roles)),
+		Subjects: make([]fileSubject, len(p.Subjects)),
+	}
+
+	for i, role := range p.Roles {
+		out.Roles[i] = fileRole{
+			ID:        role.ID,
+			Roles:     role.Roles,
+			Resources: fileResources(role.Grants),
+			Deny:      fileResources(role.Deny),
+		}
+	}
+
+	for i, sub := range p.Subjects {
+		tokens := make([]fileToken, len(sub.Tokens))
+		for j, tok := range sub.Tokens {
+			digest := sha256.Sum256([]byte(tok))
+			tokens[j] = fileToken{SHA256: hex.EncodeToString(digest[:])}
+		}
+
+		out.Subjects[i] = fileSubject{
+			ID:        sub.ID,
+			Tokens:    tokens,
+			Roles:     sub.Roles,
+			Resources: fileResources(sub.Grants),
+			Deny:      fileResources(sub.Deny),
+			Claims:    sub.Claims,
+			Tenant:    sub.Tenant,
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+func fileResources(grants []Grant) []fileResource {
+	out := make([]fileResource, len(grants))
+	for i, g := range grants {
+		out[i] = fileResource{ID: g.ResourceID, Actions: g.Actions}
+	}
+
+	return out
+}
@@ -0,0 +1,290 @@
+package staticruntime
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/metal-toolbox/iam-runtime-static/internal/resourceid"
+	"github.com/metal-toolbox/iam-runtime-static/internal/server"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/client"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/credentials"
+	"github.com/metal-toolbox/iam-runtime-static/pkg/identity"
+
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authentication"
+	"github.com/metal-toolbox/iam-runtime/pkg/iam/runtime/authorization"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// policySource is the source reported for policies given to a Runtime.
+const policySource = "staticruntime"
+
+// bufconnSize is the buffer size of in-memory connections.
+const bufconnSize = 1 << 20
+
+// bufconnAddress is the address clients of an in-memory runtime are given. It is never resolved:
+// connections are made by the in-memory listener's dialer.
+const bufconnAddress = "tcp://bufconn:0"
+
+// Runtime is a static runtime served over gRPC in the current process.
+type Runtime struct {
+	srv  server.Server
+	grpc *grpc.Server
+
+	// address is the listen address clients dial, as accepted by client.New.
+	address  string
+	dialOpts []grpc.DialOption
+}
+
+type options struct {
+	getenv func(key string) string
+	logger *zap.SugaredLogger
+	socket bool
+	hints  bool
+	// ownership maps relations to the actions relationships of them grant
+	ownership map[string][]string
+	// normalizers are applied to resource IDs in order
+	normalizers []string
+}
+
+// Option configures a Runtime.
+type Option func(*options)
+
+// WithEnv sets the function used to resolve the policy's token environment variables, so tests
+// can supply credentials without changing the process environment. By default, the process
+// environment is used.
+func WithEnv(getenv func(key string) string) Option {
+	return func(o *options) {
+		o.getenv = getenv
+	}
+}
+
+// WithLogger sets the logger the runtime logs to. By default, nothing is logged.
+func WithLogger(logger *zap.SugaredLogger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithSocket serves the runtime on a Unix socket in a new temporary directory, which is removed
+// on cleanup, so it can also be reached by other processes, such as a service under test. By
+// default, the runtime is served on an in-memory connection only reachable from this process.
+func WithSocket() Option {
+	return func(o *options) {
+		o.socket = true
+	}
+}
+
+// WithDenialHints explains denied access checks: client.Error.Hints says, for each denied action,
+// why the policy does not allow it, such as the subject's nearest grant. By default, denials carry
+// no hints.
+func WithDenialHints() Option {
+	return func(o *options) {
+		o.hints = true
+	}
+}
+
+// WithOwnership makes relationships created with the CreateRelationships RPC grant actions: a
+// relationship of one of the relations, such as owner, from a resource to a policy subject grants
+// the subject the relation's actions on the resource, as an application creating a resource and
+// recording its creator as owner expects. By default, relationships grant nothing by themselves.
+func WithOwnership(relations map[string][]string) Option {
+	return func(o *options) {
+		o.ownership = relations
+	}
+}
+
+// WithResourceIDNormalization normalizes resource IDs in the policy and in requests with the given
+// normalizers, applied in order: lowercase, strip-url, which replaces a URL with the last segment
+// of its path, and uuid, which rewrites a UUID ending an ID in canonical form. Start fails if a
+// normalizer does not exist.
+func WithResourceIDNormalization(normalizers ...string) Option {
+	return func(o *options) {
+		o.normalizers = normalizers
+	}
+}
+
+// Start serves p and returns the runtime and a function stopping it, which must be called once
+// the runtime is no longer needed. If the policy is invalid, the error is a *PolicyError.
+func Start(p Policy, opts ...Option) (*Runtime, func(), error) {
+	var buf bytes.Buffer
+
+	if err := p.encode(&buf); err != nil {
+		return nil, nil, err
+	}
+
+	return StartFromReader(&buf, opts...)
+}
+
+// StartFromReader serves the policy read from r, in the policy file format, and returns the
+// runtime and a function stopping it, which must be called once the runtime is no longer needed.
+// If the policy is invalid, the error is a *PolicyError.
+func StartFromReader(r io.Reader, opts ...Option) (*Runtime, func(), error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	o := options{
+		logger: zap.NewNop().Sugar(),
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Runtimes never record metrics, so several can run in one test binary.
+	srvOpts := []server.Option{server.WithoutMetrics()}
+
+	if o.getenv != nil {
+		srvOpts = append(srvOpts, server.WithEnv(o.getenv))
+	}
+
+	if o.hints {
+		srvOpts = append(srvOpts, server.WithDenialHints())
+	}
+
+	if o.ownership != nil {
+		srvOpts = append(srvOpts, server.WithOwnership(o.ownership))
+	}
+
+	if len(o.normalizers) > 0 {
+		normalizer, err := resourceid.New(o.normalizers)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		srvOpts = append(srvOpts, server.WithResourceIDNormalizer(normalizer))
+	}
+
+	srv, err := server.NewServerFromReader(bytes.NewReader(data), policySource, "", o.logger, srvOpts...)
+	if err != nil {
+		return nil, nil, policyError(data, err)
+	}
+
+	rt := &Runtime{
+		srv: srv,
+		grpc: grpc.NewServer(
+			grpc.StatsHandler(srv.StatsHandler()),
+			grpc.ChainUnaryInterceptor(srv.EmulationUnaryInterceptor()),
+		),
+	}
+
+	authorization.RegisterAuthorizationServer(rt.grpc, srv)
+	authentication.RegisterAuthenticationServer(rt.grpc, srv)
+	identity.RegisterIdentityServer(rt.grpc, srv)
+	credentials.RegisterCredentialsServer(rt.grpc, srv)
+
+	lis, cleanupListener, err := rt.listen(o.socket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	go func() {
+		if err := rt.grpc.Serve(lis); err != nil {
+			o.logger.Warnw("runtime stopped serving", "error", err)
+		}
+	}()
+
+	cleanup := func() {
+		rt.grpc.Stop()
+		cleanupListener()
+	}
+
+	return rt, cleanup, nil
+}
+
+// listen opens the listener the runtime is served on, sets how clients reach it, and returns a
+// function releasing anything the listener left behind.
+func (rt *Runtime) listen(socket bool) (net.Listener, func(), error) {
+	if !socket {
+		lis := bufconn.Listen(bufconnSize)
+
+		rt.address = bufconnAddress
+		rt.dialOpts = []grpc.DialOption{
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		}
+
+		return lis, func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "staticruntime-")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path := filepath.Join(dir, "runtime.sock")
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+
+		return nil, nil, err
+	}
+
+	rt.address = path
+	rt.dialOpts = []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+
+	return lis, func() { os.RemoveAll(dir) }, nil
+}
+
+// Address returns the address the runtime listens on, in the forms accepted by client.New and the
+// runtime's --listen flag. With WithSocket, it is the socket path. Otherwise, it can only be
+// dialed with the options from DialOptions.
+func (rt *Runtime) Address() string {
+	return rt.address
+}
+
+// DialOptions returns the gRPC dial options needed to connect to the runtime at Address, for
+// clients other than those from Client. Dial Address as returned by Target.
+func (rt *Runtime) DialOptions() []grpc.DialOption {
+	return rt.dialOpts
+}
+
+// Target returns the gRPC dial target of the runtime, for use with DialOptions.
+func (rt *Runtime) Target() string {
+	if rt.address == bufconnAddress {
+		return "passthrough:///bufconn"
+	}
+
+	return "unix://" + rt.address
+}
+
+// Client returns a client connected to the runtime. Close it before stopping the runtime.
+func (rt *Runtime) Client(opts ...client.Option) (*client.Client, error) {
+	return client.New(rt.address, append([]client.Option{client.WithDialOptions(rt.dialOpts...)}, opts...)...)
+}
+
+// UpdatePolicy replaces the runtime's policy with p. If the policy is invalid, the active policy
+// is unchanged and the error is a *PolicyError.
+func (rt *Runtime) UpdatePolicy(p Policy) error {
+	var buf bytes.Buffer
+
+	if err := p.encode(&buf); err != nil {
+		return err
+	}
+
+	return rt.UpdatePolicyFromReader(&buf)
+}
+
+// UpdatePolicyFromReader replaces the runtime's policy with the one read from r. If the policy is
+// invalid, the active policy is unchanged and the error is a *PolicyError.
+func (rt *Runtime) UpdatePolicyFromReader(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return policyError(data, rt.srv.UpdatePolicy(bytes.NewReader(data), policySource, ""))
+}